@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"uno/lex/clone"
+)
+
+var clonesMode = &mode{
+	name:  "clones",
+	usage: "[-min n] [-ignore-identifiers] [-ignore-literals] [-format text|json] [flags] [file ...]",
+	run:   runClones,
+}
+
+type jsonLocation struct {
+	File      string `json:"file"`
+	StartLine uint32 `json:"startLine"`
+	StartCol  uint32 `json:"startCol"`
+	EndLine   uint32 `json:"endLine"`
+}
+
+type jsonClone struct {
+	Tokens    int            `json:"tokens"`
+	Locations []jsonLocation `json:"locations"`
+}
+
+func runClones(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	var o clone.Options
+	fs.IntVar(&o.MinTokens, "min", clone.DefaultMinTokens, "The minimum number of tokens of a clone.")
+	fs.BoolVar(&o.IgnoreIdentifiers, "ignore-identifiers", false, "Compare the identifiers by kind only.")
+	fs.BoolVar(&o.IgnoreLiterals, "ignore-literals", false, "Compare the string and number literals by kind only.")
+	format := fs.String("format", "text", "The output format: text or json.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		c.errorf("Unknown format '%s'.", *format)
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	// The files with a lex error are searched up to the error.
+	code := exitOK
+	d := clone.NewDetector(o)
+	for _, path := range inputPaths(fs) {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+		tz, err := l.newTokenizer(in)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+		f, err := clone.NewFile(in.path, in.text, tz)
+		if err != nil {
+			c.lexDiagnostic(in, tz, err)
+			code = exitError
+		}
+		for _, w := range tz.Warnings() {
+			c.diagnostic(in, w.Line, w.Col, "warning", w.Message)
+		}
+		d.Add(f)
+	}
+
+	clones := d.Clones()
+	if *format == "json" {
+		out := []jsonClone{}
+		for _, cl := range clones {
+			jc := jsonClone{Tokens: cl.Tokens}
+			for _, loc := range cl.Locations {
+				jc.Locations = append(jc.Locations, jsonLocation{loc.Path, loc.StartLine, loc.StartCol, loc.EndLine})
+			}
+			out = append(out, jc)
+		}
+		e := json.NewEncoder(c.stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(out); err != nil {
+			c.errorf("%s", err.Error())
+			return exitError
+		}
+		return code
+	}
+
+	for _, cl := range clones {
+		fmt.Fprintf(c.stdout, "Clone of %d tokens in %d locations:\n", cl.Tokens, len(cl.Locations))
+		for _, loc := range cl.Locations {
+			fmt.Fprintf(c.stdout, "\t%s:%d:%d-%d\n", loc.Path, loc.StartLine, loc.StartCol, loc.EndLine)
+		}
+	}
+	return code
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"uno/lex/diff"
+)
+
+var diffMode = &mode{
+	name:  "diff",
+	usage: "[-ignore-comments] [flags] file1 file2",
+	run:   runDiff,
+}
+
+// Like diff, the diff mode exits with 1 if the files differ, and with 2 if
+// an error occurs.
+const (
+	exitDifferent = 1
+	exitTrouble   = 2
+)
+
+func runDiff(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	var o diff.Options
+	fs.BoolVar(&o.IgnoreComments, "ignore-comments", false, "Do not compare the comments.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	var files [2]*diff.File
+	for i, path := range fs.Args() {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			return exitTrouble
+		}
+		tz, err := l.newTokenizer(in)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			return exitTrouble
+		}
+		files[i], err = diff.NewFile(in.path, in.text, tz)
+		if err != nil {
+			c.lexDiagnostic(in, tz, err)
+			return exitTrouble
+		}
+		for _, w := range tz.Warnings() {
+			c.diagnostic(in, w.Line, w.Col, "warning", w.Message)
+		}
+	}
+
+	changes := diff.Diff(files[0], files[1], &o)
+	if err := diff.Unified(c.stdout, files[0], files[1], changes); err != nil {
+		c.errorf("%s", err.Error())
+		return exitTrouble
+	}
+	if len(changes) > 0 {
+		return exitDifferent
+	}
+	return exitOK
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"uno/lex"
+	"uno/lex/extract"
+	"uno/lex/token_kind"
+)
+
+var extractMode = &mode{
+	name:  "extract",
+	usage: "[-comments] [-strings] [-identifiers] [-words] [-format text|jsonl] [flags] [file ...]",
+	run:   runExtract,
+}
+
+type jsonItem struct {
+	File string `json:"file"`
+	Line uint32 `json:"line"`
+	Col  uint32 `json:"col"`
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// Returns the input |path|, its tokens and their spellings. The tokens of a
+// file with a lex error are returned up to the error, with false. The
+// errors are printed.
+func (c *command) readTokens(l *lexer, path string) (*input, []*lex.Token, []extract.Spelling, bool) {
+	in, err := c.readInput(l, path)
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return nil, nil, nil, false
+	}
+	var tokens []*lex.Token
+	var spellings []extract.Spelling
+	err = c.lexInput(l, in, func(t *lex.Token, spelling []byte, offsets []uint32) error {
+		tokens = append(tokens, t)
+		spellings = append(spellings, extract.Spelling{Text: string(spelling), Offsets: append([]uint32(nil), offsets...)})
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(lexError); !ok {
+			c.errorf("%s", err.Error())
+		}
+		return in, tokens, spellings, false
+	}
+	return in, tokens, spellings, true
+}
+
+func runExtract(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	var o extract.Options
+	fs.BoolVar(&o.Comments, "comments", false, "Extract the comments. By default, the comments and the strings are.")
+	fs.BoolVar(&o.Strings, "strings", false, "Extract the strings.")
+	fs.BoolVar(&o.Identifiers, "identifiers", false, "Extract the identifiers.")
+	words := fs.Bool("words", false, "Write the words of the text instead of the text.")
+	format := fs.String("format", "text", "The output format: text or jsonl.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "text" && *format != "jsonl" {
+		c.errorf("Unknown format '%s'.", *format)
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	e := json.NewEncoder(c.stdout)
+	write := func(item jsonItem) error {
+		if *format == "jsonl" {
+			return e.Encode(item)
+		}
+		_, err := fmt.Fprintf(c.stdout, "%s:%d:%d\t%s\t%s\n",
+			item.File, item.Line, item.Col, item.Kind, strconv.Quote(item.Text))
+		return err
+	}
+
+	// The files with a lex error are extracted up to the error.
+	code := exitOK
+	for _, path := range inputPaths(fs) {
+		in, tokens, spellings, ok := c.readTokens(l, path)
+		if !ok {
+			code = exitError
+		}
+		if in == nil {
+			continue
+		}
+		for _, it := range extract.Extract(tokens, spellings, &o) {
+			kind := token_kind.Name(it.Kind)
+			items := []jsonItem{{in.path, it.Line, it.Col, kind, it.Text}}
+			if *words {
+				items = items[:0]
+				for _, w := range it.Words() {
+					items = append(items, jsonItem{in.path, w.Line, w.Col, kind, w.Text})
+				}
+			}
+			for _, item := range items {
+				if err := write(item); err != nil {
+					c.errorf("%s", err.Error())
+					return exitError
+				}
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"uno/lex/highlight"
+)
+
+var highlightMode = &mode{
+	name:  "highlight",
+	usage: "[-format html|ansi|svg|latex] [-theme light|dark] [-standalone] [flags] [file ...]",
+	run:   runHighlight,
+}
+
+func runHighlight(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	format := fs.String("format", "ansi", "The output format: html, ansi, svg or latex.")
+	theme := fs.String("theme", "light", "The color theme: light or dark.")
+	standalone := fs.Bool("standalone", false, "Write a whole HTML or LaTeX document instead of a fragment.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+	f, err := highlight.ParseFormat(*format)
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+	t, err := highlight.ThemeByName(*theme)
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, path := range inputPaths(fs) {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+		tz, err := l.newTokenizer(in)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+
+		// The text after a lex error is still written, without highlighting.
+		spans, err := highlight.Spans(tz, in.text)
+		if err != nil {
+			c.lexDiagnostic(in, tz, err)
+			code = exitError
+		}
+		for _, w := range tz.Warnings() {
+			c.diagnostic(in, w.Line, w.Col, "warning", w.Message)
+		}
+
+		o := &highlight.Options{Theme: t, Standalone: *standalone, Title: in.path}
+		if err := highlight.Render(c.stdout, spans, f, o); err != nil {
+			c.errorf("%s", err.Error())
+			return exitError
+		}
+	}
+	return code
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"uno/lex/lsp"
+)
+
+var lspMode = &mode{
+	name:  "lsp",
+	usage: "",
+	run:   runLSP,
+}
+
+func runLSP(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		c.errorf("The lsp mode takes no files.")
+		return exitUsage
+	}
+
+	if err := lsp.NewServer(c.stdin, c.stdout).Serve(); err != nil {
+		c.errorf("%s", err.Error())
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,329 @@
+// The unolex command lexes source files with the lex package.
+//
+// Usage:
+//
+//	unolex [mode] [flags] [file ...]
+//
+// The modes are:
+//
+//	tokens     prints the tokens of the files. It is the default mode.
+//	highlight  renders the files highlighted as HTML, ANSI, SVG or LaTeX.
+//	lsp        runs a language server providing semantic tokens over the
+//	           standard input and output.
+//	clones     reports the code duplicated in and across the files.
+//	stats      counts the code, comment and blank lines and the tokens.
+//	minify     writes the files without comments and needless white space.
+//	diff       compares two files token by token, ignoring their layout.
+//	search     finds the code matching a pattern of tokens, see package
+//	           uno/lex/search.
+//	rewrite    replaces the code matching a pattern with a template, or
+//	           renames an identifier out of the strings and comments.
+//	extract    prints the comments and the strings, or their words.
+//	spell      checks the spelling of the comments and the strings.
+//	pot        writes the strings marked for translation as a gettext
+//	           template.
+//
+// The files are read from the standard input if none is given or the file
+// is "-". Run "unolex <mode> -h" for the flags of a mode.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+// The exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// A mode of the command. It is run with the arguments after the mode
+// name and returns the exit code.
+type mode struct {
+	name  string
+	usage string
+	run   func(c *command, m *mode, args []string) int
+}
+
+var modes = []*mode{
+	tokensMode,
+	highlightMode,
+	lspMode,
+	clonesMode,
+	statsMode,
+	minifyMode,
+	diffMode,
+	searchMode,
+	rewriteMode,
+	extractMode,
+	spellMode,
+	potMode,
+}
+
+// The environment of a run of the command.
+type command struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	c := &command{os.Stdin, os.Stdout, os.Stderr}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+func (c *command) run(args []string) int {
+	m := modes[0]
+	if len(args) > 0 {
+		for _, o := range modes {
+			if args[0] == o.name {
+				m = o
+				args = args[1:]
+				break
+			}
+		}
+	}
+	return m.run(c, m, args)
+}
+
+// Prints an error to the standard error.
+func (c *command) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(c.stderr, "unolex: "+format+"\n", args...)
+}
+
+// Returns a new FlagSet for the mode |m|, which prints errors to the
+// standard error of |c|.
+func (c *command) newFlagSet(m *mode) *flag.FlagSet {
+	fs := flag.NewFlagSet("unolex "+m.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: unolex %s %s\n", m.name, m.usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// The flags for how the files are lexed, which are common to the modes.
+type lexFlags struct {
+	profile  string
+	kinds    string
+	encoding string
+	invalid  bool
+	security bool
+}
+
+func (f *lexFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.profile, "profile", "",
+		"The language profile, like 'python'. By default, it is chosen by the file extension.")
+	fs.StringVar(&f.kinds, "kinds", "",
+		"A comma separated list of token kinds, like 'Identifier,LeftParen', to lex with instead of a profile.")
+	fs.StringVar(&f.encoding, "encoding", "auto", "The encoding of the files, like 'utf-8' or 'latin-1'.")
+	fs.BoolVar(&f.invalid, "invalid", false, "Lex invalid bytes as Invalid tokens instead of failing.")
+	fs.BoolVar(&f.security, "security", false,
+		"Warn about bidirectional control characters and confusable identifiers.")
+}
+
+// The way the files are lexed, from the lexFlags.
+type lexer struct {
+	flags    *lexFlags
+	profile  *lex.Profile
+	kinds    lex.TokenKindSet
+	encoding lex.Encoding
+}
+
+func (f *lexFlags) lexer() (*lexer, error) {
+	l := &lexer{flags: f}
+	if f.profile != "" && f.kinds != "" {
+		return nil, fmt.Errorf("Only one of -profile and -kinds can be given.")
+	}
+
+	var err error
+	if f.profile != "" {
+		if l.profile, err = lex.ProfileByName(f.profile); err != nil {
+			return nil, err
+		}
+	}
+	if f.kinds != "" {
+		var kinds []uint32
+		for _, name := range strings.Split(f.kinds, ",") {
+			k, err := token_kind.ByName(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			kinds = append(kinds, k)
+		}
+		l.kinds = lex.NewTokenKindSet(kinds)
+	}
+	if l.encoding, err = lex.ParseEncoding(f.encoding); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// An input file of the command.
+type input struct {
+	// The path of the file, or "<stdin>".
+	path string
+	// The text of the file decoded to UTF-8.
+	text []byte
+	// The encoding of the file.
+	encoding lex.Encoding
+}
+
+// Reads the file |path|, or the standard input if it is "-".
+func (c *command) readInput(l *lexer, path string) (*input, error) {
+	var text []byte
+	var err error
+	if path == "-" {
+		path = "<stdin>"
+		text, err = ioutil.ReadAll(c.stdin)
+	} else {
+		text, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text, enc, err := lex.DecodeBytes(text, l.encoding)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return &input{path, text, enc}, nil
+}
+
+// Returns the name of the language of |in|, which is the name of its
+// profile, or "kinds" if it is lexed with the -kinds flag.
+func (l *lexer) language(in *input) string {
+	if l.kinds != nil {
+		return "kinds"
+	}
+	p := l.profile
+	if p == nil {
+		p = lex.ProfileForFile(in.path)
+	}
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
+// Returns a new Tokenizer for |in|.
+func (l *lexer) newTokenizer(in *input) (*lex.Tokenizer, error) {
+	var tz *lex.Tokenizer
+	var err error
+	if l.kinds != nil {
+		tz, err = lex.NewTokenizer(bytes.NewReader(in.text), l.kinds, lex.GoESR{})
+	} else {
+		p := l.profile
+		if p == nil {
+			p = lex.ProfileForFile(in.path)
+		}
+		if p == nil {
+			return nil, fmt.Errorf("%s: No profile for the file, a -profile or -kinds flag is required.", in.path)
+		}
+		tz, err = p.NewTokenizer(bytes.NewReader(in.text))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tz.SetInvalidBytesAsTokens(l.flags.invalid)
+	tz.SetSecurityChecks(l.flags.security)
+	return tz, nil
+}
+
+// An error lexing an input, which is printed as a diagnostic.
+type lexError struct {
+	err error
+}
+
+func (e lexError) Error() string {
+	return e.err.Error()
+}
+
+// Reads all the tokens of |in| and calls |fn| with each, its spelling in
+// the text and its ValueOffsets, which are reused by the next token. A lex
+// error is printed as a diagnostic and returned as a lexError.
+func (c *command) lexInput(l *lexer, in *input, fn func(t *lex.Token, spelling []byte, offsets []uint32) error) error {
+	tz, err := l.newTokenizer(in)
+	if err != nil {
+		return err
+	}
+
+	for tz.HasNext() {
+		t, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.lexDiagnostic(in, tz, err)
+			return lexError{err}
+		}
+		start, end := tz.Offsets()
+		if err := fn(t, in.text[start:end], tz.ValueOffsets()); err != nil {
+			return err
+		}
+	}
+
+	for _, w := range tz.Warnings() {
+		c.diagnostic(in, w.Line, w.Col, "warning", w.Message)
+	}
+	return nil
+}
+
+// Prints the error |err| of |tz|, which reads |in|, as a diagnostic at the
+// beginning of the token which could not be read.
+func (c *command) lexDiagnostic(in *input, tz *lex.Tokenizer, err error) {
+	line, col := tz.TokenStart()
+	c.diagnostic(in, line, col, "error", err.Error())
+}
+
+// Prints a diagnostic about the position |line| and |col| of |in|, with
+// the line and a caret under the column.
+func (c *command) diagnostic(in *input, line, col uint32, severity, message string) {
+	message = strings.Replace(message, "\n", " ", -1)
+	fmt.Fprintf(c.stderr, "%s:%d:%d: %s: %s\n", in.path, line, col, severity, message)
+
+	lines := lex.SplitLines(in.text)
+	if line == 0 || int(line) > len(lines) {
+		return
+	}
+	src := []rune(string(lines[line-1]))
+	for i, r := range src {
+		// Bidirectional control characters would reorder the line.
+		if unicode.Is(unicode.Bidi_Control, r) {
+			src[i] = unicode.ReplacementChar
+		}
+	}
+	fmt.Fprintf(c.stderr, "    %s\n", string(src))
+
+	// Keep the tabs before the column so that the caret lines up.
+	var pad []rune
+	for i := 0; i+1 < int(col) && i < len(src); i++ {
+		if src[i] == '\t' {
+			pad = append(pad, '\t')
+		} else {
+			pad = append(pad, ' ')
+		}
+	}
+	fmt.Fprintf(c.stderr, "    %s^\n", string(pad))
+}
+
+// Returns the paths of the files to read, which is "-" for the standard
+// input if there are none.
+func inputPaths(fs *flag.FlagSet) []string {
+	if fs.NArg() == 0 {
+		return []string{"-"}
+	}
+	return fs.Args()
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs the command with |args| and the standard input |stdin|. Returns the
+// exit code, the standard output and the standard error.
+func runCommand(args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &command{strings.NewReader(stdin), &stdout, &stderr}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestTokensText(t *testing.T) {
+	code, out, errs := runCommand([]string{"-profile", "python"}, "x = 'a'\n")
+	if code != exitOK || errs != "" {
+		t.Fatalf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+	expected := "<stdin>:1:1\tIdentifier\t\"x\"\n" +
+		"<stdin>:1:3\tAssign\t\"=\"\n" +
+		"<stdin>:1:5\tSingleQuoteString\t\"'a'\"\n" +
+		"<stdin>:1:8\tNewLine\t\"\\n\"\n"
+	if out != expected {
+		t.Errorf("Expected the output\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestTokensFormats(t *testing.T) {
+	args := []string{"tokens", "-kinds", "Identifier,Comma", "-format", "jsonl"}
+	code, out, _ := runCommand(args, "a,b\n")
+	expected := `{"file":"<stdin>","line":1,"col":1,"kind":"Identifier","value":"a"}` + "\n" +
+		`{"file":"<stdin>","line":1,"col":2,"kind":"Comma","value":","}` + "\n" +
+		`{"file":"<stdin>","line":1,"col":3,"kind":"Identifier","value":"b"}` + "\n"
+	if code != exitOK || out != expected {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+
+	args = []string{"-kinds", "Identifier,Comma", "-format", "csv"}
+	code, out, _ = runCommand(args, "a,b\n")
+	expected = "file,line,col,kind,value\n<stdin>,1,1,Identifier,a\n<stdin>,1,2,Comma,\",\"\n<stdin>,1,3,Identifier,b\n"
+	if code != exitOK || out != expected {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+}
+
+func TestTokensFiles(t *testing.T) {
+	code, out, errs := runCommand([]string{"../../lex/test_data/files/b.c", "../../lex/test_data/files/a.py"}, "")
+	if code != exitOK {
+		t.Fatalf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+	if !strings.HasPrefix(out, "../../lex/test_data/files/b.c:1:1\t") ||
+		!strings.Contains(out, "../../lex/test_data/files/a.py:1:1\tKeywordDef\t\"def\"\n") {
+		t.Errorf("Unexpected output\n%s", out)
+	}
+}
+
+func TestTokensErrors(t *testing.T) {
+	code, out, errs := runCommand([]string{"-profile", "python"}, "x = 1\ny = $\n")
+	if code != exitError {
+		t.Errorf("Expected the exit code %d, but got %d.", exitError, code)
+	}
+	if !strings.Contains(out, "<stdin>:2:1\tIdentifier\t\"y\"") {
+		t.Errorf("Expected the tokens before the error, but got\n%s", out)
+	}
+	expected := "<stdin>:2:5: error: Unexpected character '$'.\n    y = $\n        ^\n"
+	if errs != expected {
+		t.Errorf("Expected the diagnostic\n%s\nbut got\n%s", expected, errs)
+	}
+
+	// The source line is found with the new lines of the lexer.
+	_, _, errs = runCommand([]string{"-profile", "python"}, "x = 1\ry = 2\u2028z = $\n")
+	expected = "<stdin>:3:5: error: Unexpected character '$'.\n    z = $\n        ^\n"
+	if errs != expected {
+		t.Errorf("Expected the diagnostic\n%s\nbut got\n%s", expected, errs)
+	}
+
+	// The errors are at the beginning of the token which could not be read.
+	_, _, errs = runCommand([]string{"-profile", "c"}, "x = \"abc;\ny;\n")
+	expected = "<stdin>:1:5: error: Unexpected newline while reading quoted string.\n    x = \"abc;\n        ^\n"
+	if errs != expected {
+		t.Errorf("Expected the diagnostic\n%s\nbut got\n%s", expected, errs)
+	}
+	for _, mode := range []string{"tokens", "stats", "highlight", "search"} {
+		args := []string{mode, "-profile", "python"}
+		if mode == "search" {
+			args = append(args, "Identifier")
+		}
+		_, _, errs = runCommand(args, "x = 1\ny = \"\"\"doc\n")
+		if !strings.HasPrefix(errs, "<stdin>:2:5: error: ") || !strings.HasSuffix(errs, "    y = \"\"\"doc\n        ^\n") {
+			t.Errorf("Unexpected diagnostic of %s\n%s", mode, errs)
+		}
+	}
+
+	usages := [][]string{
+		{"-profile", "cobol"},
+		{"-kinds", "Identifier,Nothing"},
+		{"-profile", "c", "-kinds", "Identifier"},
+		{"-format", "xml", "-profile", "c"},
+		{"-nosuchflag"},
+	}
+	for _, args := range usages {
+		if code, _, _ := runCommand(args, ""); code != exitUsage {
+			t.Errorf("Expected the exit code %d for %q, but got %d.", exitUsage, args, code)
+		}
+	}
+
+	// The profile cannot be chosen for the standard input.
+	if code, _, errs := runCommand(nil, "x"); code != exitError || !strings.Contains(errs, "-profile") {
+		t.Errorf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+}
+
+func TestTokensWarnings(t *testing.T) {
+	code, _, errs := runCommand([]string{"-security", "-profile", "go"}, "s := \"\u202e\"\n")
+	if code != exitOK {
+		t.Errorf("Expected warnings to not fail the command, but got the exit code %d.", code)
+	}
+	if !strings.Contains(errs, "<stdin>:1:7: warning: Bidirectional control character U+202E") ||
+		strings.ContainsRune(errs, '\u202e') {
+		t.Errorf("Unexpected warnings\n%s", errs)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	args := []string{"highlight", "-format", "html", "-profile", "c"}
+	code, out, errs := runCommand(args, "int x = 1; // <x>\n")
+	if code != exitOK {
+		t.Fatalf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+	expected := `<pre class="uno"><code><span class="line" id="L1"><span class="identifier">int</span> ` +
+		`<span class="identifier">x</span> <span class="operator">=</span> <span class="number">1</span>` +
+		`<span class="punctuation">;</span> <span class="comment">// &lt;x&gt;</span></span>` + "\n" +
+		"</code></pre>\n"
+	if out != expected {
+		t.Errorf("Expected the output\n%s\nbut got\n%s", expected, out)
+	}
+
+	// The text after an error is written without highlighting.
+	code, out, errs = runCommand([]string{"highlight", "-profile", "python"}, "x $ y\n")
+	if code != exitError || !strings.Contains(errs, "<stdin>:1:3: error:") || !strings.HasSuffix(out, " $ y\n") {
+		t.Errorf("Unexpected exit code %d, output %q and errors '%s'.", code, out, errs)
+	}
+
+	if code, _, _ := runCommand([]string{"highlight", "-theme", "neon", "-profile", "c"}, ""); code != exitUsage {
+		t.Errorf("Expected the exit code %d for an unknown theme, but got %d.", exitUsage, code)
+	}
+}
+
+func TestLSP(t *testing.T) {
+	var in strings.Builder
+	for _, m := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	code, out, errs := runCommand([]string{"lsp"}, in.String())
+	if code != exitOK || errs != "" {
+		t.Fatalf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+	if !strings.HasPrefix(out, "Content-Length: ") || !strings.Contains(out, `"semanticTokensProvider"`) ||
+		!strings.HasSuffix(out, `{"jsonrpc":"2.0","id":2,"result":null}`) {
+		t.Errorf("Unexpected output\n%s", out)
+	}
+}
+
+func TestClones(t *testing.T) {
+	f := "int f(int a) { return a * 2 + 1; }\n"
+	args := []string{"clones", "-profile", "c", "-min", "10", "-ignore-identifiers"}
+	code, out, errs := runCommand(args, f+strings.Replace(f, "a", "b", -1))
+	if code != exitOK || errs != "" {
+		t.Fatalf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+	expected := "Clone of 15 tokens in 2 locations:\n\t<stdin>:1:1-1\n\t<stdin>:2:1-2\n"
+	if out != expected {
+		t.Errorf("Expected the output\n%s\nbut got\n%s", expected, out)
+	}
+
+	code, out, _ = runCommand(append(args, "-format", "json"), f)
+	if code != exitOK || out != "[]\n" {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+}
+
+func TestStats(t *testing.T) {
+	args := []string{"stats", "-files", "../../lex/stats/test_data/sample.py", "../../lex/stats/test_data/sample.c"}
+	code, out, errs := runCommand(args, "")
+	if code != exitOK || errs != "" {
+		t.Fatalf("Unexpected exit code %d with errors '%s'.", code, errs)
+	}
+	if !strings.Contains(out, "../../lex/stats/test_data/sample.c        1         9         1         3         5") ||
+		!strings.Contains(out, "\nTotal          2        22         4         8        10") {
+		t.Errorf("Unexpected output\n%s", out)
+	}
+
+	code, out, _ = runCommand(append([]string{"stats", "-format", "json"}, args[2:]...), "")
+	var r struct {
+		Languages []struct {
+			Language string
+			Code     int
+			Tokens   map[string]int
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatal(err.Error())
+	}
+	if code != exitOK || len(r.Languages) != 2 || r.Languages[0].Language != "c" || r.Languages[0].Tokens["CSingleLineComment"] != 1 {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	code, out, errs := runCommand([]string{"minify", "-profile", "c"}, "int a = b - -c; /* d */\n")
+	if code != exitOK || errs != "" || out != "int a=b- -c;\n" {
+		t.Errorf("Unexpected exit code %d, output %q and errors '%s'.", code, out, errs)
+	}
+	if code, _, _ := runCommand([]string{"minify", "-kinds", "Identifier"}, "a\n"); code != exitUsage {
+		t.Errorf("Expected the exit code %d for an unknown flag, but got %d.", exitUsage, code)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	code, out, errs := runCommand([]string{"diff", "test_data/a.c", "test_data/b.c"}, "")
+	expected := "--- test_data/a.c\n+++ test_data/b.c\n@@ -2,1 +3,1 @@\n-  return a * [-2-];\n+\treturn a * {+3+};\n"
+	if code != exitDifferent || errs != "" || out != expected {
+		t.Errorf("Unexpected exit code %d, errors '%s' and output\n%s", code, errs, out)
+	}
+	if code, out, _ := runCommand([]string{"diff", "test_data/a.c", "test_data/a.c"}, ""); code != exitOK || out != "" {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+	if code, _, _ := runCommand([]string{"diff", "test_data/a.c"}, ""); code != exitUsage {
+		t.Errorf("Expected the exit code %d for a missing file, but got %d.", exitUsage, code)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	args := []string{"search", "-captures", "KeywordReturn $X... Semicolon", "test_data/a.c", "test_data/b.c"}
+	code, out, errs := runCommand(args, "")
+	expected := "test_data/a.c:2:3: return a * 2;\n\t$X: a * 2\ntest_data/b.c:3:2: return a * 3;\n\t$X: a * 3\n"
+	if code != exitOK || errs != "" || out != expected {
+		t.Errorf("Unexpected exit code %d, errors '%s' and output\n%s", code, errs, out)
+	}
+
+	args = []string{"search", "-format", "json", "-profile", "c", `"f" LeftParen ... RightParen`}
+	code, out, _ = runCommand(args, "x = f(a,\n  g(b));\n")
+	if code != exitOK || !strings.Contains(out, `"text": "f(a, g(b))"`) || !strings.Contains(out, `"endLine": 2`) {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+
+	if code, out, _ := runCommand([]string{"search", "-profile", "c", "@number"}, "x;\n"); code != exitNoMatch || out != "" {
+		t.Errorf("Expected the exit code %d without a match, but got %d.", exitNoMatch, code)
+	}
+	if code, _, errs := runCommand([]string{"search", "-profile", "c", "Identifer"}, ""); code != exitUsage || !strings.Contains(errs, "Unknown token kind") {
+		t.Errorf("Expected the exit code %d for an invalid pattern, but got %d.", exitUsage, code)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	args := []string{"rewrite", "-profile", "c", `Identifier("f") LeftParen $A... RightParen`, "g($A, 0)"}
+	code, out, errs := runCommand(args, "x = f(a, /* b */ b) + f();\n")
+	if code != exitOK || errs != "" || out != "x = g(a, /* b */ b, 0) + g(, 0);\n" {
+		t.Errorf("Unexpected exit code %d, output %q and errors '%s'.", code, out, errs)
+	}
+
+	dir, err := ioutil.TempDir("", "unolex")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.py")
+	if err := ioutil.WriteFile(path, []byte("n = 1  # n\nprint(n, 'n')\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	code, out, errs = runCommand([]string{"rewrite", "-rename", "-w", "n", "count", path}, "")
+	text, _ := ioutil.ReadFile(path)
+	if code != exitOK || out != "" || errs != "" || string(text) != "count = 1  # n\nprint(count, 'n')\n" {
+		t.Errorf("Unexpected exit code %d, errors '%s' and file\n%s", code, errs, string(text))
+	}
+
+	code, _, errs = runCommand([]string{"rewrite", "-rename", "-profile", "python", "n", "a b"}, "n = 1\n")
+	if code != exitError || !strings.Contains(errs, "is not an identifier") {
+		t.Errorf("Unexpected exit code %d and errors '%s'.", code, errs)
+	}
+	code, _, errs = runCommand([]string{"rewrite", "-profile", "c", "Add", ""}, "a+b;\n")
+	if code != exitError || !strings.Contains(errs, "does not lex to the same tokens") {
+		t.Errorf("Unexpected exit code %d and errors '%s'.", code, errs)
+	}
+	if code, _, _ := runCommand([]string{"rewrite", "-w", "Add", "+"}, ""); code != exitUsage {
+		t.Errorf("Expected the exit code %d without files to write, but got %d.", exitUsage, code)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	args := []string{"extract", "-profile", "python"}
+	code, out, errs := runCommand(args, "x = 'a\\tb'  # The x.\n")
+	expected := "<stdin>:1:5\tSingleQuoteString\t\"a\\tb\"\n<stdin>:1:13\tPySingleLineComment\t\" The x.\"\n"
+	if code != exitOK || errs != "" || out != expected {
+		t.Errorf("Unexpected exit code %d, errors '%s' and output\n%s", code, errs, out)
+	}
+
+	args = []string{"extract", "-identifiers", "-words", "-format", "jsonl", "-profile", "c"}
+	code, out, _ = runCommand(args, "readHTTPFile;\n")
+	if code != exitOK || strings.Count(out, "\n") != 3 || !strings.Contains(out, `"col":5,"kind":"Identifier","text":"HTTP"`) {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+
+	// The positions of the words are in the source, after the escape sequence.
+	code, out, _ = runCommand([]string{"extract", "-words", "-profile", "python"}, "x = 'teh\\tcat'\n")
+	if code != exitOK || out != "<stdin>:1:6\tSingleQuoteString\t\"teh\"\n<stdin>:1:11\tSingleQuoteString\t\"cat\"\n" {
+		t.Errorf("Unexpected exit code %d and output\n%s", code, out)
+	}
+}
+
+func TestSpell(t *testing.T) {
+	args := []string{"spell", "-dict", "test_data/words.txt", "-profile", "c"}
+	code, out, errs := runCommand(args, "/* Returns the sum of the valeus. */\nputs(\"sum\");\n")
+	expected := "<stdin>:1:27: 'valeus' in a comment is not in the dictionaries.\n"
+	if code != exitMisspelled || errs != "" || out != expected {
+		t.Errorf("Unexpected exit code %d, errors '%s' and output\n%s", code, errs, out)
+	}
+	if code, _, _ := runCommand(args, "// The sum.\n"); code != exitOK {
+		t.Errorf("Expected the exit code %d, but got %d.", exitOK, code)
+	}
+	if code, _, _ := runCommand([]string{"spell", "-profile", "c"}, ""); code != exitUsage {
+		t.Errorf("Expected the exit code %d without a dictionary, but got %d.", exitUsage, code)
+	}
+}
+
+func TestPot(t *testing.T) {
+	args := []string{"pot", "-keyword", "tr", "-profile", "python"}
+	code, out, errs := runCommand(args, "# TRANSLATORS: A greeting.\nprint(tr('Hi'), _('Bye'))\n")
+	expected := "\n#. TRANSLATORS: A greeting.\n#: <stdin>:2\nmsgid \"Hi\"\nmsgstr \"\"\n"
+	if code != exitOK || errs != "" || !strings.HasSuffix(out, expected) || strings.Contains(out, "Bye") {
+		t.Errorf("Unexpected exit code %d, errors '%s' and output\n%s", code, errs, out)
+	}
+	if code, _, _ := runCommand([]string{"pot", "-keyword", "tr:x"}, ""); code != exitUsage {
+		t.Errorf("Expected the exit code %d for an invalid keyword, but got %d.", exitUsage, code)
+	}
+}
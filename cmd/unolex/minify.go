@@ -0,0 +1,66 @@
+package main
+
+import (
+	"uno/lex"
+	"uno/lex/minify"
+)
+
+var minifyMode = &mode{
+	name:  "minify",
+	usage: "[-keep-line-breaks] [-keep-spaces] [-profile name] [-encoding name] [file ...]",
+	run:   runMinify,
+}
+
+func runMinify(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	// Only the flags which apply to minify.Minify, which needs a profile.
+	var lf lexFlags
+	fs.StringVar(&lf.profile, "profile", "",
+		"The language profile, like 'python'. By default, it is chosen by the file extension.")
+	fs.StringVar(&lf.encoding, "encoding", "auto", "The encoding of the files, like 'utf-8' or 'latin-1'.")
+	var o minify.Options
+	fs.BoolVar(&o.KeepLineBreaks, "keep-line-breaks", false,
+		"Keep a new line between the tokens on different lines, like for JavaScript.")
+	fs.BoolVar(&o.KeepSpaces, "keep-spaces", false,
+		"Keep a space between the tokens separated by white space, like for CSS.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, path := range inputPaths(fs) {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+		p := l.profile
+		if p == nil {
+			p = lex.ProfileForFile(in.path)
+		}
+		if p == nil {
+			c.errorf("%s: No profile for the file, a -profile flag is required.", in.path)
+			code = exitError
+			continue
+		}
+
+		out, err := minify.Minify(p, in.text, &o)
+		if err != nil {
+			c.errorf("%s: %s", in.path, err.Error())
+			code = exitError
+			continue
+		}
+		if _, err := c.stdout.Write(out); err != nil {
+			c.errorf("%s", err.Error())
+			return exitError
+		}
+	}
+	return code
+}
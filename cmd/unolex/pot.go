@@ -0,0 +1,61 @@
+package main
+
+import (
+	"uno/lex/gettext"
+)
+
+var potMode = &mode{
+	name:  "pot",
+	usage: "[-keyword spec ...] [-comment-tag tag] [flags] [file ...]",
+	run:   runPot,
+}
+
+func runPot(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	var specs stringList
+	fs.Var(&specs, "keyword", "A function which marks its arguments for translation, like 'tr' or "+
+		"'ngettext:1,2'. It can be repeated, and replaces the default keywords.")
+	tag := fs.String("comment-tag", gettext.DefaultCommentTag,
+		"The beginning of the comments for the translators, or nothing for none.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if len(specs) == 0 {
+		specs = gettext.DefaultKeywords
+	}
+	var keywords []gettext.Keyword
+	for _, spec := range specs {
+		k, err := gettext.ParseKeyword(spec)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			return exitUsage
+		}
+		keywords = append(keywords, k)
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	// The files with a lex error are read up to the error.
+	code := exitOK
+	catalog := gettext.NewCatalog(keywords, *tag)
+	for _, path := range inputPaths(fs) {
+		in, tokens, _, ok := c.readTokens(l, path)
+		if !ok {
+			code = exitError
+		}
+		if in != nil {
+			catalog.Add(in.path, tokens)
+		}
+	}
+	if err := gettext.WritePOT(c.stdout, catalog.Messages()); err != nil {
+		c.errorf("%s", err.Error())
+		return exitError
+	}
+	return code
+}
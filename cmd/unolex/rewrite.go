@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"uno/lex"
+	"uno/lex/rewrite"
+)
+
+var rewriteMode = &mode{
+	name:  "rewrite",
+	usage: "[-rename] [-w] [-profile name] [-encoding name] pattern template [file ...]",
+	run:   runRewrite,
+}
+
+func runRewrite(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	// Only the flags which apply to rewrite.Rewrite, which needs a profile.
+	var lf lexFlags
+	fs.StringVar(&lf.profile, "profile", "",
+		"The language profile, like 'python'. By default, it is chosen by the file extension.")
+	fs.StringVar(&lf.encoding, "encoding", "auto", "The encoding of the files, like 'utf-8' or 'latin-1'.")
+	rename := fs.Bool("rename", false, "Rename the identifier given as the pattern to the template.")
+	write := fs.Bool("w", false, "Write the changed files instead of the standard output.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 2 || *write && fs.NArg() == 2 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var r *rewrite.Rule
+	var err error
+	if *rename {
+		r, err = rewrite.Rename(fs.Arg(0), fs.Arg(1))
+	} else {
+		r, err = rewrite.Compile(fs.Arg(0), fs.Arg(1))
+	}
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	paths := fs.Args()[2:]
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	code := exitOK
+	for _, path := range paths {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+		p := l.profile
+		if p == nil {
+			p = lex.ProfileForFile(in.path)
+		}
+		if p == nil {
+			c.errorf("%s: No profile for the file, a -profile flag is required.", in.path)
+			code = exitError
+			continue
+		}
+
+		out, edits, err := rewrite.Rewrite(p, in.text, r)
+		if err != nil {
+			c.errorf("%s: %s", in.path, err.Error())
+			code = exitError
+			continue
+		}
+		if !*write {
+			if _, err := c.stdout.Write(out); err != nil {
+				c.errorf("%s", err.Error())
+				return exitError
+			}
+			continue
+		}
+
+		if len(edits) == 0 {
+			continue
+		}
+		if path == "-" {
+			c.errorf("Cannot write the standard input, use a file.")
+			code = exitError
+			continue
+		}
+		// The text was decoded to UTF-8, which is how it is written.
+		if in.encoding != lex.UTF8 {
+			c.errorf("%s: Cannot write a file in %s, only in utf-8.", in.path, in.encoding)
+			code = exitError
+			continue
+		}
+		info, err := os.Stat(path)
+		if err == nil {
+			err = ioutil.WriteFile(path, out, info.Mode())
+		}
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+		}
+	}
+	return code
+}
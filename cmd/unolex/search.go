@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"uno/lex"
+	"uno/lex/search"
+)
+
+var searchMode = &mode{
+	name:  "search",
+	usage: "[-captures] [-format text|json] [flags] pattern [file ...]",
+	run:   runSearch,
+}
+
+// Like grep, the search mode exits with 1 if nothing matches, and with 2
+// if an error occurs.
+const (
+	exitNoMatch     = 1
+	exitSearchError = 2
+)
+
+type jsonMatch struct {
+	File     string            `json:"file"`
+	Line     uint32            `json:"line"`
+	Col      uint32            `json:"col"`
+	EndLine  uint32            `json:"endLine"`
+	Text     string            `json:"text"`
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// Returns the tokens of |in| up to the first lex error, which is printed as
+// a diagnostic and returned.
+func (c *command) lexRefs(l *lexer, in *input) ([]lex.TokenRef, error) {
+	tz, err := l.newTokenizer(in)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := lex.ReadRefs(tz)
+	if err != nil {
+		c.lexDiagnostic(in, tz, err)
+		return refs, lexError{err}
+	}
+
+	for _, w := range tz.Warnings() {
+		c.diagnostic(in, w.Line, w.Col, "warning", w.Message)
+	}
+	return refs, nil
+}
+
+// Returns the source of the tokens |r| of |refs|, on a single line.
+func matchText(in *input, refs []lex.TokenRef, r search.Range) string {
+	if r.Start == r.End {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(in.text[refs[r.Start].Start:refs[r.End-1].End])), " ")
+}
+
+func runSearch(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	captures := fs.Bool("captures", false, "Also write the captures of each match.")
+	format := fs.String("format", "text", "The output format: text or json.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		c.errorf("Unknown format '%s'.", *format)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	p, err := search.Compile(fs.Arg(0))
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	paths := fs.Args()[1:]
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	// The files with a lex error are searched up to the error.
+	code := exitNoMatch
+	failed := false
+	out := []jsonMatch{}
+	for _, path := range paths {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			failed = true
+			continue
+		}
+		refs, err := c.lexRefs(l, in)
+		if err != nil {
+			if _, ok := err.(lexError); !ok {
+				c.errorf("%s", err.Error())
+			}
+			failed = true
+		}
+
+		for _, match := range p.Find(in.text, refs) {
+			code = exitOK
+			first, last := refs[match.Start], refs[match.End-1]
+			endLine := last.Line + uint32(strings.Count(string(in.text[last.Start:last.End]), "\n"))
+			jm := jsonMatch{in.path, first.Line, first.Col, endLine, matchText(in, refs, match.Range), nil}
+			if *captures {
+				jm.Captures = map[string]string{}
+				for name, r := range match.Captures {
+					jm.Captures[name] = matchText(in, refs, r)
+				}
+			}
+			if *format == "json" {
+				out = append(out, jm)
+				continue
+			}
+
+			fmt.Fprintf(c.stdout, "%s:%d:%d: %s\n", jm.File, jm.Line, jm.Col, jm.Text)
+			if *captures {
+				for _, name := range p.Captures() {
+					fmt.Fprintf(c.stdout, "\t$%s: %s\n", name, jm.Captures[name])
+				}
+			}
+		}
+	}
+
+	if *format == "json" {
+		e := json.NewEncoder(c.stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(out); err != nil {
+			c.errorf("%s", err.Error())
+			return exitSearchError
+		}
+	}
+	if failed {
+		return exitSearchError
+	}
+	return code
+}
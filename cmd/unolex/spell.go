@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"uno/lex/extract"
+	"uno/lex/highlight"
+	"uno/lex/spell"
+	"uno/lex/token_kind"
+)
+
+var spellMode = &mode{
+	name:  "spell",
+	usage: "-dict file [-dict file ...] [-identifiers] [-min n] [-format text|jsonl] [flags] [file ...]",
+	run:   runSpell,
+}
+
+// Like a linter, the spell mode exits with 1 if a word is misspelled. Like
+// the diff mode, it exits with exitTrouble if an error occurs.
+const exitMisspelled = 1
+
+// The values of a flag which can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func runSpell(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	var dicts stringList
+	fs.Var(&dicts, "dict", "A dictionary, with a word per line, like /usr/share/dict/words. It can be repeated.")
+	identifiers := fs.Bool("identifiers", false, "Also check the words of the identifiers.")
+	var o spell.Options
+	fs.IntVar(&o.MinLength, "min", spell.DefaultMinLength, "The minimum length of the words which are checked.")
+	format := fs.String("format", "text", "The output format: text or jsonl.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "text" && *format != "jsonl" {
+		c.errorf("Unknown format '%s'.", *format)
+		return exitUsage
+	}
+	if len(dicts) == 0 {
+		c.errorf("A -dict flag is required.")
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+	d := spell.NewDictionary()
+	for _, path := range dicts {
+		f, err := os.Open(path)
+		if err == nil {
+			err = d.Read(f)
+			f.Close()
+		}
+		if err != nil {
+			c.errorf("%s", err.Error())
+			return exitTrouble
+		}
+	}
+
+	// The files with a lex error are checked up to the error.
+	code := exitOK
+	failed := false
+	e := json.NewEncoder(c.stdout)
+	eo := &extract.Options{Comments: true, Strings: true, Identifiers: *identifiers}
+	for _, path := range inputPaths(fs) {
+		in, tokens, spellings, ok := c.readTokens(l, path)
+		if !ok {
+			failed = true
+		}
+		if in == nil {
+			continue
+		}
+		for _, ms := range spell.Check(extract.Extract(tokens, spellings, eo), d, &o) {
+			code = exitMisspelled
+			if *format == "jsonl" {
+				err = e.Encode(jsonItem{in.path, ms.Line, ms.Col, token_kind.Name(ms.Kind), ms.Text})
+			} else {
+				_, err = fmt.Fprintf(c.stdout, "%s:%d:%d: '%s' in a %s is not in the dictionaries.\n",
+					in.path, ms.Line, ms.Col, ms.Text, highlight.ClassOf(ms.Kind))
+			}
+			if err != nil {
+				c.errorf("%s", err.Error())
+				return exitTrouble
+			}
+		}
+	}
+	if failed {
+		return exitTrouble
+	}
+	return code
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"uno/lex/stats"
+)
+
+var statsMode = &mode{
+	name:  "stats",
+	usage: "[-format table|json] [-files] [flags] [file ...]",
+	run:   runStats,
+}
+
+// A row of the table output.
+type statsRow struct {
+	name string
+	s    *stats.Stats
+}
+
+// Writes the rows as a table with a header, the names in the first column.
+func writeStatsTable(w io.Writer, title string, rows []statsRow) error {
+	width := len(title)
+	for _, r := range rows {
+		if len(r.name) > width {
+			width = len(r.name)
+		}
+	}
+	fmt.Fprintf(w, "%-*s %7s %9s %9s %9s %9s %10s %7s\n", width, title,
+		"Files", "Lines", "Blank", "Comment", "Code", "Tokens", "IdLen")
+	for _, r := range rows {
+		s := r.s
+		_, err := fmt.Fprintf(w, "%-*s %7d %9d %9d %9d %9d %10d %7.1f\n", width, r.name,
+			s.Files, s.Lines, s.Blank, s.Comment, s.Code, s.TokenCount(), s.MeanIdentifierLength())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonStats struct {
+	Files     []*stats.FileStats     `json:"files"`
+	Languages []*stats.LanguageStats `json:"languages"`
+	Total     *stats.Stats           `json:"total"`
+}
+
+func runStats(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	format := fs.String("format", "table", "The output format: table or json.")
+	files := fs.Bool("files", false, "Also write a row for each file in the table.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		c.errorf("Unknown format '%s'.", *format)
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	// The files with a lex error are counted anyway, see stats.Count.
+	code := exitOK
+	var results []*stats.FileStats
+	for _, path := range inputPaths(fs) {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+		tz, err := l.newTokenizer(in)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+
+		r, err := stats.Count(in.path, l.language(in), tz, in.text)
+		if err != nil {
+			c.lexDiagnostic(in, tz, err)
+			code = exitError
+		}
+		for _, w := range tz.Warnings() {
+			c.diagnostic(in, w.Line, w.Col, "warning", w.Message)
+		}
+		results = append(results, r)
+	}
+
+	languages, total := stats.Summarize(results)
+	if *format == "json" {
+		out := jsonStats{results, languages, total}
+		if out.Files == nil {
+			out.Files = []*stats.FileStats{}
+			out.Languages = []*stats.LanguageStats{}
+		}
+		e := json.NewEncoder(c.stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(out); err != nil {
+			c.errorf("%s", err.Error())
+			return exitError
+		}
+		return code
+	}
+
+	if *files {
+		var rows []statsRow
+		for _, r := range results {
+			rows = append(rows, statsRow{r.Path, r.Stats})
+		}
+		if err := writeStatsTable(c.stdout, "File", rows); err != nil {
+			c.errorf("%s", err.Error())
+			return exitError
+		}
+		fmt.Fprintln(c.stdout)
+	}
+	var rows []statsRow
+	for _, ls := range languages {
+		rows = append(rows, statsRow{ls.Language, ls.Stats})
+	}
+	rows = append(rows, statsRow{"Total", total})
+	if err := writeStatsTable(c.stdout, "Language", rows); err != nil {
+		c.errorf("%s", err.Error())
+		return exitError
+	}
+	return code
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+var tokensMode = &mode{
+	name:  "tokens",
+	usage: "[-format text|jsonl|csv] [flags] [file ...]",
+	run:   runTokens,
+}
+
+// Writes the tokens of the files in a format.
+type tokenWriter interface {
+	write(path string, t *lex.Token) error
+	// Writes out the buffered tokens, if any.
+	flush() error
+}
+
+// Writes a token per line, like `a.py:1:5	Identifier	"x"`.
+type textTokenWriter struct {
+	w io.Writer
+}
+
+func (tw *textTokenWriter) write(path string, t *lex.Token) error {
+	_, err := fmt.Fprintf(tw.w, "%s:%d:%d\t%s\t%s\n",
+		path, t.Line, t.Col, token_kind.Name(t.Kind), strconv.Quote(t.Value))
+	return err
+}
+
+func (tw *textTokenWriter) flush() error {
+	return nil
+}
+
+// Writes a JSON object per line.
+type jsonTokenWriter struct {
+	e *json.Encoder
+}
+
+type jsonToken struct {
+	File  string `json:"file"`
+	Line  uint32 `json:"line"`
+	Col   uint32 `json:"col"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func (tw *jsonTokenWriter) write(path string, t *lex.Token) error {
+	return tw.e.Encode(jsonToken{path, t.Line, t.Col, token_kind.Name(t.Kind), t.Value})
+}
+
+func (tw *jsonTokenWriter) flush() error {
+	return nil
+}
+
+// Writes CSV records with a header.
+type csvTokenWriter struct {
+	w *csv.Writer
+}
+
+func (tw *csvTokenWriter) write(path string, t *lex.Token) error {
+	return tw.w.Write([]string{
+		path,
+		strconv.FormatUint(uint64(t.Line), 10),
+		strconv.FormatUint(uint64(t.Col), 10),
+		token_kind.Name(t.Kind),
+		t.Value,
+	})
+}
+
+func (tw *csvTokenWriter) flush() error {
+	tw.w.Flush()
+	return tw.w.Error()
+}
+
+func newTokenWriter(format string, w io.Writer) (tokenWriter, error) {
+	switch format {
+	case "text":
+		return &textTokenWriter{w}, nil
+	case "jsonl":
+		e := json.NewEncoder(w)
+		e.SetEscapeHTML(false)
+		return &jsonTokenWriter{e}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"file", "line", "col", "kind", "value"}); err != nil {
+			return nil, err
+		}
+		return &csvTokenWriter{cw}, nil
+	}
+	return nil, fmt.Errorf("Unknown format '%s'.", format)
+}
+
+func runTokens(c *command, m *mode, args []string) int {
+	fs := c.newFlagSet(m)
+	var lf lexFlags
+	lf.register(fs)
+	format := fs.String("format", "text", "The output format: text, jsonl or csv.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	l, err := lf.lexer()
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+	tw, err := newTokenWriter(*format, c.stdout)
+	if err != nil {
+		c.errorf("%s", err.Error())
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, path := range inputPaths(fs) {
+		in, err := c.readInput(l, path)
+		if err != nil {
+			c.errorf("%s", err.Error())
+			code = exitError
+			continue
+		}
+
+		err = c.lexInput(l, in, func(t *lex.Token, _ []byte, _ []uint32) error {
+			return tw.write(in.path, t)
+		})
+		if err != nil {
+			if _, ok := err.(lexError); !ok {
+				c.errorf("%s", err.Error())
+			}
+			code = exitError
+		}
+	}
+
+	if err := tw.flush(); err != nil {
+		c.errorf("%s", err.Error())
+		return exitError
+	}
+	return code
+}
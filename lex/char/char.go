@@ -32,7 +32,17 @@ const (
 	SingleQuote  = rune('\'')
 	BackQuote    = rune('`')
 	Hash         = rune('#')
+	QuestionMark = rune('?')
 	BackSlash    = rune('\\')
 	At           = rune('@')
 	Underscore   = rune('_')
+
+	// Unicode line terminators.
+	NEL                = rune('\u0085')
+	LineSeparator      = rune('\u2028')
+	ParagraphSeparator = rune('\u2029')
+
+	// The byte order mark, which can be present at the beginning of a
+	// text.
+	BOM = rune('\uFEFF')
 )
@@ -1,30 +1,184 @@
 package lex
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"unicode"
+	"unicode/utf8"
 	"uno/lex/char"
 )
 
-type CharReader struct {
-	cache   []rune
-	r       io.RuneReader
+// The maximum number of characters which can be peeked at.
+const MaxLookahead = 1024
+
+// The maximum number of characters which are retained from the oldest
+// outstanding mark, including the characters peeked at after the next
+// character to be read. Reading or peeking further is an error.
+const MaxMarkWindow = 64 * 1024
+
+// The spellings of the new line sequences. A new line in the buffer of a
+// CharReader refers to its spelling by the index in to this list.
+var newLineSpellings = []string{"\n", "\r\n", "\r", "\u0085", "\u2028", "\u2029"}
+
+// Returns the length in bytes of the new line at the beginning of |b|, or 0
+// if |b| does not begin with a new line. The new lines are those read by a
+// CharReader, see NewLineSpelling.
+func NewLineLen(b []byte) int {
+	for _, nl := range newLineSpellings {
+		if bytes.HasPrefix(b, []byte(nl)) {
+			return len(nl)
+		}
+	}
+	return 0
+}
+
+// Returns the lines of |text| without their new lines, split at the new
+// lines read by a CharReader. The text after the last new line is the
+// last line, even if it is empty.
+func SplitLines(text []byte) [][]byte {
+	var lines [][]byte
+	start := 0
+	for i := 0; i < len(text); {
+		n := 0
+		switch text[i] {
+		case '\n', '\r', 0xC2, 0xE2:
+			n = NewLineLen(text[i:])
+		}
+		if n == 0 {
+			i++
+			continue
+		}
+		lines = append(lines, text[start:i])
+		i += n
+		start = i
+	}
+	return append(lines, text[start:])
+}
+
+// A character in the buffer of a CharReader.
+type bufferedChar struct {
+	c rune
+	// If |c| is a new line, the index of its spelling in newLineSpellings.
+	nl uint8
+	// true if |c| is utf8.RuneError read for an invalid byte.
+	invalid bool
+}
+
+// The position of a CharReader, which is restored by Reset.
+type readerPosition struct {
 	line    uint32
 	col     uint32
+	nextCol uint32
 	newLine bool
+	// The byte offset of the next character to be read.
+	offset uint32
+	// The index of the spelling of the last new line read, or -1 if no
+	// new line has been read.
+	lastNewLine int
 }
 
+// A point in the input of a CharReader to which it can be reset.
+type CharMark struct {
+	index int
+	pos   readerPosition
+	// The number of characters recorded at the mark.
+	recorded int
+}
+
+// A character recorded by a CharReader, with its position.
+type recordedChar struct {
+	c         rune
+	line, col uint32
+}
+
+type CharReader struct {
+	r io.RuneReader
+	// If not nil, characters are decoded directly from |src| instead of
+	// being read from |r|. |pos| is the index of the next byte to decode.
+	src []byte
+	pos int
+
+	// A ring buffer of the characters peeked at, and of the characters
+	// read after an outstanding mark. Its length is a power of 2. The
+	// character at the absolute index i is at buf[i&(len(buf)-1)].
+	buf []bufferedChar
+	// The absolute indices of the oldest character retained, the next
+	// character to be read and one past the last character buffered.
+	base, head, tail int
+	// The number of outstanding marks at each absolute index.
+	marks map[int]int
+
+	readerPosition
+
+	mode     ColumnMode
+	tabWidth uint32
+
+	// A character, or an error, read after a '\r' which did not turn
+	// out to be a part of a "\r\n" sequence.
+	pending        rune
+	pendingInvalid bool
+	pendingErr     error
+	hasPending     bool
+
+	// true if invalid bytes are read as utf8.RuneError instead of
+	// causing an error.
+	readInvalid bool
+	// true if the first character has been decoded.
+	started bool
+
+	// If |record| is true, the characters read which are not ASCII are
+	// appended to |recorded| with their positions.
+	record   bool
+	recorded []recordedChar
+
+	// If not nil, the line table of |file| is built while reading.
+	file *File
+}
+
+const initialCharBufferSize = 16
+
 func NewCharReader(r io.RuneReader) *CharReader {
 	cr := new(CharReader)
 	cr.r = r
 	cr.line = 0
 	cr.col = 0
 	cr.newLine = true
+	cr.lastNewLine = -1
+	cr.buf = make([]bufferedChar, initialCharBufferSize)
 
 	return cr
 }
 
+// Returns a new CharReader which reads the UTF-8 encoded text |b|. It is
+// faster than reading |b| with NewCharReader through an io.RuneReader.
+func NewBytesCharReader(b []byte) *CharReader {
+	cr := NewCharReader(nil)
+	if b == nil {
+		b = []byte{}
+	}
+	cr.src = b
+	return cr
+}
+
+// Sets the unit in which columns are counted. The tab width is used only
+// with VisualColumns. It should be called before reading any character.
+func (r *CharReader) SetColumnMode(m ColumnMode, tabWidth uint32) error {
+	if err := checkColumnMode(m, tabWidth); err != nil {
+		return err
+	}
+	r.mode = m
+	r.tabWidth = tabWidth
+	return nil
+}
+
+// If |read| is true, each invalid byte in the input is read as the
+// character utf8.RuneError instead of causing an error. It should be
+// called before reading any character.
+func (r *CharReader) SetReadInvalidBytes(read bool) {
+	r.readInvalid = read
+}
+
 // Returns the line on which the last successfully read or attempted
 // character was present on. A value of 0 is returned before the first
 // character is read.
@@ -53,24 +207,152 @@ func (r *CharReader) NextCol() uint32 {
 	if r.newLine {
 		return 1
 	} else {
-		return r.col + 1
+		return r.nextCol
 	}
 }
 
+// Returns the byte offset of the next character to be read.
+func (r *CharReader) NextOffset() uint32 {
+	return r.offset
+}
+
 // Returns true if the last character read was a new line character.
 func (r *CharReader) PreviousWasNewLine() bool {
 	return r.newLine
 }
 
-func (r *CharReader) readOutChar() (rune, error) {
-	c, s, err := r.r.ReadRune()
+// Returns the original spelling of the last new line read. It can be
+// one of "\n", "\r\n", "\r", "\u0085", "\u2028" or "\u2029".
+func (r *CharReader) NewLineSpelling() string {
+	if r.lastNewLine < 0 {
+		return ""
+	}
+	return newLineSpellings[r.lastNewLine]
+}
+
+// Decodes a character from the input. An invalid byte is returned as
+// utf8.RuneError with the size 1.
+func (r *CharReader) decodeRune() (rune, int, error) {
+	if r.src != nil {
+		if r.pos >= len(r.src) {
+			return 0, 0, io.EOF
+		}
+		c, s := utf8.DecodeRune(r.src[r.pos:])
+		r.pos += s
+		return c, s, nil
+	}
+	return r.r.ReadRune()
+}
+
+func (r *CharReader) readRune() (rune, bool, error) {
+	if r.hasPending {
+		r.hasPending = false
+		return r.pending, r.pendingInvalid, r.pendingErr
+	}
+
+	c, s, err := r.decodeRune()
 	if err != nil {
-		return 0, err
+		return 0, false, err
+	}
+	if !r.started {
+		r.started = true
+		if c == char.BOM {
+			// The byte order mark is not a part of the text, but it
+			// is counted in the byte offsets.
+			r.offset += uint32(s)
+			return r.readRune()
+		}
 	}
 	if c == unicode.ReplacementChar && s == 1 {
-		return 0, fmt.Errorf("Invalid unicode character.")
+		if r.readInvalid {
+			return c, true, nil
+		}
+		return 0, false, fmt.Errorf("Invalid unicode character.")
 	}
-	return c, nil
+	return c, false, nil
+}
+
+func isNewLine(c rune) bool {
+	switch c {
+	case char.NewLine, char.Return, char.NEL, char.LineSeparator, char.ParagraphSeparator:
+		return true
+	}
+	return false
+}
+
+// Reads a character from the underlying reader. All the new line
+// sequences are returned as a single '\n' character.
+func (r *CharReader) readOutChar() (bufferedChar, error) {
+	c, invalid, err := r.readRune()
+	if err != nil || !isNewLine(c) {
+		return bufferedChar{c, 0, invalid}, err
+	}
+
+	var nl uint8
+	switch c {
+	case char.Return:
+		nl = 2
+		n, invalid, err := r.readRune()
+		if err == nil && n == char.NewLine {
+			nl = 1
+		} else {
+			r.pending = n
+			r.pendingInvalid = invalid
+			r.pendingErr = err
+			r.hasPending = true
+		}
+	case char.NEL:
+		nl = 3
+	case char.LineSeparator:
+		nl = 4
+	case char.ParagraphSeparator:
+		nl = 5
+	}
+	return bufferedChar{char.NewLine, nl, false}, nil
+}
+
+func (r *CharReader) slot(i int) *bufferedChar {
+	return &r.buf[i&(len(r.buf)-1)]
+}
+
+func (r *CharReader) grow() {
+	buf := make([]bufferedChar, 2*len(r.buf))
+	for i := r.base; i < r.tail; i++ {
+		buf[i&(len(buf)-1)] = *r.slot(i)
+	}
+	r.buf = buf
+}
+
+// Buffers characters until |n| characters following the next character
+// to be read are buffered.
+func (r *CharReader) fill(n int) error {
+	for r.tail-r.head <= n {
+		if r.tail-r.base >= MaxMarkWindow {
+			return fmt.Errorf("Cannot read beyond %d characters after a mark.", MaxMarkWindow)
+		}
+		bc, err := r.readOutChar()
+		if err != nil {
+			return err
+		}
+		if r.tail-r.base == len(r.buf) {
+			r.grow()
+		}
+		*r.slot(r.tail) = bc
+		r.tail += 1
+	}
+	return nil
+}
+
+// Releases the characters which have been read and are not reachable by
+// an outstanding mark.
+func (r *CharReader) release() {
+	base := r.head
+	for i := range r.marks {
+		if i < base {
+			base = i
+		}
+	}
+	r.base = base
 }
 
 // Read a character and return it.
@@ -86,25 +368,39 @@ func (r *CharReader) ReadChar() (rune, error) {
 		r.col = 1
 		r.line += 1
 	} else {
-		r.col += 1
+		r.col = r.nextCol
 	}
 
-	var c rune
-	if len(r.cache) > 0 {
-		c = r.cache[0]
-		r.cache = r.cache[1:]
-	} else {
-		var err error
-		c, err = r.readOutChar()
-		if err != nil {
-			return 0, err
-		}
+	if err := r.fill(0); err != nil {
+		return 0, err
+	}
+	bc := *r.slot(r.head)
+	r.head += 1
+	if len(r.marks) == 0 {
+		r.base = r.head
 	}
 
-	if c == char.NewLine {
-		r.newLine = true
+	c := bc.c
+	r.newLine = c == char.NewLine
+	r.nextCol = advanceColumn(r.col, c, r.mode, r.tabWidth)
+
+	if bc.invalid {
+		// An invalid byte is a single byte.
+		r.offset += 1
+		if r.mode == ByteColumns {
+			r.nextCol = r.col + 1
+		}
+	} else if c == char.NewLine {
+		r.lastNewLine = int(bc.nl)
+		r.offset += uint32(len(newLineSpellings[bc.nl]))
+		if r.file != nil {
+			r.file.AddLine(r.offset)
+		}
 	} else {
-		r.newLine = false
+		r.offset += uint32(utf8.RuneLen(c))
+	}
+	if r.record && c >= utf8.RuneSelf {
+		r.recorded = append(r.recorded, recordedChar{c, r.line, r.col})
 	}
 
 	return c, nil
@@ -132,30 +428,98 @@ func (r *CharReader) ReadSlice(n uint32) ([]rune, error) {
 // beyond the end of the data. A rune value of 0 is
 // returned on error.
 func (r *CharReader) PeekChar() (rune, error) {
-	if len(r.cache) > 0 {
-		return r.cache[0], nil
+	return r.PeekCharAt(0)
+}
+
+// Peeks at the character |i| characters after the next character to be
+// read. PeekCharAt(0) is the same as PeekChar. The error returned will be
+// io.EOF if trying to peek beyond the end of the data.
+func (r *CharReader) PeekCharAt(i uint32) (rune, error) {
+	if i >= MaxLookahead {
+		return 0, fmt.Errorf("Cannot peek beyond %d characters.", MaxLookahead)
+	}
+	if err := r.fill(int(i)); err != nil {
+		return 0, err
 	}
+	return r.slot(r.head + int(i)).c, nil
+}
 
-	c, err := r.readOutChar()
-	if err != nil {
-		return c, err
+// Returns true if the next character to be read is an invalid byte read
+// as utf8.RuneError.
+func (r *CharReader) peekInvalid() bool {
+	if err := r.fill(0); err != nil {
+		return false
 	}
-	r.cache = append(r.cache, c)
+	return r.slot(r.head).invalid
+}
 
-	return c, nil
+// Returns true if the characters to be read next are the characters of
+// |s|, false otherwise.
+func (r *CharReader) PeekMatch(s string) bool {
+	i := uint32(0)
+	for _, c := range s {
+		p, err := r.PeekCharAt(i)
+		if err != nil || p != c {
+			return false
+		}
+		i += 1
+	}
+	return true
 }
 
 // Peek and return a slice of n characters if available.
 // The error returned will be io.EOF if trying to peek
 // beyond the end of the data. 'nil' is returned on error.
+// The returned slice is a copy which is not modified by
+// further reads.
 func (r *CharReader) PeekSlice(n uint32) ([]rune, error) {
-	m := uint32(len(r.cache))
-	for i := m; i < n; i++ {
-		c, err := r.readOutChar()
-		if err != nil {
-			return nil, err
-		}
-		r.cache = append(r.cache, c)
+	if n > MaxLookahead {
+		return nil, fmt.Errorf("Cannot peek beyond %d characters.", MaxLookahead)
+	}
+	if err := r.fill(int(n) - 1); err != nil {
+		return nil, err
+	}
+
+	s := make([]rune, n)
+	for i := range s {
+		s[i] = r.slot(r.head + i).c
+	}
+	return s, nil
+}
+
+// Returns a mark at the next character to be read. The characters read
+// after the mark are retained until the mark is released by Reset or
+// Release, up to MaxMarkWindow characters.
+func (r *CharReader) Mark() CharMark {
+	if r.marks == nil {
+		r.marks = make(map[int]int)
+	}
+	r.marks[r.head] += 1
+	return CharMark{r.head, r.readerPosition, len(r.recorded)}
+}
+
+// Rewinds the reader to |m| and releases |m|. The characters read after
+// the mark are read again, and the line, column and offset are restored.
+func (r *CharReader) Reset(m CharMark) {
+	if r.marks[m.index] == 0 {
+		panic("Reset to a released mark.")
+	}
+	r.head = m.index
+	r.readerPosition = m.pos
+	if m.recorded < len(r.recorded) {
+		r.recorded = r.recorded[:m.recorded]
+	}
+	r.Release(m)
+}
+
+// Releases |m| without rewinding the reader.
+func (r *CharReader) Release(m CharMark) {
+	if r.marks[m.index] == 0 {
+		panic("Releasing a released mark.")
+	}
+	r.marks[m.index] -= 1
+	if r.marks[m.index] == 0 {
+		delete(r.marks, m.index)
 	}
-	return r.cache[0:n], nil
+	r.release()
 }
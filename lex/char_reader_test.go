@@ -2,8 +2,10 @@ package lex
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -191,3 +193,178 @@ func TestReadingBeyongEOF(t *testing.T) {
 		t.Errorf("Reading too much should result in EOF error.")
 	}
 }
+
+func TestMarkReset(t *testing.T) {
+	r := NewCharReader(strings.NewReader("ab\r\ncd\nef"))
+
+	c, _ := r.ReadChar()
+	if c != 'a' {
+		t.Fatalf("Expected 'a', but got '%c'.", c)
+	}
+
+	m := r.Mark()
+	s, err := r.ReadSlice(5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(s) != "b\ncd\n" || r.Line() != 2 || r.NextOffset() != 7 {
+		t.Fatalf("Expected 'b\\ncd\\n' ending on line 2, but got '%s' on line %d.", string(s), r.Line())
+	}
+
+	r.Reset(m)
+	if r.Line() != 1 || r.Col() != 1 || r.NextCol() != 2 || r.NextOffset() != 1 {
+		t.Errorf("Expected the position after 'a', but got %d:%d.", r.Line(), r.Col())
+	}
+	if r.NewLineSpelling() != "" {
+		t.Errorf("Expected no new line to have been read after a reset.")
+	}
+
+	// Nested marks.
+	m1 := r.Mark()
+	r.ReadSlice(2)
+	if r.NewLineSpelling() != "\r\n" {
+		t.Errorf("Expected the new line to be spelt '\\r\\n', but got %q.", r.NewLineSpelling())
+	}
+	m2 := r.Mark()
+	r.ReadSlice(3)
+	r.Reset(m2)
+	if c, _ := r.PeekChar(); c != 'c' || r.NextLine() != 2 || r.NextCol() != 1 {
+		t.Errorf("Expected to be at 'c' at 2:1, but got '%c' at %d:%d.", c, r.NextLine(), r.NextCol())
+	}
+	r.Reset(m1)
+	if c, _ := r.PeekChar(); c != 'b' {
+		t.Errorf("Expected to be at 'b', but got '%c'.", c)
+	}
+
+	m3 := r.Mark()
+	r.ReadSlice(4)
+	r.Release(m3)
+	s, _ = r.ReadSlice(3)
+	if string(s) != "\nef" || r.NextOffset() != 9 {
+		t.Errorf("Expected '\\nef', but got '%s'.", string(s))
+	}
+}
+
+func TestMarkWindow(t *testing.T) {
+	r := NewBytesCharReader(bytes.Repeat([]byte("a"), 2*MaxMarkWindow))
+	m := r.Mark()
+	if _, err := r.ReadSlice(MaxMarkWindow - 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := r.PeekCharAt(1); err == nil || err == io.EOF {
+		t.Errorf("Expected an error for peeking beyond the window of a mark, but got: %v", err)
+	}
+	if _, err := r.ReadSlice(2); err == nil || err == io.EOF {
+		t.Errorf("Expected an error for reading beyond the window of a mark, but got: %v", err)
+	}
+
+	// The reader can be reset to the mark, and reads on once it is released.
+	r.Reset(m)
+	if r.NextOffset() != 0 {
+		t.Errorf("Expected to be at the mark, but got the offset %d.", r.NextOffset())
+	}
+	if _, err := r.ReadSlice(2 * MaxMarkWindow); err != nil {
+		t.Errorf("Expected to read the text without a mark, but got: %v", err)
+	}
+	if len(r.buf) > MaxMarkWindow {
+		t.Errorf("Expected the buffer to be at most %d characters, but got %d.", MaxMarkWindow, len(r.buf))
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	lines := SplitLines([]byte("a\r\nb\rc\u0085d\u2028e\u2029f\n\xe2g\n"))
+	expected := []string{"a", "b", "c", "d", "e", "f", "\xe2g", ""}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, but got %q.", len(expected), lines)
+	}
+	for i, l := range lines {
+		if string(l) != expected[i] {
+			t.Errorf("Expected the line %d to be %q, but got %q.", i+1, expected[i], string(l))
+		}
+	}
+}
+
+func TestPeekSliceCopy(t *testing.T) {
+	r := NewCharReader(strings.NewReader("abcdef"))
+	s, err := r.PeekSlice(3)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r.ReadSlice(2)
+	r.PeekSlice(4)
+	if string(s) != "abc" {
+		t.Errorf("Expected the peeked slice to be 'abc', but got '%s'.", string(s))
+	}
+
+	if c, _ := r.PeekCharAt(3); c != 'f' {
+		t.Errorf("Expected 'f', but got '%c'.", c)
+	}
+	if !r.PeekMatch("cd") || r.PeekMatch("cx") || r.PeekMatch("cdefg") {
+		t.Errorf("PeekMatch does not match the next characters.")
+	}
+
+	if _, err := r.PeekCharAt(MaxLookahead); err == nil || err == io.EOF {
+		t.Errorf("Expected an error for peeking beyond the lookahead, but got: %v", err)
+	}
+}
+
+// Returns about |size| bytes of text for benchmarks.
+func benchmarkText(size int) []byte {
+	line := "    self._z = z or '\\tHello, World'  # A comment.\r\n"
+	return bytes.Repeat([]byte(line), size/len(line))
+}
+
+func benchmarkReader(b *testing.B, newReader func(text []byte) *CharReader) {
+	text := benchmarkText(4 << 20)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := newReader(text)
+		for {
+			if _, err := r.PeekCharAt(2); err != nil {
+				break
+			}
+			if _, err := r.ReadChar(); err != nil {
+				b.Fatal(err.Error())
+			}
+		}
+	}
+}
+
+func BenchmarkCharReader(b *testing.B) {
+	benchmarkReader(b, func(text []byte) *CharReader {
+		return NewCharReader(bufio.NewReader(bytes.NewReader(text)))
+	})
+}
+
+func BenchmarkBytesCharReader(b *testing.B) {
+	benchmarkReader(b, NewBytesCharReader)
+}
+
+func BenchmarkCharReaderMark(b *testing.B) {
+	text := benchmarkText(4 << 20)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := NewBytesCharReader(text)
+		// The characters are read with an outstanding mark, which is moved
+		// forward every 1024 characters.
+		m := r.Mark()
+		for n := 1; ; n++ {
+			if _, err := r.PeekCharAt(2); err != nil {
+				break
+			}
+			if _, err := r.ReadChar(); err != nil {
+				b.Fatal(err.Error())
+			}
+			if n%1024 == 0 {
+				r.Release(m)
+				m = r.Mark()
+			}
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Package clone finds duplicated code, like copy and pasted functions, in
+// the tokens of a set of files.
+//
+// The comments and the line structure are ignored, so that the code is
+// compared token by token whatever its layout. The identifiers and the
+// literals can also be ignored, to find the copies which were renamed or
+// had their constants changed.
+package clone
+
+import (
+	"io"
+	"sort"
+	"uno/lex"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// The options of a Detector.
+type Options struct {
+	// The minimum number of tokens of a clone. If it is not positive,
+	// DefaultMinTokens is used.
+	MinTokens int
+	// If true, the identifiers are compared by kind only.
+	IgnoreIdentifiers bool
+	// If true, the string and number literals are compared by kind only.
+	IgnoreLiterals bool
+}
+
+// The default minimum number of tokens of a clone.
+const DefaultMinTokens = 50
+
+// A region of a file which is a copy of another.
+type Location struct {
+	Path string
+	// The position of the first token of the region.
+	StartLine uint32
+	StartCol  uint32
+	// The line of the end of the last token of the region.
+	EndLine uint32
+	// The range [Start, End) of the indices of the tokens of the region in
+	// the tokens of the file.
+	Start int
+	End   int
+}
+
+// A piece of code found in several locations.
+type Clone struct {
+	// The number of tokens, not counting the comments and the tokens of
+	// the line structure like NewLine.
+	Tokens    int
+	Locations []Location
+}
+
+// The tokens of a file to search for clones.
+type File struct {
+	Path   string
+	Tokens []*lex.Token
+	// The line of the end of each token, which is after the line of the
+	// token if its source spans lines. If it is nil, the tokens end on
+	// their lines.
+	EndLines []uint32
+}
+
+// Returns the number of new lines in |b|, which are those of the lexer,
+// like "\r\n" or U+2028.
+func countLines(b []byte) uint32 {
+	n := uint32(0)
+	for i := 0; i < len(b); i++ {
+		if l := lex.NewLineLen(b[i:]); l > 0 {
+			n++
+			i += l - 1
+		}
+	}
+	return n
+}
+
+// Returns the File |path| with the tokens read by |tz| from the text
+// |text|, like the Tokenizer of Profile.NewBytesTokenizer. The end lines
+// of the tokens are found from their source in |text|, as their values
+// can have new lines which are escape sequences, like "a\nb". If lexing
+// fails, the File is returned with the tokens before the error, along
+// with the error.
+func NewFile(path string, text []byte, tz *lex.Tokenizer) (*File, error) {
+	f := &File{Path: path}
+	for tz.HasNext() {
+		t, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return f, err
+		}
+		start, end := tz.Offsets()
+		f.Tokens = append(f.Tokens, t)
+		f.EndLines = append(f.EndLines, t.Line+countLines(text[start:end]))
+	}
+	return f, nil
+}
+
+// The tokens of a file which are compared.
+type file struct {
+	*File
+	// The indices in |Tokens| of the compared tokens.
+	indices []int
+}
+
+// A Detector finds the clones in the files added to it.
+type Detector struct {
+	o     Options
+	files []file
+
+	// The compared tokens of all the files, as the IDs of their kinds and
+	// values. The files are separated by a negative ID, so that a match
+	// never spans two files.
+	seq []int32
+	// The file and the index in the compared tokens of the file of each
+	// element of |seq|.
+	fileOf  []int
+	indexOf []int
+
+	ids map[string]int32
+}
+
+// Returns a new Detector with the options |o|.
+func NewDetector(o Options) *Detector {
+	if o.MinTokens <= 0 {
+		o.MinTokens = DefaultMinTokens
+	}
+	d := new(Detector)
+	d.o = o
+	d.ids = make(map[string]int32)
+	return d
+}
+
+// Returns true if the tokens of kind |kind| are ignored.
+func ignored(kind uint32) bool {
+	return lex.IsLayout(kind) || highlight.ClassOf(kind) == highlight.Comment
+}
+
+// Returns the ID of the token |t|, which is the same for the tokens which
+// are compared equal.
+func (d *Detector) id(t *lex.Token) int32 {
+	value := t.Value
+	switch highlight.ClassOf(t.Kind) {
+	case highlight.Identifier:
+		if d.o.IgnoreIdentifiers {
+			value = ""
+		}
+	case highlight.String, highlight.Number:
+		if d.o.IgnoreLiterals {
+			value = ""
+		}
+	}
+
+	key := token_kind.Name(t.Kind) + "\x00" + value
+	id, ok := d.ids[key]
+	if !ok {
+		id = int32(len(d.ids))
+		d.ids[key] = id
+	}
+	return id
+}
+
+// Adds the tokens of the file |f|.
+func (d *Detector) Add(f *File) {
+	df := file{File: f}
+	fi := len(d.files)
+	for i, t := range f.Tokens {
+		if ignored(t.Kind) {
+			continue
+		}
+		d.seq = append(d.seq, d.id(t))
+		d.fileOf = append(d.fileOf, fi)
+		d.indexOf = append(d.indexOf, len(df.indices))
+		df.indices = append(df.indices, i)
+	}
+	d.seq = append(d.seq, -1)
+	d.fileOf = append(d.fileOf, fi)
+	d.indexOf = append(d.indexOf, len(df.indices))
+	d.files = append(d.files, df)
+}
+
+// Returns the positions in |d.seq| of the windows of MinTokens tokens,
+// grouped by a rolling hash of their tokens.
+func (d *Detector) windows() map[uint64][]int {
+	const base = 1000003
+	m := d.o.MinTokens
+
+	// base^(m-1), to remove the first token of a window from the hash.
+	pow := uint64(1)
+	for i := 1; i < m; i++ {
+		pow *= base
+	}
+
+	windows := make(map[uint64][]int)
+	var h uint64
+	// The number of tokens in the current window, which restarts after a
+	// file separator.
+	n := 0
+	for i, id := range d.seq {
+		if id < 0 {
+			h, n = 0, 0
+			continue
+		}
+		if n == m {
+			h -= uint64(d.seq[i-m]) * pow
+			n--
+		}
+		h = h*base + uint64(id)
+		n++
+		if n == m {
+			windows[h] = append(windows[h], i-m+1)
+		}
+	}
+	return windows
+}
+
+// Returns the clones of at least MinTokens tokens in the files added so
+// far, from the longest to the shortest. Each clone is the longest common
+// run of tokens of its locations. Two copies which overlap in a file are
+// not reported, as a repeated run of tokens would otherwise match itself,
+// and neither is a clone whose locations are all in the locations of a
+// longer clone.
+//
+// The windows of MinTokens tokens are grouped by hash and compared in
+// pairs, so the time can be quadratic for code which repeats the same
+// tokens many times, like large tables of numbers with IgnoreLiterals.
+func (d *Detector) Clones() []Clone {
+	// The matches are grouped by length, and by the locations they share.
+	type node struct {
+		pos    int
+		length int
+	}
+	parent := make(map[node]node)
+	var find func(n node) node
+	find = func(n node) node {
+		p, ok := parent[n]
+		if !ok || p == n {
+			return n
+		}
+		r := find(p)
+		parent[n] = r
+		return r
+	}
+
+	for _, ps := range d.windows() {
+		for a := 0; a < len(ps); a++ {
+			for b := a + 1; b < len(ps); b++ {
+				i, j := ps[a], ps[b]
+				// Only the matches which cannot be extended to the left are
+				// reported.
+				if i > 0 && d.seq[i-1] >= 0 && d.seq[i-1] == d.seq[j-1] {
+					continue
+				}
+				l := 0
+				for j+l < len(d.seq) && d.seq[i+l] >= 0 && d.seq[i+l] == d.seq[j+l] {
+					l++
+				}
+				if d.fileOf[i] == d.fileOf[j] && i+l > j {
+					l = j - i
+				}
+				if l < d.o.MinTokens {
+					// A collision of the hash, or an overlapping copy.
+					continue
+				}
+
+				ni, nj := node{i, l}, node{j, l}
+				if _, ok := parent[ni]; !ok {
+					parent[ni] = ni
+				}
+				if _, ok := parent[nj]; !ok {
+					parent[nj] = nj
+				}
+				parent[find(nj)] = find(ni)
+			}
+		}
+	}
+
+	groups := make(map[node][]int)
+	for n := range parent {
+		r := find(n)
+		groups[r] = append(groups[r], n.pos)
+	}
+
+	var clones []Clone
+	for r, ps := range groups {
+		sort.Ints(ps)
+		c := Clone{Tokens: r.length}
+		for _, p := range ps {
+			c.Locations = append(c.Locations, d.location(p, r.length))
+		}
+		clones = append(clones, c)
+	}
+	sort.Slice(clones, func(i, j int) bool {
+		a, b := clones[i], clones[j]
+		if a.Tokens != b.Tokens {
+			return a.Tokens > b.Tokens
+		}
+		la, lb := a.Locations[0], b.Locations[0]
+		if la.Path != lb.Path {
+			return la.Path < lb.Path
+		}
+		return la.Start < lb.Start
+	})
+
+	var reported []Location
+	contained := func(l Location) bool {
+		for _, r := range reported {
+			if r.Path == l.Path && r.Start <= l.Start && l.End <= r.End {
+				return true
+			}
+		}
+		return false
+	}
+	var result []Clone
+	for _, c := range clones {
+		all := true
+		for _, l := range c.Locations {
+			all = all && contained(l)
+		}
+		if all {
+			continue
+		}
+		result = append(result, c)
+		reported = append(reported, c.Locations...)
+	}
+	return result
+}
+
+// Returns the location of the |length| tokens at |pos| in |d.seq|.
+func (d *Detector) location(pos, length int) Location {
+	f := &d.files[d.fileOf[pos]]
+	start := f.indices[d.indexOf[pos]]
+	last := f.indices[d.indexOf[pos+length-1]]
+	first, lt := f.Tokens[start], f.Tokens[last]
+	endLine := lt.Line
+	if f.EndLines != nil {
+		endLine = f.EndLines[last]
+	}
+	return Location{
+		Path:      f.Path,
+		StartLine: first.Line,
+		StartCol:  first.Col,
+		EndLine:   endLine,
+		Start:     start,
+		End:       last + 1,
+	}
+}
+
+// Returns the clones in |files| found with the options |o|.
+func Detect(files []*File, o Options) []Clone {
+	d := NewDetector(o)
+	for _, f := range files {
+		d.Add(f)
+	}
+	return d.Clones()
+}
@@ -0,0 +1,133 @@
+package clone
+
+import (
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func newFile(t *testing.T, path, text string) *File {
+	tz, err := lex.ProfileForFile(path).NewBytesTokenizer([]byte(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	f, err := NewFile(path, []byte(text), tz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return f
+}
+
+const sum = `int sum(int *a, int n) {
+	int s = 0;
+	for (int i = 0; i < n; i++) {
+		s += a[i];
+	}
+	return s;
+}
+`
+
+// The same function with other names, comments and layout.
+const total = `/* Adds up the values. */
+int total(int *v, int count) {
+	int t = 0;
+	for (int j = 0; j < count; j++) { t += v[j]; }  // The loop.
+	return t;
+}
+`
+
+func TestClones(t *testing.T) {
+	d := NewDetector(Options{MinTokens: 20})
+	d.Add(newFile(t, "a.c", "int x;\n"+sum+"int y;\n"))
+	d.Add(newFile(t, "b.c", sum))
+	d.Add(newFile(t, "c.c", total))
+
+	clones := d.Clones()
+	if len(clones) != 1 {
+		t.Fatalf("Expected a clone, but got %v.", clones)
+	}
+	c := clones[0]
+	if c.Tokens != 43 || len(c.Locations) != 2 {
+		t.Fatalf("Unexpected clone %+v.", c)
+	}
+	expected := []Location{
+		{Path: "a.c", StartLine: 2, StartCol: 1, EndLine: 8, Start: 3, End: 46},
+		{Path: "b.c", StartLine: 1, StartCol: 1, EndLine: 7, Start: 0, End: 43},
+	}
+	for i, l := range c.Locations {
+		if l != expected[i] {
+			t.Errorf("Expected the location %+v, but got %+v.", expected[i], l)
+		}
+	}
+}
+
+func TestEndLine(t *testing.T) {
+	// The clones end with a string whose new lines are escape sequences,
+	// and the comment before the second one spans two lines.
+	a := "int f() { return g(1, \"a\") + g(2, \"b\") + \"a\\nb\\nc\"; }\n"
+	b := "/* A\n */ int f() { return g(1, \"a\") + g(2, \"b\") + \"a\\nb\\nc\" + x; }\n"
+	clones := Detect([]*File{newFile(t, "a.c", a), newFile(t, "b.c", b)}, Options{MinTokens: 10})
+	if len(clones) != 1 || len(clones[0].Locations) != 2 {
+		t.Fatalf("Expected a clone, but got %+v.", clones)
+	}
+	for i, l := range clones[0].Locations {
+		if l.StartLine != uint32(i+1) || l.EndLine != uint32(i+1) {
+			t.Errorf("Expected the location on the line %d, but got %+v.", i+1, l)
+		}
+	}
+
+	// A string which spans lines.
+	c := "x = f(1, 2, \"\"\"a\nb\"\"\")\n"
+	l := Detect([]*File{newFile(t, "a.py", c+c)}, Options{MinTokens: 8})
+	if len(l) != 1 || l[0].Locations[0].EndLine != 2 || l[0].Locations[1].EndLine != 4 {
+		t.Errorf("Expected the clones to end on the lines 2 and 4, but got %+v.", l)
+	}
+}
+
+func TestIgnoreIdentifiers(t *testing.T) {
+	files := []*File{newFile(t, "a.c", sum), newFile(t, "b.c", sum), newFile(t, "c.c", total)}
+	clones := Detect(files, Options{MinTokens: 20, IgnoreIdentifiers: true})
+	if len(clones) != 1 || clones[0].Tokens != 43 || len(clones[0].Locations) != 3 {
+		t.Fatalf("Expected a clone in the three files, but got %+v.", clones)
+	}
+	if l := clones[0].Locations[2]; l.Path != "c.c" || l.StartLine != 2 || l.EndLine != 6 {
+		t.Errorf("Unexpected location %+v.", l)
+	}
+}
+
+func TestIgnoreLiterals(t *testing.T) {
+	a := "int f() { return g(1, \"a\") + g(2, \"b\") + g(3, \"c\"); }\n"
+	b := "int f() { return g(4, \"x\") + g(5, \"y\") + g(6, \"z\"); }\n"
+	files := []*File{newFile(t, "a.c", a), newFile(t, "b.c", b)}
+
+	if clones := Detect(files, Options{MinTokens: 10}); len(clones) != 0 {
+		t.Errorf("Expected no clone, but got %+v.", clones)
+	}
+	clones := Detect(files, Options{MinTokens: 10, IgnoreLiterals: true})
+	if len(clones) != 1 || clones[0].Tokens != 28 {
+		t.Errorf("Expected a clone of the whole function, but got %+v.", clones)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	// A run of the same statement matches itself shifted, which is not a
+	// clone unless the copies do not overlap.
+	text := strings.Repeat("x = x + 1;\n", 6)
+	clones := Detect([]*File{newFile(t, "a.c", text)}, Options{MinTokens: 10})
+	if len(clones) != 2 {
+		t.Fatalf("Expected two clones, but got %+v.", clones)
+	}
+	if c := clones[0]; c.Tokens != 18 || len(c.Locations) != 2 {
+		t.Errorf("Expected the two halves of the text, but got %+v.", c)
+	}
+	if c := clones[1]; c.Tokens != 12 || len(c.Locations) != 3 {
+		t.Errorf("Expected the three thirds of the text, but got %+v.", c)
+	}
+	for _, c := range clones {
+		for i := 1; i < len(c.Locations); i++ {
+			if c.Locations[i-1].End > c.Locations[i].Start {
+				t.Errorf("Expected no overlap in %+v.", c)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lex
+
+import (
+	"fmt"
+	"unicode/utf8"
+	"uno/lex/char"
+)
+
+// The unit in which columns are counted.
+type ColumnMode uint32
+
+const (
+	// Each character is one column. This is the default mode.
+	RuneColumns = ColumnMode(iota)
+
+	// Each byte of the UTF-8 encoding of a character is one column, as
+	// reported by compilers.
+	ByteColumns
+
+	// Each UTF-16 code unit of a character is one column, as required by
+	// the Language Server Protocol.
+	UTF16Columns
+
+	// Columns are counted like an editor displays them: a tab advances
+	// the column to the next tab stop and every other character is one
+	// column.
+	VisualColumns
+)
+
+// Returns the column of the character following the character |c| which
+// is at column |col|.
+func advanceColumn(col uint32, c rune, m ColumnMode, tabWidth uint32) uint32 {
+	switch m {
+	case ByteColumns:
+		n := utf8.RuneLen(c)
+		if n < 0 {
+			// Invalid characters are replaced by the replacement
+			// character while reading.
+			n = utf8.RuneLen(utf8.RuneError)
+		}
+		return col + uint32(n)
+	case UTF16Columns:
+		if c >= 0x10000 {
+			// Characters outside the BMP are encoded as surrogate pairs.
+			return col + 2
+		}
+		return col + 1
+	case VisualColumns:
+		if c == char.Tab {
+			return ((col-1)/tabWidth+1)*tabWidth + 1
+		}
+		return col + 1
+	default:
+		return col + 1
+	}
+}
+
+func checkColumnMode(m ColumnMode, tabWidth uint32) error {
+	if m > VisualColumns {
+		return fmt.Errorf("Invalid column mode %d.", m)
+	}
+	if m == VisualColumns && tabWidth == 0 {
+		return fmt.Errorf("A non-zero tab width is required for visual columns.")
+	}
+	return nil
+}
+
+// Converts the column |col| on |line| counted in the mode |from| to the
+// column counted in the mode |to|. The argument |line| should not include
+// the new line character at its end. A column within a character, like a
+// byte column in the middle of a multibyte character or a visual column
+// within the span of a tab, is converted to the column of that character.
+// The column just past the end of the line can also be converted.
+func ConvertColumn(line string, col uint32, from, to ColumnMode, tabWidth uint32) (uint32, error) {
+	if err := checkColumnMode(from, tabWidth); err != nil {
+		return 0, err
+	}
+	if err := checkColumnMode(to, tabWidth); err != nil {
+		return 0, err
+	}
+	if col == 0 {
+		return 0, fmt.Errorf("Columns begin at 1.")
+	}
+
+	fc := uint32(1)
+	tc := uint32(1)
+	for _, c := range line {
+		next := advanceColumn(fc, c, from, tabWidth)
+		if col < next {
+			return tc, nil
+		}
+		fc = next
+		tc = advanceColumn(tc, c, to, tabWidth)
+	}
+
+	if col == fc {
+		return tc, nil
+	}
+	return 0, fmt.Errorf("Column %d is beyond the end of the line.", col)
+}
@@ -0,0 +1,101 @@
+package lex
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+func matchColumns(file string, m ColumnMode, tabWidth uint32, cols []uint32) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Error opening test file. \n%s", err.Error())
+	}
+	defer f.Close()
+
+	ts := NewTokenKindSet([]uint32{
+		token_kind.Identifier,
+		token_kind.Assign,
+		token_kind.Add,
+		token_kind.DoubleQuoteString,
+	})
+	var goEsr GoESR
+	tz, err := NewTokenizer(bufio.NewReader(f), ts, goEsr)
+	if err != nil {
+		return err
+	}
+	err = tz.SetColumnMode(m, tabWidth)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range cols {
+		t, err := tz.NextToken()
+		if err != nil {
+			return err
+		}
+		if t.Col != col {
+			return fmt.Errorf("Expected '%s' at column %d, but got %d.", t.Value, col, t.Col)
+		}
+	}
+	return nil
+}
+
+func TestColumnModes(t *testing.T) {
+	err := matchColumns("test_data/columns_text", RuneColumns, 0, []uint32{2, 5, 7, 11, 13})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	err = matchColumns("test_data/columns_text", ByteColumns, 0, []uint32{2, 5, 7, 12, 14})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	err = matchColumns("test_data/columns_text", UTF16Columns, 0, []uint32{2, 5, 7, 11, 13})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	err = matchColumns("test_data/columns_text", VisualColumns, 4, []uint32{5, 8, 10, 14, 16})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	err = matchColumns("test_data/columns_text", VisualColumns, 0, nil)
+	if err == nil {
+		t.Error("Expected an error for visual columns with a zero tab width.")
+	}
+}
+
+func TestConvertColumn(t *testing.T) {
+	line := "\tab = \"é\" + \U0001d4b3"
+	tests := []struct {
+		col      uint32
+		from, to ColumnMode
+		expected uint32
+	}{
+		{13, RuneColumns, ByteColumns, 14},
+		{14, ByteColumns, VisualColumns, 16},
+		{16, VisualColumns, UTF16Columns, 13},
+		// Within the span of a tab.
+		{3, VisualColumns, RuneColumns, 1},
+		// Within a multibyte character.
+		{9, ByteColumns, RuneColumns, 8},
+		// Just past the end of the line.
+		{15, UTF16Columns, RuneColumns, 14},
+	}
+
+	for _, test := range tests {
+		c, err := ConvertColumn(line, test.col, test.from, test.to, 4)
+		if err != nil {
+			t.Error(err.Error())
+		} else if c != test.expected {
+			t.Errorf("Expected column %d to be converted to %d, but got %d.",
+				test.col, test.expected, c)
+		}
+	}
+
+	_, err := ConvertColumn(line, 16, UTF16Columns, RuneColumns, 4)
+	if err == nil {
+		t.Error("Expected an error converting a column beyond the end of the line.")
+	}
+}
@@ -20,7 +20,7 @@ func (tz *Tokenizer) readPythonStyleComment() (*Token, error) {
 		return nil, err
 	}
 
-	var s []rune
+	s := tz.runes[:0]
 	c := h
 	for c != char.NewLine {
 		s = append(s, c)
@@ -30,14 +30,14 @@ func (tz *Tokenizer) readPythonStyleComment() (*Token, error) {
 		}
 	}
 
-	return newToken(token_kind.PySingleLineComment, s, line, col), nil
+	return tz.makeToken(token_kind.PySingleLineComment, s, line, col), nil
 }
 
 func (tz *Tokenizer) readCStyleSingleLineComment() (*Token, error) {
 	line := tz.r.NextLine()
 	col := tz.r.NextCol()
 
-	ss, err := tz.r.ReadSlice(2)
+	ss, err := tz.readSlice(2)
 	if err != nil {
 		err = fmt.Errorf("Expected to read a comment begging with '//'.\n%s", err.Error())
 		return nil, err
@@ -47,8 +47,7 @@ func (tz *Tokenizer) readCStyleSingleLineComment() (*Token, error) {
 		return nil, fmt.Errorf("Expected a comment beginning with '//'.")
 	}
 
-	var s []rune
-	s = append(s, ss[0])
+	s := ss[:1]
 	c := ss[1]
 	for c != char.NewLine {
 		s = append(s, c)
@@ -58,14 +57,14 @@ func (tz *Tokenizer) readCStyleSingleLineComment() (*Token, error) {
 		}
 	}
 
-	return newToken(token_kind.CSingleLineComment, s, line, col), nil
+	return tz.makeToken(token_kind.CSingleLineComment, s, line, col), nil
 }
 
 func (tz *Tokenizer) readCStyleMultiLineComment() (*Token, error) {
 	line := tz.r.NextLine()
 	col := tz.r.NextCol()
 
-	ss, err := tz.r.ReadSlice(2)
+	ss, err := tz.readSlice(2)
 	if err != nil {
 		err = fmt.Errorf("Expected to read a comment begging with '/*'.\n%s", err.Error())
 		return nil, err
@@ -75,20 +74,10 @@ func (tz *Tokenizer) readCStyleMultiLineComment() (*Token, error) {
 		return nil, fmt.Errorf("Expected a comment beginning with '/*'.")
 	}
 
-	var s []rune
-	s = append(s, ss...)
-	for true {
-		c, err := tz.r.ReadChar()
-		if err != nil {
-			return nil, fmt.Errorf("Error reading multine comment.\n%s", err.Error())
-		}
-
-		s = append(s, c)
-
-		if l := len(s); string(s[l-2:l]) == "*/" {
-			break
-		}
+	s, err := tz.readUntil(ss, "*/", token_kind.CMultiLineComment)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading multine comment.\n%s", err.Error())
 	}
 
-	return newToken(token_kind.CMultiLineComment, s, line, col), nil
+	return tz.makeToken(token_kind.CMultiLineComment, s, line, col), nil
 }
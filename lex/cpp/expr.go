@@ -0,0 +1,320 @@
+package cpp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+// Evaluates the condition of an #if, #ifdef, #ifndef or #elif directive.
+func (pp *Preprocessor) evalCondition(s *source, directive string, hash *lex.Token, line []*ppToken) (bool, error) {
+	if directive == "ifdef" || directive == "ifndef" {
+		if len(line) != 1 || !isIdentLike(line[0].t) {
+			return false, pp.errorAt(s, hash, "Expected a macro name after #%s", directive)
+		}
+		return pp.IsDefined(line[0].t.Value) == (directive == "ifdef"), nil
+	}
+
+	if len(line) == 0 {
+		return false, pp.errorAt(s, hash, "Expected an expression after #%s", directive)
+	}
+
+	// The 'defined' operator is evaluated before macro expansion.
+	var toks []*ppToken
+	for i := 0; i < len(line); i++ {
+		t, space := line[i].t, line[i].space
+		if t.Value != "defined" {
+			toks = append(toks, line[i])
+			continue
+		}
+
+		var name *lex.Token
+		switch {
+		case i+1 < len(line) && isIdentLike(line[i+1].t):
+			name = line[i+1].t
+			i += 1
+		case i+3 < len(line) && line[i+1].t.Kind == token_kind.LeftParen &&
+			isIdentLike(line[i+2].t) && line[i+3].t.Kind == token_kind.RightParen:
+			name = line[i+2].t
+			i += 3
+		default:
+			return false, pp.errorAt(s, t, "Expected a macro name after 'defined'")
+		}
+
+		v := "0"
+		if pp.IsDefined(name.Value) {
+			v = "1"
+		}
+		d := &lex.Token{Kind: token_kind.DecimalInteger, Value: v, Line: t.Line, Col: t.Col}
+		toks = append(toks, &ppToken{t: d, file: s.name, space: space})
+	}
+
+	toks, err := pp.expandList(toks)
+	if err != nil {
+		return false, err
+	}
+
+	e := &exprParser{}
+	for _, t := range toks {
+		e.toks = append(e.toks, t.t)
+	}
+	v, err := e.parse(0)
+	if err == nil && e.pos < len(e.toks) {
+		err = fmt.Errorf("Unexpected '%s'", e.toks[e.pos].Value)
+	}
+	if err != nil {
+		return false, pp.errorAt(s, hash, "Invalid expression in #%s: %s", directive, err.Error())
+	}
+	return v.v != 0, nil
+}
+
+// The precedence of the binary operators allowed in constant expressions.
+var binaryPrecedence = map[uint32]int{
+	token_kind.LogicalOr:        1,
+	token_kind.LogicalAnd:       2,
+	token_kind.BitwiseOr:        3,
+	token_kind.BitwiseXor:       4,
+	token_kind.BitwiseAnd:       5,
+	token_kind.Equal:            6,
+	token_kind.NotEqual:         6,
+	token_kind.LessThan:         7,
+	token_kind.LessThanEqual:    7,
+	token_kind.GreaterThan:      7,
+	token_kind.GreaterThanEqual: 7,
+	token_kind.LeftShift:        8,
+	token_kind.RightShift:       8,
+	token_kind.Add:              9,
+	token_kind.Sub:              9,
+	token_kind.Mul:              10,
+	token_kind.Div:              10,
+	token_kind.Mod:              10,
+}
+
+// The value of a constant expression. As in C, the expression is
+// evaluated in intmax_t or uintmax_t, which are int64 and uint64 here.
+type value struct {
+	v        int64
+	unsigned bool
+}
+
+// A precedence climbing parser which evaluates the constant expression
+// in the tokens as it parses them. The operands which C does not evaluate,
+// like the right hand side of '0 && x', are parsed with |skip| above 0.
+type exprParser struct {
+	toks []*lex.Token
+	pos  int
+	skip int
+}
+
+func (e *exprParser) parse(minPrec int) (value, error) {
+	lhs, err := e.unary()
+	if err != nil {
+		return value{}, err
+	}
+
+	for e.pos < len(e.toks) {
+		op := e.toks[e.pos]
+		prec, isOp := binaryPrecedence[op.Kind]
+		if !isOp || prec <= minPrec {
+			break
+		}
+		e.pos += 1
+
+		// The right hand side of '&&' and '||' is not evaluated if the
+		// left hand side gives the result.
+		skip := (op.Kind == token_kind.LogicalAnd && lhs.v == 0) ||
+			(op.Kind == token_kind.LogicalOr && lhs.v != 0)
+		rhs, err := e.parseSkipped(prec, skip)
+		if err != nil {
+			return value{}, err
+		}
+		lhs, err = e.binary(op, lhs, rhs)
+		if err != nil {
+			return value{}, err
+		}
+	}
+
+	// The conditional operator has the lowest precedence, and it groups
+	// from right to left. Only one of its operands is evaluated, but the
+	// type of the result depends on both.
+	if minPrec > 0 || e.pos >= len(e.toks) || e.toks[e.pos].Kind != token_kind.QuestionMark {
+		return lhs, nil
+	}
+	e.pos += 1
+	then, err := e.parseSkipped(0, lhs.v == 0)
+	if err != nil {
+		return value{}, err
+	}
+	if e.pos >= len(e.toks) || e.toks[e.pos].Kind != token_kind.Colon {
+		return value{}, fmt.Errorf("Missing ':'")
+	}
+	e.pos += 1
+	otherwise, err := e.parseSkipped(0, lhs.v != 0)
+	if err != nil {
+		return value{}, err
+	}
+	unsigned := then.unsigned || otherwise.unsigned
+	if lhs.v != 0 {
+		return value{then.v, unsigned}, nil
+	}
+	return value{otherwise.v, unsigned}, nil
+}
+
+// Parses an operand, which is not evaluated if |skip| is true.
+func (e *exprParser) parseSkipped(minPrec int, skip bool) (value, error) {
+	if skip {
+		e.skip += 1
+		defer func() { e.skip -= 1 }()
+	}
+	return e.parse(minPrec)
+}
+
+func (e *exprParser) unary() (value, error) {
+	if e.pos >= len(e.toks) {
+		return value{}, fmt.Errorf("Unexpected end of expression")
+	}
+
+	t := e.toks[e.pos]
+	e.pos += 1
+	switch t.Kind {
+	case token_kind.Add, token_kind.Sub, token_kind.LogicalNot, token_kind.BitwiseNeg:
+		v, err := e.unary()
+		if err != nil {
+			return value{}, err
+		}
+		switch t.Kind {
+		case token_kind.Sub:
+			return value{-v.v, v.unsigned}, nil
+		case token_kind.LogicalNot:
+			return boolValue(v.v == 0), nil
+		case token_kind.BitwiseNeg:
+			return value{^v.v, v.unsigned}, nil
+		}
+		return v, nil
+	case token_kind.LeftParen:
+		v, err := e.parse(0)
+		if err != nil {
+			return value{}, err
+		}
+		if e.pos >= len(e.toks) || e.toks[e.pos].Kind != token_kind.RightParen {
+			return value{}, fmt.Errorf("Missing ')'")
+		}
+		e.pos += 1
+		return v, nil
+	case token_kind.DecimalInteger, token_kind.HexInteger, token_kind.OctInteger:
+		return integer(t)
+	case token_kind.SingleQuoteCharacter:
+		return value{v: int64([]rune(t.Value)[1])}, nil
+	}
+
+	if isIdentLike(t) {
+		// Identifiers remaining after macro expansion evaluate to 0.
+		return value{}, nil
+	}
+	return value{}, fmt.Errorf("Unexpected '%s'", t.Value)
+}
+
+// Returns the value of the integer constant |t|, which can have the
+// suffixes 'u' and 'l', like 10UL. A constant is unsigned if it has the
+// suffix 'u', or if it is octal or hexadecimal and too large for int64.
+func integer(t *lex.Token) (value, error) {
+	digits := strings.TrimRight(t.Value, "uUlL")
+	suffix := strings.ToLower(t.Value[len(digits):])
+	switch suffix {
+	case "", "l", "ll":
+		v, err := strconv.ParseInt(digits, 0, 64)
+		if err == nil {
+			return value{v: v}, nil
+		}
+		if t.Kind == token_kind.DecimalInteger {
+			break
+		}
+		fallthrough
+	case "u", "ul", "lu", "ull", "llu":
+		v, err := strconv.ParseUint(digits, 0, 64)
+		if err == nil {
+			return value{int64(v), true}, nil
+		}
+	}
+	return value{}, fmt.Errorf("Invalid integer '%s'", t.Value)
+}
+
+func boolValue(b bool) value {
+	if b {
+		return value{v: 1}
+	}
+	return value{}
+}
+
+// Returns the result of the binary operator |op|. As in C, the operands
+// are converted to unsigned if either of them is unsigned, but for the
+// shifts, whose result has the type of the left hand side.
+func (e *exprParser) binary(op *lex.Token, lhs, rhs value) (value, error) {
+	l, r := lhs.v, rhs.v
+	unsigned := lhs.unsigned || rhs.unsigned
+	switch op.Kind {
+	case token_kind.LogicalOr:
+		return boolValue(l != 0 || r != 0), nil
+	case token_kind.LogicalAnd:
+		return boolValue(l != 0 && r != 0), nil
+	case token_kind.BitwiseOr:
+		return value{l | r, unsigned}, nil
+	case token_kind.BitwiseXor:
+		return value{l ^ r, unsigned}, nil
+	case token_kind.BitwiseAnd:
+		return value{l & r, unsigned}, nil
+	case token_kind.Equal:
+		return boolValue(l == r), nil
+	case token_kind.NotEqual:
+		return boolValue(l != r), nil
+	case token_kind.LessThan:
+		return boolValue(less(l, r, unsigned)), nil
+	case token_kind.LessThanEqual:
+		return boolValue(!less(r, l, unsigned)), nil
+	case token_kind.GreaterThan:
+		return boolValue(less(r, l, unsigned)), nil
+	case token_kind.GreaterThanEqual:
+		return boolValue(!less(l, r, unsigned)), nil
+	case token_kind.LeftShift:
+		return value{l << uint64(r), lhs.unsigned}, nil
+	case token_kind.RightShift:
+		if lhs.unsigned {
+			return value{int64(uint64(l) >> uint64(r)), true}, nil
+		}
+		return value{l >> uint64(r), false}, nil
+	case token_kind.Add:
+		return value{l + r, unsigned}, nil
+	case token_kind.Sub:
+		return value{l - r, unsigned}, nil
+	case token_kind.Mul:
+		return value{l * r, unsigned}, nil
+	case token_kind.Div, token_kind.Mod:
+		if r == 0 {
+			if e.skip > 0 {
+				return value{0, unsigned}, nil
+			}
+			return value{}, fmt.Errorf("Division by zero")
+		}
+		switch {
+		case unsigned && op.Kind == token_kind.Div:
+			return value{int64(uint64(l) / uint64(r)), true}, nil
+		case unsigned:
+			return value{int64(uint64(l) % uint64(r)), true}, nil
+		case op.Kind == token_kind.Div:
+			return value{l / r, false}, nil
+		}
+		return value{l % r, false}, nil
+	}
+	return value{}, fmt.Errorf("Unexpected '%s'", op.Value)
+}
+
+// Returns true if |l| is less than |r|, compared as unsigned values if
+// |unsigned| is true.
+func less(l, r int64, unsigned bool) bool {
+	if unsigned {
+		return uint64(l) < uint64(r)
+	}
+	return l < r
+}
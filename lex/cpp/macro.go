@@ -0,0 +1,457 @@
+package cpp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+// A set of macro names which should not be expanded again while
+// rescanning the result of an expansion (the "hide set").
+type hideSet map[string]bool
+
+func (hs hideSet) union(other hideSet) hideSet {
+	u := make(hideSet)
+	for n := range hs {
+		u[n] = true
+	}
+	for n := range other {
+		u[n] = true
+	}
+	return u
+}
+
+func (hs hideSet) intersect(other hideSet) hideSet {
+	i := make(hideSet)
+	for n := range hs {
+		if other[n] {
+			i[n] = true
+		}
+	}
+	return i
+}
+
+func (hs hideSet) with(name string) hideSet {
+	return hs.union(hideSet{name: true})
+}
+
+// A token along with the file it was read from and its hide set.
+type ppToken struct {
+	t    *lex.Token
+	file string
+	hide hideSet
+	// The spelling of a string or character literal in the source, whose
+	// value has the escape sequences processed. It is empty for the other
+	// tokens, whose spelling is their value.
+	spelling string
+	// True if white space precedes the token, in the source or where the
+	// token was substituted.
+	space bool
+}
+
+// Returns the spelling of the token in the source.
+func (t *ppToken) spelled() string {
+	if t.spelling != "" {
+		return t.spelling
+	}
+	return t.t.Value
+}
+
+// The placemarker, which stands for an empty argument which is an operand
+// of the '##' operator while the replacement list is being built. It is
+// removed from the result.
+var placemarker = &ppToken{}
+
+type macro struct {
+	name     string
+	file     string // The file in which the macro was defined.
+	funcLike bool
+	variadic bool
+	params   []string
+	body     []*ppToken
+}
+
+// Returns true if the body of the macro begins or ends with the '##'
+// operator, which needs an operand on each side.
+func (m *macro) pastesAtEnd() bool {
+	n := len(m.body)
+	return n > 0 && (m.body[0].t.Kind == token_kind.CPPTokenPaste || m.body[n-1].t.Kind == token_kind.CPPTokenPaste)
+}
+
+// Returns the index of the parameter named |s|, or -1 if |s| is not
+// a parameter of the macro.
+func (m *macro) param(s string) int {
+	for i, p := range m.params {
+		if p == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// A source of tokens for macro expansion. The read method returns
+// io.EOF when no more tokens are available.
+type tokenReader interface {
+	read() (*ppToken, error)
+	unread(toks []*ppToken)
+}
+
+type listReader struct {
+	toks []*ppToken
+}
+
+func (r *listReader) read() (*ppToken, error) {
+	if len(r.toks) == 0 {
+		return nil, io.EOF
+	}
+	t := r.toks[0]
+	r.toks = r.toks[1:]
+	return t, nil
+}
+
+func (r *listReader) unread(toks []*ppToken) {
+	r.toks = append(append([]*ppToken(nil), toks...), r.toks...)
+}
+
+// Returns true if the token can name a macro. Keywords can be
+// redefined as macros, so they are treated like identifiers.
+func isIdentLike(t *lex.Token) bool {
+	return t.Kind == token_kind.Identifier ||
+		(token_kind.KeywordAnd <= t.Kind && t.Kind <= token_kind.KeywordYield)
+}
+
+// Returns true for the token kinds which are white space to the
+// pre-processor, namely comments and line joins.
+func isWhiteSpace(tt uint32) bool {
+	return tt == token_kind.CSingleLineComment || tt == token_kind.CMultiLineComment ||
+		tt == token_kind.LineJoin
+}
+
+// Returns true for the token kinds which end a line. A single line
+// comment includes the new line which ends it, so no NewLine follows it.
+func endsLine(tt uint32) bool {
+	return tt == token_kind.NewLine || tt == token_kind.CSingleLineComment
+}
+
+// Returns |toks| with the first token preceded by white space if |space|
+// is true, as the tokens substituted for a macro or a parameter are.
+func spaced(toks []*ppToken, space bool) []*ppToken {
+	if len(toks) == 0 || toks[0].space == space {
+		return toks
+	}
+	first := *toks[0]
+	first.space = space
+	return append([]*ppToken{&first}, toks[1:]...)
+}
+
+func copyToken(t *lex.Token) *lex.Token {
+	c := *t
+	return &c
+}
+
+func (pp *Preprocessor) lookup(t *ppToken) *macro {
+	if !isIdentLike(t.t) || t.hide[t.t.Value] {
+		return nil
+	}
+	return pp.macros[t.t.Value]
+}
+
+// Reads the next token from |r| and returns it after performing all the
+// macro expansions it triggers.
+func (pp *Preprocessor) expandNext(r tokenReader) (*ppToken, error) {
+	for {
+		t, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+
+		m := pp.lookup(t)
+		if m == nil {
+			return t, nil
+		}
+
+		if !m.funcLike {
+			toks, err := pp.substitute(m, nil, t.hide.with(m.name))
+			if err != nil {
+				return nil, err
+			}
+			r.unread(spaced(toks, t.space))
+			continue
+		}
+
+		args, rp, err := pp.readArgs(r, m, t)
+		if err != nil {
+			return nil, err
+		}
+		if rp == nil {
+			// A function-like macro name not followed by '(' is
+			// not an invocation.
+			return t, nil
+		}
+
+		toks, err := pp.substitute(m, args, t.hide.intersect(rp.hide).with(m.name))
+		if err != nil {
+			return nil, err
+		}
+		r.unread(spaced(toks, t.space))
+	}
+}
+
+// Fully macro expands a list of tokens.
+func (pp *Preprocessor) expandList(toks []*ppToken) ([]*ppToken, error) {
+	r := &listReader{append([]*ppToken(nil), toks...)}
+	var out []*ppToken
+	for {
+		t, err := pp.expandNext(r)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+}
+
+// Reads the arguments of an invocation of the function-like macro |m|.
+// If the macro name is not followed by a '(', then the tokens read are
+// put back into |r| and a nil right parenthesis is returned.
+func (pp *Preprocessor) readArgs(r tokenReader, m *macro, name *ppToken) ([][]*ppToken, *ppToken, error) {
+	var skipped []*ppToken
+	for {
+		t, err := r.read()
+		if err == io.EOF {
+			r.unread(skipped)
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		skipped = append(skipped, t)
+		if t.t.Kind == token_kind.NewLine || isWhiteSpace(t.t.Kind) {
+			continue
+		}
+		if t.t.Kind != token_kind.LeftParen {
+			r.unread(skipped)
+			return nil, nil, nil
+		}
+		break
+	}
+
+	args := [][]*ppToken{nil}
+	depth := 0
+	for {
+		t, err := r.read()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf(
+				"Unterminated argument list invoking macro '%s' at %s:%d:%d.",
+				m.name, name.file, name.t.Line, name.t.Col)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if isWhiteSpace(t.t.Kind) {
+			continue
+		}
+
+		switch t.t.Kind {
+		case token_kind.NewLine:
+			continue
+		case token_kind.LeftParen:
+			depth += 1
+		case token_kind.RightParen:
+			if depth == 0 {
+				args, err = m.checkArgs(args, name)
+				if err != nil {
+					return nil, nil, err
+				}
+				return args, t, nil
+			}
+			depth -= 1
+		case token_kind.Comma:
+			// The variable arguments are collected in to the last
+			// argument along with the commas separating them.
+			if depth == 0 && !(m.variadic && len(args) == len(m.params)) {
+				args = append(args, nil)
+				continue
+			}
+		}
+
+		args[len(args)-1] = append(args[len(args)-1], t)
+	}
+}
+
+func (m *macro) checkArgs(args [][]*ppToken, name *ppToken) ([][]*ppToken, error) {
+	if len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0 {
+		return nil, nil
+	}
+	if m.variadic && len(args) == len(m.params)-1 {
+		// The variable arguments can be omitted altogether.
+		args = append(args, nil)
+	}
+	if len(args) != len(m.params) {
+		return nil, fmt.Errorf(
+			"Macro '%s' requires %d arguments, but %d given at %s:%d:%d.",
+			m.name, len(m.params), len(args), name.file, name.t.Line, name.t.Col)
+	}
+	return args, nil
+}
+
+// Returns the replacement list of |m| with the parameters replaced by
+// |args|. Tokens from the macro body keep the positions at which they
+// appear in the macro definition and tokens from the arguments keep the
+// positions at which they appear in the macro invocation.
+func (pp *Preprocessor) substitute(m *macro, args [][]*ppToken, hs hideSet) ([]*ppToken, error) {
+	var out []*ppToken
+	body := m.body
+	for i := 0; i < len(body); i++ {
+		t := body[i].t
+
+		// Stringification.
+		if m.funcLike && t.Kind == token_kind.CPPDirective {
+			if p := m.param(t.Value[1:]); p >= 0 {
+				out = append(out, stringify(body[i], args[p], m.file))
+				continue
+			}
+		}
+		if m.funcLike && t.Kind == token_kind.CPPStringify && i+1 < len(body) {
+			if p := m.param(body[i+1].t.Value); p >= 0 {
+				out = append(out, stringify(body[i], args[p], m.file))
+				i += 1
+				continue
+			}
+		}
+
+		// Token pasting. The definition of the macro ensures that '##' is
+		// neither the first nor the last token of the body.
+		if t.Kind == token_kind.CPPTokenPaste && len(out) > 0 && i+1 < len(body) {
+			i += 1
+			var rhs []*ppToken
+			if p := m.param(body[i].t.Value); m.funcLike && p >= 0 {
+				rhs = args[p]
+			} else {
+				rhs = []*ppToken{&ppToken{t: body[i].t, file: m.file, spelling: body[i].spelling, space: body[i].space}}
+			}
+			if len(rhs) == 0 {
+				rhs = []*ppToken{placemarker}
+			}
+			switch lhs := out[len(out)-1]; {
+			case lhs == placemarker:
+				out[len(out)-1] = rhs[0]
+			case rhs[0] != placemarker:
+				pasted, err := pp.paste(lhs, rhs[0])
+				if err != nil {
+					return nil, err
+				}
+				out[len(out)-1] = pasted
+			}
+			out = append(out, rhs[1:]...)
+			continue
+		}
+
+		if p := m.param(t.Value); m.funcLike && p >= 0 {
+			if i+1 < len(body) && body[i+1].t.Kind == token_kind.CPPTokenPaste {
+				// Operands of '##' are not macro expanded, and an empty
+				// one is a placemarker.
+				if len(args[p]) == 0 {
+					out = append(out, placemarker)
+				}
+				out = append(out, spaced(args[p], body[i].space)...)
+				continue
+			}
+			expanded, err := pp.expandList(args[p])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, spaced(expanded, body[i].space)...)
+			continue
+		}
+
+		out = append(out, &ppToken{t: t, file: m.file, spelling: body[i].spelling, space: body[i].space})
+	}
+
+	res := out[:0]
+	for _, t := range out {
+		if t != placemarker {
+			res = append(res, &ppToken{copyToken(t.t), t.file, t.hide.union(hs), t.spelling, t.space})
+		}
+	}
+	return res, nil
+}
+
+// Returns true for the kinds of the literals whose spelling can differ
+// from their value.
+func isLiteral(tt uint32) bool {
+	return tt == token_kind.DoubleQuoteString || tt == token_kind.SingleQuoteCharacter
+}
+
+// Returns the spelling of a list of tokens. Tokens which are preceded by
+// white space are separated from the previous token by a single space. If
+// |escape| is true, a '"' or a '\' in a string or character literal is
+// preceded by a '\', as the '#' operator requires.
+func spell(toks []*ppToken, escape bool) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 && t.space {
+			b.WriteRune(' ')
+		}
+		s := t.spelled()
+		if !escape || !isLiteral(t.t.Kind) {
+			b.WriteString(s)
+			continue
+		}
+		for _, c := range s {
+			if c == '"' || c == '\\' {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Returns a string literal token for the argument |arg|. The '#'
+// operator |op| gives the position of the resulting token. The value of
+// the token is its spelling, so that the string literal operands keep
+// their escape sequences, like "\"a\\n\"" for "a\n".
+func stringify(op *ppToken, arg []*ppToken, file string) *ppToken {
+	s := "\"" + spell(arg, true) + "\""
+	t := &lex.Token{Kind: token_kind.DoubleQuoteString, Value: s, Line: op.t.Line, Col: op.t.Col}
+	return &ppToken{t: t, file: file, space: op.space}
+}
+
+// Pastes two tokens in to a single token. The resulting token is at the
+// position of the left hand side token.
+func (pp *Preprocessor) paste(lhs, rhs *ppToken) (*ppToken, error) {
+	// Tokens like identifiers and numbers are terminated by the new line.
+	s := lhs.spelled() + rhs.spelled() + "\n"
+	tz, err := lex.NewTokenizer(strings.NewReader(s), pp.ts, pp.esr)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := tz.NextToken()
+	if err == nil && tz.HasNext() {
+		var n *lex.Token
+		n, err = tz.NextToken()
+		if err == nil && (n.Kind != token_kind.NewLine || tz.HasNext()) {
+			err = fmt.Errorf("Unexpected '%s'.", n.Value)
+		}
+	}
+	if err != nil || t.Kind == token_kind.NewLine {
+		return nil, fmt.Errorf(
+			"Pasting '%s' and '%s' does not give a valid token at %s:%d:%d.",
+			lhs.t.Value, rhs.t.Value, lhs.file, lhs.t.Line, lhs.t.Col)
+	}
+
+	t.Line = lhs.t.Line
+	t.Col = lhs.t.Col
+	pasted := &ppToken{t, lhs.file, lhs.hide.union(rhs.hide), "", lhs.space}
+	if isLiteral(t.Kind) {
+		pasted.spelling = s[:len(s)-1]
+	}
+	return pasted, nil
+}
@@ -0,0 +1,618 @@
+// Package cpp implements a C pre-processor which operates on the tokens
+// produced by a lex.Tokenizer.
+package cpp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+// The maximum depth of nested #include directives.
+const maxIncludeDepth = 200
+
+// An io.RuneReader which keeps the text read from |r|, so that the
+// spelling of the tokens can be found from their offsets. The text before
+// the offset |base| has been discarded.
+type textRecorder struct {
+	r    io.RuneReader
+	text []byte
+	base uint32
+}
+
+func (tr *textRecorder) ReadRune() (rune, int, error) {
+	c, size, err := tr.r.ReadRune()
+	if err != nil {
+		return c, size, err
+	}
+	var b [utf8.UTFMax]byte
+	n := utf8.EncodeRune(b[:], c)
+	if n != size {
+		// An invalid byte. Only the offsets of its spelling matter.
+		n = copy(b[:], "????"[:size])
+	}
+	tr.text = append(tr.text, b[:n]...)
+	return c, size, nil
+}
+
+// Returns the text between the offsets |start| and |end|, and discards the
+// text before |end|.
+func (tr *textRecorder) spelling(start, end uint32) string {
+	s := string(tr.text[start-tr.base : end-tr.base])
+	tr.discard(end)
+	return s
+}
+
+// Discards the text before the offset |end|.
+func (tr *textRecorder) discard(end uint32) {
+	n := copy(tr.text, tr.text[end-tr.base:])
+	tr.text = tr.text[:n]
+	tr.base = end
+}
+
+// A file being pre-processed.
+type source struct {
+	name string
+	tz   *lex.Tokenizer
+	text *textRecorder // The text read by |tz|.
+	f    *os.File      // nil if the source was not opened by the pre-processor.
+
+	// True if the next token is the first token on a line.
+	bol bool
+
+	// The end offset of the last token, and true if the last token was
+	// white space or a new line.
+	end   uint32
+	white bool
+
+	// The depth of the conditional stack when the file was entered.
+	condDepth int
+}
+
+type cond struct {
+	active   bool // True if the current group is being processed.
+	taken    bool // True if a group of the conditional has been processed.
+	seenElse bool
+	hash     *lex.Token // The #if, #ifdef or #ifndef directive.
+}
+
+// Returns a new source which reads the file |name| from |r|.
+func (pp *Preprocessor) newSource(name string, r io.RuneReader) (*source, error) {
+	text := &textRecorder{r: r}
+	tz, err := lex.NewTokenizer(text, pp.ts, pp.esr)
+	if err != nil {
+		return nil, err
+	}
+	return &source{name: name, tz: tz, text: text, bol: true, white: true, condDepth: len(pp.conds)}, nil
+}
+
+// Returns the next token of |s|. The spelling of a literal and whether
+// white space precedes the token are recorded along with it.
+func (s *source) next() (*ppToken, error) {
+	t, err := s.tz.NextToken()
+	if err != nil {
+		return nil, err
+	}
+	start, end := s.tz.Offsets()
+	pt := &ppToken{t: t, file: s.name, space: s.white || start > s.end}
+	s.end = end
+	s.white = isWhiteSpace(t.Kind) || t.Kind == token_kind.NewLine
+
+	if isLiteral(t.Kind) {
+		if sp := s.text.spelling(start, end); sp != t.Value {
+			pt.spelling = sp
+		}
+	} else {
+		s.text.discard(end)
+	}
+	return pt, nil
+}
+
+type Preprocessor struct {
+	ts           lex.TokenKindSet
+	esr          lex.EscSeqReader
+	includePaths []string
+
+	macros  map[string]*macro
+	sources []*source
+	conds   []*cond
+
+	// Tokens which have been read and need to be read again.
+	pending []*ppToken
+
+	// The next token and the error to be returned by NextToken.
+	next *ppToken
+	err  error
+
+	// The file from which the last returned token was read.
+	file string
+}
+
+// Returns a new Preprocessor which pre-processes the tokens in |r|. The
+// argument |name| is the name of the file from which |r| reads. The token
+// kind set |s| and the escape sequence reader |esr| are used to tokenize
+// |r| and the included files. The token kind set should include
+// token_kind.NewLine as directives end at the end of a line. Files named
+// in #include directives are searched for in |includePaths|.
+func NewPreprocessor(
+	name string, r io.RuneReader, s lex.TokenKindSet, esr lex.EscSeqReader,
+	includePaths []string) (*Preprocessor, error) {
+	if s == nil {
+		return nil, fmt.Errorf("A non-nil TokenKindSet param is required.")
+	}
+	if !s.Contains(token_kind.NewLine) {
+		return nil, fmt.Errorf("NewLine tokens are required to pre-process.")
+	}
+
+	pp := new(Preprocessor)
+	pp.ts = s
+	pp.esr = esr
+	pp.includePaths = includePaths
+	pp.macros = make(map[string]*macro)
+	pp.file = name
+
+	src, err := pp.newSource(name, r)
+	if err != nil {
+		return nil, err
+	}
+	pp.sources = []*source{src}
+
+	return pp, nil
+}
+
+// Defines an object-like macro |name| which expands to the tokens in
+// |value|, like the -D option of C compilers.
+func (pp *Preprocessor) Define(name, value string) error {
+	m := &macro{name: name, file: "<command line>"}
+	s, err := pp.newSource(m.file, strings.NewReader(value))
+	if err != nil {
+		return err
+	}
+
+	for s.tz.HasNext() {
+		t, err := s.next()
+		if err != nil {
+			return fmt.Errorf("Error reading definition of '%s'.\n%s", name, err.Error())
+		}
+		if t.t.Kind != token_kind.NewLine {
+			m.body = append(m.body, t)
+		}
+	}
+	if m.pastesAtEnd() {
+		return fmt.Errorf("'##' cannot be at either end of the definition of '%s'.", name)
+	}
+
+	pp.macros[name] = m
+	return nil
+}
+
+// Removes the definition of the macro |name|, if any.
+func (pp *Preprocessor) Undefine(name string) {
+	delete(pp.macros, name)
+}
+
+// Returns true if a macro named |name| is defined.
+func (pp *Preprocessor) IsDefined(name string) bool {
+	_, e := pp.macros[name]
+	return e
+}
+
+// Returns the name of the file from which the token last returned by
+// NextToken was read. For tokens resulting from a macro expansion, it
+// is the file in which the macro was defined.
+func (pp *Preprocessor) File() string {
+	return pp.file
+}
+
+// Returns true if there are further tokens, false otherwise.
+func (pp *Preprocessor) HasNext() bool {
+	if pp.next == nil && pp.err == nil {
+		pp.next, pp.err = pp.expandNext(pp)
+	}
+	return pp.err != io.EOF
+}
+
+// Returns the next token after pre-processing. The tokens in directive
+// lines are not returned. Comments are returned as is if the token kind
+// set includes them.
+// If an error occurs, it is not guaranteed to be recoverable.
+func (pp *Preprocessor) NextToken() (*lex.Token, error) {
+	if !pp.HasNext() {
+		return nil, io.EOF
+	}
+	if pp.err != nil {
+		return nil, pp.err
+	}
+
+	t := pp.next
+	pp.next = nil
+	pp.file = t.file
+	return t.t, nil
+}
+
+func (pp *Preprocessor) read() (*ppToken, error) {
+	if len(pp.pending) > 0 {
+		t := pp.pending[0]
+		pp.pending = pp.pending[1:]
+		return t, nil
+	}
+	return pp.readRaw()
+}
+
+func (pp *Preprocessor) unread(toks []*ppToken) {
+	pp.pending = append(append([]*ppToken(nil), toks...), pp.pending...)
+}
+
+func (pp *Preprocessor) skipping() bool {
+	return len(pp.conds) > 0 && !pp.conds[len(pp.conds)-1].active
+}
+
+// Reads the next token which is not part of a directive or a skipped
+// conditional group. Directives are processed as they are read.
+func (pp *Preprocessor) readRaw() (*ppToken, error) {
+	for len(pp.sources) > 0 {
+		s := pp.sources[len(pp.sources)-1]
+		if !s.tz.HasNext() {
+			if len(pp.conds) != s.condDepth {
+				return nil, pp.errorAt(s, pp.conds[len(pp.conds)-1].hash, "Unterminated conditional directive")
+			}
+			if s.f != nil {
+				s.f.Close()
+			}
+			pp.sources = pp.sources[:len(pp.sources)-1]
+			continue
+		}
+
+		if s.bol && pp.skipping() {
+			// The lines of a skipped group are not tokenized, but for the
+			// directives.
+			skipped, err := s.tz.SkipLine("#")
+			if err != nil {
+				return nil, pp.readError(s, err)
+			}
+			if skipped {
+				if _, err := pp.nextOnLine(s); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		t, err := s.next()
+		if err != nil {
+			return nil, pp.readError(s, err)
+		}
+
+		bol := s.bol
+		if endsLine(t.t.Kind) {
+			s.bol = true
+		} else if !isWhiteSpace(t.t.Kind) {
+			s.bol = false
+		}
+
+		isDirective := t.t.Kind == token_kind.CPPDirective || t.t.Kind == token_kind.CPPStringify
+		if bol && isDirective {
+			err = pp.readDirective(s, t.t)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if pp.skipping() {
+			continue
+		}
+
+		return t, nil
+	}
+
+	return nil, io.EOF
+}
+
+func (pp *Preprocessor) readError(s *source, err error) error {
+	return fmt.Errorf("Error at %s:%d:%d: %s", s.name, s.tz.Line(), s.tz.Col(), err.Error())
+}
+
+// Returns the next token on the current line of |s|, or nil after the end
+// of the line has been read. Comments and line joins are dropped.
+func (pp *Preprocessor) nextOnLine(s *source) (*ppToken, error) {
+	for s.tz.HasNext() {
+		t, err := s.next()
+		if err != nil {
+			return nil, pp.readError(s, err)
+		}
+		if endsLine(t.t.Kind) {
+			break
+		}
+		if !isWhiteSpace(t.t.Kind) {
+			return t, nil
+		}
+	}
+	s.bol = true
+	return nil, nil
+}
+
+// Reads the rest of the current line of |s|. Comments and line joins
+// are dropped.
+func (pp *Preprocessor) readLine(s *source) ([]*ppToken, error) {
+	var line []*ppToken
+	for true {
+		t, err := pp.nextOnLine(s)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return line, nil
+		}
+		line = append(line, t)
+	}
+	return line, nil
+}
+
+func (pp *Preprocessor) readDirective(s *source, hash *lex.Token) error {
+	var name string
+	if hash.Kind == token_kind.CPPDirective {
+		name = hash.Value[1:]
+	} else {
+		t, err := pp.nextOnLine(s)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			// A null directive.
+			return nil
+		}
+		// The directive name is separated from the '#'.
+		name = t.t.Value
+	}
+
+	// The rest of the line is tokenized only if it is used, as a skipped
+	// group can have any text, like an #elif after a group which is taken.
+	used := !pp.skipping()
+	switch name {
+	case "elif":
+		used = len(pp.conds) > s.condDepth && !pp.conds[len(pp.conds)-1].taken
+	case "else", "endif":
+		used = false
+	}
+
+	var line []*ppToken
+	var err error
+	if !used {
+		if _, err = s.tz.SkipLine(""); err != nil {
+			return pp.readError(s, err)
+		}
+		_, err = pp.nextOnLine(s)
+	} else {
+		line, err = pp.readLine(s)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "if", "ifdef", "ifndef":
+		if pp.skipping() {
+			pp.conds = append(pp.conds, &cond{active: false, taken: true, hash: hash})
+			return nil
+		}
+		v, err := pp.evalCondition(s, name, hash, line)
+		if err != nil {
+			return err
+		}
+		pp.conds = append(pp.conds, &cond{active: v, taken: v, hash: hash})
+		return nil
+	case "elif", "else", "endif":
+		if len(pp.conds) <= s.condDepth {
+			return pp.errorAt(s, hash, "#%s without #if", name)
+		}
+		c := pp.conds[len(pp.conds)-1]
+		switch name {
+		case "elif":
+			if c.seenElse {
+				return pp.errorAt(s, hash, "#elif after #else")
+			}
+			if c.taken {
+				c.active = false
+				return nil
+			}
+			v, err := pp.evalCondition(s, name, hash, line)
+			if err != nil {
+				return err
+			}
+			c.active = v
+			c.taken = v
+		case "else":
+			if c.seenElse {
+				return pp.errorAt(s, hash, "#else after #else")
+			}
+			c.seenElse = true
+			c.active = !c.taken
+			c.taken = true
+		case "endif":
+			pp.conds = pp.conds[:len(pp.conds)-1]
+		}
+		return nil
+	}
+
+	if pp.skipping() {
+		return nil
+	}
+
+	switch name {
+	case "define":
+		return pp.define(s, hash, line)
+	case "undef":
+		if len(line) != 1 || !isIdentLike(line[0].t) {
+			return pp.errorAt(s, hash, "Expected a macro name after #undef")
+		}
+		pp.Undefine(line[0].t.Value)
+		return nil
+	case "include":
+		return pp.include(s, hash, line)
+	case "error":
+		return pp.errorAt(s, hash, "#error %s", spell(line, false))
+	case "line", "pragma", "warning", "ident":
+		// These directives do not affect the token stream.
+		return nil
+	}
+
+	return pp.errorAt(s, hash, "Unknown pre-processor directive '%s'", name)
+}
+
+func (pp *Preprocessor) errorAt(s *source, t *lex.Token, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	return fmt.Errorf("%s at %s:%d:%d.", msg, s.name, t.Line, t.Col)
+}
+
+func (pp *Preprocessor) define(s *source, hash *lex.Token, line []*ppToken) error {
+	if len(line) == 0 || !isIdentLike(line[0].t) {
+		return pp.errorAt(s, hash, "Expected a macro name after #define")
+	}
+
+	name := line[0].t
+	m := &macro{name: name.Value, file: s.name}
+	body := line[1:]
+
+	// A macro is function-like only if the '(' immediately follows the
+	// macro name.
+	end := name.Col + uint32(len([]rune(name.Value)))
+	if len(body) > 0 && body[0].t.Kind == token_kind.LeftParen && body[0].t.Line == name.Line && body[0].t.Col == end {
+		m.funcLike = true
+		i := 1
+		for ; i < len(body); i++ {
+			t := body[i].t
+			if t.Kind == token_kind.RightParen && (i == 1 || body[i-1].t.Kind != token_kind.Comma) {
+				break
+			}
+			if m.variadic {
+				return pp.errorAt(s, t, "Expected ')' after '...'")
+			}
+			if (i-1)%2 == 1 {
+				if t.Kind != token_kind.Comma {
+					return pp.errorAt(s, t, "Expected ',' in macro parameter list")
+				}
+				continue
+			}
+			switch {
+			case t.Kind == token_kind.ExclusiveRange:
+				m.variadic = true
+				m.params = append(m.params, "__VA_ARGS__")
+			case isIdentLike(t):
+				if m.param(t.Value) >= 0 {
+					return pp.errorAt(s, t, "Duplicate macro parameter '%s'", t.Value)
+				}
+				m.params = append(m.params, t.Value)
+			default:
+				return pp.errorAt(s, t, "Invalid macro parameter '%s'", t.Value)
+			}
+		}
+		if i == len(body) {
+			return pp.errorAt(s, name, "Missing ')' in macro parameter list")
+		}
+		body = body[i+1:]
+	}
+
+	m.body = body
+	if m.pastesAtEnd() {
+		t := body[0]
+		if t.t.Kind != token_kind.CPPTokenPaste {
+			t = body[len(body)-1]
+		}
+		return pp.errorAt(s, t.t, "'##' cannot be at either end of a macro definition")
+	}
+	pp.macros[m.name] = m
+	return nil
+}
+
+func (pp *Preprocessor) include(s *source, hash *lex.Token, toks []*ppToken) error {
+	name, quoted, ok := includeName(toks)
+	if !ok {
+		// The file name can be the result of a macro expansion.
+		expanded, err := pp.expandList(toks)
+		if err != nil {
+			return err
+		}
+		name, quoted, ok = includeName(expanded)
+	}
+	if !ok {
+		return pp.errorAt(s, hash, "Expected \"FILENAME\" or <FILENAME> after #include")
+	}
+
+	if len(pp.sources) >= maxIncludeDepth {
+		return pp.errorAt(s, hash, "#include nested too deeply")
+	}
+
+	path := pp.resolve(s, name, quoted)
+	if path == "" {
+		return pp.errorAt(s, hash, "File '%s' not found", name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return pp.errorAt(s, hash, "Error opening '%s': %s", path, err.Error())
+	}
+
+	src, err := pp.newSource(path, bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	src.f = f
+
+	pp.sources = append(pp.sources, src)
+	return nil
+}
+
+// Returns the file name in an #include directive and whether it was
+// a quoted name.
+func includeName(toks []*ppToken) (string, bool, bool) {
+	if len(toks) == 1 && toks[0].t.Kind == token_kind.DoubleQuoteString {
+		// The name is not a string literal, so it has no escape sequences.
+		v := toks[0].spelled()
+		return v[1 : len(v)-1], true, true
+	}
+
+	n := len(toks)
+	if n < 3 || toks[0].t.Kind != token_kind.LessThan || toks[n-1].t.Kind != token_kind.GreaterThan {
+		return "", false, false
+	}
+	return spell(toks[1:n-1], false), false, true
+}
+
+// Returns the path to the included file |name|, or an empty string if it
+// was not found. Quoted names are first searched for in the directory of
+// the including file.
+func (pp *Preprocessor) resolve(s *source, name string, quoted bool) string {
+	if filepath.IsAbs(name) {
+		if isFile(name) {
+			return name
+		}
+		return ""
+	}
+
+	var dirs []string
+	if quoted {
+		dirs = append(dirs, filepath.Dir(s.name))
+	}
+	dirs = append(dirs, pp.includePaths...)
+
+	for _, d := range dirs {
+		p := filepath.Join(d, name)
+		if isFile(p) {
+			return p
+		}
+	}
+	return ""
+}
+
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
@@ -0,0 +1,270 @@
+package cpp
+
+import (
+	"strings"
+	"testing"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+var cTokenKinds = []uint32{
+	token_kind.Identifier,
+	token_kind.CPPDirective,
+	token_kind.CPPStringify,
+	token_kind.CPPTokenPaste,
+	token_kind.NewLine,
+	token_kind.DecimalInteger,
+	token_kind.HexInteger,
+	token_kind.DoubleQuoteString,
+	token_kind.SingleQuoteCharacter,
+	token_kind.LeftParen,
+	token_kind.RightParen,
+	token_kind.Comma,
+	token_kind.Add,
+	token_kind.Sub,
+	token_kind.Div,
+	token_kind.Mod,
+	token_kind.LeftShift,
+	token_kind.RightShift,
+	token_kind.GreaterThan,
+	token_kind.LessThan,
+	token_kind.LogicalAnd,
+	token_kind.LogicalOr,
+	token_kind.Equal,
+	token_kind.ExclusiveRange,
+	token_kind.KeywordIf,
+	token_kind.KeywordElse,
+	token_kind.QuestionMark,
+	token_kind.Colon,
+	token_kind.CMultiLineComment,
+	token_kind.CSingleLineComment,
+}
+
+func TestMacroExpansion(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+
+	err := matchTokens("test_data/macros_text", nil, ts, []lex.Token{
+		// Tokens from the macro body keep the position in the definition.
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "1", Line: 1, Col: 13},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 7, Col: 4},
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "1", Line: 1, Col: 13},
+		lex.Token{Kind: token_kind.Add, Value: "+", Line: 2, Col: 21},
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "2", Line: 8, Col: 10},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 8, Col: 12},
+		lex.Token{Kind: token_kind.DoubleQuoteString, Value: "\"hello world\"", Line: 3, Col: 16},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 9, Col: 17},
+		lex.Token{Kind: token_kind.Identifier, Value: "var1", Line: 10, Col: 5},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 10, Col: 12},
+		lex.Token{Kind: token_kind.Identifier, Value: "log", Line: 5, Col: 18},
+		lex.Token{Kind: token_kind.LeftParen, Value: "(", Line: 5, Col: 21},
+		lex.Token{Kind: token_kind.Identifier, Value: "x", Line: 11, Col: 5},
+		lex.Token{Kind: token_kind.Comma, Value: ",", Line: 11, Col: 6},
+		lex.Token{Kind: token_kind.Identifier, Value: "y", Line: 11, Col: 8},
+		lex.Token{Kind: token_kind.RightParen, Value: ")", Line: 5, Col: 33},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 11, Col: 10},
+		// A macro is not expanded within its own expansion.
+		lex.Token{Kind: token_kind.Identifier, Value: "SELF", Line: 6, Col: 14},
+		lex.Token{Kind: token_kind.Add, Value: "+", Line: 6, Col: 19},
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "1", Line: 1, Col: 13},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 12, Col: 5},
+		lex.Token{Kind: token_kind.Identifier, Value: "ONE", Line: 14, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 14, Col: 4},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+
+	err := matchTokens("test_data/conditionals_text", nil, ts, []lex.Token{
+		lex.Token{Kind: token_kind.Identifier, Value: "yes1", Line: 3, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 3, Col: 5},
+		lex.Token{Kind: token_kind.Identifier, Value: "yes2", Line: 10, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 10, Col: 5},
+		lex.Token{Kind: token_kind.Identifier, Value: "yes3", Line: 18, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 18, Col: 5},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestStringifyAndPaste(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+
+	err := matchTokens("test_data/paste_text", nil, ts, []lex.Token{
+		// The literals are stringified from their spelling.
+		lex.Token{Kind: token_kind.DoubleQuoteString, Value: `"\"a\\n\""`, Line: 1, Col: 14},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 4, Col: 9},
+		lex.Token{Kind: token_kind.DoubleQuoteString, Value: `"'\"' x"`, Line: 1, Col: 14},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 5, Col: 10},
+		// An empty argument is a placemarker for '##'.
+		lex.Token{Kind: token_kind.Identifier, Value: "x", Line: 2, Col: 17},
+		lex.Token{Kind: token_kind.Identifier, Value: "y", Line: 6, Col: 5},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 6, Col: 7},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 7, Col: 5},
+		lex.Token{Kind: token_kind.Identifier, Value: "ab", Line: 8, Col: 3},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 8, Col: 8},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+	tests := map[string]bool{
+		// The operands which are not evaluated can divide by zero.
+		"0 && (1 / 0)":    false,
+		"1 || 1 % 0":      true,
+		"1 ? 2 : 1 / 0":   true,
+		"0 ? 1 / 0 : 0":   false,
+		"0 && 1 / 0 || 1": true,
+		// An unsigned operand makes the other one unsigned.
+		"-1 > 0u":                true,
+		"-1 > 0":                 false,
+		"-1 / 2u > 0":            true,
+		"(0 ? 1u : -1) > 0":      true,
+		"-1u >> 63 == 1":         true,
+		"-1 >> 63 == -1":         true,
+		"0xffffffffffffffff > 0": true,
+		"1 << 63u < 0":           true,
+	}
+	for expr, expected := range tests {
+		text := "#if " + expr + "\nyes\n#endif\n"
+		pp, err := NewPreprocessor("t", strings.NewReader(text), ts, lex.GoESR{}, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var values []string
+		for pp.HasNext() {
+			tok, err := pp.NextToken()
+			if err != nil {
+				t.Fatalf("Unexpected error for %q.\n%s", expr, err.Error())
+			}
+			values = append(values, tok.Value)
+		}
+		if (len(values) > 0) != expected {
+			t.Errorf("Expected %v for %q, but got the tokens %q.", expected, expr, values)
+		}
+	}
+}
+
+func TestStringifySpaces(t *testing.T) {
+	ts := lex.NewTokenKindSet(append(cTokenKinds, token_kind.Dot))
+
+	// The tokens of an argument are separated by a space where white space
+	// precedes them, in the source or where they are substituted.
+	err := matchTokens("test_data/stringify_text", nil, ts, []lex.Token{
+		lex.Token{Kind: token_kind.DoubleQuoteString, Value: `"vers2.h"`, Line: 1, Col: 16},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 5, Col: 19},
+		lex.Token{Kind: token_kind.DoubleQuoteString, Value: `"f(\"a\\n\", 'b') == 0"`, Line: 1, Col: 16},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 7, Col: 7},
+		lex.Token{Kind: token_kind.DoubleQuoteString, Value: `"a(x) x"`, Line: 1, Col: 16},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 8, Col: 13},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSkippedGroups(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+
+	err := matchTokens("test_data/skipped_text", nil, ts, []lex.Token{
+		lex.Token{Kind: token_kind.Identifier, Value: "yes1", Line: 7, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 7, Col: 5},
+		lex.Token{Kind: token_kind.Identifier, Value: "yes2", Line: 10, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 10, Col: 5},
+		lex.Token{Kind: token_kind.Identifier, Value: "yes3", Line: 14, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 14, Col: 5},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSingleLineComments(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+
+	// A single line comment ends the line of a directive, and the
+	// line before a directive.
+	err := matchTokens("test_data/comments_text", nil, ts, []lex.Token{
+		lex.Token{Kind: token_kind.Identifier, Value: "yes1", Line: 2, Col: 1},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 2, Col: 5},
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "1", Line: 4, Col: 11},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 5, Col: 2},
+		lex.Token{Kind: token_kind.Identifier, Value: "x", Line: 6, Col: 1},
+		lex.Token{Kind: token_kind.CSingleLineComment, Value: "// c", Line: 6, Col: 3},
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "2", Line: 7, Col: 11},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 8, Col: 2},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestDirectiveErrors(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+	tests := map[string]string{
+		"#define G(a) ## a\n":          "'##' cannot be at either end of a macro definition at t:1:14.",
+		"#define H(a) a ##\n":          "'##' cannot be at either end of a macro definition at t:1:16.",
+		"x\n#ifdef A\n#if 1\n#endif\n": "Unterminated conditional directive at t:2:1.",
+		"#if 0\n#else\n#if 1\n#else\n": "Unterminated conditional directive at t:3:1.",
+		"#if 1 ? 2\n#endif\n":          "Invalid expression in #if: Missing ':' at t:1:1.",
+		"#if 1 && 1 / 0\n#endif\n":     "Invalid expression in #if: Division by zero at t:1:1.",
+	}
+	for text, expected := range tests {
+		pp, err := NewPreprocessor("t", strings.NewReader(text), ts, lex.GoESR{}, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for err == nil {
+			_, err = pp.NextToken()
+		}
+		if err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, but got %q.", expected, text, err.Error())
+		}
+	}
+
+	if err := (&Preprocessor{ts: ts, esr: lex.GoESR{}}).Define("P", "a ##"); err == nil {
+		t.Errorf("Expected an error for a definition which ends with '##'.")
+	}
+}
+
+func TestInclude(t *testing.T) {
+	ts := lex.NewTokenKindSet(cTokenKinds)
+
+	err := matchTokens("test_data/include_text", []string{"test_data/include"}, ts, []lex.Token{
+		lex.Token{Kind: token_kind.Identifier, Value: "local", Line: 1, Col: 15},
+		lex.Token{Kind: token_kind.Identifier, Value: "system", Line: 1, Col: 16},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 3, Col: 13},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestDirectiveLineJoin(t *testing.T) {
+	ts := lex.NewTokenKindSet(append(cTokenKinds, token_kind.LineJoin))
+
+	err := matchTokens("test_data/line_join_text", nil, ts, []lex.Token{
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "1", Line: 3, Col: 7},
+		lex.Token{Kind: token_kind.Add, Value: "+", Line: 2, Col: 7},
+		lex.Token{Kind: token_kind.DecimalInteger, Value: "1", Line: 3, Col: 7},
+		lex.Token{Kind: token_kind.NewLine, Value: "\n", Line: 3, Col: 9},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
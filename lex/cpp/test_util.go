@@ -0,0 +1,54 @@
+package cpp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"uno/lex"
+)
+
+func matchTokens(file string, includePaths []string, ts lex.TokenKindSet, tokens []lex.Token) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Error opening test file. \n%s", err.Error())
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var goEsr lex.GoESR
+	pp, err := NewPreprocessor(file, br, ts, goEsr, includePaths)
+	if err != nil {
+		return err
+	}
+
+	for _, exp := range tokens {
+		if !pp.HasNext() {
+			return fmt.Errorf("Expected a token at %s:%d:%d", file, exp.Line, exp.Col)
+		}
+		actual, err := pp.NextToken()
+		if err != nil {
+			return err
+		}
+
+		if exp.Kind != actual.Kind || exp.Value != actual.Value {
+			return fmt.Errorf(
+				"Expected '%s' of kind %d at %d:%d, got '%s' of kind %d.",
+				exp.Value, exp.Kind, exp.Line, exp.Col, actual.Value, actual.Kind)
+		}
+
+		if exp.Line != actual.Line || exp.Col != actual.Col {
+			return fmt.Errorf("Expected '%s' at %d:%d, but got it at %d:%d.",
+				exp.Value, exp.Line, exp.Col, actual.Line, actual.Col)
+		}
+	}
+
+	if pp.HasNext() {
+		t, err := pp.NextToken()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("Unexpected token '%s' at %d:%d.", t.Value, t.Line, t.Col)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package diff compares two files token by token, so that the changes of
+// layout, like reindented or rewrapped code, are not differences.
+//
+// The tokens are compared by kind and spelling with the algorithm of
+// Myers, without the white space and the layout tokens like NewLine, and
+// optionally without the comments. The changes are reported with their
+// positions in the files, in a format like the unified format of diff.
+package diff
+
+import (
+	"uno/lex"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// A file to compare.
+type File struct {
+	Path   string
+	Text   []byte
+	Tokens []lex.TokenRef
+
+	// The lines of Text and the offsets of their beginnings, once they
+	// are split by lineTable.
+	lines  [][]byte
+	starts []int
+}
+
+// Returns the File |path| with the text |text| and the tokens read by
+// |tz|, like the Tokenizer of Profile.NewBytesTokenizer. If lexing fails,
+// the File is returned with the tokens before the error, along with the
+// error.
+func NewFile(path string, text []byte, tz *lex.Tokenizer) (*File, error) {
+	refs, err := lex.ReadRefs(tz)
+	return &File{Path: path, Text: text, Tokens: refs}, err
+}
+
+// Returns the spelling of the token at |i|.
+func (f *File) Spelling(i int) string {
+	t := f.Tokens[i]
+	return string(f.Text[t.Start:t.End])
+}
+
+// The options of Diff.
+type Options struct {
+	// If true, the comments are not compared.
+	IgnoreComments bool
+}
+
+// A range [Start, End) of the indices of the tokens of a File.
+type Range struct {
+	Start int
+	End   int
+}
+
+// Returns true if the range has no tokens.
+func (r Range) Empty() bool {
+	return r.Start == r.End
+}
+
+// A change which replaces the tokens A of the first file by the tokens B
+// of the second file. One of the ranges can be empty, for the tokens
+// which are only deleted or only inserted. An empty range starts at the
+// next compared token, or at the end of the tokens.
+type Change struct {
+	A Range
+	B Range
+}
+
+// Returns true if the tokens of kind |kind| are compared.
+func compared(kind uint32, o *Options) bool {
+	return !lex.IsLayout(kind) && (!o.IgnoreComments || highlight.ClassOf(kind) != highlight.Comment)
+}
+
+// Returns the changes from |a| to |b|, in order.
+func Diff(a, b *File, o *Options) []Change {
+	if o == nil {
+		o = &Options{}
+	}
+
+	// The compared tokens, as IDs of their kinds and spellings, and their
+	// indices in the files.
+	ids := map[string]int32{}
+	keys := func(f *File) ([]int32, []int) {
+		var ks []int32
+		var is []int
+		for i, t := range f.Tokens {
+			if !compared(t.Kind, o) {
+				continue
+			}
+			key := token_kind.Name(t.Kind) + "\x00" + f.Spelling(i)
+			id, ok := ids[key]
+			if !ok {
+				id = int32(len(ids))
+				ids[key] = id
+			}
+			ks = append(ks, id)
+			is = append(is, i)
+		}
+		return ks, is
+	}
+	ka, ia := keys(a)
+	kb, ib := keys(b)
+
+	// Maps a range of the compared tokens to a range of the tokens.
+	toRange := func(s, e int, is []int, n int) Range {
+		if s == e {
+			if s < len(is) {
+				return Range{is[s], is[s]}
+			}
+			return Range{n, n}
+		}
+		return Range{is[s], is[e-1] + 1}
+	}
+
+	var changes []Change
+	x, y := 0, 0
+	for _, m := range append(matches(ka, kb), [2]int{len(ka), len(kb)}) {
+		if m[0] > x || m[1] > y {
+			changes = append(changes, Change{
+				toRange(x, m[0], ia, len(a.Tokens)),
+				toRange(y, m[1], ib, len(b.Tokens)),
+			})
+		}
+		x, y = m[0]+1, m[1]+1
+	}
+	return changes
+}
+
+// Returns the pairs of indices of the elements of |a| and |b| which are
+// in the shortest edit script from |a| to |b|, in order.
+func matches(a, b []int32) [][2]int {
+	return appendMatches(nil, a, b, 0, 0)
+}
+
+// Appends to |result| the matched pairs of the shortest edit script from
+// |a| to |b|, which are at |x| and |y| in the compared sequences, with the
+// linear space refinement of "An O(ND) Difference Algorithm and Its
+// Variations" by Eugene W. Myers: the middle snake of the script splits it
+// into two scripts of half as many edits, which are found recursively.
+func appendMatches(result [][2]int, a, b []int32, x, y int) [][2]int {
+	// The common prefix and suffix are matched without the algorithm.
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		result = append(result, [2]int{x + p, y + p})
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	a, b = a[p:len(a)-s], b[p:len(b)-s]
+	if len(a) > 0 && len(b) > 0 {
+		// As the first and the last elements differ, the script has at
+		// least 2 edits, so both halves have fewer edits than it.
+		sx, sy, ex, ey := middleSnake(a, b)
+		result = appendMatches(result, a[:sx], b[:sy], x+p, y+p)
+		for i := 0; i < ex-sx; i++ {
+			result = append(result, [2]int{x + p + sx + i, y + p + sy + i})
+		}
+		result = appendMatches(result, a[ex:], b[ey:], x+p+ex, y+p+ey)
+	}
+	for i := s; i > 0; i-- {
+		result = append(result, [2]int{x + p + len(a) + s - i, y + p + len(b) + s - i})
+	}
+	return result
+}
+
+// Returns the start and the end of the middle snake of the shortest edit
+// script from |a| to |b|, which is a run of matches in the middle of the
+// script. The paths of each number of edits d are searched forward from
+// the start and backward from the end, in O(N+M) memory, until they
+// overlap.
+func middleSnake(a, b []int32) (int, int, int, int) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+	// vf[k+offset] is the furthest x on the diagonal k = x - y of the
+	// forward paths, and vb[k+offset] the furthest x on the diagonal k of
+	// the backward paths, which are counted from the ends of |a| and |b|.
+	offset := max + 1
+	vf := make([]int, 2*max+3)
+	vb := make([]int, 2*max+3)
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			vf[offset+k] = x
+			// The diagonal of the backward paths which is the diagonal k.
+			if bk := delta - k; odd && bk >= -(d-1) && bk <= d-1 && x+vb[offset+bk] >= n {
+				return sx, sy, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x, y = x+1, y+1
+			}
+			vb[offset+k] = x
+			if fk := delta - k; !odd && fk >= -d && fk <= d && x+vf[offset+fk] >= n {
+				return n - x, m - y, n - sx, m - sy
+			}
+		}
+	}
+	// The paths overlap at the latest when d is half the number of edits
+	// of the longest script.
+	panic("The paths of the edit script do not overlap.")
+}
@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func newFile(t *testing.T, path, text string) *File {
+	tz, err := lex.PythonProfile.NewBytesTokenizer([]byte(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	f, err := NewFile(path, []byte(text), tz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return f
+}
+
+const before = `def f(a, b):
+    # Adds the values.
+    return a + b
+
+
+print(f(1, 2))
+`
+
+// Reformatted, with a changed number, a new argument and another comment.
+const after = `def f(a,
+      b):
+    # Sums the values.
+    return a+b
+
+print(f(1, 3), end="")
+`
+
+func TestDiff(t *testing.T) {
+	a, b := newFile(t, "a.py", before), newFile(t, "b.py", after)
+
+	changes := Diff(a, b, nil)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, but got %v.", changes)
+	}
+	if s := a.Spelling(changes[0].A.Start); s != "# Adds the values." {
+		t.Errorf("Expected a change of the comment, but got %q.", s)
+	}
+	if s := b.Spelling(changes[1].B.Start); s != "3" || changes[1].B.End-changes[1].B.Start != 1 {
+		t.Errorf("Expected a change of the number, but got %q.", s)
+	}
+	c := changes[2]
+	if !c.A.Empty() || c.B.End-c.B.Start != 4 || b.Spelling(c.B.Start) != "," {
+		t.Errorf("Expected the insertion of an argument, but got %v.", c)
+	}
+
+	changes = Diff(a, b, &Options{IgnoreComments: true})
+	if len(changes) != 2 {
+		t.Errorf("Expected 2 changes without the comments, but got %v.", changes)
+	}
+	if changes := Diff(a, a, nil); len(changes) != 0 {
+		t.Errorf("Expected no change, but got %v.", changes)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a, b := newFile(t, "a.py", before), newFile(t, "b.py", after)
+	var out bytes.Buffer
+	if err := Unified(&out, a, b, Diff(a, b, nil)); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `--- a.py
++++ b.py
+@@ -2,1 +3,1 @@
+-    [-# Adds the values.-]
++    {+# Sums the values.+}
+@@ -6,1 +6,1 @@
+-print(f(1, [-2-]))
++print(f(1, {+3+}){+, end=""+})
+`
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := Unified(&out, a, a, nil); err != nil || out.Len() != 0 {
+		t.Errorf("Expected no output, but got\n%s", out.String())
+	}
+	// The lines end with the new lines of the lexer, which are written as
+	// "\n".
+	for _, nl := range []string{"\r", "\r\n", "\u2028"} {
+		a = newFile(t, "a.py", strings.Replace("x = 1\ny = 2\nz = 3\n", "\n", nl, -1))
+		b = newFile(t, "b.py", strings.Replace("x = 1\ny = 5\nz = 3\n", "\n", nl, -1))
+		out.Reset()
+		if err := Unified(&out, a, b, Diff(a, b, nil)); err != nil {
+			t.Fatal(err.Error())
+		}
+		expected = "--- a.py\n+++ b.py\n@@ -2,1 +2,1 @@\n-y = [-2-]\n+y = {+5+}\n"
+		if out.String() != expected {
+			t.Errorf("Expected\n%s\nbut got\n%q", expected, out.String())
+		}
+	}
+}
+
+// Returns the edit distance from |a| to |b|, counting a replacement as a
+// deletion and an insertion.
+func distance(a, b []int32) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			d[i][j] = d[i-1][j] + 1
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if a[i-1] == b[j-1] && d[i-1][j-1] < d[i][j] {
+				d[i][j] = d[i-1][j-1]
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func TestMatches(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []int32 {
+		s := make([]int32, r.Intn(20))
+		for i := range s {
+			s[i] = int32(r.Intn(4))
+		}
+		return s
+	}
+	for n := 0; n < 500; n++ {
+		a, b := random(), random()
+		ms := matches(a, b)
+		for i, m := range ms {
+			if a[m[0]] != b[m[1]] || (i > 0 && (m[0] <= ms[i-1][0] || m[1] <= ms[i-1][1])) {
+				t.Fatalf("Invalid matches %v of %v and %v.", ms, a, b)
+			}
+		}
+		if d := len(a) + len(b) - 2*len(ms); d != distance(a, b) {
+			t.Fatalf("Expected the distance %d from %v to %v, but got %d.", distance(a, b), a, b, d)
+		}
+	}
+	// A long script, whose paths are not kept.
+	a, b := make([]int32, 5000), make([]int32, 5000)
+	for i := range b {
+		a[i], b[i] = int32(i%7), int32(i%7+7)
+	}
+	a[2500], b[2501] = 14, 14
+	if ms := matches(a, b); !reflect.DeepEqual(ms, [][2]int{{2500, 2501}}) {
+		t.Errorf("Unexpected matches %v.", ms)
+	}
+	if ms := matches([]int32{1, 2}, []int32{1, 2}); !reflect.DeepEqual(ms, [][2]int{{0, 0}, {1, 1}}) {
+		t.Errorf("Unexpected matches %v.", ms)
+	}
+}
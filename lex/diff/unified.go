@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"uno/lex"
+)
+
+// The markers of the changed tokens in the lines of a hunk, like in the
+// word diff of git.
+const (
+	deleteBegin = "[-"
+	deleteEnd   = "-]"
+	insertBegin = "{+"
+	insertEnd   = "+}"
+)
+
+// A group of changes whose lines overlap, which are written together.
+type hunk struct {
+	changes []Change
+	// The ranges [first, last] of the lines, from 0, of the changes in
+	// the files.
+	aFirst, aLast int
+	bFirst, bLast int
+}
+
+// Returns the lines of the text of |f|, split at the new lines of the
+// lexer, and the byte offsets of their beginnings. The text after the last
+// new line is a line only if it is not empty.
+func (f *File) lineTable() ([][]byte, []int) {
+	if f.lines != nil {
+		return f.lines, f.starts
+	}
+	f.lines = lex.SplitLines(f.Text)
+	if n := len(f.lines); n > 1 && len(f.lines[n-1]) == 0 {
+		f.lines = f.lines[:n-1]
+	}
+	f.starts = make([]int, len(f.lines))
+	for l := 1; l < len(f.lines); l++ {
+		e := f.starts[l-1] + len(f.lines[l-1])
+		f.starts[l] = e + lex.NewLineLen(f.Text[e:])
+	}
+	return f.lines, f.starts
+}
+
+// Returns the index from 0 of the line of the byte offset |offset| in the
+// text of |f|. The offset of a new line is on the line which it ends.
+func lineOf(f *File, offset int) int {
+	_, starts := f.lineTable()
+	return sort.SearchInts(starts, offset+1) - 1
+}
+
+// Returns the lines [first, last] of the tokens |r| of |f|. The lines of
+// an empty range are the line of the next token, or the last line.
+func lines(f *File, r Range) (int, int) {
+	if r.Empty() {
+		offset := len(f.Text)
+		if r.Start < len(f.Tokens) {
+			offset = int(f.Tokens[r.Start].Start)
+		}
+		l := lineOf(f, offset)
+		return l, l
+	}
+	// The last byte of the last token, like the new line which ends a
+	// Python comment, is on the last line.
+	first, last := f.Tokens[r.Start], f.Tokens[r.End-1]
+	end := int(last.End)
+	if end > int(last.Start) {
+		end--
+	}
+	return lineOf(f, int(first.Start)), lineOf(f, end)
+}
+
+// Groups the changes whose lines overlap in one of the files.
+func hunks(a, b *File, changes []Change) []*hunk {
+	var hs []*hunk
+	for _, c := range changes {
+		af, al := lines(a, c.A)
+		bf, bl := lines(b, c.B)
+		if n := len(hs); n > 0 && (af <= hs[n-1].aLast || bf <= hs[n-1].bLast) {
+			h := hs[n-1]
+			h.changes = append(h.changes, c)
+			if al > h.aLast {
+				h.aLast = al
+			}
+			if bl > h.bLast {
+				h.bLast = bl
+			}
+			continue
+		}
+		hs = append(hs, &hunk{[]Change{c}, af, al, bf, bl})
+	}
+	return hs
+}
+
+// Returns the byte offsets of the beginning of the line |first| and of the
+// end of the line |last| of |f|, without its new line.
+func lineOffsets(f *File, first, last int) (int, int) {
+	lines, starts := f.lineTable()
+	return starts[first], starts[last] + len(lines[last])
+}
+
+// Writes the lines [first, last] of |f| prefixed by |prefix|, with the
+// tokens of |ranges| between the markers |begin| and |end|.
+func writeLines(w *bufio.Writer, f *File, first, last int, ranges []Range, prefix, begin, end string) {
+	start, stop := lineOffsets(f, first, last)
+	var marked bytes.Buffer
+	pos := start
+	for _, r := range ranges {
+		if r.Empty() {
+			continue
+		}
+		s, e := int(f.Tokens[r.Start].Start), int(f.Tokens[r.End-1].End)
+		marked.Write(f.Text[pos:s])
+		marked.WriteString(begin)
+		marked.Write(f.Text[s:e])
+		marked.WriteString(end)
+		pos = e
+	}
+	if pos < stop {
+		marked.Write(f.Text[pos:stop])
+	}
+
+	// The lines are written with "\n", whatever their new lines are.
+	for _, line := range lex.SplitLines(marked.Bytes()) {
+		w.WriteString(prefix)
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+}
+
+// Writes the lines of a file in a hunk, as context if |ranges| is empty.
+func writeSide(w *bufio.Writer, f *File, first, last int, ranges []Range, prefix, begin, end string) {
+	if len(ranges) == 0 {
+		prefix, begin, end = " ", "", ""
+	}
+	writeLines(w, f, first, last, ranges, prefix, begin, end)
+}
+
+// Writes the changes |changes| from |a| to |b| to |w| like a unified diff.
+// Each hunk has a header with the first line and the number of lines of
+// the hunk in the two files, and the lines of the files with the changed
+// tokens between "[-" and "-]" in the first file and "{+" and "+}" in the
+// second file. The lines of a file without changed tokens in the hunk are
+// written as context, prefixed by a space.
+func Unified(w io.Writer, a, b *File, changes []Change) error {
+	bw := bufio.NewWriter(w)
+	if len(changes) > 0 {
+		fmt.Fprintf(bw, "--- %s\n+++ %s\n", a.Path, b.Path)
+	}
+	for _, h := range hunks(a, b, changes) {
+		fmt.Fprintf(bw, "@@ -%d,%d +%d,%d @@\n", h.aFirst+1, h.aLast-h.aFirst+1, h.bFirst+1, h.bLast-h.bFirst+1)
+
+		var ar, br []Range
+		for _, c := range h.changes {
+			if !c.A.Empty() {
+				ar = append(ar, c.A)
+			}
+			if !c.B.Empty() {
+				br = append(br, c.B)
+			}
+		}
+		writeSide(bw, a, h.aFirst, h.aLast, ar, "-", deleteBegin, deleteEnd)
+		writeSide(bw, b, h.bFirst, h.bLast, br, "+", insertBegin, insertEnd)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,324 @@
+package lex
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+	"uno/lex/token_kind"
+)
+
+// The encoding of a text.
+type Encoding uint32
+
+const (
+	// The encoding is detected from the text. See DetectEncoding.
+	AutoEncoding = Encoding(iota)
+	UTF8
+	UTF16LE
+	UTF16BE
+	Latin1
+	// UTF-16 in the byte order given by the byte order mark at the
+	// beginning of the text, which is required.
+	UTF16
+)
+
+var encodingNames = map[Encoding]string{
+	AutoEncoding: "auto",
+	UTF8:         "utf-8",
+	UTF16LE:      "utf-16le",
+	UTF16BE:      "utf-16be",
+	Latin1:       "latin-1",
+	UTF16:        "utf-16",
+}
+
+func (e Encoding) String() string {
+	if n, ok := encodingNames[e]; ok {
+		return n
+	}
+	return fmt.Sprintf("Encoding(%d)", uint32(e))
+}
+
+var encodingAliases = map[string]Encoding{
+	"auto":       AutoEncoding,
+	"utf-8":      UTF8,
+	"utf8":       UTF8,
+	"utf-8-sig":  UTF8,
+	"ascii":      UTF8,
+	"us-ascii":   UTF8,
+	"utf-16":     UTF16,
+	"utf-16le":   UTF16LE,
+	"utf-16-le":  UTF16LE,
+	"utf-16be":   UTF16BE,
+	"utf-16-be":  UTF16BE,
+	"latin-1":    Latin1,
+	"latin1":     Latin1,
+	"l1":         Latin1,
+	"iso-8859-1": Latin1,
+	"iso8859-1":  Latin1,
+	"cp819":      Latin1,
+}
+
+// Returns the encoding named |name|, like "utf-8" or "latin-1". Names are
+// matched like Python does, ignoring case and treating '_' as '-'.
+func ParseEncoding(name string) (Encoding, error) {
+	n := strings.Replace(strings.ToLower(strings.TrimSpace(name)), "_", "-", -1)
+	if e, ok := encodingAliases[n]; ok {
+		return e, nil
+	}
+	return AutoEncoding, fmt.Errorf("Unsupported encoding '%s'.", name)
+}
+
+var boms = []struct {
+	bom []byte
+	enc Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, UTF8},
+	{[]byte{0xFF, 0xFE}, UTF16LE},
+	{[]byte{0xFE, 0xFF}, UTF16BE},
+}
+
+// Returns the encoding indicated by the byte order mark at the beginning
+// of |b| and the length of the mark. The length is 0 if |b| does not
+// begin with a byte order mark.
+func DetectBOM(b []byte) (Encoding, int) {
+	for _, m := range boms {
+		if bytes.HasPrefix(b, m.bom) {
+			return m.enc, len(m.bom)
+		}
+	}
+	return AutoEncoding, 0
+}
+
+// The encoding declaration of PEP 263, which also matches the Emacs and
+// Vim styles of declaring the encoding.
+var codingRegexp = regexp.MustCompile(`^[ \t\f]*#.*?coding[:=][ \t]*([-\w.]+)`)
+
+// A line which is blank or only a comment.
+var blankLineRegexp = regexp.MustCompile(`^[ \t\f]*(#|$)`)
+
+// Returns the first line of |b| without its new line, and the text after
+// it. The line ends at a "\n", a "\r" or a "\r\n", like in Python.
+func splitLine(b []byte) ([]byte, []byte) {
+	n := bytes.IndexAny(b, "\r\n")
+	if n < 0 {
+		return b, nil
+	}
+	if b[n] == '\r' && n+1 < len(b) && b[n+1] == '\n' {
+		return b[:n], b[n+2:]
+	}
+	return b[:n], b[n+1:]
+}
+
+// Returns the encoding declared in a comment on the first or the second
+// line of |b|, like "# -*- coding: latin-1 -*-" in Python files. Like in
+// PEP 263, the second line is looked at only if the first line is blank or
+// a comment. The encoding AutoEncoding is returned if no encoding is
+// declared.
+func DeclaredEncoding(b []byte) (Encoding, error) {
+	for i := 0; i < 2 && len(b) > 0; i++ {
+		var line []byte
+		line, b = splitLine(b)
+		if m := codingRegexp.FindSubmatch(line); m != nil {
+			return ParseEncoding(string(m[1]))
+		}
+		if !blankLineRegexp.Match(line) {
+			break
+		}
+	}
+	return AutoEncoding, nil
+}
+
+// Detects the encoding of the text beginning with |b|. The byte order
+// mark is used if present. Else, the declared encoding is used if any.
+// Else, the text is assumed to be UTF-8, even if it is not valid UTF-8:
+// the invalid bytes are errors of the Tokenizer, or Invalid tokens if
+// SetInvalidBytesAsTokens is on. Latin-1 is used only if it is declared.
+func DetectEncoding(b []byte) (Encoding, error) {
+	if e, n := DetectBOM(b); n > 0 {
+		return e, nil
+	}
+	e, err := DeclaredEncoding(b)
+	if err != nil || e != AutoEncoding {
+		return e, err
+	}
+	return UTF8, nil
+}
+
+// The number of bytes examined to detect the encoding of a text.
+const encodingDetectionSize = 4096
+
+// An io.RuneReader which decodes a text in an encoding other than UTF-8.
+type decoder struct {
+	r   *bufio.Reader
+	enc Encoding
+}
+
+func (d *decoder) readUnit() (uint16, error) {
+	var b [2]byte
+	n, err := io.ReadFull(d.r, b[:])
+	if err == io.ErrUnexpectedEOF {
+		// An odd byte at the end.
+		return 0, fmt.Errorf("Invalid UTF-16 text of odd length.")
+	}
+	if err != nil || n < 2 {
+		return 0, err
+	}
+	if d.enc == UTF16LE {
+		return uint16(b[0]) | uint16(b[1])<<8, nil
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+// Returns the next character. Like with UTF-8, an invalid sequence is
+// returned as utf8.RuneError with the size 1.
+func (d *decoder) ReadRune() (rune, int, error) {
+	switch d.enc {
+	case Latin1:
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		return rune(b), 1, nil
+	case UTF16LE, UTF16BE:
+		u, err := d.readUnit()
+		if err != nil {
+			return 0, 0, err
+		}
+		c := rune(u)
+		if !utf16.IsSurrogate(c) {
+			return c, 2, nil
+		}
+
+		// A high surrogate should be followed by a low surrogate.
+		if c < 0xDC00 {
+			if b, err := d.r.Peek(2); err == nil {
+				l := uint16(b[0])<<8 | uint16(b[1])
+				if d.enc == UTF16LE {
+					l = uint16(b[0]) | uint16(b[1])<<8
+				}
+				if p := utf16.DecodeRune(c, rune(l)); p != utf8.RuneError {
+					d.r.Discard(2)
+					return p, 4, nil
+				}
+			}
+		}
+		return utf8.RuneError, 1, nil
+	default:
+		return d.r.ReadRune()
+	}
+}
+
+// Returns an io.RuneReader which decodes the text read from |r| in the
+// encoding |enc|, and the encoding. If |enc| is AutoEncoding, the
+// encoding is detected from the beginning of the text with
+// DetectEncoding. The encoding UTF16 is returned as UTF16LE or UTF16BE,
+// as the byte order mark says. A byte order mark at the beginning of the
+// text is skipped if it matches the encoding.
+//
+// The text is read as UTF-8, so the byte offsets of the tokens read from
+// the io.RuneReader, like those of a TokenRef or a File, are offsets in
+// the UTF-8 encoding of the text, not in the bytes read from |r|.
+func NewDecoder(r io.Reader, enc Encoding) (io.RuneReader, Encoding, error) {
+	if r == nil {
+		return nil, enc, fmt.Errorf("A non-nil reader param is required.")
+	}
+	if _, ok := encodingNames[enc]; !ok {
+		return nil, enc, fmt.Errorf("Invalid encoding %d.", uint32(enc))
+	}
+
+	br := bufio.NewReaderSize(r, encodingDetectionSize)
+	b, err := br.Peek(encodingDetectionSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, enc, err
+	}
+
+	if enc == AutoEncoding {
+		enc, err = DetectEncoding(b)
+		if err != nil {
+			return nil, enc, err
+		}
+	}
+	if enc == UTF16 {
+		if e, _ := DetectBOM(b); e == UTF16LE || e == UTF16BE {
+			enc = e
+		} else {
+			return nil, enc, fmt.Errorf("UTF-16 text without a byte order mark, utf-16le or utf-16be is required.")
+		}
+	}
+	if e, n := DetectBOM(b); n > 0 && e == enc {
+		br.Discard(n)
+	}
+
+	return &decoder{br, enc}, enc, nil
+}
+
+// Returns the UTF-8 encoding of the text |b| in the encoding |enc|, and
+// the encoding. If |enc| is AutoEncoding, the encoding is detected like
+// NewDecoder does. UTF-8 text is returned as is, and the byte order mark
+// at its beginning is skipped by the CharReader. Invalid sequences in
+// UTF-16 text are replaced by utf8.RuneError. Like with NewDecoder, the
+// byte offsets in the returned text are not those in |b| unless the
+// encoding is UTF-8.
+func DecodeBytes(b []byte, enc Encoding) ([]byte, Encoding, error) {
+	if enc == AutoEncoding {
+		n := len(b)
+		if n > encodingDetectionSize {
+			n = encodingDetectionSize
+		}
+		var err error
+		enc, err = DetectEncoding(b[:n])
+		if err != nil {
+			return nil, enc, err
+		}
+	}
+	if enc == UTF8 {
+		return b, enc, nil
+	}
+
+	d, enc, err := NewDecoder(bytes.NewReader(b), enc)
+	if err != nil {
+		return nil, enc, err
+	}
+	var out bytes.Buffer
+	for true {
+		c, _, err := d.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, enc, err
+		}
+		out.WriteRune(c)
+	}
+	return out.Bytes(), enc, nil
+}
+
+// If |on| is true, invalid bytes in the input are returned as tokens of
+// the kind token_kind.Invalid instead of causing an error. The value of
+// such a token has utf8.RuneError for each invalid byte. It should be
+// called before reading any token.
+func (tz *Tokenizer) SetInvalidBytesAsTokens(on bool) {
+	tz.invalidBytes = on
+	tz.r.SetReadInvalidBytes(on)
+}
+
+// Reads a run of invalid bytes.
+func (tz *Tokenizer) readInvalidBytes() (*Token, error) {
+	line := tz.r.NextLine()
+	col := tz.r.NextCol()
+
+	s := tz.runes[:0]
+	for tz.r.peekInvalid() {
+		c, err := tz.r.ReadChar()
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, c)
+	}
+	return tz.makeToken(token_kind.Invalid, s, line, col), nil
+}
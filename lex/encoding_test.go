@@ -0,0 +1,207 @@
+package lex
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"uno/lex/token_kind"
+)
+
+// Returns the values of the tokens of |text|, read with |tz|.
+func tokenValues(tz *Tokenizer) ([]string, []*Token, error) {
+	var values []string
+	var tokens []*Token
+	for tz.HasNext() {
+		t, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, t.Value)
+		tokens = append(tokens, t)
+	}
+	return values, tokens, nil
+}
+
+func TestParseEncoding(t *testing.T) {
+	cases := map[string]Encoding{
+		"UTF-8":      UTF8,
+		"utf_8":      UTF8,
+		"Latin-1":    Latin1,
+		"iso-8859-1": Latin1,
+		"utf-16le":   UTF16LE,
+		"UTF-16-BE":  UTF16BE,
+		"utf-16":     UTF16,
+	}
+	for name, expected := range cases {
+		e, err := ParseEncoding(name)
+		if err != nil {
+			t.Error(err.Error())
+		} else if e != expected {
+			t.Errorf("Expected %s for '%s', but got %s.", expected, name, e)
+		}
+	}
+
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Errorf("Expected an error for an unsupported encoding.")
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected Encoding
+	}{
+		{"x = 1\n", UTF8},
+		{"", UTF8},
+		{"\xef\xbb\xbfx\n", UTF8},
+		{"\xff\xfex\x00", UTF16LE},
+		{"\xfe\xff\x00x", UTF16BE},
+		{"#!/usr/bin/python\n# vim: set fileencoding=latin-1 :\n", Latin1},
+		{"x = 1\n\n# coding: latin-1\n", UTF8},
+		{"# coding: latin-1\r\nx = 1\r\n", Latin1},
+		// The declaration is only on the first two lines, after a blank
+		// line or a comment.
+		{"# a\rx = 1\r# coding: latin-1\r", UTF8},
+		{"x = 1\n# coding: latin-1\n", UTF8},
+		{"\n# coding: latin-1\n", Latin1},
+		// Invalid UTF-8 is not read as Latin-1 unless it is declared.
+		{"x = 'caf\xe9'\n", UTF8},
+		{"x = 'caf\xc3", UTF8},
+	}
+	for _, c := range cases {
+		e, err := DetectEncoding([]byte(c.text))
+		if err != nil {
+			t.Error(err.Error())
+		} else if e != c.expected {
+			t.Errorf("Expected %s for %q, but got %s.", c.expected, c.text, e)
+		}
+	}
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	b, e, err := DecodeBytes([]byte("\xff\xfex\x00"), UTF16)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(b) != "x" || e != UTF16LE {
+		t.Errorf("Expected 'x' in %s, but got %q in %s.", UTF16LE, string(b), e)
+	}
+
+	// The byte order is not guessed without a byte order mark.
+	if _, _, err := DecodeBytes([]byte("\x00x"), UTF16); err == nil {
+		t.Errorf("Expected an error for UTF-16 text without a byte order mark.")
+	}
+}
+
+func TestDecodeFiles(t *testing.T) {
+	cases := map[string]Encoding{
+		"utf16le.py":  UTF16LE,
+		"utf16be.py":  UTF16BE,
+		"latin1.py":   Latin1,
+		"utf8_bom.py": UTF8,
+	}
+	for name, expected := range cases {
+		text, err := ioutil.ReadFile(filepath.Join("test_data", "encoding", name))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		// Decode both from bytes and from a stream.
+		b, e, err := DecodeBytes(text, AutoEncoding)
+		if err != nil {
+			t.Error(err.Error())
+			continue
+		}
+		rr, re, err := NewDecoder(bytes.NewReader(text), AutoEncoding)
+		if err != nil {
+			t.Error(err.Error())
+			continue
+		}
+		if e != expected || re != expected {
+			t.Errorf("Expected %s for %s, but got %s and %s.", expected, name, e, re)
+		}
+
+		for _, r := range []io.RuneReader{bytes.NewReader(b), rr} {
+			tz, err := PythonProfile.NewTokenizer(r)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			values, tokens, err := tokenValues(tz)
+			if err != nil {
+				t.Errorf("%s: %s", name, err.Error())
+				continue
+			}
+
+			var code []string
+			for i, v := range values {
+				if tokens[i].Kind != token_kind.PySingleLineComment && tokens[i].Kind != token_kind.NewLine {
+					code = append(code, v)
+				}
+			}
+			if s := strings.Join(code, " "); s != "x = 'café'" {
+				t.Errorf("%s: unexpected tokens '%s'.", name, s)
+			}
+			if tokens[0].Col != 1 {
+				t.Errorf("%s: expected the byte order mark to be skipped, but the first token is at column %d.",
+					name, tokens[0].Col)
+			}
+		}
+	}
+}
+
+func TestInvalidBytesAsTokens(t *testing.T) {
+	text, err := ioutil.ReadFile(filepath.Join("test_data", "encoding", "invalid.py"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The invalid bytes are not decoded as Latin-1.
+	text, e, err := DecodeBytes(text, AutoEncoding)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if e != UTF8 {
+		t.Errorf("Expected the text to be read as %s, but got %s.", UTF8, e)
+	}
+
+	tz, err := PythonProfile.NewTokenizer(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, _, err := tokenValues(tz); err == nil {
+		t.Errorf("Expected an error for the invalid bytes.")
+	}
+
+	tz, err = PythonProfile.NewTokenizer(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz.SetInvalidBytesAsTokens(true)
+	_, tokens, err := tokenValues(tz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var invalid []*Token
+	for _, tk := range tokens {
+		if tk.Kind == token_kind.Invalid {
+			invalid = append(invalid, tk)
+		}
+	}
+	if len(invalid) != 1 {
+		t.Fatalf("Expected one Invalid token, but got %d.", len(invalid))
+	}
+	if invalid[0].Value != string([]rune{utf8.RuneError, utf8.RuneError}) || invalid[0].Col != 7 {
+		t.Errorf("Unexpected Invalid token %q at column %d.", invalid[0].Value, invalid[0].Col)
+	}
+	if last := tokens[len(tokens)-2]; last.Value != "y" || last.Col != 10 {
+		t.Errorf("Expected 'y' at column 10 after the invalid bytes, but got %q at %d.", last.Value, last.Col)
+	}
+}
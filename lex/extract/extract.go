@@ -0,0 +1,287 @@
+// Package extract extracts the text of the comments and the strings of
+// source code, and splits it and the identifiers into words, for tools
+// like spell-checkers and translation catalogs.
+//
+// The text of a comment is its source without the delimiters, like "//"
+// or "/*" and "*/". The text of a string is its value without the quotes,
+// with the escape sequences decoded by the Tokenizer, so that "a\tb" is
+// extracted with a tab, but the positions of its words are in the source.
+package extract
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"uno/lex"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// The options of Extract, which are what it extracts. If none is set, the
+// comments and the strings are extracted.
+type Options struct {
+	Comments    bool
+	Strings     bool
+	Identifiers bool
+}
+
+// A comment, a string or an identifier.
+type Item struct {
+	Kind uint32
+	// The position of the token.
+	Line uint32
+	Col  uint32
+	// The text of the comment or of the string, or the identifier.
+	Text string
+	// The number of characters of the token before Text, like a quote.
+	offset uint32
+	// The spelling of the token in the source and the byte offsets in it
+	// of the characters of its value, if the value has escape sequences.
+	spelling Spelling
+}
+
+// The spelling of a token in the source, like the text between the Offsets
+// of the Tokenizer, and the ValueOffsets of the Tokenizer for the token,
+// which are nil if the value of the token has no escape sequences.
+type Spelling struct {
+	Text    string
+	Offsets []uint32
+}
+
+// Returns the text of the comment or the string |t| and the number of its
+// characters before the text, or false if |t| is neither. A character
+// literal, like 'c' in C, is not a string.
+func TextOf(t *lex.Token) (string, uint32, bool) {
+	v := t.Value
+	trim := func(before, after string) (string, uint32, bool) {
+		if strings.HasPrefix(v, before) && len(v) >= len(before)+len(after) && strings.HasSuffix(v, after) {
+			return v[len(before) : len(v)-len(after)], uint32(len(before)), true
+		}
+		// An unterminated comment, like at the end of the text.
+		return strings.TrimPrefix(v, before), uint32(len(before)), true
+	}
+
+	switch t.Kind {
+	case token_kind.CSingleLineComment:
+		return trim("//", "")
+	case token_kind.CMultiLineComment:
+		return trim("/*", "*/")
+	case token_kind.PySingleLineComment:
+		s, n, _ := trim("#", "")
+		return strings.TrimRight(s, "\r\n"), n, true
+	case token_kind.PyMultilineString:
+		if len(v) < 3 {
+			return trim("", "")
+		}
+		return trim(v[:3], v[:3])
+	case token_kind.DoubleQuoteString, token_kind.SingleQuoteString, token_kind.BackQuoteString:
+		if v == "" {
+			return trim("", "")
+		}
+		return trim(v[:1], v[:1])
+	}
+	return "", 0, false
+}
+
+// Returns the comments, the strings and the identifiers of |tokens|, as
+// |o| selects them. The spellings of the tokens in the source, |spellings|,
+// give the positions of the words of the strings with escape sequences. If
+// it is nil, the positions count the characters of the values.
+func Extract(tokens []*lex.Token, spellings []Spelling, o *Options) []Item {
+	if o == nil || !o.Comments && !o.Strings && !o.Identifiers {
+		o = &Options{Comments: true, Strings: true}
+	}
+	var items []Item
+	for i, t := range tokens {
+		switch highlight.ClassOf(t.Kind) {
+		case highlight.Comment:
+			if !o.Comments {
+				continue
+			}
+		case highlight.String:
+			if !o.Strings {
+				continue
+			}
+		case highlight.Identifier:
+			if o.Identifiers {
+				items = append(items, Item{t.Kind, t.Line, t.Col, t.Value, 0, Spelling{}})
+			}
+			continue
+		default:
+			continue
+		}
+		if text, offset, ok := TextOf(t); ok {
+			var spelling Spelling
+			if spellings != nil && spellings[i].Offsets != nil {
+				spelling = spellings[i]
+			}
+			items = append(items, Item{t.Kind, t.Line, t.Col, text, offset, spelling})
+		}
+	}
+	return items
+}
+
+// A word of an Item.
+type Word struct {
+	Text string
+	Line uint32
+	Col  uint32
+}
+
+// Returns true if |r| is part of a word, like a letter of an identifier.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// Returns the ranges [start, end) of the parts of the identifier |runes|.
+// See SplitIdentifier.
+func splitIdentifier(runes []rune) [][2]int {
+	var parts [][2]int
+	start := 0
+	for i, r := range runes {
+		split := false
+		switch {
+		case !isWordRune(r) || r == '_':
+			if start < i {
+				parts = append(parts, [2]int{start, i})
+			}
+			start = i + 1
+			continue
+		case i == start:
+		case unicode.IsDigit(r) != unicode.IsDigit(runes[i-1]):
+			split = true
+		case unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			split = true
+		case unicode.IsUpper(r) && unicode.IsUpper(runes[i-1]):
+			// The last capital of an acronym begins the next part, like
+			// the S of "HTTPServer".
+			split = i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		}
+		if split {
+			parts = append(parts, [2]int{start, i})
+			start = i
+		}
+	}
+	if start < len(runes) {
+		parts = append(parts, [2]int{start, len(runes)})
+	}
+	return parts
+}
+
+// Returns the parts of the identifier |name|, split at the underscores,
+// at the changes from lower to upper case and at the digits, like "parse",
+// "HTTP", "2" and "Response" for "parse_HTTP2Response".
+func SplitIdentifier(name string) []string {
+	runes := []rune(name)
+	var parts []string
+	for _, p := range splitIdentifier(runes) {
+		parts = append(parts, string(runes[p[0]:p[1]]))
+	}
+	return parts
+}
+
+// Returns true if |s| has a letter.
+func hasLetter(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the positions in the source of the characters of Text. In a
+// string with escape sequences, the position of a character is found from
+// its offset in the spelling of the token, so that an escape sequence
+// counts as its characters in the source.
+func (it *Item) positions() [][2]uint32 {
+	runes := []rune(it.Text)
+	positions := make([][2]uint32, len(runes))
+	if it.spelling.Offsets == nil {
+		line, col := it.Line, it.Col+it.offset
+		for i, r := range runes {
+			positions[i] = [2]uint32{line, col}
+			if r == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+		return positions
+	}
+
+	src := it.spelling.Text
+	line, col := it.Line, it.Col
+	j := 0
+	for i := range runes {
+		k := int(it.offset) + i
+		if k >= len(it.spelling.Offsets) {
+			break
+		}
+		for end := int(it.spelling.Offsets[k]); j < end && j < len(src); {
+			r, size := utf8.DecodeRuneInString(src[j:])
+			if r == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+			j += size
+		}
+		positions[i] = [2]uint32{line, col}
+	}
+	return positions
+}
+
+// Returns the words of the item, which are its runs of letters and digits
+// split like SplitIdentifier. An apostrophe between two letters is part of
+// a word, like in "don't". The parts without a letter, like numbers, are
+// not words.
+//
+// The positions of the words are in the source, so in a string with
+// escape sequences, like "a\tb", an escape sequence counts as its
+// characters in the source rather than as the character of Text.
+func (it *Item) Words() []Word {
+	var words []Word
+	positions := it.positions()
+	// The index in Text and the characters of the run of word characters
+	// being read.
+	var start int
+	var run []rune
+
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		// A word with an apostrophe is prose, which is not split.
+		parts := [][2]int{{0, len(run)}}
+		if !strings.ContainsAny(string(run), "'’") {
+			parts = splitIdentifier(run)
+		}
+		for _, p := range parts {
+			if part := string(run[p[0]:p[1]]); hasLetter(part) {
+				pos := positions[start+p[0]]
+				words = append(words, Word{part, pos[0], pos[1]})
+			}
+		}
+		run = run[:0]
+	}
+
+	runes := []rune(it.Text)
+	for i, r := range runes {
+		inWord := isWordRune(r)
+		if (r == '\'' || r == '’') && len(run) > 0 && i+1 < len(runes) &&
+			unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1]) {
+			inWord = true
+		}
+		if !inWord {
+			flush()
+		} else if len(run) == 0 {
+			start = i
+		}
+		if inWord {
+			run = append(run, r)
+		}
+	}
+	flush()
+	return words
+}
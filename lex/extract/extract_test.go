@@ -0,0 +1,147 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func extract(t *testing.T, p *lex.Profile, text string, o *Options) []Item {
+	tz, err := p.NewBytesTokenizer([]byte(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return extractTokens(t, tz, text, o)
+}
+
+// Returns the items of the tokens which |tz| reads from |text|.
+func extractTokens(t *testing.T, tz *lex.Tokenizer, text string, o *Options) []Item {
+	var tokens []*lex.Token
+	var spellings []Spelling
+	for tz.HasNext() {
+		tok, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		start, end := tz.Offsets()
+		tokens = append(tokens, tok)
+		offsets := append([]uint32(nil), tz.ValueOffsets()...)
+		spellings = append(spellings, Spelling{text[start:end], offsets})
+	}
+	return Extract(tokens, spellings, o)
+}
+
+func TestExtract(t *testing.T) {
+	text := `/* Returns the
+ * sum. */
+int sum(int a, char c) {
+  puts("a\tb"); // Don't print.
+  return a + 'c';
+}
+`
+	var got []string
+	for _, it := range extract(t, lex.CProfile, text, nil) {
+		got = append(got, fmt.Sprintf("%d:%d %q", it.Line, it.Col, it.Text))
+	}
+	expected := []string{`1:1 " Returns the\n * sum. "`, `4:8 "a\tb"`, `4:17 " Don't print."`}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the items %v, but got %v.", expected, got)
+	}
+
+	items := extract(t, lex.PythonProfile, `x = """doc"""  # a`+"\n", &Options{Identifiers: true, Strings: true})
+	if len(items) != 2 || items[0].Text != "x" || items[1].Text != "doc" {
+		t.Errorf("Unexpected items %v.", items)
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"parse_HTTP2Response": "parse HTTP 2 Response",
+		"HTTPServer":          "HTTP Server",
+		"getURL":              "get URL",
+		"__init__":            "init",
+		"MAX_LINE_LENGTH":     "MAX LINE LENGTH",
+		"utf8":                "utf 8",
+		"étéChaud":            "été Chaud",
+		"x":                   "x",
+	}
+	for name, expected := range tests {
+		if got := strings.Join(SplitIdentifier(name), " "); got != expected {
+			t.Errorf("Expected the parts %q of %q, but got %q.", expected, name, got)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	items := extract(t, lex.CProfile, "int x; /* Don't call\n   readFile2 twice. */\n", nil)
+	var got []string
+	for _, w := range items[0].Words() {
+		got = append(got, fmt.Sprintf("%d:%d %s", w.Line, w.Col, w.Text))
+	}
+	expected := []string{"1:11 Don't", "1:17 call", "2:4 read", "2:8 File", "2:14 twice"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the words %v, but got %v.", expected, got)
+	}
+}
+
+func TestWordsEscapes(t *testing.T) {
+	text := "x = 1\ny = \"teh\\tcat \\\"don't\\\"\";\n"
+	items := extract(t, lex.CProfile, text, nil)
+	var got []string
+	for _, w := range items[0].Words() {
+		got = append(got, fmt.Sprintf("%d:%d %s", w.Line, w.Col, w.Text))
+	}
+	// The escape sequences are two characters in the source.
+	expected := []string{"2:6 teh", "2:11 cat", "2:17 don't"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the words %v, but got %v.", expected, got)
+	}
+}
+
+// An escape sequence reader for the escape sequences of two hexadecimal
+// digits, like \x4a, which are longer than those of GoESR.
+type hexESR struct{}
+
+func (hexESR) ReadChar(r *lex.CharReader, tt uint32) (rune, error) {
+	var digits []rune
+	for len(digits) < 3 {
+		c, err := r.ReadChar()
+		if err != nil {
+			return 0, err
+		}
+		digits = append(digits, c)
+	}
+	v, err := strconv.ParseUint(string(digits[1:]), 16, 8)
+	if digits[0] != 'x' || err != nil {
+		return 0, fmt.Errorf("Invalid escape sequence.")
+	}
+	return rune(v), nil
+}
+
+func TestWordsHexEscapes(t *testing.T) {
+	text := "s = \"\\x4aa cat\\x41\";\n"
+	tz, err := lex.NewBytesTokenizer([]byte(text), lex.CProfile.TokenKindSet(), hexESR{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	items := extractTokens(t, tz, text, nil)
+	if len(items) != 1 || items[0].Text != "Ja catA" {
+		t.Fatalf("Unexpected items %v.", items)
+	}
+	var got []string
+	for _, w := range items[0].Words() {
+		got = append(got, fmt.Sprintf("%d:%d %s", w.Line, w.Col, w.Text))
+	}
+	// The 'a' after \x4a is not a part of the escape sequence.
+	expected := []string{"1:6 Ja", "1:12 cat", "1:15 A"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the words %v, but got %v.", expected, got)
+	}
+}
@@ -0,0 +1,206 @@
+package lex
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A compact representation of a position in a file of a FileSet. It is
+// the base of the file in the set plus the byte offset in the file.
+type Pos uint32
+
+// The zero value of Pos is not a position in any file.
+const NoPos = Pos(0)
+
+func (p Pos) IsValid() bool {
+	return p != NoPos
+}
+
+// A position expanded in to the file name, byte offset, line and column.
+// Lines and columns begin at 1 and columns are counted in bytes.
+type Position struct {
+	Filename string
+	Offset   uint32
+	Line     uint32
+	Col      uint32
+}
+
+// Returns true if the position has a valid line number.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Returns the position in one of these forms:
+//
+//	file:line:col
+//	file:line
+//	line:col
+//	file
+//	-
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d", p.Line)
+		if p.Col != 0 {
+			s += fmt.Sprintf(":%d", p.Col)
+		}
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// A file in a FileSet. The line table of the file is built while the
+// file is read by a Tokenizer created with NewFileTokenizer.
+type File struct {
+	name string
+	base uint32
+	size uint32
+
+	mutex sync.Mutex
+	lines []uint32 // The byte offsets of the first characters of the lines.
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+// Returns the Pos of the byte offset 0 of the file.
+func (f *File) Base() uint32 {
+	return f.base
+}
+
+func (f *File) Size() uint32 {
+	return f.size
+}
+
+// Returns the number of lines known so far.
+func (f *File) LineCount() uint32 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return uint32(len(f.lines))
+}
+
+// Records that a line begins at the byte |offset|. Offsets which are not
+// greater than the offset of the last line, or are beyond the size of
+// the file, are ignored.
+func (f *File) AddLine(offset uint32) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if offset > f.size {
+		return
+	}
+	if n := len(f.lines); n > 0 && f.lines[n-1] >= offset {
+		return
+	}
+	f.lines = append(f.lines, offset)
+}
+
+// Returns the Pos of the byte |offset| in the file, or NoPos if |offset|
+// is beyond the end of the file.
+func (f *File) Pos(offset uint32) Pos {
+	if offset > f.size {
+		return NoPos
+	}
+	return Pos(f.base + offset)
+}
+
+// Returns the byte offset of |p| in the file, or an error if |p| is not
+// in the file.
+func (f *File) Offset(p Pos) (uint32, error) {
+	if uint32(p) < f.base || uint32(p) > f.base+f.size {
+		return 0, fmt.Errorf("The Pos %d is not in the file '%s'.", p, f.name)
+	}
+	return uint32(p) - f.base, nil
+}
+
+// Returns the Pos of the first character of |line|, or NoPos if the
+// line is not known.
+func (f *File) LineStart(line uint32) Pos {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if line == 0 || line > uint32(len(f.lines)) {
+		return NoPos
+	}
+	return Pos(f.base + f.lines[line-1])
+}
+
+// Returns the expanded position of |p|, or the zero Position if |p| is not
+// in the file.
+func (f *File) Position(p Pos) Position {
+	offset, err := f.Offset(p)
+	if !p.IsValid() || err != nil {
+		return Position{}
+	}
+
+	pos := Position{Filename: f.name, Offset: offset}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	i := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset })
+	if i > 0 {
+		pos.Line = uint32(i)
+		pos.Col = offset - f.lines[i-1] + 1
+	}
+	return pos
+}
+
+// A set of files whose positions can be represented by Pos values. It
+// can be used concurrently.
+type FileSet struct {
+	mutex sync.RWMutex
+	base  uint32
+	files []*File
+}
+
+func NewFileSet() *FileSet {
+	s := new(FileSet)
+	s.base = 1 // 0 is reserved for NoPos.
+	return s
+}
+
+// Adds a file of |size| bytes named |name| to the set.
+func (s *FileSet) AddFile(name string, size uint32) *File {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f := &File{name: name, base: s.base, size: size, lines: []uint32{0}}
+	// The position just past the end of the file is also valid.
+	s.base += size + 1
+	s.files = append(s.files, f)
+	return f
+}
+
+// Returns the file containing |p|, or nil if no such file exists.
+func (s *FileSet) File(p Pos) *File {
+	if !p.IsValid() {
+		return nil
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > uint32(p) })
+	if i == 0 {
+		return nil
+	}
+	f := s.files[i-1]
+	if uint32(p) > f.base+f.size {
+		return nil
+	}
+	return f
+}
+
+// Returns the expanded position of |p|. The zero Position is returned if
+// |p| is not in any file of the set.
+func (s *FileSet) Position(p Pos) Position {
+	f := s.File(p)
+	if f == nil {
+		return Position{}
+	}
+	return f.Position(p)
+}
@@ -0,0 +1,138 @@
+package lex
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+func tokenizeFile(fset *FileSet, file string, ts TokenKindSet) ([]Pos, []*Token, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var goEsr GoESR
+	sf := fset.AddFile(file, uint32(fi.Size()))
+	tz, err := NewFileTokenizer(sf, bufio.NewReader(f), ts, goEsr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var positions []Pos
+	var tokens []*Token
+	for tz.HasNext() {
+		t, p, err := tz.NextTokenPos()
+		if err == io.EOF {
+			// Skipped white space at the end of the file.
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		positions = append(positions, p)
+		tokens = append(tokens, t)
+	}
+	return positions, tokens, nil
+}
+
+func TestFileSetPositions(t *testing.T) {
+	ts := NewTokenKindSet([]uint32{
+		token_kind.PySingleLineComment,
+		token_kind.CSingleLineComment,
+		token_kind.CMultiLineComment,
+		token_kind.Identifier,
+		token_kind.KeywordClass,
+		token_kind.KeywordDef,
+	})
+
+	fset := NewFileSet()
+	files := []string{"test_data/comments_text", "test_data/identifiers_text"}
+	var all []Pos
+	for _, file := range files {
+		positions, tokens, err := tokenizeFile(fset, file, ts)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		// The files are ASCII, so byte columns are the same as the
+		// columns of the tokens.
+		for i, p := range positions {
+			pos := fset.Position(p)
+			if pos.Filename != file || pos.Line != tokens[i].Line || pos.Col != tokens[i].Col {
+				t.Errorf("Expected '%s' at %s:%d:%d, but got %s.",
+					tokens[i].Value, file, tokens[i].Line, tokens[i].Col, pos)
+			}
+		}
+		all = append(all, positions...)
+	}
+
+	// The positions of the second file follow those of the first.
+	for i := 1; i < len(all); i++ {
+		if all[i] <= all[i-1] {
+			t.Errorf("Pos values are not increasing: %d, %d.", all[i-1], all[i])
+		}
+	}
+
+	f := fset.File(all[len(all)-1])
+	if f == nil || f.Name() != files[1] {
+		t.Fatalf("Expected the last Pos to be in %s.", files[1])
+	}
+	if p := fset.Position(f.LineStart(2)); p.String() != files[1]+":2:1" {
+		t.Errorf("Expected the start of line 2 to be %s:2:1, but got %s.", files[1], p)
+	}
+	if fset.File(NoPos) != nil {
+		t.Errorf("NoPos should not be in any file.")
+	}
+	if s := fset.Position(NoPos).String(); s != "-" {
+		t.Errorf("Expected NoPos to be printed as '-', but got '%s'.", s)
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	ts := NewTokenKindSet([]uint32{
+		token_kind.DecimalInteger,
+		token_kind.HexInteger,
+		token_kind.OctInteger,
+		token_kind.FloatNumber,
+	})
+	if err := matchPositions("test_data/numbers_text", ts); err != nil {
+		t.Error(err.Error())
+	}
+
+	ts = NewTokenKindSet([]uint32{
+		token_kind.PySingleLineComment,
+		token_kind.CSingleLineComment,
+		token_kind.CMultiLineComment,
+	})
+	if err := matchPositions("test_data/comments_text", ts); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestFileBounds(t *testing.T) {
+	fset := NewFileSet()
+	a := fset.AddFile("a", 10)
+	b := fset.AddFile("b", 5)
+
+	if p := a.Pos(11); p != NoPos {
+		t.Errorf("Expected NoPos beyond the end of the file, but got %d.", p)
+	}
+	if _, err := a.Offset(b.Pos(1)); err == nil {
+		t.Errorf("Expected an error for the offset of a Pos of another file.")
+	}
+	if o, err := b.Offset(b.Pos(5)); err != nil || o != 5 {
+		t.Errorf("Expected the offset 5, but got %d, %v.", o, err)
+	}
+	if pos := a.Position(b.Pos(1)); pos.IsValid() {
+		t.Errorf("Expected the zero Position for a Pos of another file, but got %s.", pos)
+	}
+}
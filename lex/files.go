@@ -0,0 +1,260 @@
+package lex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The tokens of a file read by TokenizeFiles.
+type FileTokens struct {
+	Path    string
+	Profile *Profile
+	Tokens  []*Token
+	// The error which occured while reading the file. The tokens read
+	// before the error are present in |Tokens|.
+	Err error
+}
+
+// An error which occured while reading a file.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+}
+
+// The errors which occured while reading a list of files.
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	s := fmt.Sprintf("Error reading %d file(s).", len(e))
+	for _, fe := range e {
+		s += "\n" + fe.Error()
+	}
+	return s
+}
+
+type fileJob struct {
+	path    string
+	profile *Profile
+}
+
+// Expands |paths| in to the list of files to be read. Directories are
+// walked in lexical order, and the files in them which do not match a
+// profile are skipped. A file listed in |paths| which does not match a
+// profile is an error.
+func listFiles(ctx context.Context, paths []string, profile *Profile) ([]fileJob, FileErrors) {
+	profileFor := func(path string) *Profile {
+		if profile == nil {
+			return ProfileForFile(path)
+		}
+		if profile.Matches(path) {
+			return profile
+		}
+		return nil
+	}
+
+	var jobs []fileJob
+	var errs FileErrors
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, &FileError{path, err})
+			continue
+		}
+
+		if !info.IsDir() {
+			p := profile
+			if p == nil {
+				p = ProfileForFile(path)
+			}
+			if p == nil {
+				errs = append(errs, &FileError{path, fmt.Errorf("No profile for the file.")})
+				continue
+			}
+			jobs = append(jobs, fileJob{path, p})
+			continue
+		}
+
+		filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				errs = append(errs, &FileError{p, err})
+				return nil
+			}
+			if info.IsDir() {
+				// Skip hidden directories like ".git".
+				if p != path && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			if fp := profileFor(p); fp != nil {
+				jobs = append(jobs, fileJob{p, fp})
+			}
+			return nil
+		})
+	}
+	return jobs, errs
+}
+
+func readFileTokens(ctx context.Context, job fileJob) FileTokens {
+	ft := FileTokens{Path: job.path, Profile: job.profile}
+
+	text, err := ioutil.ReadFile(job.path)
+	if err != nil {
+		ft.Err = err
+		return ft
+	}
+	text, _, err = DecodeBytes(text, AutoEncoding)
+	if err != nil {
+		ft.Err = err
+		return ft
+	}
+
+	tz, err := job.profile.NewTokenizer(strings.NewReader(string(text)))
+	if err != nil {
+		ft.Err = err
+		return ft
+	}
+	for tz.HasNext() {
+		if err := ctx.Err(); err != nil {
+			ft.Err = err
+			return ft
+		}
+
+		t, err := tz.NextToken()
+		if err == io.EOF {
+			// Skipped white space at the end of the file.
+			break
+		}
+		if err != nil {
+			ft.Err = fmt.Errorf("Error at %d:%d: %s", tz.Line(), tz.Col(), err.Error())
+			return ft
+		}
+		ft.Tokens = append(ft.Tokens, t)
+	}
+	return ft
+}
+
+// Tokenizes the files in |paths| concurrently with |workers| goroutines,
+// and calls |fn| with the tokens of each file in order. The directories
+// in |paths| are walked and the files in them are read in lexical order.
+// If |profile| is nil, the profile of each file is selected from the
+// predefined profiles by its extension. Else, |profile| is used for the
+// files listed in |paths| and for the files in the directories which
+// match it. If |workers| is not positive, the number of CPUs is used. At
+// most 2*|workers| files are tokenized ahead of the file passed to |fn|,
+// so a slow |fn| does not make the tokens of all the files pile up.
+//
+// The files are read even if some of them cannot be read. The errors
+// which occur while reading a file are passed to |fn| in FileTokens.Err.
+// They are returned together with the errors in listing the files as
+// FileErrors at the end. Tokenizing stops if |ctx| is cancelled or |fn|
+// returns an error, and that error is returned.
+func TokenizeFilesFunc(ctx context.Context, paths []string, profile *Profile, workers int, fn func(FileTokens) error) error {
+	if fn == nil {
+		return fmt.Errorf("A non-nil function param is required.")
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs, errs := listFiles(ctx, paths, profile)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The result of the i-th job is available in results[i] once done[i]
+	// is closed.
+	results := make([]FileTokens, len(jobs))
+	done := make([]chan struct{}, len(jobs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	// The jobs whose results are not passed to |fn| yet hold a slot of
+	// |inFlight|, so that the tokens of at most that many files are held
+	// while |fn| is slow.
+	inFlight := make(chan struct{}, 2*workers)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range jobs {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				results[i] = readFileTokens(ctx, jobs[i])
+				close(done[i])
+			}
+		}()
+	}
+
+	for i := range jobs {
+		select {
+		case <-done[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		ft := results[i]
+		// The tokens are not retained after they are passed to |fn|.
+		results[i] = FileTokens{}
+		if ft.Err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, &FileError{ft.Path, ft.Err})
+		}
+		if err := fn(ft); err != nil {
+			return err
+		}
+		<-inFlight
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Tokenizes the files in |paths| like TokenizeFilesFunc does, and returns
+// the tokens of the files in order. The results are returned even if an
+// error occurs. If the error is FileErrors, then the results of all the
+// files are present.
+func TokenizeFiles(ctx context.Context, paths []string, profile *Profile, workers int) ([]FileTokens, error) {
+	var results []FileTokens
+	err := TokenizeFilesFunc(ctx, paths, profile, workers, func(ft FileTokens) error {
+		results = append(results, ft)
+		return nil
+	})
+	return results, err
+}
@@ -0,0 +1,85 @@
+package lex
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+func TestTokenizeFiles(t *testing.T) {
+	dir := filepath.Join("test_data", "files")
+	results, err := TokenizeFiles(context.Background(), []string{dir}, nil, 2)
+
+	errs, ok := err.(FileErrors)
+	if !ok || len(errs) != 1 || errs[0].Path != filepath.Join(dir, "bad.py") {
+		t.Fatalf("Expected an error for bad.py, but got: %v", err)
+	}
+
+	expected := []struct {
+		name    string
+		profile *Profile
+		count   int
+	}{
+		{"a.py", PythonProfile, 11},
+		{"b.c", CProfile, 11},
+		{"bad.py", PythonProfile, 2},
+		{filepath.Join("sub", "_c.go"), GoProfile, 3},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d files, but got %d.", len(expected), len(results))
+	}
+	for i, exp := range expected {
+		ft := results[i]
+		if ft.Path != filepath.Join(dir, exp.name) {
+			t.Errorf("Expected file %s at index %d, but got %s.", exp.name, i, ft.Path)
+		}
+		if ft.Profile != exp.profile {
+			t.Errorf("Expected profile %s for %s, but got %s.", exp.profile.Name, ft.Path, ft.Profile.Name)
+		}
+		if len(ft.Tokens) != exp.count {
+			t.Errorf("Expected %d tokens in %s, but got %d.", exp.count, ft.Path, len(ft.Tokens))
+		}
+	}
+	if results[0].Tokens[0].Kind != token_kind.KeywordDef {
+		t.Errorf("Expected the first token of a.py to be 'def'.")
+	}
+
+	// A listed file which matches no profile is an error, unless a
+	// profile is given.
+	_, err = TokenizeFiles(context.Background(), []string{filepath.Join(dir, "notes.txt")}, nil, 1)
+	if _, ok := err.(FileErrors); !ok {
+		t.Errorf("Expected FileErrors, but got: %v", err)
+	}
+	results, err = TokenizeFiles(
+		context.Background(), []string{dir, filepath.Join(dir, "notes.txt")}, PythonProfile, 0)
+	if err == nil || len(results) != 3 {
+		t.Fatalf("Expected 3 files and an error, but got %d files and error: %v", len(results), err)
+	}
+	if results[2].Path != filepath.Join(dir, "notes.txt") || results[2].Err != nil {
+		t.Errorf("Expected notes.txt to be read with the Python profile.")
+	}
+}
+
+func TestTokenizeFilesCancel(t *testing.T) {
+	dir := filepath.Join("test_data", "files")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := TokenizeFiles(ctx, []string{dir}, nil, 2)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, but got: %v", err)
+	}
+
+	// An error returned by the function stops tokenizing.
+	stop := fmt.Errorf("Stop.")
+	n := 0
+	err = TokenizeFilesFunc(context.Background(), []string{dir}, nil, 2, func(ft FileTokens) error {
+		n += 1
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Expected to stop after 1 file, but read %d files and got: %v", n, err)
+	}
+}
@@ -0,0 +1,359 @@
+// Package gettext collects the strings of source code which are marked
+// for translation, like the argument of _("Hello"), and writes them as a
+// gettext template, a .pot file, like xgettext does.
+//
+// A keyword is the name of a function which marks its arguments, with the
+// positions of the arguments which are the message, its plural form and
+// its context, like for xgettext: "_" marks its first argument,
+// "ngettext:1,2" marks a message and its plural, and "pgettext:1c,2" marks
+// a context and a message. The arguments must be strings, or adjacent
+// strings which are concatenated, so the calls with other arguments, like
+// _(name), are skipped.
+//
+// The comments which begin with a tag, like "TRANSLATORS:", and which end
+// on the line of a call or on the line before it, are written for the
+// translators.
+package gettext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"uno/lex"
+	"uno/lex/extract"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// A function which marks its arguments for translation.
+type Keyword struct {
+	Name string
+	// The positions of the arguments, from 1, or 0 if there is none.
+	Message int
+	Plural  int
+	Context int
+}
+
+// The keywords of the gettext functions.
+var DefaultKeywords = []string{"_", "N_", "gettext", "ngettext:1,2", "pgettext:1c,2", "npgettext:1c,2,3"}
+
+// The default tag of the comments for the translators.
+const DefaultCommentTag = "TRANSLATORS:"
+
+// Returns the keyword of |spec|, which is a name followed by the positions
+// of the message, the plural and the context, like "pgettext:1c,2". The
+// message is the first argument by default.
+func ParseKeyword(spec string) (Keyword, error) {
+	k := Keyword{Name: spec, Message: 1}
+	i := strings.IndexByte(spec, ':')
+	if i < 0 {
+		if spec == "" {
+			return k, fmt.Errorf("The keyword is empty.")
+		}
+		return k, nil
+	}
+	k.Name, k.Message = spec[:i], 0
+	if k.Name == "" {
+		return k, fmt.Errorf("The keyword '%s' has no name.", spec)
+	}
+
+	for _, arg := range strings.Split(spec[i+1:], ",") {
+		context := strings.HasSuffix(arg, "c")
+		n, err := strconv.Atoi(strings.TrimSuffix(arg, "c"))
+		switch {
+		case err != nil || n <= 0:
+			return k, fmt.Errorf("Invalid argument '%s' in the keyword '%s'.", arg, spec)
+		case context && k.Context == 0:
+			k.Context = n
+		case !context && k.Message == 0:
+			k.Message = n
+		case !context && k.Plural == 0:
+			k.Plural = n
+		default:
+			return k, fmt.Errorf("Too many arguments in the keyword '%s'.", spec)
+		}
+	}
+	if k.Message == 0 {
+		return k, fmt.Errorf("The keyword '%s' has no message argument.", spec)
+	}
+	return k, nil
+}
+
+// The place of a message in the source.
+type Reference struct {
+	Path string
+	Line uint32
+}
+
+// A message to translate.
+type Message struct {
+	// The context, which is empty if there is none.
+	Context string
+	ID      string
+	// The plural form, which is empty if there is none.
+	Plural string
+	// The comments for the translators.
+	Comments   []string
+	References []Reference
+}
+
+// A set of messages, in the order in which they are found.
+type Catalog struct {
+	keywords   map[string]Keyword
+	commentTag string
+	messages   []*Message
+	// The messages by their context and ID.
+	index map[[2]string]*Message
+}
+
+// Returns a new empty Catalog which collects the messages marked by
+// |keywords|, and the comments which begin with |commentTag| if it is not
+// empty.
+func NewCatalog(keywords []Keyword, commentTag string) *Catalog {
+	c := &Catalog{
+		keywords:   map[string]Keyword{},
+		commentTag: commentTag,
+		index:      map[[2]string]*Message{},
+	}
+	for _, k := range keywords {
+		c.keywords[k.Name] = k
+	}
+	return c
+}
+
+// Returns the messages of the catalog.
+func (c *Catalog) Messages() []*Message {
+	return c.messages
+}
+
+// A comment for the translators.
+type comment struct {
+	lines   []string
+	endLine uint32
+	// The index of the token of the code after the comment.
+	before int
+}
+
+// Returns the arguments of the call whose left parenthesis is |tokens[0]|,
+// or false if the call does not end.
+func arguments(tokens []*lex.Token) ([][]*lex.Token, bool) {
+	var args [][]*lex.Token
+	var arg []*lex.Token
+	depth := 0
+	for _, t := range tokens[1:] {
+		switch t.Kind {
+		case token_kind.LeftParen, token_kind.LeftBracket, token_kind.LeftBrace:
+			depth++
+		case token_kind.RightParen, token_kind.RightBracket, token_kind.RightBrace:
+			if depth == 0 {
+				return append(args, arg), true
+			}
+			depth--
+		case token_kind.Comma:
+			if depth == 0 {
+				args = append(args, arg)
+				arg = nil
+				continue
+			}
+		}
+		arg = append(arg, t)
+	}
+	return nil, false
+}
+
+// Returns the value of the argument |n| of |args|, or false if it is not
+// strings.
+func stringArgument(args [][]*lex.Token, n int) (string, bool) {
+	if n > len(args) || len(args[n-1]) == 0 {
+		return "", false
+	}
+	var b strings.Builder
+	for _, t := range args[n-1] {
+		if highlight.ClassOf(t.Kind) != highlight.String {
+			return "", false
+		}
+		s, _, ok := extract.TextOf(t)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(s)
+	}
+	return b.String(), true
+}
+
+// Adds the messages of the tokens |tokens| of the file |path|.
+func (c *Catalog) Add(path string, tokens []*lex.Token) {
+	// The tokens without the layout tokens and the comments.
+	var code []*lex.Token
+	var comments []comment
+	for _, t := range tokens {
+		if lex.IsLayout(t.Kind) {
+			continue
+		}
+		if highlight.ClassOf(t.Kind) != highlight.Comment {
+			code = append(code, t)
+			continue
+		}
+
+		text, _, _ := extract.TextOf(t)
+		text = strings.TrimSpace(text)
+		if c.commentTag == "" || !strings.HasPrefix(text, c.commentTag) {
+			continue
+		}
+		var lines []string
+		for _, line := range strings.Split(text, "\n") {
+			// The stars at the beginning of the lines of a C comment.
+			line = strings.TrimSpace(line)
+			line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		comments = append(comments, comment{lines, t.Line + uint32(strings.Count(t.Value, "\n")), len(code)})
+	}
+
+	// The comments before |next| are used or too far from the calls.
+	next := 0
+	for i, t := range code {
+		k, ok := c.keywords[t.Value]
+		if t.Kind != token_kind.Identifier || !ok || i+1 == len(code) || code[i+1].Kind != token_kind.LeftParen {
+			continue
+		}
+		args, ok := arguments(code[i+1:])
+		if !ok {
+			continue
+		}
+		var m Message
+		// The empty message is the header of a PO file.
+		if m.ID, ok = stringArgument(args, k.Message); !ok || m.ID == "" {
+			continue
+		}
+		if k.Plural > 0 {
+			if m.Plural, ok = stringArgument(args, k.Plural); !ok {
+				continue
+			}
+		}
+		if k.Context > 0 {
+			if m.Context, ok = stringArgument(args, k.Context); !ok {
+				continue
+			}
+		}
+		for ; next < len(comments) && comments[next].before <= i; next++ {
+			if comments[next].endLine+1 >= t.Line {
+				m.Comments = append(m.Comments, comments[next].lines...)
+			}
+		}
+		c.add(&m, Reference{path, args[k.Message-1][0].Line})
+	}
+}
+
+// Adds the message |m| found at |ref|, or its reference and comments to the
+// message with the same context and ID.
+func (c *Catalog) add(m *Message, ref Reference) {
+	key := [2]string{m.Context, m.ID}
+	if old, ok := c.index[key]; ok {
+		old.References = append(old.References, ref)
+		old.Comments = append(old.Comments, m.Comments...)
+		if old.Plural == "" {
+			old.Plural = m.Plural
+		}
+		return
+	}
+	m.References = []Reference{ref}
+	c.index[key] = m
+	c.messages = append(c.messages, m)
+}
+
+// Returns |s| quoted like in a PO file.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, "\\%03o", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Writes the field |name| with the value |s|. A value of several lines is
+// written as one string per line, after an empty string.
+func writeField(w *bufio.Writer, name, s string) {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= 1 {
+		fmt.Fprintf(w, "%s %s\n", name, quote(s))
+		return
+	}
+	fmt.Fprintf(w, "%s \"\"\n", name)
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s\n", quote(line))
+	}
+}
+
+// The width of the lines of references.
+const referencesWidth = 79
+
+// Writes |messages| to |w| as a .pot file, after a header.
+func WritePOT(w io.Writer, messages []*Message) error {
+	b := bufio.NewWriter(w)
+	plural := false
+	for _, m := range messages {
+		plural = plural || m.Plural != ""
+	}
+	b.WriteString("# SOME DESCRIPTIVE TITLE.\n#, fuzzy\nmsgid \"\"\nmsgstr \"\"\n")
+	b.WriteString("\"Project-Id-Version: PACKAGE VERSION\\n\"\n")
+	b.WriteString("\"MIME-Version: 1.0\\n\"\n")
+	b.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	b.WriteString("\"Content-Transfer-Encoding: 8bit\\n\"\n")
+	if plural {
+		b.WriteString("\"Plural-Forms: nplurals=INTEGER; plural=EXPRESSION;\\n\"\n")
+	}
+
+	for _, m := range messages {
+		b.WriteString("\n")
+		for _, c := range m.Comments {
+			fmt.Fprintf(b, "#. %s\n", c)
+		}
+		line := "#:"
+		for _, r := range m.References {
+			ref := fmt.Sprintf(" %s:%d", r.Path, r.Line)
+			if len(line) > 2 && len(line)+len(ref) > referencesWidth {
+				fmt.Fprintf(b, "%s\n", line)
+				line = "#:"
+			}
+			line += ref
+		}
+		fmt.Fprintf(b, "%s\n", line)
+		if m.Context != "" {
+			writeField(b, "msgctxt", m.Context)
+		}
+		writeField(b, "msgid", m.ID)
+		if m.Plural == "" {
+			b.WriteString("msgstr \"\"\n")
+			continue
+		}
+		writeField(b, "msgid_plural", m.Plural)
+		b.WriteString("msgstr[0] \"\"\nmsgstr[1] \"\"\n")
+	}
+	return b.Flush()
+}
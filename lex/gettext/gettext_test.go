@@ -0,0 +1,127 @@
+package gettext
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"uno/lex"
+)
+
+const source = `int main(int argc, char **argv) {
+  /* TRANSLATORS: The greeting,
+   * before the name. */
+  printf(_("Hello, \"%s\"!\n"), argv[1]);
+  puts(_(argv[2]));
+  puts(gettext("Multi-"
+               "line\ntext"));
+  // Not for the translators.
+  printf(ngettext("%d file", "%d files", argc), argc);
+  puts(pgettext("menu", "Open"));
+  // TRANSLATORS: Opens a file.
+  puts(N_("Open"));
+  puts(_("Hello, \"%s\"!\n"));
+  puts(_(""));
+}
+`
+
+const pot = `# SOME DESCRIPTIVE TITLE.
+#, fuzzy
+msgid ""
+msgstr ""
+"Project-Id-Version: PACKAGE VERSION\n"
+"MIME-Version: 1.0\n"
+"Content-Type: text/plain; charset=UTF-8\n"
+"Content-Transfer-Encoding: 8bit\n"
+"Plural-Forms: nplurals=INTEGER; plural=EXPRESSION;\n"
+
+#. TRANSLATORS: The greeting,
+#. before the name.
+#: main.c:4 main.c:13
+msgid "Hello, \"%s\"!\n"
+msgstr ""
+
+#: main.c:6
+msgid ""
+"Multi-line\n"
+"text"
+msgstr ""
+
+#: main.c:9
+msgid "%d file"
+msgid_plural "%d files"
+msgstr[0] ""
+msgstr[1] ""
+
+#: main.c:10
+msgctxt "menu"
+msgid "Open"
+msgstr ""
+
+#. TRANSLATORS: Opens a file.
+#: main.c:12
+msgid "Open"
+msgstr ""
+`
+
+func TestCatalog(t *testing.T) {
+	var keywords []Keyword
+	for _, spec := range DefaultKeywords {
+		k, err := ParseKeyword(spec)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		keywords = append(keywords, k)
+	}
+
+	tz, err := lex.CProfile.NewBytesTokenizer([]byte(source))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var tokens []*lex.Token
+	for tz.HasNext() {
+		tok, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		tokens = append(tokens, tok)
+	}
+
+	c := NewCatalog(keywords, DefaultCommentTag)
+	c.Add("main.c", tokens)
+	var out bytes.Buffer
+	if err := WritePOT(&out, c.Messages()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.String() != pot {
+		t.Errorf("Expected\n%s\nbut got\n%s", pot, out.String())
+	}
+}
+
+func TestParseKeyword(t *testing.T) {
+	tests := map[string]Keyword{
+		"_":                {"_", 1, 0, 0},
+		"tr:2":             {"tr", 2, 0, 0},
+		"npgettext:1c,2,3": {"npgettext", 2, 3, 1},
+	}
+	for spec, expected := range tests {
+		if k, err := ParseKeyword(spec); err != nil || k != expected {
+			t.Errorf("Expected the keyword %v for %q, but got %v and %v.", expected, spec, k, err)
+		}
+	}
+
+	errors := map[string]string{
+		"":        "The keyword is empty.",
+		":1":      "The keyword ':1' has no name.",
+		"f:x":     "Invalid argument 'x' in the keyword 'f:x'.",
+		"f:1c":    "The keyword 'f:1c' has no message argument.",
+		"f:1,2,3": "Too many arguments in the keyword 'f:1,2,3'.",
+	}
+	for spec, expected := range errors {
+		if _, err := ParseKeyword(spec); err == nil || err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, but got %v.", expected, spec, err)
+		}
+	}
+}
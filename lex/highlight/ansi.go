@@ -0,0 +1,68 @@
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Writes the text with the 24-bit color escape sequences of ANSI
+// terminals. The classes without a style of the theme keep the colors of
+// the terminal.
+type ansiRenderer struct {
+	w *bufio.Writer
+	o *Options
+	// The escape sequence of each class, or "" if it has no style.
+	escapes [numClasses]string
+}
+
+func (r *ansiRenderer) begin(lines [][]Span) error {
+	for c := Class(0); c < numClasses; c++ {
+		s, ok := r.o.Theme.Styles[c]
+		if !ok {
+			continue
+		}
+
+		var codes []string
+		if s.Bold {
+			codes = append(codes, "1")
+		}
+		if s.Italic {
+			codes = append(codes, "3")
+		}
+		if s.Color != "" {
+			red, green, blue, err := rgb(s.Color)
+			if err != nil {
+				return err
+			}
+			codes = append(codes, fmt.Sprintf("38;2;%d;%d;%d", red, green, blue))
+		}
+		if len(codes) > 0 {
+			r.escapes[c] = "\x1b[" + strings.Join(codes, ";") + "m"
+		}
+	}
+	return nil
+}
+
+func (r *ansiRenderer) beginLine(n int) error {
+	return nil
+}
+
+func (r *ansiRenderer) span(c Class, s string) error {
+	var err error
+	if e := r.escapes[c]; e != "" {
+		_, err = r.w.WriteString(e + s + "\x1b[0m")
+	} else {
+		_, err = r.w.WriteString(s)
+	}
+	return err
+}
+
+func (r *ansiRenderer) endLine(nl string) error {
+	_, err := r.w.WriteString(nl)
+	return err
+}
+
+func (r *ansiRenderer) end() error {
+	return nil
+}
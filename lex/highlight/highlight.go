@@ -0,0 +1,134 @@
+// Package highlight renders source text highlighted by the kinds of its
+// tokens as HTML, ANSI terminal colors, SVG or LaTeX.
+package highlight
+
+import (
+	"fmt"
+	"uno/lex"
+	"uno/lex/token_kind"
+)
+
+// The highlight class of a token.
+type Class uint32
+
+const (
+	// The text between tokens, and the tokens without a class.
+	Plain = Class(iota)
+	Keyword
+	Identifier
+	String
+	Number
+	Comment
+	Operator
+	Punctuation
+	Preprocessor
+	Decorator
+	Invalid
+	numClasses
+)
+
+var classNames = [numClasses]string{
+	Plain:        "plain",
+	Keyword:      "keyword",
+	Identifier:   "identifier",
+	String:       "string",
+	Number:       "number",
+	Comment:      "comment",
+	Operator:     "operator",
+	Punctuation:  "punctuation",
+	Preprocessor: "preprocessor",
+	Decorator:    "decorator",
+	Invalid:      "invalid",
+}
+
+// Returns the name of the class, like "keyword". It is also the CSS class
+// of the HTML output.
+func (c Class) String() string {
+	if c < numClasses {
+		return classNames[c]
+	}
+	return fmt.Sprintf("Class(%d)", uint32(c))
+}
+
+// Returns the class named |name|, like "keyword".
+func ParseClass(name string) (Class, error) {
+	for c, n := range classNames {
+		if n == name {
+			return Class(c), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown class '%s'.", name)
+}
+
+// Returns the class of the token kind |kind|.
+func ClassOf(kind uint32) Class {
+	switch {
+	case kind >= token_kind.KeywordAnd && kind <= token_kind.KeywordYield:
+		return Keyword
+	case kind >= token_kind.Add && kind <= token_kind.MulPower:
+		switch kind {
+		case token_kind.Comma, token_kind.Semicolon, token_kind.Colon, token_kind.Dot,
+			token_kind.LeftParen, token_kind.RightParen, token_kind.LeftBracket,
+			token_kind.RightBracket, token_kind.LeftBrace, token_kind.RightBrace:
+			return Punctuation
+		}
+		return Operator
+	}
+
+	switch kind {
+	case token_kind.Identifier:
+		return Identifier
+	case token_kind.DoubleQuoteString, token_kind.SingleQuoteString, token_kind.BackQuoteString,
+		token_kind.PyMultilineString, token_kind.SingleQuoteCharacter:
+		return String
+	case token_kind.DecimalInteger, token_kind.HexInteger, token_kind.OctInteger, token_kind.FloatNumber:
+		return Number
+	case token_kind.CSingleLineComment, token_kind.CMultiLineComment, token_kind.PySingleLineComment:
+		return Comment
+	case token_kind.CPPDirective, token_kind.CPPStringify, token_kind.CPPTokenPaste:
+		return Preprocessor
+	case token_kind.QuestionMark:
+		return Operator
+	case token_kind.PythonDecorator:
+		return Decorator
+	case token_kind.Invalid:
+		return Invalid
+	}
+	return Plain
+}
+
+// A span of text with a class.
+type Span struct {
+	Class Class
+	Text  string
+}
+
+// Returns the spans of the tokens read by |tz| from |text|, and of the
+// text between them. The texts of the spans add up to |text|. If lexing
+// fails, the rest of the text is returned as a Plain span along with the
+// error. |tz| must read |text|, like the Tokenizer of NewBytesTokenizer.
+func Spans(tz *lex.Tokenizer, text []byte) ([]Span, error) {
+	var spans []Span
+	add := func(c Class, s []byte) {
+		if len(s) == 0 {
+			return
+		}
+		// Merge the spans of a class, like the white space and the Plain
+		// tokens.
+		if n := len(spans); n > 0 && spans[n-1].Class == c {
+			spans[n-1].Text += string(s)
+			return
+		}
+		spans = append(spans, Span{c, string(s)})
+	}
+
+	var end uint32
+	refs, err := lex.ReadRefs(tz)
+	for _, t := range refs {
+		add(Plain, text[end:t.Start])
+		add(ClassOf(t.Kind), text[t.Start:t.End])
+		end = t.End
+	}
+	add(Plain, text[end:])
+	return spans, err
+}
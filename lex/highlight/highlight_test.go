@@ -0,0 +1,193 @@
+package highlight
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func sampleSpans(t *testing.T) ([]byte, []Span) {
+	text, err := ioutil.ReadFile("test_data/sample.py")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz, err := lex.PythonProfile.NewBytesTokenizer(text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	spans, err := Spans(tz, text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return text, spans
+}
+
+func TestSpans(t *testing.T) {
+	text, spans := sampleSpans(t)
+
+	var b strings.Builder
+	classes := map[string]Class{}
+	for _, sp := range spans {
+		b.WriteString(sp.Text)
+		classes[sp.Text] = sp.Class
+	}
+	if b.String() != string(text) {
+		t.Errorf("Expected the spans to add up to the text, but got %q.", b.String())
+	}
+
+	expected := map[string]Class{
+		"# A comment with <html> & \"quotes\"": Comment,
+		"@decorator":                           Decorator,
+		"def":                                  Keyword,
+		"f":                                    Identifier,
+		"(":                                    Punctuation,
+		"+":                                    Operator,
+		"0x1F":                                 Number,
+		"\"\"\"multi\nline\"\"\"":              String,
+	}
+	for s, c := range expected {
+		if classes[s] != c {
+			t.Errorf("Expected the class %s for %q, but got %s.", c, s, classes[s])
+		}
+	}
+}
+
+func TestSpansError(t *testing.T) {
+	text := []byte("x = 1 $ y\n")
+	tz, err := lex.PythonProfile.NewBytesTokenizer(text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	spans, err := Spans(tz, text)
+	if err == nil {
+		t.Errorf("Expected an error for '$'.")
+	}
+	last := spans[len(spans)-1]
+	if last.Class != Plain || !strings.HasSuffix(last.Text, "$ y\n") {
+		t.Errorf("Expected the rest of the text in a Plain span, but got %v.", last)
+	}
+}
+
+func render(t *testing.T, spans []Span, f Format, o *Options) string {
+	var b bytes.Buffer
+	if err := Render(&b, spans, f, o); err != nil {
+		t.Fatal(err.Error())
+	}
+	return b.String()
+}
+
+func TestHTML(t *testing.T) {
+	text, spans := sampleSpans(t)
+	out := render(t, spans, HTML, nil)
+
+	if !strings.Contains(out, `<span class="line" id="L3"><span class="keyword">def</span> `) {
+		t.Errorf("Expected a line anchor and a keyword span in\n%s", out)
+	}
+	if !strings.Contains(out, `&lt;html&gt; &amp;`) {
+		t.Errorf("Expected the text to be escaped in\n%s", out)
+	}
+	tags := regexp.MustCompile(`<[^>]*>`)
+	if s := html.UnescapeString(tags.ReplaceAllString(out, "")); s != string(text)+"\n" {
+		t.Errorf("Expected the text of the HTML to be the input, but got %q.", s)
+	}
+
+	out = render(t, spans, HTML, &Options{Theme: DarkTheme, Standalone: true, Title: "a<b"})
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.Contains(out, "<title>a&lt;b</title>") ||
+		!strings.Contains(out, "pre.uno { background: #1e1e1e;") {
+		t.Errorf("Unexpected standalone document\n%s", out)
+	}
+}
+
+func TestANSI(t *testing.T) {
+	text, spans := sampleSpans(t)
+	out := render(t, spans, ANSI, nil)
+
+	if !strings.Contains(out, "\x1b[1;38;2;215;58;73mdef\x1b[0m") {
+		t.Errorf("Expected a bold colored keyword in %q.", out)
+	}
+	escapes := regexp.MustCompile("\x1b\\[[0-9;]*m")
+	if s := escapes.ReplaceAllString(out, ""); s != string(text) {
+		t.Errorf("Expected the text without the escapes to be the input, but got %q.", s)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	text, spans := sampleSpans(t)
+	out := render(t, spans, SVG, &Options{Theme: DarkTheme})
+
+	// The output is well formed and its text is the input.
+	var s strings.Builder
+	d := xml.NewDecoder(strings.NewReader(out))
+	lines := 0
+	inText := false
+	for true {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch e := tok.(type) {
+		case xml.CharData:
+			if inText {
+				s.Write(e)
+			}
+		case xml.StartElement:
+			if e.Name.Local == "text" {
+				inText = true
+				lines++
+			}
+		case xml.EndElement:
+			if e.Name.Local == "text" {
+				inText = false
+			}
+		}
+	}
+	// The XML parser normalizes "\r\n" to "\n".
+	expected := strings.Replace(string(text), "\r\n", "\n", -1)
+	if got := s.String(); got != expected {
+		t.Errorf("Expected the text of the SVG to be the input, but got %q.", got)
+	}
+	if lines != 7 {
+		t.Errorf("Expected 7 lines, but got %d.", lines)
+	}
+	if !strings.Contains(out, `<tspan fill="#569cd6" font-weight="bold">def</tspan>`) {
+		t.Errorf("Expected a styled keyword in\n%s", out)
+	}
+}
+
+func TestLaTeX(t *testing.T) {
+	_, spans := sampleSpans(t)
+	out := render(t, spans, LaTeX, &Options{Standalone: true})
+
+	expected := "\\unoPlain{\t}\\unoKeyword{return}\\unoPlain{ }\\unoIdentifier{a}\\unoPlain{ }" +
+		"\\unoOperator{+}\\unoPlain{ }\\unoNumber{0x1F}\\unoPlain{  }" +
+		"\\unoComment{# \\unoZbs{}\\unoZbs{} \\unoZob{}x\\unoZcb{}}\r\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("Expected the line %q in\n%s", expected, out)
+	}
+	if !strings.Contains(out, "\\newcommand{\\unoKeyword}[1]{\\textcolor[HTML]{D73A49}{\\textbf{#1}}}") ||
+		!strings.HasSuffix(out, "\\end{Verbatim}\n\\end{document}\n") {
+		t.Errorf("Unexpected standalone document\n%s", out)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range []Format{HTML, ANSI, SVG, LaTeX} {
+		if p, err := ParseFormat(f.String()); err != nil || p != f {
+			t.Errorf("Expected to parse the format %s.", f)
+		}
+	}
+	if _, err := ParseFormat("rtf"); err == nil {
+		t.Errorf("Expected an error for an unknown format.")
+	}
+	if c, err := ParseClass("comment"); err != nil || c != Comment {
+		t.Errorf("Expected to parse the class comment.")
+	}
+	if _, err := ThemeByName("dark"); err != nil {
+		t.Error(err.Error())
+	}
+}
@@ -0,0 +1,77 @@
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Returns the CSS style sheet of the theme |t| for the HTML output.
+func CSS(t *Theme) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pre.uno { background: %s; color: %s; }\n", t.Background, t.Foreground)
+	for c := Class(0); c < numClasses; c++ {
+		s, ok := t.Styles[c]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "pre.uno .%s {", c)
+		if s.Color != "" {
+			fmt.Fprintf(&b, " color: %s;", s.Color)
+		}
+		if s.Bold {
+			fmt.Fprintf(&b, " font-weight: bold;")
+		}
+		if s.Italic {
+			fmt.Fprintf(&b, " font-style: italic;")
+		}
+		fmt.Fprintf(&b, " }\n")
+	}
+	return b.String()
+}
+
+// Writes a <pre> element with a <span> of id "L<n>" for each line n, and
+// a <span> with the class of each span which is not Plain.
+type htmlRenderer struct {
+	w *bufio.Writer
+	o *Options
+}
+
+func (r *htmlRenderer) begin(lines [][]Span) error {
+	if r.o.Standalone {
+		fmt.Fprintf(r.w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+		fmt.Fprintf(r.w, "<title>%s</title>\n", html.EscapeString(r.o.Title))
+		fmt.Fprintf(r.w, "<style>\n%s</style>\n</head>\n<body>\n", CSS(r.o.Theme))
+	}
+	_, err := r.w.WriteString("<pre class=\"uno\"><code>")
+	return err
+}
+
+func (r *htmlRenderer) beginLine(n int) error {
+	_, err := fmt.Fprintf(r.w, "<span class=\"line\" id=\"L%d\">", n)
+	return err
+}
+
+func (r *htmlRenderer) span(c Class, s string) error {
+	var err error
+	if c == Plain {
+		_, err = r.w.WriteString(html.EscapeString(s))
+	} else {
+		_, err = fmt.Fprintf(r.w, "<span class=\"%s\">%s</span>", c, html.EscapeString(s))
+	}
+	return err
+}
+
+func (r *htmlRenderer) endLine(nl string) error {
+	_, err := r.w.WriteString("</span>" + html.EscapeString(nl))
+	return err
+}
+
+func (r *htmlRenderer) end() error {
+	_, err := r.w.WriteString("</code></pre>\n")
+	if err == nil && r.o.Standalone {
+		_, err = r.w.WriteString("</body>\n</html>\n")
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Returns the name of the LaTeX macro of the class |c|, like "unoKeyword".
+func latexMacro(c Class) string {
+	n := c.String()
+	return "uno" + strings.ToUpper(n[:1]) + n[1:]
+}
+
+// Returns the LaTeX definitions of the theme |t| for the LaTeX output. They
+// need the fancyvrb and xcolor packages.
+func LaTeXStyles(t *Theme) string {
+	var b strings.Builder
+	b.WriteString("\\newcommand{\\unoZbs}{\\char`\\\\}\n")
+	b.WriteString("\\newcommand{\\unoZob}{\\char`\\{}\n")
+	b.WriteString("\\newcommand{\\unoZcb}{\\char`\\}}\n")
+	for c := Class(0); c < numClasses; c++ {
+		s := t.Style(c)
+		body := "#1"
+		if s.Bold {
+			body = "\\textbf{" + body + "}"
+		}
+		if s.Italic {
+			body = "\\textit{" + body + "}"
+		}
+		if s.Color != "" {
+			body = fmt.Sprintf("\\textcolor[HTML]{%s}{%s}", strings.ToUpper(s.Color[1:]), body)
+		}
+		fmt.Fprintf(&b, "\\newcommand{\\%s}[1]{%s}\n", latexMacro(c), body)
+	}
+	return b.String()
+}
+
+// Returns |s| with the command characters of the Verbatim environment
+// replaced by the macros which print them.
+func escapeLaTeX(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString("\\unoZbs{}")
+		case '{':
+			b.WriteString("\\unoZob{}")
+		case '}':
+			b.WriteString("\\unoZcb{}")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Writes a Verbatim environment of fancyvrb in which each span is an
+// argument of the macro of its class.
+type latexRenderer struct {
+	w *bufio.Writer
+	o *Options
+}
+
+func (r *latexRenderer) begin(lines [][]Span) error {
+	if r.o.Standalone {
+		r.w.WriteString("\\documentclass{article}\n\\usepackage{fancyvrb}\n\\usepackage{xcolor}\n")
+		r.w.WriteString(LaTeXStyles(r.o.Theme))
+		if r.o.Title != "" {
+			fmt.Fprintf(r.w, "\\title{%s}\n\\date{}\n", escapeLaTeXText(r.o.Title))
+		}
+		fmt.Fprintf(r.w, "\\pagecolor[HTML]{%s}\n", strings.ToUpper(r.o.Theme.Background[1:]))
+		r.w.WriteString("\\begin{document}\n")
+		if r.o.Title != "" {
+			r.w.WriteString("\\maketitle\n")
+		}
+	}
+	_, err := r.w.WriteString("\\begin{Verbatim}[commandchars=\\\\\\{\\},obeytabs]\n")
+	return err
+}
+
+func (r *latexRenderer) beginLine(n int) error {
+	return nil
+}
+
+func (r *latexRenderer) span(c Class, s string) error {
+	_, err := fmt.Fprintf(r.w, "\\%s{%s}", latexMacro(c), escapeLaTeX(s))
+	return err
+}
+
+// The Verbatim environment ends with a new line, so the last line ends
+// with one even if the text does not.
+func (r *latexRenderer) endLine(nl string) error {
+	if nl == "" {
+		nl = "\n"
+	}
+	_, err := r.w.WriteString(nl)
+	return err
+}
+
+func (r *latexRenderer) end() error {
+	_, err := r.w.WriteString("\\end{Verbatim}\n")
+	if err == nil && r.o.Standalone {
+		_, err = r.w.WriteString("\\end{document}\n")
+	}
+	return err
+}
+
+// Returns |s| escaped for the text of a LaTeX document.
+func escapeLaTeXText(s string) string {
+	r := strings.NewReplacer(
+		"\\", "\\textbackslash{}", "{", "\\{", "}", "\\}", "$", "\\$", "&", "\\&",
+		"#", "\\#", "^", "\\^{}", "_", "\\_", "~", "\\~{}", "%", "\\%")
+	return r.Replace(s)
+}
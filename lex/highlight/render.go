@@ -0,0 +1,153 @@
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An output format.
+type Format uint32
+
+const (
+	HTML = Format(iota)
+	ANSI
+	SVG
+	LaTeX
+)
+
+var formatNames = map[Format]string{
+	HTML:  "html",
+	ANSI:  "ansi",
+	SVG:   "svg",
+	LaTeX: "latex",
+}
+
+func (f Format) String() string {
+	if n, ok := formatNames[f]; ok {
+		return n
+	}
+	return fmt.Sprintf("Format(%d)", uint32(f))
+}
+
+// Returns the format named |name|, like "html".
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown format '%s'.", name)
+}
+
+// The options of Render.
+type Options struct {
+	// The theme of the colors. The LightTheme is used if it is nil.
+	Theme *Theme
+	// If true, the output is a whole document, like an HTML page with the
+	// style sheet, instead of a fragment to include in a document. SVG
+	// and ANSI output are always whole.
+	Standalone bool
+	// The title of a standalone HTML or LaTeX document.
+	Title string
+}
+
+// Renders the text of the lines of the spans. A line is started for each
+// line of the text, even if it is empty, and spans do not cross lines.
+type renderer interface {
+	begin(lines [][]Span) error
+	// Begins the line |n|, counting from 1.
+	beginLine(n int) error
+	span(c Class, s string) error
+	// Ends the current line. |nl| is the new line at its end, which is
+	// empty for the last line.
+	endLine(nl string) error
+	end() error
+}
+
+// Returns the spans split at the new lines, as the spans of each line and
+// the new line at the end of each line.
+func splitLines(spans []Span) ([][]Span, []string) {
+	lines := [][]Span{nil}
+	var nls []string
+	for _, sp := range spans {
+		s := sp.Text
+		for true {
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				break
+			}
+			// Keep a carriage return before the new line with it.
+			j := i
+			if j > 0 && s[j-1] == '\r' {
+				j--
+			}
+			if j > 0 {
+				lines[len(lines)-1] = append(lines[len(lines)-1], Span{sp.Class, s[:j]})
+			}
+			nls = append(nls, s[j:i+1])
+			lines = append(lines, nil)
+			s = s[i+1:]
+		}
+		if s != "" {
+			lines[len(lines)-1] = append(lines[len(lines)-1], Span{sp.Class, s})
+		}
+	}
+	nls = append(nls, "")
+
+	// A new line at the end of the text does not begin another line.
+	if n := len(lines); n > 1 && len(lines[n-1]) == 0 {
+		lines = lines[:n-1]
+		nls = nls[:n-1]
+	}
+	return lines, nls
+}
+
+// Writes the spans to |w| in the format |f|.
+func Render(w io.Writer, spans []Span, f Format, o *Options) error {
+	if o == nil {
+		o = &Options{}
+	}
+	opts := *o
+	if opts.Theme == nil {
+		opts.Theme = LightTheme
+	}
+
+	bw := bufio.NewWriter(w)
+	var r renderer
+	switch f {
+	case HTML:
+		r = &htmlRenderer{w: bw, o: &opts}
+	case ANSI:
+		r = &ansiRenderer{w: bw, o: &opts}
+	case SVG:
+		r = &svgRenderer{w: bw, o: &opts}
+	case LaTeX:
+		r = &latexRenderer{w: bw, o: &opts}
+	default:
+		return fmt.Errorf("Unknown format %d.", uint32(f))
+	}
+
+	lines, nls := splitLines(spans)
+	if err := r.begin(lines); err != nil {
+		return err
+	}
+	for i, line := range lines {
+		if err := r.beginLine(i + 1); err != nil {
+			return err
+		}
+		for _, sp := range line {
+			if err := r.span(sp.Class, sp.Text); err != nil {
+				return err
+			}
+		}
+		if err := r.endLine(nls[i]); err != nil {
+			return err
+		}
+	}
+	if err := r.end(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
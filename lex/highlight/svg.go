@@ -0,0 +1,118 @@
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// The metrics of the SVG output, in pixels.
+const (
+	svgFontSize   = 14
+	svgCharWidth  = 8.4
+	svgLineHeight = 18
+	svgPadding    = 8
+	svgTabWidth   = 8
+)
+
+// Returns |s| escaped for the text of an XML document. The characters
+// which XML does not allow, like most control characters, are replaced
+// by U+FFFD.
+func escapeXML(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '&':
+			b.WriteString("&amp;")
+		case c == '<':
+			b.WriteString("&lt;")
+		case c == '>':
+			b.WriteString("&gt;")
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r', c == 0xFFFE, c == 0xFFFF:
+			b.WriteRune(utf8.RuneError)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Writes an SVG image with a <text> element for each line.
+type svgRenderer struct {
+	w *bufio.Writer
+	o *Options
+}
+
+// Returns the width of |line| in characters, with tabs to the next tab
+// stop.
+func lineWidth(line []Span) int {
+	n := 0
+	for _, sp := range line {
+		for _, c := range sp.Text {
+			if c == '\t' {
+				n += svgTabWidth - n%svgTabWidth
+			} else {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (r *svgRenderer) begin(lines [][]Span) error {
+	cols := 0
+	for _, l := range lines {
+		if n := lineWidth(l); n > cols {
+			cols = n
+		}
+	}
+	width := int(float64(cols)*svgCharWidth) + 2*svgPadding
+	height := len(lines)*svgLineHeight + 2*svgPadding
+
+	fmt.Fprintf(r.w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\""+
+		" font-family=\"monospace\" font-size=\"%d\">\n", width, height, width, height, svgFontSize)
+	_, err := fmt.Fprintf(r.w, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", r.o.Theme.Background)
+	return err
+}
+
+func (r *svgRenderer) beginLine(n int) error {
+	y := svgPadding + n*svgLineHeight - (svgLineHeight-svgFontSize)/2 - 2
+	_, err := fmt.Fprintf(r.w, "<text x=\"%d\" y=\"%d\" fill=\"%s\" xml:space=\"preserve\""+
+		" style=\"white-space:pre;tab-size:%d\">", svgPadding, y, r.o.Theme.Foreground, svgTabWidth)
+	return err
+}
+
+func (r *svgRenderer) span(c Class, s string) error {
+	s = escapeXML(s)
+	st, ok := r.o.Theme.Styles[c]
+	if c == Plain || !ok {
+		_, err := r.w.WriteString(s)
+		return err
+	}
+
+	fmt.Fprintf(r.w, "<tspan")
+	if st.Color != "" {
+		fmt.Fprintf(r.w, " fill=\"%s\"", st.Color)
+	}
+	if st.Bold {
+		fmt.Fprintf(r.w, " font-weight=\"bold\"")
+	}
+	if st.Italic {
+		fmt.Fprintf(r.w, " font-style=\"italic\"")
+	}
+	_, err := fmt.Fprintf(r.w, ">%s</tspan>", s)
+	return err
+}
+
+// The new line is kept in the <text> element so that the text of the
+// image is the text of the input.
+func (r *svgRenderer) endLine(nl string) error {
+	_, err := r.w.WriteString(escapeXML(nl) + "</text>")
+	return err
+}
+
+func (r *svgRenderer) end() error {
+	_, err := r.w.WriteString("\n</svg>\n")
+	return err
+}
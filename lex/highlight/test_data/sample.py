@@ -0,0 +1,7 @@
+# A comment with <html> & "quotes"
+@decorator
+def f(a, b):
+	return a + 0x1F  # \\ {x}
+
+s = """multi
+line"""
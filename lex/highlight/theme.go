@@ -0,0 +1,89 @@
+package highlight
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The style of a class. The colors are like "#1a2b3c", and an empty color
+// is the foreground color of the theme.
+type Style struct {
+	Color  string
+	Bold   bool
+	Italic bool
+}
+
+// A set of styles for the classes.
+type Theme struct {
+	Name       string
+	Background string
+	Foreground string
+	Styles     map[Class]Style
+}
+
+// Returns the style of the class |c|.
+func (t *Theme) Style(c Class) Style {
+	s := t.Styles[c]
+	if s.Color == "" {
+		s.Color = t.Foreground
+	}
+	return s
+}
+
+var LightTheme = &Theme{
+	Name:       "light",
+	Background: "#ffffff",
+	Foreground: "#24292e",
+	Styles: map[Class]Style{
+		Keyword:      {Color: "#d73a49", Bold: true},
+		String:       {Color: "#032f62"},
+		Number:       {Color: "#005cc5"},
+		Comment:      {Color: "#6a737d", Italic: true},
+		Operator:     {Color: "#d73a49"},
+		Preprocessor: {Color: "#6f42c1"},
+		Decorator:    {Color: "#6f42c1"},
+		Invalid:      {Color: "#b31d28", Bold: true},
+	},
+}
+
+var DarkTheme = &Theme{
+	Name:       "dark",
+	Background: "#1e1e1e",
+	Foreground: "#d4d4d4",
+	Styles: map[Class]Style{
+		Keyword:      {Color: "#569cd6", Bold: true},
+		String:       {Color: "#ce9178"},
+		Number:       {Color: "#b5cea8"},
+		Comment:      {Color: "#6a9955", Italic: true},
+		Operator:     {Color: "#d4d4d4"},
+		Preprocessor: {Color: "#c586c0"},
+		Decorator:    {Color: "#dcdcaa"},
+		Invalid:      {Color: "#f44747", Bold: true},
+	},
+}
+
+// The predefined themes.
+var Themes = []*Theme{LightTheme, DarkTheme}
+
+// Returns the predefined theme named |name|.
+func ThemeByName(name string) (*Theme, error) {
+	for _, t := range Themes {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown theme '%s'.", name)
+}
+
+// Returns the red, green and blue components of the color |c|, which is
+// like "#1a2b3c".
+func rgb(c string) (uint8, uint8, uint8, error) {
+	if len(c) != 7 || c[0] != '#' {
+		return 0, 0, 0, fmt.Errorf("Invalid color '%s'.", c)
+	}
+	v, err := strconv.ParseUint(c[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Invalid color '%s'.", c)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
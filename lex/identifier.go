@@ -2,7 +2,9 @@ package lex
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 	"uno/lex/char"
 	"uno/lex/token_kind"
 )
@@ -45,12 +47,91 @@ var KeywordMap = map[string]uint32{
 	"yield":    token_kind.KeywordYield,
 }
 
-func isIdentifierBeginChar(c rune) bool {
-	return c == char.Underscore || unicode.IsLetter(rune(c))
+// The rules for the characters of identifiers. Identifiers follow the
+// default identifier syntax of UAX #31: they begin with a XID_Start
+// character or '_' and continue with XID_Continue characters. The zero
+// value is the rules of C, Go and Python.
+type IdentifierRules struct {
+	// The characters which can begin and continue an identifier besides
+	// the UAX #31 ones, like "$" for JavaScript.
+	ExtraStart string
+	// The characters which can continue an identifier besides the UAX #31
+	// ones, like "-" for CSS.
+	ExtraContinue string
+	// The normalization of the values of identifiers.
+	Normalization Normalization
 }
 
-func isIdentifierContinuationChar(c rune) bool {
-	return isIdentifierBeginChar(c) || unicode.IsNumber(rune(c))
+// The characters of ID_Start which are not in XID_Start, because they do
+// not keep the property under NFKC normalization.
+var notXIDStart = map[rune]bool{
+	0x037A: true, 0x0E33: true, 0x0EB3: true, 0x309B: true, 0x309C: true,
+	0xFC5E: true, 0xFC5F: true, 0xFC60: true, 0xFC61: true, 0xFC62: true,
+	0xFC63: true, 0xFDFA: true, 0xFDFB: true, 0xFE70: true, 0xFE72: true,
+	0xFE74: true, 0xFE76: true, 0xFE78: true, 0xFE7A: true, 0xFE7C: true,
+	0xFE7E: true, 0xFF9E: true, 0xFF9F: true,
+}
+
+// The characters of ID_Continue which are not in XID_Continue.
+var notXIDContinue = map[rune]bool{
+	0x037A: true, 0x309B: true, 0x309C: true, 0xFC5E: true, 0xFC5F: true,
+	0xFC60: true, 0xFC61: true, 0xFC62: true, 0xFC63: true, 0xFDFA: true,
+	0xFDFB: true, 0xFE70: true, 0xFE72: true, 0xFE74: true, 0xFE76: true,
+	0xFE78: true, 0xFE7A: true, 0xFE7C: true, 0xFE7E: true,
+}
+
+func isASCIILetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Returns true if |c| has the XID_Start property of UAX #31.
+func IsXIDStart(c rune) bool {
+	if c < utf8.RuneSelf {
+		return isASCIILetter(c)
+	}
+	if !unicode.In(c, unicode.L, unicode.Nl, unicode.Other_ID_Start) {
+		return false
+	}
+	return !unicode.In(c, unicode.Pattern_Syntax, unicode.Pattern_White_Space) && !notXIDStart[c]
+}
+
+// Returns true if |c| has the XID_Continue property of UAX #31.
+func IsXIDContinue(c rune) bool {
+	if c < utf8.RuneSelf {
+		return isASCIILetter(c) || isDecimalDigit(c) || c == char.Underscore
+	}
+	if !unicode.In(c, unicode.L, unicode.Nl, unicode.Other_ID_Start,
+		unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) {
+		return false
+	}
+	return !unicode.In(c, unicode.Pattern_Syntax, unicode.Pattern_White_Space) && !notXIDContinue[c]
+}
+
+// Returns true if |c| can begin an identifier under the rules |r|.
+func (r *IdentifierRules) isStart(c rune) bool {
+	return c == char.Underscore || IsXIDStart(c) ||
+		(r.ExtraStart != "" && strings.ContainsRune(r.ExtraStart, c))
+}
+
+// Returns true if |c| can continue an identifier under the rules |r|.
+func (r *IdentifierRules) isContinue(c rune) bool {
+	return IsXIDContinue(c) ||
+		(r.ExtraStart != "" && strings.ContainsRune(r.ExtraStart, c)) ||
+		(r.ExtraContinue != "" && strings.ContainsRune(r.ExtraContinue, c))
+}
+
+// Sets the rules for the characters of identifiers. It should be called
+// before reading any token.
+func (tz *Tokenizer) SetIdentifierRules(r IdentifierRules) {
+	tz.idRules = r
+}
+
+func (tz *Tokenizer) isIdentifierBeginChar(c rune) bool {
+	return tz.idRules.isStart(c)
+}
+
+func (tz *Tokenizer) isIdentifierContinuationChar(c rune) bool {
+	return tz.idRules.isContinue(c)
 }
 
 func (tz *Tokenizer) readIdentifierString() ([]rune, error) {
@@ -58,7 +139,7 @@ func (tz *Tokenizer) readIdentifierString() ([]rune, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error reading identifier.\n%s", err.Error())
 	}
-	if !isIdentifierBeginChar(c) {
+	if !tz.isIdentifierBeginChar(c) {
 		return nil, fmt.Errorf("Invalid identifier begin character '%c'.", c)
 	}
 
@@ -67,7 +148,7 @@ func (tz *Tokenizer) readIdentifierString() ([]rune, error) {
 		return nil, fmt.Errorf("Error reading identifier.\n%s", err.Error())
 	}
 
-	var id []rune
+	id := tz.runes[:0]
 	id = append(id, c)
 
 	for true {
@@ -75,7 +156,7 @@ func (tz *Tokenizer) readIdentifierString() ([]rune, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Error reading identifier.\n%s", err.Error())
 		}
-		if !isIdentifierContinuationChar(c) {
+		if !tz.isIdentifierContinuationChar(c) {
 			break
 		}
 
@@ -98,11 +179,13 @@ func (tz *Tokenizer) readIdentifier() (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	// The keywords are matched after normalization, like Python does.
+	id = tz.idRules.Normalization.NormalizeRunes(id)
 
 	tt, e := KeywordMap[string(id)]
 	if e && tz.ts.Contains(tt) {
-		return newToken(tt, id, tz.r.Line(), col), nil
+		return tz.makeToken(tt, id, tz.r.Line(), col), nil
 	} else {
-		return newToken(token_kind.Identifier, id, tz.r.Line(), col), nil
+		return tz.makeToken(token_kind.Identifier, id, tz.r.Line(), col), nil
 	}
 }
@@ -1,6 +1,7 @@
 package lex
 
 import (
+	"strings"
 	"testing"
 	"uno/lex/token_kind"
 )
@@ -28,3 +29,89 @@ func TestIdentifierTokens(t *testing.T) {
 		t.Errorf(err.Error())
 	}
 }
+
+func TestXIDProperties(t *testing.T) {
+	cases := []struct {
+		c                rune
+		start, continue_ bool
+	}{
+		{'a', true, true},
+		{'7', false, true},
+		{'_', false, true},
+		{'$', false, false},
+		{'क', true, true},       // DEVANAGARI LETTER KA
+		{'\u094d', false, true}, // DEVANAGARI SIGN VIRAMA, a combining mark
+		{'\u0301', false, true}, // COMBINING ACUTE ACCENT
+		{'‿', false, true},      // UNDERTIE, a connector punctuation
+		{'ⅰ', true, true},       // SMALL ROMAN NUMERAL ONE, a letter number
+		{'²', false, false},
+		{'½', false, false},
+		{'℘', true, true},   // SCRIPT CAPITAL P, an Other_ID_Start
+		{'ⸯ', false, false}, // VERTICAL TILDE, a Pattern_Syntax
+		{'゛', false, false}, // not kept by NFKC
+	}
+	for _, c := range cases {
+		if IsXIDStart(c.c) != c.start || IsXIDContinue(c.c) != c.continue_ {
+			t.Errorf("Expected XID_Start %t and XID_Continue %t for %U.", c.start, c.continue_, c.c)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	cases := []struct {
+		profile  *Profile
+		text     string
+		expected []string
+	}{
+		// Hindi and Tamil identifiers have combining marks.
+		{PythonProfile, "नमस्ते = 1\n", []string{"नमस्ते", "=", "1", "\n"}},
+		{PythonProfile, "வணக்கம்\n", []string{"வணக்கம்", "\n"}},
+		// NFKC folds the ligature and the fullwidth letters.
+		{PythonProfile, "ﬁle = ｆile\n", []string{"file", "=", "file", "\n"}},
+		{PythonProfile, "ｄef f\n", []string{"def", "f", "\n"}},
+		{GoProfile, "é ⅰ\n", []string{"é", "ⅰ", "\n"}},
+		{JavaScriptProfile, "$el = _$x1 + $\n", []string{"$el", "=", "_$x1", "+", "$"}},
+		{CSSProfile, ".nav-item{margin-top:1}\n", []string{".", "nav-item", "{", "margin-top", ":", "1", "}"}},
+	}
+	for _, c := range cases {
+		tz, err := c.profile.NewTokenizer(strings.NewReader(c.text))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		values, _, err := tokenValues(tz)
+		if err != nil {
+			t.Errorf("%q: %s", c.text, err.Error())
+			continue
+		}
+		if strings.Join(values, " ") != strings.Join(c.expected, " ") {
+			t.Errorf("Expected %q for %q, but got %q.", c.expected, c.text, values)
+		}
+	}
+
+	// A superscript digit does not continue an identifier.
+	tz, err := GoProfile.NewTokenizer(strings.NewReader("x²\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, _, err := tokenValues(tz); err == nil {
+		t.Errorf("Expected an error for the superscript digit.")
+	}
+}
+
+func TestIdentifierNormalization(t *testing.T) {
+	tz, err := NewTokenizer(strings.NewReader("e\u0301 \ufb01\n"), NewTokenKindSet([]uint32{
+		token_kind.Identifier,
+	}), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz.SetIdentifierRules(IdentifierRules{Normalization: NFC})
+	values, _, err := tokenValues(tz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// NFC composes, but keeps the compatibility characters.
+	if len(values) != 2 || values[0] != "\u00e9" || values[1] != "\ufb01" {
+		t.Errorf("Unexpected identifiers %q.", values)
+	}
+}
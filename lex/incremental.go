@@ -0,0 +1,235 @@
+package lex
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A change to the text of a Buffer. The text between the byte offsets
+// Start and End is replaced by Text.
+type Edit struct {
+	Start uint32
+	End   uint32
+	Text  string
+}
+
+// The range of tokens changed by an edit. The tokens in the range
+// [Start, OldEnd) of the token list before the edit were replaced by the
+// tokens in the range [Start, NewEnd) of the token list after the edit.
+type TokenChange struct {
+	Start  int
+	OldEnd int
+	NewEnd int
+}
+
+// A point at the beginning of a line from which lexing can be restarted.
+type checkpoint struct {
+	// The state of the Tokenizer at the beginning of the line, like the
+	// brackets which are not closed yet.
+	state State
+	// The index of the first token at or after the offset of |state|.
+	index int
+}
+
+// A Buffer holds the text of a document along with its tokens, and
+// updates the tokens incrementally as the text is edited. Only the text
+// from the last line start before an edit is lexed again, up to the
+// point where the new tokens are in sync with the old tokens.
+type Buffer struct {
+	ts      TokenKindSet
+	esr     EscSeqReader
+	idRules IdentifierRules
+
+	text   string
+	tokens []*Token
+	// The byte offsets of the tokens in |text|.
+	starts []uint32
+	ends   []uint32
+
+	checkpoints []checkpoint
+
+	// true if lexing stopped at an error, in which case the tokens after
+	// the error are missing.
+	incomplete bool
+}
+
+// Returns a new Buffer with the tokens of |text|. As editors can have
+// text which cannot be lexed, the Buffer is returned even if an error
+// occurs while lexing. Like with Apply, the tokens after the error are
+// missing in that case.
+func NewBuffer(text string, s TokenKindSet, esr EscSeqReader) (*Buffer, error) {
+	return newBuffer(text, s, esr, IdentifierRules{})
+}
+
+// Returns a new Buffer with the tokens of |text| lexed with the profile
+// |p|. See NewBuffer.
+func (p *Profile) NewBuffer(text string) (*Buffer, error) {
+	return newBuffer(text, p.TokenKindSet(), p.ESR, p.Identifiers)
+}
+
+func newBuffer(text string, s TokenKindSet, esr EscSeqReader, idRules IdentifierRules) (*Buffer, error) {
+	// Validate the arguments before creating the Buffer.
+	_, err := NewTokenizer(strings.NewReader(""), s, esr)
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(Buffer)
+	b.ts = s
+	b.esr = esr
+	b.idRules = idRules
+	b.text = text
+
+	_, err = b.relex(checkpoint{}, 0, 0)
+	return b, err
+}
+
+func (b *Buffer) Text() string {
+	return b.text
+}
+
+// Returns the tokens of the text. The returned slice and the tokens in it
+// should not be modified and are invalidated by Apply.
+func (b *Buffer) Tokens() []*Token {
+	return b.tokens
+}
+
+// Returns the byte offsets of the beginning and the end of the token at
+// index |i|.
+func (b *Buffer) TokenOffsets(i int) (uint32, uint32) {
+	return b.starts[i], b.ends[i]
+}
+
+// Applies the edit |e| to the text and updates the tokens. If an error
+// occurs while lexing the new text, the text is still updated but the
+// tokens after the error are dropped. They are lexed again by the next
+// call to Apply.
+func (b *Buffer) Apply(e Edit) (TokenChange, error) {
+	if e.Start > e.End || e.End > uint32(len(b.text)) {
+		return TokenChange{}, fmt.Errorf("Invalid edit range [%d, %d).", e.Start, e.End)
+	}
+
+	b.text = b.text[:e.Start] + e.Text + b.text[e.End:]
+
+	// Restart from the last checkpoint at or before the edit.
+	i := sort.Search(len(b.checkpoints), func(i int) bool {
+		return b.checkpoints[i].state.Offset > e.Start
+	})
+	// There is no checkpoint if the text has no tokens.
+	var cp checkpoint
+	if i > 0 {
+		cp = b.checkpoints[i-1]
+	}
+
+	delta := int64(len(e.Text)) - int64(e.End-e.Start)
+	return b.relex(cp, e.Start+uint32(len(e.Text)), delta)
+}
+
+// Lexes the text from the checkpoint |cp| until the lexer reaches, at or
+// after the offset |syncFrom|, the beginning of a line which corresponds
+// to a checkpoint of the old text with the same state. The old text after
+// that point is the new text shifted by |delta| bytes.
+func (b *Buffer) relex(cp checkpoint, syncFrom uint32, delta int64) (TokenChange, error) {
+	oldTokens := b.tokens
+	oldStarts := b.starts
+	oldEnds := b.ends
+	oldCheckpoints := b.checkpoints
+
+	// The checkpoints which are not after |cp| are still valid.
+	ci := sort.Search(len(oldCheckpoints), func(i int) bool {
+		return oldCheckpoints[i].state.Offset >= cp.state.Offset
+	})
+	b.checkpoints = append([]checkpoint(nil), oldCheckpoints[:ci]...)
+	b.tokens = append([]*Token(nil), oldTokens[:cp.index]...)
+	b.starts = append([]uint32(nil), oldStarts[:cp.index]...)
+	b.ends = append([]uint32(nil), oldEnds[:cp.index]...)
+
+	r := strings.NewReader(b.text[cp.state.Offset:])
+	tz, err := NewTokenizerFromState(r, b.ts, b.esr, cp.state)
+	if err != nil {
+		return TokenChange{}, err
+	}
+	// The Buffer has all the text, so a token which is not terminated is
+	// an error.
+	tz.partial = false
+	tz.SetIdentifierRules(b.idRules)
+
+	// The index of the checkpoint of the old text at which the new tokens
+	// are in sync with the old tokens. The old tokens cannot be reused if
+	// they are incomplete.
+	sync := -1
+	canSync := !b.incomplete
+	var syncLine uint32
+	tz.lineStartHook = func() {
+		if sync >= 0 {
+			return
+		}
+		st := tz.State()
+		if canSync && st.Offset >= syncFrom {
+			old := int64(st.Offset) - delta
+			j := sort.Search(len(oldCheckpoints), func(i int) bool {
+				return int64(oldCheckpoints[i].state.Offset) >= old
+			})
+			if j < len(oldCheckpoints) && int64(oldCheckpoints[j].state.Offset) == old &&
+				oldCheckpoints[j].state.Equal(st) {
+				sync = j
+				syncLine = st.Line
+				return
+			}
+		}
+		b.checkpoints = append(b.checkpoints, checkpoint{st, len(b.tokens)})
+	}
+
+	b.incomplete = false
+	for sync < 0 && tz.HasNext() {
+		t, err := tz.NextToken()
+		if sync >= 0 {
+			// The token is already present in the old tokens.
+			break
+		}
+		if err == io.EOF {
+			// Skipped white space at the end of the text.
+			break
+		}
+		if err != nil {
+			b.incomplete = true
+			err = fmt.Errorf("Error at %d:%d: %s", tz.Line(), tz.Col(), err.Error())
+			return TokenChange{cp.index, len(oldTokens), len(b.tokens)}, err
+		}
+		b.tokens = append(b.tokens, t)
+		b.starts = append(b.starts, tz.startOffset)
+		b.ends = append(b.ends, tz.r.NextOffset())
+	}
+
+	change := TokenChange{cp.index, len(oldTokens), len(b.tokens)}
+	if sync < 0 {
+		return change, nil
+	}
+
+	// Reuse the old tokens after the point of sync. The tokens which move
+	// to other lines are copied, as the old tokens can still be in use.
+	scp := oldCheckpoints[sync]
+	change.OldEnd = scp.index
+	lineDelta := int64(syncLine) - int64(scp.state.Line)
+	indexDelta := len(b.tokens) - scp.index
+	for i := scp.index; i < len(oldTokens); i++ {
+		t := oldTokens[i]
+		if lineDelta != 0 {
+			c := *t
+			c.Line = uint32(int64(t.Line) + lineDelta)
+			t = &c
+		}
+		b.tokens = append(b.tokens, t)
+		b.starts = append(b.starts, uint32(int64(oldStarts[i])+delta))
+		b.ends = append(b.ends, uint32(int64(oldEnds[i])+delta))
+	}
+	for _, c := range oldCheckpoints[sync:] {
+		st := c.state
+		st.Offset = uint32(int64(st.Offset) + delta)
+		st.Line = uint32(int64(st.Line) + lineDelta)
+		b.checkpoints = append(b.checkpoints, checkpoint{st, c.index + indexDelta})
+	}
+	return change, nil
+}
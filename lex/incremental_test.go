@@ -0,0 +1,199 @@
+package lex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+var incrementalTokenKinds = []uint32{
+	token_kind.PySingleLineComment,
+	token_kind.PyMultilineString,
+	token_kind.KeywordClass,
+	token_kind.KeywordDef,
+	token_kind.KeywordReturn,
+	token_kind.KeywordOr,
+	token_kind.Identifier,
+	token_kind.LeftParen,
+	token_kind.RightParen,
+	token_kind.LeftBracket,
+	token_kind.RightBracket,
+	token_kind.Colon,
+	token_kind.Dot,
+	token_kind.Comma,
+	token_kind.ReturnArrow,
+	token_kind.Assign,
+	token_kind.Indent,
+	token_kind.NewLine,
+	token_kind.SingleQuoteString,
+}
+
+// Checks that the tokens of |b| are the same as the tokens of its text
+// lexed from scratch.
+func checkBuffer(b *Buffer) error {
+	ts := NewTokenKindSet(incrementalTokenKinds)
+	var goEsr GoESR
+	full, err := NewBuffer(b.Text(), ts, goEsr)
+	if err != nil {
+		return err
+	}
+
+	if len(full.Tokens()) != len(b.Tokens()) {
+		return fmt.Errorf("Expected %d tokens, but got %d.", len(full.Tokens()), len(b.Tokens()))
+	}
+	for i, exp := range full.Tokens() {
+		actual := b.Tokens()[i]
+		if *exp != *actual {
+			return fmt.Errorf("Expected %v at index %d, but got %v.", *exp, i, *actual)
+		}
+		es, ee := full.TokenOffsets(i)
+		as, ae := b.TokenOffsets(i)
+		if es != as || ee != ae {
+			return fmt.Errorf("Expected '%s' at [%d, %d), but got [%d, %d).",
+				exp.Value, es, ee, as, ae)
+		}
+	}
+
+	// The checkpoints have the states of the lexer at the line starts.
+	if len(full.checkpoints) != len(b.checkpoints) {
+		return fmt.Errorf("Expected %d checkpoints, but got %d.", len(full.checkpoints), len(b.checkpoints))
+	}
+	for i, exp := range full.checkpoints {
+		actual := b.checkpoints[i]
+		if exp.index != actual.index || exp.state.Line != actual.state.Line ||
+			exp.state.Offset != actual.state.Offset || !exp.state.Equal(actual.state) {
+			return fmt.Errorf("Expected the checkpoint %+v, but got %+v.", exp, actual)
+		}
+	}
+	return nil
+}
+
+func TestIncrementalRelex(t *testing.T) {
+	text, err := ioutil.ReadFile("test_data/python_text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ts := NewTokenKindSet(incrementalTokenKinds)
+	var goEsr GoESR
+	b, err := NewBuffer(string(text), ts, goEsr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	n := len(b.Tokens())
+
+	edits := []struct {
+		find    string
+		replace string
+		// The expected numbers of old and new tokens changed.
+		changedOld, changedNew int
+		// true if the edit results in text which cannot be lexed.
+		invalid bool
+	}{
+		// Rename an identifier in a line.
+		{"geti", "get_i", 10, 10, false},
+		// Join two lines.
+		{"self._i\n", "self._i ", 7, 6, false},
+		// Split a line. The new line has no indentation, so the lines
+		// after it are lexed again until the indentation is the same.
+		{"self._i ", "self._i\n", 35, 36, false},
+		// Insert a line.
+		{"    def append", "    x = []\n    def append", 12, 18, false},
+		// Open a multiline string which is not closed.
+		{"x = []", "x = \"\"\"[]", 0, 0, true},
+		// Close it. The tokens after the error are lexed again.
+		{"(self, i: int)", "(self, i: int)\"\"\"", 3, 41, false},
+	}
+
+	for _, e := range edits {
+		i := strings.Index(b.Text(), e.find)
+		if i < 0 {
+			t.Fatalf("'%s' not found.", e.find)
+		}
+		edit := Edit{uint32(i), uint32(i + len(e.find)), e.replace}
+		change, err := b.Apply(edit)
+		if e.invalid {
+			if err == nil {
+				t.Fatalf("Expected an error replacing '%s' with '%s'.", e.find, e.replace)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err = checkBuffer(b); err != nil {
+			t.Fatalf("After replacing '%s' with '%s': %s", e.find, e.replace, err.Error())
+		}
+
+		changedOld := change.OldEnd - change.Start
+		changedNew := change.NewEnd - change.Start
+		if changedOld != e.changedOld || changedNew != e.changedNew {
+			t.Errorf("Replacing '%s' changed %d old tokens with %d new tokens.",
+				e.find, changedOld, changedNew)
+		}
+	}
+
+	if len(b.Tokens()) == n {
+		t.Errorf("Expected the number of tokens to change.")
+	}
+}
+
+func TestIncrementalRelexError(t *testing.T) {
+	ts := NewTokenKindSet(incrementalTokenKinds)
+	var goEsr GoESR
+	b, err := NewBuffer("a = 'x'\nb = c\n", ts, goEsr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Unterminated string.
+	_, err = b.Apply(Edit{6, 7, ""})
+	if err == nil {
+		t.Fatal("Expected an error for an unterminated string.")
+	}
+
+	_, err = b.Apply(Edit{6, 6, "'"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = checkBuffer(b); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestIncrementalEmptyBuffer(t *testing.T) {
+	b, err := PythonProfile.NewBuffer("  \n")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := b.Apply(Edit{0, 0, "x = 1"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := len(b.Tokens()); n != 4 || b.Tokens()[0].Value != "x" {
+		t.Errorf("Expected the tokens of the new text, but got %d tokens.", n)
+	}
+}
+
+func TestIncrementalOldTokens(t *testing.T) {
+	ts := NewTokenKindSet(incrementalTokenKinds)
+	var goEsr GoESR
+	b, err := NewBuffer("a = b\nc = d\ne = f\n", ts, goEsr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The tokens returned before an edit are not changed by it.
+	old := b.Tokens()
+	last := *old[len(old)-2]
+	if _, err := b.Apply(Edit{0, 0, "x = y\n"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if *old[len(old)-2] != last {
+		t.Errorf("Expected the old token %v to be unchanged, but got %v.", last, *old[len(old)-2])
+	}
+	if n := b.Tokens()[len(b.Tokens())-2]; n.Value != "f" || n.Line != 4 {
+		t.Errorf("Expected 'f' on line 4, but got %v.", *n)
+	}
+}
@@ -0,0 +1,71 @@
+package lex
+
+import (
+	"testing"
+	"uno/lex/token_kind"
+)
+
+var lineJoinTokenKinds = []uint32{
+	token_kind.Identifier,
+	token_kind.KeywordIf,
+	token_kind.KeywordAnd,
+	token_kind.Assign,
+	token_kind.Add,
+	token_kind.Colon,
+	token_kind.DecimalInteger,
+	token_kind.Indent,
+	token_kind.NewLine,
+}
+
+func TestLineJoinTokens(t *testing.T) {
+	ts := NewTokenKindSet(append(lineJoinTokenKinds, token_kind.LineJoin))
+
+	err := matchTokens("test_data/line_join_text", ts, []Token{
+		Token{token_kind.Identifier, "total", 1, 1},
+		Token{token_kind.Assign, "=", 1, 7},
+		Token{token_kind.DecimalInteger, "1", 1, 9},
+		Token{token_kind.Add, "+", 1, 11},
+		Token{token_kind.LineJoin, "\\\n", 1, 13},
+		// The continued line does not have an Indent token.
+		Token{token_kind.DecimalInteger, "2", 2, 5},
+		Token{token_kind.NewLine, "\n", 2, 6},
+		Token{token_kind.KeywordIf, "if", 3, 1},
+		Token{token_kind.Identifier, "a", 3, 4},
+		Token{token_kind.KeywordAnd, "and", 3, 6},
+		Token{token_kind.LineJoin, "\\\n", 3, 10},
+		Token{token_kind.Identifier, "b", 4, 4},
+		Token{token_kind.Colon, ":", 4, 5},
+		Token{token_kind.NewLine, "\n", 4, 6},
+		Token{token_kind.Indent, "    ", 5, 1},
+		Token{token_kind.Identifier, "c", 5, 5},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestTransparentLineJoin(t *testing.T) {
+	ts := NewTokenKindSet(lineJoinTokenKinds)
+
+	err := matchTokens("test_data/line_join_text", ts, []Token{
+		Token{token_kind.Identifier, "total", 1, 1},
+		Token{token_kind.Assign, "=", 1, 7},
+		Token{token_kind.DecimalInteger, "1", 1, 9},
+		Token{token_kind.Add, "+", 1, 11},
+		Token{token_kind.DecimalInteger, "2", 2, 5},
+		Token{token_kind.NewLine, "\n", 2, 6},
+		Token{token_kind.KeywordIf, "if", 3, 1},
+		Token{token_kind.Identifier, "a", 3, 4},
+		Token{token_kind.KeywordAnd, "and", 3, 6},
+		Token{token_kind.Identifier, "b", 4, 4},
+		Token{token_kind.Colon, ":", 4, 5},
+		Token{token_kind.NewLine, "\n", 4, 6},
+		Token{token_kind.Indent, "    ", 5, 1},
+		Token{token_kind.Identifier, "c", 5, 5},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
@@ -0,0 +1,149 @@
+package lsp
+
+import (
+	"unicode/utf8"
+	"uno/lex"
+	"uno/lex/highlight"
+)
+
+// The token types of the legend, which are standard semantic token types
+// of LSP.
+var tokenTypes = []string{
+	"keyword",
+	"variable",
+	"string",
+	"number",
+	"comment",
+	"operator",
+	"macro",
+	"decorator",
+}
+
+// The index in the legend of the token type of each highlight class. The
+// tokens of the other classes are not reported.
+var classTypes = map[highlight.Class]int{
+	highlight.Keyword:      0,
+	highlight.Identifier:   1,
+	highlight.String:       2,
+	highlight.Number:       3,
+	highlight.Comment:      4,
+	highlight.Operator:     5,
+	highlight.Preprocessor: 6,
+	highlight.Decorator:    7,
+}
+
+// Returns the length of |s| in UTF-16 code units.
+func utf16Len(s string) uint32 {
+	n := uint32(0)
+	for _, c := range s {
+		if c >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the semantic tokens of the buffer |b| encoded as in LSP: five
+// integers for each token, which are the line relative to the previous
+// token, the start character relative to the previous token if it is on
+// the same line, the length, the token type and the modifiers. The
+// characters are counted in UTF-16 code units, and the tokens spanning
+// lines are split at the line ends. The lines are those of LSP, see
+// lineBreakLen.
+func semanticTokens(b *lex.Buffer) []uint32 {
+	text := b.Text()
+	data := []uint32{}
+	var prevLine, prevChar uint32
+
+	// The position of |offset| in |text|, which only moves forward.
+	var offset int
+	var line, char uint32
+	advance := func(to int) {
+		for offset < to {
+			if n := lineBreakLen(text, offset); n > 0 {
+				line, char = line+1, 0
+				offset += n
+				continue
+			}
+			c, n := utf8.DecodeRuneInString(text[offset:])
+			if c >= 0x10000 {
+				char += 2
+			} else {
+				char++
+			}
+			offset += n
+		}
+	}
+	emit := func(length uint32, tokenType int) {
+		if length == 0 {
+			return
+		}
+		deltaChar := char
+		if line == prevLine {
+			deltaChar = char - prevChar
+		}
+		data = append(data, line-prevLine, deltaChar, length, uint32(tokenType), 0)
+		prevLine, prevChar = line, char
+	}
+
+	for i, t := range b.Tokens() {
+		tokenType, ok := classTypes[highlight.ClassOf(t.Kind)]
+		if !ok {
+			continue
+		}
+
+		start, end := b.TokenOffsets(i)
+		if tokenType == classTypes[highlight.Comment] {
+			// A single line comment ends with its new line, which can be a
+			// new line of the lexer which does not break the line for LSP.
+			for n := uint32(3); n > 0; n-- {
+				if end-start >= n && lex.NewLineLen([]byte(text[end-n:end])) == int(n) {
+					end -= n
+					break
+				}
+			}
+		}
+		advance(int(start))
+		for offset < int(end) {
+			// The part of the token on the current line.
+			e := offset
+			for e < int(end) && lineBreakLen(text, e) == 0 {
+				e++
+			}
+			emit(utf16Len(text[offset:e]), tokenType)
+			advance(e)
+			if e < int(end) {
+				advance(e + lineBreakLen(text, e))
+			}
+		}
+	}
+	return data
+}
+
+// An edit of the semantic tokens of LSP, which replaces DeleteCount
+// integers of the old data at Start by Data.
+type semanticTokensEdit struct {
+	Start       int      `json:"start"`
+	DeleteCount int      `json:"deleteCount"`
+	Data        []uint32 `json:"data"`
+}
+
+// Returns the edits from the data |old| to the data |new|, which is a
+// single edit of the part between their common prefix and suffix.
+func semanticTokensEdits(old, new []uint32) []semanticTokensEdit {
+	p := 0
+	for p < len(old) && p < len(new) && old[p] == new[p] {
+		p++
+	}
+	s := 0
+	for s < len(old)-p && s < len(new)-p && old[len(old)-1-s] == new[len(new)-1-s] {
+		s++
+	}
+	if p == len(old) && p == len(new) {
+		return []semanticTokensEdit{}
+	}
+	data := append([]uint32{}, new[p:len(new)-s]...)
+	return []semanticTokensEdit{{p, len(old) - p - s, data}}
+}
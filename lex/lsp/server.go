@@ -0,0 +1,383 @@
+// Package lsp implements a small language server which provides the
+// semantic tokens of documents from the tokens of the lex package. It
+// speaks the Language Server Protocol over a pair of streams, usually the
+// standard input and output, and supports the requests
+// textDocument/semanticTokens/full and textDocument/semanticTokens/full/delta.
+//
+// The open documents are kept in lex.Buffer values, so that the changes
+// sent by the client only relex the lines around them. The positions are
+// in UTF-16 code units, which is the default encoding of the protocol.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+	"uno/lex"
+)
+
+// A Server serves the requests read from a stream and writes the responses
+// to another stream.
+type Server struct {
+	c conn
+
+	initialized bool
+	shutdown    bool
+
+	docs map[string]*document
+	// The number of the last result ID.
+	lastResult int
+	// The notifications to send after the current message is handled.
+	pending []*notification
+}
+
+// An open document.
+type document struct {
+	buf     *lex.Buffer
+	version int
+	// The last semantic tokens sent for the document and their result ID.
+	resultID string
+	data     []uint32
+}
+
+// Returns a new Server which reads the messages of the client from |r| and
+// writes its messages to |w|.
+func NewServer(r io.Reader, w io.Writer) *Server {
+	s := new(Server)
+	s.c = conn{bufio.NewReader(r), w}
+	s.docs = make(map[string]*document)
+	return s
+}
+
+// Serves requests until the client sends the exit notification or closes
+// the input stream. Returns an error if a message cannot be read or
+// written.
+func (s *Server) Serve() error {
+	for true {
+		b, err := s.c.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil {
+			err = s.c.write(&response{"2.0", nil, nil, &responseError{parseError, "Invalid JSON message."}})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		for _, n := range s.pending {
+			if err := s.c.write(n); err != nil {
+				return err
+			}
+		}
+		s.pending = nil
+		if req.ID == nil {
+			// No response is sent to a notification.
+			continue
+		}
+		if err := s.c.write(&response{"2.0", req.ID, result, rerr}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The type of the messages of window/logMessage which are only logged.
+const logMessageType = 4
+
+// Sends a window/logMessage notification with the message |format|
+// formatted with |args| after the current message is handled.
+func (s *Server) logf(format string, args ...interface{}) {
+	s.pending = append(s.pending, &notification{"2.0", "window/logMessage", map[string]interface{}{
+		"type":    logMessageType,
+		"message": fmt.Sprintf(format, args...),
+	}})
+}
+
+// Returns the result of the request |req|.
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{invalidRequest, "The server is shut down."}
+	}
+	if !s.initialized && req.Method != "initialize" {
+		return nil, &responseError{serverNotInitialized, "The server is not initialized."}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return s.initialize()
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := parseParams(req, &p); err != nil {
+			return nil, err
+		}
+		return s.didOpen(&p)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := parseParams(req, &p); err != nil {
+			return nil, err
+		}
+		return s.didChange(&p)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := parseParams(req, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/semanticTokens/full":
+		var p semanticTokensParams
+		if err := parseParams(req, &p); err != nil {
+			return nil, err
+		}
+		return s.semanticTokensFull(&p)
+	case "textDocument/semanticTokens/full/delta":
+		var p semanticTokensDeltaParams
+		if err := parseParams(req, &p); err != nil {
+			return nil, err
+		}
+		return s.semanticTokensDelta(&p)
+	}
+	return nil, &responseError{methodNotFound, fmt.Sprintf("Unsupported method '%s'.", req.Method)}
+}
+
+// Decodes the parameters of |req| into |v|.
+func parseParams(req *request, v interface{}) *responseError {
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return &responseError{invalidParams, fmt.Sprintf("Invalid parameters for '%s'.\n%s", req.Method, err.Error())}
+	}
+	return nil
+}
+
+func (s *Server) initialize() (interface{}, *responseError) {
+	if s.initialized {
+		return nil, &responseError{invalidRequest, "The server is already initialized."}
+	}
+	s.initialized = true
+
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"positionEncoding": "utf-16",
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				// Incremental changes.
+				"change": 2,
+			},
+			"semanticTokensProvider": map[string]interface{}{
+				"legend": map[string]interface{}{
+					"tokenTypes":     tokenTypes,
+					"tokenModifiers": []string{},
+				},
+				"full": map[string]interface{}{"delta": true},
+			},
+		},
+		"serverInfo": map[string]interface{}{"name": "unolex"},
+	}, nil
+}
+
+type position struct {
+	Line      uint32 `json:"line"`
+	Character uint32 `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI        string `json:"uri"`
+		LanguageID string `json:"languageId"`
+		Version    int    `json:"version"`
+		Text       string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		// The whole text is replaced if there is no range.
+		Range *textRange `json:"range"`
+		Text  string     `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type semanticTokensParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type semanticTokensDeltaParams struct {
+	TextDocument     textDocumentIdentifier `json:"textDocument"`
+	PreviousResultID string                 `json:"previousResultId"`
+}
+
+// Returns the profile for the language ID |id| of LSP, or for the
+// extension of |uri| if the language is unknown.
+func profileFor(id, uri string) *lex.Profile {
+	if p, err := lex.ProfileByName(id); err == nil {
+		return p
+	}
+	return lex.ProfileForFile(uri)
+}
+
+// Errors while lexing are only logged, as the text of a document being
+// edited is often incomplete. The tokens after the error are missing from
+// the semantic tokens until the error is fixed.
+func (s *Server) didOpen(p *didOpenParams) (interface{}, *responseError) {
+	td := &p.TextDocument
+	prof := profileFor(td.LanguageID, td.URI)
+	if prof == nil {
+		return nil, &responseError{invalidParams, fmt.Sprintf("No profile for the language '%s'.", td.LanguageID)}
+	}
+	buf, err := prof.NewBuffer(td.Text)
+	if buf == nil {
+		return nil, &responseError{internalError, "Cannot create a buffer."}
+	}
+	if err != nil {
+		s.logf("%s: %s", td.URI, err.Error())
+	}
+	s.docs[td.URI] = &document{buf: buf, version: td.Version}
+	return nil, nil
+}
+
+func (s *Server) didChange(p *didChangeParams) (interface{}, *responseError) {
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{invalidParams, fmt.Sprintf("The document '%s' is not open.", p.TextDocument.URI)}
+	}
+
+	for _, c := range p.ContentChanges {
+		text := d.buf.Text()
+		e := lex.Edit{Start: 0, End: uint32(len(text)), Text: c.Text}
+		if c.Range != nil {
+			e.Start = offsetOf(text, c.Range.Start)
+			e.End = offsetOf(text, c.Range.End)
+			if e.End < e.Start {
+				e.Start, e.End = e.End, e.Start
+			}
+		}
+		if _, err := d.buf.Apply(e); err != nil {
+			s.logf("%s: %s", p.TextDocument.URI, err.Error())
+		}
+	}
+	d.version = p.TextDocument.Version
+	return nil, nil
+}
+
+// Returns the length of the line break of LSP at |i| in |text|, which is
+// "\n", "\r\n" or "\r", or 0 if there is none. The other new lines of the
+// lexer, NEL, U+2028 and U+2029, do not break the lines of LSP, so the
+// lines of the tokens are not those of LSP, and the positions are found
+// from the byte offsets instead.
+func lineBreakLen(text string, i int) int {
+	switch {
+	case text[i] == '\n':
+		return 1
+	case text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n':
+		return 2
+	case text[i] == '\r':
+		return 1
+	}
+	return 0
+}
+
+// Returns the byte offset in |text| of the position |pos|. As in LSP, a
+// character after the end of a line is the end of the line, and a line
+// after the last line is the end of the text.
+func offsetOf(text string, pos position) uint32 {
+	offset := 0
+	for line := uint32(0); line < pos.Line; line++ {
+		for offset < len(text) && lineBreakLen(text, offset) == 0 {
+			offset++
+		}
+		if offset == len(text) {
+			return uint32(len(text))
+		}
+		offset += lineBreakLen(text, offset)
+	}
+
+	for char := uint32(0); char < pos.Character && offset < len(text); {
+		if lineBreakLen(text, offset) > 0 {
+			break
+		}
+		c, n := utf8.DecodeRuneInString(text[offset:])
+		if c >= 0x10000 {
+			char += 2
+		} else {
+			char++
+		}
+		offset += n
+	}
+	return uint32(offset)
+}
+
+func (s *Server) document(uri string) (*document, *responseError) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{invalidParams, fmt.Sprintf("The document '%s' is not open.", uri)}
+	}
+	return d, nil
+}
+
+// Computes the semantic tokens of |d| and gives them a new result ID.
+func (s *Server) update(d *document) {
+	s.lastResult++
+	d.resultID = strconv.Itoa(s.lastResult)
+	d.data = semanticTokens(d.buf)
+}
+
+func (s *Server) semanticTokensFull(p *semanticTokensParams) (interface{}, *responseError) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	s.update(d)
+	return map[string]interface{}{"resultId": d.resultID, "data": d.data}, nil
+}
+
+// Returns the edits from the previous result if the client has it, or
+// else all the semantic tokens like semanticTokensFull.
+func (s *Server) semanticTokensDelta(p *semanticTokensDeltaParams) (interface{}, *responseError) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	if d.resultID == "" || p.PreviousResultID != d.resultID {
+		s.update(d)
+		return map[string]interface{}{"resultId": d.resultID, "data": d.data}, nil
+	}
+
+	old := d.data
+	s.update(d)
+	return map[string]interface{}{"resultId": d.resultID, "edits": semanticTokensEdits(old, d.data)}, nil
+}
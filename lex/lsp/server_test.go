@@ -0,0 +1,346 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A client which drives a Server over pipes.
+type client struct {
+	t    *testing.T
+	c    conn
+	id   int
+	done chan error
+	// The responses read from the server.
+	responses chan []byte
+
+	mu sync.Mutex
+	// The messages of the window/logMessage notifications of the server.
+	logs []string
+}
+
+func newClient(t *testing.T) *client {
+	sr, cw := io.Pipe()
+	cr, sw := io.Pipe()
+	cl := &client{t: t, c: conn{bufio.NewReader(cr), cw}, done: make(chan error, 1), responses: make(chan []byte)}
+	go func() {
+		err := NewServer(sr, sw).Serve()
+		sw.Close()
+		cl.done <- err
+	}()
+	// The messages are read as they come, so that the notifications of the
+	// server do not block it.
+	go func() {
+		defer close(cl.responses)
+		for true {
+			b, err := cl.c.read()
+			if err != nil {
+				return
+			}
+			var m struct {
+				ID     *int
+				Method string
+				Params struct {
+					Message string
+				}
+			}
+			if json.Unmarshal(b, &m) == nil && m.ID == nil && m.Method == "window/logMessage" {
+				cl.mu.Lock()
+				cl.logs = append(cl.logs, m.Params.Message)
+				cl.mu.Unlock()
+				continue
+			}
+			cl.responses <- b
+		}
+	}()
+	return cl
+}
+
+// Returns the messages logged by the server so far.
+func (cl *client) logged() []string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return append([]string{}, cl.logs...)
+}
+
+// Sends a request and returns its response.
+func (cl *client) call(method string, params interface{}) (json.RawMessage, *responseError) {
+	cl.id++
+	if err := cl.c.write(map[string]interface{}{"jsonrpc": "2.0", "id": cl.id, "method": method, "params": params}); err != nil {
+		cl.t.Fatal(err.Error())
+	}
+	b, ok := <-cl.responses
+	if !ok {
+		cl.t.Fatalf("The server closed the connection.")
+	}
+	var resp struct {
+		ID     int
+		Result json.RawMessage
+		Error  *responseError
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		cl.t.Fatal(err.Error())
+	}
+	if resp.ID != cl.id {
+		cl.t.Fatalf("Expected the response to %d, but got %d.", cl.id, resp.ID)
+	}
+	return resp.Result, resp.Error
+}
+
+func (cl *client) notify(method string, params interface{}) {
+	if err := cl.c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}); err != nil {
+		cl.t.Fatal(err.Error())
+	}
+}
+
+// Sends a request which must succeed and decodes its result into |v|.
+func (cl *client) mustCall(method string, params interface{}, v interface{}) {
+	result, rerr := cl.call(method, params)
+	if rerr != nil {
+		cl.t.Fatalf("Unexpected error for '%s': %s", method, rerr.Message)
+	}
+	if v != nil {
+		if err := json.Unmarshal(result, v); err != nil {
+			cl.t.Fatal(err.Error())
+		}
+	}
+}
+
+func (cl *client) exit() {
+	cl.mustCall("shutdown", nil, nil)
+	cl.notify("exit", nil)
+	if err := <-cl.done; err != nil {
+		cl.t.Error(err.Error())
+	}
+}
+
+type semanticTokensResult struct {
+	ResultID string               `json:"resultId"`
+	Data     []uint32             `json:"data"`
+	Edits    []semanticTokensEdit `json:"edits"`
+}
+
+func open(cl *client, uri, languageID, text string) {
+	cl.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": languageID, "version": 1, "text": text},
+	})
+}
+
+func change(cl *client, uri string, version int, sl, sc, el, ec int, text string) {
+	cl.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []interface{}{map[string]interface{}{
+			"range": map[string]interface{}{
+				"start": map[string]int{"line": sl, "character": sc},
+				"end":   map[string]int{"line": el, "character": ec},
+			},
+			"text": text,
+		}},
+	})
+}
+
+func full(cl *client, uri string) semanticTokensResult {
+	var r semanticTokensResult
+	cl.mustCall("textDocument/semanticTokens/full", map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+	}, &r)
+	return r
+}
+
+// Returns |data| after the edits of a delta result.
+func applyEdits(data []uint32, edits []semanticTokensEdit) []uint32 {
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		rest := append([]uint32{}, data[e.Start+e.DeleteCount:]...)
+		data = append(append(data[:e.Start:e.Start], e.Data...), rest...)
+	}
+	return data
+}
+
+func TestInitialize(t *testing.T) {
+	cl := newClient(t)
+	if _, rerr := cl.call("textDocument/semanticTokens/full", nil); rerr == nil || rerr.Code != serverNotInitialized {
+		t.Errorf("Expected an error before initialize, but got %v.", rerr)
+	}
+
+	var r struct {
+		Capabilities struct {
+			PositionEncoding       string
+			SemanticTokensProvider struct {
+				Legend struct{ TokenTypes []string }
+				Full   struct{ Delta bool }
+			}
+		}
+	}
+	cl.mustCall("initialize", map[string]interface{}{}, &r)
+	p := r.Capabilities.SemanticTokensProvider
+	if r.Capabilities.PositionEncoding != "utf-16" || !reflect.DeepEqual(p.Legend.TokenTypes, tokenTypes) || !p.Full.Delta {
+		t.Errorf("Unexpected capabilities %+v.", r.Capabilities)
+	}
+
+	if _, rerr := cl.call("textDocument/hover", nil); rerr == nil || rerr.Code != methodNotFound {
+		t.Errorf("Expected an error for an unknown method, but got %v.", rerr)
+	}
+	cl.exit()
+}
+
+func TestSemanticTokens(t *testing.T) {
+	cl := newClient(t)
+	cl.mustCall("initialize", map[string]interface{}{}, nil)
+
+	// U+1D465 is two UTF-16 code units, and the string spans two lines.
+	open(cl, "file:///a.py", "python", "def f(\U0001D465):\n    return \"\"\"a\r\nbc\"\"\" # é\n")
+	r := full(cl, "file:///a.py")
+	expected := []uint32{
+		0, 0, 3, 0, 0, // def
+		0, 4, 1, 1, 0, // f
+		0, 2, 2, 1, 0, // the identifier, normalized to x but with its length in the text
+		1, 4, 6, 0, 0, // return
+		0, 7, 4, 2, 0, // """a
+		1, 0, 5, 2, 0, // bc"""
+		0, 6, 3, 4, 0, // # é
+	}
+	if !reflect.DeepEqual(r.Data, expected) {
+		t.Errorf("Expected the data\n%v\nbut got\n%v", expected, r.Data)
+	}
+
+	// Rename f to longer, after the surrogate pair.
+	change(cl, "file:///a.py", 2, 0, 4, 0, 5, "longer")
+	change(cl, "file:///a.py", 3, 0, 11, 0, 13, "y")
+	var d semanticTokensResult
+	cl.mustCall("textDocument/semanticTokens/full/delta", map[string]interface{}{
+		"textDocument":     map[string]string{"uri": "file:///a.py"},
+		"previousResultId": r.ResultID,
+	}, &d)
+	if d.ResultID == r.ResultID || d.Data != nil {
+		t.Errorf("Expected a delta result, but got %+v.", d)
+	}
+	got := applyEdits(r.Data, d.Edits)
+	if f := full(cl, "file:///a.py"); !reflect.DeepEqual(got, f.Data) {
+		t.Errorf("Expected the edits to give\n%v\nbut got\n%v", f.Data, got)
+	}
+	if got[7] != 6 || got[12] != 1 || got[11] != 7 {
+		t.Errorf("Expected the new lengths of the identifiers, but got %v.", got)
+	}
+
+	// An unknown result ID gives all the tokens.
+	cl.mustCall("textDocument/semanticTokens/full/delta", map[string]interface{}{
+		"textDocument":     map[string]string{"uri": "file:///a.py"},
+		"previousResultId": "unknown",
+	}, &d)
+	if d.Data == nil {
+		t.Errorf("Expected all the tokens, but got %+v.", d)
+	}
+	cl.exit()
+}
+
+func TestIncompleteDocument(t *testing.T) {
+	cl := newClient(t)
+	cl.mustCall("initialize", map[string]interface{}{}, nil)
+
+	// The profile is chosen from the extension, and the tokens after a lex
+	// error are missing until it is fixed.
+	open(cl, "file:///b.c", "", "int a = 1;\nint b = $;\nint c;\n")
+	before := full(cl, "file:///b.c")
+	change(cl, "file:///b.c", 2, 1, 8, 1, 9, "@")
+	change(cl, "file:///b.c", 3, 1, 8, 1, 9, "2")
+	after := full(cl, "file:///b.c")
+	if len(after.Data) <= len(before.Data) {
+		t.Errorf("Expected more tokens after the fix, but got\n%v\nthen\n%v", before.Data, after.Data)
+	}
+	// The errors are logged, for the open document and for the change.
+	if logs := cl.logged(); len(logs) != 2 || !strings.HasPrefix(logs[0], "file:///b.c: ") ||
+		!strings.Contains(logs[1], "'@'") {
+		t.Errorf("Expected the lex errors to be logged, but got %q.", logs)
+	}
+
+	cl.notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]string{"uri": "file:///b.c"}})
+	if _, rerr := cl.call("textDocument/semanticTokens/full", map[string]interface{}{
+		"textDocument": map[string]string{"uri": "file:///b.c"},
+	}); rerr == nil || rerr.Code != invalidParams {
+		t.Errorf("Expected an error for a closed document, but got %v.", rerr)
+	}
+	cl.exit()
+}
+
+func TestLineBreaks(t *testing.T) {
+	cl := newClient(t)
+	cl.mustCall("initialize", map[string]interface{}{}, nil)
+
+	// A "\r" breaks the lines of LSP, but U+2028, which ends the comment
+	// for the lexer, does not.
+	open(cl, "file:///c.py", "python", "a = 1\rb  # x\u2028y\n")
+	r := full(cl, "file:///c.py")
+	expected := []uint32{
+		0, 0, 1, 1, 0, // a
+		0, 2, 1, 5, 0, // =
+		0, 2, 1, 3, 0, // 1
+		1, 0, 1, 1, 0, // b
+		0, 3, 3, 4, 0, // # x
+		0, 4, 1, 1, 0, // y
+	}
+	if !reflect.DeepEqual(r.Data, expected) {
+		t.Errorf("Expected the data\n%v\nbut got\n%v", expected, r.Data)
+	}
+	cl.exit()
+}
+
+func TestOffsetOf(t *testing.T) {
+	text := "a\U0001D465b\r\nc\n"
+	tests := []struct {
+		pos    position
+		offset uint32
+	}{
+		{position{0, 0}, 0},
+		{position{0, 1}, 1},
+		{position{0, 3}, 5},
+		{position{0, 4}, 6},
+		{position{0, 9}, 6},
+		{position{1, 1}, 9},
+		{position{2, 0}, 10},
+		{position{7, 3}, 10},
+	}
+	for _, test := range tests {
+		if o := offsetOf(text, test.pos); o != test.offset {
+			t.Errorf("Expected the offset %d for %v, but got %d.", test.offset, test.pos, o)
+		}
+	}
+
+	// The lines of LSP end at "\r" too, but not at U+2028.
+	text = "a\rb\u2028c\nd"
+	tests = []struct {
+		pos    position
+		offset uint32
+	}{
+		{position{1, 0}, 2},
+		{position{1, 2}, 6},
+		{position{1, 9}, 7},
+		{position{2, 0}, 8},
+	}
+	for _, test := range tests {
+		if o := offsetOf(text, test.pos); o != test.offset {
+			t.Errorf("Expected the offset %d for %v in %q, but got %d.", test.offset, test.pos, text, o)
+		}
+	}
+}
+
+func TestSemanticTokensEdits(t *testing.T) {
+	tests := [][2][]uint32{
+		{{1, 2, 3}, {1, 2, 3}},
+		{{1, 2, 3}, {1, 4, 3}},
+		{{1, 2, 3}, {1, 2, 3, 4}},
+		{{1, 2, 2, 3}, {1, 2, 3}},
+		{{}, {5}},
+	}
+	for _, test := range tests {
+		edits := semanticTokensEdits(test[0], test[1])
+		if got := applyEdits(append([]uint32{}, test[0]...), edits); !reflect.DeepEqual(got, test[1]) {
+			t.Errorf("Expected %v from %v, but got %v.", test[1], test[0], got)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+//go:build ignore
+
+// Generates norm_tables.go, the tables for the normalization of
+// identifiers, from the files UnicodeData.txt and CompositionExclusions.txt
+// of the Unicode Character Database. The files are downloaded from
+// unicode.org for the version of the unicode package, unicode.Version, so
+// that the tables match the tables of the letters of identifiers, unless
+// a directory with the files is given.
+//
+//	go run maketables.go [-ucd <dir>] [-version <version>]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ucd = flag.String("ucd", "",
+	"The directory of the Unicode Character Database files. By default, they are downloaded from unicode.org.")
+var version = flag.String("version", unicode.Version, "The version of the Unicode Character Database.")
+var output = flag.String("output", "norm_tables.go", "The file to write.")
+
+type decomposition struct {
+	compat bool
+	runes  []rune
+}
+
+// Returns the file |name| of the Unicode Character Database, from the
+// directory |ucd| or else from unicode.org.
+func openUCD(name string) io.ReadCloser {
+	if *ucd != "" {
+		f, err := os.Open(filepath.Join(*ucd, name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return f
+	}
+
+	url := fmt.Sprintf("https://www.unicode.org/Public/%s/ucd/%s", *version, name)
+	resp, err := http.Get(url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("%s: %s", url, resp.Status)
+	}
+	return resp.Body
+}
+
+// Calls |fn| with the fields of each line of the file |name|, without
+// comments and blank lines.
+func readFields(name string, fn func(fields []string)) {
+	f := openUCD(name)
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		fn(fields)
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseRune(s string) rune {
+	c, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return rune(c)
+}
+
+func sortedRunes(m map[rune]bool) []rune {
+	var l []rune
+	for c := range m {
+		l = append(l, c)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	return l
+}
+
+func main() {
+	flag.Parse()
+
+	classes := map[rune]uint8{}
+	decompositions := map[rune]decomposition{}
+	readFields("UnicodeData.txt", func(fields []string) {
+		c := parseRune(fields[0])
+		ccc, err := strconv.ParseUint(fields[3], 10, 8)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ccc != 0 {
+			classes[c] = uint8(ccc)
+		}
+
+		d := strings.Fields(fields[5])
+		if len(d) == 0 {
+			return
+		}
+		var dc decomposition
+		if strings.HasPrefix(d[0], "<") {
+			dc.compat = true
+			d = d[1:]
+		}
+		for _, s := range d {
+			dc.runes = append(dc.runes, parseRune(s))
+		}
+		decompositions[c] = dc
+	})
+
+	exclusions := map[rune]bool{}
+	readFields("CompositionExclusions.txt", func(fields []string) {
+		exclusions[parseRune(fields[0])] = true
+	})
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by maketables.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package lex\n\n")
+	fmt.Fprintf(&b, "// The version of the Unicode Character Database of the tables.\n")
+	fmt.Fprintf(&b, "const normUnicodeVersion = %q\n\n", *version)
+
+	fmt.Fprintf(&b, "// The canonical combining class of each character which is not a starter.\n")
+	fmt.Fprintf(&b, "var combiningClasses = map[rune]uint8{\n")
+	keys := map[rune]bool{}
+	for c := range classes {
+		keys[c] = true
+	}
+	for i, c := range sortedRunes(keys) {
+		fmt.Fprintf(&b, "0x%04X: %d,", c, classes[c])
+		if i%6 == 5 {
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+	fmt.Fprintf(&b, "\n}\n\n")
+
+	fmt.Fprintf(&b, "// The single step decomposition of each character which has one.\n")
+	fmt.Fprintf(&b, "var decompositions = map[rune]decomposition{\n")
+	keys = map[rune]bool{}
+	for c := range decompositions {
+		keys[c] = true
+	}
+	for _, c := range sortedRunes(keys) {
+		d := decompositions[c]
+		var s strings.Builder
+		for _, r := range d.runes {
+			if r > 0xFFFF {
+				fmt.Fprintf(&s, "\\U%08X", r)
+			} else {
+				fmt.Fprintf(&s, "\\u%04X", r)
+			}
+		}
+		fmt.Fprintf(&b, "0x%04X: {%t, \"%s\"},\n", c, d.compat, s.String())
+	}
+	fmt.Fprintf(&b, "}\n\n")
+
+	fmt.Fprintf(&b, "// The characters which are excluded from composition in addition to\n")
+	fmt.Fprintf(&b, "// the singletons and the non-starter decompositions.\n")
+	fmt.Fprintf(&b, "var compositionExclusions = map[rune]bool{\n")
+	for i, c := range sortedRunes(exclusions) {
+		fmt.Fprintf(&b, "0x%04X: true,", c)
+		if i%6 == 5 {
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+	fmt.Fprintf(&b, "\n}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,338 @@
+// Package minify removes the comments and the white space of source text
+// which are not needed to lex it to the same tokens.
+//
+// The tokens keep their spelling. A space is only written between two
+// tokens which would otherwise lex differently, like two identifiers or
+// the two '-' of "a - -b". The NewLine tokens are kept, without the blank
+// lines, and the indentation of the Indent tokens is reduced to one space
+// per level. After the pre-processor directives of C, a new line is
+// written so that the directive ends where it did, and the space after
+// the name of a macro is kept.
+//
+// The minified text is lexed again and compared to the tokens of the
+// original text, so that Minify fails rather than returning text with
+// other tokens. Some languages give a meaning to the white space between
+// tokens which is not in their tokens, like the line breaks which end
+// statements in JavaScript and the spaces of the descendant selectors of
+// CSS. Options keeps them.
+package minify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"uno/lex"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// The options of Minify.
+type Options struct {
+	// If true, a new line is written between two tokens which are on
+	// different lines in the text.
+	KeepLineBreaks bool
+	// If true, a space is written between two tokens which are separated by
+	// white space or comments in the text.
+	KeepSpaces bool
+}
+
+// A token of the text, with what comes before it.
+type item struct {
+	kind     uint32
+	spelling string
+	// The indentation level if the token begins a logical line, or -1.
+	level int
+	// Whether there is white space, or a line break, between the token
+	// and the previous one.
+	space     bool
+	lineBreak bool
+}
+
+// The width of a tab in indentation, like in Python.
+const tabWidth = 8
+
+// Returns the width of the indentation |s|.
+func indentWidth(s string) int {
+	w := 0
+	for _, c := range s {
+		if c == '\t' {
+			w += tabWidth - w%tabWidth
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+// Returns the tokens of |text| without the comments and the layout tokens
+// other than NewLine, and with at most one NewLine in a row.
+func items(p *lex.Profile, text []byte) ([]item, error) {
+	tz, err := p.NewBytesTokenizer(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []item
+	// The widths of the open indentation levels.
+	indents := []int{0}
+	// The width of the Indent token of the current line.
+	indent := 0
+	// The depth of the brackets, in which indentation is not significant.
+	depth := 0
+	var end uint32
+	space, lineBreak := false, false
+
+	newLine := func() {
+		n := len(items)
+		if n > 0 && items[n-1].kind != token_kind.NewLine {
+			items = append(items, item{token_kind.NewLine, "\n", -1, space, lineBreak})
+		}
+		indent = 0
+		space, lineBreak = false, false
+	}
+
+	refs, err := lex.ReadRefs(tz)
+	if err != nil {
+		line, col := tz.TokenStart()
+		return nil, fmt.Errorf("Error at %d:%d: %s", line, col, err.Error())
+	}
+	for _, t := range refs {
+		gap := text[end:t.Start]
+		spelling := string(text[t.Start:t.End])
+		end = t.End
+		if len(gap) > 0 {
+			space = true
+		}
+		if bytes.IndexByte(gap, '\n') >= 0 {
+			lineBreak = true
+		}
+
+		switch {
+		case highlight.ClassOf(t.Kind) == highlight.Comment:
+			space = true
+			// The new line which ends a Python comment is not a NewLine
+			// token, but it ends the logical line out of brackets.
+			if t.Kind == token_kind.PySingleLineComment && depth == 0 {
+				newLine()
+			}
+			continue
+		case t.Kind == token_kind.LineJoin, t.Kind == token_kind.Tab:
+			space = true
+			continue
+		case t.Kind == token_kind.NewLine:
+			newLine()
+			continue
+		case t.Kind == token_kind.Indent:
+			indent = indentWidth(spelling)
+			continue
+		}
+
+		level := -1
+		n := len(items)
+		if depth == 0 && (n == 0 || items[n-1].kind == token_kind.NewLine) {
+			if indent > indents[len(indents)-1] {
+				indents = append(indents, indent)
+			}
+			for indent < indents[len(indents)-1] {
+				indents = indents[:len(indents)-1]
+			}
+			if indent != indents[len(indents)-1] {
+				// An inconsistent dedent, which is kept as a new level.
+				indents = append(indents, indent)
+			}
+			level = len(indents) - 1
+		}
+
+		switch t.Kind {
+		case token_kind.LeftParen, token_kind.LeftBracket, token_kind.LeftBrace:
+			depth++
+		case token_kind.RightParen, token_kind.RightBracket, token_kind.RightBrace:
+			if depth > 0 {
+				depth--
+			}
+		}
+		items = append(items, item{t.Kind, spelling, level, space, lineBreak})
+		space, lineBreak = false, false
+	}
+	return items, nil
+}
+
+// Returns true if the two tokens |a| and |b| written one after the other
+// lex differently.
+func merge(p *lex.Profile, a, b item, cache map[string]bool) bool {
+	key := a.spelling + "\x00" + b.spelling
+	if m, ok := cache[key]; ok {
+		return m
+	}
+
+	// The new line ends the last token, like an identifier which must be
+	// followed by a character.
+	text := []byte(a.spelling + b.spelling + "\n")
+	m := true
+	if tz, err := p.NewBytesTokenizer(text); err == nil {
+		// The tokens before an error, if any, do not match.
+		all, _ := lex.ReadRefs(tz)
+		var refs []lex.TokenRef
+		for _, t := range all {
+			if t.Kind != token_kind.NewLine {
+				refs = append(refs, t)
+			}
+		}
+		m = len(refs) != 2 ||
+			refs[0].Kind != a.kind || refs[0].End != uint32(len(a.spelling)) ||
+			refs[1].Kind != b.kind || refs[1].End != uint32(len(a.spelling)+len(b.spelling))
+	}
+	if len(key) < 64 {
+		cache[key] = m
+	}
+	return m
+}
+
+// Returns the text |text| of the language of |p| without its comments and
+// the white space which is not needed. Returns an error if the text cannot
+// be lexed, or if the minified text does not lex to the same tokens.
+func Minify(p *lex.Profile, text []byte, o *Options) ([]byte, error) {
+	if o == nil {
+		o = &Options{}
+	}
+	in, err := items(p, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	cache := map[string]bool{}
+	// Whether the current line is a pre-processor directive, and where a
+	// #define directive is: 1 before the name of the macro, and 2 after it.
+	// The space after the name is kept, as a macro without parameters
+	// would otherwise become a macro with parameters.
+	directive := false
+	define := 0
+	for i, it := range in {
+		if it.kind == token_kind.NewLine {
+			out.WriteByte('\n')
+			directive, define = false, 0
+			continue
+		}
+
+		// A directive like "# define" begins with a CPPStringify token.
+		isDirective := it.kind == token_kind.CPPDirective ||
+			(it.kind == token_kind.CPPStringify && (i == 0 || it.lineBreak))
+		atLineStart := out.Len() == 0 || out.Bytes()[out.Len()-1] == '\n'
+		switch {
+		case atLineStart:
+		case it.lineBreak && (directive || o.KeepLineBreaks), isDirective:
+			out.WriteByte('\n')
+			directive, define = false, 0
+		case it.space && (o.KeepSpaces || define == 2), merge(p, in[i-1], it, cache):
+			out.WriteByte(' ')
+		}
+		if it.level > 0 {
+			out.WriteString(strings.Repeat(" ", it.level))
+		}
+		out.WriteString(it.spelling)
+
+		switch {
+		case isDirective:
+			directive = true
+			if it.spelling == "#define" {
+				define = 1
+			}
+		case directive && define == 0 && in[i-1].kind == token_kind.CPPStringify && it.spelling == "define":
+			define = 1
+		case define == 1 && it.kind == token_kind.Identifier:
+			define = 2
+		default:
+			if define == 2 {
+				define = 0
+			}
+		}
+	}
+	// The text ends with a new line if it did, which also ends a last
+	// directive.
+	if n := out.Len(); n > 0 && out.Bytes()[n-1] != '\n' && bytes.HasSuffix(text, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+
+	if err := check(p, text, in, out.Bytes()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Returns the index of the logical line of each token of |text| which is
+// not a comment or a layout token. The lines are found from the positions
+// of the tokens rather than from the NewLine tokens: a token begins a
+// logical line if it is on a later line than the end of the previous one,
+// out of brackets and not after a LineJoin.
+func logicalLines(p *lex.Profile, text []byte) ([]int, error) {
+	tz, err := p.NewBytesTokenizer(text)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := lex.ReadRefs(tz)
+	if err != nil {
+		return nil, err
+	}
+	var lines []int
+	line, depth, endLine, joined := 0, 0, uint32(0), false
+	for _, t := range refs {
+		switch {
+		case t.Kind == token_kind.LineJoin:
+			joined = true
+			continue
+		case lex.IsLayout(t.Kind), highlight.ClassOf(t.Kind) == highlight.Comment:
+			continue
+		}
+		if len(lines) > 0 && depth == 0 && !joined && t.Line > endLine {
+			line++
+		}
+		lines = append(lines, line)
+		joined = false
+		endLine = t.Line + uint32(len(lex.SplitLines(text[t.Start:t.End]))-1)
+
+		switch t.Kind {
+		case token_kind.LeftParen, token_kind.LeftBracket, token_kind.LeftBrace:
+			depth++
+		case token_kind.RightParen, token_kind.RightBracket, token_kind.RightBrace:
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return lines, nil
+}
+
+// Returns an error if the tokens of |out| are not the tokens |in| of
+// |text|. In a language with NewLine tokens, the logical lines of the
+// tokens must also be the same.
+func check(p *lex.Profile, text []byte, in []item, out []byte) error {
+	got, err := items(p, out)
+	if err != nil {
+		return fmt.Errorf("The minified text cannot be lexed.\n%s", err.Error())
+	}
+	for i := 0; i < len(in) || i < len(got); i++ {
+		if i >= len(in) || i >= len(got) || in[i].kind != got[i].kind || in[i].spelling != got[i].spelling ||
+			in[i].level != got[i].level {
+			return fmt.Errorf("The minified text does not lex to the same tokens at token %d.", i)
+		}
+	}
+
+	if !p.TokenKindSet().Contains(token_kind.NewLine) {
+		return nil
+	}
+	want, err := logicalLines(p, text)
+	if err != nil {
+		return err
+	}
+	have, err := logicalLines(p, out)
+	if err != nil {
+		return fmt.Errorf("The minified text cannot be lexed.\n%s", err.Error())
+	}
+	for i := 0; i < len(want) && i < len(have); i++ {
+		if want[i] != have[i] {
+			return fmt.Errorf("The minified text does not have the same lines at token %d.", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package minify
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func minify(t *testing.T, p *lex.Profile, text string, o *Options) string {
+	out, err := Minify(p, []byte(text), o)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return string(out)
+}
+
+func readFile(t *testing.T, path string) string {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return string(text)
+}
+
+func TestMinifyPython(t *testing.T) {
+	out := minify(t, lex.PythonProfile, readFile(t, "test_data/sample.py"), nil)
+	expected := "\"\"\"Module docstring.\"\"\"\n" +
+		"import os\n" +
+		"class A(object):\n" +
+		" def f(self,name,\n" +
+		"other):\n" +
+		"  if name:\n" +
+		"   return-(-1)+2 .real\n" +
+		"  s=\"# not a comment\"\n" +
+		"  return s+name\n" +
+		" x=[1,\n" +
+		"2]\n"
+	if out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestMinifyC(t *testing.T) {
+	out := minify(t, lex.CProfile, readFile(t, "test_data/sample.c"), nil)
+	expected := "#include<stdio.h>\n" +
+		"#define TWICE(x)((x)+(x))\n" +
+		"int main(void){int a=1,b=- -a;printf(\"%d\\n\",a+++b);return TWICE(a)/ *&b;}\n"
+	if out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestMinifyOptions(t *testing.T) {
+	js := "let a = b\n(c || d).call()  /* call */\n"
+	if out := minify(t, lex.JavaScriptProfile, js, nil); out != "let a=b(c||d).call()\n" {
+		t.Errorf("Unexpected output %q.", out)
+	}
+	if out := minify(t, lex.JavaScriptProfile, js, &Options{KeepLineBreaks: true}); out != "let a=b\n(c||d).call()\n" {
+		t.Errorf("Unexpected output %q.", out)
+	}
+
+	css := "div .item , p {\n  color : red ;\n}\n"
+	if out := minify(t, lex.CSSProfile, css, &Options{KeepSpaces: true}); out != "div .item , p { color : red ; }\n" {
+		t.Errorf("Unexpected output %q.", out)
+	}
+}
+
+func TestMinifyDefine(t *testing.T) {
+	c := "#define X (1)\n#  define Y(a) (a)\n#define Z\tX\nint x = -X;\n"
+	expected := "#define X (1)\n# define Y(a)(a)\n#define Z X\nint x=-X;\n"
+	if out := minify(t, lex.CProfile, c, nil); out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestMinifyError(t *testing.T) {
+	if _, err := Minify(lex.PythonProfile, []byte("x = $\n"), nil); err == nil {
+		t.Errorf("Expected an error for '$'.")
+	}
+}
+
+func TestMinifyComments(t *testing.T) {
+	tests := []struct {
+		text, expected string
+	}{
+		{"x = 1 # c\ny = 2\n", "x=1\ny=2\n"},
+		{"def f():\n    x = 1  # c\n    return x\n", "def f():\n x=1\n return x\n"},
+		{"x = (1 # c\n, 2)\n", "x=(1,2)\n"},
+	}
+	for _, test := range tests {
+		if out := minify(t, lex.PythonProfile, test.text, nil); out != test.expected {
+			t.Errorf("Expected %q for %q, but got %q.", test.expected, test.text, out)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	in, err := items(lex.CProfile, []byte("a - -b;"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	text := []byte("a - -b;")
+	if err := check(lex.CProfile, text, in, []byte("a- -b;")); err != nil {
+		t.Error(err.Error())
+	}
+	err = check(lex.CProfile, text, in, []byte("a--b;"))
+	if err == nil || !strings.Contains(err.Error(), "at token 1") {
+		t.Errorf("Expected an error at the second token, but got %v.", err)
+	}
+}
+
+func TestCheckLines(t *testing.T) {
+	// The tokens of the output are the same, but not its lines.
+	out := []byte("x=1 y=2\n")
+	in, err := items(lex.PythonProfile, out)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = check(lex.PythonProfile, []byte("x = 1 # c\ny = 2\n"), in, out)
+	if err == nil || !strings.Contains(err.Error(), "same lines at token 3") {
+		t.Errorf("Expected an error at the fourth token, but got %v.", err)
+	}
+}
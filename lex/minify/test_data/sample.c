@@ -0,0 +1,10 @@
+/* A header. */
+#include <stdio.h>
+#define TWICE(x) \
+  ((x) + (x))
+
+int main(void) {
+  int a = 1, b = - -a; // Negation.
+  printf("%d\n", a+++b);
+  return TWICE(a) / *&b;
+}
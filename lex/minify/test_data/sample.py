@@ -0,0 +1,19 @@
+#!/usr/bin/env python
+"""Module docstring."""
+
+import os  # a comment
+
+
+class A(object):
+
+    def f(self, name,
+          other):
+        # Only a comment.
+        if name:
+		return -(-1) + 2 . real
+        s = "# not a comment"
+        return s + \
+            name
+
+    x = [1,
+         2]
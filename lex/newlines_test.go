@@ -0,0 +1,74 @@
+package lex
+
+import (
+	"bufio"
+	"os"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+var newLinesTokenKinds = []uint32{
+	token_kind.Identifier,
+	token_kind.BackQuoteString,
+	token_kind.NewLine,
+}
+
+func TestNewLineNormalisation(t *testing.T) {
+	ts := NewTokenKindSet(newLinesTokenKinds)
+
+	err := matchTokens("test_data/newlines_text", ts, []Token{
+		Token{token_kind.Identifier, "a", 1, 1},
+		Token{token_kind.NewLine, "\n", 1, 2},
+		Token{token_kind.Identifier, "b", 2, 1},
+		Token{token_kind.NewLine, "\n", 2, 2},
+		Token{token_kind.Identifier, "c", 3, 1},
+		Token{token_kind.NewLine, "\n", 3, 2},
+		Token{token_kind.Identifier, "d", 4, 1},
+		Token{token_kind.NewLine, "\n", 4, 2},
+		Token{token_kind.Identifier, "e", 5, 1},
+		Token{token_kind.NewLine, "\n", 5, 2},
+		Token{token_kind.BackQuoteString, "`x\ny`", 6, 1},
+		Token{token_kind.NewLine, "\n", 7, 3},
+	})
+
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestNewLineSpelling(t *testing.T) {
+	f, err := os.Open("test_data/newlines_text")
+	if err != nil {
+		t.Fatalf("Error opening test file. \n%s", err.Error())
+	}
+	defer f.Close()
+
+	ts := NewTokenKindSet(newLinesTokenKinds)
+	var goEsr GoESR
+	tz, err := NewTokenizer(bufio.NewReader(f), ts, goEsr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz.SetKeepNewLineSpelling(true)
+
+	expected := []string{"\r\n", "\r", "\u2028", "\u0085", "\n", "\r\n"}
+	var spellings []string
+	for tz.HasNext() {
+		tok, err := tz.NextToken()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if tok.Kind == token_kind.NewLine {
+			spellings = append(spellings, tok.Value)
+		}
+	}
+
+	if len(spellings) != len(expected) {
+		t.Fatalf("Expected %d new lines, but got %d.", len(expected), len(spellings))
+	}
+	for i, s := range spellings {
+		if s != expected[i] {
+			t.Errorf("Expected new line %d to be %q, but got %q.", i+1, expected[i], s)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package lex
+
+import "fmt"
+
+//go:generate go run maketables.go
+
+// The tables of norm_tables.go are generated by maketables.go from the
+// Unicode Character Database of unicode.Version, the version of the
+// tables of the letters and digits of identifiers.
+
+// A Unicode normalization form applied to the values of identifiers.
+type Normalization uint32
+
+const (
+	// The values of identifiers are as in the input.
+	NoNormalization = Normalization(iota)
+	// Normalization Form C, canonical decomposition followed by canonical
+	// composition.
+	NFC
+	// Normalization Form KC, compatibility decomposition followed by
+	// canonical composition. Python normalizes identifiers with NFKC.
+	NFKC
+)
+
+func (n Normalization) String() string {
+	switch n {
+	case NoNormalization:
+		return "none"
+	case NFC:
+		return "NFC"
+	case NFKC:
+		return "NFKC"
+	}
+	return fmt.Sprintf("Normalization(%d)", uint32(n))
+}
+
+type decomposition struct {
+	compat bool
+	runes  string
+}
+
+// The constants of the algorithmic decomposition of Hangul syllables.
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// The canonical compositions of pairs of characters, which are not
+// excluded from composition.
+var compositions = map[[2]rune]rune{}
+
+func init() {
+	for c, d := range decompositions {
+		if d.compat || compositionExclusions[c] || combiningClasses[c] != 0 {
+			continue
+		}
+		r := []rune(d.runes)
+		if len(r) != 2 || combiningClasses[r[0]] != 0 {
+			continue
+		}
+		compositions[[2]rune{r[0], r[1]}] = c
+	}
+}
+
+// Appends the full decomposition of |c| to |s| and returns it.
+func (n Normalization) decompose(s []rune, c rune) []rune {
+	if c >= hangulSBase && c < hangulSBase+hangulSCount {
+		i := c - hangulSBase
+		s = append(s, hangulLBase+i/hangulNCount, hangulVBase+(i%hangulNCount)/hangulTCount)
+		if t := i % hangulTCount; t != 0 {
+			s = append(s, hangulTBase+t)
+		}
+		return s
+	}
+
+	d, e := decompositions[c]
+	if !e || (d.compat && n != NFKC) {
+		return append(s, c)
+	}
+	for _, r := range d.runes {
+		s = n.decompose(s, r)
+	}
+	return s
+}
+
+// Returns the composition of |a| and |b|, or -1 if they do not compose.
+func compose(a, b rune) rune {
+	if a >= hangulLBase && a < hangulLBase+hangulLCount &&
+		b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+(b-hangulVBase))*hangulTCount
+	}
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + (b - hangulTBase)
+	}
+	if c, e := compositions[[2]rune{a, b}]; e {
+		return c
+	}
+	return -1
+}
+
+// Returns true if normalizing |s| can change it. Only characters below
+// U+00A0 are known to be unchanged by all the forms.
+func needsNormalization(s []rune) bool {
+	for _, c := range s {
+		if c >= 0xA0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the full decomposition of |s| in canonical order, which is the
+// NFD of |s| for NFC and the NFKD of |s| for NFKC.
+func (n Normalization) decomposeRunes(s []rune) []rune {
+	var d []rune
+	for _, c := range s {
+		d = n.decompose(d, c)
+	}
+
+	// Put the combining marks of each sequence in canonical order, with a
+	// stable insertion sort.
+	for i := 1; i < len(d); i++ {
+		cc := combiningClasses[d[i]]
+		if cc == 0 {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			pc := combiningClasses[d[j-1]]
+			if pc == 0 || pc <= cc {
+				break
+			}
+			d[j-1], d[j] = d[j], d[j-1]
+		}
+	}
+	return d
+}
+
+// Returns |s| in the normalization form |n|. The result may share the
+// memory of |s|.
+func (n Normalization) NormalizeRunes(s []rune) []rune {
+	if n == NoNormalization || !needsNormalization(s) {
+		return s
+	}
+	d := n.decomposeRunes(s)
+
+	// Compose each character with the last starter if it is not blocked
+	// from it.
+	starter := -1
+	var lastClass uint8
+	out := d[:0]
+	for _, c := range d {
+		cc := combiningClasses[c]
+		if starter >= 0 && (lastClass < cc || (lastClass == 0 && len(out) == starter+1)) {
+			if p := compose(out[starter], c); p >= 0 {
+				out[starter] = p
+				continue
+			}
+		}
+		if cc == 0 {
+			starter = len(out)
+		}
+		lastClass = cc
+		out = append(out, c)
+	}
+	return out
+}
+
+// Returns |s| in the normalization form |n|.
+func (n Normalization) Normalize(s string) string {
+	return string(n.NormalizeRunes([]rune(s)))
+}
@@ -0,0 +1,6109 @@
+// Code generated by maketables.go; DO NOT EDIT.
+
+package lex
+
+// The version of the Unicode Character Database of the tables.
+const normUnicodeVersion = "17.0.0"
+
+// The canonical combining class of each character which is not a starter.
+var combiningClasses = map[rune]uint8{
+	0x0300: 230, 0x0301: 230, 0x0302: 230, 0x0303: 230, 0x0304: 230, 0x0305: 230,
+	0x0306: 230, 0x0307: 230, 0x0308: 230, 0x0309: 230, 0x030A: 230, 0x030B: 230,
+	0x030C: 230, 0x030D: 230, 0x030E: 230, 0x030F: 230, 0x0310: 230, 0x0311: 230,
+	0x0312: 230, 0x0313: 230, 0x0314: 230, 0x0315: 232, 0x0316: 220, 0x0317: 220,
+	0x0318: 220, 0x0319: 220, 0x031A: 232, 0x031B: 216, 0x031C: 220, 0x031D: 220,
+	0x031E: 220, 0x031F: 220, 0x0320: 220, 0x0321: 202, 0x0322: 202, 0x0323: 220,
+	0x0324: 220, 0x0325: 220, 0x0326: 220, 0x0327: 202, 0x0328: 202, 0x0329: 220,
+	0x032A: 220, 0x032B: 220, 0x032C: 220, 0x032D: 220, 0x032E: 220, 0x032F: 220,
+	0x0330: 220, 0x0331: 220, 0x0332: 220, 0x0333: 220, 0x0334: 1, 0x0335: 1,
+	0x0336: 1, 0x0337: 1, 0x0338: 1, 0x0339: 220, 0x033A: 220, 0x033B: 220,
+	0x033C: 220, 0x033D: 230, 0x033E: 230, 0x033F: 230, 0x0340: 230, 0x0341: 230,
+	0x0342: 230, 0x0343: 230, 0x0344: 230, 0x0345: 240, 0x0346: 230, 0x0347: 220,
+	0x0348: 220, 0x0349: 220, 0x034A: 230, 0x034B: 230, 0x034C: 230, 0x034D: 220,
+	0x034E: 220, 0x0350: 230, 0x0351: 230, 0x0352: 230, 0x0353: 220, 0x0354: 220,
+	0x0355: 220, 0x0356: 220, 0x0357: 230, 0x0358: 232, 0x0359: 220, 0x035A: 220,
+	0x035B: 230, 0x035C: 233, 0x035D: 234, 0x035E: 234, 0x035F: 233, 0x0360: 234,
+	0x0361: 234, 0x0362: 233, 0x0363: 230, 0x0364: 230, 0x0365: 230, 0x0366: 230,
+	0x0367: 230, 0x0368: 230, 0x0369: 230, 0x036A: 230, 0x036B: 230, 0x036C: 230,
+	0x036D: 230, 0x036E: 230, 0x036F: 230, 0x0483: 230, 0x0484: 230, 0x0485: 230,
+	0x0486: 230, 0x0487: 230, 0x0591: 220, 0x0592: 230, 0x0593: 230, 0x0594: 230,
+	0x0595: 230, 0x0596: 220, 0x0597: 230, 0x0598: 230, 0x0599: 230, 0x059A: 222,
+	0x059B: 220, 0x059C: 230, 0x059D: 230, 0x059E: 230, 0x059F: 230, 0x05A0: 230,
+	0x05A1: 230, 0x05A2: 220, 0x05A3: 220, 0x05A4: 220, 0x05A5: 220, 0x05A6: 220,
+	0x05A7: 220, 0x05A8: 230, 0x05A9: 230, 0x05AA: 220, 0x05AB: 230, 0x05AC: 230,
+	0x05AD: 222, 0x05AE: 228, 0x05AF: 230, 0x05B0: 10, 0x05B1: 11, 0x05B2: 12,
+	0x05B3: 13, 0x05B4: 14, 0x05B5: 15, 0x05B6: 16, 0x05B7: 17, 0x05B8: 18,
+	0x05B9: 19, 0x05BA: 19, 0x05BB: 20, 0x05BC: 21, 0x05BD: 22, 0x05BF: 23,
+	0x05C1: 24, 0x05C2: 25, 0x05C4: 230, 0x05C5: 220, 0x05C7: 18, 0x0610: 230,
+	0x0611: 230, 0x0612: 230, 0x0613: 230, 0x0614: 230, 0x0615: 230, 0x0616: 230,
+	0x0617: 230, 0x0618: 30, 0x0619: 31, 0x061A: 32, 0x064B: 27, 0x064C: 28,
+	0x064D: 29, 0x064E: 30, 0x064F: 31, 0x0650: 32, 0x0651: 33, 0x0652: 34,
+	0x0653: 230, 0x0654: 230, 0x0655: 220, 0x0656: 220, 0x0657: 230, 0x0658: 230,
+	0x0659: 230, 0x065A: 230, 0x065B: 230, 0x065C: 220, 0x065D: 230, 0x065E: 230,
+	0x065F: 220, 0x0670: 35, 0x06D6: 230, 0x06D7: 230, 0x06D8: 230, 0x06D9: 230,
+	0x06DA: 230, 0x06DB: 230, 0x06DC: 230, 0x06DF: 230, 0x06E0: 230, 0x06E1: 230,
+	0x06E2: 230, 0x06E3: 220, 0x06E4: 230, 0x06E7: 230, 0x06E8: 230, 0x06EA: 220,
+	0x06EB: 230, 0x06EC: 230, 0x06ED: 220, 0x0711: 36, 0x0730: 230, 0x0731: 220,
+	0x0732: 230, 0x0733: 230, 0x0734: 220, 0x0735: 230, 0x0736: 230, 0x0737: 220,
+	0x0738: 220, 0x0739: 220, 0x073A: 230, 0x073B: 220, 0x073C: 220, 0x073D: 230,
+	0x073E: 220, 0x073F: 230, 0x0740: 230, 0x0741: 230, 0x0742: 220, 0x0743: 230,
+	0x0744: 220, 0x0745: 230, 0x0746: 220, 0x0747: 230, 0x0748: 220, 0x0749: 230,
+	0x074A: 230, 0x07EB: 230, 0x07EC: 230, 0x07ED: 230, 0x07EE: 230, 0x07EF: 230,
+	0x07F0: 230, 0x07F1: 230, 0x07F2: 220, 0x07F3: 230, 0x07FD: 220, 0x0816: 230,
+	0x0817: 230, 0x0818: 230, 0x0819: 230, 0x081B: 230, 0x081C: 230, 0x081D: 230,
+	0x081E: 230, 0x081F: 230, 0x0820: 230, 0x0821: 230, 0x0822: 230, 0x0823: 230,
+	0x0825: 230, 0x0826: 230, 0x0827: 230, 0x0829: 230, 0x082A: 230, 0x082B: 230,
+	0x082C: 230, 0x082D: 230, 0x0859: 220, 0x085A: 220, 0x085B: 220, 0x0897: 230,
+	0x0898: 230, 0x0899: 220, 0x089A: 220, 0x089B: 220, 0x089C: 230, 0x089D: 230,
+	0x089E: 230, 0x089F: 230, 0x08CA: 230, 0x08CB: 230, 0x08CC: 230, 0x08CD: 230,
+	0x08CE: 230, 0x08CF: 220, 0x08D0: 220, 0x08D1: 220, 0x08D2: 220, 0x08D3: 220,
+	0x08D4: 230, 0x08D5: 230, 0x08D6: 230, 0x08D7: 230, 0x08D8: 230, 0x08D9: 230,
+	0x08DA: 230, 0x08DB: 230, 0x08DC: 230, 0x08DD: 230, 0x08DE: 230, 0x08DF: 230,
+	0x08E0: 230, 0x08E1: 230, 0x08E3: 220, 0x08E4: 230, 0x08E5: 230, 0x08E6: 220,
+	0x08E7: 230, 0x08E8: 230, 0x08E9: 220, 0x08EA: 230, 0x08EB: 230, 0x08EC: 230,
+	0x08ED: 220, 0x08EE: 220, 0x08EF: 220, 0x08F0: 27, 0x08F1: 28, 0x08F2: 29,
+	0x08F3: 230, 0x08F4: 230, 0x08F5: 230, 0x08F6: 220, 0x08F7: 230, 0x08F8: 230,
+	0x08F9: 220, 0x08FA: 220, 0x08FB: 230, 0x08FC: 230, 0x08FD: 230, 0x08FE: 230,
+	0x08FF: 230, 0x093C: 7, 0x094D: 9, 0x0951: 230, 0x0952: 220, 0x0953: 230,
+	0x0954: 230, 0x09BC: 7, 0x09CD: 9, 0x09FE: 230, 0x0A3C: 7, 0x0A4D: 9,
+	0x0ABC: 7, 0x0ACD: 9, 0x0B3C: 7, 0x0B4D: 9, 0x0BCD: 9, 0x0C3C: 7,
+	0x0C4D: 9, 0x0C55: 84, 0x0C56: 91, 0x0CBC: 7, 0x0CCD: 9, 0x0D3B: 9,
+	0x0D3C: 9, 0x0D4D: 9, 0x0DCA: 9, 0x0E38: 103, 0x0E39: 103, 0x0E3A: 9,
+	0x0E48: 107, 0x0E49: 107, 0x0E4A: 107, 0x0E4B: 107, 0x0EB8: 118, 0x0EB9: 118,
+	0x0EBA: 9, 0x0EC8: 122, 0x0EC9: 122, 0x0ECA: 122, 0x0ECB: 122, 0x0F18: 220,
+	0x0F19: 220, 0x0F35: 220, 0x0F37: 220, 0x0F39: 216, 0x0F71: 129, 0x0F72: 130,
+	0x0F74: 132, 0x0F7A: 130, 0x0F7B: 130, 0x0F7C: 130, 0x0F7D: 130, 0x0F80: 130,
+	0x0F82: 230, 0x0F83: 230, 0x0F84: 9, 0x0F86: 230, 0x0F87: 230, 0x0FC6: 220,
+	0x1037: 7, 0x1039: 9, 0x103A: 9, 0x108D: 220, 0x135D: 230, 0x135E: 230,
+	0x135F: 230, 0x1714: 9, 0x1715: 9, 0x1734: 9, 0x17D2: 9, 0x17DD: 230,
+	0x18A9: 228, 0x1939: 222, 0x193A: 230, 0x193B: 220, 0x1A17: 230, 0x1A18: 220,
+	0x1A60: 9, 0x1A75: 230, 0x1A76: 230, 0x1A77: 230, 0x1A78: 230, 0x1A79: 230,
+	0x1A7A: 230, 0x1A7B: 230, 0x1A7C: 230, 0x1A7F: 220, 0x1AB0: 230, 0x1AB1: 230,
+	0x1AB2: 230, 0x1AB3: 230, 0x1AB4: 230, 0x1AB5: 220, 0x1AB6: 220, 0x1AB7: 220,
+	0x1AB8: 220, 0x1AB9: 220, 0x1ABA: 220, 0x1ABB: 230, 0x1ABC: 230, 0x1ABD: 220,
+	0x1ABF: 220, 0x1AC0: 220, 0x1AC1: 230, 0x1AC2: 230, 0x1AC3: 220, 0x1AC4: 220,
+	0x1AC5: 230, 0x1AC6: 230, 0x1AC7: 230, 0x1AC8: 230, 0x1AC9: 230, 0x1ACA: 220,
+	0x1ACB: 230, 0x1ACC: 230, 0x1ACD: 230, 0x1ACE: 230, 0x1ACF: 230, 0x1AD0: 230,
+	0x1AD1: 230, 0x1AD2: 230, 0x1AD3: 230, 0x1AD4: 230, 0x1AD5: 230, 0x1AD6: 230,
+	0x1AD7: 230, 0x1AD8: 230, 0x1AD9: 230, 0x1ADA: 230, 0x1ADB: 230, 0x1ADC: 230,
+	0x1ADD: 220, 0x1AE0: 230, 0x1AE1: 230, 0x1AE2: 230, 0x1AE3: 230, 0x1AE4: 230,
+	0x1AE5: 230, 0x1AE6: 220, 0x1AE7: 230, 0x1AE8: 230, 0x1AE9: 230, 0x1AEA: 230,
+	0x1AEB: 234, 0x1B34: 7, 0x1B44: 9, 0x1B6B: 230, 0x1B6C: 220, 0x1B6D: 230,
+	0x1B6E: 230, 0x1B6F: 230, 0x1B70: 230, 0x1B71: 230, 0x1B72: 230, 0x1B73: 230,
+	0x1BAA: 9, 0x1BAB: 9, 0x1BE6: 7, 0x1BF2: 9, 0x1BF3: 9, 0x1C37: 7,
+	0x1CD0: 230, 0x1CD1: 230, 0x1CD2: 230, 0x1CD4: 1, 0x1CD5: 220, 0x1CD6: 220,
+	0x1CD7: 220, 0x1CD8: 220, 0x1CD9: 220, 0x1CDA: 230, 0x1CDB: 230, 0x1CDC: 220,
+	0x1CDD: 220, 0x1CDE: 220, 0x1CDF: 220, 0x1CE0: 230, 0x1CE2: 1, 0x1CE3: 1,
+	0x1CE4: 1, 0x1CE5: 1, 0x1CE6: 1, 0x1CE7: 1, 0x1CE8: 1, 0x1CED: 220,
+	0x1CF4: 230, 0x1CF8: 230, 0x1CF9: 230, 0x1DC0: 230, 0x1DC1: 230, 0x1DC2: 220,
+	0x1DC3: 230, 0x1DC4: 230, 0x1DC5: 230, 0x1DC6: 230, 0x1DC7: 230, 0x1DC8: 230,
+	0x1DC9: 230, 0x1DCA: 220, 0x1DCB: 230, 0x1DCC: 230, 0x1DCD: 234, 0x1DCE: 214,
+	0x1DCF: 220, 0x1DD0: 202, 0x1DD1: 230, 0x1DD2: 230, 0x1DD3: 230, 0x1DD4: 230,
+	0x1DD5: 230, 0x1DD6: 230, 0x1DD7: 230, 0x1DD8: 230, 0x1DD9: 230, 0x1DDA: 230,
+	0x1DDB: 230, 0x1DDC: 230, 0x1DDD: 230, 0x1DDE: 230, 0x1DDF: 230, 0x1DE0: 230,
+	0x1DE1: 230, 0x1DE2: 230, 0x1DE3: 230, 0x1DE4: 230, 0x1DE5: 230, 0x1DE6: 230,
+	0x1DE7: 230, 0x1DE8: 230, 0x1DE9: 230, 0x1DEA: 230, 0x1DEB: 230, 0x1DEC: 230,
+	0x1DED: 230, 0x1DEE: 230, 0x1DEF: 230, 0x1DF0: 230, 0x1DF1: 230, 0x1DF2: 230,
+	0x1DF3: 230, 0x1DF4: 230, 0x1DF5: 230, 0x1DF6: 232, 0x1DF7: 228, 0x1DF8: 228,
+	0x1DF9: 220, 0x1DFA: 218, 0x1DFB: 230, 0x1DFC: 233, 0x1DFD: 220, 0x1DFE: 230,
+	0x1DFF: 220, 0x20D0: 230, 0x20D1: 230, 0x20D2: 1, 0x20D3: 1, 0x20D4: 230,
+	0x20D5: 230, 0x20D6: 230, 0x20D7: 230, 0x20D8: 1, 0x20D9: 1, 0x20DA: 1,
+	0x20DB: 230, 0x20DC: 230, 0x20E1: 230, 0x20E5: 1, 0x20E6: 1, 0x20E7: 230,
+	0x20E8: 220, 0x20E9: 230, 0x20EA: 1, 0x20EB: 1, 0x20EC: 220, 0x20ED: 220,
+	0x20EE: 220, 0x20EF: 220, 0x20F0: 230, 0x2CEF: 230, 0x2CF0: 230, 0x2CF1: 230,
+	0x2D7F: 9, 0x2DE0: 230, 0x2DE1: 230, 0x2DE2: 230, 0x2DE3: 230, 0x2DE4: 230,
+	0x2DE5: 230, 0x2DE6: 230, 0x2DE7: 230, 0x2DE8: 230, 0x2DE9: 230, 0x2DEA: 230,
+	0x2DEB: 230, 0x2DEC: 230, 0x2DED: 230, 0x2DEE: 230, 0x2DEF: 230, 0x2DF0: 230,
+	0x2DF1: 230, 0x2DF2: 230, 0x2DF3: 230, 0x2DF4: 230, 0x2DF5: 230, 0x2DF6: 230,
+	0x2DF7: 230, 0x2DF8: 230, 0x2DF9: 230, 0x2DFA: 230, 0x2DFB: 230, 0x2DFC: 230,
+	0x2DFD: 230, 0x2DFE: 230, 0x2DFF: 230, 0x302A: 218, 0x302B: 228, 0x302C: 232,
+	0x302D: 222, 0x302E: 224, 0x302F: 224, 0x3099: 8, 0x309A: 8, 0xA66F: 230,
+	0xA674: 230, 0xA675: 230, 0xA676: 230, 0xA677: 230, 0xA678: 230, 0xA679: 230,
+	0xA67A: 230, 0xA67B: 230, 0xA67C: 230, 0xA67D: 230, 0xA69E: 230, 0xA69F: 230,
+	0xA6F0: 230, 0xA6F1: 230, 0xA806: 9, 0xA82C: 9, 0xA8C4: 9, 0xA8E0: 230,
+	0xA8E1: 230, 0xA8E2: 230, 0xA8E3: 230, 0xA8E4: 230, 0xA8E5: 230, 0xA8E6: 230,
+	0xA8E7: 230, 0xA8E8: 230, 0xA8E9: 230, 0xA8EA: 230, 0xA8EB: 230, 0xA8EC: 230,
+	0xA8ED: 230, 0xA8EE: 230, 0xA8EF: 230, 0xA8F0: 230, 0xA8F1: 230, 0xA92B: 220,
+	0xA92C: 220, 0xA92D: 220, 0xA953: 9, 0xA9B3: 7, 0xA9C0: 9, 0xAAB0: 230,
+	0xAAB2: 230, 0xAAB3: 230, 0xAAB4: 220, 0xAAB7: 230, 0xAAB8: 230, 0xAABE: 230,
+	0xAABF: 230, 0xAAC1: 230, 0xAAF6: 9, 0xABED: 9, 0xFB1E: 26, 0xFE20: 230,
+	0xFE21: 230, 0xFE22: 230, 0xFE23: 230, 0xFE24: 230, 0xFE25: 230, 0xFE26: 230,
+	0xFE27: 220, 0xFE28: 220, 0xFE29: 220, 0xFE2A: 220, 0xFE2B: 220, 0xFE2C: 220,
+	0xFE2D: 220, 0xFE2E: 230, 0xFE2F: 230, 0x101FD: 220, 0x102E0: 220, 0x10376: 230,
+	0x10377: 230, 0x10378: 230, 0x10379: 230, 0x1037A: 230, 0x10A0D: 220, 0x10A0F: 230,
+	0x10A38: 230, 0x10A39: 1, 0x10A3A: 220, 0x10A3F: 9, 0x10AE5: 230, 0x10AE6: 220,
+	0x10D24: 230, 0x10D25: 230, 0x10D26: 230, 0x10D27: 230, 0x10D69: 230, 0x10D6A: 230,
+	0x10D6B: 230, 0x10D6C: 230, 0x10D6D: 230, 0x10EAB: 230, 0x10EAC: 230, 0x10EFA: 220,
+	0x10EFB: 220, 0x10EFD: 220, 0x10EFE: 220, 0x10EFF: 220, 0x10F46: 220, 0x10F47: 220,
+	0x10F48: 230, 0x10F49: 230, 0x10F4A: 230, 0x10F4B: 220, 0x10F4C: 230, 0x10F4D: 220,
+	0x10F4E: 220, 0x10F4F: 220, 0x10F50: 220, 0x10F82: 230, 0x10F83: 220, 0x10F84: 230,
+	0x10F85: 220, 0x11046: 9, 0x11070: 9, 0x1107F: 9, 0x110B9: 9, 0x110BA: 7,
+	0x11100: 230, 0x11101: 230, 0x11102: 230, 0x11133: 9, 0x11134: 9, 0x11173: 7,
+	0x111C0: 9, 0x111CA: 7, 0x11235: 9, 0x11236: 7, 0x112E9: 7, 0x112EA: 9,
+	0x1133B: 7, 0x1133C: 7, 0x1134D: 9, 0x11366: 230, 0x11367: 230, 0x11368: 230,
+	0x11369: 230, 0x1136A: 230, 0x1136B: 230, 0x1136C: 230, 0x11370: 230, 0x11371: 230,
+	0x11372: 230, 0x11373: 230, 0x11374: 230, 0x113CE: 9, 0x113CF: 9, 0x113D0: 9,
+	0x11442: 9, 0x11446: 7, 0x1145E: 230, 0x114C2: 9, 0x114C3: 7, 0x115BF: 9,
+	0x115C0: 7, 0x1163F: 9, 0x116B6: 9, 0x116B7: 7, 0x1172B: 9, 0x11839: 9,
+	0x1183A: 7, 0x1193D: 9, 0x1193E: 9, 0x11943: 7, 0x119E0: 9, 0x11A34: 9,
+	0x11A47: 9, 0x11A99: 9, 0x11C3F: 9, 0x11D42: 7, 0x11D44: 9, 0x11D45: 9,
+	0x11D97: 9, 0x11F41: 9, 0x11F42: 9, 0x1612F: 9, 0x16AF0: 1, 0x16AF1: 1,
+	0x16AF2: 1, 0x16AF3: 1, 0x16AF4: 1, 0x16B30: 230, 0x16B31: 230, 0x16B32: 230,
+	0x16B33: 230, 0x16B34: 230, 0x16B35: 230, 0x16B36: 230, 0x16FF0: 6, 0x16FF1: 6,
+	0x1BC9E: 1, 0x1D165: 216, 0x1D166: 216, 0x1D167: 1, 0x1D168: 1, 0x1D169: 1,
+	0x1D16D: 226, 0x1D16E: 216, 0x1D16F: 216, 0x1D170: 216, 0x1D171: 216, 0x1D172: 216,
+	0x1D17B: 220, 0x1D17C: 220, 0x1D17D: 220, 0x1D17E: 220, 0x1D17F: 220, 0x1D180: 220,
+	0x1D181: 220, 0x1D182: 220, 0x1D185: 230, 0x1D186: 230, 0x1D187: 230, 0x1D188: 230,
+	0x1D189: 230, 0x1D18A: 220, 0x1D18B: 220, 0x1D1AA: 230, 0x1D1AB: 230, 0x1D1AC: 230,
+	0x1D1AD: 230, 0x1D242: 230, 0x1D243: 230, 0x1D244: 230, 0x1E000: 230, 0x1E001: 230,
+	0x1E002: 230, 0x1E003: 230, 0x1E004: 230, 0x1E005: 230, 0x1E006: 230, 0x1E008: 230,
+	0x1E009: 230, 0x1E00A: 230, 0x1E00B: 230, 0x1E00C: 230, 0x1E00D: 230, 0x1E00E: 230,
+	0x1E00F: 230, 0x1E010: 230, 0x1E011: 230, 0x1E012: 230, 0x1E013: 230, 0x1E014: 230,
+	0x1E015: 230, 0x1E016: 230, 0x1E017: 230, 0x1E018: 230, 0x1E01B: 230, 0x1E01C: 230,
+	0x1E01D: 230, 0x1E01E: 230, 0x1E01F: 230, 0x1E020: 230, 0x1E021: 230, 0x1E023: 230,
+	0x1E024: 230, 0x1E026: 230, 0x1E027: 230, 0x1E028: 230, 0x1E029: 230, 0x1E02A: 230,
+	0x1E08F: 230, 0x1E130: 230, 0x1E131: 230, 0x1E132: 230, 0x1E133: 230, 0x1E134: 230,
+	0x1E135: 230, 0x1E136: 230, 0x1E2AE: 230, 0x1E2EC: 230, 0x1E2ED: 230, 0x1E2EE: 230,
+	0x1E2EF: 230, 0x1E4EC: 232, 0x1E4ED: 232, 0x1E4EE: 220, 0x1E4EF: 230, 0x1E5EE: 230,
+	0x1E5EF: 220, 0x1E6E3: 230, 0x1E6E6: 230, 0x1E6EE: 230, 0x1E6EF: 230, 0x1E6F5: 230,
+	0x1E8D0: 220, 0x1E8D1: 220, 0x1E8D2: 220, 0x1E8D3: 220, 0x1E8D4: 220, 0x1E8D5: 220,
+	0x1E8D6: 220, 0x1E944: 230, 0x1E945: 230, 0x1E946: 230, 0x1E947: 230, 0x1E948: 230,
+	0x1E949: 230, 0x1E94A: 7,
+}
+
+// The single step decomposition of each character which has one.
+var decompositions = map[rune]decomposition{
+	0x00A0:  {true, "\u0020"},
+	0x00A8:  {true, "\u0020\u0308"},
+	0x00AA:  {true, "\u0061"},
+	0x00AF:  {true, "\u0020\u0304"},
+	0x00B2:  {true, "\u0032"},
+	0x00B3:  {true, "\u0033"},
+	0x00B4:  {true, "\u0020\u0301"},
+	0x00B5:  {true, "\u03BC"},
+	0x00B8:  {true, "\u0020\u0327"},
+	0x00B9:  {true, "\u0031"},
+	0x00BA:  {true, "\u006F"},
+	0x00BC:  {true, "\u0031\u2044\u0034"},
+	0x00BD:  {true, "\u0031\u2044\u0032"},
+	0x00BE:  {true, "\u0033\u2044\u0034"},
+	0x00C0:  {false, "\u0041\u0300"},
+	0x00C1:  {false, "\u0041\u0301"},
+	0x00C2:  {false, "\u0041\u0302"},
+	0x00C3:  {false, "\u0041\u0303"},
+	0x00C4:  {false, "\u0041\u0308"},
+	0x00C5:  {false, "\u0041\u030A"},
+	0x00C7:  {false, "\u0043\u0327"},
+	0x00C8:  {false, "\u0045\u0300"},
+	0x00C9:  {false, "\u0045\u0301"},
+	0x00CA:  {false, "\u0045\u0302"},
+	0x00CB:  {false, "\u0045\u0308"},
+	0x00CC:  {false, "\u0049\u0300"},
+	0x00CD:  {false, "\u0049\u0301"},
+	0x00CE:  {false, "\u0049\u0302"},
+	0x00CF:  {false, "\u0049\u0308"},
+	0x00D1:  {false, "\u004E\u0303"},
+	0x00D2:  {false, "\u004F\u0300"},
+	0x00D3:  {false, "\u004F\u0301"},
+	0x00D4:  {false, "\u004F\u0302"},
+	0x00D5:  {false, "\u004F\u0303"},
+	0x00D6:  {false, "\u004F\u0308"},
+	0x00D9:  {false, "\u0055\u0300"},
+	0x00DA:  {false, "\u0055\u0301"},
+	0x00DB:  {false, "\u0055\u0302"},
+	0x00DC:  {false, "\u0055\u0308"},
+	0x00DD:  {false, "\u0059\u0301"},
+	0x00E0:  {false, "\u0061\u0300"},
+	0x00E1:  {false, "\u0061\u0301"},
+	0x00E2:  {false, "\u0061\u0302"},
+	0x00E3:  {false, "\u0061\u0303"},
+	0x00E4:  {false, "\u0061\u0308"},
+	0x00E5:  {false, "\u0061\u030A"},
+	0x00E7:  {false, "\u0063\u0327"},
+	0x00E8:  {false, "\u0065\u0300"},
+	0x00E9:  {false, "\u0065\u0301"},
+	0x00EA:  {false, "\u0065\u0302"},
+	0x00EB:  {false, "\u0065\u0308"},
+	0x00EC:  {false, "\u0069\u0300"},
+	0x00ED:  {false, "\u0069\u0301"},
+	0x00EE:  {false, "\u0069\u0302"},
+	0x00EF:  {false, "\u0069\u0308"},
+	0x00F1:  {false, "\u006E\u0303"},
+	0x00F2:  {false, "\u006F\u0300"},
+	0x00F3:  {false, "\u006F\u0301"},
+	0x00F4:  {false, "\u006F\u0302"},
+	0x00F5:  {false, "\u006F\u0303"},
+	0x00F6:  {false, "\u006F\u0308"},
+	0x00F9:  {false, "\u0075\u0300"},
+	0x00FA:  {false, "\u0075\u0301"},
+	0x00FB:  {false, "\u0075\u0302"},
+	0x00FC:  {false, "\u0075\u0308"},
+	0x00FD:  {false, "\u0079\u0301"},
+	0x00FF:  {false, "\u0079\u0308"},
+	0x0100:  {false, "\u0041\u0304"},
+	0x0101:  {false, "\u0061\u0304"},
+	0x0102:  {false, "\u0041\u0306"},
+	0x0103:  {false, "\u0061\u0306"},
+	0x0104:  {false, "\u0041\u0328"},
+	0x0105:  {false, "\u0061\u0328"},
+	0x0106:  {false, "\u0043\u0301"},
+	0x0107:  {false, "\u0063\u0301"},
+	0x0108:  {false, "\u0043\u0302"},
+	0x0109:  {false, "\u0063\u0302"},
+	0x010A:  {false, "\u0043\u0307"},
+	0x010B:  {false, "\u0063\u0307"},
+	0x010C:  {false, "\u0043\u030C"},
+	0x010D:  {false, "\u0063\u030C"},
+	0x010E:  {false, "\u0044\u030C"},
+	0x010F:  {false, "\u0064\u030C"},
+	0x0112:  {false, "\u0045\u0304"},
+	0x0113:  {false, "\u0065\u0304"},
+	0x0114:  {false, "\u0045\u0306"},
+	0x0115:  {false, "\u0065\u0306"},
+	0x0116:  {false, "\u0045\u0307"},
+	0x0117:  {false, "\u0065\u0307"},
+	0x0118:  {false, "\u0045\u0328"},
+	0x0119:  {false, "\u0065\u0328"},
+	0x011A:  {false, "\u0045\u030C"},
+	0x011B:  {false, "\u0065\u030C"},
+	0x011C:  {false, "\u0047\u0302"},
+	0x011D:  {false, "\u0067\u0302"},
+	0x011E:  {false, "\u0047\u0306"},
+	0x011F:  {false, "\u0067\u0306"},
+	0x0120:  {false, "\u0047\u0307"},
+	0x0121:  {false, "\u0067\u0307"},
+	0x0122:  {false, "\u0047\u0327"},
+	0x0123:  {false, "\u0067\u0327"},
+	0x0124:  {false, "\u0048\u0302"},
+	0x0125:  {false, "\u0068\u0302"},
+	0x0128:  {false, "\u0049\u0303"},
+	0x0129:  {false, "\u0069\u0303"},
+	0x012A:  {false, "\u0049\u0304"},
+	0x012B:  {false, "\u0069\u0304"},
+	0x012C:  {false, "\u0049\u0306"},
+	0x012D:  {false, "\u0069\u0306"},
+	0x012E:  {false, "\u0049\u0328"},
+	0x012F:  {false, "\u0069\u0328"},
+	0x0130:  {false, "\u0049\u0307"},
+	0x0132:  {true, "\u0049\u004A"},
+	0x0133:  {true, "\u0069\u006A"},
+	0x0134:  {false, "\u004A\u0302"},
+	0x0135:  {false, "\u006A\u0302"},
+	0x0136:  {false, "\u004B\u0327"},
+	0x0137:  {false, "\u006B\u0327"},
+	0x0139:  {false, "\u004C\u0301"},
+	0x013A:  {false, "\u006C\u0301"},
+	0x013B:  {false, "\u004C\u0327"},
+	0x013C:  {false, "\u006C\u0327"},
+	0x013D:  {false, "\u004C\u030C"},
+	0x013E:  {false, "\u006C\u030C"},
+	0x013F:  {true, "\u004C\u00B7"},
+	0x0140:  {true, "\u006C\u00B7"},
+	0x0143:  {false, "\u004E\u0301"},
+	0x0144:  {false, "\u006E\u0301"},
+	0x0145:  {false, "\u004E\u0327"},
+	0x0146:  {false, "\u006E\u0327"},
+	0x0147:  {false, "\u004E\u030C"},
+	0x0148:  {false, "\u006E\u030C"},
+	0x0149:  {true, "\u02BC\u006E"},
+	0x014C:  {false, "\u004F\u0304"},
+	0x014D:  {false, "\u006F\u0304"},
+	0x014E:  {false, "\u004F\u0306"},
+	0x014F:  {false, "\u006F\u0306"},
+	0x0150:  {false, "\u004F\u030B"},
+	0x0151:  {false, "\u006F\u030B"},
+	0x0154:  {false, "\u0052\u0301"},
+	0x0155:  {false, "\u0072\u0301"},
+	0x0156:  {false, "\u0052\u0327"},
+	0x0157:  {false, "\u0072\u0327"},
+	0x0158:  {false, "\u0052\u030C"},
+	0x0159:  {false, "\u0072\u030C"},
+	0x015A:  {false, "\u0053\u0301"},
+	0x015B:  {false, "\u0073\u0301"},
+	0x015C:  {false, "\u0053\u0302"},
+	0x015D:  {false, "\u0073\u0302"},
+	0x015E:  {false, "\u0053\u0327"},
+	0x015F:  {false, "\u0073\u0327"},
+	0x0160:  {false, "\u0053\u030C"},
+	0x0161:  {false, "\u0073\u030C"},
+	0x0162:  {false, "\u0054\u0327"},
+	0x0163:  {false, "\u0074\u0327"},
+	0x0164:  {false, "\u0054\u030C"},
+	0x0165:  {false, "\u0074\u030C"},
+	0x0168:  {false, "\u0055\u0303"},
+	0x0169:  {false, "\u0075\u0303"},
+	0x016A:  {false, "\u0055\u0304"},
+	0x016B:  {false, "\u0075\u0304"},
+	0x016C:  {false, "\u0055\u0306"},
+	0x016D:  {false, "\u0075\u0306"},
+	0x016E:  {false, "\u0055\u030A"},
+	0x016F:  {false, "\u0075\u030A"},
+	0x0170:  {false, "\u0055\u030B"},
+	0x0171:  {false, "\u0075\u030B"},
+	0x0172:  {false, "\u0055\u0328"},
+	0x0173:  {false, "\u0075\u0328"},
+	0x0174:  {false, "\u0057\u0302"},
+	0x0175:  {false, "\u0077\u0302"},
+	0x0176:  {false, "\u0059\u0302"},
+	0x0177:  {false, "\u0079\u0302"},
+	0x0178:  {false, "\u0059\u0308"},
+	0x0179:  {false, "\u005A\u0301"},
+	0x017A:  {false, "\u007A\u0301"},
+	0x017B:  {false, "\u005A\u0307"},
+	0x017C:  {false, "\u007A\u0307"},
+	0x017D:  {false, "\u005A\u030C"},
+	0x017E:  {false, "\u007A\u030C"},
+	0x017F:  {true, "\u0073"},
+	0x01A0:  {false, "\u004F\u031B"},
+	0x01A1:  {false, "\u006F\u031B"},
+	0x01AF:  {false, "\u0055\u031B"},
+	0x01B0:  {false, "\u0075\u031B"},
+	0x01C4:  {true, "\u0044\u005A\u030C"},
+	0x01C5:  {true, "\u0044\u007A\u030C"},
+	0x01C6:  {true, "\u0064\u007A\u030C"},
+	0x01C7:  {true, "\u004C\u004A"},
+	0x01C8:  {true, "\u004C\u006A"},
+	0x01C9:  {true, "\u006C\u006A"},
+	0x01CA:  {true, "\u004E\u004A"},
+	0x01CB:  {true, "\u004E\u006A"},
+	0x01CC:  {true, "\u006E\u006A"},
+	0x01CD:  {false, "\u0041\u030C"},
+	0x01CE:  {false, "\u0061\u030C"},
+	0x01CF:  {false, "\u0049\u030C"},
+	0x01D0:  {false, "\u0069\u030C"},
+	0x01D1:  {false, "\u004F\u030C"},
+	0x01D2:  {false, "\u006F\u030C"},
+	0x01D3:  {false, "\u0055\u030C"},
+	0x01D4:  {false, "\u0075\u030C"},
+	0x01D5:  {false, "\u00DC\u0304"},
+	0x01D6:  {false, "\u00FC\u0304"},
+	0x01D7:  {false, "\u00DC\u0301"},
+	0x01D8:  {false, "\u00FC\u0301"},
+	0x01D9:  {false, "\u00DC\u030C"},
+	0x01DA:  {false, "\u00FC\u030C"},
+	0x01DB:  {false, "\u00DC\u0300"},
+	0x01DC:  {false, "\u00FC\u0300"},
+	0x01DE:  {false, "\u00C4\u0304"},
+	0x01DF:  {false, "\u00E4\u0304"},
+	0x01E0:  {false, "\u0226\u0304"},
+	0x01E1:  {false, "\u0227\u0304"},
+	0x01E2:  {false, "\u00C6\u0304"},
+	0x01E3:  {false, "\u00E6\u0304"},
+	0x01E6:  {false, "\u0047\u030C"},
+	0x01E7:  {false, "\u0067\u030C"},
+	0x01E8:  {false, "\u004B\u030C"},
+	0x01E9:  {false, "\u006B\u030C"},
+	0x01EA:  {false, "\u004F\u0328"},
+	0x01EB:  {false, "\u006F\u0328"},
+	0x01EC:  {false, "\u01EA\u0304"},
+	0x01ED:  {false, "\u01EB\u0304"},
+	0x01EE:  {false, "\u01B7\u030C"},
+	0x01EF:  {false, "\u0292\u030C"},
+	0x01F0:  {false, "\u006A\u030C"},
+	0x01F1:  {true, "\u0044\u005A"},
+	0x01F2:  {true, "\u0044\u007A"},
+	0x01F3:  {true, "\u0064\u007A"},
+	0x01F4:  {false, "\u0047\u0301"},
+	0x01F5:  {false, "\u0067\u0301"},
+	0x01F8:  {false, "\u004E\u0300"},
+	0x01F9:  {false, "\u006E\u0300"},
+	0x01FA:  {false, "\u00C5\u0301"},
+	0x01FB:  {false, "\u00E5\u0301"},
+	0x01FC:  {false, "\u00C6\u0301"},
+	0x01FD:  {false, "\u00E6\u0301"},
+	0x01FE:  {false, "\u00D8\u0301"},
+	0x01FF:  {false, "\u00F8\u0301"},
+	0x0200:  {false, "\u0041\u030F"},
+	0x0201:  {false, "\u0061\u030F"},
+	0x0202:  {false, "\u0041\u0311"},
+	0x0203:  {false, "\u0061\u0311"},
+	0x0204:  {false, "\u0045\u030F"},
+	0x0205:  {false, "\u0065\u030F"},
+	0x0206:  {false, "\u0045\u0311"},
+	0x0207:  {false, "\u0065\u0311"},
+	0x0208:  {false, "\u0049\u030F"},
+	0x0209:  {false, "\u0069\u030F"},
+	0x020A:  {false, "\u0049\u0311"},
+	0x020B:  {false, "\u0069\u0311"},
+	0x020C:  {false, "\u004F\u030F"},
+	0x020D:  {false, "\u006F\u030F"},
+	0x020E:  {false, "\u004F\u0311"},
+	0x020F:  {false, "\u006F\u0311"},
+	0x0210:  {false, "\u0052\u030F"},
+	0x0211:  {false, "\u0072\u030F"},
+	0x0212:  {false, "\u0052\u0311"},
+	0x0213:  {false, "\u0072\u0311"},
+	0x0214:  {false, "\u0055\u030F"},
+	0x0215:  {false, "\u0075\u030F"},
+	0x0216:  {false, "\u0055\u0311"},
+	0x0217:  {false, "\u0075\u0311"},
+	0x0218:  {false, "\u0053\u0326"},
+	0x0219:  {false, "\u0073\u0326"},
+	0x021A:  {false, "\u0054\u0326"},
+	0x021B:  {false, "\u0074\u0326"},
+	0x021E:  {false, "\u0048\u030C"},
+	0x021F:  {false, "\u0068\u030C"},
+	0x0226:  {false, "\u0041\u0307"},
+	0x0227:  {false, "\u0061\u0307"},
+	0x0228:  {false, "\u0045\u0327"},
+	0x0229:  {false, "\u0065\u0327"},
+	0x022A:  {false, "\u00D6\u0304"},
+	0x022B:  {false, "\u00F6\u0304"},
+	0x022C:  {false, "\u00D5\u0304"},
+	0x022D:  {false, "\u00F5\u0304"},
+	0x022E:  {false, "\u004F\u0307"},
+	0x022F:  {false, "\u006F\u0307"},
+	0x0230:  {false, "\u022E\u0304"},
+	0x0231:  {false, "\u022F\u0304"},
+	0x0232:  {false, "\u0059\u0304"},
+	0x0233:  {false, "\u0079\u0304"},
+	0x02B0:  {true, "\u0068"},
+	0x02B1:  {true, "\u0266"},
+	0x02B2:  {true, "\u006A"},
+	0x02B3:  {true, "\u0072"},
+	0x02B4:  {true, "\u0279"},
+	0x02B5:  {true, "\u027B"},
+	0x02B6:  {true, "\u0281"},
+	0x02B7:  {true, "\u0077"},
+	0x02B8:  {true, "\u0079"},
+	0x02D8:  {true, "\u0020\u0306"},
+	0x02D9:  {true, "\u0020\u0307"},
+	0x02DA:  {true, "\u0020\u030A"},
+	0x02DB:  {true, "\u0020\u0328"},
+	0x02DC:  {true, "\u0020\u0303"},
+	0x02DD:  {true, "\u0020\u030B"},
+	0x02E0:  {true, "\u0263"},
+	0x02E1:  {true, "\u006C"},
+	0x02E2:  {true, "\u0073"},
+	0x02E3:  {true, "\u0078"},
+	0x02E4:  {true, "\u0295"},
+	0x0340:  {false, "\u0300"},
+	0x0341:  {false, "\u0301"},
+	0x0343:  {false, "\u0313"},
+	0x0344:  {false, "\u0308\u0301"},
+	0x0374:  {false, "\u02B9"},
+	0x037A:  {true, "\u0020\u0345"},
+	0x037E:  {false, "\u003B"},
+	0x0384:  {true, "\u0020\u0301"},
+	0x0385:  {false, "\u00A8\u0301"},
+	0x0386:  {false, "\u0391\u0301"},
+	0x0387:  {false, "\u00B7"},
+	0x0388:  {false, "\u0395\u0301"},
+	0x0389:  {false, "\u0397\u0301"},
+	0x038A:  {false, "\u0399\u0301"},
+	0x038C:  {false, "\u039F\u0301"},
+	0x038E:  {false, "\u03A5\u0301"},
+	0x038F:  {false, "\u03A9\u0301"},
+	0x0390:  {false, "\u03CA\u0301"},
+	0x03AA:  {false, "\u0399\u0308"},
+	0x03AB:  {false, "\u03A5\u0308"},
+	0x03AC:  {false, "\u03B1\u0301"},
+	0x03AD:  {false, "\u03B5\u0301"},
+	0x03AE:  {false, "\u03B7\u0301"},
+	0x03AF:  {false, "\u03B9\u0301"},
+	0x03B0:  {false, "\u03CB\u0301"},
+	0x03CA:  {false, "\u03B9\u0308"},
+	0x03CB:  {false, "\u03C5\u0308"},
+	0x03CC:  {false, "\u03BF\u0301"},
+	0x03CD:  {false, "\u03C5\u0301"},
+	0x03CE:  {false, "\u03C9\u0301"},
+	0x03D0:  {true, "\u03B2"},
+	0x03D1:  {true, "\u03B8"},
+	0x03D2:  {true, "\u03A5"},
+	0x03D3:  {false, "\u03D2\u0301"},
+	0x03D4:  {false, "\u03D2\u0308"},
+	0x03D5:  {true, "\u03C6"},
+	0x03D6:  {true, "\u03C0"},
+	0x03F0:  {true, "\u03BA"},
+	0x03F1:  {true, "\u03C1"},
+	0x03F2:  {true, "\u03C2"},
+	0x03F4:  {true, "\u0398"},
+	0x03F5:  {true, "\u03B5"},
+	0x03F9:  {true, "\u03A3"},
+	0x0400:  {false, "\u0415\u0300"},
+	0x0401:  {false, "\u0415\u0308"},
+	0x0403:  {false, "\u0413\u0301"},
+	0x0407:  {false, "\u0406\u0308"},
+	0x040C:  {false, "\u041A\u0301"},
+	0x040D:  {false, "\u0418\u0300"},
+	0x040E:  {false, "\u0423\u0306"},
+	0x0419:  {false, "\u0418\u0306"},
+	0x0439:  {false, "\u0438\u0306"},
+	0x0450:  {false, "\u0435\u0300"},
+	0x0451:  {false, "\u0435\u0308"},
+	0x0453:  {false, "\u0433\u0301"},
+	0x0457:  {false, "\u0456\u0308"},
+	0x045C:  {false, "\u043A\u0301"},
+	0x045D:  {false, "\u0438\u0300"},
+	0x045E:  {false, "\u0443\u0306"},
+	0x0476:  {false, "\u0474\u030F"},
+	0x0477:  {false, "\u0475\u030F"},
+	0x04C1:  {false, "\u0416\u0306"},
+	0x04C2:  {false, "\u0436\u0306"},
+	0x04D0:  {false, "\u0410\u0306"},
+	0x04D1:  {false, "\u0430\u0306"},
+	0x04D2:  {false, "\u0410\u0308"},
+	0x04D3:  {false, "\u0430\u0308"},
+	0x04D6:  {false, "\u0415\u0306"},
+	0x04D7:  {false, "\u0435\u0306"},
+	0x04DA:  {false, "\u04D8\u0308"},
+	0x04DB:  {false, "\u04D9\u0308"},
+	0x04DC:  {false, "\u0416\u0308"},
+	0x04DD:  {false, "\u0436\u0308"},
+	0x04DE:  {false, "\u0417\u0308"},
+	0x04DF:  {false, "\u0437\u0308"},
+	0x04E2:  {false, "\u0418\u0304"},
+	0x04E3:  {false, "\u0438\u0304"},
+	0x04E4:  {false, "\u0418\u0308"},
+	0x04E5:  {false, "\u0438\u0308"},
+	0x04E6:  {false, "\u041E\u0308"},
+	0x04E7:  {false, "\u043E\u0308"},
+	0x04EA:  {false, "\u04E8\u0308"},
+	0x04EB:  {false, "\u04E9\u0308"},
+	0x04EC:  {false, "\u042D\u0308"},
+	0x04ED:  {false, "\u044D\u0308"},
+	0x04EE:  {false, "\u0423\u0304"},
+	0x04EF:  {false, "\u0443\u0304"},
+	0x04F0:  {false, "\u0423\u0308"},
+	0x04F1:  {false, "\u0443\u0308"},
+	0x04F2:  {false, "\u0423\u030B"},
+	0x04F3:  {false, "\u0443\u030B"},
+	0x04F4:  {false, "\u0427\u0308"},
+	0x04F5:  {false, "\u0447\u0308"},
+	0x04F8:  {false, "\u042B\u0308"},
+	0x04F9:  {false, "\u044B\u0308"},
+	0x0587:  {true, "\u0565\u0582"},
+	0x0622:  {false, "\u0627\u0653"},
+	0x0623:  {false, "\u0627\u0654"},
+	0x0624:  {false, "\u0648\u0654"},
+	0x0625:  {false, "\u0627\u0655"},
+	0x0626:  {false, "\u064A\u0654"},
+	0x0675:  {true, "\u0627\u0674"},
+	0x0676:  {true, "\u0648\u0674"},
+	0x0677:  {true, "\u06C7\u0674"},
+	0x0678:  {true, "\u064A\u0674"},
+	0x06C0:  {false, "\u06D5\u0654"},
+	0x06C2:  {false, "\u06C1\u0654"},
+	0x06D3:  {false, "\u06D2\u0654"},
+	0x0929:  {false, "\u0928\u093C"},
+	0x0931:  {false, "\u0930\u093C"},
+	0x0934:  {false, "\u0933\u093C"},
+	0x0958:  {false, "\u0915\u093C"},
+	0x0959:  {false, "\u0916\u093C"},
+	0x095A:  {false, "\u0917\u093C"},
+	0x095B:  {false, "\u091C\u093C"},
+	0x095C:  {false, "\u0921\u093C"},
+	0x095D:  {false, "\u0922\u093C"},
+	0x095E:  {false, "\u092B\u093C"},
+	0x095F:  {false, "\u092F\u093C"},
+	0x09CB:  {false, "\u09C7\u09BE"},
+	0x09CC:  {false, "\u09C7\u09D7"},
+	0x09DC:  {false, "\u09A1\u09BC"},
+	0x09DD:  {false, "\u09A2\u09BC"},
+	0x09DF:  {false, "\u09AF\u09BC"},
+	0x0A33:  {false, "\u0A32\u0A3C"},
+	0x0A36:  {false, "\u0A38\u0A3C"},
+	0x0A59:  {false, "\u0A16\u0A3C"},
+	0x0A5A:  {false, "\u0A17\u0A3C"},
+	0x0A5B:  {false, "\u0A1C\u0A3C"},
+	0x0A5E:  {false, "\u0A2B\u0A3C"},
+	0x0B48:  {false, "\u0B47\u0B56"},
+	0x0B4B:  {false, "\u0B47\u0B3E"},
+	0x0B4C:  {false, "\u0B47\u0B57"},
+	0x0B5C:  {false, "\u0B21\u0B3C"},
+	0x0B5D:  {false, "\u0B22\u0B3C"},
+	0x0B94:  {false, "\u0B92\u0BD7"},
+	0x0BCA:  {false, "\u0BC6\u0BBE"},
+	0x0BCB:  {false, "\u0BC7\u0BBE"},
+	0x0BCC:  {false, "\u0BC6\u0BD7"},
+	0x0C48:  {false, "\u0C46\u0C56"},
+	0x0CC0:  {false, "\u0CBF\u0CD5"},
+	0x0CC7:  {false, "\u0CC6\u0CD5"},
+	0x0CC8:  {false, "\u0CC6\u0CD6"},
+	0x0CCA:  {false, "\u0CC6\u0CC2"},
+	0x0CCB:  {false, "\u0CCA\u0CD5"},
+	0x0D4A:  {false, "\u0D46\u0D3E"},
+	0x0D4B:  {false, "\u0D47\u0D3E"},
+	0x0D4C:  {false, "\u0D46\u0D57"},
+	0x0DDA:  {false, "\u0DD9\u0DCA"},
+	0x0DDC:  {false, "\u0DD9\u0DCF"},
+	0x0DDD:  {false, "\u0DDC\u0DCA"},
+	0x0DDE:  {false, "\u0DD9\u0DDF"},
+	0x0E33:  {true, "\u0E4D\u0E32"},
+	0x0EB3:  {true, "\u0ECD\u0EB2"},
+	0x0EDC:  {true, "\u0EAB\u0E99"},
+	0x0EDD:  {true, "\u0EAB\u0EA1"},
+	0x0F0C:  {true, "\u0F0B"},
+	0x0F43:  {false, "\u0F42\u0FB7"},
+	0x0F4D:  {false, "\u0F4C\u0FB7"},
+	0x0F52:  {false, "\u0F51\u0FB7"},
+	0x0F57:  {false, "\u0F56\u0FB7"},
+	0x0F5C:  {false, "\u0F5B\u0FB7"},
+	0x0F69:  {false, "\u0F40\u0FB5"},
+	0x0F73:  {false, "\u0F71\u0F72"},
+	0x0F75:  {false, "\u0F71\u0F74"},
+	0x0F76:  {false, "\u0FB2\u0F80"},
+	0x0F77:  {true, "\u0FB2\u0F71\u0F80"},
+	0x0F78:  {false, "\u0FB3\u0F80"},
+	0x0F79:  {true, "\u0FB3\u0F71\u0F80"},
+	0x0F81:  {false, "\u0F71\u0F80"},
+	0x0F93:  {false, "\u0F92\u0FB7"},
+	0x0F9D:  {false, "\u0F9C\u0FB7"},
+	0x0FA2:  {false, "\u0FA1\u0FB7"},
+	0x0FA7:  {false, "\u0FA6\u0FB7"},
+	0x0FAC:  {false, "\u0FAB\u0FB7"},
+	0x0FB9:  {false, "\u0F90\u0FB5"},
+	0x1026:  {false, "\u1025\u102E"},
+	0x10FC:  {true, "\u10DC"},
+	0x1B06:  {false, "\u1B05\u1B35"},
+	0x1B08:  {false, "\u1B07\u1B35"},
+	0x1B0A:  {false, "\u1B09\u1B35"},
+	0x1B0C:  {false, "\u1B0B\u1B35"},
+	0x1B0E:  {false, "\u1B0D\u1B35"},
+	0x1B12:  {false, "\u1B11\u1B35"},
+	0x1B3B:  {false, "\u1B3A\u1B35"},
+	0x1B3D:  {false, "\u1B3C\u1B35"},
+	0x1B40:  {false, "\u1B3E\u1B35"},
+	0x1B41:  {false, "\u1B3F\u1B35"},
+	0x1B43:  {false, "\u1B42\u1B35"},
+	0x1D2C:  {true, "\u0041"},
+	0x1D2D:  {true, "\u00C6"},
+	0x1D2E:  {true, "\u0042"},
+	0x1D30:  {true, "\u0044"},
+	0x1D31:  {true, "\u0045"},
+	0x1D32:  {true, "\u018E"},
+	0x1D33:  {true, "\u0047"},
+	0x1D34:  {true, "\u0048"},
+	0x1D35:  {true, "\u0049"},
+	0x1D36:  {true, "\u004A"},
+	0x1D37:  {true, "\u004B"},
+	0x1D38:  {true, "\u004C"},
+	0x1D39:  {true, "\u004D"},
+	0x1D3A:  {true, "\u004E"},
+	0x1D3C:  {true, "\u004F"},
+	0x1D3D:  {true, "\u0222"},
+	0x1D3E:  {true, "\u0050"},
+	0x1D3F:  {true, "\u0052"},
+	0x1D40:  {true, "\u0054"},
+	0x1D41:  {true, "\u0055"},
+	0x1D42:  {true, "\u0057"},
+	0x1D43:  {true, "\u0061"},
+	0x1D44:  {true, "\u0250"},
+	0x1D45:  {true, "\u0251"},
+	0x1D46:  {true, "\u1D02"},
+	0x1D47:  {true, "\u0062"},
+	0x1D48:  {true, "\u0064"},
+	0x1D49:  {true, "\u0065"},
+	0x1D4A:  {true, "\u0259"},
+	0x1D4B:  {true, "\u025B"},
+	0x1D4C:  {true, "\u025C"},
+	0x1D4D:  {true, "\u0067"},
+	0x1D4F:  {true, "\u006B"},
+	0x1D50:  {true, "\u006D"},
+	0x1D51:  {true, "\u014B"},
+	0x1D52:  {true, "\u006F"},
+	0x1D53:  {true, "\u0254"},
+	0x1D54:  {true, "\u1D16"},
+	0x1D55:  {true, "\u1D17"},
+	0x1D56:  {true, "\u0070"},
+	0x1D57:  {true, "\u0074"},
+	0x1D58:  {true, "\u0075"},
+	0x1D59:  {true, "\u1D1D"},
+	0x1D5A:  {true, "\u026F"},
+	0x1D5B:  {true, "\u0076"},
+	0x1D5C:  {true, "\u1D25"},
+	0x1D5D:  {true, "\u03B2"},
+	0x1D5E:  {true, "\u03B3"},
+	0x1D5F:  {true, "\u03B4"},
+	0x1D60:  {true, "\u03C6"},
+	0x1D61:  {true, "\u03C7"},
+	0x1D62:  {true, "\u0069"},
+	0x1D63:  {true, "\u0072"},
+	0x1D64:  {true, "\u0075"},
+	0x1D65:  {true, "\u0076"},
+	0x1D66:  {true, "\u03B2"},
+	0x1D67:  {true, "\u03B3"},
+	0x1D68:  {true, "\u03C1"},
+	0x1D69:  {true, "\u03C6"},
+	0x1D6A:  {true, "\u03C7"},
+	0x1D78:  {true, "\u043D"},
+	0x1D9B:  {true, "\u0252"},
+	0x1D9C:  {true, "\u0063"},
+	0x1D9D:  {true, "\u0255"},
+	0x1D9E:  {true, "\u00F0"},
+	0x1D9F:  {true, "\u025C"},
+	0x1DA0:  {true, "\u0066"},
+	0x1DA1:  {true, "\u025F"},
+	0x1DA2:  {true, "\u0261"},
+	0x1DA3:  {true, "\u0265"},
+	0x1DA4:  {true, "\u0268"},
+	0x1DA5:  {true, "\u0269"},
+	0x1DA6:  {true, "\u026A"},
+	0x1DA7:  {true, "\u1D7B"},
+	0x1DA8:  {true, "\u029D"},
+	0x1DA9:  {true, "\u026D"},
+	0x1DAA:  {true, "\u1D85"},
+	0x1DAB:  {true, "\u029F"},
+	0x1DAC:  {true, "\u0271"},
+	0x1DAD:  {true, "\u0270"},
+	0x1DAE:  {true, "\u0272"},
+	0x1DAF:  {true, "\u0273"},
+	0x1DB0:  {true, "\u0274"},
+	0x1DB1:  {true, "\u0275"},
+	0x1DB2:  {true, "\u0278"},
+	0x1DB3:  {true, "\u0282"},
+	0x1DB4:  {true, "\u0283"},
+	0x1DB5:  {true, "\u01AB"},
+	0x1DB6:  {true, "\u0289"},
+	0x1DB7:  {true, "\u028A"},
+	0x1DB8:  {true, "\u1D1C"},
+	0x1DB9:  {true, "\u028B"},
+	0x1DBA:  {true, "\u028C"},
+	0x1DBB:  {true, "\u007A"},
+	0x1DBC:  {true, "\u0290"},
+	0x1DBD:  {true, "\u0291"},
+	0x1DBE:  {true, "\u0292"},
+	0x1DBF:  {true, "\u03B8"},
+	0x1E00:  {false, "\u0041\u0325"},
+	0x1E01:  {false, "\u0061\u0325"},
+	0x1E02:  {false, "\u0042\u0307"},
+	0x1E03:  {false, "\u0062\u0307"},
+	0x1E04:  {false, "\u0042\u0323"},
+	0x1E05:  {false, "\u0062\u0323"},
+	0x1E06:  {false, "\u0042\u0331"},
+	0x1E07:  {false, "\u0062\u0331"},
+	0x1E08:  {false, "\u00C7\u0301"},
+	0x1E09:  {false, "\u00E7\u0301"},
+	0x1E0A:  {false, "\u0044\u0307"},
+	0x1E0B:  {false, "\u0064\u0307"},
+	0x1E0C:  {false, "\u0044\u0323"},
+	0x1E0D:  {false, "\u0064\u0323"},
+	0x1E0E:  {false, "\u0044\u0331"},
+	0x1E0F:  {false, "\u0064\u0331"},
+	0x1E10:  {false, "\u0044\u0327"},
+	0x1E11:  {false, "\u0064\u0327"},
+	0x1E12:  {false, "\u0044\u032D"},
+	0x1E13:  {false, "\u0064\u032D"},
+	0x1E14:  {false, "\u0112\u0300"},
+	0x1E15:  {false, "\u0113\u0300"},
+	0x1E16:  {false, "\u0112\u0301"},
+	0x1E17:  {false, "\u0113\u0301"},
+	0x1E18:  {false, "\u0045\u032D"},
+	0x1E19:  {false, "\u0065\u032D"},
+	0x1E1A:  {false, "\u0045\u0330"},
+	0x1E1B:  {false, "\u0065\u0330"},
+	0x1E1C:  {false, "\u0228\u0306"},
+	0x1E1D:  {false, "\u0229\u0306"},
+	0x1E1E:  {false, "\u0046\u0307"},
+	0x1E1F:  {false, "\u0066\u0307"},
+	0x1E20:  {false, "\u0047\u0304"},
+	0x1E21:  {false, "\u0067\u0304"},
+	0x1E22:  {false, "\u0048\u0307"},
+	0x1E23:  {false, "\u0068\u0307"},
+	0x1E24:  {false, "\u0048\u0323"},
+	0x1E25:  {false, "\u0068\u0323"},
+	0x1E26:  {false, "\u0048\u0308"},
+	0x1E27:  {false, "\u0068\u0308"},
+	0x1E28:  {false, "\u0048\u0327"},
+	0x1E29:  {false, "\u0068\u0327"},
+	0x1E2A:  {false, "\u0048\u032E"},
+	0x1E2B:  {false, "\u0068\u032E"},
+	0x1E2C:  {false, "\u0049\u0330"},
+	0x1E2D:  {false, "\u0069\u0330"},
+	0x1E2E:  {false, "\u00CF\u0301"},
+	0x1E2F:  {false, "\u00EF\u0301"},
+	0x1E30:  {false, "\u004B\u0301"},
+	0x1E31:  {false, "\u006B\u0301"},
+	0x1E32:  {false, "\u004B\u0323"},
+	0x1E33:  {false, "\u006B\u0323"},
+	0x1E34:  {false, "\u004B\u0331"},
+	0x1E35:  {false, "\u006B\u0331"},
+	0x1E36:  {false, "\u004C\u0323"},
+	0x1E37:  {false, "\u006C\u0323"},
+	0x1E38:  {false, "\u1E36\u0304"},
+	0x1E39:  {false, "\u1E37\u0304"},
+	0x1E3A:  {false, "\u004C\u0331"},
+	0x1E3B:  {false, "\u006C\u0331"},
+	0x1E3C:  {false, "\u004C\u032D"},
+	0x1E3D:  {false, "\u006C\u032D"},
+	0x1E3E:  {false, "\u004D\u0301"},
+	0x1E3F:  {false, "\u006D\u0301"},
+	0x1E40:  {false, "\u004D\u0307"},
+	0x1E41:  {false, "\u006D\u0307"},
+	0x1E42:  {false, "\u004D\u0323"},
+	0x1E43:  {false, "\u006D\u0323"},
+	0x1E44:  {false, "\u004E\u0307"},
+	0x1E45:  {false, "\u006E\u0307"},
+	0x1E46:  {false, "\u004E\u0323"},
+	0x1E47:  {false, "\u006E\u0323"},
+	0x1E48:  {false, "\u004E\u0331"},
+	0x1E49:  {false, "\u006E\u0331"},
+	0x1E4A:  {false, "\u004E\u032D"},
+	0x1E4B:  {false, "\u006E\u032D"},
+	0x1E4C:  {false, "\u00D5\u0301"},
+	0x1E4D:  {false, "\u00F5\u0301"},
+	0x1E4E:  {false, "\u00D5\u0308"},
+	0x1E4F:  {false, "\u00F5\u0308"},
+	0x1E50:  {false, "\u014C\u0300"},
+	0x1E51:  {false, "\u014D\u0300"},
+	0x1E52:  {false, "\u014C\u0301"},
+	0x1E53:  {false, "\u014D\u0301"},
+	0x1E54:  {false, "\u0050\u0301"},
+	0x1E55:  {false, "\u0070\u0301"},
+	0x1E56:  {false, "\u0050\u0307"},
+	0x1E57:  {false, "\u0070\u0307"},
+	0x1E58:  {false, "\u0052\u0307"},
+	0x1E59:  {false, "\u0072\u0307"},
+	0x1E5A:  {false, "\u0052\u0323"},
+	0x1E5B:  {false, "\u0072\u0323"},
+	0x1E5C:  {false, "\u1E5A\u0304"},
+	0x1E5D:  {false, "\u1E5B\u0304"},
+	0x1E5E:  {false, "\u0052\u0331"},
+	0x1E5F:  {false, "\u0072\u0331"},
+	0x1E60:  {false, "\u0053\u0307"},
+	0x1E61:  {false, "\u0073\u0307"},
+	0x1E62:  {false, "\u0053\u0323"},
+	0x1E63:  {false, "\u0073\u0323"},
+	0x1E64:  {false, "\u015A\u0307"},
+	0x1E65:  {false, "\u015B\u0307"},
+	0x1E66:  {false, "\u0160\u0307"},
+	0x1E67:  {false, "\u0161\u0307"},
+	0x1E68:  {false, "\u1E62\u0307"},
+	0x1E69:  {false, "\u1E63\u0307"},
+	0x1E6A:  {false, "\u0054\u0307"},
+	0x1E6B:  {false, "\u0074\u0307"},
+	0x1E6C:  {false, "\u0054\u0323"},
+	0x1E6D:  {false, "\u0074\u0323"},
+	0x1E6E:  {false, "\u0054\u0331"},
+	0x1E6F:  {false, "\u0074\u0331"},
+	0x1E70:  {false, "\u0054\u032D"},
+	0x1E71:  {false, "\u0074\u032D"},
+	0x1E72:  {false, "\u0055\u0324"},
+	0x1E73:  {false, "\u0075\u0324"},
+	0x1E74:  {false, "\u0055\u0330"},
+	0x1E75:  {false, "\u0075\u0330"},
+	0x1E76:  {false, "\u0055\u032D"},
+	0x1E77:  {false, "\u0075\u032D"},
+	0x1E78:  {false, "\u0168\u0301"},
+	0x1E79:  {false, "\u0169\u0301"},
+	0x1E7A:  {false, "\u016A\u0308"},
+	0x1E7B:  {false, "\u016B\u0308"},
+	0x1E7C:  {false, "\u0056\u0303"},
+	0x1E7D:  {false, "\u0076\u0303"},
+	0x1E7E:  {false, "\u0056\u0323"},
+	0x1E7F:  {false, "\u0076\u0323"},
+	0x1E80:  {false, "\u0057\u0300"},
+	0x1E81:  {false, "\u0077\u0300"},
+	0x1E82:  {false, "\u0057\u0301"},
+	0x1E83:  {false, "\u0077\u0301"},
+	0x1E84:  {false, "\u0057\u0308"},
+	0x1E85:  {false, "\u0077\u0308"},
+	0x1E86:  {false, "\u0057\u0307"},
+	0x1E87:  {false, "\u0077\u0307"},
+	0x1E88:  {false, "\u0057\u0323"},
+	0x1E89:  {false, "\u0077\u0323"},
+	0x1E8A:  {false, "\u0058\u0307"},
+	0x1E8B:  {false, "\u0078\u0307"},
+	0x1E8C:  {false, "\u0058\u0308"},
+	0x1E8D:  {false, "\u0078\u0308"},
+	0x1E8E:  {false, "\u0059\u0307"},
+	0x1E8F:  {false, "\u0079\u0307"},
+	0x1E90:  {false, "\u005A\u0302"},
+	0x1E91:  {false, "\u007A\u0302"},
+	0x1E92:  {false, "\u005A\u0323"},
+	0x1E93:  {false, "\u007A\u0323"},
+	0x1E94:  {false, "\u005A\u0331"},
+	0x1E95:  {false, "\u007A\u0331"},
+	0x1E96:  {false, "\u0068\u0331"},
+	0x1E97:  {false, "\u0074\u0308"},
+	0x1E98:  {false, "\u0077\u030A"},
+	0x1E99:  {false, "\u0079\u030A"},
+	0x1E9A:  {true, "\u0061\u02BE"},
+	0x1E9B:  {false, "\u017F\u0307"},
+	0x1EA0:  {false, "\u0041\u0323"},
+	0x1EA1:  {false, "\u0061\u0323"},
+	0x1EA2:  {false, "\u0041\u0309"},
+	0x1EA3:  {false, "\u0061\u0309"},
+	0x1EA4:  {false, "\u00C2\u0301"},
+	0x1EA5:  {false, "\u00E2\u0301"},
+	0x1EA6:  {false, "\u00C2\u0300"},
+	0x1EA7:  {false, "\u00E2\u0300"},
+	0x1EA8:  {false, "\u00C2\u0309"},
+	0x1EA9:  {false, "\u00E2\u0309"},
+	0x1EAA:  {false, "\u00C2\u0303"},
+	0x1EAB:  {false, "\u00E2\u0303"},
+	0x1EAC:  {false, "\u1EA0\u0302"},
+	0x1EAD:  {false, "\u1EA1\u0302"},
+	0x1EAE:  {false, "\u0102\u0301"},
+	0x1EAF:  {false, "\u0103\u0301"},
+	0x1EB0:  {false, "\u0102\u0300"},
+	0x1EB1:  {false, "\u0103\u0300"},
+	0x1EB2:  {false, "\u0102\u0309"},
+	0x1EB3:  {false, "\u0103\u0309"},
+	0x1EB4:  {false, "\u0102\u0303"},
+	0x1EB5:  {false, "\u0103\u0303"},
+	0x1EB6:  {false, "\u1EA0\u0306"},
+	0x1EB7:  {false, "\u1EA1\u0306"},
+	0x1EB8:  {false, "\u0045\u0323"},
+	0x1EB9:  {false, "\u0065\u0323"},
+	0x1EBA:  {false, "\u0045\u0309"},
+	0x1EBB:  {false, "\u0065\u0309"},
+	0x1EBC:  {false, "\u0045\u0303"},
+	0x1EBD:  {false, "\u0065\u0303"},
+	0x1EBE:  {false, "\u00CA\u0301"},
+	0x1EBF:  {false, "\u00EA\u0301"},
+	0x1EC0:  {false, "\u00CA\u0300"},
+	0x1EC1:  {false, "\u00EA\u0300"},
+	0x1EC2:  {false, "\u00CA\u0309"},
+	0x1EC3:  {false, "\u00EA\u0309"},
+	0x1EC4:  {false, "\u00CA\u0303"},
+	0x1EC5:  {false, "\u00EA\u0303"},
+	0x1EC6:  {false, "\u1EB8\u0302"},
+	0x1EC7:  {false, "\u1EB9\u0302"},
+	0x1EC8:  {false, "\u0049\u0309"},
+	0x1EC9:  {false, "\u0069\u0309"},
+	0x1ECA:  {false, "\u0049\u0323"},
+	0x1ECB:  {false, "\u0069\u0323"},
+	0x1ECC:  {false, "\u004F\u0323"},
+	0x1ECD:  {false, "\u006F\u0323"},
+	0x1ECE:  {false, "\u004F\u0309"},
+	0x1ECF:  {false, "\u006F\u0309"},
+	0x1ED0:  {false, "\u00D4\u0301"},
+	0x1ED1:  {false, "\u00F4\u0301"},
+	0x1ED2:  {false, "\u00D4\u0300"},
+	0x1ED3:  {false, "\u00F4\u0300"},
+	0x1ED4:  {false, "\u00D4\u0309"},
+	0x1ED5:  {false, "\u00F4\u0309"},
+	0x1ED6:  {false, "\u00D4\u0303"},
+	0x1ED7:  {false, "\u00F4\u0303"},
+	0x1ED8:  {false, "\u1ECC\u0302"},
+	0x1ED9:  {false, "\u1ECD\u0302"},
+	0x1EDA:  {false, "\u01A0\u0301"},
+	0x1EDB:  {false, "\u01A1\u0301"},
+	0x1EDC:  {false, "\u01A0\u0300"},
+	0x1EDD:  {false, "\u01A1\u0300"},
+	0x1EDE:  {false, "\u01A0\u0309"},
+	0x1EDF:  {false, "\u01A1\u0309"},
+	0x1EE0:  {false, "\u01A0\u0303"},
+	0x1EE1:  {false, "\u01A1\u0303"},
+	0x1EE2:  {false, "\u01A0\u0323"},
+	0x1EE3:  {false, "\u01A1\u0323"},
+	0x1EE4:  {false, "\u0055\u0323"},
+	0x1EE5:  {false, "\u0075\u0323"},
+	0x1EE6:  {false, "\u0055\u0309"},
+	0x1EE7:  {false, "\u0075\u0309"},
+	0x1EE8:  {false, "\u01AF\u0301"},
+	0x1EE9:  {false, "\u01B0\u0301"},
+	0x1EEA:  {false, "\u01AF\u0300"},
+	0x1EEB:  {false, "\u01B0\u0300"},
+	0x1EEC:  {false, "\u01AF\u0309"},
+	0x1EED:  {false, "\u01B0\u0309"},
+	0x1EEE:  {false, "\u01AF\u0303"},
+	0x1EEF:  {false, "\u01B0\u0303"},
+	0x1EF0:  {false, "\u01AF\u0323"},
+	0x1EF1:  {false, "\u01B0\u0323"},
+	0x1EF2:  {false, "\u0059\u0300"},
+	0x1EF3:  {false, "\u0079\u0300"},
+	0x1EF4:  {false, "\u0059\u0323"},
+	0x1EF5:  {false, "\u0079\u0323"},
+	0x1EF6:  {false, "\u0059\u0309"},
+	0x1EF7:  {false, "\u0079\u0309"},
+	0x1EF8:  {false, "\u0059\u0303"},
+	0x1EF9:  {false, "\u0079\u0303"},
+	0x1F00:  {false, "\u03B1\u0313"},
+	0x1F01:  {false, "\u03B1\u0314"},
+	0x1F02:  {false, "\u1F00\u0300"},
+	0x1F03:  {false, "\u1F01\u0300"},
+	0x1F04:  {false, "\u1F00\u0301"},
+	0x1F05:  {false, "\u1F01\u0301"},
+	0x1F06:  {false, "\u1F00\u0342"},
+	0x1F07:  {false, "\u1F01\u0342"},
+	0x1F08:  {false, "\u0391\u0313"},
+	0x1F09:  {false, "\u0391\u0314"},
+	0x1F0A:  {false, "\u1F08\u0300"},
+	0x1F0B:  {false, "\u1F09\u0300"},
+	0x1F0C:  {false, "\u1F08\u0301"},
+	0x1F0D:  {false, "\u1F09\u0301"},
+	0x1F0E:  {false, "\u1F08\u0342"},
+	0x1F0F:  {false, "\u1F09\u0342"},
+	0x1F10:  {false, "\u03B5\u0313"},
+	0x1F11:  {false, "\u03B5\u0314"},
+	0x1F12:  {false, "\u1F10\u0300"},
+	0x1F13:  {false, "\u1F11\u0300"},
+	0x1F14:  {false, "\u1F10\u0301"},
+	0x1F15:  {false, "\u1F11\u0301"},
+	0x1F18:  {false, "\u0395\u0313"},
+	0x1F19:  {false, "\u0395\u0314"},
+	0x1F1A:  {false, "\u1F18\u0300"},
+	0x1F1B:  {false, "\u1F19\u0300"},
+	0x1F1C:  {false, "\u1F18\u0301"},
+	0x1F1D:  {false, "\u1F19\u0301"},
+	0x1F20:  {false, "\u03B7\u0313"},
+	0x1F21:  {false, "\u03B7\u0314"},
+	0x1F22:  {false, "\u1F20\u0300"},
+	0x1F23:  {false, "\u1F21\u0300"},
+	0x1F24:  {false, "\u1F20\u0301"},
+	0x1F25:  {false, "\u1F21\u0301"},
+	0x1F26:  {false, "\u1F20\u0342"},
+	0x1F27:  {false, "\u1F21\u0342"},
+	0x1F28:  {false, "\u0397\u0313"},
+	0x1F29:  {false, "\u0397\u0314"},
+	0x1F2A:  {false, "\u1F28\u0300"},
+	0x1F2B:  {false, "\u1F29\u0300"},
+	0x1F2C:  {false, "\u1F28\u0301"},
+	0x1F2D:  {false, "\u1F29\u0301"},
+	0x1F2E:  {false, "\u1F28\u0342"},
+	0x1F2F:  {false, "\u1F29\u0342"},
+	0x1F30:  {false, "\u03B9\u0313"},
+	0x1F31:  {false, "\u03B9\u0314"},
+	0x1F32:  {false, "\u1F30\u0300"},
+	0x1F33:  {false, "\u1F31\u0300"},
+	0x1F34:  {false, "\u1F30\u0301"},
+	0x1F35:  {false, "\u1F31\u0301"},
+	0x1F36:  {false, "\u1F30\u0342"},
+	0x1F37:  {false, "\u1F31\u0342"},
+	0x1F38:  {false, "\u0399\u0313"},
+	0x1F39:  {false, "\u0399\u0314"},
+	0x1F3A:  {false, "\u1F38\u0300"},
+	0x1F3B:  {false, "\u1F39\u0300"},
+	0x1F3C:  {false, "\u1F38\u0301"},
+	0x1F3D:  {false, "\u1F39\u0301"},
+	0x1F3E:  {false, "\u1F38\u0342"},
+	0x1F3F:  {false, "\u1F39\u0342"},
+	0x1F40:  {false, "\u03BF\u0313"},
+	0x1F41:  {false, "\u03BF\u0314"},
+	0x1F42:  {false, "\u1F40\u0300"},
+	0x1F43:  {false, "\u1F41\u0300"},
+	0x1F44:  {false, "\u1F40\u0301"},
+	0x1F45:  {false, "\u1F41\u0301"},
+	0x1F48:  {false, "\u039F\u0313"},
+	0x1F49:  {false, "\u039F\u0314"},
+	0x1F4A:  {false, "\u1F48\u0300"},
+	0x1F4B:  {false, "\u1F49\u0300"},
+	0x1F4C:  {false, "\u1F48\u0301"},
+	0x1F4D:  {false, "\u1F49\u0301"},
+	0x1F50:  {false, "\u03C5\u0313"},
+	0x1F51:  {false, "\u03C5\u0314"},
+	0x1F52:  {false, "\u1F50\u0300"},
+	0x1F53:  {false, "\u1F51\u0300"},
+	0x1F54:  {false, "\u1F50\u0301"},
+	0x1F55:  {false, "\u1F51\u0301"},
+	0x1F56:  {false, "\u1F50\u0342"},
+	0x1F57:  {false, "\u1F51\u0342"},
+	0x1F59:  {false, "\u03A5\u0314"},
+	0x1F5B:  {false, "\u1F59\u0300"},
+	0x1F5D:  {false, "\u1F59\u0301"},
+	0x1F5F:  {false, "\u1F59\u0342"},
+	0x1F60:  {false, "\u03C9\u0313"},
+	0x1F61:  {false, "\u03C9\u0314"},
+	0x1F62:  {false, "\u1F60\u0300"},
+	0x1F63:  {false, "\u1F61\u0300"},
+	0x1F64:  {false, "\u1F60\u0301"},
+	0x1F65:  {false, "\u1F61\u0301"},
+	0x1F66:  {false, "\u1F60\u0342"},
+	0x1F67:  {false, "\u1F61\u0342"},
+	0x1F68:  {false, "\u03A9\u0313"},
+	0x1F69:  {false, "\u03A9\u0314"},
+	0x1F6A:  {false, "\u1F68\u0300"},
+	0x1F6B:  {false, "\u1F69\u0300"},
+	0x1F6C:  {false, "\u1F68\u0301"},
+	0x1F6D:  {false, "\u1F69\u0301"},
+	0x1F6E:  {false, "\u1F68\u0342"},
+	0x1F6F:  {false, "\u1F69\u0342"},
+	0x1F70:  {false, "\u03B1\u0300"},
+	0x1F71:  {false, "\u03AC"},
+	0x1F72:  {false, "\u03B5\u0300"},
+	0x1F73:  {false, "\u03AD"},
+	0x1F74:  {false, "\u03B7\u0300"},
+	0x1F75:  {false, "\u03AE"},
+	0x1F76:  {false, "\u03B9\u0300"},
+	0x1F77:  {false, "\u03AF"},
+	0x1F78:  {false, "\u03BF\u0300"},
+	0x1F79:  {false, "\u03CC"},
+	0x1F7A:  {false, "\u03C5\u0300"},
+	0x1F7B:  {false, "\u03CD"},
+	0x1F7C:  {false, "\u03C9\u0300"},
+	0x1F7D:  {false, "\u03CE"},
+	0x1F80:  {false, "\u1F00\u0345"},
+	0x1F81:  {false, "\u1F01\u0345"},
+	0x1F82:  {false, "\u1F02\u0345"},
+	0x1F83:  {false, "\u1F03\u0345"},
+	0x1F84:  {false, "\u1F04\u0345"},
+	0x1F85:  {false, "\u1F05\u0345"},
+	0x1F86:  {false, "\u1F06\u0345"},
+	0x1F87:  {false, "\u1F07\u0345"},
+	0x1F88:  {false, "\u1F08\u0345"},
+	0x1F89:  {false, "\u1F09\u0345"},
+	0x1F8A:  {false, "\u1F0A\u0345"},
+	0x1F8B:  {false, "\u1F0B\u0345"},
+	0x1F8C:  {false, "\u1F0C\u0345"},
+	0x1F8D:  {false, "\u1F0D\u0345"},
+	0x1F8E:  {false, "\u1F0E\u0345"},
+	0x1F8F:  {false, "\u1F0F\u0345"},
+	0x1F90:  {false, "\u1F20\u0345"},
+	0x1F91:  {false, "\u1F21\u0345"},
+	0x1F92:  {false, "\u1F22\u0345"},
+	0x1F93:  {false, "\u1F23\u0345"},
+	0x1F94:  {false, "\u1F24\u0345"},
+	0x1F95:  {false, "\u1F25\u0345"},
+	0x1F96:  {false, "\u1F26\u0345"},
+	0x1F97:  {false, "\u1F27\u0345"},
+	0x1F98:  {false, "\u1F28\u0345"},
+	0x1F99:  {false, "\u1F29\u0345"},
+	0x1F9A:  {false, "\u1F2A\u0345"},
+	0x1F9B:  {false, "\u1F2B\u0345"},
+	0x1F9C:  {false, "\u1F2C\u0345"},
+	0x1F9D:  {false, "\u1F2D\u0345"},
+	0x1F9E:  {false, "\u1F2E\u0345"},
+	0x1F9F:  {false, "\u1F2F\u0345"},
+	0x1FA0:  {false, "\u1F60\u0345"},
+	0x1FA1:  {false, "\u1F61\u0345"},
+	0x1FA2:  {false, "\u1F62\u0345"},
+	0x1FA3:  {false, "\u1F63\u0345"},
+	0x1FA4:  {false, "\u1F64\u0345"},
+	0x1FA5:  {false, "\u1F65\u0345"},
+	0x1FA6:  {false, "\u1F66\u0345"},
+	0x1FA7:  {false, "\u1F67\u0345"},
+	0x1FA8:  {false, "\u1F68\u0345"},
+	0x1FA9:  {false, "\u1F69\u0345"},
+	0x1FAA:  {false, "\u1F6A\u0345"},
+	0x1FAB:  {false, "\u1F6B\u0345"},
+	0x1FAC:  {false, "\u1F6C\u0345"},
+	0x1FAD:  {false, "\u1F6D\u0345"},
+	0x1FAE:  {false, "\u1F6E\u0345"},
+	0x1FAF:  {false, "\u1F6F\u0345"},
+	0x1FB0:  {false, "\u03B1\u0306"},
+	0x1FB1:  {false, "\u03B1\u0304"},
+	0x1FB2:  {false, "\u1F70\u0345"},
+	0x1FB3:  {false, "\u03B1\u0345"},
+	0x1FB4:  {false, "\u03AC\u0345"},
+	0x1FB6:  {false, "\u03B1\u0342"},
+	0x1FB7:  {false, "\u1FB6\u0345"},
+	0x1FB8:  {false, "\u0391\u0306"},
+	0x1FB9:  {false, "\u0391\u0304"},
+	0x1FBA:  {false, "\u0391\u0300"},
+	0x1FBB:  {false, "\u0386"},
+	0x1FBC:  {false, "\u0391\u0345"},
+	0x1FBD:  {true, "\u0020\u0313"},
+	0x1FBE:  {false, "\u03B9"},
+	0x1FBF:  {true, "\u0020\u0313"},
+	0x1FC0:  {true, "\u0020\u0342"},
+	0x1FC1:  {false, "\u00A8\u0342"},
+	0x1FC2:  {false, "\u1F74\u0345"},
+	0x1FC3:  {false, "\u03B7\u0345"},
+	0x1FC4:  {false, "\u03AE\u0345"},
+	0x1FC6:  {false, "\u03B7\u0342"},
+	0x1FC7:  {false, "\u1FC6\u0345"},
+	0x1FC8:  {false, "\u0395\u0300"},
+	0x1FC9:  {false, "\u0388"},
+	0x1FCA:  {false, "\u0397\u0300"},
+	0x1FCB:  {false, "\u0389"},
+	0x1FCC:  {false, "\u0397\u0345"},
+	0x1FCD:  {false, "\u1FBF\u0300"},
+	0x1FCE:  {false, "\u1FBF\u0301"},
+	0x1FCF:  {false, "\u1FBF\u0342"},
+	0x1FD0:  {false, "\u03B9\u0306"},
+	0x1FD1:  {false, "\u03B9\u0304"},
+	0x1FD2:  {false, "\u03CA\u0300"},
+	0x1FD3:  {false, "\u0390"},
+	0x1FD6:  {false, "\u03B9\u0342"},
+	0x1FD7:  {false, "\u03CA\u0342"},
+	0x1FD8:  {false, "\u0399\u0306"},
+	0x1FD9:  {false, "\u0399\u0304"},
+	0x1FDA:  {false, "\u0399\u0300"},
+	0x1FDB:  {false, "\u038A"},
+	0x1FDD:  {false, "\u1FFE\u0300"},
+	0x1FDE:  {false, "\u1FFE\u0301"},
+	0x1FDF:  {false, "\u1FFE\u0342"},
+	0x1FE0:  {false, "\u03C5\u0306"},
+	0x1FE1:  {false, "\u03C5\u0304"},
+	0x1FE2:  {false, "\u03CB\u0300"},
+	0x1FE3:  {false, "\u03B0"},
+	0x1FE4:  {false, "\u03C1\u0313"},
+	0x1FE5:  {false, "\u03C1\u0314"},
+	0x1FE6:  {false, "\u03C5\u0342"},
+	0x1FE7:  {false, "\u03CB\u0342"},
+	0x1FE8:  {false, "\u03A5\u0306"},
+	0x1FE9:  {false, "\u03A5\u0304"},
+	0x1FEA:  {false, "\u03A5\u0300"},
+	0x1FEB:  {false, "\u038E"},
+	0x1FEC:  {false, "\u03A1\u0314"},
+	0x1FED:  {false, "\u00A8\u0300"},
+	0x1FEE:  {false, "\u0385"},
+	0x1FEF:  {false, "\u0060"},
+	0x1FF2:  {false, "\u1F7C\u0345"},
+	0x1FF3:  {false, "\u03C9\u0345"},
+	0x1FF4:  {false, "\u03CE\u0345"},
+	0x1FF6:  {false, "\u03C9\u0342"},
+	0x1FF7:  {false, "\u1FF6\u0345"},
+	0x1FF8:  {false, "\u039F\u0300"},
+	0x1FF9:  {false, "\u038C"},
+	0x1FFA:  {false, "\u03A9\u0300"},
+	0x1FFB:  {false, "\u038F"},
+	0x1FFC:  {false, "\u03A9\u0345"},
+	0x1FFD:  {false, "\u00B4"},
+	0x1FFE:  {true, "\u0020\u0314"},
+	0x2000:  {false, "\u2002"},
+	0x2001:  {false, "\u2003"},
+	0x2002:  {true, "\u0020"},
+	0x2003:  {true, "\u0020"},
+	0x2004:  {true, "\u0020"},
+	0x2005:  {true, "\u0020"},
+	0x2006:  {true, "\u0020"},
+	0x2007:  {true, "\u0020"},
+	0x2008:  {true, "\u0020"},
+	0x2009:  {true, "\u0020"},
+	0x200A:  {true, "\u0020"},
+	0x2011:  {true, "\u2010"},
+	0x2017:  {true, "\u0020\u0333"},
+	0x2024:  {true, "\u002E"},
+	0x2025:  {true, "\u002E\u002E"},
+	0x2026:  {true, "\u002E\u002E\u002E"},
+	0x202F:  {true, "\u0020"},
+	0x2033:  {true, "\u2032\u2032"},
+	0x2034:  {true, "\u2032\u2032\u2032"},
+	0x2036:  {true, "\u2035\u2035"},
+	0x2037:  {true, "\u2035\u2035\u2035"},
+	0x203C:  {true, "\u0021\u0021"},
+	0x203E:  {true, "\u0020\u0305"},
+	0x2047:  {true, "\u003F\u003F"},
+	0x2048:  {true, "\u003F\u0021"},
+	0x2049:  {true, "\u0021\u003F"},
+	0x2057:  {true, "\u2032\u2032\u2032\u2032"},
+	0x205F:  {true, "\u0020"},
+	0x2070:  {true, "\u0030"},
+	0x2071:  {true, "\u0069"},
+	0x2074:  {true, "\u0034"},
+	0x2075:  {true, "\u0035"},
+	0x2076:  {true, "\u0036"},
+	0x2077:  {true, "\u0037"},
+	0x2078:  {true, "\u0038"},
+	0x2079:  {true, "\u0039"},
+	0x207A:  {true, "\u002B"},
+	0x207B:  {true, "\u2212"},
+	0x207C:  {true, "\u003D"},
+	0x207D:  {true, "\u0028"},
+	0x207E:  {true, "\u0029"},
+	0x207F:  {true, "\u006E"},
+	0x2080:  {true, "\u0030"},
+	0x2081:  {true, "\u0031"},
+	0x2082:  {true, "\u0032"},
+	0x2083:  {true, "\u0033"},
+	0x2084:  {true, "\u0034"},
+	0x2085:  {true, "\u0035"},
+	0x2086:  {true, "\u0036"},
+	0x2087:  {true, "\u0037"},
+	0x2088:  {true, "\u0038"},
+	0x2089:  {true, "\u0039"},
+	0x208A:  {true, "\u002B"},
+	0x208B:  {true, "\u2212"},
+	0x208C:  {true, "\u003D"},
+	0x208D:  {true, "\u0028"},
+	0x208E:  {true, "\u0029"},
+	0x2090:  {true, "\u0061"},
+	0x2091:  {true, "\u0065"},
+	0x2092:  {true, "\u006F"},
+	0x2093:  {true, "\u0078"},
+	0x2094:  {true, "\u0259"},
+	0x2095:  {true, "\u0068"},
+	0x2096:  {true, "\u006B"},
+	0x2097:  {true, "\u006C"},
+	0x2098:  {true, "\u006D"},
+	0x2099:  {true, "\u006E"},
+	0x209A:  {true, "\u0070"},
+	0x209B:  {true, "\u0073"},
+	0x209C:  {true, "\u0074"},
+	0x20A8:  {true, "\u0052\u0073"},
+	0x2100:  {true, "\u0061\u002F\u0063"},
+	0x2101:  {true, "\u0061\u002F\u0073"},
+	0x2102:  {true, "\u0043"},
+	0x2103:  {true, "\u00B0\u0043"},
+	0x2105:  {true, "\u0063\u002F\u006F"},
+	0x2106:  {true, "\u0063\u002F\u0075"},
+	0x2107:  {true, "\u0190"},
+	0x2109:  {true, "\u00B0\u0046"},
+	0x210A:  {true, "\u0067"},
+	0x210B:  {true, "\u0048"},
+	0x210C:  {true, "\u0048"},
+	0x210D:  {true, "\u0048"},
+	0x210E:  {true, "\u0068"},
+	0x210F:  {true, "\u0127"},
+	0x2110:  {true, "\u0049"},
+	0x2111:  {true, "\u0049"},
+	0x2112:  {true, "\u004C"},
+	0x2113:  {true, "\u006C"},
+	0x2115:  {true, "\u004E"},
+	0x2116:  {true, "\u004E\u006F"},
+	0x2119:  {true, "\u0050"},
+	0x211A:  {true, "\u0051"},
+	0x211B:  {true, "\u0052"},
+	0x211C:  {true, "\u0052"},
+	0x211D:  {true, "\u0052"},
+	0x2120:  {true, "\u0053\u004D"},
+	0x2121:  {true, "\u0054\u0045\u004C"},
+	0x2122:  {true, "\u0054\u004D"},
+	0x2124:  {true, "\u005A"},
+	0x2126:  {false, "\u03A9"},
+	0x2128:  {true, "\u005A"},
+	0x212A:  {false, "\u004B"},
+	0x212B:  {false, "\u00C5"},
+	0x212C:  {true, "\u0042"},
+	0x212D:  {true, "\u0043"},
+	0x212F:  {true, "\u0065"},
+	0x2130:  {true, "\u0045"},
+	0x2131:  {true, "\u0046"},
+	0x2133:  {true, "\u004D"},
+	0x2134:  {true, "\u006F"},
+	0x2135:  {true, "\u05D0"},
+	0x2136:  {true, "\u05D1"},
+	0x2137:  {true, "\u05D2"},
+	0x2138:  {true, "\u05D3"},
+	0x2139:  {true, "\u0069"},
+	0x213B:  {true, "\u0046\u0041\u0058"},
+	0x213C:  {true, "\u03C0"},
+	0x213D:  {true, "\u03B3"},
+	0x213E:  {true, "\u0393"},
+	0x213F:  {true, "\u03A0"},
+	0x2140:  {true, "\u2211"},
+	0x2145:  {true, "\u0044"},
+	0x2146:  {true, "\u0064"},
+	0x2147:  {true, "\u0065"},
+	0x2148:  {true, "\u0069"},
+	0x2149:  {true, "\u006A"},
+	0x2150:  {true, "\u0031\u2044\u0037"},
+	0x2151:  {true, "\u0031\u2044\u0039"},
+	0x2152:  {true, "\u0031\u2044\u0031\u0030"},
+	0x2153:  {true, "\u0031\u2044\u0033"},
+	0x2154:  {true, "\u0032\u2044\u0033"},
+	0x2155:  {true, "\u0031\u2044\u0035"},
+	0x2156:  {true, "\u0032\u2044\u0035"},
+	0x2157:  {true, "\u0033\u2044\u0035"},
+	0x2158:  {true, "\u0034\u2044\u0035"},
+	0x2159:  {true, "\u0031\u2044\u0036"},
+	0x215A:  {true, "\u0035\u2044\u0036"},
+	0x215B:  {true, "\u0031\u2044\u0038"},
+	0x215C:  {true, "\u0033\u2044\u0038"},
+	0x215D:  {true, "\u0035\u2044\u0038"},
+	0x215E:  {true, "\u0037\u2044\u0038"},
+	0x215F:  {true, "\u0031\u2044"},
+	0x2160:  {true, "\u0049"},
+	0x2161:  {true, "\u0049\u0049"},
+	0x2162:  {true, "\u0049\u0049\u0049"},
+	0x2163:  {true, "\u0049\u0056"},
+	0x2164:  {true, "\u0056"},
+	0x2165:  {true, "\u0056\u0049"},
+	0x2166:  {true, "\u0056\u0049\u0049"},
+	0x2167:  {true, "\u0056\u0049\u0049\u0049"},
+	0x2168:  {true, "\u0049\u0058"},
+	0x2169:  {true, "\u0058"},
+	0x216A:  {true, "\u0058\u0049"},
+	0x216B:  {true, "\u0058\u0049\u0049"},
+	0x216C:  {true, "\u004C"},
+	0x216D:  {true, "\u0043"},
+	0x216E:  {true, "\u0044"},
+	0x216F:  {true, "\u004D"},
+	0x2170:  {true, "\u0069"},
+	0x2171:  {true, "\u0069\u0069"},
+	0x2172:  {true, "\u0069\u0069\u0069"},
+	0x2173:  {true, "\u0069\u0076"},
+	0x2174:  {true, "\u0076"},
+	0x2175:  {true, "\u0076\u0069"},
+	0x2176:  {true, "\u0076\u0069\u0069"},
+	0x2177:  {true, "\u0076\u0069\u0069\u0069"},
+	0x2178:  {true, "\u0069\u0078"},
+	0x2179:  {true, "\u0078"},
+	0x217A:  {true, "\u0078\u0069"},
+	0x217B:  {true, "\u0078\u0069\u0069"},
+	0x217C:  {true, "\u006C"},
+	0x217D:  {true, "\u0063"},
+	0x217E:  {true, "\u0064"},
+	0x217F:  {true, "\u006D"},
+	0x2189:  {true, "\u0030\u2044\u0033"},
+	0x219A:  {false, "\u2190\u0338"},
+	0x219B:  {false, "\u2192\u0338"},
+	0x21AE:  {false, "\u2194\u0338"},
+	0x21CD:  {false, "\u21D0\u0338"},
+	0x21CE:  {false, "\u21D4\u0338"},
+	0x21CF:  {false, "\u21D2\u0338"},
+	0x2204:  {false, "\u2203\u0338"},
+	0x2209:  {false, "\u2208\u0338"},
+	0x220C:  {false, "\u220B\u0338"},
+	0x2224:  {false, "\u2223\u0338"},
+	0x2226:  {false, "\u2225\u0338"},
+	0x222C:  {true, "\u222B\u222B"},
+	0x222D:  {true, "\u222B\u222B\u222B"},
+	0x222F:  {true, "\u222E\u222E"},
+	0x2230:  {true, "\u222E\u222E\u222E"},
+	0x2241:  {false, "\u223C\u0338"},
+	0x2244:  {false, "\u2243\u0338"},
+	0x2247:  {false, "\u2245\u0338"},
+	0x2249:  {false, "\u2248\u0338"},
+	0x2260:  {false, "\u003D\u0338"},
+	0x2262:  {false, "\u2261\u0338"},
+	0x226D:  {false, "\u224D\u0338"},
+	0x226E:  {false, "\u003C\u0338"},
+	0x226F:  {false, "\u003E\u0338"},
+	0x2270:  {false, "\u2264\u0338"},
+	0x2271:  {false, "\u2265\u0338"},
+	0x2274:  {false, "\u2272\u0338"},
+	0x2275:  {false, "\u2273\u0338"},
+	0x2278:  {false, "\u2276\u0338"},
+	0x2279:  {false, "\u2277\u0338"},
+	0x2280:  {false, "\u227A\u0338"},
+	0x2281:  {false, "\u227B\u0338"},
+	0x2284:  {false, "\u2282\u0338"},
+	0x2285:  {false, "\u2283\u0338"},
+	0x2288:  {false, "\u2286\u0338"},
+	0x2289:  {false, "\u2287\u0338"},
+	0x22AC:  {false, "\u22A2\u0338"},
+	0x22AD:  {false, "\u22A8\u0338"},
+	0x22AE:  {false, "\u22A9\u0338"},
+	0x22AF:  {false, "\u22AB\u0338"},
+	0x22E0:  {false, "\u227C\u0338"},
+	0x22E1:  {false, "\u227D\u0338"},
+	0x22E2:  {false, "\u2291\u0338"},
+	0x22E3:  {false, "\u2292\u0338"},
+	0x22EA:  {false, "\u22B2\u0338"},
+	0x22EB:  {false, "\u22B3\u0338"},
+	0x22EC:  {false, "\u22B4\u0338"},
+	0x22ED:  {false, "\u22B5\u0338"},
+	0x2329:  {false, "\u3008"},
+	0x232A:  {false, "\u3009"},
+	0x2460:  {true, "\u0031"},
+	0x2461:  {true, "\u0032"},
+	0x2462:  {true, "\u0033"},
+	0x2463:  {true, "\u0034"},
+	0x2464:  {true, "\u0035"},
+	0x2465:  {true, "\u0036"},
+	0x2466:  {true, "\u0037"},
+	0x2467:  {true, "\u0038"},
+	0x2468:  {true, "\u0039"},
+	0x2469:  {true, "\u0031\u0030"},
+	0x246A:  {true, "\u0031\u0031"},
+	0x246B:  {true, "\u0031\u0032"},
+	0x246C:  {true, "\u0031\u0033"},
+	0x246D:  {true, "\u0031\u0034"},
+	0x246E:  {true, "\u0031\u0035"},
+	0x246F:  {true, "\u0031\u0036"},
+	0x2470:  {true, "\u0031\u0037"},
+	0x2471:  {true, "\u0031\u0038"},
+	0x2472:  {true, "\u0031\u0039"},
+	0x2473:  {true, "\u0032\u0030"},
+	0x2474:  {true, "\u0028\u0031\u0029"},
+	0x2475:  {true, "\u0028\u0032\u0029"},
+	0x2476:  {true, "\u0028\u0033\u0029"},
+	0x2477:  {true, "\u0028\u0034\u0029"},
+	0x2478:  {true, "\u0028\u0035\u0029"},
+	0x2479:  {true, "\u0028\u0036\u0029"},
+	0x247A:  {true, "\u0028\u0037\u0029"},
+	0x247B:  {true, "\u0028\u0038\u0029"},
+	0x247C:  {true, "\u0028\u0039\u0029"},
+	0x247D:  {true, "\u0028\u0031\u0030\u0029"},
+	0x247E:  {true, "\u0028\u0031\u0031\u0029"},
+	0x247F:  {true, "\u0028\u0031\u0032\u0029"},
+	0x2480:  {true, "\u0028\u0031\u0033\u0029"},
+	0x2481:  {true, "\u0028\u0031\u0034\u0029"},
+	0x2482:  {true, "\u0028\u0031\u0035\u0029"},
+	0x2483:  {true, "\u0028\u0031\u0036\u0029"},
+	0x2484:  {true, "\u0028\u0031\u0037\u0029"},
+	0x2485:  {true, "\u0028\u0031\u0038\u0029"},
+	0x2486:  {true, "\u0028\u0031\u0039\u0029"},
+	0x2487:  {true, "\u0028\u0032\u0030\u0029"},
+	0x2488:  {true, "\u0031\u002E"},
+	0x2489:  {true, "\u0032\u002E"},
+	0x248A:  {true, "\u0033\u002E"},
+	0x248B:  {true, "\u0034\u002E"},
+	0x248C:  {true, "\u0035\u002E"},
+	0x248D:  {true, "\u0036\u002E"},
+	0x248E:  {true, "\u0037\u002E"},
+	0x248F:  {true, "\u0038\u002E"},
+	0x2490:  {true, "\u0039\u002E"},
+	0x2491:  {true, "\u0031\u0030\u002E"},
+	0x2492:  {true, "\u0031\u0031\u002E"},
+	0x2493:  {true, "\u0031\u0032\u002E"},
+	0x2494:  {true, "\u0031\u0033\u002E"},
+	0x2495:  {true, "\u0031\u0034\u002E"},
+	0x2496:  {true, "\u0031\u0035\u002E"},
+	0x2497:  {true, "\u0031\u0036\u002E"},
+	0x2498:  {true, "\u0031\u0037\u002E"},
+	0x2499:  {true, "\u0031\u0038\u002E"},
+	0x249A:  {true, "\u0031\u0039\u002E"},
+	0x249B:  {true, "\u0032\u0030\u002E"},
+	0x249C:  {true, "\u0028\u0061\u0029"},
+	0x249D:  {true, "\u0028\u0062\u0029"},
+	0x249E:  {true, "\u0028\u0063\u0029"},
+	0x249F:  {true, "\u0028\u0064\u0029"},
+	0x24A0:  {true, "\u0028\u0065\u0029"},
+	0x24A1:  {true, "\u0028\u0066\u0029"},
+	0x24A2:  {true, "\u0028\u0067\u0029"},
+	0x24A3:  {true, "\u0028\u0068\u0029"},
+	0x24A4:  {true, "\u0028\u0069\u0029"},
+	0x24A5:  {true, "\u0028\u006A\u0029"},
+	0x24A6:  {true, "\u0028\u006B\u0029"},
+	0x24A7:  {true, "\u0028\u006C\u0029"},
+	0x24A8:  {true, "\u0028\u006D\u0029"},
+	0x24A9:  {true, "\u0028\u006E\u0029"},
+	0x24AA:  {true, "\u0028\u006F\u0029"},
+	0x24AB:  {true, "\u0028\u0070\u0029"},
+	0x24AC:  {true, "\u0028\u0071\u0029"},
+	0x24AD:  {true, "\u0028\u0072\u0029"},
+	0x24AE:  {true, "\u0028\u0073\u0029"},
+	0x24AF:  {true, "\u0028\u0074\u0029"},
+	0x24B0:  {true, "\u0028\u0075\u0029"},
+	0x24B1:  {true, "\u0028\u0076\u0029"},
+	0x24B2:  {true, "\u0028\u0077\u0029"},
+	0x24B3:  {true, "\u0028\u0078\u0029"},
+	0x24B4:  {true, "\u0028\u0079\u0029"},
+	0x24B5:  {true, "\u0028\u007A\u0029"},
+	0x24B6:  {true, "\u0041"},
+	0x24B7:  {true, "\u0042"},
+	0x24B8:  {true, "\u0043"},
+	0x24B9:  {true, "\u0044"},
+	0x24BA:  {true, "\u0045"},
+	0x24BB:  {true, "\u0046"},
+	0x24BC:  {true, "\u0047"},
+	0x24BD:  {true, "\u0048"},
+	0x24BE:  {true, "\u0049"},
+	0x24BF:  {true, "\u004A"},
+	0x24C0:  {true, "\u004B"},
+	0x24C1:  {true, "\u004C"},
+	0x24C2:  {true, "\u004D"},
+	0x24C3:  {true, "\u004E"},
+	0x24C4:  {true, "\u004F"},
+	0x24C5:  {true, "\u0050"},
+	0x24C6:  {true, "\u0051"},
+	0x24C7:  {true, "\u0052"},
+	0x24C8:  {true, "\u0053"},
+	0x24C9:  {true, "\u0054"},
+	0x24CA:  {true, "\u0055"},
+	0x24CB:  {true, "\u0056"},
+	0x24CC:  {true, "\u0057"},
+	0x24CD:  {true, "\u0058"},
+	0x24CE:  {true, "\u0059"},
+	0x24CF:  {true, "\u005A"},
+	0x24D0:  {true, "\u0061"},
+	0x24D1:  {true, "\u0062"},
+	0x24D2:  {true, "\u0063"},
+	0x24D3:  {true, "\u0064"},
+	0x24D4:  {true, "\u0065"},
+	0x24D5:  {true, "\u0066"},
+	0x24D6:  {true, "\u0067"},
+	0x24D7:  {true, "\u0068"},
+	0x24D8:  {true, "\u0069"},
+	0x24D9:  {true, "\u006A"},
+	0x24DA:  {true, "\u006B"},
+	0x24DB:  {true, "\u006C"},
+	0x24DC:  {true, "\u006D"},
+	0x24DD:  {true, "\u006E"},
+	0x24DE:  {true, "\u006F"},
+	0x24DF:  {true, "\u0070"},
+	0x24E0:  {true, "\u0071"},
+	0x24E1:  {true, "\u0072"},
+	0x24E2:  {true, "\u0073"},
+	0x24E3:  {true, "\u0074"},
+	0x24E4:  {true, "\u0075"},
+	0x24E5:  {true, "\u0076"},
+	0x24E6:  {true, "\u0077"},
+	0x24E7:  {true, "\u0078"},
+	0x24E8:  {true, "\u0079"},
+	0x24E9:  {true, "\u007A"},
+	0x24EA:  {true, "\u0030"},
+	0x2A0C:  {true, "\u222B\u222B\u222B\u222B"},
+	0x2A74:  {true, "\u003A\u003A\u003D"},
+	0x2A75:  {true, "\u003D\u003D"},
+	0x2A76:  {true, "\u003D\u003D\u003D"},
+	0x2ADC:  {false, "\u2ADD\u0338"},
+	0x2C7C:  {true, "\u006A"},
+	0x2C7D:  {true, "\u0056"},
+	0x2D6F:  {true, "\u2D61"},
+	0x2E9F:  {true, "\u6BCD"},
+	0x2EF3:  {true, "\u9F9F"},
+	0x2F00:  {true, "\u4E00"},
+	0x2F01:  {true, "\u4E28"},
+	0x2F02:  {true, "\u4E36"},
+	0x2F03:  {true, "\u4E3F"},
+	0x2F04:  {true, "\u4E59"},
+	0x2F05:  {true, "\u4E85"},
+	0x2F06:  {true, "\u4E8C"},
+	0x2F07:  {true, "\u4EA0"},
+	0x2F08:  {true, "\u4EBA"},
+	0x2F09:  {true, "\u513F"},
+	0x2F0A:  {true, "\u5165"},
+	0x2F0B:  {true, "\u516B"},
+	0x2F0C:  {true, "\u5182"},
+	0x2F0D:  {true, "\u5196"},
+	0x2F0E:  {true, "\u51AB"},
+	0x2F0F:  {true, "\u51E0"},
+	0x2F10:  {true, "\u51F5"},
+	0x2F11:  {true, "\u5200"},
+	0x2F12:  {true, "\u529B"},
+	0x2F13:  {true, "\u52F9"},
+	0x2F14:  {true, "\u5315"},
+	0x2F15:  {true, "\u531A"},
+	0x2F16:  {true, "\u5338"},
+	0x2F17:  {true, "\u5341"},
+	0x2F18:  {true, "\u535C"},
+	0x2F19:  {true, "\u5369"},
+	0x2F1A:  {true, "\u5382"},
+	0x2F1B:  {true, "\u53B6"},
+	0x2F1C:  {true, "\u53C8"},
+	0x2F1D:  {true, "\u53E3"},
+	0x2F1E:  {true, "\u56D7"},
+	0x2F1F:  {true, "\u571F"},
+	0x2F20:  {true, "\u58EB"},
+	0x2F21:  {true, "\u5902"},
+	0x2F22:  {true, "\u590A"},
+	0x2F23:  {true, "\u5915"},
+	0x2F24:  {true, "\u5927"},
+	0x2F25:  {true, "\u5973"},
+	0x2F26:  {true, "\u5B50"},
+	0x2F27:  {true, "\u5B80"},
+	0x2F28:  {true, "\u5BF8"},
+	0x2F29:  {true, "\u5C0F"},
+	0x2F2A:  {true, "\u5C22"},
+	0x2F2B:  {true, "\u5C38"},
+	0x2F2C:  {true, "\u5C6E"},
+	0x2F2D:  {true, "\u5C71"},
+	0x2F2E:  {true, "\u5DDB"},
+	0x2F2F:  {true, "\u5DE5"},
+	0x2F30:  {true, "\u5DF1"},
+	0x2F31:  {true, "\u5DFE"},
+	0x2F32:  {true, "\u5E72"},
+	0x2F33:  {true, "\u5E7A"},
+	0x2F34:  {true, "\u5E7F"},
+	0x2F35:  {true, "\u5EF4"},
+	0x2F36:  {true, "\u5EFE"},
+	0x2F37:  {true, "\u5F0B"},
+	0x2F38:  {true, "\u5F13"},
+	0x2F39:  {true, "\u5F50"},
+	0x2F3A:  {true, "\u5F61"},
+	0x2F3B:  {true, "\u5F73"},
+	0x2F3C:  {true, "\u5FC3"},
+	0x2F3D:  {true, "\u6208"},
+	0x2F3E:  {true, "\u6236"},
+	0x2F3F:  {true, "\u624B"},
+	0x2F40:  {true, "\u652F"},
+	0x2F41:  {true, "\u6534"},
+	0x2F42:  {true, "\u6587"},
+	0x2F43:  {true, "\u6597"},
+	0x2F44:  {true, "\u65A4"},
+	0x2F45:  {true, "\u65B9"},
+	0x2F46:  {true, "\u65E0"},
+	0x2F47:  {true, "\u65E5"},
+	0x2F48:  {true, "\u66F0"},
+	0x2F49:  {true, "\u6708"},
+	0x2F4A:  {true, "\u6728"},
+	0x2F4B:  {true, "\u6B20"},
+	0x2F4C:  {true, "\u6B62"},
+	0x2F4D:  {true, "\u6B79"},
+	0x2F4E:  {true, "\u6BB3"},
+	0x2F4F:  {true, "\u6BCB"},
+	0x2F50:  {true, "\u6BD4"},
+	0x2F51:  {true, "\u6BDB"},
+	0x2F52:  {true, "\u6C0F"},
+	0x2F53:  {true, "\u6C14"},
+	0x2F54:  {true, "\u6C34"},
+	0x2F55:  {true, "\u706B"},
+	0x2F56:  {true, "\u722A"},
+	0x2F57:  {true, "\u7236"},
+	0x2F58:  {true, "\u723B"},
+	0x2F59:  {true, "\u723F"},
+	0x2F5A:  {true, "\u7247"},
+	0x2F5B:  {true, "\u7259"},
+	0x2F5C:  {true, "\u725B"},
+	0x2F5D:  {true, "\u72AC"},
+	0x2F5E:  {true, "\u7384"},
+	0x2F5F:  {true, "\u7389"},
+	0x2F60:  {true, "\u74DC"},
+	0x2F61:  {true, "\u74E6"},
+	0x2F62:  {true, "\u7518"},
+	0x2F63:  {true, "\u751F"},
+	0x2F64:  {true, "\u7528"},
+	0x2F65:  {true, "\u7530"},
+	0x2F66:  {true, "\u758B"},
+	0x2F67:  {true, "\u7592"},
+	0x2F68:  {true, "\u7676"},
+	0x2F69:  {true, "\u767D"},
+	0x2F6A:  {true, "\u76AE"},
+	0x2F6B:  {true, "\u76BF"},
+	0x2F6C:  {true, "\u76EE"},
+	0x2F6D:  {true, "\u77DB"},
+	0x2F6E:  {true, "\u77E2"},
+	0x2F6F:  {true, "\u77F3"},
+	0x2F70:  {true, "\u793A"},
+	0x2F71:  {true, "\u79B8"},
+	0x2F72:  {true, "\u79BE"},
+	0x2F73:  {true, "\u7A74"},
+	0x2F74:  {true, "\u7ACB"},
+	0x2F75:  {true, "\u7AF9"},
+	0x2F76:  {true, "\u7C73"},
+	0x2F77:  {true, "\u7CF8"},
+	0x2F78:  {true, "\u7F36"},
+	0x2F79:  {true, "\u7F51"},
+	0x2F7A:  {true, "\u7F8A"},
+	0x2F7B:  {true, "\u7FBD"},
+	0x2F7C:  {true, "\u8001"},
+	0x2F7D:  {true, "\u800C"},
+	0x2F7E:  {true, "\u8012"},
+	0x2F7F:  {true, "\u8033"},
+	0x2F80:  {true, "\u807F"},
+	0x2F81:  {true, "\u8089"},
+	0x2F82:  {true, "\u81E3"},
+	0x2F83:  {true, "\u81EA"},
+	0x2F84:  {true, "\u81F3"},
+	0x2F85:  {true, "\u81FC"},
+	0x2F86:  {true, "\u820C"},
+	0x2F87:  {true, "\u821B"},
+	0x2F88:  {true, "\u821F"},
+	0x2F89:  {true, "\u826E"},
+	0x2F8A:  {true, "\u8272"},
+	0x2F8B:  {true, "\u8278"},
+	0x2F8C:  {true, "\u864D"},
+	0x2F8D:  {true, "\u866B"},
+	0x2F8E:  {true, "\u8840"},
+	0x2F8F:  {true, "\u884C"},
+	0x2F90:  {true, "\u8863"},
+	0x2F91:  {true, "\u897E"},
+	0x2F92:  {true, "\u898B"},
+	0x2F93:  {true, "\u89D2"},
+	0x2F94:  {true, "\u8A00"},
+	0x2F95:  {true, "\u8C37"},
+	0x2F96:  {true, "\u8C46"},
+	0x2F97:  {true, "\u8C55"},
+	0x2F98:  {true, "\u8C78"},
+	0x2F99:  {true, "\u8C9D"},
+	0x2F9A:  {true, "\u8D64"},
+	0x2F9B:  {true, "\u8D70"},
+	0x2F9C:  {true, "\u8DB3"},
+	0x2F9D:  {true, "\u8EAB"},
+	0x2F9E:  {true, "\u8ECA"},
+	0x2F9F:  {true, "\u8F9B"},
+	0x2FA0:  {true, "\u8FB0"},
+	0x2FA1:  {true, "\u8FB5"},
+	0x2FA2:  {true, "\u9091"},
+	0x2FA3:  {true, "\u9149"},
+	0x2FA4:  {true, "\u91C6"},
+	0x2FA5:  {true, "\u91CC"},
+	0x2FA6:  {true, "\u91D1"},
+	0x2FA7:  {true, "\u9577"},
+	0x2FA8:  {true, "\u9580"},
+	0x2FA9:  {true, "\u961C"},
+	0x2FAA:  {true, "\u96B6"},
+	0x2FAB:  {true, "\u96B9"},
+	0x2FAC:  {true, "\u96E8"},
+	0x2FAD:  {true, "\u9751"},
+	0x2FAE:  {true, "\u975E"},
+	0x2FAF:  {true, "\u9762"},
+	0x2FB0:  {true, "\u9769"},
+	0x2FB1:  {true, "\u97CB"},
+	0x2FB2:  {true, "\u97ED"},
+	0x2FB3:  {true, "\u97F3"},
+	0x2FB4:  {true, "\u9801"},
+	0x2FB5:  {true, "\u98A8"},
+	0x2FB6:  {true, "\u98DB"},
+	0x2FB7:  {true, "\u98DF"},
+	0x2FB8:  {true, "\u9996"},
+	0x2FB9:  {true, "\u9999"},
+	0x2FBA:  {true, "\u99AC"},
+	0x2FBB:  {true, "\u9AA8"},
+	0x2FBC:  {true, "\u9AD8"},
+	0x2FBD:  {true, "\u9ADF"},
+	0x2FBE:  {true, "\u9B25"},
+	0x2FBF:  {true, "\u9B2F"},
+	0x2FC0:  {true, "\u9B32"},
+	0x2FC1:  {true, "\u9B3C"},
+	0x2FC2:  {true, "\u9B5A"},
+	0x2FC3:  {true, "\u9CE5"},
+	0x2FC4:  {true, "\u9E75"},
+	0x2FC5:  {true, "\u9E7F"},
+	0x2FC6:  {true, "\u9EA5"},
+	0x2FC7:  {true, "\u9EBB"},
+	0x2FC8:  {true, "\u9EC3"},
+	0x2FC9:  {true, "\u9ECD"},
+	0x2FCA:  {true, "\u9ED1"},
+	0x2FCB:  {true, "\u9EF9"},
+	0x2FCC:  {true, "\u9EFD"},
+	0x2FCD:  {true, "\u9F0E"},
+	0x2FCE:  {true, "\u9F13"},
+	0x2FCF:  {true, "\u9F20"},
+	0x2FD0:  {true, "\u9F3B"},
+	0x2FD1:  {true, "\u9F4A"},
+	0x2FD2:  {true, "\u9F52"},
+	0x2FD3:  {true, "\u9F8D"},
+	0x2FD4:  {true, "\u9F9C"},
+	0x2FD5:  {true, "\u9FA0"},
+	0x3000:  {true, "\u0020"},
+	0x3036:  {true, "\u3012"},
+	0x3038:  {true, "\u5341"},
+	0x3039:  {true, "\u5344"},
+	0x303A:  {true, "\u5345"},
+	0x304C:  {false, "\u304B\u3099"},
+	0x304E:  {false, "\u304D\u3099"},
+	0x3050:  {false, "\u304F\u3099"},
+	0x3052:  {false, "\u3051\u3099"},
+	0x3054:  {false, "\u3053\u3099"},
+	0x3056:  {false, "\u3055\u3099"},
+	0x3058:  {false, "\u3057\u3099"},
+	0x305A:  {false, "\u3059\u3099"},
+	0x305C:  {false, "\u305B\u3099"},
+	0x305E:  {false, "\u305D\u3099"},
+	0x3060:  {false, "\u305F\u3099"},
+	0x3062:  {false, "\u3061\u3099"},
+	0x3065:  {false, "\u3064\u3099"},
+	0x3067:  {false, "\u3066\u3099"},
+	0x3069:  {false, "\u3068\u3099"},
+	0x3070:  {false, "\u306F\u3099"},
+	0x3071:  {false, "\u306F\u309A"},
+	0x3073:  {false, "\u3072\u3099"},
+	0x3074:  {false, "\u3072\u309A"},
+	0x3076:  {false, "\u3075\u3099"},
+	0x3077:  {false, "\u3075\u309A"},
+	0x3079:  {false, "\u3078\u3099"},
+	0x307A:  {false, "\u3078\u309A"},
+	0x307C:  {false, "\u307B\u3099"},
+	0x307D:  {false, "\u307B\u309A"},
+	0x3094:  {false, "\u3046\u3099"},
+	0x309B:  {true, "\u0020\u3099"},
+	0x309C:  {true, "\u0020\u309A"},
+	0x309E:  {false, "\u309D\u3099"},
+	0x309F:  {true, "\u3088\u308A"},
+	0x30AC:  {false, "\u30AB\u3099"},
+	0x30AE:  {false, "\u30AD\u3099"},
+	0x30B0:  {false, "\u30AF\u3099"},
+	0x30B2:  {false, "\u30B1\u3099"},
+	0x30B4:  {false, "\u30B3\u3099"},
+	0x30B6:  {false, "\u30B5\u3099"},
+	0x30B8:  {false, "\u30B7\u3099"},
+	0x30BA:  {false, "\u30B9\u3099"},
+	0x30BC:  {false, "\u30BB\u3099"},
+	0x30BE:  {false, "\u30BD\u3099"},
+	0x30C0:  {false, "\u30BF\u3099"},
+	0x30C2:  {false, "\u30C1\u3099"},
+	0x30C5:  {false, "\u30C4\u3099"},
+	0x30C7:  {false, "\u30C6\u3099"},
+	0x30C9:  {false, "\u30C8\u3099"},
+	0x30D0:  {false, "\u30CF\u3099"},
+	0x30D1:  {false, "\u30CF\u309A"},
+	0x30D3:  {false, "\u30D2\u3099"},
+	0x30D4:  {false, "\u30D2\u309A"},
+	0x30D6:  {false, "\u30D5\u3099"},
+	0x30D7:  {false, "\u30D5\u309A"},
+	0x30D9:  {false, "\u30D8\u3099"},
+	0x30DA:  {false, "\u30D8\u309A"},
+	0x30DC:  {false, "\u30DB\u3099"},
+	0x30DD:  {false, "\u30DB\u309A"},
+	0x30F4:  {false, "\u30A6\u3099"},
+	0x30F7:  {false, "\u30EF\u3099"},
+	0x30F8:  {false, "\u30F0\u3099"},
+	0x30F9:  {false, "\u30F1\u3099"},
+	0x30FA:  {false, "\u30F2\u3099"},
+	0x30FE:  {false, "\u30FD\u3099"},
+	0x30FF:  {true, "\u30B3\u30C8"},
+	0x3131:  {true, "\u1100"},
+	0x3132:  {true, "\u1101"},
+	0x3133:  {true, "\u11AA"},
+	0x3134:  {true, "\u1102"},
+	0x3135:  {true, "\u11AC"},
+	0x3136:  {true, "\u11AD"},
+	0x3137:  {true, "\u1103"},
+	0x3138:  {true, "\u1104"},
+	0x3139:  {true, "\u1105"},
+	0x313A:  {true, "\u11B0"},
+	0x313B:  {true, "\u11B1"},
+	0x313C:  {true, "\u11B2"},
+	0x313D:  {true, "\u11B3"},
+	0x313E:  {true, "\u11B4"},
+	0x313F:  {true, "\u11B5"},
+	0x3140:  {true, "\u111A"},
+	0x3141:  {true, "\u1106"},
+	0x3142:  {true, "\u1107"},
+	0x3143:  {true, "\u1108"},
+	0x3144:  {true, "\u1121"},
+	0x3145:  {true, "\u1109"},
+	0x3146:  {true, "\u110A"},
+	0x3147:  {true, "\u110B"},
+	0x3148:  {true, "\u110C"},
+	0x3149:  {true, "\u110D"},
+	0x314A:  {true, "\u110E"},
+	0x314B:  {true, "\u110F"},
+	0x314C:  {true, "\u1110"},
+	0x314D:  {true, "\u1111"},
+	0x314E:  {true, "\u1112"},
+	0x314F:  {true, "\u1161"},
+	0x3150:  {true, "\u1162"},
+	0x3151:  {true, "\u1163"},
+	0x3152:  {true, "\u1164"},
+	0x3153:  {true, "\u1165"},
+	0x3154:  {true, "\u1166"},
+	0x3155:  {true, "\u1167"},
+	0x3156:  {true, "\u1168"},
+	0x3157:  {true, "\u1169"},
+	0x3158:  {true, "\u116A"},
+	0x3159:  {true, "\u116B"},
+	0x315A:  {true, "\u116C"},
+	0x315B:  {true, "\u116D"},
+	0x315C:  {true, "\u116E"},
+	0x315D:  {true, "\u116F"},
+	0x315E:  {true, "\u1170"},
+	0x315F:  {true, "\u1171"},
+	0x3160:  {true, "\u1172"},
+	0x3161:  {true, "\u1173"},
+	0x3162:  {true, "\u1174"},
+	0x3163:  {true, "\u1175"},
+	0x3164:  {true, "\u1160"},
+	0x3165:  {true, "\u1114"},
+	0x3166:  {true, "\u1115"},
+	0x3167:  {true, "\u11C7"},
+	0x3168:  {true, "\u11C8"},
+	0x3169:  {true, "\u11CC"},
+	0x316A:  {true, "\u11CE"},
+	0x316B:  {true, "\u11D3"},
+	0x316C:  {true, "\u11D7"},
+	0x316D:  {true, "\u11D9"},
+	0x316E:  {true, "\u111C"},
+	0x316F:  {true, "\u11DD"},
+	0x3170:  {true, "\u11DF"},
+	0x3171:  {true, "\u111D"},
+	0x3172:  {true, "\u111E"},
+	0x3173:  {true, "\u1120"},
+	0x3174:  {true, "\u1122"},
+	0x3175:  {true, "\u1123"},
+	0x3176:  {true, "\u1127"},
+	0x3177:  {true, "\u1129"},
+	0x3178:  {true, "\u112B"},
+	0x3179:  {true, "\u112C"},
+	0x317A:  {true, "\u112D"},
+	0x317B:  {true, "\u112E"},
+	0x317C:  {true, "\u112F"},
+	0x317D:  {true, "\u1132"},
+	0x317E:  {true, "\u1136"},
+	0x317F:  {true, "\u1140"},
+	0x3180:  {true, "\u1147"},
+	0x3181:  {true, "\u114C"},
+	0x3182:  {true, "\u11F1"},
+	0x3183:  {true, "\u11F2"},
+	0x3184:  {true, "\u1157"},
+	0x3185:  {true, "\u1158"},
+	0x3186:  {true, "\u1159"},
+	0x3187:  {true, "\u1184"},
+	0x3188:  {true, "\u1185"},
+	0x3189:  {true, "\u1188"},
+	0x318A:  {true, "\u1191"},
+	0x318B:  {true, "\u1192"},
+	0x318C:  {true, "\u1194"},
+	0x318D:  {true, "\u119E"},
+	0x318E:  {true, "\u11A1"},
+	0x3192:  {true, "\u4E00"},
+	0x3193:  {true, "\u4E8C"},
+	0x3194:  {true, "\u4E09"},
+	0x3195:  {true, "\u56DB"},
+	0x3196:  {true, "\u4E0A"},
+	0x3197:  {true, "\u4E2D"},
+	0x3198:  {true, "\u4E0B"},
+	0x3199:  {true, "\u7532"},
+	0x319A:  {true, "\u4E59"},
+	0x319B:  {true, "\u4E19"},
+	0x319C:  {true, "\u4E01"},
+	0x319D:  {true, "\u5929"},
+	0x319E:  {true, "\u5730"},
+	0x319F:  {true, "\u4EBA"},
+	0x3200:  {true, "\u0028\u1100\u0029"},
+	0x3201:  {true, "\u0028\u1102\u0029"},
+	0x3202:  {true, "\u0028\u1103\u0029"},
+	0x3203:  {true, "\u0028\u1105\u0029"},
+	0x3204:  {true, "\u0028\u1106\u0029"},
+	0x3205:  {true, "\u0028\u1107\u0029"},
+	0x3206:  {true, "\u0028\u1109\u0029"},
+	0x3207:  {true, "\u0028\u110B\u0029"},
+	0x3208:  {true, "\u0028\u110C\u0029"},
+	0x3209:  {true, "\u0028\u110E\u0029"},
+	0x320A:  {true, "\u0028\u110F\u0029"},
+	0x320B:  {true, "\u0028\u1110\u0029"},
+	0x320C:  {true, "\u0028\u1111\u0029"},
+	0x320D:  {true, "\u0028\u1112\u0029"},
+	0x320E:  {true, "\u0028\u1100\u1161\u0029"},
+	0x320F:  {true, "\u0028\u1102\u1161\u0029"},
+	0x3210:  {true, "\u0028\u1103\u1161\u0029"},
+	0x3211:  {true, "\u0028\u1105\u1161\u0029"},
+	0x3212:  {true, "\u0028\u1106\u1161\u0029"},
+	0x3213:  {true, "\u0028\u1107\u1161\u0029"},
+	0x3214:  {true, "\u0028\u1109\u1161\u0029"},
+	0x3215:  {true, "\u0028\u110B\u1161\u0029"},
+	0x3216:  {true, "\u0028\u110C\u1161\u0029"},
+	0x3217:  {true, "\u0028\u110E\u1161\u0029"},
+	0x3218:  {true, "\u0028\u110F\u1161\u0029"},
+	0x3219:  {true, "\u0028\u1110\u1161\u0029"},
+	0x321A:  {true, "\u0028\u1111\u1161\u0029"},
+	0x321B:  {true, "\u0028\u1112\u1161\u0029"},
+	0x321C:  {true, "\u0028\u110C\u116E\u0029"},
+	0x321D:  {true, "\u0028\u110B\u1169\u110C\u1165\u11AB\u0029"},
+	0x321E:  {true, "\u0028\u110B\u1169\u1112\u116E\u0029"},
+	0x3220:  {true, "\u0028\u4E00\u0029"},
+	0x3221:  {true, "\u0028\u4E8C\u0029"},
+	0x3222:  {true, "\u0028\u4E09\u0029"},
+	0x3223:  {true, "\u0028\u56DB\u0029"},
+	0x3224:  {true, "\u0028\u4E94\u0029"},
+	0x3225:  {true, "\u0028\u516D\u0029"},
+	0x3226:  {true, "\u0028\u4E03\u0029"},
+	0x3227:  {true, "\u0028\u516B\u0029"},
+	0x3228:  {true, "\u0028\u4E5D\u0029"},
+	0x3229:  {true, "\u0028\u5341\u0029"},
+	0x322A:  {true, "\u0028\u6708\u0029"},
+	0x322B:  {true, "\u0028\u706B\u0029"},
+	0x322C:  {true, "\u0028\u6C34\u0029"},
+	0x322D:  {true, "\u0028\u6728\u0029"},
+	0x322E:  {true, "\u0028\u91D1\u0029"},
+	0x322F:  {true, "\u0028\u571F\u0029"},
+	0x3230:  {true, "\u0028\u65E5\u0029"},
+	0x3231:  {true, "\u0028\u682A\u0029"},
+	0x3232:  {true, "\u0028\u6709\u0029"},
+	0x3233:  {true, "\u0028\u793E\u0029"},
+	0x3234:  {true, "\u0028\u540D\u0029"},
+	0x3235:  {true, "\u0028\u7279\u0029"},
+	0x3236:  {true, "\u0028\u8CA1\u0029"},
+	0x3237:  {true, "\u0028\u795D\u0029"},
+	0x3238:  {true, "\u0028\u52B4\u0029"},
+	0x3239:  {true, "\u0028\u4EE3\u0029"},
+	0x323A:  {true, "\u0028\u547C\u0029"},
+	0x323B:  {true, "\u0028\u5B66\u0029"},
+	0x323C:  {true, "\u0028\u76E3\u0029"},
+	0x323D:  {true, "\u0028\u4F01\u0029"},
+	0x323E:  {true, "\u0028\u8CC7\u0029"},
+	0x323F:  {true, "\u0028\u5354\u0029"},
+	0x3240:  {true, "\u0028\u796D\u0029"},
+	0x3241:  {true, "\u0028\u4F11\u0029"},
+	0x3242:  {true, "\u0028\u81EA\u0029"},
+	0x3243:  {true, "\u0028\u81F3\u0029"},
+	0x3244:  {true, "\u554F"},
+	0x3245:  {true, "\u5E7C"},
+	0x3246:  {true, "\u6587"},
+	0x3247:  {true, "\u7B8F"},
+	0x3250:  {true, "\u0050\u0054\u0045"},
+	0x3251:  {true, "\u0032\u0031"},
+	0x3252:  {true, "\u0032\u0032"},
+	0x3253:  {true, "\u0032\u0033"},
+	0x3254:  {true, "\u0032\u0034"},
+	0x3255:  {true, "\u0032\u0035"},
+	0x3256:  {true, "\u0032\u0036"},
+	0x3257:  {true, "\u0032\u0037"},
+	0x3258:  {true, "\u0032\u0038"},
+	0x3259:  {true, "\u0032\u0039"},
+	0x325A:  {true, "\u0033\u0030"},
+	0x325B:  {true, "\u0033\u0031"},
+	0x325C:  {true, "\u0033\u0032"},
+	0x325D:  {true, "\u0033\u0033"},
+	0x325E:  {true, "\u0033\u0034"},
+	0x325F:  {true, "\u0033\u0035"},
+	0x3260:  {true, "\u1100"},
+	0x3261:  {true, "\u1102"},
+	0x3262:  {true, "\u1103"},
+	0x3263:  {true, "\u1105"},
+	0x3264:  {true, "\u1106"},
+	0x3265:  {true, "\u1107"},
+	0x3266:  {true, "\u1109"},
+	0x3267:  {true, "\u110B"},
+	0x3268:  {true, "\u110C"},
+	0x3269:  {true, "\u110E"},
+	0x326A:  {true, "\u110F"},
+	0x326B:  {true, "\u1110"},
+	0x326C:  {true, "\u1111"},
+	0x326D:  {true, "\u1112"},
+	0x326E:  {true, "\u1100\u1161"},
+	0x326F:  {true, "\u1102\u1161"},
+	0x3270:  {true, "\u1103\u1161"},
+	0x3271:  {true, "\u1105\u1161"},
+	0x3272:  {true, "\u1106\u1161"},
+	0x3273:  {true, "\u1107\u1161"},
+	0x3274:  {true, "\u1109\u1161"},
+	0x3275:  {true, "\u110B\u1161"},
+	0x3276:  {true, "\u110C\u1161"},
+	0x3277:  {true, "\u110E\u1161"},
+	0x3278:  {true, "\u110F\u1161"},
+	0x3279:  {true, "\u1110\u1161"},
+	0x327A:  {true, "\u1111\u1161"},
+	0x327B:  {true, "\u1112\u1161"},
+	0x327C:  {true, "\u110E\u1161\u11B7\u1100\u1169"},
+	0x327D:  {true, "\u110C\u116E\u110B\u1174"},
+	0x327E:  {true, "\u110B\u116E"},
+	0x3280:  {true, "\u4E00"},
+	0x3281:  {true, "\u4E8C"},
+	0x3282:  {true, "\u4E09"},
+	0x3283:  {true, "\u56DB"},
+	0x3284:  {true, "\u4E94"},
+	0x3285:  {true, "\u516D"},
+	0x3286:  {true, "\u4E03"},
+	0x3287:  {true, "\u516B"},
+	0x3288:  {true, "\u4E5D"},
+	0x3289:  {true, "\u5341"},
+	0x328A:  {true, "\u6708"},
+	0x328B:  {true, "\u706B"},
+	0x328C:  {true, "\u6C34"},
+	0x328D:  {true, "\u6728"},
+	0x328E:  {true, "\u91D1"},
+	0x328F:  {true, "\u571F"},
+	0x3290:  {true, "\u65E5"},
+	0x3291:  {true, "\u682A"},
+	0x3292:  {true, "\u6709"},
+	0x3293:  {true, "\u793E"},
+	0x3294:  {true, "\u540D"},
+	0x3295:  {true, "\u7279"},
+	0x3296:  {true, "\u8CA1"},
+	0x3297:  {true, "\u795D"},
+	0x3298:  {true, "\u52B4"},
+	0x3299:  {true, "\u79D8"},
+	0x329A:  {true, "\u7537"},
+	0x329B:  {true, "\u5973"},
+	0x329C:  {true, "\u9069"},
+	0x329D:  {true, "\u512A"},
+	0x329E:  {true, "\u5370"},
+	0x329F:  {true, "\u6CE8"},
+	0x32A0:  {true, "\u9805"},
+	0x32A1:  {true, "\u4F11"},
+	0x32A2:  {true, "\u5199"},
+	0x32A3:  {true, "\u6B63"},
+	0x32A4:  {true, "\u4E0A"},
+	0x32A5:  {true, "\u4E2D"},
+	0x32A6:  {true, "\u4E0B"},
+	0x32A7:  {true, "\u5DE6"},
+	0x32A8:  {true, "\u53F3"},
+	0x32A9:  {true, "\u533B"},
+	0x32AA:  {true, "\u5B97"},
+	0x32AB:  {true, "\u5B66"},
+	0x32AC:  {true, "\u76E3"},
+	0x32AD:  {true, "\u4F01"},
+	0x32AE:  {true, "\u8CC7"},
+	0x32AF:  {true, "\u5354"},
+	0x32B0:  {true, "\u591C"},
+	0x32B1:  {true, "\u0033\u0036"},
+	0x32B2:  {true, "\u0033\u0037"},
+	0x32B3:  {true, "\u0033\u0038"},
+	0x32B4:  {true, "\u0033\u0039"},
+	0x32B5:  {true, "\u0034\u0030"},
+	0x32B6:  {true, "\u0034\u0031"},
+	0x32B7:  {true, "\u0034\u0032"},
+	0x32B8:  {true, "\u0034\u0033"},
+	0x32B9:  {true, "\u0034\u0034"},
+	0x32BA:  {true, "\u0034\u0035"},
+	0x32BB:  {true, "\u0034\u0036"},
+	0x32BC:  {true, "\u0034\u0037"},
+	0x32BD:  {true, "\u0034\u0038"},
+	0x32BE:  {true, "\u0034\u0039"},
+	0x32BF:  {true, "\u0035\u0030"},
+	0x32C0:  {true, "\u0031\u6708"},
+	0x32C1:  {true, "\u0032\u6708"},
+	0x32C2:  {true, "\u0033\u6708"},
+	0x32C3:  {true, "\u0034\u6708"},
+	0x32C4:  {true, "\u0035\u6708"},
+	0x32C5:  {true, "\u0036\u6708"},
+	0x32C6:  {true, "\u0037\u6708"},
+	0x32C7:  {true, "\u0038\u6708"},
+	0x32C8:  {true, "\u0039\u6708"},
+	0x32C9:  {true, "\u0031\u0030\u6708"},
+	0x32CA:  {true, "\u0031\u0031\u6708"},
+	0x32CB:  {true, "\u0031\u0032\u6708"},
+	0x32CC:  {true, "\u0048\u0067"},
+	0x32CD:  {true, "\u0065\u0072\u0067"},
+	0x32CE:  {true, "\u0065\u0056"},
+	0x32CF:  {true, "\u004C\u0054\u0044"},
+	0x32D0:  {true, "\u30A2"},
+	0x32D1:  {true, "\u30A4"},
+	0x32D2:  {true, "\u30A6"},
+	0x32D3:  {true, "\u30A8"},
+	0x32D4:  {true, "\u30AA"},
+	0x32D5:  {true, "\u30AB"},
+	0x32D6:  {true, "\u30AD"},
+	0x32D7:  {true, "\u30AF"},
+	0x32D8:  {true, "\u30B1"},
+	0x32D9:  {true, "\u30B3"},
+	0x32DA:  {true, "\u30B5"},
+	0x32DB:  {true, "\u30B7"},
+	0x32DC:  {true, "\u30B9"},
+	0x32DD:  {true, "\u30BB"},
+	0x32DE:  {true, "\u30BD"},
+	0x32DF:  {true, "\u30BF"},
+	0x32E0:  {true, "\u30C1"},
+	0x32E1:  {true, "\u30C4"},
+	0x32E2:  {true, "\u30C6"},
+	0x32E3:  {true, "\u30C8"},
+	0x32E4:  {true, "\u30CA"},
+	0x32E5:  {true, "\u30CB"},
+	0x32E6:  {true, "\u30CC"},
+	0x32E7:  {true, "\u30CD"},
+	0x32E8:  {true, "\u30CE"},
+	0x32E9:  {true, "\u30CF"},
+	0x32EA:  {true, "\u30D2"},
+	0x32EB:  {true, "\u30D5"},
+	0x32EC:  {true, "\u30D8"},
+	0x32ED:  {true, "\u30DB"},
+	0x32EE:  {true, "\u30DE"},
+	0x32EF:  {true, "\u30DF"},
+	0x32F0:  {true, "\u30E0"},
+	0x32F1:  {true, "\u30E1"},
+	0x32F2:  {true, "\u30E2"},
+	0x32F3:  {true, "\u30E4"},
+	0x32F4:  {true, "\u30E6"},
+	0x32F5:  {true, "\u30E8"},
+	0x32F6:  {true, "\u30E9"},
+	0x32F7:  {true, "\u30EA"},
+	0x32F8:  {true, "\u30EB"},
+	0x32F9:  {true, "\u30EC"},
+	0x32FA:  {true, "\u30ED"},
+	0x32FB:  {true, "\u30EF"},
+	0x32FC:  {true, "\u30F0"},
+	0x32FD:  {true, "\u30F1"},
+	0x32FE:  {true, "\u30F2"},
+	0x32FF:  {true, "\u4EE4\u548C"},
+	0x3300:  {true, "\u30A2\u30CF\u309A\u30FC\u30C8"},
+	0x3301:  {true, "\u30A2\u30EB\u30D5\u30A1"},
+	0x3302:  {true, "\u30A2\u30F3\u30D8\u309A\u30A2"},
+	0x3303:  {true, "\u30A2\u30FC\u30EB"},
+	0x3304:  {true, "\u30A4\u30CB\u30F3\u30AF\u3099"},
+	0x3305:  {true, "\u30A4\u30F3\u30C1"},
+	0x3306:  {true, "\u30A6\u30A9\u30F3"},
+	0x3307:  {true, "\u30A8\u30B9\u30AF\u30FC\u30C8\u3099"},
+	0x3308:  {true, "\u30A8\u30FC\u30AB\u30FC"},
+	0x3309:  {true, "\u30AA\u30F3\u30B9"},
+	0x330A:  {true, "\u30AA\u30FC\u30E0"},
+	0x330B:  {true, "\u30AB\u30A4\u30EA"},
+	0x330C:  {true, "\u30AB\u30E9\u30C3\u30C8"},
+	0x330D:  {true, "\u30AB\u30ED\u30EA\u30FC"},
+	0x330E:  {true, "\u30AB\u3099\u30ED\u30F3"},
+	0x330F:  {true, "\u30AB\u3099\u30F3\u30DE"},
+	0x3310:  {true, "\u30AD\u3099\u30AB\u3099"},
+	0x3311:  {true, "\u30AD\u3099\u30CB\u30FC"},
+	0x3312:  {true, "\u30AD\u30E5\u30EA\u30FC"},
+	0x3313:  {true, "\u30AD\u3099\u30EB\u30BF\u3099\u30FC"},
+	0x3314:  {true, "\u30AD\u30ED"},
+	0x3315:  {true, "\u30AD\u30ED\u30AF\u3099\u30E9\u30E0"},
+	0x3316:  {true, "\u30AD\u30ED\u30E1\u30FC\u30C8\u30EB"},
+	0x3317:  {true, "\u30AD\u30ED\u30EF\u30C3\u30C8"},
+	0x3318:  {true, "\u30AF\u3099\u30E9\u30E0"},
+	0x3319:  {true, "\u30AF\u3099\u30E9\u30E0\u30C8\u30F3"},
+	0x331A:  {true, "\u30AF\u30EB\u30BB\u3099\u30A4\u30ED"},
+	0x331B:  {true, "\u30AF\u30ED\u30FC\u30CD"},
+	0x331C:  {true, "\u30B1\u30FC\u30B9"},
+	0x331D:  {true, "\u30B3\u30EB\u30CA"},
+	0x331E:  {true, "\u30B3\u30FC\u30DB\u309A"},
+	0x331F:  {true, "\u30B5\u30A4\u30AF\u30EB"},
+	0x3320:  {true, "\u30B5\u30F3\u30C1\u30FC\u30E0"},
+	0x3321:  {true, "\u30B7\u30EA\u30F3\u30AF\u3099"},
+	0x3322:  {true, "\u30BB\u30F3\u30C1"},
+	0x3323:  {true, "\u30BB\u30F3\u30C8"},
+	0x3324:  {true, "\u30BF\u3099\u30FC\u30B9"},
+	0x3325:  {true, "\u30C6\u3099\u30B7"},
+	0x3326:  {true, "\u30C8\u3099\u30EB"},
+	0x3327:  {true, "\u30C8\u30F3"},
+	0x3328:  {true, "\u30CA\u30CE"},
+	0x3329:  {true, "\u30CE\u30C3\u30C8"},
+	0x332A:  {true, "\u30CF\u30A4\u30C4"},
+	0x332B:  {true, "\u30CF\u309A\u30FC\u30BB\u30F3\u30C8"},
+	0x332C:  {true, "\u30CF\u309A\u30FC\u30C4"},
+	0x332D:  {true, "\u30CF\u3099\u30FC\u30EC\u30EB"},
+	0x332E:  {true, "\u30D2\u309A\u30A2\u30B9\u30C8\u30EB"},
+	0x332F:  {true, "\u30D2\u309A\u30AF\u30EB"},
+	0x3330:  {true, "\u30D2\u309A\u30B3"},
+	0x3331:  {true, "\u30D2\u3099\u30EB"},
+	0x3332:  {true, "\u30D5\u30A1\u30E9\u30C3\u30C8\u3099"},
+	0x3333:  {true, "\u30D5\u30A3\u30FC\u30C8"},
+	0x3334:  {true, "\u30D5\u3099\u30C3\u30B7\u30A7\u30EB"},
+	0x3335:  {true, "\u30D5\u30E9\u30F3"},
+	0x3336:  {true, "\u30D8\u30AF\u30BF\u30FC\u30EB"},
+	0x3337:  {true, "\u30D8\u309A\u30BD"},
+	0x3338:  {true, "\u30D8\u309A\u30CB\u30D2"},
+	0x3339:  {true, "\u30D8\u30EB\u30C4"},
+	0x333A:  {true, "\u30D8\u309A\u30F3\u30B9"},
+	0x333B:  {true, "\u30D8\u309A\u30FC\u30B7\u3099"},
+	0x333C:  {true, "\u30D8\u3099\u30FC\u30BF"},
+	0x333D:  {true, "\u30DB\u309A\u30A4\u30F3\u30C8"},
+	0x333E:  {true, "\u30DB\u3099\u30EB\u30C8"},
+	0x333F:  {true, "\u30DB\u30F3"},
+	0x3340:  {true, "\u30DB\u309A\u30F3\u30C8\u3099"},
+	0x3341:  {true, "\u30DB\u30FC\u30EB"},
+	0x3342:  {true, "\u30DB\u30FC\u30F3"},
+	0x3343:  {true, "\u30DE\u30A4\u30AF\u30ED"},
+	0x3344:  {true, "\u30DE\u30A4\u30EB"},
+	0x3345:  {true, "\u30DE\u30C3\u30CF"},
+	0x3346:  {true, "\u30DE\u30EB\u30AF"},
+	0x3347:  {true, "\u30DE\u30F3\u30B7\u30E7\u30F3"},
+	0x3348:  {true, "\u30DF\u30AF\u30ED\u30F3"},
+	0x3349:  {true, "\u30DF\u30EA"},
+	0x334A:  {true, "\u30DF\u30EA\u30CF\u3099\u30FC\u30EB"},
+	0x334B:  {true, "\u30E1\u30AB\u3099"},
+	0x334C:  {true, "\u30E1\u30AB\u3099\u30C8\u30F3"},
+	0x334D:  {true, "\u30E1\u30FC\u30C8\u30EB"},
+	0x334E:  {true, "\u30E4\u30FC\u30C8\u3099"},
+	0x334F:  {true, "\u30E4\u30FC\u30EB"},
+	0x3350:  {true, "\u30E6\u30A2\u30F3"},
+	0x3351:  {true, "\u30EA\u30C3\u30C8\u30EB"},
+	0x3352:  {true, "\u30EA\u30E9"},
+	0x3353:  {true, "\u30EB\u30D2\u309A\u30FC"},
+	0x3354:  {true, "\u30EB\u30FC\u30D5\u3099\u30EB"},
+	0x3355:  {true, "\u30EC\u30E0"},
+	0x3356:  {true, "\u30EC\u30F3\u30C8\u30B1\u3099\u30F3"},
+	0x3357:  {true, "\u30EF\u30C3\u30C8"},
+	0x3358:  {true, "\u0030\u70B9"},
+	0x3359:  {true, "\u0031\u70B9"},
+	0x335A:  {true, "\u0032\u70B9"},
+	0x335B:  {true, "\u0033\u70B9"},
+	0x335C:  {true, "\u0034\u70B9"},
+	0x335D:  {true, "\u0035\u70B9"},
+	0x335E:  {true, "\u0036\u70B9"},
+	0x335F:  {true, "\u0037\u70B9"},
+	0x3360:  {true, "\u0038\u70B9"},
+	0x3361:  {true, "\u0039\u70B9"},
+	0x3362:  {true, "\u0031\u0030\u70B9"},
+	0x3363:  {true, "\u0031\u0031\u70B9"},
+	0x3364:  {true, "\u0031\u0032\u70B9"},
+	0x3365:  {true, "\u0031\u0033\u70B9"},
+	0x3366:  {true, "\u0031\u0034\u70B9"},
+	0x3367:  {true, "\u0031\u0035\u70B9"},
+	0x3368:  {true, "\u0031\u0036\u70B9"},
+	0x3369:  {true, "\u0031\u0037\u70B9"},
+	0x336A:  {true, "\u0031\u0038\u70B9"},
+	0x336B:  {true, "\u0031\u0039\u70B9"},
+	0x336C:  {true, "\u0032\u0030\u70B9"},
+	0x336D:  {true, "\u0032\u0031\u70B9"},
+	0x336E:  {true, "\u0032\u0032\u70B9"},
+	0x336F:  {true, "\u0032\u0033\u70B9"},
+	0x3370:  {true, "\u0032\u0034\u70B9"},
+	0x3371:  {true, "\u0068\u0050\u0061"},
+	0x3372:  {true, "\u0064\u0061"},
+	0x3373:  {true, "\u0041\u0055"},
+	0x3374:  {true, "\u0062\u0061\u0072"},
+	0x3375:  {true, "\u006F\u0056"},
+	0x3376:  {true, "\u0070\u0063"},
+	0x3377:  {true, "\u0064\u006D"},
+	0x3378:  {true, "\u0064\u006D\u0032"},
+	0x3379:  {true, "\u0064\u006D\u0033"},
+	0x337A:  {true, "\u0049\u0055"},
+	0x337B:  {true, "\u5E73\u6210"},
+	0x337C:  {true, "\u662D\u548C"},
+	0x337D:  {true, "\u5927\u6B63"},
+	0x337E:  {true, "\u660E\u6CBB"},
+	0x337F:  {true, "\u682A\u5F0F\u4F1A\u793E"},
+	0x3380:  {true, "\u0070\u0041"},
+	0x3381:  {true, "\u006E\u0041"},
+	0x3382:  {true, "\u03BC\u0041"},
+	0x3383:  {true, "\u006D\u0041"},
+	0x3384:  {true, "\u006B\u0041"},
+	0x3385:  {true, "\u004B\u0042"},
+	0x3386:  {true, "\u004D\u0042"},
+	0x3387:  {true, "\u0047\u0042"},
+	0x3388:  {true, "\u0063\u0061\u006C"},
+	0x3389:  {true, "\u006B\u0063\u0061\u006C"},
+	0x338A:  {true, "\u0070\u0046"},
+	0x338B:  {true, "\u006E\u0046"},
+	0x338C:  {true, "\u03BC\u0046"},
+	0x338D:  {true, "\u03BC\u0067"},
+	0x338E:  {true, "\u006D\u0067"},
+	0x338F:  {true, "\u006B\u0067"},
+	0x3390:  {true, "\u0048\u007A"},
+	0x3391:  {true, "\u006B\u0048\u007A"},
+	0x3392:  {true, "\u004D\u0048\u007A"},
+	0x3393:  {true, "\u0047\u0048\u007A"},
+	0x3394:  {true, "\u0054\u0048\u007A"},
+	0x3395:  {true, "\u03BC\u006C"},
+	0x3396:  {true, "\u006D\u006C"},
+	0x3397:  {true, "\u0064\u006C"},
+	0x3398:  {true, "\u006B\u006C"},
+	0x3399:  {true, "\u0066\u006D"},
+	0x339A:  {true, "\u006E\u006D"},
+	0x339B:  {true, "\u03BC\u006D"},
+	0x339C:  {true, "\u006D\u006D"},
+	0x339D:  {true, "\u0063\u006D"},
+	0x339E:  {true, "\u006B\u006D"},
+	0x339F:  {true, "\u006D\u006D\u0032"},
+	0x33A0:  {true, "\u0063\u006D\u0032"},
+	0x33A1:  {true, "\u006D\u0032"},
+	0x33A2:  {true, "\u006B\u006D\u0032"},
+	0x33A3:  {true, "\u006D\u006D\u0033"},
+	0x33A4:  {true, "\u0063\u006D\u0033"},
+	0x33A5:  {true, "\u006D\u0033"},
+	0x33A6:  {true, "\u006B\u006D\u0033"},
+	0x33A7:  {true, "\u006D\u2215\u0073"},
+	0x33A8:  {true, "\u006D\u2215\u0073\u0032"},
+	0x33A9:  {true, "\u0050\u0061"},
+	0x33AA:  {true, "\u006B\u0050\u0061"},
+	0x33AB:  {true, "\u004D\u0050\u0061"},
+	0x33AC:  {true, "\u0047\u0050\u0061"},
+	0x33AD:  {true, "\u0072\u0061\u0064"},
+	0x33AE:  {true, "\u0072\u0061\u0064\u2215\u0073"},
+	0x33AF:  {true, "\u0072\u0061\u0064\u2215\u0073\u0032"},
+	0x33B0:  {true, "\u0070\u0073"},
+	0x33B1:  {true, "\u006E\u0073"},
+	0x33B2:  {true, "\u03BC\u0073"},
+	0x33B3:  {true, "\u006D\u0073"},
+	0x33B4:  {true, "\u0070\u0056"},
+	0x33B5:  {true, "\u006E\u0056"},
+	0x33B6:  {true, "\u03BC\u0056"},
+	0x33B7:  {true, "\u006D\u0056"},
+	0x33B8:  {true, "\u006B\u0056"},
+	0x33B9:  {true, "\u004D\u0056"},
+	0x33BA:  {true, "\u0070\u0057"},
+	0x33BB:  {true, "\u006E\u0057"},
+	0x33BC:  {true, "\u03BC\u0057"},
+	0x33BD:  {true, "\u006D\u0057"},
+	0x33BE:  {true, "\u006B\u0057"},
+	0x33BF:  {true, "\u004D\u0057"},
+	0x33C0:  {true, "\u006B\u03A9"},
+	0x33C1:  {true, "\u004D\u03A9"},
+	0x33C2:  {true, "\u0061\u002E\u006D\u002E"},
+	0x33C3:  {true, "\u0042\u0071"},
+	0x33C4:  {true, "\u0063\u0063"},
+	0x33C5:  {true, "\u0063\u0064"},
+	0x33C6:  {true, "\u0043\u2215\u006B\u0067"},
+	0x33C7:  {true, "\u0043\u006F\u002E"},
+	0x33C8:  {true, "\u0064\u0042"},
+	0x33C9:  {true, "\u0047\u0079"},
+	0x33CA:  {true, "\u0068\u0061"},
+	0x33CB:  {true, "\u0048\u0050"},
+	0x33CC:  {true, "\u0069\u006E"},
+	0x33CD:  {true, "\u004B\u004B"},
+	0x33CE:  {true, "\u004B\u004D"},
+	0x33CF:  {true, "\u006B\u0074"},
+	0x33D0:  {true, "\u006C\u006D"},
+	0x33D1:  {true, "\u006C\u006E"},
+	0x33D2:  {true, "\u006C\u006F\u0067"},
+	0x33D3:  {true, "\u006C\u0078"},
+	0x33D4:  {true, "\u006D\u0062"},
+	0x33D5:  {true, "\u006D\u0069\u006C"},
+	0x33D6:  {true, "\u006D\u006F\u006C"},
+	0x33D7:  {true, "\u0050\u0048"},
+	0x33D8:  {true, "\u0070\u002E\u006D\u002E"},
+	0x33D9:  {true, "\u0050\u0050\u004D"},
+	0x33DA:  {true, "\u0050\u0052"},
+	0x33DB:  {true, "\u0073\u0072"},
+	0x33DC:  {true, "\u0053\u0076"},
+	0x33DD:  {true, "\u0057\u0062"},
+	0x33DE:  {true, "\u0056\u2215\u006D"},
+	0x33DF:  {true, "\u0041\u2215\u006D"},
+	0x33E0:  {true, "\u0031\u65E5"},
+	0x33E1:  {true, "\u0032\u65E5"},
+	0x33E2:  {true, "\u0033\u65E5"},
+	0x33E3:  {true, "\u0034\u65E5"},
+	0x33E4:  {true, "\u0035\u65E5"},
+	0x33E5:  {true, "\u0036\u65E5"},
+	0x33E6:  {true, "\u0037\u65E5"},
+	0x33E7:  {true, "\u0038\u65E5"},
+	0x33E8:  {true, "\u0039\u65E5"},
+	0x33E9:  {true, "\u0031\u0030\u65E5"},
+	0x33EA:  {true, "\u0031\u0031\u65E5"},
+	0x33EB:  {true, "\u0031\u0032\u65E5"},
+	0x33EC:  {true, "\u0031\u0033\u65E5"},
+	0x33ED:  {true, "\u0031\u0034\u65E5"},
+	0x33EE:  {true, "\u0031\u0035\u65E5"},
+	0x33EF:  {true, "\u0031\u0036\u65E5"},
+	0x33F0:  {true, "\u0031\u0037\u65E5"},
+	0x33F1:  {true, "\u0031\u0038\u65E5"},
+	0x33F2:  {true, "\u0031\u0039\u65E5"},
+	0x33F3:  {true, "\u0032\u0030\u65E5"},
+	0x33F4:  {true, "\u0032\u0031\u65E5"},
+	0x33F5:  {true, "\u0032\u0032\u65E5"},
+	0x33F6:  {true, "\u0032\u0033\u65E5"},
+	0x33F7:  {true, "\u0032\u0034\u65E5"},
+	0x33F8:  {true, "\u0032\u0035\u65E5"},
+	0x33F9:  {true, "\u0032\u0036\u65E5"},
+	0x33FA:  {true, "\u0032\u0037\u65E5"},
+	0x33FB:  {true, "\u0032\u0038\u65E5"},
+	0x33FC:  {true, "\u0032\u0039\u65E5"},
+	0x33FD:  {true, "\u0033\u0030\u65E5"},
+	0x33FE:  {true, "\u0033\u0031\u65E5"},
+	0x33FF:  {true, "\u0067\u0061\u006C"},
+	0xA69C:  {true, "\u044A"},
+	0xA69D:  {true, "\u044C"},
+	0xA770:  {true, "\uA76F"},
+	0xA7F1:  {true, "\u0053"},
+	0xA7F2:  {true, "\u0043"},
+	0xA7F3:  {true, "\u0046"},
+	0xA7F4:  {true, "\u0051"},
+	0xA7F8:  {true, "\u0126"},
+	0xA7F9:  {true, "\u0153"},
+	0xAB5C:  {true, "\uA727"},
+	0xAB5D:  {true, "\uAB37"},
+	0xAB5E:  {true, "\u026B"},
+	0xAB5F:  {true, "\uAB52"},
+	0xAB69:  {true, "\u028D"},
+	0xF900:  {false, "\u8C48"},
+	0xF901:  {false, "\u66F4"},
+	0xF902:  {false, "\u8ECA"},
+	0xF903:  {false, "\u8CC8"},
+	0xF904:  {false, "\u6ED1"},
+	0xF905:  {false, "\u4E32"},
+	0xF906:  {false, "\u53E5"},
+	0xF907:  {false, "\u9F9C"},
+	0xF908:  {false, "\u9F9C"},
+	0xF909:  {false, "\u5951"},
+	0xF90A:  {false, "\u91D1"},
+	0xF90B:  {false, "\u5587"},
+	0xF90C:  {false, "\u5948"},
+	0xF90D:  {false, "\u61F6"},
+	0xF90E:  {false, "\u7669"},
+	0xF90F:  {false, "\u7F85"},
+	0xF910:  {false, "\u863F"},
+	0xF911:  {false, "\u87BA"},
+	0xF912:  {false, "\u88F8"},
+	0xF913:  {false, "\u908F"},
+	0xF914:  {false, "\u6A02"},
+	0xF915:  {false, "\u6D1B"},
+	0xF916:  {false, "\u70D9"},
+	0xF917:  {false, "\u73DE"},
+	0xF918:  {false, "\u843D"},
+	0xF919:  {false, "\u916A"},
+	0xF91A:  {false, "\u99F1"},
+	0xF91B:  {false, "\u4E82"},
+	0xF91C:  {false, "\u5375"},
+	0xF91D:  {false, "\u6B04"},
+	0xF91E:  {false, "\u721B"},
+	0xF91F:  {false, "\u862D"},
+	0xF920:  {false, "\u9E1E"},
+	0xF921:  {false, "\u5D50"},
+	0xF922:  {false, "\u6FEB"},
+	0xF923:  {false, "\u85CD"},
+	0xF924:  {false, "\u8964"},
+	0xF925:  {false, "\u62C9"},
+	0xF926:  {false, "\u81D8"},
+	0xF927:  {false, "\u881F"},
+	0xF928:  {false, "\u5ECA"},
+	0xF929:  {false, "\u6717"},
+	0xF92A:  {false, "\u6D6A"},
+	0xF92B:  {false, "\u72FC"},
+	0xF92C:  {false, "\u90CE"},
+	0xF92D:  {false, "\u4F86"},
+	0xF92E:  {false, "\u51B7"},
+	0xF92F:  {false, "\u52DE"},
+	0xF930:  {false, "\u64C4"},
+	0xF931:  {false, "\u6AD3"},
+	0xF932:  {false, "\u7210"},
+	0xF933:  {false, "\u76E7"},
+	0xF934:  {false, "\u8001"},
+	0xF935:  {false, "\u8606"},
+	0xF936:  {false, "\u865C"},
+	0xF937:  {false, "\u8DEF"},
+	0xF938:  {false, "\u9732"},
+	0xF939:  {false, "\u9B6F"},
+	0xF93A:  {false, "\u9DFA"},
+	0xF93B:  {false, "\u788C"},
+	0xF93C:  {false, "\u797F"},
+	0xF93D:  {false, "\u7DA0"},
+	0xF93E:  {false, "\u83C9"},
+	0xF93F:  {false, "\u9304"},
+	0xF940:  {false, "\u9E7F"},
+	0xF941:  {false, "\u8AD6"},
+	0xF942:  {false, "\u58DF"},
+	0xF943:  {false, "\u5F04"},
+	0xF944:  {false, "\u7C60"},
+	0xF945:  {false, "\u807E"},
+	0xF946:  {false, "\u7262"},
+	0xF947:  {false, "\u78CA"},
+	0xF948:  {false, "\u8CC2"},
+	0xF949:  {false, "\u96F7"},
+	0xF94A:  {false, "\u58D8"},
+	0xF94B:  {false, "\u5C62"},
+	0xF94C:  {false, "\u6A13"},
+	0xF94D:  {false, "\u6DDA"},
+	0xF94E:  {false, "\u6F0F"},
+	0xF94F:  {false, "\u7D2F"},
+	0xF950:  {false, "\u7E37"},
+	0xF951:  {false, "\u964B"},
+	0xF952:  {false, "\u52D2"},
+	0xF953:  {false, "\u808B"},
+	0xF954:  {false, "\u51DC"},
+	0xF955:  {false, "\u51CC"},
+	0xF956:  {false, "\u7A1C"},
+	0xF957:  {false, "\u7DBE"},
+	0xF958:  {false, "\u83F1"},
+	0xF959:  {false, "\u9675"},
+	0xF95A:  {false, "\u8B80"},
+	0xF95B:  {false, "\u62CF"},
+	0xF95C:  {false, "\u6A02"},
+	0xF95D:  {false, "\u8AFE"},
+	0xF95E:  {false, "\u4E39"},
+	0xF95F:  {false, "\u5BE7"},
+	0xF960:  {false, "\u6012"},
+	0xF961:  {false, "\u7387"},
+	0xF962:  {false, "\u7570"},
+	0xF963:  {false, "\u5317"},
+	0xF964:  {false, "\u78FB"},
+	0xF965:  {false, "\u4FBF"},
+	0xF966:  {false, "\u5FA9"},
+	0xF967:  {false, "\u4E0D"},
+	0xF968:  {false, "\u6CCC"},
+	0xF969:  {false, "\u6578"},
+	0xF96A:  {false, "\u7D22"},
+	0xF96B:  {false, "\u53C3"},
+	0xF96C:  {false, "\u585E"},
+	0xF96D:  {false, "\u7701"},
+	0xF96E:  {false, "\u8449"},
+	0xF96F:  {false, "\u8AAA"},
+	0xF970:  {false, "\u6BBA"},
+	0xF971:  {false, "\u8FB0"},
+	0xF972:  {false, "\u6C88"},
+	0xF973:  {false, "\u62FE"},
+	0xF974:  {false, "\u82E5"},
+	0xF975:  {false, "\u63A0"},
+	0xF976:  {false, "\u7565"},
+	0xF977:  {false, "\u4EAE"},
+	0xF978:  {false, "\u5169"},
+	0xF979:  {false, "\u51C9"},
+	0xF97A:  {false, "\u6881"},
+	0xF97B:  {false, "\u7CE7"},
+	0xF97C:  {false, "\u826F"},
+	0xF97D:  {false, "\u8AD2"},
+	0xF97E:  {false, "\u91CF"},
+	0xF97F:  {false, "\u52F5"},
+	0xF980:  {false, "\u5442"},
+	0xF981:  {false, "\u5973"},
+	0xF982:  {false, "\u5EEC"},
+	0xF983:  {false, "\u65C5"},
+	0xF984:  {false, "\u6FFE"},
+	0xF985:  {false, "\u792A"},
+	0xF986:  {false, "\u95AD"},
+	0xF987:  {false, "\u9A6A"},
+	0xF988:  {false, "\u9E97"},
+	0xF989:  {false, "\u9ECE"},
+	0xF98A:  {false, "\u529B"},
+	0xF98B:  {false, "\u66C6"},
+	0xF98C:  {false, "\u6B77"},
+	0xF98D:  {false, "\u8F62"},
+	0xF98E:  {false, "\u5E74"},
+	0xF98F:  {false, "\u6190"},
+	0xF990:  {false, "\u6200"},
+	0xF991:  {false, "\u649A"},
+	0xF992:  {false, "\u6F23"},
+	0xF993:  {false, "\u7149"},
+	0xF994:  {false, "\u7489"},
+	0xF995:  {false, "\u79CA"},
+	0xF996:  {false, "\u7DF4"},
+	0xF997:  {false, "\u806F"},
+	0xF998:  {false, "\u8F26"},
+	0xF999:  {false, "\u84EE"},
+	0xF99A:  {false, "\u9023"},
+	0xF99B:  {false, "\u934A"},
+	0xF99C:  {false, "\u5217"},
+	0xF99D:  {false, "\u52A3"},
+	0xF99E:  {false, "\u54BD"},
+	0xF99F:  {false, "\u70C8"},
+	0xF9A0:  {false, "\u88C2"},
+	0xF9A1:  {false, "\u8AAA"},
+	0xF9A2:  {false, "\u5EC9"},
+	0xF9A3:  {false, "\u5FF5"},
+	0xF9A4:  {false, "\u637B"},
+	0xF9A5:  {false, "\u6BAE"},
+	0xF9A6:  {false, "\u7C3E"},
+	0xF9A7:  {false, "\u7375"},
+	0xF9A8:  {false, "\u4EE4"},
+	0xF9A9:  {false, "\u56F9"},
+	0xF9AA:  {false, "\u5BE7"},
+	0xF9AB:  {false, "\u5DBA"},
+	0xF9AC:  {false, "\u601C"},
+	0xF9AD:  {false, "\u73B2"},
+	0xF9AE:  {false, "\u7469"},
+	0xF9AF:  {false, "\u7F9A"},
+	0xF9B0:  {false, "\u8046"},
+	0xF9B1:  {false, "\u9234"},
+	0xF9B2:  {false, "\u96F6"},
+	0xF9B3:  {false, "\u9748"},
+	0xF9B4:  {false, "\u9818"},
+	0xF9B5:  {false, "\u4F8B"},
+	0xF9B6:  {false, "\u79AE"},
+	0xF9B7:  {false, "\u91B4"},
+	0xF9B8:  {false, "\u96B8"},
+	0xF9B9:  {false, "\u60E1"},
+	0xF9BA:  {false, "\u4E86"},
+	0xF9BB:  {false, "\u50DA"},
+	0xF9BC:  {false, "\u5BEE"},
+	0xF9BD:  {false, "\u5C3F"},
+	0xF9BE:  {false, "\u6599"},
+	0xF9BF:  {false, "\u6A02"},
+	0xF9C0:  {false, "\u71CE"},
+	0xF9C1:  {false, "\u7642"},
+	0xF9C2:  {false, "\u84FC"},
+	0xF9C3:  {false, "\u907C"},
+	0xF9C4:  {false, "\u9F8D"},
+	0xF9C5:  {false, "\u6688"},
+	0xF9C6:  {false, "\u962E"},
+	0xF9C7:  {false, "\u5289"},
+	0xF9C8:  {false, "\u677B"},
+	0xF9C9:  {false, "\u67F3"},
+	0xF9CA:  {false, "\u6D41"},
+	0xF9CB:  {false, "\u6E9C"},
+	0xF9CC:  {false, "\u7409"},
+	0xF9CD:  {false, "\u7559"},
+	0xF9CE:  {false, "\u786B"},
+	0xF9CF:  {false, "\u7D10"},
+	0xF9D0:  {false, "\u985E"},
+	0xF9D1:  {false, "\u516D"},
+	0xF9D2:  {false, "\u622E"},
+	0xF9D3:  {false, "\u9678"},
+	0xF9D4:  {false, "\u502B"},
+	0xF9D5:  {false, "\u5D19"},
+	0xF9D6:  {false, "\u6DEA"},
+	0xF9D7:  {false, "\u8F2A"},
+	0xF9D8:  {false, "\u5F8B"},
+	0xF9D9:  {false, "\u6144"},
+	0xF9DA:  {false, "\u6817"},
+	0xF9DB:  {false, "\u7387"},
+	0xF9DC:  {false, "\u9686"},
+	0xF9DD:  {false, "\u5229"},
+	0xF9DE:  {false, "\u540F"},
+	0xF9DF:  {false, "\u5C65"},
+	0xF9E0:  {false, "\u6613"},
+	0xF9E1:  {false, "\u674E"},
+	0xF9E2:  {false, "\u68A8"},
+	0xF9E3:  {false, "\u6CE5"},
+	0xF9E4:  {false, "\u7406"},
+	0xF9E5:  {false, "\u75E2"},
+	0xF9E6:  {false, "\u7F79"},
+	0xF9E7:  {false, "\u88CF"},
+	0xF9E8:  {false, "\u88E1"},
+	0xF9E9:  {false, "\u91CC"},
+	0xF9EA:  {false, "\u96E2"},
+	0xF9EB:  {false, "\u533F"},
+	0xF9EC:  {false, "\u6EBA"},
+	0xF9ED:  {false, "\u541D"},
+	0xF9EE:  {false, "\u71D0"},
+	0xF9EF:  {false, "\u7498"},
+	0xF9F0:  {false, "\u85FA"},
+	0xF9F1:  {false, "\u96A3"},
+	0xF9F2:  {false, "\u9C57"},
+	0xF9F3:  {false, "\u9E9F"},
+	0xF9F4:  {false, "\u6797"},
+	0xF9F5:  {false, "\u6DCB"},
+	0xF9F6:  {false, "\u81E8"},
+	0xF9F7:  {false, "\u7ACB"},
+	0xF9F8:  {false, "\u7B20"},
+	0xF9F9:  {false, "\u7C92"},
+	0xF9FA:  {false, "\u72C0"},
+	0xF9FB:  {false, "\u7099"},
+	0xF9FC:  {false, "\u8B58"},
+	0xF9FD:  {false, "\u4EC0"},
+	0xF9FE:  {false, "\u8336"},
+	0xF9FF:  {false, "\u523A"},
+	0xFA00:  {false, "\u5207"},
+	0xFA01:  {false, "\u5EA6"},
+	0xFA02:  {false, "\u62D3"},
+	0xFA03:  {false, "\u7CD6"},
+	0xFA04:  {false, "\u5B85"},
+	0xFA05:  {false, "\u6D1E"},
+	0xFA06:  {false, "\u66B4"},
+	0xFA07:  {false, "\u8F3B"},
+	0xFA08:  {false, "\u884C"},
+	0xFA09:  {false, "\u964D"},
+	0xFA0A:  {false, "\u898B"},
+	0xFA0B:  {false, "\u5ED3"},
+	0xFA0C:  {false, "\u5140"},
+	0xFA0D:  {false, "\u55C0"},
+	0xFA10:  {false, "\u585A"},
+	0xFA12:  {false, "\u6674"},
+	0xFA15:  {false, "\u51DE"},
+	0xFA16:  {false, "\u732A"},
+	0xFA17:  {false, "\u76CA"},
+	0xFA18:  {false, "\u793C"},
+	0xFA19:  {false, "\u795E"},
+	0xFA1A:  {false, "\u7965"},
+	0xFA1B:  {false, "\u798F"},
+	0xFA1C:  {false, "\u9756"},
+	0xFA1D:  {false, "\u7CBE"},
+	0xFA1E:  {false, "\u7FBD"},
+	0xFA20:  {false, "\u8612"},
+	0xFA22:  {false, "\u8AF8"},
+	0xFA25:  {false, "\u9038"},
+	0xFA26:  {false, "\u90FD"},
+	0xFA2A:  {false, "\u98EF"},
+	0xFA2B:  {false, "\u98FC"},
+	0xFA2C:  {false, "\u9928"},
+	0xFA2D:  {false, "\u9DB4"},
+	0xFA2E:  {false, "\u90DE"},
+	0xFA2F:  {false, "\u96B7"},
+	0xFA30:  {false, "\u4FAE"},
+	0xFA31:  {false, "\u50E7"},
+	0xFA32:  {false, "\u514D"},
+	0xFA33:  {false, "\u52C9"},
+	0xFA34:  {false, "\u52E4"},
+	0xFA35:  {false, "\u5351"},
+	0xFA36:  {false, "\u559D"},
+	0xFA37:  {false, "\u5606"},
+	0xFA38:  {false, "\u5668"},
+	0xFA39:  {false, "\u5840"},
+	0xFA3A:  {false, "\u58A8"},
+	0xFA3B:  {false, "\u5C64"},
+	0xFA3C:  {false, "\u5C6E"},
+	0xFA3D:  {false, "\u6094"},
+	0xFA3E:  {false, "\u6168"},
+	0xFA3F:  {false, "\u618E"},
+	0xFA40:  {false, "\u61F2"},
+	0xFA41:  {false, "\u654F"},
+	0xFA42:  {false, "\u65E2"},
+	0xFA43:  {false, "\u6691"},
+	0xFA44:  {false, "\u6885"},
+	0xFA45:  {false, "\u6D77"},
+	0xFA46:  {false, "\u6E1A"},
+	0xFA47:  {false, "\u6F22"},
+	0xFA48:  {false, "\u716E"},
+	0xFA49:  {false, "\u722B"},
+	0xFA4A:  {false, "\u7422"},
+	0xFA4B:  {false, "\u7891"},
+	0xFA4C:  {false, "\u793E"},
+	0xFA4D:  {false, "\u7949"},
+	0xFA4E:  {false, "\u7948"},
+	0xFA4F:  {false, "\u7950"},
+	0xFA50:  {false, "\u7956"},
+	0xFA51:  {false, "\u795D"},
+	0xFA52:  {false, "\u798D"},
+	0xFA53:  {false, "\u798E"},
+	0xFA54:  {false, "\u7A40"},
+	0xFA55:  {false, "\u7A81"},
+	0xFA56:  {false, "\u7BC0"},
+	0xFA57:  {false, "\u7DF4"},
+	0xFA58:  {false, "\u7E09"},
+	0xFA59:  {false, "\u7E41"},
+	0xFA5A:  {false, "\u7F72"},
+	0xFA5B:  {false, "\u8005"},
+	0xFA5C:  {false, "\u81ED"},
+	0xFA5D:  {false, "\u8279"},
+	0xFA5E:  {false, "\u8279"},
+	0xFA5F:  {false, "\u8457"},
+	0xFA60:  {false, "\u8910"},
+	0xFA61:  {false, "\u8996"},
+	0xFA62:  {false, "\u8B01"},
+	0xFA63:  {false, "\u8B39"},
+	0xFA64:  {false, "\u8CD3"},
+	0xFA65:  {false, "\u8D08"},
+	0xFA66:  {false, "\u8FB6"},
+	0xFA67:  {false, "\u9038"},
+	0xFA68:  {false, "\u96E3"},
+	0xFA69:  {false, "\u97FF"},
+	0xFA6A:  {false, "\u983B"},
+	0xFA6B:  {false, "\u6075"},
+	0xFA6C:  {false, "\U000242EE"},
+	0xFA6D:  {false, "\u8218"},
+	0xFA70:  {false, "\u4E26"},
+	0xFA71:  {false, "\u51B5"},
+	0xFA72:  {false, "\u5168"},
+	0xFA73:  {false, "\u4F80"},
+	0xFA74:  {false, "\u5145"},
+	0xFA75:  {false, "\u5180"},
+	0xFA76:  {false, "\u52C7"},
+	0xFA77:  {false, "\u52FA"},
+	0xFA78:  {false, "\u559D"},
+	0xFA79:  {false, "\u5555"},
+	0xFA7A:  {false, "\u5599"},
+	0xFA7B:  {false, "\u55E2"},
+	0xFA7C:  {false, "\u585A"},
+	0xFA7D:  {false, "\u58B3"},
+	0xFA7E:  {false, "\u5944"},
+	0xFA7F:  {false, "\u5954"},
+	0xFA80:  {false, "\u5A62"},
+	0xFA81:  {false, "\u5B28"},
+	0xFA82:  {false, "\u5ED2"},
+	0xFA83:  {false, "\u5ED9"},
+	0xFA84:  {false, "\u5F69"},
+	0xFA85:  {false, "\u5FAD"},
+	0xFA86:  {false, "\u60D8"},
+	0xFA87:  {false, "\u614E"},
+	0xFA88:  {false, "\u6108"},
+	0xFA89:  {false, "\u618E"},
+	0xFA8A:  {false, "\u6160"},
+	0xFA8B:  {false, "\u61F2"},
+	0xFA8C:  {false, "\u6234"},
+	0xFA8D:  {false, "\u63C4"},
+	0xFA8E:  {false, "\u641C"},
+	0xFA8F:  {false, "\u6452"},
+	0xFA90:  {false, "\u6556"},
+	0xFA91:  {false, "\u6674"},
+	0xFA92:  {false, "\u6717"},
+	0xFA93:  {false, "\u671B"},
+	0xFA94:  {false, "\u6756"},
+	0xFA95:  {false, "\u6B79"},
+	0xFA96:  {false, "\u6BBA"},
+	0xFA97:  {false, "\u6D41"},
+	0xFA98:  {false, "\u6EDB"},
+	0xFA99:  {false, "\u6ECB"},
+	0xFA9A:  {false, "\u6F22"},
+	0xFA9B:  {false, "\u701E"},
+	0xFA9C:  {false, "\u716E"},
+	0xFA9D:  {false, "\u77A7"},
+	0xFA9E:  {false, "\u7235"},
+	0xFA9F:  {false, "\u72AF"},
+	0xFAA0:  {false, "\u732A"},
+	0xFAA1:  {false, "\u7471"},
+	0xFAA2:  {false, "\u7506"},
+	0xFAA3:  {false, "\u753B"},
+	0xFAA4:  {false, "\u761D"},
+	0xFAA5:  {false, "\u761F"},
+	0xFAA6:  {false, "\u76CA"},
+	0xFAA7:  {false, "\u76DB"},
+	0xFAA8:  {false, "\u76F4"},
+	0xFAA9:  {false, "\u774A"},
+	0xFAAA:  {false, "\u7740"},
+	0xFAAB:  {false, "\u78CC"},
+	0xFAAC:  {false, "\u7AB1"},
+	0xFAAD:  {false, "\u7BC0"},
+	0xFAAE:  {false, "\u7C7B"},
+	0xFAAF:  {false, "\u7D5B"},
+	0xFAB0:  {false, "\u7DF4"},
+	0xFAB1:  {false, "\u7F3E"},
+	0xFAB2:  {false, "\u8005"},
+	0xFAB3:  {false, "\u8352"},
+	0xFAB4:  {false, "\u83EF"},
+	0xFAB5:  {false, "\u8779"},
+	0xFAB6:  {false, "\u8941"},
+	0xFAB7:  {false, "\u8986"},
+	0xFAB8:  {false, "\u8996"},
+	0xFAB9:  {false, "\u8ABF"},
+	0xFABA:  {false, "\u8AF8"},
+	0xFABB:  {false, "\u8ACB"},
+	0xFABC:  {false, "\u8B01"},
+	0xFABD:  {false, "\u8AFE"},
+	0xFABE:  {false, "\u8AED"},
+	0xFABF:  {false, "\u8B39"},
+	0xFAC0:  {false, "\u8B8A"},
+	0xFAC1:  {false, "\u8D08"},
+	0xFAC2:  {false, "\u8F38"},
+	0xFAC3:  {false, "\u9072"},
+	0xFAC4:  {false, "\u9199"},
+	0xFAC5:  {false, "\u9276"},
+	0xFAC6:  {false, "\u967C"},
+	0xFAC7:  {false, "\u96E3"},
+	0xFAC8:  {false, "\u9756"},
+	0xFAC9:  {false, "\u97DB"},
+	0xFACA:  {false, "\u97FF"},
+	0xFACB:  {false, "\u980B"},
+	0xFACC:  {false, "\u983B"},
+	0xFACD:  {false, "\u9B12"},
+	0xFACE:  {false, "\u9F9C"},
+	0xFACF:  {false, "\U0002284A"},
+	0xFAD0:  {false, "\U00022844"},
+	0xFAD1:  {false, "\U000233D5"},
+	0xFAD2:  {false, "\u3B9D"},
+	0xFAD3:  {false, "\u4018"},
+	0xFAD4:  {false, "\u4039"},
+	0xFAD5:  {false, "\U00025249"},
+	0xFAD6:  {false, "\U00025CD0"},
+	0xFAD7:  {false, "\U00027ED3"},
+	0xFAD8:  {false, "\u9F43"},
+	0xFAD9:  {false, "\u9F8E"},
+	0xFB00:  {true, "\u0066\u0066"},
+	0xFB01:  {true, "\u0066\u0069"},
+	0xFB02:  {true, "\u0066\u006C"},
+	0xFB03:  {true, "\u0066\u0066\u0069"},
+	0xFB04:  {true, "\u0066\u0066\u006C"},
+	0xFB05:  {true, "\u0073\u0074"},
+	0xFB06:  {true, "\u0073\u0074"},
+	0xFB13:  {true, "\u0574\u0576"},
+	0xFB14:  {true, "\u0574\u0565"},
+	0xFB15:  {true, "\u0574\u056B"},
+	0xFB16:  {true, "\u057E\u0576"},
+	0xFB17:  {true, "\u0574\u056D"},
+	0xFB1D:  {false, "\u05D9\u05B4"},
+	0xFB1F:  {false, "\u05F2\u05B7"},
+	0xFB20:  {true, "\u05E2"},
+	0xFB21:  {true, "\u05D0"},
+	0xFB22:  {true, "\u05D3"},
+	0xFB23:  {true, "\u05D4"},
+	0xFB24:  {true, "\u05DB"},
+	0xFB25:  {true, "\u05DC"},
+	0xFB26:  {true, "\u05DD"},
+	0xFB27:  {true, "\u05E8"},
+	0xFB28:  {true, "\u05EA"},
+	0xFB29:  {true, "\u002B"},
+	0xFB2A:  {false, "\u05E9\u05C1"},
+	0xFB2B:  {false, "\u05E9\u05C2"},
+	0xFB2C:  {false, "\uFB49\u05C1"},
+	0xFB2D:  {false, "\uFB49\u05C2"},
+	0xFB2E:  {false, "\u05D0\u05B7"},
+	0xFB2F:  {false, "\u05D0\u05B8"},
+	0xFB30:  {false, "\u05D0\u05BC"},
+	0xFB31:  {false, "\u05D1\u05BC"},
+	0xFB32:  {false, "\u05D2\u05BC"},
+	0xFB33:  {false, "\u05D3\u05BC"},
+	0xFB34:  {false, "\u05D4\u05BC"},
+	0xFB35:  {false, "\u05D5\u05BC"},
+	0xFB36:  {false, "\u05D6\u05BC"},
+	0xFB38:  {false, "\u05D8\u05BC"},
+	0xFB39:  {false, "\u05D9\u05BC"},
+	0xFB3A:  {false, "\u05DA\u05BC"},
+	0xFB3B:  {false, "\u05DB\u05BC"},
+	0xFB3C:  {false, "\u05DC\u05BC"},
+	0xFB3E:  {false, "\u05DE\u05BC"},
+	0xFB40:  {false, "\u05E0\u05BC"},
+	0xFB41:  {false, "\u05E1\u05BC"},
+	0xFB43:  {false, "\u05E3\u05BC"},
+	0xFB44:  {false, "\u05E4\u05BC"},
+	0xFB46:  {false, "\u05E6\u05BC"},
+	0xFB47:  {false, "\u05E7\u05BC"},
+	0xFB48:  {false, "\u05E8\u05BC"},
+	0xFB49:  {false, "\u05E9\u05BC"},
+	0xFB4A:  {false, "\u05EA\u05BC"},
+	0xFB4B:  {false, "\u05D5\u05B9"},
+	0xFB4C:  {false, "\u05D1\u05BF"},
+	0xFB4D:  {false, "\u05DB\u05BF"},
+	0xFB4E:  {false, "\u05E4\u05BF"},
+	0xFB4F:  {true, "\u05D0\u05DC"},
+	0xFB50:  {true, "\u0671"},
+	0xFB51:  {true, "\u0671"},
+	0xFB52:  {true, "\u067B"},
+	0xFB53:  {true, "\u067B"},
+	0xFB54:  {true, "\u067B"},
+	0xFB55:  {true, "\u067B"},
+	0xFB56:  {true, "\u067E"},
+	0xFB57:  {true, "\u067E"},
+	0xFB58:  {true, "\u067E"},
+	0xFB59:  {true, "\u067E"},
+	0xFB5A:  {true, "\u0680"},
+	0xFB5B:  {true, "\u0680"},
+	0xFB5C:  {true, "\u0680"},
+	0xFB5D:  {true, "\u0680"},
+	0xFB5E:  {true, "\u067A"},
+	0xFB5F:  {true, "\u067A"},
+	0xFB60:  {true, "\u067A"},
+	0xFB61:  {true, "\u067A"},
+	0xFB62:  {true, "\u067F"},
+	0xFB63:  {true, "\u067F"},
+	0xFB64:  {true, "\u067F"},
+	0xFB65:  {true, "\u067F"},
+	0xFB66:  {true, "\u0679"},
+	0xFB67:  {true, "\u0679"},
+	0xFB68:  {true, "\u0679"},
+	0xFB69:  {true, "\u0679"},
+	0xFB6A:  {true, "\u06A4"},
+	0xFB6B:  {true, "\u06A4"},
+	0xFB6C:  {true, "\u06A4"},
+	0xFB6D:  {true, "\u06A4"},
+	0xFB6E:  {true, "\u06A6"},
+	0xFB6F:  {true, "\u06A6"},
+	0xFB70:  {true, "\u06A6"},
+	0xFB71:  {true, "\u06A6"},
+	0xFB72:  {true, "\u0684"},
+	0xFB73:  {true, "\u0684"},
+	0xFB74:  {true, "\u0684"},
+	0xFB75:  {true, "\u0684"},
+	0xFB76:  {true, "\u0683"},
+	0xFB77:  {true, "\u0683"},
+	0xFB78:  {true, "\u0683"},
+	0xFB79:  {true, "\u0683"},
+	0xFB7A:  {true, "\u0686"},
+	0xFB7B:  {true, "\u0686"},
+	0xFB7C:  {true, "\u0686"},
+	0xFB7D:  {true, "\u0686"},
+	0xFB7E:  {true, "\u0687"},
+	0xFB7F:  {true, "\u0687"},
+	0xFB80:  {true, "\u0687"},
+	0xFB81:  {true, "\u0687"},
+	0xFB82:  {true, "\u068D"},
+	0xFB83:  {true, "\u068D"},
+	0xFB84:  {true, "\u068C"},
+	0xFB85:  {true, "\u068C"},
+	0xFB86:  {true, "\u068E"},
+	0xFB87:  {true, "\u068E"},
+	0xFB88:  {true, "\u0688"},
+	0xFB89:  {true, "\u0688"},
+	0xFB8A:  {true, "\u0698"},
+	0xFB8B:  {true, "\u0698"},
+	0xFB8C:  {true, "\u0691"},
+	0xFB8D:  {true, "\u0691"},
+	0xFB8E:  {true, "\u06A9"},
+	0xFB8F:  {true, "\u06A9"},
+	0xFB90:  {true, "\u06A9"},
+	0xFB91:  {true, "\u06A9"},
+	0xFB92:  {true, "\u06AF"},
+	0xFB93:  {true, "\u06AF"},
+	0xFB94:  {true, "\u06AF"},
+	0xFB95:  {true, "\u06AF"},
+	0xFB96:  {true, "\u06B3"},
+	0xFB97:  {true, "\u06B3"},
+	0xFB98:  {true, "\u06B3"},
+	0xFB99:  {true, "\u06B3"},
+	0xFB9A:  {true, "\u06B1"},
+	0xFB9B:  {true, "\u06B1"},
+	0xFB9C:  {true, "\u06B1"},
+	0xFB9D:  {true, "\u06B1"},
+	0xFB9E:  {true, "\u06BA"},
+	0xFB9F:  {true, "\u06BA"},
+	0xFBA0:  {true, "\u06BB"},
+	0xFBA1:  {true, "\u06BB"},
+	0xFBA2:  {true, "\u06BB"},
+	0xFBA3:  {true, "\u06BB"},
+	0xFBA4:  {true, "\u06D5\u0654"},
+	0xFBA5:  {true, "\u06D5\u0654"},
+	0xFBA6:  {true, "\u06C1"},
+	0xFBA7:  {true, "\u06C1"},
+	0xFBA8:  {true, "\u06C1"},
+	0xFBA9:  {true, "\u06C1"},
+	0xFBAA:  {true, "\u06BE"},
+	0xFBAB:  {true, "\u06BE"},
+	0xFBAC:  {true, "\u06BE"},
+	0xFBAD:  {true, "\u06BE"},
+	0xFBAE:  {true, "\u06D2"},
+	0xFBAF:  {true, "\u06D2"},
+	0xFBB0:  {true, "\u06D2\u0654"},
+	0xFBB1:  {true, "\u06D2\u0654"},
+	0xFBD3:  {true, "\u06AD"},
+	0xFBD4:  {true, "\u06AD"},
+	0xFBD5:  {true, "\u06AD"},
+	0xFBD6:  {true, "\u06AD"},
+	0xFBD7:  {true, "\u06C7"},
+	0xFBD8:  {true, "\u06C7"},
+	0xFBD9:  {true, "\u06C6"},
+	0xFBDA:  {true, "\u06C6"},
+	0xFBDB:  {true, "\u06C8"},
+	0xFBDC:  {true, "\u06C8"},
+	0xFBDD:  {true, "\u06C7\u0674"},
+	0xFBDE:  {true, "\u06CB"},
+	0xFBDF:  {true, "\u06CB"},
+	0xFBE0:  {true, "\u06C5"},
+	0xFBE1:  {true, "\u06C5"},
+	0xFBE2:  {true, "\u06C9"},
+	0xFBE3:  {true, "\u06C9"},
+	0xFBE4:  {true, "\u06D0"},
+	0xFBE5:  {true, "\u06D0"},
+	0xFBE6:  {true, "\u06D0"},
+	0xFBE7:  {true, "\u06D0"},
+	0xFBE8:  {true, "\u0649"},
+	0xFBE9:  {true, "\u0649"},
+	0xFBEA:  {true, "\u064A\u0654\u0627"},
+	0xFBEB:  {true, "\u064A\u0654\u0627"},
+	0xFBEC:  {true, "\u064A\u0654\u06D5"},
+	0xFBED:  {true, "\u064A\u0654\u06D5"},
+	0xFBEE:  {true, "\u064A\u0654\u0648"},
+	0xFBEF:  {true, "\u064A\u0654\u0648"},
+	0xFBF0:  {true, "\u064A\u0654\u06C7"},
+	0xFBF1:  {true, "\u064A\u0654\u06C7"},
+	0xFBF2:  {true, "\u064A\u0654\u06C6"},
+	0xFBF3:  {true, "\u064A\u0654\u06C6"},
+	0xFBF4:  {true, "\u064A\u0654\u06C8"},
+	0xFBF5:  {true, "\u064A\u0654\u06C8"},
+	0xFBF6:  {true, "\u064A\u0654\u06D0"},
+	0xFBF7:  {true, "\u064A\u0654\u06D0"},
+	0xFBF8:  {true, "\u064A\u0654\u06D0"},
+	0xFBF9:  {true, "\u064A\u0654\u0649"},
+	0xFBFA:  {true, "\u064A\u0654\u0649"},
+	0xFBFB:  {true, "\u064A\u0654\u0649"},
+	0xFBFC:  {true, "\u06CC"},
+	0xFBFD:  {true, "\u06CC"},
+	0xFBFE:  {true, "\u06CC"},
+	0xFBFF:  {true, "\u06CC"},
+	0xFC00:  {true, "\u064A\u0654\u062C"},
+	0xFC01:  {true, "\u064A\u0654\u062D"},
+	0xFC02:  {true, "\u064A\u0654\u0645"},
+	0xFC03:  {true, "\u064A\u0654\u0649"},
+	0xFC04:  {true, "\u064A\u0654\u064A"},
+	0xFC05:  {true, "\u0628\u062C"},
+	0xFC06:  {true, "\u0628\u062D"},
+	0xFC07:  {true, "\u0628\u062E"},
+	0xFC08:  {true, "\u0628\u0645"},
+	0xFC09:  {true, "\u0628\u0649"},
+	0xFC0A:  {true, "\u0628\u064A"},
+	0xFC0B:  {true, "\u062A\u062C"},
+	0xFC0C:  {true, "\u062A\u062D"},
+	0xFC0D:  {true, "\u062A\u062E"},
+	0xFC0E:  {true, "\u062A\u0645"},
+	0xFC0F:  {true, "\u062A\u0649"},
+	0xFC10:  {true, "\u062A\u064A"},
+	0xFC11:  {true, "\u062B\u062C"},
+	0xFC12:  {true, "\u062B\u0645"},
+	0xFC13:  {true, "\u062B\u0649"},
+	0xFC14:  {true, "\u062B\u064A"},
+	0xFC15:  {true, "\u062C\u062D"},
+	0xFC16:  {true, "\u062C\u0645"},
+	0xFC17:  {true, "\u062D\u062C"},
+	0xFC18:  {true, "\u062D\u0645"},
+	0xFC19:  {true, "\u062E\u062C"},
+	0xFC1A:  {true, "\u062E\u062D"},
+	0xFC1B:  {true, "\u062E\u0645"},
+	0xFC1C:  {true, "\u0633\u062C"},
+	0xFC1D:  {true, "\u0633\u062D"},
+	0xFC1E:  {true, "\u0633\u062E"},
+	0xFC1F:  {true, "\u0633\u0645"},
+	0xFC20:  {true, "\u0635\u062D"},
+	0xFC21:  {true, "\u0635\u0645"},
+	0xFC22:  {true, "\u0636\u062C"},
+	0xFC23:  {true, "\u0636\u062D"},
+	0xFC24:  {true, "\u0636\u062E"},
+	0xFC25:  {true, "\u0636\u0645"},
+	0xFC26:  {true, "\u0637\u062D"},
+	0xFC27:  {true, "\u0637\u0645"},
+	0xFC28:  {true, "\u0638\u0645"},
+	0xFC29:  {true, "\u0639\u062C"},
+	0xFC2A:  {true, "\u0639\u0645"},
+	0xFC2B:  {true, "\u063A\u062C"},
+	0xFC2C:  {true, "\u063A\u0645"},
+	0xFC2D:  {true, "\u0641\u062C"},
+	0xFC2E:  {true, "\u0641\u062D"},
+	0xFC2F:  {true, "\u0641\u062E"},
+	0xFC30:  {true, "\u0641\u0645"},
+	0xFC31:  {true, "\u0641\u0649"},
+	0xFC32:  {true, "\u0641\u064A"},
+	0xFC33:  {true, "\u0642\u062D"},
+	0xFC34:  {true, "\u0642\u0645"},
+	0xFC35:  {true, "\u0642\u0649"},
+	0xFC36:  {true, "\u0642\u064A"},
+	0xFC37:  {true, "\u0643\u0627"},
+	0xFC38:  {true, "\u0643\u062C"},
+	0xFC39:  {true, "\u0643\u062D"},
+	0xFC3A:  {true, "\u0643\u062E"},
+	0xFC3B:  {true, "\u0643\u0644"},
+	0xFC3C:  {true, "\u0643\u0645"},
+	0xFC3D:  {true, "\u0643\u0649"},
+	0xFC3E:  {true, "\u0643\u064A"},
+	0xFC3F:  {true, "\u0644\u062C"},
+	0xFC40:  {true, "\u0644\u062D"},
+	0xFC41:  {true, "\u0644\u062E"},
+	0xFC42:  {true, "\u0644\u0645"},
+	0xFC43:  {true, "\u0644\u0649"},
+	0xFC44:  {true, "\u0644\u064A"},
+	0xFC45:  {true, "\u0645\u062C"},
+	0xFC46:  {true, "\u0645\u062D"},
+	0xFC47:  {true, "\u0645\u062E"},
+	0xFC48:  {true, "\u0645\u0645"},
+	0xFC49:  {true, "\u0645\u0649"},
+	0xFC4A:  {true, "\u0645\u064A"},
+	0xFC4B:  {true, "\u0646\u062C"},
+	0xFC4C:  {true, "\u0646\u062D"},
+	0xFC4D:  {true, "\u0646\u062E"},
+	0xFC4E:  {true, "\u0646\u0645"},
+	0xFC4F:  {true, "\u0646\u0649"},
+	0xFC50:  {true, "\u0646\u064A"},
+	0xFC51:  {true, "\u0647\u062C"},
+	0xFC52:  {true, "\u0647\u0645"},
+	0xFC53:  {true, "\u0647\u0649"},
+	0xFC54:  {true, "\u0647\u064A"},
+	0xFC55:  {true, "\u064A\u062C"},
+	0xFC56:  {true, "\u064A\u062D"},
+	0xFC57:  {true, "\u064A\u062E"},
+	0xFC58:  {true, "\u064A\u0645"},
+	0xFC59:  {true, "\u064A\u0649"},
+	0xFC5A:  {true, "\u064A\u064A"},
+	0xFC5B:  {true, "\u0630\u0670"},
+	0xFC5C:  {true, "\u0631\u0670"},
+	0xFC5D:  {true, "\u0649\u0670"},
+	0xFC5E:  {true, "\u0020\u064C\u0651"},
+	0xFC5F:  {true, "\u0020\u064D\u0651"},
+	0xFC60:  {true, "\u0020\u064E\u0651"},
+	0xFC61:  {true, "\u0020\u064F\u0651"},
+	0xFC62:  {true, "\u0020\u0650\u0651"},
+	0xFC63:  {true, "\u0020\u0651\u0670"},
+	0xFC64:  {true, "\u064A\u0654\u0631"},
+	0xFC65:  {true, "\u064A\u0654\u0632"},
+	0xFC66:  {true, "\u064A\u0654\u0645"},
+	0xFC67:  {true, "\u064A\u0654\u0646"},
+	0xFC68:  {true, "\u064A\u0654\u0649"},
+	0xFC69:  {true, "\u064A\u0654\u064A"},
+	0xFC6A:  {true, "\u0628\u0631"},
+	0xFC6B:  {true, "\u0628\u0632"},
+	0xFC6C:  {true, "\u0628\u0645"},
+	0xFC6D:  {true, "\u0628\u0646"},
+	0xFC6E:  {true, "\u0628\u0649"},
+	0xFC6F:  {true, "\u0628\u064A"},
+	0xFC70:  {true, "\u062A\u0631"},
+	0xFC71:  {true, "\u062A\u0632"},
+	0xFC72:  {true, "\u062A\u0645"},
+	0xFC73:  {true, "\u062A\u0646"},
+	0xFC74:  {true, "\u062A\u0649"},
+	0xFC75:  {true, "\u062A\u064A"},
+	0xFC76:  {true, "\u062B\u0631"},
+	0xFC77:  {true, "\u062B\u0632"},
+	0xFC78:  {true, "\u062B\u0645"},
+	0xFC79:  {true, "\u062B\u0646"},
+	0xFC7A:  {true, "\u062B\u0649"},
+	0xFC7B:  {true, "\u062B\u064A"},
+	0xFC7C:  {true, "\u0641\u0649"},
+	0xFC7D:  {true, "\u0641\u064A"},
+	0xFC7E:  {true, "\u0642\u0649"},
+	0xFC7F:  {true, "\u0642\u064A"},
+	0xFC80:  {true, "\u0643\u0627"},
+	0xFC81:  {true, "\u0643\u0644"},
+	0xFC82:  {true, "\u0643\u0645"},
+	0xFC83:  {true, "\u0643\u0649"},
+	0xFC84:  {true, "\u0643\u064A"},
+	0xFC85:  {true, "\u0644\u0645"},
+	0xFC86:  {true, "\u0644\u0649"},
+	0xFC87:  {true, "\u0644\u064A"},
+	0xFC88:  {true, "\u0645\u0627"},
+	0xFC89:  {true, "\u0645\u0645"},
+	0xFC8A:  {true, "\u0646\u0631"},
+	0xFC8B:  {true, "\u0646\u0632"},
+	0xFC8C:  {true, "\u0646\u0645"},
+	0xFC8D:  {true, "\u0646\u0646"},
+	0xFC8E:  {true, "\u0646\u0649"},
+	0xFC8F:  {true, "\u0646\u064A"},
+	0xFC90:  {true, "\u0649\u0670"},
+	0xFC91:  {true, "\u064A\u0631"},
+	0xFC92:  {true, "\u064A\u0632"},
+	0xFC93:  {true, "\u064A\u0645"},
+	0xFC94:  {true, "\u064A\u0646"},
+	0xFC95:  {true, "\u064A\u0649"},
+	0xFC96:  {true, "\u064A\u064A"},
+	0xFC97:  {true, "\u064A\u0654\u062C"},
+	0xFC98:  {true, "\u064A\u0654\u062D"},
+	0xFC99:  {true, "\u064A\u0654\u062E"},
+	0xFC9A:  {true, "\u064A\u0654\u0645"},
+	0xFC9B:  {true, "\u064A\u0654\u0647"},
+	0xFC9C:  {true, "\u0628\u062C"},
+	0xFC9D:  {true, "\u0628\u062D"},
+	0xFC9E:  {true, "\u0628\u062E"},
+	0xFC9F:  {true, "\u0628\u0645"},
+	0xFCA0:  {true, "\u0628\u0647"},
+	0xFCA1:  {true, "\u062A\u062C"},
+	0xFCA2:  {true, "\u062A\u062D"},
+	0xFCA3:  {true, "\u062A\u062E"},
+	0xFCA4:  {true, "\u062A\u0645"},
+	0xFCA5:  {true, "\u062A\u0647"},
+	0xFCA6:  {true, "\u062B\u0645"},
+	0xFCA7:  {true, "\u062C\u062D"},
+	0xFCA8:  {true, "\u062C\u0645"},
+	0xFCA9:  {true, "\u062D\u062C"},
+	0xFCAA:  {true, "\u062D\u0645"},
+	0xFCAB:  {true, "\u062E\u062C"},
+	0xFCAC:  {true, "\u062E\u0645"},
+	0xFCAD:  {true, "\u0633\u062C"},
+	0xFCAE:  {true, "\u0633\u062D"},
+	0xFCAF:  {true, "\u0633\u062E"},
+	0xFCB0:  {true, "\u0633\u0645"},
+	0xFCB1:  {true, "\u0635\u062D"},
+	0xFCB2:  {true, "\u0635\u062E"},
+	0xFCB3:  {true, "\u0635\u0645"},
+	0xFCB4:  {true, "\u0636\u062C"},
+	0xFCB5:  {true, "\u0636\u062D"},
+	0xFCB6:  {true, "\u0636\u062E"},
+	0xFCB7:  {true, "\u0636\u0645"},
+	0xFCB8:  {true, "\u0637\u062D"},
+	0xFCB9:  {true, "\u0638\u0645"},
+	0xFCBA:  {true, "\u0639\u062C"},
+	0xFCBB:  {true, "\u0639\u0645"},
+	0xFCBC:  {true, "\u063A\u062C"},
+	0xFCBD:  {true, "\u063A\u0645"},
+	0xFCBE:  {true, "\u0641\u062C"},
+	0xFCBF:  {true, "\u0641\u062D"},
+	0xFCC0:  {true, "\u0641\u062E"},
+	0xFCC1:  {true, "\u0641\u0645"},
+	0xFCC2:  {true, "\u0642\u062D"},
+	0xFCC3:  {true, "\u0642\u0645"},
+	0xFCC4:  {true, "\u0643\u062C"},
+	0xFCC5:  {true, "\u0643\u062D"},
+	0xFCC6:  {true, "\u0643\u062E"},
+	0xFCC7:  {true, "\u0643\u0644"},
+	0xFCC8:  {true, "\u0643\u0645"},
+	0xFCC9:  {true, "\u0644\u062C"},
+	0xFCCA:  {true, "\u0644\u062D"},
+	0xFCCB:  {true, "\u0644\u062E"},
+	0xFCCC:  {true, "\u0644\u0645"},
+	0xFCCD:  {true, "\u0644\u0647"},
+	0xFCCE:  {true, "\u0645\u062C"},
+	0xFCCF:  {true, "\u0645\u062D"},
+	0xFCD0:  {true, "\u0645\u062E"},
+	0xFCD1:  {true, "\u0645\u0645"},
+	0xFCD2:  {true, "\u0646\u062C"},
+	0xFCD3:  {true, "\u0646\u062D"},
+	0xFCD4:  {true, "\u0646\u062E"},
+	0xFCD5:  {true, "\u0646\u0645"},
+	0xFCD6:  {true, "\u0646\u0647"},
+	0xFCD7:  {true, "\u0647\u062C"},
+	0xFCD8:  {true, "\u0647\u0645"},
+	0xFCD9:  {true, "\u0647\u0670"},
+	0xFCDA:  {true, "\u064A\u062C"},
+	0xFCDB:  {true, "\u064A\u062D"},
+	0xFCDC:  {true, "\u064A\u062E"},
+	0xFCDD:  {true, "\u064A\u0645"},
+	0xFCDE:  {true, "\u064A\u0647"},
+	0xFCDF:  {true, "\u064A\u0654\u0645"},
+	0xFCE0:  {true, "\u064A\u0654\u0647"},
+	0xFCE1:  {true, "\u0628\u0645"},
+	0xFCE2:  {true, "\u0628\u0647"},
+	0xFCE3:  {true, "\u062A\u0645"},
+	0xFCE4:  {true, "\u062A\u0647"},
+	0xFCE5:  {true, "\u062B\u0645"},
+	0xFCE6:  {true, "\u062B\u0647"},
+	0xFCE7:  {true, "\u0633\u0645"},
+	0xFCE8:  {true, "\u0633\u0647"},
+	0xFCE9:  {true, "\u0634\u0645"},
+	0xFCEA:  {true, "\u0634\u0647"},
+	0xFCEB:  {true, "\u0643\u0644"},
+	0xFCEC:  {true, "\u0643\u0645"},
+	0xFCED:  {true, "\u0644\u0645"},
+	0xFCEE:  {true, "\u0646\u0645"},
+	0xFCEF:  {true, "\u0646\u0647"},
+	0xFCF0:  {true, "\u064A\u0645"},
+	0xFCF1:  {true, "\u064A\u0647"},
+	0xFCF2:  {true, "\u0640\u064E\u0651"},
+	0xFCF3:  {true, "\u0640\u064F\u0651"},
+	0xFCF4:  {true, "\u0640\u0650\u0651"},
+	0xFCF5:  {true, "\u0637\u0649"},
+	0xFCF6:  {true, "\u0637\u064A"},
+	0xFCF7:  {true, "\u0639\u0649"},
+	0xFCF8:  {true, "\u0639\u064A"},
+	0xFCF9:  {true, "\u063A\u0649"},
+	0xFCFA:  {true, "\u063A\u064A"},
+	0xFCFB:  {true, "\u0633\u0649"},
+	0xFCFC:  {true, "\u0633\u064A"},
+	0xFCFD:  {true, "\u0634\u0649"},
+	0xFCFE:  {true, "\u0634\u064A"},
+	0xFCFF:  {true, "\u062D\u0649"},
+	0xFD00:  {true, "\u062D\u064A"},
+	0xFD01:  {true, "\u062C\u0649"},
+	0xFD02:  {true, "\u062C\u064A"},
+	0xFD03:  {true, "\u062E\u0649"},
+	0xFD04:  {true, "\u062E\u064A"},
+	0xFD05:  {true, "\u0635\u0649"},
+	0xFD06:  {true, "\u0635\u064A"},
+	0xFD07:  {true, "\u0636\u0649"},
+	0xFD08:  {true, "\u0636\u064A"},
+	0xFD09:  {true, "\u0634\u062C"},
+	0xFD0A:  {true, "\u0634\u062D"},
+	0xFD0B:  {true, "\u0634\u062E"},
+	0xFD0C:  {true, "\u0634\u0645"},
+	0xFD0D:  {true, "\u0634\u0631"},
+	0xFD0E:  {true, "\u0633\u0631"},
+	0xFD0F:  {true, "\u0635\u0631"},
+	0xFD10:  {true, "\u0636\u0631"},
+	0xFD11:  {true, "\u0637\u0649"},
+	0xFD12:  {true, "\u0637\u064A"},
+	0xFD13:  {true, "\u0639\u0649"},
+	0xFD14:  {true, "\u0639\u064A"},
+	0xFD15:  {true, "\u063A\u0649"},
+	0xFD16:  {true, "\u063A\u064A"},
+	0xFD17:  {true, "\u0633\u0649"},
+	0xFD18:  {true, "\u0633\u064A"},
+	0xFD19:  {true, "\u0634\u0649"},
+	0xFD1A:  {true, "\u0634\u064A"},
+	0xFD1B:  {true, "\u062D\u0649"},
+	0xFD1C:  {true, "\u062D\u064A"},
+	0xFD1D:  {true, "\u062C\u0649"},
+	0xFD1E:  {true, "\u062C\u064A"},
+	0xFD1F:  {true, "\u062E\u0649"},
+	0xFD20:  {true, "\u062E\u064A"},
+	0xFD21:  {true, "\u0635\u0649"},
+	0xFD22:  {true, "\u0635\u064A"},
+	0xFD23:  {true, "\u0636\u0649"},
+	0xFD24:  {true, "\u0636\u064A"},
+	0xFD25:  {true, "\u0634\u062C"},
+	0xFD26:  {true, "\u0634\u062D"},
+	0xFD27:  {true, "\u0634\u062E"},
+	0xFD28:  {true, "\u0634\u0645"},
+	0xFD29:  {true, "\u0634\u0631"},
+	0xFD2A:  {true, "\u0633\u0631"},
+	0xFD2B:  {true, "\u0635\u0631"},
+	0xFD2C:  {true, "\u0636\u0631"},
+	0xFD2D:  {true, "\u0634\u062C"},
+	0xFD2E:  {true, "\u0634\u062D"},
+	0xFD2F:  {true, "\u0634\u062E"},
+	0xFD30:  {true, "\u0634\u0645"},
+	0xFD31:  {true, "\u0633\u0647"},
+	0xFD32:  {true, "\u0634\u0647"},
+	0xFD33:  {true, "\u0637\u0645"},
+	0xFD34:  {true, "\u0633\u062C"},
+	0xFD35:  {true, "\u0633\u062D"},
+	0xFD36:  {true, "\u0633\u062E"},
+	0xFD37:  {true, "\u0634\u062C"},
+	0xFD38:  {true, "\u0634\u062D"},
+	0xFD39:  {true, "\u0634\u062E"},
+	0xFD3A:  {true, "\u0637\u0645"},
+	0xFD3B:  {true, "\u0638\u0645"},
+	0xFD3C:  {true, "\u0627\u064B"},
+	0xFD3D:  {true, "\u0627\u064B"},
+	0xFD50:  {true, "\u062A\u062C\u0645"},
+	0xFD51:  {true, "\u062A\u062D\u062C"},
+	0xFD52:  {true, "\u062A\u062D\u062C"},
+	0xFD53:  {true, "\u062A\u062D\u0645"},
+	0xFD54:  {true, "\u062A\u062E\u0645"},
+	0xFD55:  {true, "\u062A\u0645\u062C"},
+	0xFD56:  {true, "\u062A\u0645\u062D"},
+	0xFD57:  {true, "\u062A\u0645\u062E"},
+	0xFD58:  {true, "\u062C\u0645\u062D"},
+	0xFD59:  {true, "\u062C\u0645\u062D"},
+	0xFD5A:  {true, "\u062D\u0645\u064A"},
+	0xFD5B:  {true, "\u062D\u0645\u0649"},
+	0xFD5C:  {true, "\u0633\u062D\u062C"},
+	0xFD5D:  {true, "\u0633\u062C\u062D"},
+	0xFD5E:  {true, "\u0633\u062C\u0649"},
+	0xFD5F:  {true, "\u0633\u0645\u062D"},
+	0xFD60:  {true, "\u0633\u0645\u062D"},
+	0xFD61:  {true, "\u0633\u0645\u062C"},
+	0xFD62:  {true, "\u0633\u0645\u0645"},
+	0xFD63:  {true, "\u0633\u0645\u0645"},
+	0xFD64:  {true, "\u0635\u062D\u062D"},
+	0xFD65:  {true, "\u0635\u062D\u062D"},
+	0xFD66:  {true, "\u0635\u0645\u0645"},
+	0xFD67:  {true, "\u0634\u062D\u0645"},
+	0xFD68:  {true, "\u0634\u062D\u0645"},
+	0xFD69:  {true, "\u0634\u062C\u064A"},
+	0xFD6A:  {true, "\u0634\u0645\u062E"},
+	0xFD6B:  {true, "\u0634\u0645\u062E"},
+	0xFD6C:  {true, "\u0634\u0645\u0645"},
+	0xFD6D:  {true, "\u0634\u0645\u0645"},
+	0xFD6E:  {true, "\u0636\u062D\u0649"},
+	0xFD6F:  {true, "\u0636\u062E\u0645"},
+	0xFD70:  {true, "\u0636\u062E\u0645"},
+	0xFD71:  {true, "\u0637\u0645\u062D"},
+	0xFD72:  {true, "\u0637\u0645\u062D"},
+	0xFD73:  {true, "\u0637\u0645\u0645"},
+	0xFD74:  {true, "\u0637\u0645\u064A"},
+	0xFD75:  {true, "\u0639\u062C\u0645"},
+	0xFD76:  {true, "\u0639\u0645\u0645"},
+	0xFD77:  {true, "\u0639\u0645\u0645"},
+	0xFD78:  {true, "\u0639\u0645\u0649"},
+	0xFD79:  {true, "\u063A\u0645\u0645"},
+	0xFD7A:  {true, "\u063A\u0645\u064A"},
+	0xFD7B:  {true, "\u063A\u0645\u0649"},
+	0xFD7C:  {true, "\u0641\u062E\u0645"},
+	0xFD7D:  {true, "\u0641\u062E\u0645"},
+	0xFD7E:  {true, "\u0642\u0645\u062D"},
+	0xFD7F:  {true, "\u0642\u0645\u0645"},
+	0xFD80:  {true, "\u0644\u062D\u0645"},
+	0xFD81:  {true, "\u0644\u062D\u064A"},
+	0xFD82:  {true, "\u0644\u062D\u0649"},
+	0xFD83:  {true, "\u0644\u062C\u062C"},
+	0xFD84:  {true, "\u0644\u062C\u062C"},
+	0xFD85:  {true, "\u0644\u062E\u0645"},
+	0xFD86:  {true, "\u0644\u062E\u0645"},
+	0xFD87:  {true, "\u0644\u0645\u062D"},
+	0xFD88:  {true, "\u0644\u0645\u062D"},
+	0xFD89:  {true, "\u0645\u062D\u062C"},
+	0xFD8A:  {true, "\u0645\u062D\u0645"},
+	0xFD8B:  {true, "\u0645\u062D\u064A"},
+	0xFD8C:  {true, "\u0645\u062C\u062D"},
+	0xFD8D:  {true, "\u0645\u062C\u0645"},
+	0xFD8E:  {true, "\u0645\u062E\u062C"},
+	0xFD8F:  {true, "\u0645\u062E\u0645"},
+	0xFD92:  {true, "\u0645\u062C\u062E"},
+	0xFD93:  {true, "\u0647\u0645\u062C"},
+	0xFD94:  {true, "\u0647\u0645\u0645"},
+	0xFD95:  {true, "\u0646\u062D\u0645"},
+	0xFD96:  {true, "\u0646\u062D\u0649"},
+	0xFD97:  {true, "\u0646\u062C\u0645"},
+	0xFD98:  {true, "\u0646\u062C\u0645"},
+	0xFD99:  {true, "\u0646\u062C\u0649"},
+	0xFD9A:  {true, "\u0646\u0645\u064A"},
+	0xFD9B:  {true, "\u0646\u0645\u0649"},
+	0xFD9C:  {true, "\u064A\u0645\u0645"},
+	0xFD9D:  {true, "\u064A\u0645\u0645"},
+	0xFD9E:  {true, "\u0628\u062E\u064A"},
+	0xFD9F:  {true, "\u062A\u062C\u064A"},
+	0xFDA0:  {true, "\u062A\u062C\u0649"},
+	0xFDA1:  {true, "\u062A\u062E\u064A"},
+	0xFDA2:  {true, "\u062A\u062E\u0649"},
+	0xFDA3:  {true, "\u062A\u0645\u064A"},
+	0xFDA4:  {true, "\u062A\u0645\u0649"},
+	0xFDA5:  {true, "\u062C\u0645\u064A"},
+	0xFDA6:  {true, "\u062C\u062D\u0649"},
+	0xFDA7:  {true, "\u062C\u0645\u0649"},
+	0xFDA8:  {true, "\u0633\u062E\u0649"},
+	0xFDA9:  {true, "\u0635\u062D\u064A"},
+	0xFDAA:  {true, "\u0634\u062D\u064A"},
+	0xFDAB:  {true, "\u0636\u062D\u064A"},
+	0xFDAC:  {true, "\u0644\u062C\u064A"},
+	0xFDAD:  {true, "\u0644\u0645\u064A"},
+	0xFDAE:  {true, "\u064A\u062D\u064A"},
+	0xFDAF:  {true, "\u064A\u062C\u064A"},
+	0xFDB0:  {true, "\u064A\u0645\u064A"},
+	0xFDB1:  {true, "\u0645\u0645\u064A"},
+	0xFDB2:  {true, "\u0642\u0645\u064A"},
+	0xFDB3:  {true, "\u0646\u062D\u064A"},
+	0xFDB4:  {true, "\u0642\u0645\u062D"},
+	0xFDB5:  {true, "\u0644\u062D\u0645"},
+	0xFDB6:  {true, "\u0639\u0645\u064A"},
+	0xFDB7:  {true, "\u0643\u0645\u064A"},
+	0xFDB8:  {true, "\u0646\u062C\u062D"},
+	0xFDB9:  {true, "\u0645\u062E\u064A"},
+	0xFDBA:  {true, "\u0644\u062C\u0645"},
+	0xFDBB:  {true, "\u0643\u0645\u0645"},
+	0xFDBC:  {true, "\u0644\u062C\u0645"},
+	0xFDBD:  {true, "\u0646\u062C\u062D"},
+	0xFDBE:  {true, "\u062C\u062D\u064A"},
+	0xFDBF:  {true, "\u062D\u062C\u064A"},
+	0xFDC0:  {true, "\u0645\u062C\u064A"},
+	0xFDC1:  {true, "\u0641\u0645\u064A"},
+	0xFDC2:  {true, "\u0628\u062D\u064A"},
+	0xFDC3:  {true, "\u0643\u0645\u0645"},
+	0xFDC4:  {true, "\u0639\u062C\u0645"},
+	0xFDC5:  {true, "\u0635\u0645\u0645"},
+	0xFDC6:  {true, "\u0633\u062E\u064A"},
+	0xFDC7:  {true, "\u0646\u062C\u064A"},
+	0xFDF0:  {true, "\u0635\u0644\u06D2"},
+	0xFDF1:  {true, "\u0642\u0644\u06D2"},
+	0xFDF2:  {true, "\u0627\u0644\u0644\u0647"},
+	0xFDF3:  {true, "\u0627\u0643\u0628\u0631"},
+	0xFDF4:  {true, "\u0645\u062D\u0645\u062F"},
+	0xFDF5:  {true, "\u0635\u0644\u0639\u0645"},
+	0xFDF6:  {true, "\u0631\u0633\u0648\u0644"},
+	0xFDF7:  {true, "\u0639\u0644\u064A\u0647"},
+	0xFDF8:  {true, "\u0648\u0633\u0644\u0645"},
+	0xFDF9:  {true, "\u0635\u0644\u0649"},
+	0xFDFA:  {true, "\u0635\u0644\u0649\u0020\u0627\u0644\u0644\u0647\u0020\u0639\u0644\u064A\u0647\u0020\u0648\u0633\u0644\u0645"},
+	0xFDFB:  {true, "\u062C\u0644\u0020\u062C\u0644\u0627\u0644\u0647"},
+	0xFDFC:  {true, "\u0631\u06CC\u0627\u0644"},
+	0xFE10:  {true, "\u002C"},
+	0xFE11:  {true, "\u3001"},
+	0xFE12:  {true, "\u3002"},
+	0xFE13:  {true, "\u003A"},
+	0xFE14:  {true, "\u003B"},
+	0xFE15:  {true, "\u0021"},
+	0xFE16:  {true, "\u003F"},
+	0xFE17:  {true, "\u3016"},
+	0xFE18:  {true, "\u3017"},
+	0xFE19:  {true, "\u002E\u002E\u002E"},
+	0xFE30:  {true, "\u002E\u002E"},
+	0xFE31:  {true, "\u2014"},
+	0xFE32:  {true, "\u2013"},
+	0xFE33:  {true, "\u005F"},
+	0xFE34:  {true, "\u005F"},
+	0xFE35:  {true, "\u0028"},
+	0xFE36:  {true, "\u0029"},
+	0xFE37:  {true, "\u007B"},
+	0xFE38:  {true, "\u007D"},
+	0xFE39:  {true, "\u3014"},
+	0xFE3A:  {true, "\u3015"},
+	0xFE3B:  {true, "\u3010"},
+	0xFE3C:  {true, "\u3011"},
+	0xFE3D:  {true, "\u300A"},
+	0xFE3E:  {true, "\u300B"},
+	0xFE3F:  {true, "\u3008"},
+	0xFE40:  {true, "\u3009"},
+	0xFE41:  {true, "\u300C"},
+	0xFE42:  {true, "\u300D"},
+	0xFE43:  {true, "\u300E"},
+	0xFE44:  {true, "\u300F"},
+	0xFE47:  {true, "\u005B"},
+	0xFE48:  {true, "\u005D"},
+	0xFE49:  {true, "\u0020\u0305"},
+	0xFE4A:  {true, "\u0020\u0305"},
+	0xFE4B:  {true, "\u0020\u0305"},
+	0xFE4C:  {true, "\u0020\u0305"},
+	0xFE4D:  {true, "\u005F"},
+	0xFE4E:  {true, "\u005F"},
+	0xFE4F:  {true, "\u005F"},
+	0xFE50:  {true, "\u002C"},
+	0xFE51:  {true, "\u3001"},
+	0xFE52:  {true, "\u002E"},
+	0xFE54:  {true, "\u003B"},
+	0xFE55:  {true, "\u003A"},
+	0xFE56:  {true, "\u003F"},
+	0xFE57:  {true, "\u0021"},
+	0xFE58:  {true, "\u2014"},
+	0xFE59:  {true, "\u0028"},
+	0xFE5A:  {true, "\u0029"},
+	0xFE5B:  {true, "\u007B"},
+	0xFE5C:  {true, "\u007D"},
+	0xFE5D:  {true, "\u3014"},
+	0xFE5E:  {true, "\u3015"},
+	0xFE5F:  {true, "\u0023"},
+	0xFE60:  {true, "\u0026"},
+	0xFE61:  {true, "\u002A"},
+	0xFE62:  {true, "\u002B"},
+	0xFE63:  {true, "\u002D"},
+	0xFE64:  {true, "\u003C"},
+	0xFE65:  {true, "\u003E"},
+	0xFE66:  {true, "\u003D"},
+	0xFE68:  {true, "\u005C"},
+	0xFE69:  {true, "\u0024"},
+	0xFE6A:  {true, "\u0025"},
+	0xFE6B:  {true, "\u0040"},
+	0xFE70:  {true, "\u0020\u064B"},
+	0xFE71:  {true, "\u0640\u064B"},
+	0xFE72:  {true, "\u0020\u064C"},
+	0xFE74:  {true, "\u0020\u064D"},
+	0xFE76:  {true, "\u0020\u064E"},
+	0xFE77:  {true, "\u0640\u064E"},
+	0xFE78:  {true, "\u0020\u064F"},
+	0xFE79:  {true, "\u0640\u064F"},
+	0xFE7A:  {true, "\u0020\u0650"},
+	0xFE7B:  {true, "\u0640\u0650"},
+	0xFE7C:  {true, "\u0020\u0651"},
+	0xFE7D:  {true, "\u0640\u0651"},
+	0xFE7E:  {true, "\u0020\u0652"},
+	0xFE7F:  {true, "\u0640\u0652"},
+	0xFE80:  {true, "\u0621"},
+	0xFE81:  {true, "\u0627\u0653"},
+	0xFE82:  {true, "\u0627\u0653"},
+	0xFE83:  {true, "\u0627\u0654"},
+	0xFE84:  {true, "\u0627\u0654"},
+	0xFE85:  {true, "\u0648\u0654"},
+	0xFE86:  {true, "\u0648\u0654"},
+	0xFE87:  {true, "\u0627\u0655"},
+	0xFE88:  {true, "\u0627\u0655"},
+	0xFE89:  {true, "\u064A\u0654"},
+	0xFE8A:  {true, "\u064A\u0654"},
+	0xFE8B:  {true, "\u064A\u0654"},
+	0xFE8C:  {true, "\u064A\u0654"},
+	0xFE8D:  {true, "\u0627"},
+	0xFE8E:  {true, "\u0627"},
+	0xFE8F:  {true, "\u0628"},
+	0xFE90:  {true, "\u0628"},
+	0xFE91:  {true, "\u0628"},
+	0xFE92:  {true, "\u0628"},
+	0xFE93:  {true, "\u0629"},
+	0xFE94:  {true, "\u0629"},
+	0xFE95:  {true, "\u062A"},
+	0xFE96:  {true, "\u062A"},
+	0xFE97:  {true, "\u062A"},
+	0xFE98:  {true, "\u062A"},
+	0xFE99:  {true, "\u062B"},
+	0xFE9A:  {true, "\u062B"},
+	0xFE9B:  {true, "\u062B"},
+	0xFE9C:  {true, "\u062B"},
+	0xFE9D:  {true, "\u062C"},
+	0xFE9E:  {true, "\u062C"},
+	0xFE9F:  {true, "\u062C"},
+	0xFEA0:  {true, "\u062C"},
+	0xFEA1:  {true, "\u062D"},
+	0xFEA2:  {true, "\u062D"},
+	0xFEA3:  {true, "\u062D"},
+	0xFEA4:  {true, "\u062D"},
+	0xFEA5:  {true, "\u062E"},
+	0xFEA6:  {true, "\u062E"},
+	0xFEA7:  {true, "\u062E"},
+	0xFEA8:  {true, "\u062E"},
+	0xFEA9:  {true, "\u062F"},
+	0xFEAA:  {true, "\u062F"},
+	0xFEAB:  {true, "\u0630"},
+	0xFEAC:  {true, "\u0630"},
+	0xFEAD:  {true, "\u0631"},
+	0xFEAE:  {true, "\u0631"},
+	0xFEAF:  {true, "\u0632"},
+	0xFEB0:  {true, "\u0632"},
+	0xFEB1:  {true, "\u0633"},
+	0xFEB2:  {true, "\u0633"},
+	0xFEB3:  {true, "\u0633"},
+	0xFEB4:  {true, "\u0633"},
+	0xFEB5:  {true, "\u0634"},
+	0xFEB6:  {true, "\u0634"},
+	0xFEB7:  {true, "\u0634"},
+	0xFEB8:  {true, "\u0634"},
+	0xFEB9:  {true, "\u0635"},
+	0xFEBA:  {true, "\u0635"},
+	0xFEBB:  {true, "\u0635"},
+	0xFEBC:  {true, "\u0635"},
+	0xFEBD:  {true, "\u0636"},
+	0xFEBE:  {true, "\u0636"},
+	0xFEBF:  {true, "\u0636"},
+	0xFEC0:  {true, "\u0636"},
+	0xFEC1:  {true, "\u0637"},
+	0xFEC2:  {true, "\u0637"},
+	0xFEC3:  {true, "\u0637"},
+	0xFEC4:  {true, "\u0637"},
+	0xFEC5:  {true, "\u0638"},
+	0xFEC6:  {true, "\u0638"},
+	0xFEC7:  {true, "\u0638"},
+	0xFEC8:  {true, "\u0638"},
+	0xFEC9:  {true, "\u0639"},
+	0xFECA:  {true, "\u0639"},
+	0xFECB:  {true, "\u0639"},
+	0xFECC:  {true, "\u0639"},
+	0xFECD:  {true, "\u063A"},
+	0xFECE:  {true, "\u063A"},
+	0xFECF:  {true, "\u063A"},
+	0xFED0:  {true, "\u063A"},
+	0xFED1:  {true, "\u0641"},
+	0xFED2:  {true, "\u0641"},
+	0xFED3:  {true, "\u0641"},
+	0xFED4:  {true, "\u0641"},
+	0xFED5:  {true, "\u0642"},
+	0xFED6:  {true, "\u0642"},
+	0xFED7:  {true, "\u0642"},
+	0xFED8:  {true, "\u0642"},
+	0xFED9:  {true, "\u0643"},
+	0xFEDA:  {true, "\u0643"},
+	0xFEDB:  {true, "\u0643"},
+	0xFEDC:  {true, "\u0643"},
+	0xFEDD:  {true, "\u0644"},
+	0xFEDE:  {true, "\u0644"},
+	0xFEDF:  {true, "\u0644"},
+	0xFEE0:  {true, "\u0644"},
+	0xFEE1:  {true, "\u0645"},
+	0xFEE2:  {true, "\u0645"},
+	0xFEE3:  {true, "\u0645"},
+	0xFEE4:  {true, "\u0645"},
+	0xFEE5:  {true, "\u0646"},
+	0xFEE6:  {true, "\u0646"},
+	0xFEE7:  {true, "\u0646"},
+	0xFEE8:  {true, "\u0646"},
+	0xFEE9:  {true, "\u0647"},
+	0xFEEA:  {true, "\u0647"},
+	0xFEEB:  {true, "\u0647"},
+	0xFEEC:  {true, "\u0647"},
+	0xFEED:  {true, "\u0648"},
+	0xFEEE:  {true, "\u0648"},
+	0xFEEF:  {true, "\u0649"},
+	0xFEF0:  {true, "\u0649"},
+	0xFEF1:  {true, "\u064A"},
+	0xFEF2:  {true, "\u064A"},
+	0xFEF3:  {true, "\u064A"},
+	0xFEF4:  {true, "\u064A"},
+	0xFEF5:  {true, "\u0644\u0627\u0653"},
+	0xFEF6:  {true, "\u0644\u0627\u0653"},
+	0xFEF7:  {true, "\u0644\u0627\u0654"},
+	0xFEF8:  {true, "\u0644\u0627\u0654"},
+	0xFEF9:  {true, "\u0644\u0627\u0655"},
+	0xFEFA:  {true, "\u0644\u0627\u0655"},
+	0xFEFB:  {true, "\u0644\u0627"},
+	0xFEFC:  {true, "\u0644\u0627"},
+	0xFF01:  {true, "\u0021"},
+	0xFF02:  {true, "\u0022"},
+	0xFF03:  {true, "\u0023"},
+	0xFF04:  {true, "\u0024"},
+	0xFF05:  {true, "\u0025"},
+	0xFF06:  {true, "\u0026"},
+	0xFF07:  {true, "\u0027"},
+	0xFF08:  {true, "\u0028"},
+	0xFF09:  {true, "\u0029"},
+	0xFF0A:  {true, "\u002A"},
+	0xFF0B:  {true, "\u002B"},
+	0xFF0C:  {true, "\u002C"},
+	0xFF0D:  {true, "\u002D"},
+	0xFF0E:  {true, "\u002E"},
+	0xFF0F:  {true, "\u002F"},
+	0xFF10:  {true, "\u0030"},
+	0xFF11:  {true, "\u0031"},
+	0xFF12:  {true, "\u0032"},
+	0xFF13:  {true, "\u0033"},
+	0xFF14:  {true, "\u0034"},
+	0xFF15:  {true, "\u0035"},
+	0xFF16:  {true, "\u0036"},
+	0xFF17:  {true, "\u0037"},
+	0xFF18:  {true, "\u0038"},
+	0xFF19:  {true, "\u0039"},
+	0xFF1A:  {true, "\u003A"},
+	0xFF1B:  {true, "\u003B"},
+	0xFF1C:  {true, "\u003C"},
+	0xFF1D:  {true, "\u003D"},
+	0xFF1E:  {true, "\u003E"},
+	0xFF1F:  {true, "\u003F"},
+	0xFF20:  {true, "\u0040"},
+	0xFF21:  {true, "\u0041"},
+	0xFF22:  {true, "\u0042"},
+	0xFF23:  {true, "\u0043"},
+	0xFF24:  {true, "\u0044"},
+	0xFF25:  {true, "\u0045"},
+	0xFF26:  {true, "\u0046"},
+	0xFF27:  {true, "\u0047"},
+	0xFF28:  {true, "\u0048"},
+	0xFF29:  {true, "\u0049"},
+	0xFF2A:  {true, "\u004A"},
+	0xFF2B:  {true, "\u004B"},
+	0xFF2C:  {true, "\u004C"},
+	0xFF2D:  {true, "\u004D"},
+	0xFF2E:  {true, "\u004E"},
+	0xFF2F:  {true, "\u004F"},
+	0xFF30:  {true, "\u0050"},
+	0xFF31:  {true, "\u0051"},
+	0xFF32:  {true, "\u0052"},
+	0xFF33:  {true, "\u0053"},
+	0xFF34:  {true, "\u0054"},
+	0xFF35:  {true, "\u0055"},
+	0xFF36:  {true, "\u0056"},
+	0xFF37:  {true, "\u0057"},
+	0xFF38:  {true, "\u0058"},
+	0xFF39:  {true, "\u0059"},
+	0xFF3A:  {true, "\u005A"},
+	0xFF3B:  {true, "\u005B"},
+	0xFF3C:  {true, "\u005C"},
+	0xFF3D:  {true, "\u005D"},
+	0xFF3E:  {true, "\u005E"},
+	0xFF3F:  {true, "\u005F"},
+	0xFF40:  {true, "\u0060"},
+	0xFF41:  {true, "\u0061"},
+	0xFF42:  {true, "\u0062"},
+	0xFF43:  {true, "\u0063"},
+	0xFF44:  {true, "\u0064"},
+	0xFF45:  {true, "\u0065"},
+	0xFF46:  {true, "\u0066"},
+	0xFF47:  {true, "\u0067"},
+	0xFF48:  {true, "\u0068"},
+	0xFF49:  {true, "\u0069"},
+	0xFF4A:  {true, "\u006A"},
+	0xFF4B:  {true, "\u006B"},
+	0xFF4C:  {true, "\u006C"},
+	0xFF4D:  {true, "\u006D"},
+	0xFF4E:  {true, "\u006E"},
+	0xFF4F:  {true, "\u006F"},
+	0xFF50:  {true, "\u0070"},
+	0xFF51:  {true, "\u0071"},
+	0xFF52:  {true, "\u0072"},
+	0xFF53:  {true, "\u0073"},
+	0xFF54:  {true, "\u0074"},
+	0xFF55:  {true, "\u0075"},
+	0xFF56:  {true, "\u0076"},
+	0xFF57:  {true, "\u0077"},
+	0xFF58:  {true, "\u0078"},
+	0xFF59:  {true, "\u0079"},
+	0xFF5A:  {true, "\u007A"},
+	0xFF5B:  {true, "\u007B"},
+	0xFF5C:  {true, "\u007C"},
+	0xFF5D:  {true, "\u007D"},
+	0xFF5E:  {true, "\u007E"},
+	0xFF5F:  {true, "\u2985"},
+	0xFF60:  {true, "\u2986"},
+	0xFF61:  {true, "\u3002"},
+	0xFF62:  {true, "\u300C"},
+	0xFF63:  {true, "\u300D"},
+	0xFF64:  {true, "\u3001"},
+	0xFF65:  {true, "\u30FB"},
+	0xFF66:  {true, "\u30F2"},
+	0xFF67:  {true, "\u30A1"},
+	0xFF68:  {true, "\u30A3"},
+	0xFF69:  {true, "\u30A5"},
+	0xFF6A:  {true, "\u30A7"},
+	0xFF6B:  {true, "\u30A9"},
+	0xFF6C:  {true, "\u30E3"},
+	0xFF6D:  {true, "\u30E5"},
+	0xFF6E:  {true, "\u30E7"},
+	0xFF6F:  {true, "\u30C3"},
+	0xFF70:  {true, "\u30FC"},
+	0xFF71:  {true, "\u30A2"},
+	0xFF72:  {true, "\u30A4"},
+	0xFF73:  {true, "\u30A6"},
+	0xFF74:  {true, "\u30A8"},
+	0xFF75:  {true, "\u30AA"},
+	0xFF76:  {true, "\u30AB"},
+	0xFF77:  {true, "\u30AD"},
+	0xFF78:  {true, "\u30AF"},
+	0xFF79:  {true, "\u30B1"},
+	0xFF7A:  {true, "\u30B3"},
+	0xFF7B:  {true, "\u30B5"},
+	0xFF7C:  {true, "\u30B7"},
+	0xFF7D:  {true, "\u30B9"},
+	0xFF7E:  {true, "\u30BB"},
+	0xFF7F:  {true, "\u30BD"},
+	0xFF80:  {true, "\u30BF"},
+	0xFF81:  {true, "\u30C1"},
+	0xFF82:  {true, "\u30C4"},
+	0xFF83:  {true, "\u30C6"},
+	0xFF84:  {true, "\u30C8"},
+	0xFF85:  {true, "\u30CA"},
+	0xFF86:  {true, "\u30CB"},
+	0xFF87:  {true, "\u30CC"},
+	0xFF88:  {true, "\u30CD"},
+	0xFF89:  {true, "\u30CE"},
+	0xFF8A:  {true, "\u30CF"},
+	0xFF8B:  {true, "\u30D2"},
+	0xFF8C:  {true, "\u30D5"},
+	0xFF8D:  {true, "\u30D8"},
+	0xFF8E:  {true, "\u30DB"},
+	0xFF8F:  {true, "\u30DE"},
+	0xFF90:  {true, "\u30DF"},
+	0xFF91:  {true, "\u30E0"},
+	0xFF92:  {true, "\u30E1"},
+	0xFF93:  {true, "\u30E2"},
+	0xFF94:  {true, "\u30E4"},
+	0xFF95:  {true, "\u30E6"},
+	0xFF96:  {true, "\u30E8"},
+	0xFF97:  {true, "\u30E9"},
+	0xFF98:  {true, "\u30EA"},
+	0xFF99:  {true, "\u30EB"},
+	0xFF9A:  {true, "\u30EC"},
+	0xFF9B:  {true, "\u30ED"},
+	0xFF9C:  {true, "\u30EF"},
+	0xFF9D:  {true, "\u30F3"},
+	0xFF9E:  {true, "\u3099"},
+	0xFF9F:  {true, "\u309A"},
+	0xFFA0:  {true, "\u1160"},
+	0xFFA1:  {true, "\u1100"},
+	0xFFA2:  {true, "\u1101"},
+	0xFFA3:  {true, "\u11AA"},
+	0xFFA4:  {true, "\u1102"},
+	0xFFA5:  {true, "\u11AC"},
+	0xFFA6:  {true, "\u11AD"},
+	0xFFA7:  {true, "\u1103"},
+	0xFFA8:  {true, "\u1104"},
+	0xFFA9:  {true, "\u1105"},
+	0xFFAA:  {true, "\u11B0"},
+	0xFFAB:  {true, "\u11B1"},
+	0xFFAC:  {true, "\u11B2"},
+	0xFFAD:  {true, "\u11B3"},
+	0xFFAE:  {true, "\u11B4"},
+	0xFFAF:  {true, "\u11B5"},
+	0xFFB0:  {true, "\u111A"},
+	0xFFB1:  {true, "\u1106"},
+	0xFFB2:  {true, "\u1107"},
+	0xFFB3:  {true, "\u1108"},
+	0xFFB4:  {true, "\u1121"},
+	0xFFB5:  {true, "\u1109"},
+	0xFFB6:  {true, "\u110A"},
+	0xFFB7:  {true, "\u110B"},
+	0xFFB8:  {true, "\u110C"},
+	0xFFB9:  {true, "\u110D"},
+	0xFFBA:  {true, "\u110E"},
+	0xFFBB:  {true, "\u110F"},
+	0xFFBC:  {true, "\u1110"},
+	0xFFBD:  {true, "\u1111"},
+	0xFFBE:  {true, "\u1112"},
+	0xFFC2:  {true, "\u1161"},
+	0xFFC3:  {true, "\u1162"},
+	0xFFC4:  {true, "\u1163"},
+	0xFFC5:  {true, "\u1164"},
+	0xFFC6:  {true, "\u1165"},
+	0xFFC7:  {true, "\u1166"},
+	0xFFCA:  {true, "\u1167"},
+	0xFFCB:  {true, "\u1168"},
+	0xFFCC:  {true, "\u1169"},
+	0xFFCD:  {true, "\u116A"},
+	0xFFCE:  {true, "\u116B"},
+	0xFFCF:  {true, "\u116C"},
+	0xFFD2:  {true, "\u116D"},
+	0xFFD3:  {true, "\u116E"},
+	0xFFD4:  {true, "\u116F"},
+	0xFFD5:  {true, "\u1170"},
+	0xFFD6:  {true, "\u1171"},
+	0xFFD7:  {true, "\u1172"},
+	0xFFDA:  {true, "\u1173"},
+	0xFFDB:  {true, "\u1174"},
+	0xFFDC:  {true, "\u1175"},
+	0xFFE0:  {true, "\u00A2"},
+	0xFFE1:  {true, "\u00A3"},
+	0xFFE2:  {true, "\u00AC"},
+	0xFFE3:  {true, "\u0020\u0304"},
+	0xFFE4:  {true, "\u00A6"},
+	0xFFE5:  {true, "\u00A5"},
+	0xFFE6:  {true, "\u20A9"},
+	0xFFE8:  {true, "\u2502"},
+	0xFFE9:  {true, "\u2190"},
+	0xFFEA:  {true, "\u2191"},
+	0xFFEB:  {true, "\u2192"},
+	0xFFEC:  {true, "\u2193"},
+	0xFFED:  {true, "\u25A0"},
+	0xFFEE:  {true, "\u25CB"},
+	0x105C9: {false, "\U000105D2\u0307"},
+	0x105E4: {false, "\U000105DA\u0307"},
+	0x10781: {true, "\u02D0"},
+	0x10782: {true, "\u02D1"},
+	0x10783: {true, "\u00E6"},
+	0x10784: {true, "\u0299"},
+	0x10785: {true, "\u0253"},
+	0x10787: {true, "\u02A3"},
+	0x10788: {true, "\uAB66"},
+	0x10789: {true, "\u02A5"},
+	0x1078A: {true, "\u02A4"},
+	0x1078B: {true, "\u0256"},
+	0x1078C: {true, "\u0257"},
+	0x1078D: {true, "\u1D91"},
+	0x1078E: {true, "\u0258"},
+	0x1078F: {true, "\u025E"},
+	0x10790: {true, "\u02A9"},
+	0x10791: {true, "\u0264"},
+	0x10792: {true, "\u0262"},
+	0x10793: {true, "\u0260"},
+	0x10794: {true, "\u029B"},
+	0x10795: {true, "\u0127"},
+	0x10796: {true, "\u029C"},
+	0x10797: {true, "\u0267"},
+	0x10798: {true, "\u0284"},
+	0x10799: {true, "\u02AA"},
+	0x1079A: {true, "\u02AB"},
+	0x1079B: {true, "\u026C"},
+	0x1079C: {true, "\U0001DF04"},
+	0x1079D: {true, "\uA78E"},
+	0x1079E: {true, "\u026E"},
+	0x1079F: {true, "\U0001DF05"},
+	0x107A0: {true, "\u028E"},
+	0x107A1: {true, "\U0001DF06"},
+	0x107A2: {true, "\u00F8"},
+	0x107A3: {true, "\u0276"},
+	0x107A4: {true, "\u0277"},
+	0x107A5: {true, "\u0071"},
+	0x107A6: {true, "\u027A"},
+	0x107A7: {true, "\U0001DF08"},
+	0x107A8: {true, "\u027D"},
+	0x107A9: {true, "\u027E"},
+	0x107AA: {true, "\u0280"},
+	0x107AB: {true, "\u02A8"},
+	0x107AC: {true, "\u02A6"},
+	0x107AD: {true, "\uAB67"},
+	0x107AE: {true, "\u02A7"},
+	0x107AF: {true, "\u0288"},
+	0x107B0: {true, "\u2C71"},
+	0x107B2: {true, "\u028F"},
+	0x107B3: {true, "\u02A1"},
+	0x107B4: {true, "\u02A2"},
+	0x107B5: {true, "\u0298"},
+	0x107B6: {true, "\u01C0"},
+	0x107B7: {true, "\u01C1"},
+	0x107B8: {true, "\u01C2"},
+	0x107B9: {true, "\U0001DF0A"},
+	0x107BA: {true, "\U0001DF1E"},
+	0x1109A: {false, "\U00011099\U000110BA"},
+	0x1109C: {false, "\U0001109B\U000110BA"},
+	0x110AB: {false, "\U000110A5\U000110BA"},
+	0x1112E: {false, "\U00011131\U00011127"},
+	0x1112F: {false, "\U00011132\U00011127"},
+	0x1134B: {false, "\U00011347\U0001133E"},
+	0x1134C: {false, "\U00011347\U00011357"},
+	0x11383: {false, "\U00011382\U000113C9"},
+	0x11385: {false, "\U00011384\U000113BB"},
+	0x1138E: {false, "\U0001138B\U000113C2"},
+	0x11391: {false, "\U00011390\U000113C9"},
+	0x113C5: {false, "\U000113C2\U000113C2"},
+	0x113C7: {false, "\U000113C2\U000113B8"},
+	0x113C8: {false, "\U000113C2\U000113C9"},
+	0x114BB: {false, "\U000114B9\U000114BA"},
+	0x114BC: {false, "\U000114B9\U000114B0"},
+	0x114BE: {false, "\U000114B9\U000114BD"},
+	0x115BA: {false, "\U000115B8\U000115AF"},
+	0x115BB: {false, "\U000115B9\U000115AF"},
+	0x11938: {false, "\U00011935\U00011930"},
+	0x16121: {false, "\U0001611E\U0001611E"},
+	0x16122: {false, "\U0001611E\U00016129"},
+	0x16123: {false, "\U0001611E\U0001611F"},
+	0x16124: {false, "\U00016129\U0001611F"},
+	0x16125: {false, "\U0001611E\U00016120"},
+	0x16126: {false, "\U00016121\U0001611F"},
+	0x16127: {false, "\U00016122\U0001611F"},
+	0x16128: {false, "\U00016121\U00016120"},
+	0x16D68: {false, "\U00016D67\U00016D67"},
+	0x16D69: {false, "\U00016D63\U00016D67"},
+	0x16D6A: {false, "\U00016D69\U00016D67"},
+	0x1CCD6: {true, "\u0041"},
+	0x1CCD7: {true, "\u0042"},
+	0x1CCD8: {true, "\u0043"},
+	0x1CCD9: {true, "\u0044"},
+	0x1CCDA: {true, "\u0045"},
+	0x1CCDB: {true, "\u0046"},
+	0x1CCDC: {true, "\u0047"},
+	0x1CCDD: {true, "\u0048"},
+	0x1CCDE: {true, "\u0049"},
+	0x1CCDF: {true, "\u004A"},
+	0x1CCE0: {true, "\u004B"},
+	0x1CCE1: {true, "\u004C"},
+	0x1CCE2: {true, "\u004D"},
+	0x1CCE3: {true, "\u004E"},
+	0x1CCE4: {true, "\u004F"},
+	0x1CCE5: {true, "\u0050"},
+	0x1CCE6: {true, "\u0051"},
+	0x1CCE7: {true, "\u0052"},
+	0x1CCE8: {true, "\u0053"},
+	0x1CCE9: {true, "\u0054"},
+	0x1CCEA: {true, "\u0055"},
+	0x1CCEB: {true, "\u0056"},
+	0x1CCEC: {true, "\u0057"},
+	0x1CCED: {true, "\u0058"},
+	0x1CCEE: {true, "\u0059"},
+	0x1CCEF: {true, "\u005A"},
+	0x1CCF0: {true, "\u0030"},
+	0x1CCF1: {true, "\u0031"},
+	0x1CCF2: {true, "\u0032"},
+	0x1CCF3: {true, "\u0033"},
+	0x1CCF4: {true, "\u0034"},
+	0x1CCF5: {true, "\u0035"},
+	0x1CCF6: {true, "\u0036"},
+	0x1CCF7: {true, "\u0037"},
+	0x1CCF8: {true, "\u0038"},
+	0x1CCF9: {true, "\u0039"},
+	0x1D15E: {false, "\U0001D157\U0001D165"},
+	0x1D15F: {false, "\U0001D158\U0001D165"},
+	0x1D160: {false, "\U0001D15F\U0001D16E"},
+	0x1D161: {false, "\U0001D15F\U0001D16F"},
+	0x1D162: {false, "\U0001D15F\U0001D170"},
+	0x1D163: {false, "\U0001D15F\U0001D171"},
+	0x1D164: {false, "\U0001D15F\U0001D172"},
+	0x1D1BB: {false, "\U0001D1B9\U0001D165"},
+	0x1D1BC: {false, "\U0001D1BA\U0001D165"},
+	0x1D1BD: {false, "\U0001D1BB\U0001D16E"},
+	0x1D1BE: {false, "\U0001D1BC\U0001D16E"},
+	0x1D1BF: {false, "\U0001D1BB\U0001D16F"},
+	0x1D1C0: {false, "\U0001D1BC\U0001D16F"},
+	0x1D400: {true, "\u0041"},
+	0x1D401: {true, "\u0042"},
+	0x1D402: {true, "\u0043"},
+	0x1D403: {true, "\u0044"},
+	0x1D404: {true, "\u0045"},
+	0x1D405: {true, "\u0046"},
+	0x1D406: {true, "\u0047"},
+	0x1D407: {true, "\u0048"},
+	0x1D408: {true, "\u0049"},
+	0x1D409: {true, "\u004A"},
+	0x1D40A: {true, "\u004B"},
+	0x1D40B: {true, "\u004C"},
+	0x1D40C: {true, "\u004D"},
+	0x1D40D: {true, "\u004E"},
+	0x1D40E: {true, "\u004F"},
+	0x1D40F: {true, "\u0050"},
+	0x1D410: {true, "\u0051"},
+	0x1D411: {true, "\u0052"},
+	0x1D412: {true, "\u0053"},
+	0x1D413: {true, "\u0054"},
+	0x1D414: {true, "\u0055"},
+	0x1D415: {true, "\u0056"},
+	0x1D416: {true, "\u0057"},
+	0x1D417: {true, "\u0058"},
+	0x1D418: {true, "\u0059"},
+	0x1D419: {true, "\u005A"},
+	0x1D41A: {true, "\u0061"},
+	0x1D41B: {true, "\u0062"},
+	0x1D41C: {true, "\u0063"},
+	0x1D41D: {true, "\u0064"},
+	0x1D41E: {true, "\u0065"},
+	0x1D41F: {true, "\u0066"},
+	0x1D420: {true, "\u0067"},
+	0x1D421: {true, "\u0068"},
+	0x1D422: {true, "\u0069"},
+	0x1D423: {true, "\u006A"},
+	0x1D424: {true, "\u006B"},
+	0x1D425: {true, "\u006C"},
+	0x1D426: {true, "\u006D"},
+	0x1D427: {true, "\u006E"},
+	0x1D428: {true, "\u006F"},
+	0x1D429: {true, "\u0070"},
+	0x1D42A: {true, "\u0071"},
+	0x1D42B: {true, "\u0072"},
+	0x1D42C: {true, "\u0073"},
+	0x1D42D: {true, "\u0074"},
+	0x1D42E: {true, "\u0075"},
+	0x1D42F: {true, "\u0076"},
+	0x1D430: {true, "\u0077"},
+	0x1D431: {true, "\u0078"},
+	0x1D432: {true, "\u0079"},
+	0x1D433: {true, "\u007A"},
+	0x1D434: {true, "\u0041"},
+	0x1D435: {true, "\u0042"},
+	0x1D436: {true, "\u0043"},
+	0x1D437: {true, "\u0044"},
+	0x1D438: {true, "\u0045"},
+	0x1D439: {true, "\u0046"},
+	0x1D43A: {true, "\u0047"},
+	0x1D43B: {true, "\u0048"},
+	0x1D43C: {true, "\u0049"},
+	0x1D43D: {true, "\u004A"},
+	0x1D43E: {true, "\u004B"},
+	0x1D43F: {true, "\u004C"},
+	0x1D440: {true, "\u004D"},
+	0x1D441: {true, "\u004E"},
+	0x1D442: {true, "\u004F"},
+	0x1D443: {true, "\u0050"},
+	0x1D444: {true, "\u0051"},
+	0x1D445: {true, "\u0052"},
+	0x1D446: {true, "\u0053"},
+	0x1D447: {true, "\u0054"},
+	0x1D448: {true, "\u0055"},
+	0x1D449: {true, "\u0056"},
+	0x1D44A: {true, "\u0057"},
+	0x1D44B: {true, "\u0058"},
+	0x1D44C: {true, "\u0059"},
+	0x1D44D: {true, "\u005A"},
+	0x1D44E: {true, "\u0061"},
+	0x1D44F: {true, "\u0062"},
+	0x1D450: {true, "\u0063"},
+	0x1D451: {true, "\u0064"},
+	0x1D452: {true, "\u0065"},
+	0x1D453: {true, "\u0066"},
+	0x1D454: {true, "\u0067"},
+	0x1D456: {true, "\u0069"},
+	0x1D457: {true, "\u006A"},
+	0x1D458: {true, "\u006B"},
+	0x1D459: {true, "\u006C"},
+	0x1D45A: {true, "\u006D"},
+	0x1D45B: {true, "\u006E"},
+	0x1D45C: {true, "\u006F"},
+	0x1D45D: {true, "\u0070"},
+	0x1D45E: {true, "\u0071"},
+	0x1D45F: {true, "\u0072"},
+	0x1D460: {true, "\u0073"},
+	0x1D461: {true, "\u0074"},
+	0x1D462: {true, "\u0075"},
+	0x1D463: {true, "\u0076"},
+	0x1D464: {true, "\u0077"},
+	0x1D465: {true, "\u0078"},
+	0x1D466: {true, "\u0079"},
+	0x1D467: {true, "\u007A"},
+	0x1D468: {true, "\u0041"},
+	0x1D469: {true, "\u0042"},
+	0x1D46A: {true, "\u0043"},
+	0x1D46B: {true, "\u0044"},
+	0x1D46C: {true, "\u0045"},
+	0x1D46D: {true, "\u0046"},
+	0x1D46E: {true, "\u0047"},
+	0x1D46F: {true, "\u0048"},
+	0x1D470: {true, "\u0049"},
+	0x1D471: {true, "\u004A"},
+	0x1D472: {true, "\u004B"},
+	0x1D473: {true, "\u004C"},
+	0x1D474: {true, "\u004D"},
+	0x1D475: {true, "\u004E"},
+	0x1D476: {true, "\u004F"},
+	0x1D477: {true, "\u0050"},
+	0x1D478: {true, "\u0051"},
+	0x1D479: {true, "\u0052"},
+	0x1D47A: {true, "\u0053"},
+	0x1D47B: {true, "\u0054"},
+	0x1D47C: {true, "\u0055"},
+	0x1D47D: {true, "\u0056"},
+	0x1D47E: {true, "\u0057"},
+	0x1D47F: {true, "\u0058"},
+	0x1D480: {true, "\u0059"},
+	0x1D481: {true, "\u005A"},
+	0x1D482: {true, "\u0061"},
+	0x1D483: {true, "\u0062"},
+	0x1D484: {true, "\u0063"},
+	0x1D485: {true, "\u0064"},
+	0x1D486: {true, "\u0065"},
+	0x1D487: {true, "\u0066"},
+	0x1D488: {true, "\u0067"},
+	0x1D489: {true, "\u0068"},
+	0x1D48A: {true, "\u0069"},
+	0x1D48B: {true, "\u006A"},
+	0x1D48C: {true, "\u006B"},
+	0x1D48D: {true, "\u006C"},
+	0x1D48E: {true, "\u006D"},
+	0x1D48F: {true, "\u006E"},
+	0x1D490: {true, "\u006F"},
+	0x1D491: {true, "\u0070"},
+	0x1D492: {true, "\u0071"},
+	0x1D493: {true, "\u0072"},
+	0x1D494: {true, "\u0073"},
+	0x1D495: {true, "\u0074"},
+	0x1D496: {true, "\u0075"},
+	0x1D497: {true, "\u0076"},
+	0x1D498: {true, "\u0077"},
+	0x1D499: {true, "\u0078"},
+	0x1D49A: {true, "\u0079"},
+	0x1D49B: {true, "\u007A"},
+	0x1D49C: {true, "\u0041"},
+	0x1D49E: {true, "\u0043"},
+	0x1D49F: {true, "\u0044"},
+	0x1D4A2: {true, "\u0047"},
+	0x1D4A5: {true, "\u004A"},
+	0x1D4A6: {true, "\u004B"},
+	0x1D4A9: {true, "\u004E"},
+	0x1D4AA: {true, "\u004F"},
+	0x1D4AB: {true, "\u0050"},
+	0x1D4AC: {true, "\u0051"},
+	0x1D4AE: {true, "\u0053"},
+	0x1D4AF: {true, "\u0054"},
+	0x1D4B0: {true, "\u0055"},
+	0x1D4B1: {true, "\u0056"},
+	0x1D4B2: {true, "\u0057"},
+	0x1D4B3: {true, "\u0058"},
+	0x1D4B4: {true, "\u0059"},
+	0x1D4B5: {true, "\u005A"},
+	0x1D4B6: {true, "\u0061"},
+	0x1D4B7: {true, "\u0062"},
+	0x1D4B8: {true, "\u0063"},
+	0x1D4B9: {true, "\u0064"},
+	0x1D4BB: {true, "\u0066"},
+	0x1D4BD: {true, "\u0068"},
+	0x1D4BE: {true, "\u0069"},
+	0x1D4BF: {true, "\u006A"},
+	0x1D4C0: {true, "\u006B"},
+	0x1D4C1: {true, "\u006C"},
+	0x1D4C2: {true, "\u006D"},
+	0x1D4C3: {true, "\u006E"},
+	0x1D4C5: {true, "\u0070"},
+	0x1D4C6: {true, "\u0071"},
+	0x1D4C7: {true, "\u0072"},
+	0x1D4C8: {true, "\u0073"},
+	0x1D4C9: {true, "\u0074"},
+	0x1D4CA: {true, "\u0075"},
+	0x1D4CB: {true, "\u0076"},
+	0x1D4CC: {true, "\u0077"},
+	0x1D4CD: {true, "\u0078"},
+	0x1D4CE: {true, "\u0079"},
+	0x1D4CF: {true, "\u007A"},
+	0x1D4D0: {true, "\u0041"},
+	0x1D4D1: {true, "\u0042"},
+	0x1D4D2: {true, "\u0043"},
+	0x1D4D3: {true, "\u0044"},
+	0x1D4D4: {true, "\u0045"},
+	0x1D4D5: {true, "\u0046"},
+	0x1D4D6: {true, "\u0047"},
+	0x1D4D7: {true, "\u0048"},
+	0x1D4D8: {true, "\u0049"},
+	0x1D4D9: {true, "\u004A"},
+	0x1D4DA: {true, "\u004B"},
+	0x1D4DB: {true, "\u004C"},
+	0x1D4DC: {true, "\u004D"},
+	0x1D4DD: {true, "\u004E"},
+	0x1D4DE: {true, "\u004F"},
+	0x1D4DF: {true, "\u0050"},
+	0x1D4E0: {true, "\u0051"},
+	0x1D4E1: {true, "\u0052"},
+	0x1D4E2: {true, "\u0053"},
+	0x1D4E3: {true, "\u0054"},
+	0x1D4E4: {true, "\u0055"},
+	0x1D4E5: {true, "\u0056"},
+	0x1D4E6: {true, "\u0057"},
+	0x1D4E7: {true, "\u0058"},
+	0x1D4E8: {true, "\u0059"},
+	0x1D4E9: {true, "\u005A"},
+	0x1D4EA: {true, "\u0061"},
+	0x1D4EB: {true, "\u0062"},
+	0x1D4EC: {true, "\u0063"},
+	0x1D4ED: {true, "\u0064"},
+	0x1D4EE: {true, "\u0065"},
+	0x1D4EF: {true, "\u0066"},
+	0x1D4F0: {true, "\u0067"},
+	0x1D4F1: {true, "\u0068"},
+	0x1D4F2: {true, "\u0069"},
+	0x1D4F3: {true, "\u006A"},
+	0x1D4F4: {true, "\u006B"},
+	0x1D4F5: {true, "\u006C"},
+	0x1D4F6: {true, "\u006D"},
+	0x1D4F7: {true, "\u006E"},
+	0x1D4F8: {true, "\u006F"},
+	0x1D4F9: {true, "\u0070"},
+	0x1D4FA: {true, "\u0071"},
+	0x1D4FB: {true, "\u0072"},
+	0x1D4FC: {true, "\u0073"},
+	0x1D4FD: {true, "\u0074"},
+	0x1D4FE: {true, "\u0075"},
+	0x1D4FF: {true, "\u0076"},
+	0x1D500: {true, "\u0077"},
+	0x1D501: {true, "\u0078"},
+	0x1D502: {true, "\u0079"},
+	0x1D503: {true, "\u007A"},
+	0x1D504: {true, "\u0041"},
+	0x1D505: {true, "\u0042"},
+	0x1D507: {true, "\u0044"},
+	0x1D508: {true, "\u0045"},
+	0x1D509: {true, "\u0046"},
+	0x1D50A: {true, "\u0047"},
+	0x1D50D: {true, "\u004A"},
+	0x1D50E: {true, "\u004B"},
+	0x1D50F: {true, "\u004C"},
+	0x1D510: {true, "\u004D"},
+	0x1D511: {true, "\u004E"},
+	0x1D512: {true, "\u004F"},
+	0x1D513: {true, "\u0050"},
+	0x1D514: {true, "\u0051"},
+	0x1D516: {true, "\u0053"},
+	0x1D517: {true, "\u0054"},
+	0x1D518: {true, "\u0055"},
+	0x1D519: {true, "\u0056"},
+	0x1D51A: {true, "\u0057"},
+	0x1D51B: {true, "\u0058"},
+	0x1D51C: {true, "\u0059"},
+	0x1D51E: {true, "\u0061"},
+	0x1D51F: {true, "\u0062"},
+	0x1D520: {true, "\u0063"},
+	0x1D521: {true, "\u0064"},
+	0x1D522: {true, "\u0065"},
+	0x1D523: {true, "\u0066"},
+	0x1D524: {true, "\u0067"},
+	0x1D525: {true, "\u0068"},
+	0x1D526: {true, "\u0069"},
+	0x1D527: {true, "\u006A"},
+	0x1D528: {true, "\u006B"},
+	0x1D529: {true, "\u006C"},
+	0x1D52A: {true, "\u006D"},
+	0x1D52B: {true, "\u006E"},
+	0x1D52C: {true, "\u006F"},
+	0x1D52D: {true, "\u0070"},
+	0x1D52E: {true, "\u0071"},
+	0x1D52F: {true, "\u0072"},
+	0x1D530: {true, "\u0073"},
+	0x1D531: {true, "\u0074"},
+	0x1D532: {true, "\u0075"},
+	0x1D533: {true, "\u0076"},
+	0x1D534: {true, "\u0077"},
+	0x1D535: {true, "\u0078"},
+	0x1D536: {true, "\u0079"},
+	0x1D537: {true, "\u007A"},
+	0x1D538: {true, "\u0041"},
+	0x1D539: {true, "\u0042"},
+	0x1D53B: {true, "\u0044"},
+	0x1D53C: {true, "\u0045"},
+	0x1D53D: {true, "\u0046"},
+	0x1D53E: {true, "\u0047"},
+	0x1D540: {true, "\u0049"},
+	0x1D541: {true, "\u004A"},
+	0x1D542: {true, "\u004B"},
+	0x1D543: {true, "\u004C"},
+	0x1D544: {true, "\u004D"},
+	0x1D546: {true, "\u004F"},
+	0x1D54A: {true, "\u0053"},
+	0x1D54B: {true, "\u0054"},
+	0x1D54C: {true, "\u0055"},
+	0x1D54D: {true, "\u0056"},
+	0x1D54E: {true, "\u0057"},
+	0x1D54F: {true, "\u0058"},
+	0x1D550: {true, "\u0059"},
+	0x1D552: {true, "\u0061"},
+	0x1D553: {true, "\u0062"},
+	0x1D554: {true, "\u0063"},
+	0x1D555: {true, "\u0064"},
+	0x1D556: {true, "\u0065"},
+	0x1D557: {true, "\u0066"},
+	0x1D558: {true, "\u0067"},
+	0x1D559: {true, "\u0068"},
+	0x1D55A: {true, "\u0069"},
+	0x1D55B: {true, "\u006A"},
+	0x1D55C: {true, "\u006B"},
+	0x1D55D: {true, "\u006C"},
+	0x1D55E: {true, "\u006D"},
+	0x1D55F: {true, "\u006E"},
+	0x1D560: {true, "\u006F"},
+	0x1D561: {true, "\u0070"},
+	0x1D562: {true, "\u0071"},
+	0x1D563: {true, "\u0072"},
+	0x1D564: {true, "\u0073"},
+	0x1D565: {true, "\u0074"},
+	0x1D566: {true, "\u0075"},
+	0x1D567: {true, "\u0076"},
+	0x1D568: {true, "\u0077"},
+	0x1D569: {true, "\u0078"},
+	0x1D56A: {true, "\u0079"},
+	0x1D56B: {true, "\u007A"},
+	0x1D56C: {true, "\u0041"},
+	0x1D56D: {true, "\u0042"},
+	0x1D56E: {true, "\u0043"},
+	0x1D56F: {true, "\u0044"},
+	0x1D570: {true, "\u0045"},
+	0x1D571: {true, "\u0046"},
+	0x1D572: {true, "\u0047"},
+	0x1D573: {true, "\u0048"},
+	0x1D574: {true, "\u0049"},
+	0x1D575: {true, "\u004A"},
+	0x1D576: {true, "\u004B"},
+	0x1D577: {true, "\u004C"},
+	0x1D578: {true, "\u004D"},
+	0x1D579: {true, "\u004E"},
+	0x1D57A: {true, "\u004F"},
+	0x1D57B: {true, "\u0050"},
+	0x1D57C: {true, "\u0051"},
+	0x1D57D: {true, "\u0052"},
+	0x1D57E: {true, "\u0053"},
+	0x1D57F: {true, "\u0054"},
+	0x1D580: {true, "\u0055"},
+	0x1D581: {true, "\u0056"},
+	0x1D582: {true, "\u0057"},
+	0x1D583: {true, "\u0058"},
+	0x1D584: {true, "\u0059"},
+	0x1D585: {true, "\u005A"},
+	0x1D586: {true, "\u0061"},
+	0x1D587: {true, "\u0062"},
+	0x1D588: {true, "\u0063"},
+	0x1D589: {true, "\u0064"},
+	0x1D58A: {true, "\u0065"},
+	0x1D58B: {true, "\u0066"},
+	0x1D58C: {true, "\u0067"},
+	0x1D58D: {true, "\u0068"},
+	0x1D58E: {true, "\u0069"},
+	0x1D58F: {true, "\u006A"},
+	0x1D590: {true, "\u006B"},
+	0x1D591: {true, "\u006C"},
+	0x1D592: {true, "\u006D"},
+	0x1D593: {true, "\u006E"},
+	0x1D594: {true, "\u006F"},
+	0x1D595: {true, "\u0070"},
+	0x1D596: {true, "\u0071"},
+	0x1D597: {true, "\u0072"},
+	0x1D598: {true, "\u0073"},
+	0x1D599: {true, "\u0074"},
+	0x1D59A: {true, "\u0075"},
+	0x1D59B: {true, "\u0076"},
+	0x1D59C: {true, "\u0077"},
+	0x1D59D: {true, "\u0078"},
+	0x1D59E: {true, "\u0079"},
+	0x1D59F: {true, "\u007A"},
+	0x1D5A0: {true, "\u0041"},
+	0x1D5A1: {true, "\u0042"},
+	0x1D5A2: {true, "\u0043"},
+	0x1D5A3: {true, "\u0044"},
+	0x1D5A4: {true, "\u0045"},
+	0x1D5A5: {true, "\u0046"},
+	0x1D5A6: {true, "\u0047"},
+	0x1D5A7: {true, "\u0048"},
+	0x1D5A8: {true, "\u0049"},
+	0x1D5A9: {true, "\u004A"},
+	0x1D5AA: {true, "\u004B"},
+	0x1D5AB: {true, "\u004C"},
+	0x1D5AC: {true, "\u004D"},
+	0x1D5AD: {true, "\u004E"},
+	0x1D5AE: {true, "\u004F"},
+	0x1D5AF: {true, "\u0050"},
+	0x1D5B0: {true, "\u0051"},
+	0x1D5B1: {true, "\u0052"},
+	0x1D5B2: {true, "\u0053"},
+	0x1D5B3: {true, "\u0054"},
+	0x1D5B4: {true, "\u0055"},
+	0x1D5B5: {true, "\u0056"},
+	0x1D5B6: {true, "\u0057"},
+	0x1D5B7: {true, "\u0058"},
+	0x1D5B8: {true, "\u0059"},
+	0x1D5B9: {true, "\u005A"},
+	0x1D5BA: {true, "\u0061"},
+	0x1D5BB: {true, "\u0062"},
+	0x1D5BC: {true, "\u0063"},
+	0x1D5BD: {true, "\u0064"},
+	0x1D5BE: {true, "\u0065"},
+	0x1D5BF: {true, "\u0066"},
+	0x1D5C0: {true, "\u0067"},
+	0x1D5C1: {true, "\u0068"},
+	0x1D5C2: {true, "\u0069"},
+	0x1D5C3: {true, "\u006A"},
+	0x1D5C4: {true, "\u006B"},
+	0x1D5C5: {true, "\u006C"},
+	0x1D5C6: {true, "\u006D"},
+	0x1D5C7: {true, "\u006E"},
+	0x1D5C8: {true, "\u006F"},
+	0x1D5C9: {true, "\u0070"},
+	0x1D5CA: {true, "\u0071"},
+	0x1D5CB: {true, "\u0072"},
+	0x1D5CC: {true, "\u0073"},
+	0x1D5CD: {true, "\u0074"},
+	0x1D5CE: {true, "\u0075"},
+	0x1D5CF: {true, "\u0076"},
+	0x1D5D0: {true, "\u0077"},
+	0x1D5D1: {true, "\u0078"},
+	0x1D5D2: {true, "\u0079"},
+	0x1D5D3: {true, "\u007A"},
+	0x1D5D4: {true, "\u0041"},
+	0x1D5D5: {true, "\u0042"},
+	0x1D5D6: {true, "\u0043"},
+	0x1D5D7: {true, "\u0044"},
+	0x1D5D8: {true, "\u0045"},
+	0x1D5D9: {true, "\u0046"},
+	0x1D5DA: {true, "\u0047"},
+	0x1D5DB: {true, "\u0048"},
+	0x1D5DC: {true, "\u0049"},
+	0x1D5DD: {true, "\u004A"},
+	0x1D5DE: {true, "\u004B"},
+	0x1D5DF: {true, "\u004C"},
+	0x1D5E0: {true, "\u004D"},
+	0x1D5E1: {true, "\u004E"},
+	0x1D5E2: {true, "\u004F"},
+	0x1D5E3: {true, "\u0050"},
+	0x1D5E4: {true, "\u0051"},
+	0x1D5E5: {true, "\u0052"},
+	0x1D5E6: {true, "\u0053"},
+	0x1D5E7: {true, "\u0054"},
+	0x1D5E8: {true, "\u0055"},
+	0x1D5E9: {true, "\u0056"},
+	0x1D5EA: {true, "\u0057"},
+	0x1D5EB: {true, "\u0058"},
+	0x1D5EC: {true, "\u0059"},
+	0x1D5ED: {true, "\u005A"},
+	0x1D5EE: {true, "\u0061"},
+	0x1D5EF: {true, "\u0062"},
+	0x1D5F0: {true, "\u0063"},
+	0x1D5F1: {true, "\u0064"},
+	0x1D5F2: {true, "\u0065"},
+	0x1D5F3: {true, "\u0066"},
+	0x1D5F4: {true, "\u0067"},
+	0x1D5F5: {true, "\u0068"},
+	0x1D5F6: {true, "\u0069"},
+	0x1D5F7: {true, "\u006A"},
+	0x1D5F8: {true, "\u006B"},
+	0x1D5F9: {true, "\u006C"},
+	0x1D5FA: {true, "\u006D"},
+	0x1D5FB: {true, "\u006E"},
+	0x1D5FC: {true, "\u006F"},
+	0x1D5FD: {true, "\u0070"},
+	0x1D5FE: {true, "\u0071"},
+	0x1D5FF: {true, "\u0072"},
+	0x1D600: {true, "\u0073"},
+	0x1D601: {true, "\u0074"},
+	0x1D602: {true, "\u0075"},
+	0x1D603: {true, "\u0076"},
+	0x1D604: {true, "\u0077"},
+	0x1D605: {true, "\u0078"},
+	0x1D606: {true, "\u0079"},
+	0x1D607: {true, "\u007A"},
+	0x1D608: {true, "\u0041"},
+	0x1D609: {true, "\u0042"},
+	0x1D60A: {true, "\u0043"},
+	0x1D60B: {true, "\u0044"},
+	0x1D60C: {true, "\u0045"},
+	0x1D60D: {true, "\u0046"},
+	0x1D60E: {true, "\u0047"},
+	0x1D60F: {true, "\u0048"},
+	0x1D610: {true, "\u0049"},
+	0x1D611: {true, "\u004A"},
+	0x1D612: {true, "\u004B"},
+	0x1D613: {true, "\u004C"},
+	0x1D614: {true, "\u004D"},
+	0x1D615: {true, "\u004E"},
+	0x1D616: {true, "\u004F"},
+	0x1D617: {true, "\u0050"},
+	0x1D618: {true, "\u0051"},
+	0x1D619: {true, "\u0052"},
+	0x1D61A: {true, "\u0053"},
+	0x1D61B: {true, "\u0054"},
+	0x1D61C: {true, "\u0055"},
+	0x1D61D: {true, "\u0056"},
+	0x1D61E: {true, "\u0057"},
+	0x1D61F: {true, "\u0058"},
+	0x1D620: {true, "\u0059"},
+	0x1D621: {true, "\u005A"},
+	0x1D622: {true, "\u0061"},
+	0x1D623: {true, "\u0062"},
+	0x1D624: {true, "\u0063"},
+	0x1D625: {true, "\u0064"},
+	0x1D626: {true, "\u0065"},
+	0x1D627: {true, "\u0066"},
+	0x1D628: {true, "\u0067"},
+	0x1D629: {true, "\u0068"},
+	0x1D62A: {true, "\u0069"},
+	0x1D62B: {true, "\u006A"},
+	0x1D62C: {true, "\u006B"},
+	0x1D62D: {true, "\u006C"},
+	0x1D62E: {true, "\u006D"},
+	0x1D62F: {true, "\u006E"},
+	0x1D630: {true, "\u006F"},
+	0x1D631: {true, "\u0070"},
+	0x1D632: {true, "\u0071"},
+	0x1D633: {true, "\u0072"},
+	0x1D634: {true, "\u0073"},
+	0x1D635: {true, "\u0074"},
+	0x1D636: {true, "\u0075"},
+	0x1D637: {true, "\u0076"},
+	0x1D638: {true, "\u0077"},
+	0x1D639: {true, "\u0078"},
+	0x1D63A: {true, "\u0079"},
+	0x1D63B: {true, "\u007A"},
+	0x1D63C: {true, "\u0041"},
+	0x1D63D: {true, "\u0042"},
+	0x1D63E: {true, "\u0043"},
+	0x1D63F: {true, "\u0044"},
+	0x1D640: {true, "\u0045"},
+	0x1D641: {true, "\u0046"},
+	0x1D642: {true, "\u0047"},
+	0x1D643: {true, "\u0048"},
+	0x1D644: {true, "\u0049"},
+	0x1D645: {true, "\u004A"},
+	0x1D646: {true, "\u004B"},
+	0x1D647: {true, "\u004C"},
+	0x1D648: {true, "\u004D"},
+	0x1D649: {true, "\u004E"},
+	0x1D64A: {true, "\u004F"},
+	0x1D64B: {true, "\u0050"},
+	0x1D64C: {true, "\u0051"},
+	0x1D64D: {true, "\u0052"},
+	0x1D64E: {true, "\u0053"},
+	0x1D64F: {true, "\u0054"},
+	0x1D650: {true, "\u0055"},
+	0x1D651: {true, "\u0056"},
+	0x1D652: {true, "\u0057"},
+	0x1D653: {true, "\u0058"},
+	0x1D654: {true, "\u0059"},
+	0x1D655: {true, "\u005A"},
+	0x1D656: {true, "\u0061"},
+	0x1D657: {true, "\u0062"},
+	0x1D658: {true, "\u0063"},
+	0x1D659: {true, "\u0064"},
+	0x1D65A: {true, "\u0065"},
+	0x1D65B: {true, "\u0066"},
+	0x1D65C: {true, "\u0067"},
+	0x1D65D: {true, "\u0068"},
+	0x1D65E: {true, "\u0069"},
+	0x1D65F: {true, "\u006A"},
+	0x1D660: {true, "\u006B"},
+	0x1D661: {true, "\u006C"},
+	0x1D662: {true, "\u006D"},
+	0x1D663: {true, "\u006E"},
+	0x1D664: {true, "\u006F"},
+	0x1D665: {true, "\u0070"},
+	0x1D666: {true, "\u0071"},
+	0x1D667: {true, "\u0072"},
+	0x1D668: {true, "\u0073"},
+	0x1D669: {true, "\u0074"},
+	0x1D66A: {true, "\u0075"},
+	0x1D66B: {true, "\u0076"},
+	0x1D66C: {true, "\u0077"},
+	0x1D66D: {true, "\u0078"},
+	0x1D66E: {true, "\u0079"},
+	0x1D66F: {true, "\u007A"},
+	0x1D670: {true, "\u0041"},
+	0x1D671: {true, "\u0042"},
+	0x1D672: {true, "\u0043"},
+	0x1D673: {true, "\u0044"},
+	0x1D674: {true, "\u0045"},
+	0x1D675: {true, "\u0046"},
+	0x1D676: {true, "\u0047"},
+	0x1D677: {true, "\u0048"},
+	0x1D678: {true, "\u0049"},
+	0x1D679: {true, "\u004A"},
+	0x1D67A: {true, "\u004B"},
+	0x1D67B: {true, "\u004C"},
+	0x1D67C: {true, "\u004D"},
+	0x1D67D: {true, "\u004E"},
+	0x1D67E: {true, "\u004F"},
+	0x1D67F: {true, "\u0050"},
+	0x1D680: {true, "\u0051"},
+	0x1D681: {true, "\u0052"},
+	0x1D682: {true, "\u0053"},
+	0x1D683: {true, "\u0054"},
+	0x1D684: {true, "\u0055"},
+	0x1D685: {true, "\u0056"},
+	0x1D686: {true, "\u0057"},
+	0x1D687: {true, "\u0058"},
+	0x1D688: {true, "\u0059"},
+	0x1D689: {true, "\u005A"},
+	0x1D68A: {true, "\u0061"},
+	0x1D68B: {true, "\u0062"},
+	0x1D68C: {true, "\u0063"},
+	0x1D68D: {true, "\u0064"},
+	0x1D68E: {true, "\u0065"},
+	0x1D68F: {true, "\u0066"},
+	0x1D690: {true, "\u0067"},
+	0x1D691: {true, "\u0068"},
+	0x1D692: {true, "\u0069"},
+	0x1D693: {true, "\u006A"},
+	0x1D694: {true, "\u006B"},
+	0x1D695: {true, "\u006C"},
+	0x1D696: {true, "\u006D"},
+	0x1D697: {true, "\u006E"},
+	0x1D698: {true, "\u006F"},
+	0x1D699: {true, "\u0070"},
+	0x1D69A: {true, "\u0071"},
+	0x1D69B: {true, "\u0072"},
+	0x1D69C: {true, "\u0073"},
+	0x1D69D: {true, "\u0074"},
+	0x1D69E: {true, "\u0075"},
+	0x1D69F: {true, "\u0076"},
+	0x1D6A0: {true, "\u0077"},
+	0x1D6A1: {true, "\u0078"},
+	0x1D6A2: {true, "\u0079"},
+	0x1D6A3: {true, "\u007A"},
+	0x1D6A4: {true, "\u0131"},
+	0x1D6A5: {true, "\u0237"},
+	0x1D6A8: {true, "\u0391"},
+	0x1D6A9: {true, "\u0392"},
+	0x1D6AA: {true, "\u0393"},
+	0x1D6AB: {true, "\u0394"},
+	0x1D6AC: {true, "\u0395"},
+	0x1D6AD: {true, "\u0396"},
+	0x1D6AE: {true, "\u0397"},
+	0x1D6AF: {true, "\u0398"},
+	0x1D6B0: {true, "\u0399"},
+	0x1D6B1: {true, "\u039A"},
+	0x1D6B2: {true, "\u039B"},
+	0x1D6B3: {true, "\u039C"},
+	0x1D6B4: {true, "\u039D"},
+	0x1D6B5: {true, "\u039E"},
+	0x1D6B6: {true, "\u039F"},
+	0x1D6B7: {true, "\u03A0"},
+	0x1D6B8: {true, "\u03A1"},
+	0x1D6B9: {true, "\u0398"},
+	0x1D6BA: {true, "\u03A3"},
+	0x1D6BB: {true, "\u03A4"},
+	0x1D6BC: {true, "\u03A5"},
+	0x1D6BD: {true, "\u03A6"},
+	0x1D6BE: {true, "\u03A7"},
+	0x1D6BF: {true, "\u03A8"},
+	0x1D6C0: {true, "\u03A9"},
+	0x1D6C1: {true, "\u2207"},
+	0x1D6C2: {true, "\u03B1"},
+	0x1D6C3: {true, "\u03B2"},
+	0x1D6C4: {true, "\u03B3"},
+	0x1D6C5: {true, "\u03B4"},
+	0x1D6C6: {true, "\u03B5"},
+	0x1D6C7: {true, "\u03B6"},
+	0x1D6C8: {true, "\u03B7"},
+	0x1D6C9: {true, "\u03B8"},
+	0x1D6CA: {true, "\u03B9"},
+	0x1D6CB: {true, "\u03BA"},
+	0x1D6CC: {true, "\u03BB"},
+	0x1D6CD: {true, "\u03BC"},
+	0x1D6CE: {true, "\u03BD"},
+	0x1D6CF: {true, "\u03BE"},
+	0x1D6D0: {true, "\u03BF"},
+	0x1D6D1: {true, "\u03C0"},
+	0x1D6D2: {true, "\u03C1"},
+	0x1D6D3: {true, "\u03C2"},
+	0x1D6D4: {true, "\u03C3"},
+	0x1D6D5: {true, "\u03C4"},
+	0x1D6D6: {true, "\u03C5"},
+	0x1D6D7: {true, "\u03C6"},
+	0x1D6D8: {true, "\u03C7"},
+	0x1D6D9: {true, "\u03C8"},
+	0x1D6DA: {true, "\u03C9"},
+	0x1D6DB: {true, "\u2202"},
+	0x1D6DC: {true, "\u03B5"},
+	0x1D6DD: {true, "\u03B8"},
+	0x1D6DE: {true, "\u03BA"},
+	0x1D6DF: {true, "\u03C6"},
+	0x1D6E0: {true, "\u03C1"},
+	0x1D6E1: {true, "\u03C0"},
+	0x1D6E2: {true, "\u0391"},
+	0x1D6E3: {true, "\u0392"},
+	0x1D6E4: {true, "\u0393"},
+	0x1D6E5: {true, "\u0394"},
+	0x1D6E6: {true, "\u0395"},
+	0x1D6E7: {true, "\u0396"},
+	0x1D6E8: {true, "\u0397"},
+	0x1D6E9: {true, "\u0398"},
+	0x1D6EA: {true, "\u0399"},
+	0x1D6EB: {true, "\u039A"},
+	0x1D6EC: {true, "\u039B"},
+	0x1D6ED: {true, "\u039C"},
+	0x1D6EE: {true, "\u039D"},
+	0x1D6EF: {true, "\u039E"},
+	0x1D6F0: {true, "\u039F"},
+	0x1D6F1: {true, "\u03A0"},
+	0x1D6F2: {true, "\u03A1"},
+	0x1D6F3: {true, "\u0398"},
+	0x1D6F4: {true, "\u03A3"},
+	0x1D6F5: {true, "\u03A4"},
+	0x1D6F6: {true, "\u03A5"},
+	0x1D6F7: {true, "\u03A6"},
+	0x1D6F8: {true, "\u03A7"},
+	0x1D6F9: {true, "\u03A8"},
+	0x1D6FA: {true, "\u03A9"},
+	0x1D6FB: {true, "\u2207"},
+	0x1D6FC: {true, "\u03B1"},
+	0x1D6FD: {true, "\u03B2"},
+	0x1D6FE: {true, "\u03B3"},
+	0x1D6FF: {true, "\u03B4"},
+	0x1D700: {true, "\u03B5"},
+	0x1D701: {true, "\u03B6"},
+	0x1D702: {true, "\u03B7"},
+	0x1D703: {true, "\u03B8"},
+	0x1D704: {true, "\u03B9"},
+	0x1D705: {true, "\u03BA"},
+	0x1D706: {true, "\u03BB"},
+	0x1D707: {true, "\u03BC"},
+	0x1D708: {true, "\u03BD"},
+	0x1D709: {true, "\u03BE"},
+	0x1D70A: {true, "\u03BF"},
+	0x1D70B: {true, "\u03C0"},
+	0x1D70C: {true, "\u03C1"},
+	0x1D70D: {true, "\u03C2"},
+	0x1D70E: {true, "\u03C3"},
+	0x1D70F: {true, "\u03C4"},
+	0x1D710: {true, "\u03C5"},
+	0x1D711: {true, "\u03C6"},
+	0x1D712: {true, "\u03C7"},
+	0x1D713: {true, "\u03C8"},
+	0x1D714: {true, "\u03C9"},
+	0x1D715: {true, "\u2202"},
+	0x1D716: {true, "\u03B5"},
+	0x1D717: {true, "\u03B8"},
+	0x1D718: {true, "\u03BA"},
+	0x1D719: {true, "\u03C6"},
+	0x1D71A: {true, "\u03C1"},
+	0x1D71B: {true, "\u03C0"},
+	0x1D71C: {true, "\u0391"},
+	0x1D71D: {true, "\u0392"},
+	0x1D71E: {true, "\u0393"},
+	0x1D71F: {true, "\u0394"},
+	0x1D720: {true, "\u0395"},
+	0x1D721: {true, "\u0396"},
+	0x1D722: {true, "\u0397"},
+	0x1D723: {true, "\u0398"},
+	0x1D724: {true, "\u0399"},
+	0x1D725: {true, "\u039A"},
+	0x1D726: {true, "\u039B"},
+	0x1D727: {true, "\u039C"},
+	0x1D728: {true, "\u039D"},
+	0x1D729: {true, "\u039E"},
+	0x1D72A: {true, "\u039F"},
+	0x1D72B: {true, "\u03A0"},
+	0x1D72C: {true, "\u03A1"},
+	0x1D72D: {true, "\u0398"},
+	0x1D72E: {true, "\u03A3"},
+	0x1D72F: {true, "\u03A4"},
+	0x1D730: {true, "\u03A5"},
+	0x1D731: {true, "\u03A6"},
+	0x1D732: {true, "\u03A7"},
+	0x1D733: {true, "\u03A8"},
+	0x1D734: {true, "\u03A9"},
+	0x1D735: {true, "\u2207"},
+	0x1D736: {true, "\u03B1"},
+	0x1D737: {true, "\u03B2"},
+	0x1D738: {true, "\u03B3"},
+	0x1D739: {true, "\u03B4"},
+	0x1D73A: {true, "\u03B5"},
+	0x1D73B: {true, "\u03B6"},
+	0x1D73C: {true, "\u03B7"},
+	0x1D73D: {true, "\u03B8"},
+	0x1D73E: {true, "\u03B9"},
+	0x1D73F: {true, "\u03BA"},
+	0x1D740: {true, "\u03BB"},
+	0x1D741: {true, "\u03BC"},
+	0x1D742: {true, "\u03BD"},
+	0x1D743: {true, "\u03BE"},
+	0x1D744: {true, "\u03BF"},
+	0x1D745: {true, "\u03C0"},
+	0x1D746: {true, "\u03C1"},
+	0x1D747: {true, "\u03C2"},
+	0x1D748: {true, "\u03C3"},
+	0x1D749: {true, "\u03C4"},
+	0x1D74A: {true, "\u03C5"},
+	0x1D74B: {true, "\u03C6"},
+	0x1D74C: {true, "\u03C7"},
+	0x1D74D: {true, "\u03C8"},
+	0x1D74E: {true, "\u03C9"},
+	0x1D74F: {true, "\u2202"},
+	0x1D750: {true, "\u03B5"},
+	0x1D751: {true, "\u03B8"},
+	0x1D752: {true, "\u03BA"},
+	0x1D753: {true, "\u03C6"},
+	0x1D754: {true, "\u03C1"},
+	0x1D755: {true, "\u03C0"},
+	0x1D756: {true, "\u0391"},
+	0x1D757: {true, "\u0392"},
+	0x1D758: {true, "\u0393"},
+	0x1D759: {true, "\u0394"},
+	0x1D75A: {true, "\u0395"},
+	0x1D75B: {true, "\u0396"},
+	0x1D75C: {true, "\u0397"},
+	0x1D75D: {true, "\u0398"},
+	0x1D75E: {true, "\u0399"},
+	0x1D75F: {true, "\u039A"},
+	0x1D760: {true, "\u039B"},
+	0x1D761: {true, "\u039C"},
+	0x1D762: {true, "\u039D"},
+	0x1D763: {true, "\u039E"},
+	0x1D764: {true, "\u039F"},
+	0x1D765: {true, "\u03A0"},
+	0x1D766: {true, "\u03A1"},
+	0x1D767: {true, "\u0398"},
+	0x1D768: {true, "\u03A3"},
+	0x1D769: {true, "\u03A4"},
+	0x1D76A: {true, "\u03A5"},
+	0x1D76B: {true, "\u03A6"},
+	0x1D76C: {true, "\u03A7"},
+	0x1D76D: {true, "\u03A8"},
+	0x1D76E: {true, "\u03A9"},
+	0x1D76F: {true, "\u2207"},
+	0x1D770: {true, "\u03B1"},
+	0x1D771: {true, "\u03B2"},
+	0x1D772: {true, "\u03B3"},
+	0x1D773: {true, "\u03B4"},
+	0x1D774: {true, "\u03B5"},
+	0x1D775: {true, "\u03B6"},
+	0x1D776: {true, "\u03B7"},
+	0x1D777: {true, "\u03B8"},
+	0x1D778: {true, "\u03B9"},
+	0x1D779: {true, "\u03BA"},
+	0x1D77A: {true, "\u03BB"},
+	0x1D77B: {true, "\u03BC"},
+	0x1D77C: {true, "\u03BD"},
+	0x1D77D: {true, "\u03BE"},
+	0x1D77E: {true, "\u03BF"},
+	0x1D77F: {true, "\u03C0"},
+	0x1D780: {true, "\u03C1"},
+	0x1D781: {true, "\u03C2"},
+	0x1D782: {true, "\u03C3"},
+	0x1D783: {true, "\u03C4"},
+	0x1D784: {true, "\u03C5"},
+	0x1D785: {true, "\u03C6"},
+	0x1D786: {true, "\u03C7"},
+	0x1D787: {true, "\u03C8"},
+	0x1D788: {true, "\u03C9"},
+	0x1D789: {true, "\u2202"},
+	0x1D78A: {true, "\u03B5"},
+	0x1D78B: {true, "\u03B8"},
+	0x1D78C: {true, "\u03BA"},
+	0x1D78D: {true, "\u03C6"},
+	0x1D78E: {true, "\u03C1"},
+	0x1D78F: {true, "\u03C0"},
+	0x1D790: {true, "\u0391"},
+	0x1D791: {true, "\u0392"},
+	0x1D792: {true, "\u0393"},
+	0x1D793: {true, "\u0394"},
+	0x1D794: {true, "\u0395"},
+	0x1D795: {true, "\u0396"},
+	0x1D796: {true, "\u0397"},
+	0x1D797: {true, "\u0398"},
+	0x1D798: {true, "\u0399"},
+	0x1D799: {true, "\u039A"},
+	0x1D79A: {true, "\u039B"},
+	0x1D79B: {true, "\u039C"},
+	0x1D79C: {true, "\u039D"},
+	0x1D79D: {true, "\u039E"},
+	0x1D79E: {true, "\u039F"},
+	0x1D79F: {true, "\u03A0"},
+	0x1D7A0: {true, "\u03A1"},
+	0x1D7A1: {true, "\u0398"},
+	0x1D7A2: {true, "\u03A3"},
+	0x1D7A3: {true, "\u03A4"},
+	0x1D7A4: {true, "\u03A5"},
+	0x1D7A5: {true, "\u03A6"},
+	0x1D7A6: {true, "\u03A7"},
+	0x1D7A7: {true, "\u03A8"},
+	0x1D7A8: {true, "\u03A9"},
+	0x1D7A9: {true, "\u2207"},
+	0x1D7AA: {true, "\u03B1"},
+	0x1D7AB: {true, "\u03B2"},
+	0x1D7AC: {true, "\u03B3"},
+	0x1D7AD: {true, "\u03B4"},
+	0x1D7AE: {true, "\u03B5"},
+	0x1D7AF: {true, "\u03B6"},
+	0x1D7B0: {true, "\u03B7"},
+	0x1D7B1: {true, "\u03B8"},
+	0x1D7B2: {true, "\u03B9"},
+	0x1D7B3: {true, "\u03BA"},
+	0x1D7B4: {true, "\u03BB"},
+	0x1D7B5: {true, "\u03BC"},
+	0x1D7B6: {true, "\u03BD"},
+	0x1D7B7: {true, "\u03BE"},
+	0x1D7B8: {true, "\u03BF"},
+	0x1D7B9: {true, "\u03C0"},
+	0x1D7BA: {true, "\u03C1"},
+	0x1D7BB: {true, "\u03C2"},
+	0x1D7BC: {true, "\u03C3"},
+	0x1D7BD: {true, "\u03C4"},
+	0x1D7BE: {true, "\u03C5"},
+	0x1D7BF: {true, "\u03C6"},
+	0x1D7C0: {true, "\u03C7"},
+	0x1D7C1: {true, "\u03C8"},
+	0x1D7C2: {true, "\u03C9"},
+	0x1D7C3: {true, "\u2202"},
+	0x1D7C4: {true, "\u03B5"},
+	0x1D7C5: {true, "\u03B8"},
+	0x1D7C6: {true, "\u03BA"},
+	0x1D7C7: {true, "\u03C6"},
+	0x1D7C8: {true, "\u03C1"},
+	0x1D7C9: {true, "\u03C0"},
+	0x1D7CA: {true, "\u03DC"},
+	0x1D7CB: {true, "\u03DD"},
+	0x1D7CE: {true, "\u0030"},
+	0x1D7CF: {true, "\u0031"},
+	0x1D7D0: {true, "\u0032"},
+	0x1D7D1: {true, "\u0033"},
+	0x1D7D2: {true, "\u0034"},
+	0x1D7D3: {true, "\u0035"},
+	0x1D7D4: {true, "\u0036"},
+	0x1D7D5: {true, "\u0037"},
+	0x1D7D6: {true, "\u0038"},
+	0x1D7D7: {true, "\u0039"},
+	0x1D7D8: {true, "\u0030"},
+	0x1D7D9: {true, "\u0031"},
+	0x1D7DA: {true, "\u0032"},
+	0x1D7DB: {true, "\u0033"},
+	0x1D7DC: {true, "\u0034"},
+	0x1D7DD: {true, "\u0035"},
+	0x1D7DE: {true, "\u0036"},
+	0x1D7DF: {true, "\u0037"},
+	0x1D7E0: {true, "\u0038"},
+	0x1D7E1: {true, "\u0039"},
+	0x1D7E2: {true, "\u0030"},
+	0x1D7E3: {true, "\u0031"},
+	0x1D7E4: {true, "\u0032"},
+	0x1D7E5: {true, "\u0033"},
+	0x1D7E6: {true, "\u0034"},
+	0x1D7E7: {true, "\u0035"},
+	0x1D7E8: {true, "\u0036"},
+	0x1D7E9: {true, "\u0037"},
+	0x1D7EA: {true, "\u0038"},
+	0x1D7EB: {true, "\u0039"},
+	0x1D7EC: {true, "\u0030"},
+	0x1D7ED: {true, "\u0031"},
+	0x1D7EE: {true, "\u0032"},
+	0x1D7EF: {true, "\u0033"},
+	0x1D7F0: {true, "\u0034"},
+	0x1D7F1: {true, "\u0035"},
+	0x1D7F2: {true, "\u0036"},
+	0x1D7F3: {true, "\u0037"},
+	0x1D7F4: {true, "\u0038"},
+	0x1D7F5: {true, "\u0039"},
+	0x1D7F6: {true, "\u0030"},
+	0x1D7F7: {true, "\u0031"},
+	0x1D7F8: {true, "\u0032"},
+	0x1D7F9: {true, "\u0033"},
+	0x1D7FA: {true, "\u0034"},
+	0x1D7FB: {true, "\u0035"},
+	0x1D7FC: {true, "\u0036"},
+	0x1D7FD: {true, "\u0037"},
+	0x1D7FE: {true, "\u0038"},
+	0x1D7FF: {true, "\u0039"},
+	0x1E030: {true, "\u0430"},
+	0x1E031: {true, "\u0431"},
+	0x1E032: {true, "\u0432"},
+	0x1E033: {true, "\u0433"},
+	0x1E034: {true, "\u0434"},
+	0x1E035: {true, "\u0435"},
+	0x1E036: {true, "\u0436"},
+	0x1E037: {true, "\u0437"},
+	0x1E038: {true, "\u0438"},
+	0x1E039: {true, "\u043A"},
+	0x1E03A: {true, "\u043B"},
+	0x1E03B: {true, "\u043C"},
+	0x1E03C: {true, "\u043E"},
+	0x1E03D: {true, "\u043F"},
+	0x1E03E: {true, "\u0440"},
+	0x1E03F: {true, "\u0441"},
+	0x1E040: {true, "\u0442"},
+	0x1E041: {true, "\u0443"},
+	0x1E042: {true, "\u0444"},
+	0x1E043: {true, "\u0445"},
+	0x1E044: {true, "\u0446"},
+	0x1E045: {true, "\u0447"},
+	0x1E046: {true, "\u0448"},
+	0x1E047: {true, "\u044B"},
+	0x1E048: {true, "\u044D"},
+	0x1E049: {true, "\u044E"},
+	0x1E04A: {true, "\uA689"},
+	0x1E04B: {true, "\u04D9"},
+	0x1E04C: {true, "\u0456"},
+	0x1E04D: {true, "\u0458"},
+	0x1E04E: {true, "\u04E9"},
+	0x1E04F: {true, "\u04AF"},
+	0x1E050: {true, "\u04CF"},
+	0x1E051: {true, "\u0430"},
+	0x1E052: {true, "\u0431"},
+	0x1E053: {true, "\u0432"},
+	0x1E054: {true, "\u0433"},
+	0x1E055: {true, "\u0434"},
+	0x1E056: {true, "\u0435"},
+	0x1E057: {true, "\u0436"},
+	0x1E058: {true, "\u0437"},
+	0x1E059: {true, "\u0438"},
+	0x1E05A: {true, "\u043A"},
+	0x1E05B: {true, "\u043B"},
+	0x1E05C: {true, "\u043E"},
+	0x1E05D: {true, "\u043F"},
+	0x1E05E: {true, "\u0441"},
+	0x1E05F: {true, "\u0443"},
+	0x1E060: {true, "\u0444"},
+	0x1E061: {true, "\u0445"},
+	0x1E062: {true, "\u0446"},
+	0x1E063: {true, "\u0447"},
+	0x1E064: {true, "\u0448"},
+	0x1E065: {true, "\u044A"},
+	0x1E066: {true, "\u044B"},
+	0x1E067: {true, "\u0491"},
+	0x1E068: {true, "\u0456"},
+	0x1E069: {true, "\u0455"},
+	0x1E06A: {true, "\u045F"},
+	0x1E06B: {true, "\u04AB"},
+	0x1E06C: {true, "\uA651"},
+	0x1E06D: {true, "\u04B1"},
+	0x1EE00: {true, "\u0627"},
+	0x1EE01: {true, "\u0628"},
+	0x1EE02: {true, "\u062C"},
+	0x1EE03: {true, "\u062F"},
+	0x1EE05: {true, "\u0648"},
+	0x1EE06: {true, "\u0632"},
+	0x1EE07: {true, "\u062D"},
+	0x1EE08: {true, "\u0637"},
+	0x1EE09: {true, "\u064A"},
+	0x1EE0A: {true, "\u0643"},
+	0x1EE0B: {true, "\u0644"},
+	0x1EE0C: {true, "\u0645"},
+	0x1EE0D: {true, "\u0646"},
+	0x1EE0E: {true, "\u0633"},
+	0x1EE0F: {true, "\u0639"},
+	0x1EE10: {true, "\u0641"},
+	0x1EE11: {true, "\u0635"},
+	0x1EE12: {true, "\u0642"},
+	0x1EE13: {true, "\u0631"},
+	0x1EE14: {true, "\u0634"},
+	0x1EE15: {true, "\u062A"},
+	0x1EE16: {true, "\u062B"},
+	0x1EE17: {true, "\u062E"},
+	0x1EE18: {true, "\u0630"},
+	0x1EE19: {true, "\u0636"},
+	0x1EE1A: {true, "\u0638"},
+	0x1EE1B: {true, "\u063A"},
+	0x1EE1C: {true, "\u066E"},
+	0x1EE1D: {true, "\u06BA"},
+	0x1EE1E: {true, "\u06A1"},
+	0x1EE1F: {true, "\u066F"},
+	0x1EE21: {true, "\u0628"},
+	0x1EE22: {true, "\u062C"},
+	0x1EE24: {true, "\u0647"},
+	0x1EE27: {true, "\u062D"},
+	0x1EE29: {true, "\u064A"},
+	0x1EE2A: {true, "\u0643"},
+	0x1EE2B: {true, "\u0644"},
+	0x1EE2C: {true, "\u0645"},
+	0x1EE2D: {true, "\u0646"},
+	0x1EE2E: {true, "\u0633"},
+	0x1EE2F: {true, "\u0639"},
+	0x1EE30: {true, "\u0641"},
+	0x1EE31: {true, "\u0635"},
+	0x1EE32: {true, "\u0642"},
+	0x1EE34: {true, "\u0634"},
+	0x1EE35: {true, "\u062A"},
+	0x1EE36: {true, "\u062B"},
+	0x1EE37: {true, "\u062E"},
+	0x1EE39: {true, "\u0636"},
+	0x1EE3B: {true, "\u063A"},
+	0x1EE42: {true, "\u062C"},
+	0x1EE47: {true, "\u062D"},
+	0x1EE49: {true, "\u064A"},
+	0x1EE4B: {true, "\u0644"},
+	0x1EE4D: {true, "\u0646"},
+	0x1EE4E: {true, "\u0633"},
+	0x1EE4F: {true, "\u0639"},
+	0x1EE51: {true, "\u0635"},
+	0x1EE52: {true, "\u0642"},
+	0x1EE54: {true, "\u0634"},
+	0x1EE57: {true, "\u062E"},
+	0x1EE59: {true, "\u0636"},
+	0x1EE5B: {true, "\u063A"},
+	0x1EE5D: {true, "\u06BA"},
+	0x1EE5F: {true, "\u066F"},
+	0x1EE61: {true, "\u0628"},
+	0x1EE62: {true, "\u062C"},
+	0x1EE64: {true, "\u0647"},
+	0x1EE67: {true, "\u062D"},
+	0x1EE68: {true, "\u0637"},
+	0x1EE69: {true, "\u064A"},
+	0x1EE6A: {true, "\u0643"},
+	0x1EE6C: {true, "\u0645"},
+	0x1EE6D: {true, "\u0646"},
+	0x1EE6E: {true, "\u0633"},
+	0x1EE6F: {true, "\u0639"},
+	0x1EE70: {true, "\u0641"},
+	0x1EE71: {true, "\u0635"},
+	0x1EE72: {true, "\u0642"},
+	0x1EE74: {true, "\u0634"},
+	0x1EE75: {true, "\u062A"},
+	0x1EE76: {true, "\u062B"},
+	0x1EE77: {true, "\u062E"},
+	0x1EE79: {true, "\u0636"},
+	0x1EE7A: {true, "\u0638"},
+	0x1EE7B: {true, "\u063A"},
+	0x1EE7C: {true, "\u066E"},
+	0x1EE7E: {true, "\u06A1"},
+	0x1EE80: {true, "\u0627"},
+	0x1EE81: {true, "\u0628"},
+	0x1EE82: {true, "\u062C"},
+	0x1EE83: {true, "\u062F"},
+	0x1EE84: {true, "\u0647"},
+	0x1EE85: {true, "\u0648"},
+	0x1EE86: {true, "\u0632"},
+	0x1EE87: {true, "\u062D"},
+	0x1EE88: {true, "\u0637"},
+	0x1EE89: {true, "\u064A"},
+	0x1EE8B: {true, "\u0644"},
+	0x1EE8C: {true, "\u0645"},
+	0x1EE8D: {true, "\u0646"},
+	0x1EE8E: {true, "\u0633"},
+	0x1EE8F: {true, "\u0639"},
+	0x1EE90: {true, "\u0641"},
+	0x1EE91: {true, "\u0635"},
+	0x1EE92: {true, "\u0642"},
+	0x1EE93: {true, "\u0631"},
+	0x1EE94: {true, "\u0634"},
+	0x1EE95: {true, "\u062A"},
+	0x1EE96: {true, "\u062B"},
+	0x1EE97: {true, "\u062E"},
+	0x1EE98: {true, "\u0630"},
+	0x1EE99: {true, "\u0636"},
+	0x1EE9A: {true, "\u0638"},
+	0x1EE9B: {true, "\u063A"},
+	0x1EEA1: {true, "\u0628"},
+	0x1EEA2: {true, "\u062C"},
+	0x1EEA3: {true, "\u062F"},
+	0x1EEA5: {true, "\u0648"},
+	0x1EEA6: {true, "\u0632"},
+	0x1EEA7: {true, "\u062D"},
+	0x1EEA8: {true, "\u0637"},
+	0x1EEA9: {true, "\u064A"},
+	0x1EEAB: {true, "\u0644"},
+	0x1EEAC: {true, "\u0645"},
+	0x1EEAD: {true, "\u0646"},
+	0x1EEAE: {true, "\u0633"},
+	0x1EEAF: {true, "\u0639"},
+	0x1EEB0: {true, "\u0641"},
+	0x1EEB1: {true, "\u0635"},
+	0x1EEB2: {true, "\u0642"},
+	0x1EEB3: {true, "\u0631"},
+	0x1EEB4: {true, "\u0634"},
+	0x1EEB5: {true, "\u062A"},
+	0x1EEB6: {true, "\u062B"},
+	0x1EEB7: {true, "\u062E"},
+	0x1EEB8: {true, "\u0630"},
+	0x1EEB9: {true, "\u0636"},
+	0x1EEBA: {true, "\u0638"},
+	0x1EEBB: {true, "\u063A"},
+	0x1F100: {true, "\u0030\u002E"},
+	0x1F101: {true, "\u0030\u002C"},
+	0x1F102: {true, "\u0031\u002C"},
+	0x1F103: {true, "\u0032\u002C"},
+	0x1F104: {true, "\u0033\u002C"},
+	0x1F105: {true, "\u0034\u002C"},
+	0x1F106: {true, "\u0035\u002C"},
+	0x1F107: {true, "\u0036\u002C"},
+	0x1F108: {true, "\u0037\u002C"},
+	0x1F109: {true, "\u0038\u002C"},
+	0x1F10A: {true, "\u0039\u002C"},
+	0x1F110: {true, "\u0028\u0041\u0029"},
+	0x1F111: {true, "\u0028\u0042\u0029"},
+	0x1F112: {true, "\u0028\u0043\u0029"},
+	0x1F113: {true, "\u0028\u0044\u0029"},
+	0x1F114: {true, "\u0028\u0045\u0029"},
+	0x1F115: {true, "\u0028\u0046\u0029"},
+	0x1F116: {true, "\u0028\u0047\u0029"},
+	0x1F117: {true, "\u0028\u0048\u0029"},
+	0x1F118: {true, "\u0028\u0049\u0029"},
+	0x1F119: {true, "\u0028\u004A\u0029"},
+	0x1F11A: {true, "\u0028\u004B\u0029"},
+	0x1F11B: {true, "\u0028\u004C\u0029"},
+	0x1F11C: {true, "\u0028\u004D\u0029"},
+	0x1F11D: {true, "\u0028\u004E\u0029"},
+	0x1F11E: {true, "\u0028\u004F\u0029"},
+	0x1F11F: {true, "\u0028\u0050\u0029"},
+	0x1F120: {true, "\u0028\u0051\u0029"},
+	0x1F121: {true, "\u0028\u0052\u0029"},
+	0x1F122: {true, "\u0028\u0053\u0029"},
+	0x1F123: {true, "\u0028\u0054\u0029"},
+	0x1F124: {true, "\u0028\u0055\u0029"},
+	0x1F125: {true, "\u0028\u0056\u0029"},
+	0x1F126: {true, "\u0028\u0057\u0029"},
+	0x1F127: {true, "\u0028\u0058\u0029"},
+	0x1F128: {true, "\u0028\u0059\u0029"},
+	0x1F129: {true, "\u0028\u005A\u0029"},
+	0x1F12A: {true, "\u3014\u0053\u3015"},
+	0x1F12B: {true, "\u0043"},
+	0x1F12C: {true, "\u0052"},
+	0x1F12D: {true, "\u0043\u0044"},
+	0x1F12E: {true, "\u0057\u005A"},
+	0x1F130: {true, "\u0041"},
+	0x1F131: {true, "\u0042"},
+	0x1F132: {true, "\u0043"},
+	0x1F133: {true, "\u0044"},
+	0x1F134: {true, "\u0045"},
+	0x1F135: {true, "\u0046"},
+	0x1F136: {true, "\u0047"},
+	0x1F137: {true, "\u0048"},
+	0x1F138: {true, "\u0049"},
+	0x1F139: {true, "\u004A"},
+	0x1F13A: {true, "\u004B"},
+	0x1F13B: {true, "\u004C"},
+	0x1F13C: {true, "\u004D"},
+	0x1F13D: {true, "\u004E"},
+	0x1F13E: {true, "\u004F"},
+	0x1F13F: {true, "\u0050"},
+	0x1F140: {true, "\u0051"},
+	0x1F141: {true, "\u0052"},
+	0x1F142: {true, "\u0053"},
+	0x1F143: {true, "\u0054"},
+	0x1F144: {true, "\u0055"},
+	0x1F145: {true, "\u0056"},
+	0x1F146: {true, "\u0057"},
+	0x1F147: {true, "\u0058"},
+	0x1F148: {true, "\u0059"},
+	0x1F149: {true, "\u005A"},
+	0x1F14A: {true, "\u0048\u0056"},
+	0x1F14B: {true, "\u004D\u0056"},
+	0x1F14C: {true, "\u0053\u0044"},
+	0x1F14D: {true, "\u0053\u0053"},
+	0x1F14E: {true, "\u0050\u0050\u0056"},
+	0x1F14F: {true, "\u0057\u0043"},
+	0x1F16A: {true, "\u004D\u0043"},
+	0x1F16B: {true, "\u004D\u0044"},
+	0x1F16C: {true, "\u004D\u0052"},
+	0x1F190: {true, "\u0044\u004A"},
+	0x1F200: {true, "\u307B\u304B"},
+	0x1F201: {true, "\u30B3\u30B3"},
+	0x1F202: {true, "\u30B5"},
+	0x1F210: {true, "\u624B"},
+	0x1F211: {true, "\u5B57"},
+	0x1F212: {true, "\u53CC"},
+	0x1F213: {true, "\u30C6\u3099"},
+	0x1F214: {true, "\u4E8C"},
+	0x1F215: {true, "\u591A"},
+	0x1F216: {true, "\u89E3"},
+	0x1F217: {true, "\u5929"},
+	0x1F218: {true, "\u4EA4"},
+	0x1F219: {true, "\u6620"},
+	0x1F21A: {true, "\u7121"},
+	0x1F21B: {true, "\u6599"},
+	0x1F21C: {true, "\u524D"},
+	0x1F21D: {true, "\u5F8C"},
+	0x1F21E: {true, "\u518D"},
+	0x1F21F: {true, "\u65B0"},
+	0x1F220: {true, "\u521D"},
+	0x1F221: {true, "\u7D42"},
+	0x1F222: {true, "\u751F"},
+	0x1F223: {true, "\u8CA9"},
+	0x1F224: {true, "\u58F0"},
+	0x1F225: {true, "\u5439"},
+	0x1F226: {true, "\u6F14"},
+	0x1F227: {true, "\u6295"},
+	0x1F228: {true, "\u6355"},
+	0x1F229: {true, "\u4E00"},
+	0x1F22A: {true, "\u4E09"},
+	0x1F22B: {true, "\u904A"},
+	0x1F22C: {true, "\u5DE6"},
+	0x1F22D: {true, "\u4E2D"},
+	0x1F22E: {true, "\u53F3"},
+	0x1F22F: {true, "\u6307"},
+	0x1F230: {true, "\u8D70"},
+	0x1F231: {true, "\u6253"},
+	0x1F232: {true, "\u7981"},
+	0x1F233: {true, "\u7A7A"},
+	0x1F234: {true, "\u5408"},
+	0x1F235: {true, "\u6E80"},
+	0x1F236: {true, "\u6709"},
+	0x1F237: {true, "\u6708"},
+	0x1F238: {true, "\u7533"},
+	0x1F239: {true, "\u5272"},
+	0x1F23A: {true, "\u55B6"},
+	0x1F23B: {true, "\u914D"},
+	0x1F240: {true, "\u3014\u672C\u3015"},
+	0x1F241: {true, "\u3014\u4E09\u3015"},
+	0x1F242: {true, "\u3014\u4E8C\u3015"},
+	0x1F243: {true, "\u3014\u5B89\u3015"},
+	0x1F244: {true, "\u3014\u70B9\u3015"},
+	0x1F245: {true, "\u3014\u6253\u3015"},
+	0x1F246: {true, "\u3014\u76D7\u3015"},
+	0x1F247: {true, "\u3014\u52DD\u3015"},
+	0x1F248: {true, "\u3014\u6557\u3015"},
+	0x1F250: {true, "\u5F97"},
+	0x1F251: {true, "\u53EF"},
+	0x1FBF0: {true, "\u0030"},
+	0x1FBF1: {true, "\u0031"},
+	0x1FBF2: {true, "\u0032"},
+	0x1FBF3: {true, "\u0033"},
+	0x1FBF4: {true, "\u0034"},
+	0x1FBF5: {true, "\u0035"},
+	0x1FBF6: {true, "\u0036"},
+	0x1FBF7: {true, "\u0037"},
+	0x1FBF8: {true, "\u0038"},
+	0x1FBF9: {true, "\u0039"},
+	0x2F800: {false, "\u4E3D"},
+	0x2F801: {false, "\u4E38"},
+	0x2F802: {false, "\u4E41"},
+	0x2F803: {false, "\U00020122"},
+	0x2F804: {false, "\u4F60"},
+	0x2F805: {false, "\u4FAE"},
+	0x2F806: {false, "\u4FBB"},
+	0x2F807: {false, "\u5002"},
+	0x2F808: {false, "\u507A"},
+	0x2F809: {false, "\u5099"},
+	0x2F80A: {false, "\u50E7"},
+	0x2F80B: {false, "\u50CF"},
+	0x2F80C: {false, "\u349E"},
+	0x2F80D: {false, "\U0002063A"},
+	0x2F80E: {false, "\u514D"},
+	0x2F80F: {false, "\u5154"},
+	0x2F810: {false, "\u5164"},
+	0x2F811: {false, "\u5177"},
+	0x2F812: {false, "\U0002051C"},
+	0x2F813: {false, "\u34B9"},
+	0x2F814: {false, "\u5167"},
+	0x2F815: {false, "\u518D"},
+	0x2F816: {false, "\U0002054B"},
+	0x2F817: {false, "\u5197"},
+	0x2F818: {false, "\u51A4"},
+	0x2F819: {false, "\u4ECC"},
+	0x2F81A: {false, "\u51AC"},
+	0x2F81B: {false, "\u51B5"},
+	0x2F81C: {false, "\U000291DF"},
+	0x2F81D: {false, "\u51F5"},
+	0x2F81E: {false, "\u5203"},
+	0x2F81F: {false, "\u34DF"},
+	0x2F820: {false, "\u523B"},
+	0x2F821: {false, "\u5246"},
+	0x2F822: {false, "\u5272"},
+	0x2F823: {false, "\u5277"},
+	0x2F824: {false, "\u3515"},
+	0x2F825: {false, "\u52C7"},
+	0x2F826: {false, "\u52C9"},
+	0x2F827: {false, "\u52E4"},
+	0x2F828: {false, "\u52FA"},
+	0x2F829: {false, "\u5305"},
+	0x2F82A: {false, "\u5306"},
+	0x2F82B: {false, "\u5317"},
+	0x2F82C: {false, "\u5349"},
+	0x2F82D: {false, "\u5351"},
+	0x2F82E: {false, "\u535A"},
+	0x2F82F: {false, "\u5373"},
+	0x2F830: {false, "\u537D"},
+	0x2F831: {false, "\u537F"},
+	0x2F832: {false, "\u537F"},
+	0x2F833: {false, "\u537F"},
+	0x2F834: {false, "\U00020A2C"},
+	0x2F835: {false, "\u7070"},
+	0x2F836: {false, "\u53CA"},
+	0x2F837: {false, "\u53DF"},
+	0x2F838: {false, "\U00020B63"},
+	0x2F839: {false, "\u53EB"},
+	0x2F83A: {false, "\u53F1"},
+	0x2F83B: {false, "\u5406"},
+	0x2F83C: {false, "\u549E"},
+	0x2F83D: {false, "\u5438"},
+	0x2F83E: {false, "\u5448"},
+	0x2F83F: {false, "\u5468"},
+	0x2F840: {false, "\u54A2"},
+	0x2F841: {false, "\u54F6"},
+	0x2F842: {false, "\u5510"},
+	0x2F843: {false, "\u5553"},
+	0x2F844: {false, "\u5563"},
+	0x2F845: {false, "\u5584"},
+	0x2F846: {false, "\u5584"},
+	0x2F847: {false, "\u5599"},
+	0x2F848: {false, "\u55AB"},
+	0x2F849: {false, "\u55B3"},
+	0x2F84A: {false, "\u55C2"},
+	0x2F84B: {false, "\u5716"},
+	0x2F84C: {false, "\u5606"},
+	0x2F84D: {false, "\u5717"},
+	0x2F84E: {false, "\u5651"},
+	0x2F84F: {false, "\u5674"},
+	0x2F850: {false, "\u5207"},
+	0x2F851: {false, "\u58EE"},
+	0x2F852: {false, "\u57CE"},
+	0x2F853: {false, "\u57F4"},
+	0x2F854: {false, "\u580D"},
+	0x2F855: {false, "\u578B"},
+	0x2F856: {false, "\u5832"},
+	0x2F857: {false, "\u5831"},
+	0x2F858: {false, "\u58AC"},
+	0x2F859: {false, "\U000214E4"},
+	0x2F85A: {false, "\u58F2"},
+	0x2F85B: {false, "\u58F7"},
+	0x2F85C: {false, "\u5906"},
+	0x2F85D: {false, "\u591A"},
+	0x2F85E: {false, "\u5922"},
+	0x2F85F: {false, "\u5962"},
+	0x2F860: {false, "\U000216A8"},
+	0x2F861: {false, "\U000216EA"},
+	0x2F862: {false, "\u59EC"},
+	0x2F863: {false, "\u5A1B"},
+	0x2F864: {false, "\u5A27"},
+	0x2F865: {false, "\u59D8"},
+	0x2F866: {false, "\u5A66"},
+	0x2F867: {false, "\u36EE"},
+	0x2F868: {false, "\u36FC"},
+	0x2F869: {false, "\u5B08"},
+	0x2F86A: {false, "\u5B3E"},
+	0x2F86B: {false, "\u5B3E"},
+	0x2F86C: {false, "\U000219C8"},
+	0x2F86D: {false, "\u5BC3"},
+	0x2F86E: {false, "\u5BD8"},
+	0x2F86F: {false, "\u5BE7"},
+	0x2F870: {false, "\u5BF3"},
+	0x2F871: {false, "\U00021B18"},
+	0x2F872: {false, "\u5BFF"},
+	0x2F873: {false, "\u5C06"},
+	0x2F874: {false, "\u5F53"},
+	0x2F875: {false, "\u5C22"},
+	0x2F876: {false, "\u3781"},
+	0x2F877: {false, "\u5C60"},
+	0x2F878: {false, "\u5C6E"},
+	0x2F879: {false, "\u5CC0"},
+	0x2F87A: {false, "\u5C8D"},
+	0x2F87B: {false, "\U00021DE4"},
+	0x2F87C: {false, "\u5D43"},
+	0x2F87D: {false, "\U00021DE6"},
+	0x2F87E: {false, "\u5D6E"},
+	0x2F87F: {false, "\u5D6B"},
+	0x2F880: {false, "\u5D7C"},
+	0x2F881: {false, "\u5DE1"},
+	0x2F882: {false, "\u5DE2"},
+	0x2F883: {false, "\u382F"},
+	0x2F884: {false, "\u5DFD"},
+	0x2F885: {false, "\u5E28"},
+	0x2F886: {false, "\u5E3D"},
+	0x2F887: {false, "\u5E69"},
+	0x2F888: {false, "\u3862"},
+	0x2F889: {false, "\U00022183"},
+	0x2F88A: {false, "\u387C"},
+	0x2F88B: {false, "\u5EB0"},
+	0x2F88C: {false, "\u5EB3"},
+	0x2F88D: {false, "\u5EB6"},
+	0x2F88E: {false, "\u5ECA"},
+	0x2F88F: {false, "\U0002A392"},
+	0x2F890: {false, "\u5EFE"},
+	0x2F891: {false, "\U00022331"},
+	0x2F892: {false, "\U00022331"},
+	0x2F893: {false, "\u8201"},
+	0x2F894: {false, "\u5F22"},
+	0x2F895: {false, "\u5F22"},
+	0x2F896: {false, "\u38C7"},
+	0x2F897: {false, "\U000232B8"},
+	0x2F898: {false, "\U000261DA"},
+	0x2F899: {false, "\u5F62"},
+	0x2F89A: {false, "\u5F6B"},
+	0x2F89B: {false, "\u38E3"},
+	0x2F89C: {false, "\u5F9A"},
+	0x2F89D: {false, "\u5FCD"},
+	0x2F89E: {false, "\u5FD7"},
+	0x2F89F: {false, "\u5FF9"},
+	0x2F8A0: {false, "\u6081"},
+	0x2F8A1: {false, "\u393A"},
+	0x2F8A2: {false, "\u391C"},
+	0x2F8A3: {false, "\u6094"},
+	0x2F8A4: {false, "\U000226D4"},
+	0x2F8A5: {false, "\u60C7"},
+	0x2F8A6: {false, "\u6148"},
+	0x2F8A7: {false, "\u614C"},
+	0x2F8A8: {false, "\u614E"},
+	0x2F8A9: {false, "\u614C"},
+	0x2F8AA: {false, "\u617A"},
+	0x2F8AB: {false, "\u618E"},
+	0x2F8AC: {false, "\u61B2"},
+	0x2F8AD: {false, "\u61A4"},
+	0x2F8AE: {false, "\u61AF"},
+	0x2F8AF: {false, "\u61DE"},
+	0x2F8B0: {false, "\u61F2"},
+	0x2F8B1: {false, "\u61F6"},
+	0x2F8B2: {false, "\u6210"},
+	0x2F8B3: {false, "\u621B"},
+	0x2F8B4: {false, "\u625D"},
+	0x2F8B5: {false, "\u62B1"},
+	0x2F8B6: {false, "\u62D4"},
+	0x2F8B7: {false, "\u6350"},
+	0x2F8B8: {false, "\U00022B0C"},
+	0x2F8B9: {false, "\u633D"},
+	0x2F8BA: {false, "\u62FC"},
+	0x2F8BB: {false, "\u6368"},
+	0x2F8BC: {false, "\u6383"},
+	0x2F8BD: {false, "\u63E4"},
+	0x2F8BE: {false, "\U00022BF1"},
+	0x2F8BF: {false, "\u6422"},
+	0x2F8C0: {false, "\u63C5"},
+	0x2F8C1: {false, "\u63A9"},
+	0x2F8C2: {false, "\u3A2E"},
+	0x2F8C3: {false, "\u6469"},
+	0x2F8C4: {false, "\u647E"},
+	0x2F8C5: {false, "\u649D"},
+	0x2F8C6: {false, "\u6477"},
+	0x2F8C7: {false, "\u3A6C"},
+	0x2F8C8: {false, "\u654F"},
+	0x2F8C9: {false, "\u656C"},
+	0x2F8CA: {false, "\U0002300A"},
+	0x2F8CB: {false, "\u65E3"},
+	0x2F8CC: {false, "\u66F8"},
+	0x2F8CD: {false, "\u6649"},
+	0x2F8CE: {false, "\u3B19"},
+	0x2F8CF: {false, "\u6691"},
+	0x2F8D0: {false, "\u3B08"},
+	0x2F8D1: {false, "\u3AE4"},
+	0x2F8D2: {false, "\u5192"},
+	0x2F8D3: {false, "\u5195"},
+	0x2F8D4: {false, "\u6700"},
+	0x2F8D5: {false, "\u669C"},
+	0x2F8D6: {false, "\u80AD"},
+	0x2F8D7: {false, "\u43D9"},
+	0x2F8D8: {false, "\u6717"},
+	0x2F8D9: {false, "\u671B"},
+	0x2F8DA: {false, "\u6721"},
+	0x2F8DB: {false, "\u675E"},
+	0x2F8DC: {false, "\u6753"},
+	0x2F8DD: {false, "\U000233C3"},
+	0x2F8DE: {false, "\u3B49"},
+	0x2F8DF: {false, "\u67FA"},
+	0x2F8E0: {false, "\u6785"},
+	0x2F8E1: {false, "\u6852"},
+	0x2F8E2: {false, "\u6885"},
+	0x2F8E3: {false, "\U0002346D"},
+	0x2F8E4: {false, "\u688E"},
+	0x2F8E5: {false, "\u681F"},
+	0x2F8E6: {false, "\u6914"},
+	0x2F8E7: {false, "\u3B9D"},
+	0x2F8E8: {false, "\u6942"},
+	0x2F8E9: {false, "\u69A3"},
+	0x2F8EA: {false, "\u69EA"},
+	0x2F8EB: {false, "\u6AA8"},
+	0x2F8EC: {false, "\U000236A3"},
+	0x2F8ED: {false, "\u6ADB"},
+	0x2F8EE: {false, "\u3C18"},
+	0x2F8EF: {false, "\u6B21"},
+	0x2F8F0: {false, "\U000238A7"},
+	0x2F8F1: {false, "\u6B54"},
+	0x2F8F2: {false, "\u3C4E"},
+	0x2F8F3: {false, "\u6B72"},
+	0x2F8F4: {false, "\u6B9F"},
+	0x2F8F5: {false, "\u6BBA"},
+	0x2F8F6: {false, "\u6BBB"},
+	0x2F8F7: {false, "\U00023A8D"},
+	0x2F8F8: {false, "\U00021D0B"},
+	0x2F8F9: {false, "\U00023AFA"},
+	0x2F8FA: {false, "\u6C4E"},
+	0x2F8FB: {false, "\U00023CBC"},
+	0x2F8FC: {false, "\u6CBF"},
+	0x2F8FD: {false, "\u6CCD"},
+	0x2F8FE: {false, "\u6C67"},
+	0x2F8FF: {false, "\u6D16"},
+	0x2F900: {false, "\u6D3E"},
+	0x2F901: {false, "\u6D77"},
+	0x2F902: {false, "\u6D41"},
+	0x2F903: {false, "\u6D69"},
+	0x2F904: {false, "\u6D78"},
+	0x2F905: {false, "\u6D85"},
+	0x2F906: {false, "\U00023D1E"},
+	0x2F907: {false, "\u6D34"},
+	0x2F908: {false, "\u6E2F"},
+	0x2F909: {false, "\u6E6E"},
+	0x2F90A: {false, "\u3D33"},
+	0x2F90B: {false, "\u6ECB"},
+	0x2F90C: {false, "\u6EC7"},
+	0x2F90D: {false, "\U00023ED1"},
+	0x2F90E: {false, "\u6DF9"},
+	0x2F90F: {false, "\u6F6E"},
+	0x2F910: {false, "\U00023F5E"},
+	0x2F911: {false, "\U00023F8E"},
+	0x2F912: {false, "\u6FC6"},
+	0x2F913: {false, "\u7039"},
+	0x2F914: {false, "\u701E"},
+	0x2F915: {false, "\u701B"},
+	0x2F916: {false, "\u3D96"},
+	0x2F917: {false, "\u704A"},
+	0x2F918: {false, "\u707D"},
+	0x2F919: {false, "\u7077"},
+	0x2F91A: {false, "\u70AD"},
+	0x2F91B: {false, "\U00020525"},
+	0x2F91C: {false, "\u7145"},
+	0x2F91D: {false, "\U00024263"},
+	0x2F91E: {false, "\u719C"},
+	0x2F91F: {false, "\U000243AB"},
+	0x2F920: {false, "\u7228"},
+	0x2F921: {false, "\u7235"},
+	0x2F922: {false, "\u7250"},
+	0x2F923: {false, "\U00024608"},
+	0x2F924: {false, "\u7280"},
+	0x2F925: {false, "\u7295"},
+	0x2F926: {false, "\U00024735"},
+	0x2F927: {false, "\U00024814"},
+	0x2F928: {false, "\u737A"},
+	0x2F929: {false, "\u738B"},
+	0x2F92A: {false, "\u3EAC"},
+	0x2F92B: {false, "\u73A5"},
+	0x2F92C: {false, "\u3EB8"},
+	0x2F92D: {false, "\u3EB8"},
+	0x2F92E: {false, "\u7447"},
+	0x2F92F: {false, "\u745C"},
+	0x2F930: {false, "\u7471"},
+	0x2F931: {false, "\u7485"},
+	0x2F932: {false, "\u74CA"},
+	0x2F933: {false, "\u3F1B"},
+	0x2F934: {false, "\u7524"},
+	0x2F935: {false, "\U00024C36"},
+	0x2F936: {false, "\u753E"},
+	0x2F937: {false, "\U00024C92"},
+	0x2F938: {false, "\u7570"},
+	0x2F939: {false, "\U0002219F"},
+	0x2F93A: {false, "\u7610"},
+	0x2F93B: {false, "\U00024FA1"},
+	0x2F93C: {false, "\U00024FB8"},
+	0x2F93D: {false, "\U00025044"},
+	0x2F93E: {false, "\u3FFC"},
+	0x2F93F: {false, "\u4008"},
+	0x2F940: {false, "\u76F4"},
+	0x2F941: {false, "\U000250F3"},
+	0x2F942: {false, "\U000250F2"},
+	0x2F943: {false, "\U00025119"},
+	0x2F944: {false, "\U00025133"},
+	0x2F945: {false, "\u771E"},
+	0x2F946: {false, "\u771F"},
+	0x2F947: {false, "\u771F"},
+	0x2F948: {false, "\u774A"},
+	0x2F949: {false, "\u4039"},
+	0x2F94A: {false, "\u778B"},
+	0x2F94B: {false, "\u4046"},
+	0x2F94C: {false, "\u4096"},
+	0x2F94D: {false, "\U0002541D"},
+	0x2F94E: {false, "\u784E"},
+	0x2F94F: {false, "\u788C"},
+	0x2F950: {false, "\u78CC"},
+	0x2F951: {false, "\u40E3"},
+	0x2F952: {false, "\U00025626"},
+	0x2F953: {false, "\u7956"},
+	0x2F954: {false, "\U0002569A"},
+	0x2F955: {false, "\U000256C5"},
+	0x2F956: {false, "\u798F"},
+	0x2F957: {false, "\u79EB"},
+	0x2F958: {false, "\u412F"},
+	0x2F959: {false, "\u7A40"},
+	0x2F95A: {false, "\u7A4A"},
+	0x2F95B: {false, "\u7A4F"},
+	0x2F95C: {false, "\U0002597C"},
+	0x2F95D: {false, "\U00025AA7"},
+	0x2F95E: {false, "\U00025AA7"},
+	0x2F95F: {false, "\u7AEE"},
+	0x2F960: {false, "\u4202"},
+	0x2F961: {false, "\U00025BAB"},
+	0x2F962: {false, "\u7BC6"},
+	0x2F963: {false, "\u7BC9"},
+	0x2F964: {false, "\u4227"},
+	0x2F965: {false, "\U00025C80"},
+	0x2F966: {false, "\u7CD2"},
+	0x2F967: {false, "\u42A0"},
+	0x2F968: {false, "\u7CE8"},
+	0x2F969: {false, "\u7CE3"},
+	0x2F96A: {false, "\u7D00"},
+	0x2F96B: {false, "\U00025F86"},
+	0x2F96C: {false, "\u7D63"},
+	0x2F96D: {false, "\u4301"},
+	0x2F96E: {false, "\u7DC7"},
+	0x2F96F: {false, "\u7E02"},
+	0x2F970: {false, "\u7E45"},
+	0x2F971: {false, "\u4334"},
+	0x2F972: {false, "\U00026228"},
+	0x2F973: {false, "\U00026247"},
+	0x2F974: {false, "\u4359"},
+	0x2F975: {false, "\U000262D9"},
+	0x2F976: {false, "\u7F7A"},
+	0x2F977: {false, "\U0002633E"},
+	0x2F978: {false, "\u7F95"},
+	0x2F979: {false, "\u7FFA"},
+	0x2F97A: {false, "\u8005"},
+	0x2F97B: {false, "\U000264DA"},
+	0x2F97C: {false, "\U00026523"},
+	0x2F97D: {false, "\u8060"},
+	0x2F97E: {false, "\U000265A8"},
+	0x2F97F: {false, "\u8070"},
+	0x2F980: {false, "\U0002335F"},
+	0x2F981: {false, "\u43D5"},
+	0x2F982: {false, "\u80B2"},
+	0x2F983: {false, "\u8103"},
+	0x2F984: {false, "\u440B"},
+	0x2F985: {false, "\u813E"},
+	0x2F986: {false, "\u5AB5"},
+	0x2F987: {false, "\U000267A7"},
+	0x2F988: {false, "\U000267B5"},
+	0x2F989: {false, "\U00023393"},
+	0x2F98A: {false, "\U0002339C"},
+	0x2F98B: {false, "\u8201"},
+	0x2F98C: {false, "\u8204"},
+	0x2F98D: {false, "\u8F9E"},
+	0x2F98E: {false, "\u446B"},
+	0x2F98F: {false, "\u8291"},
+	0x2F990: {false, "\u828B"},
+	0x2F991: {false, "\u829D"},
+	0x2F992: {false, "\u52B3"},
+	0x2F993: {false, "\u82B1"},
+	0x2F994: {false, "\u82B3"},
+	0x2F995: {false, "\u82BD"},
+	0x2F996: {false, "\u82E6"},
+	0x2F997: {false, "\U00026B3C"},
+	0x2F998: {false, "\u82E5"},
+	0x2F999: {false, "\u831D"},
+	0x2F99A: {false, "\u8363"},
+	0x2F99B: {false, "\u83AD"},
+	0x2F99C: {false, "\u8323"},
+	0x2F99D: {false, "\u83BD"},
+	0x2F99E: {false, "\u83E7"},
+	0x2F99F: {false, "\u8457"},
+	0x2F9A0: {false, "\u8353"},
+	0x2F9A1: {false, "\u83CA"},
+	0x2F9A2: {false, "\u83CC"},
+	0x2F9A3: {false, "\u83DC"},
+	0x2F9A4: {false, "\U00026C36"},
+	0x2F9A5: {false, "\U00026D6B"},
+	0x2F9A6: {false, "\U00026CD5"},
+	0x2F9A7: {false, "\u452B"},
+	0x2F9A8: {false, "\u84F1"},
+	0x2F9A9: {false, "\u84F3"},
+	0x2F9AA: {false, "\u8516"},
+	0x2F9AB: {false, "\U000273CA"},
+	0x2F9AC: {false, "\u8564"},
+	0x2F9AD: {false, "\U00026F2C"},
+	0x2F9AE: {false, "\u455D"},
+	0x2F9AF: {false, "\u4561"},
+	0x2F9B0: {false, "\U00026FB1"},
+	0x2F9B1: {false, "\U000270D2"},
+	0x2F9B2: {false, "\u456B"},
+	0x2F9B3: {false, "\u8650"},
+	0x2F9B4: {false, "\u865C"},
+	0x2F9B5: {false, "\u8667"},
+	0x2F9B6: {false, "\u8669"},
+	0x2F9B7: {false, "\u86A9"},
+	0x2F9B8: {false, "\u8688"},
+	0x2F9B9: {false, "\u870E"},
+	0x2F9BA: {false, "\u86E2"},
+	0x2F9BB: {false, "\u8779"},
+	0x2F9BC: {false, "\u8728"},
+	0x2F9BD: {false, "\u876B"},
+	0x2F9BE: {false, "\u8786"},
+	0x2F9BF: {false, "\u45D7"},
+	0x2F9C0: {false, "\u87E1"},
+	0x2F9C1: {false, "\u8801"},
+	0x2F9C2: {false, "\u45F9"},
+	0x2F9C3: {false, "\u8860"},
+	0x2F9C4: {false, "\u8863"},
+	0x2F9C5: {false, "\U00027667"},
+	0x2F9C6: {false, "\u88D7"},
+	0x2F9C7: {false, "\u88DE"},
+	0x2F9C8: {false, "\u4635"},
+	0x2F9C9: {false, "\u88FA"},
+	0x2F9CA: {false, "\u34BB"},
+	0x2F9CB: {false, "\U000278AE"},
+	0x2F9CC: {false, "\U00027966"},
+	0x2F9CD: {false, "\u46BE"},
+	0x2F9CE: {false, "\u46C7"},
+	0x2F9CF: {false, "\u8AA0"},
+	0x2F9D0: {false, "\u8AED"},
+	0x2F9D1: {false, "\u8B8A"},
+	0x2F9D2: {false, "\u8C55"},
+	0x2F9D3: {false, "\U00027CA8"},
+	0x2F9D4: {false, "\u8CAB"},
+	0x2F9D5: {false, "\u8CC1"},
+	0x2F9D6: {false, "\u8D1B"},
+	0x2F9D7: {false, "\u8D77"},
+	0x2F9D8: {false, "\U00027F2F"},
+	0x2F9D9: {false, "\U00020804"},
+	0x2F9DA: {false, "\u8DCB"},
+	0x2F9DB: {false, "\u8DBC"},
+	0x2F9DC: {false, "\u8DF0"},
+	0x2F9DD: {false, "\U000208DE"},
+	0x2F9DE: {false, "\u8ED4"},
+	0x2F9DF: {false, "\u8F38"},
+	0x2F9E0: {false, "\U000285D2"},
+	0x2F9E1: {false, "\U000285ED"},
+	0x2F9E2: {false, "\u9094"},
+	0x2F9E3: {false, "\u90F1"},
+	0x2F9E4: {false, "\u9111"},
+	0x2F9E5: {false, "\U0002872E"},
+	0x2F9E6: {false, "\u911B"},
+	0x2F9E7: {false, "\u9238"},
+	0x2F9E8: {false, "\u92D7"},
+	0x2F9E9: {false, "\u92D8"},
+	0x2F9EA: {false, "\u927C"},
+	0x2F9EB: {false, "\u93F9"},
+	0x2F9EC: {false, "\u9415"},
+	0x2F9ED: {false, "\U00028BFA"},
+	0x2F9EE: {false, "\u958B"},
+	0x2F9EF: {false, "\u4995"},
+	0x2F9F0: {false, "\u95B7"},
+	0x2F9F1: {false, "\U00028D77"},
+	0x2F9F2: {false, "\u49E6"},
+	0x2F9F3: {false, "\u96C3"},
+	0x2F9F4: {false, "\u5DB2"},
+	0x2F9F5: {false, "\u9723"},
+	0x2F9F6: {false, "\U00029145"},
+	0x2F9F7: {false, "\U0002921A"},
+	0x2F9F8: {false, "\u4A6E"},
+	0x2F9F9: {false, "\u4A76"},
+	0x2F9FA: {false, "\u97E0"},
+	0x2F9FB: {false, "\U0002940A"},
+	0x2F9FC: {false, "\u4AB2"},
+	0x2F9FD: {false, "\U00029496"},
+	0x2F9FE: {false, "\u980B"},
+	0x2F9FF: {false, "\u980B"},
+	0x2FA00: {false, "\u9829"},
+	0x2FA01: {false, "\U000295B6"},
+	0x2FA02: {false, "\u98E2"},
+	0x2FA03: {false, "\u4B33"},
+	0x2FA04: {false, "\u9929"},
+	0x2FA05: {false, "\u99A7"},
+	0x2FA06: {false, "\u99C2"},
+	0x2FA07: {false, "\u99FE"},
+	0x2FA08: {false, "\u4BCE"},
+	0x2FA09: {false, "\U00029B30"},
+	0x2FA0A: {false, "\u9B12"},
+	0x2FA0B: {false, "\u9C40"},
+	0x2FA0C: {false, "\u9CFD"},
+	0x2FA0D: {false, "\u4CCE"},
+	0x2FA0E: {false, "\u4CED"},
+	0x2FA0F: {false, "\u9D67"},
+	0x2FA10: {false, "\U0002A0CE"},
+	0x2FA11: {false, "\u4CF8"},
+	0x2FA12: {false, "\U0002A105"},
+	0x2FA13: {false, "\U0002A20E"},
+	0x2FA14: {false, "\U0002A291"},
+	0x2FA15: {false, "\u9EBB"},
+	0x2FA16: {false, "\u4D56"},
+	0x2FA17: {false, "\u9EF9"},
+	0x2FA18: {false, "\u9EFE"},
+	0x2FA19: {false, "\u9F05"},
+	0x2FA1A: {false, "\u9F0F"},
+	0x2FA1B: {false, "\u9F16"},
+	0x2FA1C: {false, "\u9F3B"},
+	0x2FA1D: {false, "\U0002A600"},
+}
+
+// The characters which are excluded from composition in addition to
+// the singletons and the non-starter decompositions.
+var compositionExclusions = map[rune]bool{
+	0x0958: true, 0x0959: true, 0x095A: true, 0x095B: true, 0x095C: true, 0x095D: true,
+	0x095E: true, 0x095F: true, 0x09DC: true, 0x09DD: true, 0x09DF: true, 0x0A33: true,
+	0x0A36: true, 0x0A59: true, 0x0A5A: true, 0x0A5B: true, 0x0A5E: true, 0x0B5C: true,
+	0x0B5D: true, 0x0F43: true, 0x0F4D: true, 0x0F52: true, 0x0F57: true, 0x0F5C: true,
+	0x0F69: true, 0x0F76: true, 0x0F78: true, 0x0F93: true, 0x0F9D: true, 0x0FA2: true,
+	0x0FA7: true, 0x0FAC: true, 0x0FB9: true, 0x2ADC: true, 0xFB1D: true, 0xFB1F: true,
+	0xFB2A: true, 0xFB2B: true, 0xFB2C: true, 0xFB2D: true, 0xFB2E: true, 0xFB2F: true,
+	0xFB30: true, 0xFB31: true, 0xFB32: true, 0xFB33: true, 0xFB34: true, 0xFB35: true,
+	0xFB36: true, 0xFB38: true, 0xFB39: true, 0xFB3A: true, 0xFB3B: true, 0xFB3C: true,
+	0xFB3E: true, 0xFB40: true, 0xFB41: true, 0xFB43: true, 0xFB44: true, 0xFB46: true,
+	0xFB47: true, 0xFB48: true, 0xFB49: true, 0xFB4A: true, 0xFB4B: true, 0xFB4C: true,
+	0xFB4D: true, 0xFB4E: true, 0x1D15E: true, 0x1D15F: true, 0x1D160: true, 0x1D161: true,
+	0x1D162: true, 0x1D163: true, 0x1D164: true, 0x1D1BB: true, 0x1D1BC: true, 0x1D1BD: true,
+	0x1D1BE: true, 0x1D1BF: true, 0x1D1C0: true,
+}
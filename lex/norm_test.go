@@ -0,0 +1,35 @@
+package lex
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		text      string
+		nfc, nfkc string
+	}{
+		{"abc", "abc", "abc"},
+		{"e\u0301", "\u00e9", "\u00e9"},
+		{"\u00e9", "\u00e9", "\u00e9"},
+		// The combining marks are reordered by their combining classes.
+		{"a\u0301\u0323", "\u1ea1\u0301", "\u1ea1\u0301"},
+		{"\ufb01", "\ufb01", "fi"},
+		{"\u2460", "\u2460", "1"},
+		// The Hangul syllables are composed algorithmically.
+		{"\u1100\u1161\u11a8", "\uac01", "\uac01"},
+		{"\uac00\u11a8", "\uac01", "\uac01"},
+		// The composition exclusions are not composed.
+		{"\u0958", "\u0915\u093c", "\u0915\u093c"},
+		{"\u212b", "\u00c5", "\u00c5"},
+	}
+	for _, c := range cases {
+		if s := NFC.Normalize(c.text); s != c.nfc {
+			t.Errorf("Expected the NFC of %+q to be %+q, but got %+q.", c.text, c.nfc, s)
+		}
+		if s := NFKC.Normalize(c.text); s != c.nfkc {
+			t.Errorf("Expected the NFKC of %+q to be %+q, but got %+q.", c.text, c.nfkc, s)
+		}
+		if s := NoNormalization.Normalize(c.text); s != c.text {
+			t.Errorf("Expected %+q to be unchanged, but got %+q.", c.text, s)
+		}
+	}
+}
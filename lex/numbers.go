@@ -34,6 +34,29 @@ func octSyntaxError() error {
 	return fmt.Errorf("Bad octal integer syntax.")
 }
 
+func isIntegerSuffixChar(c rune) bool {
+	return c == 'u' || c == 'U' || c == 'l' || c == 'L'
+}
+
+// Returns true if |s| is the suffix of a C integer constant, which is an
+// optional 'u' and an optional 'l' or 'll', in either order and in either
+// case, like "UL" or "llu".
+func isIntegerSuffix(s string) bool {
+	switch s {
+	case "u", "U", "l", "L", "ll", "LL",
+		"ul", "uL", "Ul", "UL", "lu", "lU", "Lu", "LU",
+		"ull", "uLL", "Ull", "ULL", "llu", "llU", "LLu", "LLU":
+		return true
+	}
+	return false
+}
+
+// Returns true if the integers can have the suffixes of C, like 10UL.
+// They are read if the C pre-processor directives are tokens.
+func (tz *Tokenizer) hasIntegerSuffixes() bool {
+	return tz.ts.Contains(token_kind.CPPDirective)
+}
+
 func (tz *Tokenizer) readCharAfterE() (rune, error) {
 	c, err := tz.r.ReadChar()
 	if err != nil {
@@ -58,13 +81,15 @@ func (tz *Tokenizer) readNumber() (*Token, error) {
 		return nil, fmt.Errorf("Unexpected '%c' while reading a number.", c)
 	}
 
-	n := []rune{c}
+	n := append(tz.runes[:0], c)
 	dec := false
 	hex := false
 	oct := false
 	float := false
 	// Flag to check whether an 'e' or 'E' of a float number has been read.
 	exp := false
+	// The index of the suffix of an integer in |n|, if any.
+	suffix := -1
 
 	if c == '0' {
 		// The number is either octal, hex, float, or just plain
@@ -110,6 +135,9 @@ func (tz *Tokenizer) readNumber() (*Token, error) {
 			// It is either an octal number or a float number.
 			// We will treat it as octal until we find a '.' or 'e' or 'E'.
 			oct = true
+		case isIntegerSuffixChar(c) && tz.hasIntegerSuffixes():
+			dec = true
+			suffix = 1
 		default:
 			return nil, unExpectedCharacterError(c)
 		}
@@ -140,6 +168,14 @@ func (tz *Tokenizer) readNumber() (*Token, error) {
 		// reading subsquent characters.
 		n = append(n, c)
 
+		// The suffix of an integer is checked once it has been read.
+		if suffix < 0 && (dec || hex || oct) && isIntegerSuffixChar(c) && tz.hasIntegerSuffixes() {
+			suffix = len(n) - 1
+		}
+		if suffix >= 0 {
+			continue
+		}
+
 		switch {
 		case hex:
 			if !isHexDigit(c) {
@@ -200,12 +236,20 @@ func (tz *Tokenizer) readNumber() (*Token, error) {
 		}
 	}
 
+	digits := n
+	if suffix >= 0 {
+		digits = n[:suffix]
+		if !isIntegerSuffix(string(n[suffix:])) {
+			return nil, fmt.Errorf("Bad integer suffix '%s'.", string(n[suffix:]))
+		}
+	}
+
 	var tt uint32
 	if dec {
 		tt = token_kind.DecimalInteger
 	}
 	if hex {
-		if len(n) < 3 {
+		if len(digits) < 3 {
 			return nil, hexSyntaxError()
 		}
 		tt = token_kind.HexInteger
@@ -217,7 +261,7 @@ func (tz *Tokenizer) readNumber() (*Token, error) {
 		tt = token_kind.FloatNumber
 	}
 	if oct {
-		if len(n) < 2 {
+		if len(digits) < 2 {
 			return nil, octSyntaxError()
 		}
 		// The oct integer string was constructed even if
@@ -230,5 +274,5 @@ func (tz *Tokenizer) readNumber() (*Token, error) {
 		tt = token_kind.OctInteger
 	}
 
-	return newToken(tt, n, line, col), nil
+	return tz.makeToken(tt, n, line, col), nil
 }
@@ -37,3 +37,34 @@ func TestNumberTokens(t *testing.T) {
 		t.Errorf(err.Error())
 	}
 }
+
+func TestIntegerSuffixes(t *testing.T) {
+	// The integers of C, whose directives are tokens, can have suffixes.
+	ts := NewTokenKindSet([]uint32{
+		token_kind.DecimalInteger,
+		token_kind.HexInteger,
+		token_kind.OctInteger,
+		token_kind.CPPDirective,
+	})
+
+	err := matchTokens("test_data/integer_suffixes_text", ts, []Token{
+		Token{token_kind.DecimalInteger, "10UL", 1, 1},
+		Token{token_kind.HexInteger, "0x1fu", 1, 6},
+		Token{token_kind.OctInteger, "07lu", 1, 12},
+		Token{token_kind.DecimalInteger, "0L", 1, 17},
+		Token{token_kind.DecimalInteger, "1llu", 1, 20},
+	})
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	for _, s := range []string{"1uu", "1lul", "1lL"} {
+		tz, err := NewBytesTokenizer([]byte(s), ts, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := tz.NextToken(); err == nil {
+			t.Errorf("Expected an error for the suffix of %q.", s)
+		}
+	}
+}
@@ -57,6 +57,9 @@ var OperatorMap = map[string]uint32{
 	"++":  token_kind.UnaryIncrement,
 	"--":  token_kind.UnaryDecrement,
 	"**":  token_kind.MulPower,
+	"#":   token_kind.CPPStringify,
+	"##":  token_kind.CPPTokenPaste,
+	"?":   token_kind.QuestionMark,
 }
 
 func (tz *Tokenizer) hasCompAssign(op []rune) bool {
@@ -90,7 +93,7 @@ func (tz *Tokenizer) readOpFlavors(tt, tta, ttr, ttra uint32) (*Token, error) {
 		return nil, err
 	}
 
-	op := []rune{c}
+	op := append(tz.runes[:0], c)
 	c1, err := tz.r.PeekChar()
 	switch {
 	case err != nil:
@@ -101,7 +104,7 @@ func (tz *Tokenizer) readOpFlavors(tt, tta, ttr, ttra uint32) (*Token, error) {
 			return nil, err
 		}
 		op = append(op, c1)
-		return newToken(tta, op, line, col), nil
+		return tz.makeToken(tta, op, line, col), nil
 	case c1 == c && tz.ts.Contains(ttr):
 		c1, err = tz.r.ReadChar()
 		if err != nil {
@@ -111,14 +114,14 @@ func (tz *Tokenizer) readOpFlavors(tt, tta, ttr, ttra uint32) (*Token, error) {
 
 		c2, err := tz.r.PeekChar()
 		if err != nil || c2 != char.Equal || !tz.hasCompAssign(op) {
-			return newToken(ttr, op, line, col), nil
+			return tz.makeToken(ttr, op, line, col), nil
 		}
 		c2, err = tz.r.ReadChar()
 		if err != nil {
 			return nil, err
 		}
 		op = append(op, c2)
-		return newToken(ttra, op, line, col), nil
+		return tz.makeToken(ttra, op, line, col), nil
 	default:
 		return tz.newValidToken(tt, op, line, col)
 	}
@@ -141,13 +144,13 @@ func (tz *Tokenizer) readOperator() (*Token, error) {
 		// The operator '->' is not read by readOpFlavors. Hence we handle it
 		// as a separate case.
 		if tz.ts.Contains(token_kind.ReturnArrow) {
-			cc, err := tz.r.PeekSlice(2)
-			if err == nil && cc[1] == char.GreaterThan {
-				s, err := tz.r.ReadSlice(2)
+			c1, err := tz.r.PeekCharAt(1)
+			if err == nil && c1 == char.GreaterThan {
+				s, err := tz.readSlice(2)
 				if err != nil {
 					return nil, err
 				}
-				return newToken(token_kind.ReturnArrow, s, line, col), nil
+				return tz.makeToken(token_kind.ReturnArrow, s, line, col), nil
 			}
 		}
 		return tz.readOpFlavors(
@@ -182,6 +185,17 @@ func (tz *Tokenizer) readOperator() (*Token, error) {
 			token_kind.BitwiseOr, token_kind.BitwiseOrAssign, token_kind.LogicalOr,
 			token_kind.Invalid)
 	case char.Dot:
+		// The operator '...' is not read by readOpFlavors. Hence we handle
+		// it as a separate case.
+		if tz.ts.Contains(token_kind.ExclusiveRange) {
+			if tz.r.PeekMatch("...") {
+				s, err := tz.readSlice(3)
+				if err != nil {
+					return nil, err
+				}
+				return tz.makeToken(token_kind.ExclusiveRange, s, line, col), nil
+			}
+		}
 		return tz.readOpFlavors(
 			token_kind.Dot, token_kind.Invalid, token_kind.InclusiveRange, token_kind.Invalid)
 	case char.Comma:
@@ -219,6 +233,17 @@ func (tz *Tokenizer) readOperator() (*Token, error) {
 		return tz.readOpFlavors(
 			token_kind.GreaterThan, token_kind.GreaterThanEqual, token_kind.RightShift,
 			token_kind.RightShiftAssign)
+	case char.Hash:
+		return tz.readOpFlavors(
+			token_kind.CPPStringify, token_kind.Invalid, token_kind.CPPTokenPaste,
+			token_kind.Invalid)
+	case char.QuestionMark:
+		// A '?' is an unexpected character in the languages which have no
+		// conditional operator.
+		if tz.ts.Contains(token_kind.QuestionMark) {
+			return tz.readOpFlavors(
+				token_kind.QuestionMark, token_kind.Invalid, token_kind.Invalid, token_kind.Invalid)
+		}
 	}
 
 	return nil, unExpectedCharacterError(c)
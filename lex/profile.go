@@ -0,0 +1,368 @@
+package lex
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"uno/lex/token_kind"
+)
+
+// A language profile. It has the token kinds of a language, the escape
+// sequence reader for its strings and the extensions of its source files.
+type Profile struct {
+	Name string
+	// The file extensions, including the leading '.', like ".py".
+	Extensions []string
+	Kinds      []uint32
+	ESR        EscSeqReader
+	// The rules for the characters of identifiers.
+	Identifiers IdentifierRules
+}
+
+// Returns a new set of the token kinds of the profile.
+func (p *Profile) TokenKindSet() TokenKindSet {
+	return NewTokenKindSet(p.Kinds)
+}
+
+// Returns a new Tokenizer which reads |r| with the profile.
+func (p *Profile) NewTokenizer(r io.RuneReader) (*Tokenizer, error) {
+	tz, err := NewTokenizer(r, p.TokenKindSet(), p.ESR)
+	if err != nil {
+		return nil, err
+	}
+	tz.SetIdentifierRules(p.Identifiers)
+	return tz, nil
+}
+
+// Returns a new Tokenizer which reads the UTF-8 encoded text |b| with the
+// profile. See NewBytesTokenizer.
+func (p *Profile) NewBytesTokenizer(b []byte) (*Tokenizer, error) {
+	tz, err := NewBytesTokenizer(b, p.TokenKindSet(), p.ESR)
+	if err != nil {
+		return nil, err
+	}
+	tz.SetIdentifierRules(p.Identifiers)
+	return tz, nil
+}
+
+// Returns true if |path| has one of the extensions of the profile.
+func (p *Profile) Matches(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range p.Extensions {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+var cOperatorKinds = []uint32{
+	token_kind.Add,
+	token_kind.Sub,
+	token_kind.Mul,
+	token_kind.Div,
+	token_kind.Mod,
+	token_kind.BitwiseAnd,
+	token_kind.BitwiseOr,
+	token_kind.BitwiseXor,
+	token_kind.BitwiseNeg,
+	token_kind.LeftShift,
+	token_kind.RightShift,
+	token_kind.Assign,
+	token_kind.AddAssign,
+	token_kind.SubAssign,
+	token_kind.MulAssign,
+	token_kind.DivAssign,
+	token_kind.ModAssign,
+	token_kind.LeftShiftAssign,
+	token_kind.RightShiftAssign,
+	token_kind.BitwiseAndAssign,
+	token_kind.BitwiseOrAssign,
+	token_kind.BitwiseXorAssign,
+	token_kind.Equal,
+	token_kind.NotEqual,
+	token_kind.LogicalAnd,
+	token_kind.LogicalOr,
+	token_kind.LogicalNot,
+	token_kind.Dot,
+	token_kind.ExclusiveRange,
+	token_kind.Comma,
+	token_kind.LeftParen,
+	token_kind.RightParen,
+	token_kind.LeftBracket,
+	token_kind.RightBracket,
+	token_kind.LeftBrace,
+	token_kind.RightBrace,
+	token_kind.Colon,
+	token_kind.Semicolon,
+	token_kind.LessThan,
+	token_kind.LessThanEqual,
+	token_kind.GreaterThan,
+	token_kind.GreaterThanEqual,
+	token_kind.UnaryIncrement,
+	token_kind.UnaryDecrement,
+}
+
+func kindList(lists ...[]uint32) []uint32 {
+	var l []uint32
+	for _, k := range lists {
+		l = append(l, k...)
+	}
+	return l
+}
+
+var CProfile = &Profile{
+	Name:       "c",
+	Extensions: []string{".c", ".h"},
+	Kinds: kindList(cOperatorKinds, []uint32{
+		token_kind.KeywordBreak,
+		token_kind.KeywordConst,
+		token_kind.KeywordContinue,
+		token_kind.KeywordElse,
+		token_kind.KeywordFor,
+		token_kind.KeywordIf,
+		token_kind.KeywordReturn,
+		token_kind.KeywordWhile,
+		token_kind.KeywordCTrue,
+		token_kind.KeywordCFalse,
+		token_kind.Identifier,
+		token_kind.CPPDirective,
+		token_kind.DoubleQuoteString,
+		token_kind.SingleQuoteCharacter,
+		token_kind.DecimalInteger,
+		token_kind.HexInteger,
+		token_kind.OctInteger,
+		token_kind.FloatNumber,
+		token_kind.CSingleLineComment,
+		token_kind.CMultiLineComment,
+		token_kind.ReturnArrow,
+		token_kind.CPPStringify,
+		token_kind.CPPTokenPaste,
+		token_kind.QuestionMark,
+		token_kind.LineJoin,
+	}),
+	ESR: GoESR{},
+}
+
+var GoProfile = &Profile{
+	Name:       "go",
+	Extensions: []string{".go"},
+	Kinds: kindList(cOperatorKinds, []uint32{
+		token_kind.KeywordBreak,
+		token_kind.KeywordConst,
+		token_kind.KeywordContinue,
+		token_kind.KeywordElse,
+		token_kind.KeywordFor,
+		token_kind.KeywordIf,
+		token_kind.KeywordImport,
+		token_kind.KeywordReturn,
+		token_kind.Identifier,
+		token_kind.DoubleQuoteString,
+		token_kind.BackQuoteString,
+		token_kind.SingleQuoteCharacter,
+		token_kind.DecimalInteger,
+		token_kind.HexInteger,
+		token_kind.OctInteger,
+		token_kind.FloatNumber,
+		token_kind.CSingleLineComment,
+		token_kind.CMultiLineComment,
+		token_kind.ChannelIO,
+		token_kind.NewLine,
+	}),
+	ESR: GoESR{},
+}
+
+var PythonProfile = &Profile{
+	Name:       "python",
+	Extensions: []string{".py"},
+	Kinds: []uint32{
+		token_kind.KeywordAnd,
+		token_kind.KeywordAs,
+		token_kind.KeywordAssert,
+		token_kind.KeywordBreak,
+		token_kind.KeywordClass,
+		token_kind.KeywordContinue,
+		token_kind.KeywordDef,
+		token_kind.KeywordDel,
+		token_kind.KeywordElif,
+		token_kind.KeywordElse,
+		token_kind.KeywordExcept,
+		token_kind.KeywordPyFalse,
+		token_kind.KeywordFinally,
+		token_kind.KeywordFor,
+		token_kind.KeywordFrom,
+		token_kind.KeywordGlobal,
+		token_kind.KeywordIf,
+		token_kind.KeywordImport,
+		token_kind.KeywordIn,
+		token_kind.KeywordIs,
+		token_kind.KeywordLambda,
+		token_kind.KeywordNonlocal,
+		token_kind.KeywordNot,
+		token_kind.KeywordOr,
+		token_kind.KeywordPass,
+		token_kind.KeywordRaise,
+		token_kind.KeywordReturn,
+		token_kind.KeywordPyTrue,
+		token_kind.KeywordTry,
+		token_kind.KeywordWhile,
+		token_kind.KeywordWith,
+		token_kind.KeywordYield,
+		token_kind.Identifier,
+		token_kind.PythonDecorator,
+		token_kind.DoubleQuoteString,
+		token_kind.SingleQuoteString,
+		token_kind.PyMultilineString,
+		token_kind.DecimalInteger,
+		token_kind.HexInteger,
+		token_kind.OctInteger,
+		token_kind.FloatNumber,
+		token_kind.PySingleLineComment,
+		token_kind.Add,
+		token_kind.Sub,
+		token_kind.Mul,
+		token_kind.Div,
+		token_kind.Mod,
+		token_kind.MulPower,
+		token_kind.BitwiseAnd,
+		token_kind.BitwiseOr,
+		token_kind.BitwiseXor,
+		token_kind.BitwiseNeg,
+		token_kind.LeftShift,
+		token_kind.RightShift,
+		token_kind.Assign,
+		token_kind.AddAssign,
+		token_kind.SubAssign,
+		token_kind.MulAssign,
+		token_kind.DivAssign,
+		token_kind.ModAssign,
+		token_kind.LeftShiftAssign,
+		token_kind.RightShiftAssign,
+		token_kind.BitwiseAndAssign,
+		token_kind.BitwiseOrAssign,
+		token_kind.BitwiseXorAssign,
+		token_kind.Equal,
+		token_kind.NotEqual,
+		token_kind.LessThan,
+		token_kind.LessThanEqual,
+		token_kind.GreaterThan,
+		token_kind.GreaterThanEqual,
+		token_kind.Dot,
+		token_kind.Comma,
+		token_kind.LeftParen,
+		token_kind.RightParen,
+		token_kind.LeftBracket,
+		token_kind.RightBracket,
+		token_kind.LeftBrace,
+		token_kind.RightBrace,
+		token_kind.Colon,
+		token_kind.Semicolon,
+		token_kind.ReturnArrow,
+		token_kind.Indent,
+		token_kind.NewLine,
+		token_kind.LineJoin,
+	},
+	ESR: GoESR{},
+	// Python normalizes identifiers with NFKC, so that 'ﬁle' and 'file' are
+	// the same identifier.
+	Identifiers: IdentifierRules{Normalization: NFKC},
+}
+
+var JavaScriptProfile = &Profile{
+	Name:       "javascript",
+	Extensions: []string{".js", ".mjs", ".cjs"},
+	Kinds: kindList(cOperatorKinds, []uint32{
+		token_kind.KeywordBreak,
+		token_kind.KeywordClass,
+		token_kind.KeywordConst,
+		token_kind.KeywordContinue,
+		token_kind.KeywordElse,
+		token_kind.KeywordFor,
+		token_kind.KeywordFrom,
+		token_kind.KeywordIf,
+		token_kind.KeywordImport,
+		token_kind.KeywordIn,
+		token_kind.KeywordReturn,
+		token_kind.KeywordTry,
+		token_kind.KeywordWhile,
+		token_kind.KeywordWith,
+		token_kind.KeywordYield,
+		token_kind.KeywordCTrue,
+		token_kind.KeywordCFalse,
+		token_kind.KeywordNull,
+		token_kind.Identifier,
+		token_kind.DoubleQuoteString,
+		token_kind.SingleQuoteString,
+		token_kind.BackQuoteString,
+		token_kind.DecimalInteger,
+		token_kind.HexInteger,
+		token_kind.OctInteger,
+		token_kind.FloatNumber,
+		token_kind.CSingleLineComment,
+		token_kind.CMultiLineComment,
+	}),
+	ESR:         GoESR{},
+	Identifiers: IdentifierRules{ExtraStart: "$"},
+}
+
+// CSS, in which '#' and at-rules like "@media" are read as the
+// CPPStringify and PythonDecorator tokens.
+var CSSProfile = &Profile{
+	Name:       "css",
+	Extensions: []string{".css"},
+	Kinds: []uint32{
+		token_kind.Identifier,
+		token_kind.DoubleQuoteString,
+		token_kind.SingleQuoteString,
+		token_kind.DecimalInteger,
+		token_kind.FloatNumber,
+		token_kind.CMultiLineComment,
+		token_kind.CPPStringify,
+		token_kind.PythonDecorator,
+		token_kind.Add,
+		token_kind.Mul,
+		token_kind.Mod,
+		token_kind.Div,
+		token_kind.Assign,
+		token_kind.LogicalNot,
+		token_kind.GreaterThan,
+		token_kind.BitwiseNeg,
+		token_kind.Dot,
+		token_kind.Comma,
+		token_kind.Colon,
+		token_kind.Semicolon,
+		token_kind.LeftParen,
+		token_kind.RightParen,
+		token_kind.LeftBracket,
+		token_kind.RightBracket,
+		token_kind.LeftBrace,
+		token_kind.RightBrace,
+	},
+	ESR:         GoESR{},
+	Identifiers: IdentifierRules{ExtraContinue: "-"},
+}
+
+// The predefined profiles.
+var Profiles = []*Profile{CProfile, GoProfile, PythonProfile, JavaScriptProfile, CSSProfile}
+
+// Returns the predefined profile named |name|.
+func ProfileByName(name string) (*Profile, error) {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown profile '%s'.", name)
+}
+
+// Returns the predefined profile for the file |path| based on its
+// extension, or nil if no profile matches.
+func ProfileForFile(path string) *Profile {
+	for _, p := range Profiles {
+		if p.Matches(path) {
+			return p
+		}
+	}
+	return nil
+}
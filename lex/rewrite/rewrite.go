@@ -0,0 +1,341 @@
+// Package rewrite replaces the code matching a pattern of package search
+// with a template, like a search-and-replace which understands the tokens.
+//
+// A template is text in which $X, or ${X}, is replaced by the source of
+// the capture X of the pattern, and $$ is a '$'. For example, the pattern
+//
+//	Identifier("printf") LeftParen $ARGS... RightParen
+//
+// with the template "fprintf(stderr, $ARGS)" rewrites the calls of printf.
+// Only the source of the matched tokens is replaced: the white space and
+// the comments around a match are kept, and so are those in the captures,
+// but the comments between the other tokens of a match are lost.
+//
+// The comments and the strings are single tokens, which a pattern only
+// matches as a whole, so Rename renames an identifier without changing
+// the comments and the strings which contain its name.
+//
+// The rewritten text is lexed again, and Rewrite fails rather than return
+// text in which the tokens out of the replacements are not the tokens they
+// were, like when a replacement joins the identifier which follows it or
+// opens a comment which it does not close, or in which a replacement does
+// not lex to the tokens of its text alone.
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"uno/lex"
+	"uno/lex/search"
+	"uno/lex/token_kind"
+)
+
+// A part of a template, which is either text or a capture.
+type part struct {
+	text    string
+	capture string
+}
+
+// A pattern and its replacement.
+type Rule struct {
+	pattern  *search.Pattern
+	template string
+	parts    []part
+	// Whether the template is a name which replaces an identifier.
+	rename bool
+}
+
+// Returns the pattern of the rule.
+func (r *Rule) Pattern() *search.Pattern {
+	return r.pattern
+}
+
+// Returns the template of the rule.
+func (r *Rule) Template() string {
+	return r.template
+}
+
+// Returns the rule which replaces the matches of |p| with |template|.
+// Returns an error if the template refers to a capture which is not in
+// the pattern.
+func NewRule(p *search.Pattern, template string) (*Rule, error) {
+	captures := map[string]bool{}
+	for _, name := range p.Captures() {
+		captures[name] = true
+	}
+
+	r := &Rule{pattern: p, template: template}
+	var text strings.Builder
+	for i := 0; i < len(template); {
+		if template[i] != '$' {
+			text.WriteByte(template[i])
+			i++
+			continue
+		}
+
+		var name string
+		next := i + 1
+		switch {
+		case strings.HasPrefix(template[i:], "$$"):
+			text.WriteByte('$')
+			i += 2
+			continue
+		case strings.HasPrefix(template[i:], "${"):
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid template at %d: Expected '}'.", i+1)
+			}
+			name, next = template[i+2:i+end], i+end+1
+		default:
+			for next < len(template) && search.IsNameChar(template[next]) {
+				next++
+			}
+			name = template[i+1 : next]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("Invalid template at %d: Expected the name of a capture.", i+1)
+		}
+		if !captures[name] {
+			return nil, fmt.Errorf("Invalid template at %d: The pattern has no capture '%s'.", i+1, name)
+		}
+
+		if text.Len() > 0 {
+			r.parts = append(r.parts, part{text: text.String()})
+			text.Reset()
+		}
+		r.parts = append(r.parts, part{capture: name})
+		i = next
+	}
+	if text.Len() > 0 {
+		r.parts = append(r.parts, part{text: text.String()})
+	}
+	return r, nil
+}
+
+// Returns the rule which replaces the matches of the pattern |pattern|
+// with |template|. See package search for the patterns.
+func Compile(pattern, template string) (*Rule, error) {
+	p, err := search.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return NewRule(p, template)
+}
+
+// Returns the rule which renames the identifiers |old| to |new|. Rewrite
+// fails if |new| is not a single identifier in the language of the text.
+func Rename(old, new string) (*Rule, error) {
+	if old == "" || new == "" {
+		return nil, fmt.Errorf("The names of a rename cannot be empty.")
+	}
+	r, err := Compile("Identifier("+strconv.Quote(old)+")", strings.Replace(new, "$", "$$", -1))
+	if err != nil {
+		return nil, err
+	}
+	r.rename = true
+	return r, nil
+}
+
+// A replacement of the source [Start, End) of a text by Text.
+type Edit struct {
+	Start uint32
+	End   uint32
+	// The position of Start in the text.
+	Line uint32
+	Col  uint32
+	Text string
+}
+
+// A token compared by verify, by its kind and its spelling.
+type token struct {
+	kind     uint32
+	spelling string
+}
+
+// Returns the tokens of |refs| in |text| which verify compares, which are
+// not empty and are not part of the line structure, like NewLine.
+func compared(text []byte, refs []lex.TokenRef) []token {
+	var ts []token
+	for _, t := range refs {
+		if !lex.IsLayout(t.Kind) && t.Start < t.End {
+			ts = append(ts, token{t.Kind, string(text[t.Start:t.End])})
+		}
+	}
+	return ts
+}
+
+// Returns the compared tokens of |text| in the language of |p|.
+func textTokens(p *lex.Profile, text string) ([]token, error) {
+	// The new line ends the last token, which the Tokenizer requires.
+	b := []byte(text + "\n")
+	refs, err := tokens(p, b)
+	if err != nil {
+		return nil, err
+	}
+	return compared(b, refs), nil
+}
+
+// Returns the edits which replace the matches of the rule in the tokens
+// |refs| of |text|, in order.
+func (r *Rule) Edits(text []byte, refs []lex.TokenRef) []Edit {
+	var edits []Edit
+	for _, m := range r.pattern.Find(text, refs) {
+		var b strings.Builder
+		for _, p := range r.parts {
+			if p.capture == "" {
+				b.WriteString(p.text)
+			} else if c := m.Captures[p.capture]; c.Start < c.End {
+				b.Write(text[refs[c.Start].Start:refs[c.End-1].End])
+			}
+		}
+		first, last := refs[m.Start], refs[m.End-1]
+		edits = append(edits, Edit{first.Start, last.End, first.Line, first.Col, b.String()})
+	}
+	return edits
+}
+
+// Returns |text| with the edits |edits|, which are in order and do not
+// overlap.
+func Apply(text []byte, edits []Edit) []byte {
+	var out bytes.Buffer
+	end := uint32(0)
+	for _, e := range edits {
+		out.Write(text[end:e.Start])
+		out.WriteString(e.Text)
+		end = e.End
+	}
+	out.Write(text[end:])
+	return out.Bytes()
+}
+
+// Returns the tokens of |text| in the language of |p|.
+func tokens(p *lex.Profile, text []byte) ([]lex.TokenRef, error) {
+	tz, err := p.NewBytesTokenizer(text)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := lex.ReadRefs(tz)
+	if err != nil {
+		line, col := tz.TokenStart()
+		return nil, fmt.Errorf("Error at %d:%d: %s", line, col, err.Error())
+	}
+	return refs, nil
+}
+
+// Returns an error if the tokens of |out|, which is the text with the
+// tokens |refs| and the edits |edits|, are not the tokens of the text out
+// of the edits, or if the tokens of an edit are not the tokens of its text
+// alone.
+func verify(p *lex.Profile, refs []lex.TokenRef, edits []Edit, out []byte) error {
+	got, err := tokens(p, out)
+	if err != nil {
+		return fmt.Errorf("The rewritten text cannot be lexed.\n%s", err.Error())
+	}
+
+	// The tokens out of the edits, by their start. The empty tokens, like
+	// some Indent tokens, are not checked.
+	kept := map[uint32]lex.TokenRef{}
+	e := 0
+	for _, t := range refs {
+		for e < len(edits) && edits[e].End <= t.Start {
+			e++
+		}
+		if t.Start < t.End && (e == len(edits) || t.End <= edits[e].Start) {
+			kept[t.Start] = t
+		}
+	}
+
+	// The ranges of the replacements in |out|.
+	type region struct{ start, end int }
+	regions := make([]region, len(edits))
+	shift := 0
+	for i, e := range edits {
+		start := int(e.Start) - shift
+		regions[i] = region{start, start + len(e.Text)}
+		shift += int(e.End-e.Start) - len(e.Text)
+	}
+
+	// The tokens of |out| in each replacement.
+	replaced := make([][]lex.TokenRef, len(edits))
+	found := 0
+	e, shift = 0, 0
+	for _, t := range got {
+		start, end := int(t.Start), int(t.End)
+		if start == end {
+			continue
+		}
+		for e < len(edits) && regions[e].end <= start {
+			shift += int(edits[e].End-edits[e].Start) - len(edits[e].Text)
+			e++
+		}
+		if e < len(edits) && end > regions[e].start {
+			if start >= regions[e].start && end <= regions[e].end {
+				replaced[e] = append(replaced[e], t)
+				continue
+			}
+			return fmt.Errorf("The rewritten text does not lex to the same tokens at %d:%d.", t.Line, t.Col)
+		}
+		k, ok := kept[uint32(start+shift)]
+		if !ok || k.Kind != t.Kind || k.End-k.Start != t.End-t.Start {
+			return fmt.Errorf("The rewritten text does not lex to the same tokens at %d:%d.", t.Line, t.Col)
+		}
+		found++
+	}
+	if found != len(kept) {
+		return fmt.Errorf("The rewritten text does not lex to the same tokens out of the replacements.")
+	}
+
+	for i, e := range edits {
+		expected, err := textTokens(p, e.Text)
+		if err != nil {
+			return fmt.Errorf("The replacement at %d:%d cannot be lexed.\n%s", e.Line, e.Col, err.Error())
+		}
+		if !equal(compared(out, replaced[i]), expected) {
+			return fmt.Errorf("The replacement at %d:%d does not lex to the tokens of its text.", e.Line, e.Col)
+		}
+	}
+	return nil
+}
+
+// Returns true if |a| and |b| are the same tokens.
+func equal(a, b []token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the text |text| of the language of |p| with the matches of |r|
+// replaced, and the edits. Returns an error if the text cannot be lexed,
+// if the tokens out of the replacements change, or if a replacement does
+// not lex to the tokens of its text. A rename fails if its new name is not
+// an identifier.
+func Rewrite(p *lex.Profile, text []byte, r *Rule) ([]byte, []Edit, error) {
+	if r.rename {
+		name := r.parts[0].text
+		ts, err := textTokens(p, name)
+		if err != nil || len(ts) != 1 || ts[0].kind != token_kind.Identifier || ts[0].spelling != name {
+			return nil, nil, fmt.Errorf("The new name '%s' is not an identifier.", name)
+		}
+	}
+	refs, err := tokens(p, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	edits := r.Edits(text, refs)
+	if len(edits) == 0 {
+		return text, nil, nil
+	}
+	out := Apply(text, edits)
+	if err := verify(p, refs, edits, out); err != nil {
+		return nil, nil, err
+	}
+	return out, edits, nil
+}
@@ -0,0 +1,144 @@
+package rewrite
+
+import (
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func rewrite(t *testing.T, p *lex.Profile, pattern, template, text string) string {
+	r, err := Compile(pattern, template)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	out, _, err := Rewrite(p, []byte(text), r)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return string(out)
+}
+
+func TestRewrite(t *testing.T) {
+	text := `int main(void) {
+  printf("%d\n", /* the count */ n);  // Prints n.
+  printf("%s\n",
+         name(argv[0]));
+}
+`
+	expected := `int main(void) {
+  fprintf(stderr, "%d\n", /* the count */ n);  // Prints n.
+  fprintf(stderr, "%s\n",
+         name(argv[0]));
+}
+`
+	out := rewrite(t, lex.CProfile, `Identifier("printf") LeftParen $ARGS... RightParen`, "fprintf(stderr, $ARGS)", text)
+	if out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	// The captures can be repeated, and ${X} is followed by a name.
+	out = rewrite(t, lex.CProfile, `$X:Identifier AddAssign $Y:_ Semicolon`, "${X}_old = $X; $X = $X + $Y; // $$", "a += 1;\n")
+	if out != "a_old = a; a = a + 1; // $\n" {
+		t.Errorf("Unexpected rewrite %q.", out)
+	}
+}
+
+func TestRename(t *testing.T) {
+	text := `def count(items):
+    # The count of the items.
+    count = len(items)
+    return "count: %d" % count
+`
+	expected := `def total(items):
+    # The count of the items.
+    total = len(items)
+    return "count: %d" % total
+`
+	r, err := Rename("count", "total")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	out, edits, err := Rewrite(lex.PythonProfile, []byte(text), r)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(out) != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, string(out))
+	}
+	if len(edits) != 3 || edits[1].Line != 3 || edits[1].Col != 5 || edits[1].Text != "total" {
+		t.Errorf("Unexpected edits %v.", edits)
+	}
+
+	if _, err := Rename("", "x"); err == nil {
+		t.Errorf("Expected an error for an empty name.")
+	}
+	// The new name must be an identifier, even if nothing is renamed.
+	for _, name := range []string{"a b", "x+y", "1x", "$", " x"} {
+		r, err := Rename("count", name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, _, err := Rewrite(lex.PythonProfile, []byte("x = 1\n"), r); err == nil {
+			t.Errorf("Expected an error for the new name %q.", name)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := map[string][]string{
+		// The replacement joins the tokens around it.
+		"a+b;\n": {"Add", "", "The rewritten text does not lex to the same tokens at 1:1."},
+		// The replacement opens a comment, which is not closed.
+		"a + b; c;\n": {"Add", "/*", "The rewritten text cannot be lexed."},
+		// The replacement opens a comment, which another one closes.
+		"a + b; /* c */\n": {"Identifier(\"b\")", "c /*", "The rewritten text does not lex to the same tokens at 1:7."},
+	}
+	for text, test := range tests {
+		r, err := Compile(test[0], test[1])
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		_, _, err = Rewrite(lex.CProfile, []byte(text), r)
+		if err == nil || !strings.HasPrefix(err.Error(), test[2]) {
+			t.Errorf("Expected the error %q for %q, but got %v.", test[2], text, err)
+		}
+	}
+}
+
+func TestVerifyReplacement(t *testing.T) {
+	text := []byte("a;\n")
+	refs, err := tokens(lex.CProfile, text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	edits := []Edit{{0, 1, 1, 1, "b c"}}
+	if err := verify(lex.CProfile, refs, edits, []byte("b c;\n")); err != nil {
+		t.Errorf("Unexpected error %v.", err)
+	}
+	// The replacement in the text is not the text of the edit.
+	expected := "The replacement at 1:1 does not lex to the tokens of its text."
+	if err := verify(lex.CProfile, refs, edits, []byte("bc ;\n")); err == nil || err.Error() != expected {
+		t.Errorf("Expected the error %q, but got %v.", expected, err)
+	}
+	edits[0].Text = "1x"
+	if err := verify(lex.CProfile, refs, edits, []byte("bc;\n")); err == nil ||
+		!strings.HasPrefix(err.Error(), "The replacement at 1:1 cannot be lexed.") {
+		t.Errorf("Unexpected error %v.", err)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	tests := map[string]string{
+		"$":      "Invalid template at 1: Expected the name of a capture.",
+		"x ${X":  "Invalid template at 3: Expected '}'.",
+		"$X $Y":  "Invalid template at 4: The pattern has no capture 'Y'.",
+		"${}":    "Invalid template at 1: Expected the name of a capture.",
+		"$X.$$Y": "",
+	}
+	for template, expected := range tests {
+		_, err := Compile("$X:Identifier", template)
+		if (err == nil) != (expected == "") || err != nil && err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, but got %v.", expected, template, err)
+		}
+	}
+}
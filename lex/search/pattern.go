@@ -0,0 +1,302 @@
+// Package search finds the places in source text whose tokens match a
+// pattern, like a grep which understands the tokens of the language.
+//
+// A pattern is a sequence of elements separated by white space:
+//
+//	Identifier            a token of the kind Identifier
+//	Identifier("printf")  an Identifier spelled printf
+//	Identifier(/^get/)    an Identifier whose spelling matches a regexp
+//	"("                   a token of any kind spelled (
+//	@string               a token of the highlight class string
+//	_                     any token
+//	A|B                   a token which matches A or B, like @number|Identifier
+//	$X                    any token, captured as X
+//	$X:Identifier         a token which matches Identifier, captured as X
+//	...                   any sequence of tokens with balanced brackets
+//	$ARGS...              the same, captured as ARGS
+//
+// The spelling of a token is its text in the source, so a string token
+// is spelled with its quotes and escapes. A capture which appears twice
+// must match the same spelling twice, so that "$X Assign $X" finds the
+// assignments of a variable to itself. The sequences match as few tokens
+// as possible, and they cannot contain a bracket without its pair, so
+// that "LeftParen $ARGS... RightParen" captures all the arguments of a
+// call, including the nested calls.
+//
+// The comments and the layout tokens, like NewLine and Indent, are
+// skipped in the text.
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// A condition on a token.
+type filter struct {
+	any bool
+	// The kind of the token, if class is not set.
+	kind uint32
+	// The highlight class of the token, if set.
+	class    highlight.Class
+	hasClass bool
+	// The spelling of the token if set, else a regexp for it if set.
+	spelling    string
+	hasSpelling bool
+	re          *regexp.Regexp
+}
+
+// An element of a pattern.
+type element struct {
+	// The token matches one of the filters, unless the element is a
+	// sequence.
+	filters []filter
+	// true for "...".
+	sequence bool
+	// The name of the capture, if any.
+	capture string
+}
+
+// A compiled pattern.
+type Pattern struct {
+	src      string
+	elements []element
+}
+
+// Returns the source of the pattern.
+func (p *Pattern) String() string {
+	return p.src
+}
+
+// Returns the names of the captures of the pattern, in order.
+func (p *Pattern) Captures() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, e := range p.elements {
+		if e.capture != "" && !seen[e.capture] {
+			seen[e.capture] = true
+			names = append(names, e.capture)
+		}
+	}
+	return names
+}
+
+// A parser of a pattern.
+type parser struct {
+	src string
+	pos int
+}
+
+func (ps *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid pattern at %d: %s", ps.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (ps *parser) peek() byte {
+	if ps.pos < len(ps.src) {
+		return ps.src[ps.pos]
+	}
+	return 0
+}
+
+// Returns true if |c| is part of a name, like the name of a token kind or
+// of a capture.
+func IsNameChar(c byte) bool {
+	return c == '_' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+// Reads a name, like the name of a token kind or of a capture.
+func (ps *parser) name() string {
+	start := ps.pos
+	for ps.pos < len(ps.src) && IsNameChar(ps.src[ps.pos]) {
+		ps.pos++
+	}
+	return ps.src[start:ps.pos]
+}
+
+// Reads a Go string literal, quoted with '"' or '`'.
+func (ps *parser) quoted() (string, error) {
+	start := ps.pos
+	q := ps.src[ps.pos]
+	ps.pos++
+	for ps.pos < len(ps.src) && ps.src[ps.pos] != q {
+		if q == '"' && ps.src[ps.pos] == '\\' {
+			ps.pos++
+		}
+		ps.pos++
+	}
+	if ps.pos >= len(ps.src) {
+		ps.pos = start
+		return "", ps.errorf("Unterminated string.")
+	}
+	ps.pos++
+	s, err := strconv.Unquote(ps.src[start:ps.pos])
+	if err != nil {
+		ps.pos = start
+		return "", ps.errorf("Invalid string %s.", ps.src[start:ps.pos])
+	}
+	return s, nil
+}
+
+// Reads a regexp between slashes, in which "\/" is a slash.
+func (ps *parser) regexp() (*regexp.Regexp, error) {
+	start := ps.pos
+	ps.pos++
+	var b strings.Builder
+	for ps.pos < len(ps.src) && ps.src[ps.pos] != '/' {
+		if ps.src[ps.pos] == '\\' && ps.pos+1 < len(ps.src) && ps.src[ps.pos+1] == '/' {
+			ps.pos++
+		}
+		b.WriteByte(ps.src[ps.pos])
+		ps.pos++
+	}
+	if ps.pos >= len(ps.src) {
+		ps.pos = start
+		return nil, ps.errorf("Unterminated regexp.")
+	}
+	ps.pos++
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		ps.pos = start
+		return nil, ps.errorf("%s", err.Error())
+	}
+	return re, nil
+}
+
+// Reads a filter, like Identifier("x").
+func (ps *parser) filter() (filter, error) {
+	var f filter
+	switch c := ps.peek(); {
+	case c == '"' || c == '`':
+		s, err := ps.quoted()
+		f.spelling, f.hasSpelling = s, true
+		f.any = true
+		return f, err
+	case c == '@':
+		ps.pos++
+		start := ps.pos
+		c, err := highlight.ParseClass(ps.name())
+		if err != nil {
+			ps.pos = start
+			return f, ps.errorf("%s", err.Error())
+		}
+		f.class, f.hasClass = c, true
+	case IsNameChar(c):
+		start := ps.pos
+		name := ps.name()
+		if name == "_" {
+			f.any = true
+			return f, nil
+		}
+		k, err := token_kind.ByName(name)
+		if err != nil {
+			ps.pos = start
+			return f, ps.errorf("%s", err.Error())
+		}
+		f.kind = k
+	default:
+		return f, ps.errorf("Unexpected '%c'.", c)
+	}
+
+	// The spelling of a kind or a class.
+	if ps.peek() != '(' {
+		return f, nil
+	}
+	ps.pos++
+	var err error
+	switch ps.peek() {
+	case '"', '`':
+		f.spelling, err = ps.quoted()
+		f.hasSpelling = true
+	case '/':
+		f.re, err = ps.regexp()
+	default:
+		err = ps.errorf("Expected a string or a regexp.")
+	}
+	if err != nil {
+		return f, err
+	}
+	if ps.peek() != ')' {
+		return f, ps.errorf("Expected ')'.")
+	}
+	ps.pos++
+	return f, nil
+}
+
+// Reads the filters of an element, separated by '|'.
+func (ps *parser) filters() ([]filter, error) {
+	var fs []filter
+	for true {
+		f, err := ps.filter()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+		if ps.peek() != '|' {
+			break
+		}
+		ps.pos++
+	}
+	return fs, nil
+}
+
+// Returns the pattern |src| compiled.
+func Compile(src string) (*Pattern, error) {
+	p := &Pattern{src: src}
+	ps := &parser{src: src}
+	for true {
+		for ps.pos < len(src) && unicode.IsSpace(rune(src[ps.pos])) {
+			ps.pos++
+		}
+		if ps.pos == len(src) {
+			break
+		}
+
+		var e element
+		if ps.peek() == '$' {
+			ps.pos++
+			e.capture = ps.name()
+			if e.capture == "" {
+				return nil, ps.errorf("Expected the name of a capture.")
+			}
+		}
+		switch {
+		case strings.HasPrefix(src[ps.pos:], "..."):
+			ps.pos += 3
+			e.sequence = true
+		case e.capture != "" && ps.peek() == ':':
+			ps.pos++
+			fs, err := ps.filters()
+			if err != nil {
+				return nil, err
+			}
+			e.filters = fs
+		case e.capture != "":
+			e.filters = []filter{{any: true}}
+		default:
+			fs, err := ps.filters()
+			if err != nil {
+				return nil, err
+			}
+			e.filters = fs
+		}
+		if c := ps.peek(); c != 0 && !unicode.IsSpace(rune(c)) {
+			return nil, ps.errorf("Expected a space before '%c'.", c)
+		}
+		p.elements = append(p.elements, e)
+	}
+
+	if len(p.elements) == 0 {
+		return nil, fmt.Errorf("The pattern is empty.")
+	}
+	for _, e := range p.elements {
+		if !e.sequence {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("The pattern must match at least one token.")
+}
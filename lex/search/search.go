@@ -0,0 +1,193 @@
+package search
+
+import (
+	"uno/lex"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// A range [Start, End) of the indices of tokens.
+type Range struct {
+	Start int
+	End   int
+}
+
+// A match of a pattern. The ranges are indices in the tokens passed to
+// Find, which include the skipped tokens, like the comments, which are
+// between the matched tokens.
+type Match struct {
+	Range
+	Captures map[string]Range
+}
+
+// Returns true if the tokens of kind |kind| are skipped.
+func skipped(kind uint32) bool {
+	return lex.IsLayout(kind) || highlight.ClassOf(kind) == highlight.Comment
+}
+
+// Returns whether the tokens of kind |kind| are brackets, and whether
+// they open.
+func bracket(kind uint32) (bool, bool) {
+	switch kind {
+	case token_kind.LeftParen, token_kind.LeftBracket, token_kind.LeftBrace:
+		return true, true
+	case token_kind.RightParen, token_kind.RightBracket, token_kind.RightBrace:
+		return true, false
+	}
+	return false, false
+}
+
+// The state of a search in a text.
+type matcher struct {
+	p    *Pattern
+	text []byte
+	refs []lex.TokenRef
+	// The indices in |refs| of the tokens which are not skipped.
+	indices []int
+	// The captures, as ranges of |indices|.
+	captures map[string]Range
+	end      int
+}
+
+func (m *matcher) spelling(i int) string {
+	t := m.refs[m.indices[i]]
+	return string(m.text[t.Start:t.End])
+}
+
+func (f *filter) matches(kind uint32, spelling string) bool {
+	switch {
+	case f.hasClass:
+		if highlight.ClassOf(kind) != f.class {
+			return false
+		}
+	case !f.any:
+		if kind != f.kind {
+			return false
+		}
+	}
+	if f.hasSpelling {
+		return spelling == f.spelling
+	}
+	if f.re != nil {
+		return f.re.MatchString(spelling)
+	}
+	return true
+}
+
+// Returns true if the tokens |r| have the same spellings as the tokens
+// of the capture |c|.
+func (m *matcher) same(c, r Range) bool {
+	if c.End-c.Start != r.End-r.Start {
+		return false
+	}
+	for i := 0; i < c.End-c.Start; i++ {
+		if m.spelling(c.Start+i) != m.spelling(r.Start+i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the elements from |e| match the tokens from |i|, in
+// which case |m.end| is the end of the match.
+func (m *matcher) match(e, i int) bool {
+	if e == len(m.p.elements) {
+		m.end = i
+		return true
+	}
+	el := &m.p.elements[e]
+
+	// Tries the rest of the pattern after the element matches |r|.
+	try := func(r Range) bool {
+		if el.capture == "" {
+			return m.match(e+1, r.End)
+		}
+		if c, ok := m.captures[el.capture]; ok {
+			return m.same(c, r) && m.match(e+1, r.End)
+		}
+		m.captures[el.capture] = r
+		if m.match(e+1, r.End) {
+			return true
+		}
+		delete(m.captures, el.capture)
+		return false
+	}
+
+	if !el.sequence {
+		if i == len(m.indices) {
+			return false
+		}
+		kind, spelling := m.refs[m.indices[i]].Kind, m.spelling(i)
+		for _, f := range el.filters {
+			if f.matches(kind, spelling) {
+				return try(Range{i, i + 1})
+			}
+		}
+		return false
+	}
+
+	// The shortest sequence with balanced brackets first.
+	depth := 0
+	for j := i; true; j++ {
+		if depth == 0 && try(Range{i, j}) {
+			return true
+		}
+		if j == len(m.indices) {
+			break
+		}
+		if isBracket, opens := bracket(m.refs[m.indices[j]].Kind); isBracket {
+			if opens {
+				depth++
+			} else if depth == 0 {
+				break
+			} else {
+				depth--
+			}
+		}
+	}
+	return false
+}
+
+// Returns the range of the tokens of |refs| for the range |r| of the
+// tokens which are not skipped.
+func (m *matcher) toRange(r Range) Range {
+	if r.Start == r.End {
+		if r.Start < len(m.indices) {
+			return Range{m.indices[r.Start], m.indices[r.Start]}
+		}
+		return Range{len(m.refs), len(m.refs)}
+	}
+	return Range{m.indices[r.Start], m.indices[r.End-1] + 1}
+}
+
+// Returns the matches of the pattern in the tokens |refs| of |text|, like
+// the tokens read by the Tokenizer of Profile.NewBytesTokenizer. The
+// matches do not overlap, and a match starts at the first token where the
+// pattern matches after the previous match.
+//
+// The sequences are matched by trying their possible lengths, which can
+// take a time exponential in the number of sequences in a pattern.
+func (p *Pattern) Find(text []byte, refs []lex.TokenRef) []Match {
+	m := &matcher{p: p, text: text, refs: refs}
+	for i, t := range refs {
+		if !skipped(t.Kind) {
+			m.indices = append(m.indices, i)
+		}
+	}
+
+	var matches []Match
+	for i := 0; i < len(m.indices); {
+		m.captures = map[string]Range{}
+		if !m.match(0, i) || m.end == i {
+			i++
+			continue
+		}
+		match := Match{m.toRange(Range{i, m.end}), map[string]Range{}}
+		for name, r := range m.captures {
+			match.Captures[name] = m.toRange(r)
+		}
+		matches = append(matches, match)
+		i = m.end
+	}
+	return matches
+}
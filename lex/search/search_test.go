@@ -0,0 +1,132 @@
+package search
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+const source = `#include <stdio.h>
+
+int main(int argc, char **argv) {
+  printf("%d %s\n", argc, /* the first */ argv[0]);
+  x = x;
+  y = x;
+  printf("%d\n", max(argc, strlen(argv[1])));
+  fprintf(stderr, "done\n");
+  return 0;
+}
+`
+
+func refs(t *testing.T, text string) []lex.TokenRef {
+	tz, err := lex.CProfile.NewBytesTokenizer([]byte(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var refs []lex.TokenRef
+	for tz.HasNext() {
+		r, err := tz.NextRef()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		refs = append(refs, r)
+	}
+	return refs
+}
+
+// Returns the text of the matches, and of the capture |name| of each.
+func find(t *testing.T, pattern, name string) ([]string, []string) {
+	p, err := Compile(pattern)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rs := refs(t, source)
+	slice := func(r Range) string {
+		if r.Start == r.End {
+			return ""
+		}
+		return source[rs[r.Start].Start:rs[r.End-1].End]
+	}
+	var texts, captures []string
+	for _, m := range p.Find([]byte(source), rs) {
+		texts = append(texts, slice(m.Range))
+		if name != "" {
+			captures = append(captures, slice(m.Captures[name]))
+		}
+	}
+	return texts, captures
+}
+
+func checkStrings(t *testing.T, what string, got, expected []string) {
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the %s\n%s\nbut got\n%s", what, strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestFind(t *testing.T) {
+	texts, args := find(t, `Identifier("printf") LeftParen $ARGS... RightParen`, "ARGS")
+	checkStrings(t, "matches", texts, []string{
+		`printf("%d %s\n", argc, /* the first */ argv[0])`,
+		`printf("%d\n", max(argc, strlen(argv[1])))`,
+	})
+	checkStrings(t, "captures", args, []string{
+		`"%d %s\n", argc, /* the first */ argv[0]`,
+		`"%d\n", max(argc, strlen(argv[1]))`,
+	})
+
+	// A capture which appears twice matches the same spelling.
+	texts, _ = find(t, `$X:Identifier Assign $X Semicolon`, "")
+	checkStrings(t, "matches", texts, []string{"x = x;"})
+
+	// Regexps, classes, alternatives and spellings.
+	texts, _ = find(t, `Identifier(/printf$/) "(" @identifier|@string ...`, "")
+	checkStrings(t, "matches", texts, []string{`printf("%d %s\n"`, `printf("%d\n"`, `fprintf(stderr`})
+
+	texts, names := find(t, `$F:Identifier "(" _ "," $REST... ")" Semicolon`, "F")
+	checkStrings(t, "matches", texts, []string{
+		`printf("%d %s\n", argc, /* the first */ argv[0]);`,
+		`printf("%d\n", max(argc, strlen(argv[1])));`,
+		`fprintf(stderr, "done\n");`,
+	})
+	checkStrings(t, "captures", names, []string{"printf", "printf", "fprintf"})
+
+	// The brackets of a sequence are balanced.
+	texts, _ = find(t, `Identifier("max") ... RightParen Semicolon`, "")
+	checkStrings(t, "matches", texts, []string{`max(argc, strlen(argv[1])));`})
+	texts, _ = find(t, `LeftBracket ... RightParen`, "")
+	checkStrings(t, "matches", texts, nil)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                "The pattern is empty.",
+		"... $X...":       "The pattern must match at least one token.",
+		"Identifer":       "Invalid pattern at 1: Unknown token kind 'Identifer'.",
+		"Identifier(x)":   "Invalid pattern at 12: Expected a string or a regexp.",
+		`Identifier("x"`:  "Invalid pattern at 15: Expected ')'.",
+		`"abc`:            "Invalid pattern at 1: Unterminated string.",
+		"Identifier(/[/)": "Invalid pattern at 12: error parsing regexp: missing closing ]: `[`",
+		"@keywords":       "Invalid pattern at 2: Unknown class 'keywords'.",
+		"$ Identifier":    "Invalid pattern at 2: Expected the name of a capture.",
+		"Identifier;":     "Invalid pattern at 11: Expected a space before ';'.",
+		"Identifier|":     "Invalid pattern at 12: Unexpected '\x00'.",
+	}
+	for pattern, expected := range tests {
+		_, err := Compile(pattern)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, but got %v.", expected, pattern, err)
+		}
+	}
+
+	p, err := Compile("$A $B... $A")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if names := p.Captures(); strings.Join(names, ",") != "A,B" || p.String() != "$A $B... $A" {
+		t.Errorf("Unexpected captures %v.", names)
+	}
+}
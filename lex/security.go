@@ -0,0 +1,321 @@
+package lex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"uno/lex/token_kind"
+)
+
+// The kind of a Warning.
+type WarningKind uint32
+
+const (
+	// A bidirectional control character, which can make the code look
+	// different from what it is (CVE-2021-42574, "Trojan Source").
+	BidiControlWarning = WarningKind(iota)
+	// An identifier with characters of scripts which are not usually mixed.
+	MixedScriptWarning
+	// An identifier which can be confused with another identifier, or with
+	// an identifier of ASCII characters.
+	ConfusableWarning
+)
+
+func (k WarningKind) String() string {
+	switch k {
+	case BidiControlWarning:
+		return "bidi-control"
+	case MixedScriptWarning:
+		return "mixed-script"
+	case ConfusableWarning:
+		return "confusable"
+	}
+	return fmt.Sprintf("WarningKind(%d)", uint32(k))
+}
+
+// A warning of the security checks about a token. See SetSecurityChecks.
+type Warning struct {
+	Kind WarningKind
+	// The position of the character the warning is about, or of the token.
+	Line uint32
+	Col  uint32
+	// The kind of the token.
+	TokenKind uint32
+	Message   string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Col, w.Message)
+}
+
+// The bidirectional control characters.
+var bidiControls = map[rune]string{
+	0x061C: "ARABIC LETTER MARK",
+	0x200E: "LEFT-TO-RIGHT MARK",
+	0x200F: "RIGHT-TO-LEFT MARK",
+	0x202A: "LEFT-TO-RIGHT EMBEDDING",
+	0x202B: "RIGHT-TO-LEFT EMBEDDING",
+	0x202C: "POP DIRECTIONAL FORMATTING",
+	0x202D: "LEFT-TO-RIGHT OVERRIDE",
+	0x202E: "RIGHT-TO-LEFT OVERRIDE",
+	0x2066: "LEFT-TO-RIGHT ISOLATE",
+	0x2067: "RIGHT-TO-LEFT ISOLATE",
+	0x2068: "FIRST STRONG ISOLATE",
+	0x2069: "POP DIRECTIONAL ISOLATE",
+}
+
+// The prototypes of confusable characters. It is a hand-picked subset of
+// the confusables.txt mappings of Unicode TR39, of the Latin, Greek,
+// Cyrillic and Armenian letters which are confused with ASCII letters and
+// digits. It is not the full table: identifiers made confusable by the
+// other characters of confusables.txt, like the mathematical letters or
+// the letters of other scripts, are not reported, and the skeletons of
+// two such identifiers are compared without the mappings.
+var confusables = map[rune]rune{
+	0x0030: 'O', // DIGIT ZERO
+	0x0031: 'l', // DIGIT ONE
+	0x0049: 'l', // LATIN CAPITAL LETTER I
+	0x0131: 'i', // LATIN SMALL LETTER DOTLESS I
+	0x01C0: 'l', // LATIN LETTER DENTAL CLICK
+	0x0261: 'g', // LATIN SMALL LETTER SCRIPT G
+	0x0269: 'i', // LATIN SMALL LETTER IOTA
+	0x0391: 'A', // GREEK CAPITAL LETTER ALPHA
+	0x0392: 'B', // GREEK CAPITAL LETTER BETA
+	0x0395: 'E', // GREEK CAPITAL LETTER EPSILON
+	0x0396: 'Z', // GREEK CAPITAL LETTER ZETA
+	0x0397: 'H', // GREEK CAPITAL LETTER ETA
+	0x0399: 'l', // GREEK CAPITAL LETTER IOTA
+	0x039A: 'K', // GREEK CAPITAL LETTER KAPPA
+	0x039C: 'M', // GREEK CAPITAL LETTER MU
+	0x039D: 'N', // GREEK CAPITAL LETTER NU
+	0x039F: 'O', // GREEK CAPITAL LETTER OMICRON
+	0x03A1: 'P', // GREEK CAPITAL LETTER RHO
+	0x03A4: 'T', // GREEK CAPITAL LETTER TAU
+	0x03A5: 'Y', // GREEK CAPITAL LETTER UPSILON
+	0x03A7: 'X', // GREEK CAPITAL LETTER CHI
+	0x03B1: 'a', // GREEK SMALL LETTER ALPHA
+	0x03B9: 'i', // GREEK SMALL LETTER IOTA
+	0x03BD: 'v', // GREEK SMALL LETTER NU
+	0x03BF: 'o', // GREEK SMALL LETTER OMICRON
+	0x03C1: 'p', // GREEK SMALL LETTER RHO
+	0x03C5: 'u', // GREEK SMALL LETTER UPSILON
+	0x0405: 'S', // CYRILLIC CAPITAL LETTER DZE
+	0x0406: 'l', // CYRILLIC CAPITAL LETTER BYELORUSSIAN-UKRAINIAN I
+	0x0408: 'J', // CYRILLIC CAPITAL LETTER JE
+	0x0410: 'A', // CYRILLIC CAPITAL LETTER A
+	0x0412: 'B', // CYRILLIC CAPITAL LETTER VE
+	0x0415: 'E', // CYRILLIC CAPITAL LETTER IE
+	0x0417: '3', // CYRILLIC CAPITAL LETTER ZE
+	0x041A: 'K', // CYRILLIC CAPITAL LETTER KA
+	0x041C: 'M', // CYRILLIC CAPITAL LETTER EM
+	0x041D: 'H', // CYRILLIC CAPITAL LETTER EN
+	0x041E: 'O', // CYRILLIC CAPITAL LETTER O
+	0x0420: 'P', // CYRILLIC CAPITAL LETTER ER
+	0x0421: 'C', // CYRILLIC CAPITAL LETTER ES
+	0x0422: 'T', // CYRILLIC CAPITAL LETTER TE
+	0x0425: 'X', // CYRILLIC CAPITAL LETTER HA
+	0x0430: 'a', // CYRILLIC SMALL LETTER A
+	0x0435: 'e', // CYRILLIC SMALL LETTER IE
+	0x043E: 'o', // CYRILLIC SMALL LETTER O
+	0x0440: 'p', // CYRILLIC SMALL LETTER ER
+	0x0441: 'c', // CYRILLIC SMALL LETTER ES
+	0x0443: 'y', // CYRILLIC SMALL LETTER U
+	0x0445: 'x', // CYRILLIC SMALL LETTER HA
+	0x0455: 's', // CYRILLIC SMALL LETTER DZE
+	0x0456: 'i', // CYRILLIC SMALL LETTER BYELORUSSIAN-UKRAINIAN I
+	0x0458: 'j', // CYRILLIC SMALL LETTER JE
+	0x0475: 'v', // CYRILLIC SMALL LETTER IZHITSA
+	0x04AE: 'Y', // CYRILLIC CAPITAL LETTER STRAIGHT U
+	0x04BB: 'h', // CYRILLIC SMALL LETTER SHHA
+	0x04CF: 'l', // CYRILLIC SMALL LETTER PALOCHKA
+	0x0501: 'd', // CYRILLIC SMALL LETTER KOMI DE
+	0x051B: 'q', // CYRILLIC SMALL LETTER QA
+	0x051D: 'w', // CYRILLIC SMALL LETTER WE
+	0x0570: 'h', // ARMENIAN SMALL LETTER HO
+	0x0578: 'n', // ARMENIAN SMALL LETTER VO
+	0x057D: 'u', // ARMENIAN SMALL LETTER SEH
+	0x0581: 'g', // ARMENIAN SMALL LETTER CO
+	0x0585: 'o', // ARMENIAN SMALL LETTER OH
+	0x1D0F: 'o', // LATIN LETTER SMALL CAPITAL O
+}
+
+// The sets of scripts which can be mixed in an identifier, as in the
+// Highly Restrictive level of Unicode TR39.
+var allowedScriptSets = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+// The scripts looked up first, as they are the most common.
+var commonScripts = []string{"Latin", "Cyrillic", "Greek", "Han", "Hiragana", "Katakana", "Hangul",
+	"Arabic", "Hebrew", "Devanagari", "Armenian"}
+
+// Returns the script of |c|, like "Latin", or "Common" and "Inherited"
+// for the characters which are used with many scripts.
+func scriptOf(c rune) string {
+	if c < utf8.RuneSelf {
+		if isASCIILetter(c) {
+			return "Latin"
+		}
+		return "Common"
+	}
+	for _, name := range commonScripts {
+		if unicode.Is(unicode.Scripts[name], c) {
+			return name
+		}
+	}
+	for name, t := range unicode.Scripts {
+		if unicode.Is(t, c) {
+			return name
+		}
+	}
+	return "Unknown"
+}
+
+// Returns the skeleton of |s| of Unicode TR39. Two strings with the same
+// skeleton are confusable.
+func skeleton(s []rune) string {
+	d := NFC.decomposeRunes(s)
+	for i, c := range d {
+		if p, e := confusables[c]; e {
+			d[i] = p
+		}
+	}
+	return string(NFC.decomposeRunes(d))
+}
+
+// The first identifier with a skeleton.
+type identifierSite struct {
+	value     string
+	line, col uint32
+}
+
+// If |on| is true, the tokens are checked for bidirectional control
+// characters, identifiers mixing scripts and confusable identifiers. The
+// problems found are returned by Warnings. It should be called before
+// reading any token.
+func (tz *Tokenizer) SetSecurityChecks(on bool) {
+	tz.security = on
+	tz.r.record = on
+}
+
+// Returns the warnings of the security checks about the tokens read so
+// far. See SetSecurityChecks.
+func (tz *Tokenizer) Warnings() []Warning {
+	return tz.warnings
+}
+
+func (tz *Tokenizer) warn(kind WarningKind, tt, line, col uint32, format string, args ...interface{}) {
+	tz.warnings = append(tz.warnings, Warning{
+		Kind:      kind,
+		Line:      line,
+		Col:       col,
+		TokenKind: tt,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Checks the token of the kind |tt| with the value |val| at |line| and
+// |col|. The bidirectional control characters are looked for in the
+// source of the token, as recorded by the CharReader, so that their
+// positions are those in the source, and that the escape sequences which
+// stand for them, like "\u202e", are not reported.
+func (tz *Tokenizer) checkSecurity(tt uint32, val []rune, line, col uint32) {
+	for _, rc := range tz.r.recorded {
+		if name, e := bidiControls[rc.c]; e {
+			tz.warn(BidiControlWarning, tt, rc.line, rc.col,
+				"Bidirectional control character %U (%s) in a %s token.", rc.c, name, token_kind.Name(tt))
+		}
+	}
+
+	if tt == token_kind.Identifier {
+		ascii := true
+		for _, c := range val {
+			if c >= utf8.RuneSelf {
+				ascii = false
+				break
+			}
+		}
+		tz.checkIdentifier(val, ascii, line, col)
+	}
+}
+
+// Checks the identifier |val|. The identifiers of ASCII characters are
+// only recorded, to find the other identifiers confusable with them.
+func (tz *Tokenizer) checkIdentifier(val []rune, ascii bool, line, col uint32) {
+	id := string(val)
+
+	var scripts map[string]bool
+	if !ascii {
+		scripts = map[string]bool{}
+		for _, c := range val {
+			if s := scriptOf(c); s != "Common" && s != "Inherited" {
+				scripts[s] = true
+			}
+		}
+		if len(scripts) > 1 && !allowedScripts(scripts) {
+			tz.warn(MixedScriptWarning, token_kind.Identifier, line, col,
+				"Identifier '%s' mixes the scripts %s.", id, scriptList(scripts))
+		}
+	}
+
+	sk := skeleton(val)
+	if !ascii && !scripts["Latin"] && isASCIIString(sk) {
+		tz.warn(ConfusableWarning, token_kind.Identifier, line, col,
+			"Identifier '%s' can be confused with '%s'.", id, sk)
+	}
+
+	if tz.skeletons == nil {
+		tz.skeletons = map[string]identifierSite{}
+	}
+	site, e := tz.skeletons[sk]
+	if !e {
+		tz.skeletons[sk] = identifierSite{id, line, col}
+		return
+	}
+	// Identifiers of ASCII characters like 'l1' and 'll' are not reported,
+	// as they are rarely malicious.
+	if site.value != id && !(ascii && isASCIIString(site.value)) {
+		tz.warn(ConfusableWarning, token_kind.Identifier, line, col,
+			"Identifier '%s' can be confused with '%s' at %d:%d.", id, site.value, site.line, site.col)
+	}
+}
+
+// Returns true if the scripts of |scripts| can be mixed.
+func allowedScripts(scripts map[string]bool) bool {
+	for _, allowed := range allowedScriptSets {
+		ok := true
+		for s := range scripts {
+			if !allowed[s] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the names of |scripts| in order, like "Cyrillic and Latin".
+func scriptList(scripts map[string]bool) string {
+	var names []string
+	for s := range scripts {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+func isASCIIString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package lex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSecurityChecks(t *testing.T) {
+	text, err := ioutil.ReadFile("test_data/security_text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	tz, err := CProfile.NewTokenizer(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz.SetSecurityChecks(true)
+	if _, _, err := tokenValues(tz); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []Warning{
+		{BidiControlWarning, 1, 3, 0, ""},
+		{BidiControlWarning, 1, 7, 0, ""},
+		{BidiControlWarning, 1, 20, 0, ""},
+		{BidiControlWarning, 1, 22, 0, ""},
+		{MixedScriptWarning, 3, 1, 0, ""},
+		{ConfusableWarning, 3, 1, 0, ""},
+		{ConfusableWarning, 4, 1, 0, ""},
+		{BidiControlWarning, 5, 9, 0, ""},
+		// The column is in the source, after the escape sequences.
+		{BidiControlWarning, 7, 10, 0, ""},
+	}
+	warnings := tz.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, but got %d: %v", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		e := expected[i]
+		if w.Kind != e.Kind || w.Line != e.Line || w.Col != e.Col {
+			t.Errorf("Expected a %s warning at %d:%d, but got a %s warning '%s'.", e.Kind, e.Line, e.Col, w.Kind, w)
+		}
+	}
+	if m := warnings[5].Message; !strings.Contains(m, "'paypal' at 2:1") {
+		t.Errorf("Unexpected message '%s'.", m)
+	}
+	if m := warnings[6].Message; !strings.Contains(m, "'scope'") {
+		t.Errorf("Unexpected message '%s'.", m)
+	}
+
+	// The checks are off by default.
+	tz, err = CProfile.NewTokenizer(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, _, err := tokenValues(tz); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(tz.Warnings()) != 0 {
+		t.Errorf("Expected no warnings without the security checks.")
+	}
+}
+
+func TestSecurityChecksRefs(t *testing.T) {
+	tz, err := NewBytesTokenizer([]byte("x = \"\u202e\"\n"), GoProfile.TokenKindSet(), GoESR{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz.SetSecurityChecks(true)
+	for tz.HasNext() {
+		if _, err := tz.NextRef(); err != nil {
+			break
+		}
+	}
+	if w := tz.Warnings(); len(w) != 1 || w[0].Kind != BidiControlWarning || w[0].Col != 6 {
+		t.Errorf("Unexpected warnings %v.", w)
+	}
+}
+
+// An EscSeqReader which reads the escape sequences of GoESR and "\uXXXX".
+type unicodeESR struct{}
+
+func (unicodeESR) ReadChar(r *CharReader, tt uint32) (rune, error) {
+	if c, err := r.PeekChar(); err != nil || c != 'u' {
+		return GoESR{}.ReadChar(r, tt)
+	}
+	s, err := r.ReadSlice(5)
+	if err != nil {
+		return 0, err
+	}
+	c, err := strconv.ParseUint(string(s[1:]), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid escape sequence.")
+	}
+	return rune(c), nil
+}
+
+func TestSecurityChecksEscapes(t *testing.T) {
+	tz, err := NewTokenizer(strings.NewReader("x = \"\\u202e\";\n"), CProfile.TokenKindSet(), unicodeESR{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz.SetSecurityChecks(true)
+	values, _, err := tokenValues(tz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if values[2] != "\"\u202e\"" {
+		t.Fatalf("Expected the escape sequence to be decoded, but got %q.", values[2])
+	}
+	// The escape sequence is not a bidirectional control character in the
+	// source.
+	if w := tz.Warnings(); len(w) != 0 {
+		t.Errorf("Unexpected warnings %v.", w)
+	}
+}
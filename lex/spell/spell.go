@@ -0,0 +1,94 @@
+// Package spell checks the spelling of the words of the comments, the
+// strings and the identifiers extracted by package extract, with the words
+// of dictionaries.
+//
+// A dictionary is a list of words, one per line, like /usr/share/dict/words
+// or a custom list of the names of a project. The affixes of the Hunspell
+// dictionaries, after a '/', are ignored. A word of the text is spelled
+// right if it is in a dictionary as is or in lower case, so that "The"
+// matches "the" but "paris" does not match "Paris".
+package spell
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+	"uno/lex/extract"
+)
+
+// A set of the words which are spelled right.
+type Dictionary struct {
+	words map[string]bool
+}
+
+// Returns a new empty Dictionary.
+func NewDictionary() *Dictionary {
+	return &Dictionary{map[string]bool{}}
+}
+
+// Adds the word |word| to the dictionary.
+func (d *Dictionary) Add(word string) {
+	d.words[word] = true
+}
+
+// Adds the words of |r|, one per line. The blank lines and the lines which
+// begin with '#' are skipped.
+func (d *Dictionary) Read(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if i := strings.IndexByte(line, '/'); i > 0 {
+			line = line[:i]
+		}
+		d.Add(line)
+	}
+	return s.Err()
+}
+
+// Returns the number of words of the dictionary.
+func (d *Dictionary) Len() int {
+	return len(d.words)
+}
+
+// Returns true if |word| is spelled right.
+func (d *Dictionary) Contains(word string) bool {
+	return d.words[word] || d.words[strings.ToLower(word)]
+}
+
+// The options of Check.
+type Options struct {
+	// The words of fewer characters are not checked. If it is not
+	// positive, DefaultMinLength is used.
+	MinLength int
+}
+
+// The default minimum length of the words which are checked.
+const DefaultMinLength = 3
+
+// A word which is not in the dictionary.
+type Misspelling struct {
+	extract.Word
+	// The kind of the token of the word.
+	Kind uint32
+}
+
+// Returns the words of |items| which are not in |d|, in order.
+func Check(items []extract.Item, d *Dictionary, o *Options) []Misspelling {
+	min := DefaultMinLength
+	if o != nil && o.MinLength > 0 {
+		min = o.MinLength
+	}
+	var misspellings []Misspelling
+	for i := range items {
+		for _, w := range items[i].Words() {
+			if utf8.RuneCountInString(w.Text) >= min && !d.Contains(w.Text) {
+				misspellings = append(misspellings, Misspelling{w, items[i].Kind})
+			}
+		}
+	}
+	return misspellings
+}
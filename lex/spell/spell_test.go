@@ -0,0 +1,64 @@
+package spell
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"uno/lex"
+	"uno/lex/extract"
+)
+
+const words = `# The words of the test.
+the
+Paris
+read/SB
+file
+count
+items
+`
+
+func TestCheck(t *testing.T) {
+	d := NewDictionary()
+	if err := d.Read(strings.NewReader(words)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if d.Len() != 6 || !d.Contains("The") || !d.Contains("read") || d.Contains("paris") {
+		t.Errorf("Unexpected dictionary %v.", d.words)
+	}
+
+	text := "# Teh count of the items in Paris.\nreadFile = \"the fiel\"\n"
+	tz, err := lex.PythonProfile.NewBytesTokenizer([]byte(text))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var tokens []*lex.Token
+	var spellings []extract.Spelling
+	for tz.HasNext() {
+		tok, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		start, end := tz.Offsets()
+		tokens = append(tokens, tok)
+		spellings = append(spellings, extract.Spelling{Text: text[start:end], Offsets: append([]uint32(nil), tz.ValueOffsets()...)})
+	}
+
+	items := extract.Extract(tokens, spellings, &extract.Options{Comments: true, Strings: true, Identifiers: true})
+	var got []string
+	for _, m := range Check(items, d, nil) {
+		got = append(got, fmt.Sprintf("%d:%d %s", m.Line, m.Col, m.Text))
+	}
+	if expected := []string{"1:3 Teh", "2:17 fiel"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the misspellings %v, but got %v.", expected, got)
+	}
+
+	// "in" and "of" are too short to be checked unless MinLength is 1.
+	if n := len(Check(items, d, &Options{MinLength: 1})); n != 4 {
+		t.Errorf("Expected 4 misspellings, but got %d.", n)
+	}
+}
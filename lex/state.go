@@ -0,0 +1,230 @@
+package lex
+
+import (
+	"fmt"
+	"io"
+	"uno/lex/token_kind"
+)
+
+// The state of a Tokenizer between two tokens. It has all that is
+// required to resume lexing from that point with NewTokenizerFromState,
+// which allows a text to be lexed a line at a time, like syntax
+// highlighters do. All fields are exported so that a State can be
+// serialised with packages like encoding/json and encoding/gob.
+//
+// The zero State is the state at the beginning of a text.
+type State struct {
+	// The line, column and byte offset of the next character.
+	Line   uint32
+	Col    uint32
+	Offset uint32
+
+	// true if the last new line read was a part of a line join.
+	Joined bool
+
+	// The kind of the multiline token which was not terminated before
+	// the end of the input. It is token_kind.CMultiLineComment or
+	// token_kind.PyMultilineString, or token_kind.Invalid if no token is
+	// open.
+	Open uint32
+
+	// The widths of the enclosing indentation levels, outermost first.
+	// The level of width 0 is not included. Tabs advance the width to the
+	// next multiple of 8, like in Python. Indentation is tracked only if
+	// token_kind.Indent is present in the token kind set, and the lines
+	// within brackets do not change it.
+	Indents []uint32
+
+	// The kinds of the opening brackets which are not closed yet,
+	// innermost last. It is the stack of bracket modes the lexer is in.
+	Brackets []uint32
+}
+
+// Returns the number of brackets which are not closed yet.
+func (s State) ParenDepth() int {
+	return len(s.Brackets)
+}
+
+// Returns true if |s| and |o| have the same lexical state, false
+// otherwise. The positions are not compared, so a line whose end state
+// is equal before and after an edit does not affect the tokens of the
+// lines following it.
+func (s State) Equal(o State) bool {
+	if s.Joined != o.Joined || s.Open != o.Open {
+		return false
+	}
+	return equalStacks(s.Indents, o.Indents) && equalStacks(s.Brackets, o.Brackets)
+}
+
+func equalStacks(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the current state of the Tokenizer.
+func (tz *Tokenizer) State() State {
+	return State{
+		Line:     tz.r.NextLine(),
+		Col:      tz.r.NextCol(),
+		Offset:   tz.r.NextOffset(),
+		Joined:   tz.joined,
+		Open:     tz.open,
+		Indents:  append([]uint32(nil), tz.indents...),
+		Brackets: append([]uint32(nil), tz.brackets...),
+	}
+}
+
+// Returns a new Tokenizer which resumes lexing in the state |st|. The
+// input |r| should begin at the point at which |st| was taken.
+//
+// Unlike a Tokenizer created by NewTokenizer, the returned Tokenizer
+// does not report an error if the input ends within a multiline comment
+// or string. The part read is returned as a token of that kind, and the
+// token is left open in the State of the Tokenizer. The Tokenizer which
+// resumes from that State returns the rest of the token first.
+func NewTokenizerFromState(r io.RuneReader, s TokenKindSet, esr EscSeqReader, st State) (*Tokenizer, error) {
+	tz, err := NewTokenizer(r, s, esr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch st.Open {
+	case token_kind.Invalid:
+	case token_kind.CMultiLineComment, token_kind.PyMultilineString:
+		if !s.Contains(st.Open) {
+			return nil, fmt.Errorf("The open token kind %d is not in the TokenKindSet.", st.Open)
+		}
+	default:
+		return nil, fmt.Errorf("Token kind %d cannot be open.", st.Open)
+	}
+
+	line := st.Line
+	if line == 0 {
+		line = 1
+	}
+	if st.Col <= 1 {
+		tz.r.line = line - 1
+	} else {
+		tz.r.line = line
+		tz.r.col = st.Col - 1
+		tz.r.nextCol = st.Col
+		tz.r.newLine = false
+	}
+	tz.r.offset = st.Offset
+
+	tz.partial = true
+	tz.joined = st.Joined
+	tz.open = st.Open
+	tz.indents = append([]uint32(nil), st.Indents...)
+	tz.brackets = append([]uint32(nil), st.Brackets...)
+	return tz, nil
+}
+
+// Reads characters and appends them to |s| until |s| ends with |end|.
+// If the input ends before that and the Tokenizer was created by
+// NewTokenizerFromState, |kind| is left open and no error is returned.
+func (tz *Tokenizer) readUntil(s []rune, end string, kind uint32) ([]rune, error) {
+	n := len([]rune(end))
+	for true {
+		if tz.partial {
+			if _, err := tz.r.PeekChar(); err == io.EOF {
+				tz.open = kind
+				return s, nil
+			}
+		}
+
+		c, err := tz.r.ReadChar()
+		if err != nil {
+			return nil, err
+		}
+
+		s = append(s, c)
+
+		if l := len(s); l >= n && string(s[l-n:l]) == end {
+			break
+		}
+	}
+
+	tz.open = token_kind.Invalid
+	return s, nil
+}
+
+// Reads the rest of the open multiline token.
+func (tz *Tokenizer) readOpenToken() (*Token, error) {
+	line := tz.r.NextLine()
+	col := tz.r.NextCol()
+
+	kind := tz.open
+	end := "*/"
+	if kind == token_kind.PyMultilineString {
+		end = TripleQuote
+	}
+	tz.startOffset = tz.r.NextOffset()
+	tz.startLine, tz.startCol = line, col
+	tz.valueOffsets = nil
+	tz.r.recorded = tz.r.recorded[:0]
+	s, err := tz.readUntil(tz.runes[:0], end, kind)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading open multiline token.\n%s", err.Error())
+	}
+
+	// The line on which the token began has been accounted for already.
+	tz.lineBegins = false
+	return tz.makeToken(kind, s, line, col), nil
+}
+
+// Returns the width of the indentation |v|.
+func indentWidth(v []rune) uint32 {
+	col := uint32(1)
+	for _, c := range v {
+		col = advanceColumn(col, c, VisualColumns, 8)
+	}
+	return col - 1
+}
+
+// Updates the indentation and the bracket stacks with |t|, the token
+// just read.
+func (tz *Tokenizer) updateState(t *Token) {
+	switch t.Kind {
+	case token_kind.Indent:
+		if tz.lineBegins {
+			tz.lineIndent = tz.indentWidth
+		}
+		return
+	case token_kind.NewLine, token_kind.LineJoin, token_kind.PySingleLineComment,
+		token_kind.CSingleLineComment, token_kind.CMultiLineComment:
+		// Blank lines and lines with only comments do not change the
+		// indentation.
+		return
+	}
+
+	if tz.lineBegins {
+		tz.lineBegins = false
+		if tz.indent && len(tz.brackets) == 0 {
+			n := len(tz.indents)
+			for n > 0 && tz.indents[n-1] > tz.lineIndent {
+				n -= 1
+			}
+			tz.indents = tz.indents[:n]
+			if tz.lineIndent > 0 && (n == 0 || tz.indents[n-1] < tz.lineIndent) {
+				tz.indents = append(tz.indents, tz.lineIndent)
+			}
+		}
+	}
+
+	switch t.Kind {
+	case token_kind.LeftParen, token_kind.LeftBracket, token_kind.LeftBrace:
+		tz.brackets = append(tz.brackets, t.Kind)
+	case token_kind.RightParen, token_kind.RightBracket, token_kind.RightBrace:
+		if n := len(tz.brackets); n > 0 {
+			tz.brackets = tz.brackets[:n-1]
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package lex
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+// Lexes |text| a line at a time, resuming each line from the state at the
+// end of the previous line. Returns the tokens and the state at the end
+// of each line.
+func tokenizeLines(text string, kinds []uint32) ([]*Token, []State, error) {
+	ts := NewTokenKindSet(kinds)
+	var goEsr GoESR
+
+	var tokens []*Token
+	var states []State
+	var st State
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+
+		tz, err := NewTokenizerFromState(strings.NewReader(line), ts, goEsr, st)
+		if err != nil {
+			return nil, nil, err
+		}
+		for tz.HasNext() {
+			t, err := tz.NextToken()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			tokens = append(tokens, t)
+		}
+		st = tz.State()
+		states = append(states, st)
+	}
+	return tokens, states, nil
+}
+
+func TestStateByLine(t *testing.T) {
+	text, err := ioutil.ReadFile("test_data/state_text")
+	if err != nil {
+		t.Fatalf("Error reading test file.\n%s", err.Error())
+	}
+
+	tokens, states, err := tokenizeLines(string(text), incrementalTokenKinds)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	type lineState struct {
+		open     uint32
+		indents  []uint32
+		brackets []uint32
+	}
+	expected := []lineState{
+		{token_kind.Invalid, nil, nil},
+		{token_kind.Invalid, []uint32{4}, []uint32{token_kind.LeftParen}},
+		{token_kind.Invalid, []uint32{4}, nil},
+		{token_kind.PyMultilineString, []uint32{4, 8}, nil},
+		{token_kind.Invalid, []uint32{4, 8}, nil},
+		{token_kind.Invalid, []uint32{4, 8}, nil},
+		{token_kind.Invalid, []uint32{4, 8}, nil},
+		{token_kind.Invalid, []uint32{4, 8}, nil},
+		{token_kind.Invalid, []uint32{4}, nil},
+		{token_kind.Invalid, nil, nil},
+	}
+	if len(states) != len(expected) {
+		t.Fatalf("Expected %d lines, but got %d.", len(expected), len(states))
+	}
+	for i, exp := range expected {
+		st := states[i]
+		if st.Line != uint32(i+2) || st.Col != 1 {
+			t.Errorf("Expected state at %d:1 after line %d, but got %d:%d.", i+2, i+1, st.Line, st.Col)
+		}
+		e := State{Open: exp.open, Indents: exp.indents, Brackets: exp.brackets}
+		if !st.Equal(e) {
+			t.Errorf("Expected state %v after line %d, but got %v.", e, i+1, st)
+		}
+	}
+
+	// The multiline string is split in to two tokens.
+	var strs []Token
+	for _, tok := range tokens {
+		if tok.Kind == token_kind.PyMultilineString {
+			strs = append(strs, *tok)
+		}
+	}
+	expectedStrs := []Token{
+		{token_kind.PyMultilineString, "\"\"\"Doc\n", 4, 9},
+		{token_kind.PyMultilineString, "        string.\"\"\"", 5, 1},
+	}
+	if len(strs) != len(expectedStrs) {
+		t.Fatalf("Expected %d string tokens, but got %d.", len(expectedStrs), len(strs))
+	}
+	for i, exp := range expectedStrs {
+		if strs[i] != exp {
+			t.Errorf("Expected %v, but got %v.", exp, strs[i])
+		}
+	}
+
+	// Lexing the whole text should end in the same state.
+	ts := NewTokenKindSet(incrementalTokenKinds)
+	var goEsr GoESR
+	tz, err := NewTokenizerFromState(strings.NewReader(string(text)), ts, goEsr, State{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for tz.HasNext() {
+		if _, err := tz.NextToken(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	last := states[len(states)-1]
+	if st := tz.State(); !st.Equal(last) || st.Line != last.Line || st.Offset != last.Offset {
+		t.Errorf("Expected state %v, but got %v.", last, st)
+	}
+}
+
+func TestStateOpenComment(t *testing.T) {
+	kinds := []uint32{
+		token_kind.CMultiLineComment,
+		token_kind.Identifier,
+		token_kind.Semicolon,
+		token_kind.NewLine,
+	}
+	tokens, states, err := tokenizeLines("a; /* b\nc */ d;\n", kinds)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if states[0].Open != token_kind.CMultiLineComment || states[1].Open != token_kind.Invalid {
+		t.Errorf("Expected the comment to be open only after the first line.")
+	}
+	if states[0].Equal(states[1]) {
+		t.Errorf("Expected the states to differ.")
+	}
+
+	expected := []Token{
+		{token_kind.Identifier, "a", 1, 1},
+		{token_kind.Semicolon, ";", 1, 2},
+		{token_kind.CMultiLineComment, "/* b\n", 1, 4},
+		{token_kind.CMultiLineComment, "c */", 2, 1},
+		{token_kind.Identifier, "d", 2, 6},
+		{token_kind.Semicolon, ";", 2, 7},
+		{token_kind.NewLine, "\n", 2, 8},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, but got %d.", len(expected), len(tokens))
+	}
+	for i, exp := range expected {
+		if *tokens[i] != exp {
+			t.Errorf("Expected %v, but got %v.", exp, *tokens[i])
+		}
+	}
+
+	// A Tokenizer created by NewTokenizer does not leave tokens open.
+	ts := NewTokenKindSet(kinds)
+	var goEsr GoESR
+	tz, err := NewTokenizer(strings.NewReader("/* b\n"), ts, goEsr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := tz.NextToken(); err == nil {
+		t.Errorf("Expected an error for an unterminated comment.")
+	}
+
+	_, err = NewTokenizerFromState(strings.NewReader(""), ts, goEsr, State{Open: token_kind.Identifier})
+	if err == nil {
+		t.Errorf("Expected an error for an invalid open token kind.")
+	}
+	_, err = NewTokenizerFromState(strings.NewReader(""), ts, goEsr, State{Open: token_kind.PyMultilineString})
+	if err == nil {
+		t.Errorf("Expected an error for an open token kind not in the set.")
+	}
+}
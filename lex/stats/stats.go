@@ -0,0 +1,241 @@
+// Package stats counts the lines and the tokens of source files, like the
+// cloc tool. As the lines are classified by the tokens on them, the
+// comment markers in strings and the strings in comments do not confuse
+// the counts.
+package stats
+
+import (
+	"sort"
+	"unicode/utf8"
+	"uno/lex"
+	"uno/lex/highlight"
+	"uno/lex/token_kind"
+)
+
+// The counts of a file, or of a set of files.
+type Stats struct {
+	Files int `json:"files"`
+	Lines int `json:"lines"`
+	// The lines with only white space.
+	Blank int `json:"blank"`
+	// The lines with only comments and docstrings.
+	Comment int `json:"comment"`
+	// The other lines.
+	Code int `json:"code"`
+
+	// The number of tokens of each kind, by the name of the kind.
+	Tokens map[string]int `json:"tokens"`
+	// The number of identifiers of each length, in runes of their spelling
+	// in the text.
+	IdentifierLengths map[int]int `json:"identifierLengths"`
+}
+
+func newStats() *Stats {
+	return &Stats{Tokens: map[string]int{}, IdentifierLengths: map[int]int{}}
+}
+
+// Returns the total number of tokens.
+func (s *Stats) TokenCount() int {
+	n := 0
+	for _, c := range s.Tokens {
+		n += c
+	}
+	return n
+}
+
+// Returns the mean length of the identifiers, or 0 if there are none.
+func (s *Stats) MeanIdentifierLength() float64 {
+	n, sum := 0, 0
+	for l, c := range s.IdentifierLengths {
+		n += c
+		sum += l * c
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(sum) / float64(n)
+}
+
+// Adds the counts of |o| to |s|.
+func (s *Stats) Add(o *Stats) {
+	s.Files += o.Files
+	s.Lines += o.Lines
+	s.Blank += o.Blank
+	s.Comment += o.Comment
+	s.Code += o.Code
+	for k, c := range o.Tokens {
+		s.Tokens[k] += c
+	}
+	for l, c := range o.IdentifierLengths {
+		s.IdentifierLengths[l] += c
+	}
+}
+
+// The counts of a file.
+type FileStats struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	*Stats
+}
+
+// The counts of the files of a language.
+type LanguageStats struct {
+	Language string `json:"language"`
+	*Stats
+}
+
+// Returns which tokens of |refs| are docstrings, which are strings alone on
+// their logical line as the first statement of a module, or of the body of
+// a def or a class, like in Python. The strings in brackets, like the
+// arguments of a call on several lines, are not docstrings.
+func docstrings(refs []lex.TokenRef) []bool {
+	docs := make([]bool, len(refs))
+	depth := 0
+	// Whether the next token begins a statement, whether it is the first
+	// statement of a module or of a body, and whether the current statement
+	// is the header of a def or a class.
+	start, first, header := true, true, false
+	for i, t := range refs {
+		switch {
+		case t.Kind == token_kind.Indent || t.Kind == token_kind.Tab || t.Kind == token_kind.LineJoin:
+			continue
+		case depth > 0 && (t.Kind == token_kind.NewLine || highlight.ClassOf(t.Kind) == highlight.Comment):
+			continue
+		// A single-line comment includes the new line which ends it.
+		case t.Kind == token_kind.NewLine || t.Kind == token_kind.PySingleLineComment:
+			start, header = true, false
+			continue
+		case highlight.ClassOf(t.Kind) == highlight.Comment:
+			continue
+		}
+
+		if start && first && depth == 0 && highlight.ClassOf(t.Kind) == highlight.String {
+			docs[i] = i+1 == len(refs) || refs[i+1].Kind == token_kind.NewLine ||
+				highlight.ClassOf(refs[i+1].Kind) == highlight.Comment
+		}
+		start, first = false, false
+		switch t.Kind {
+		case token_kind.LeftParen, token_kind.LeftBracket, token_kind.LeftBrace:
+			depth++
+		case token_kind.RightParen, token_kind.RightBracket, token_kind.RightBrace:
+			if depth > 0 {
+				depth--
+			}
+		case token_kind.KeywordDef, token_kind.KeywordClass:
+			header = header || depth == 0
+		case token_kind.Colon:
+			// The body begins after the colon, on the same line or on the
+			// next one.
+			if header && depth == 0 {
+				start, first, header = true, true, false
+			}
+		}
+	}
+	return docs
+}
+
+// Returns the counts of the file |path| in the language |language|, whose
+// text |text| is read by |tz|, like the Tokenizer of
+// Profile.NewBytesTokenizer. If lexing fails, the counts are returned with
+// the error, and the lines after the error count as code if they are not
+// blank.
+func Count(path, language string, tz *lex.Tokenizer, text []byte) (*FileStats, error) {
+	fs := &FileStats{path, language, newStats()}
+	fs.Files = 1
+
+	refs, err := lex.ReadRefs(tz)
+
+	// The lines, split at the new lines of the lexer, the offsets of their
+	// beginnings, and the kind of each line: whether a code token or a
+	// comment is on it. The text after the last new line is a line only if
+	// it is not empty.
+	lines := lex.SplitLines(text)
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	starts := make([]int, len(lines))
+	for l := 1; l < len(lines); l++ {
+		e := starts[l-1] + len(lines[l-1])
+		starts[l] = e + lex.NewLineLen(text[e:])
+	}
+	code := make([]bool, len(starts))
+	docs := docstrings(refs)
+	comment := make([]bool, len(starts))
+
+	for i, t := range refs {
+		fs.Tokens[token_kind.Name(t.Kind)]++
+		if t.Kind == token_kind.Identifier {
+			fs.IdentifierLengths[utf8.RuneCount(text[t.Start:t.End])]++
+		}
+		if lex.IsLayout(t.Kind) {
+			continue
+		}
+
+		// The lines of the first and the last bytes of the token. The new
+		// line which ends a single-line comment is on the line it ends.
+		first := sort.SearchInts(starts, int(t.Start)+1) - 1
+		last := sort.SearchInts(starts, int(t.End)) - 1
+		if last < first {
+			last = first
+		}
+		isComment := highlight.ClassOf(t.Kind) == highlight.Comment || docs[i]
+		for l := first; l <= last; l++ {
+			if isComment {
+				comment[l] = true
+			} else {
+				code[l] = true
+			}
+		}
+	}
+
+	fs.Lines = len(lines)
+	for l, line := range lines {
+		switch {
+		case isBlank(line):
+			fs.Blank++
+		case comment[l] && !code[l]:
+			fs.Comment++
+		default:
+			fs.Code++
+		}
+	}
+	return fs, err
+}
+
+func isBlank(line []byte) bool {
+	for _, c := range line {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != '\f' && c != '\v' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the counts of |files| summed by language, sorted by the number
+// of code lines, and the total counts.
+func Summarize(files []*FileStats) ([]*LanguageStats, *Stats) {
+	byLanguage := map[string]*LanguageStats{}
+	total := newStats()
+	for _, f := range files {
+		ls, ok := byLanguage[f.Language]
+		if !ok {
+			ls = &LanguageStats{f.Language, newStats()}
+			byLanguage[f.Language] = ls
+		}
+		ls.Add(f.Stats)
+		total.Add(f.Stats)
+	}
+
+	var languages []*LanguageStats
+	for _, ls := range byLanguage {
+		languages = append(languages, ls)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		a, b := languages[i], languages[j]
+		if a.Code != b.Code {
+			return a.Code > b.Code
+		}
+		return a.Language < b.Language
+	})
+	return languages, total
+}
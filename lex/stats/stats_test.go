@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"uno/lex"
+)
+
+func count(t *testing.T, path string, p *lex.Profile) *FileStats {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tz, err := p.NewBytesTokenizer(text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fs, err := Count(path, p.Name, tz, text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fs
+}
+
+func checkLines(t *testing.T, fs *FileStats, lines, blank, comment, code int) {
+	if fs.Lines != lines || fs.Blank != blank || fs.Comment != comment || fs.Code != code {
+		t.Errorf("Expected %d lines with %d blank, %d comment and %d code in %s, but got %d, %d, %d and %d.",
+			lines, blank, comment, code, fs.Path, fs.Lines, fs.Blank, fs.Comment, fs.Code)
+	}
+}
+
+func TestCountPython(t *testing.T) {
+	fs := count(t, "test_data/sample.py", lex.PythonProfile)
+	// The docstrings count as comments, and the comment marker in the
+	// string does not.
+	checkLines(t, fs, 13, 3, 5, 5)
+
+	if fs.Tokens["KeywordDef"] != 1 || fs.Tokens["PySingleLineComment"] != 3 || fs.Tokens["PyMultilineString"] != 2 {
+		t.Errorf("Unexpected token counts %v.", fs.Tokens)
+	}
+	// os, f, name, s, s and name.
+	expected := map[int]int{2: 1, 1: 3, 4: 2}
+	for l, c := range expected {
+		if fs.IdentifierLengths[l] != c {
+			t.Errorf("Expected %d identifiers of length %d, but got %v.", c, l, fs.IdentifierLengths)
+		}
+	}
+	if m := fs.MeanIdentifierLength(); m != 13.0/6 {
+		t.Errorf("Expected a mean identifier length of 13/6, but got %v.", m)
+	}
+}
+
+func TestDocstrings(t *testing.T) {
+	tests := map[string]int{
+		// The strings in brackets are arguments or items.
+		"foo(\n  \"abc\",\n  \"def\"\n)\n":          0,
+		"MSG = [\n  'a',\n  'b'\n]\n":               0,
+		"x = 1\n'not a docstring'\n":                0,
+		"class A:\n  \"\"\"Doc.\"\"\"\n  x = 'y'\n": 1,
+		"@d\nasync def f():\n  'Doc.'\n":            1,
+		"def f(x: int) -> dict[str, int]:\n  # A comment.\n  'Doc.'\n  'Not a docstring.'\n": 2,
+	}
+	for text, comment := range tests {
+		tz, err := lex.PythonProfile.NewBytesTokenizer([]byte(text))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		fs, err := Count("a.py", "python", tz, []byte(text))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if fs.Comment != comment {
+			t.Errorf("Expected %d comment lines in %q, but got %d.", comment, text, fs.Comment)
+		}
+	}
+}
+
+func TestCountC(t *testing.T) {
+	fs := count(t, "test_data/sample.c", lex.CProfile)
+	checkLines(t, fs, 9, 1, 3, 5)
+	if fs.Tokens["CMultiLineComment"] != 2 || fs.Tokens["CSingleLineComment"] != 1 {
+		t.Errorf("Unexpected token counts %v.", fs.Tokens)
+	}
+}
+
+func TestCountError(t *testing.T) {
+	text := []byte("x = 1\n\n$ # a comment\n")
+	tz, err := lex.PythonProfile.NewBytesTokenizer(text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fs, err := Count("a.py", "python", tz, text)
+	if err == nil {
+		t.Errorf("Expected an error for '$'.")
+	}
+	checkLines(t, fs, 3, 1, 0, 2)
+}
+
+func TestCountNewLines(t *testing.T) {
+	// The lines end with the new lines of the lexer, like "\r".
+	for _, nl := range []string{"\r", "\r\n", "\u2028"} {
+		text := []byte(strings.Replace("# c\n\nx = 1\n\"\"\"doc\"\"\"\n", "\n", nl, -1))
+		tz, err := lex.PythonProfile.NewBytesTokenizer(text)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		fs, err := Count("a.py", "python", tz, text)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		checkLines(t, fs, 4, 1, 1, 2)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	files := []*FileStats{
+		count(t, "test_data/sample.py", lex.PythonProfile),
+		count(t, "test_data/sample.c", lex.CProfile),
+		count(t, "test_data/sample.py", lex.PythonProfile),
+	}
+	languages, total := Summarize(files)
+	if len(languages) != 2 || languages[0].Language != "python" || languages[0].Files != 2 || languages[0].Code != 10 {
+		t.Errorf("Unexpected languages %+v.", languages)
+	}
+	if total.Files != 3 || total.Lines != 35 || total.Code != 15 || total.TokenCount() != 2*files[0].TokenCount()+files[1].TokenCount() {
+		t.Errorf("Unexpected total %+v.", total)
+	}
+}
@@ -0,0 +1,9 @@
+/* A header
+ * comment. */
+#include <stdio.h>
+
+int main(void) {
+  // Say hello.
+  printf("/* not a comment */\n");
+  return 0; /* trailing */
+}
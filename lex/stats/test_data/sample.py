@@ -0,0 +1,13 @@
+#!/usr/bin/env python
+"""Module docstring
+spanning lines."""
+
+import os  # a comment
+
+
+def f(name):
+    """Doc."""
+    # Only a comment.
+    s = "# not a comment"
+    return s + \
+        name
@@ -27,7 +27,7 @@ func (tz *Tokenizer) readIndentToken() (*Token, error) {
 	line := tz.r.NextLine()
 	col := tz.r.NextCol()
 
-	var v []rune
+	v := tz.runes[:0]
 	for true {
 		c, e := tz.r.PeekChar()
 		if e != nil {
@@ -45,7 +45,7 @@ func (tz *Tokenizer) readIndentToken() (*Token, error) {
 		}
 	}
 
-	return newToken(token_kind.Indent, v, line, col), nil
+	return tz.makeToken(token_kind.Indent, v, line, col), nil
 }
 
 func (tz *Tokenizer) skipSpace() error {
@@ -88,7 +88,7 @@ func (tz *Tokenizer) readSingleQuoteCharacter() (*Token, error) {
 	// not be a newline char and the third char should be the closing
 	// single quote.
 	if c != '\\' {
-		if c == char.NewLine || c == char.Return {
+		if c == char.NewLine {
 			return nil, fmt.Errorf("Invalid newline after single quote.")
 		}
 
@@ -97,7 +97,7 @@ func (tz *Tokenizer) readSingleQuoteCharacter() (*Token, error) {
 			return nil, fmt.Errorf("Missing/incorrectly placed closing single quote.")
 		}
 
-		t := newToken(
+		t := tz.makeToken(
 			token_kind.SingleQuoteCharacter,
 			[]rune{char.SingleQuote, c, char.SingleQuote},
 			line, col)
@@ -110,6 +110,8 @@ func (tz *Tokenizer) readSingleQuoteCharacter() (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	tz.offsets = append(tz.offsets[:0], 0, 1, tz.r.NextOffset()-tz.startOffset)
+	tz.valueOffsets = tz.offsets
 
 	q, err = tz.r.ReadChar()
 	if err != nil {
@@ -121,7 +123,7 @@ func (tz *Tokenizer) readSingleQuoteCharacter() (*Token, error) {
 		return nil, fmt.Errorf("Missing or incorrectly placed closing single quote.")
 	}
 
-	t := newToken(
+	t := tz.makeToken(
 		token_kind.SingleQuoteCharacter,
 		[]rune{char.SingleQuote, c, char.SingleQuote},
 		line, col)
@@ -139,7 +141,10 @@ func (tz *Tokenizer) readQuotedString(raw bool) (*Token, error) {
 	col := tz.r.NextCol()
 	line := tz.r.NextLine()
 
-	var s []rune // The full quoted string will be stored in this.
+	s := tz.runes[:0] // The full quoted string will be stored in this.
+	// The offsets of the characters of |s| in the source.
+	offsets := append(tz.offsets[:0], 0)
+	escaped := false
 
 	q, err := tz.r.ReadChar()
 	if err != nil {
@@ -153,6 +158,7 @@ func (tz *Tokenizer) readQuotedString(raw bool) (*Token, error) {
 
 	done := false
 	for true {
+		offsets = append(offsets, tz.r.NextOffset()-tz.startOffset)
 		c, err := tz.r.ReadChar()
 		if err != nil {
 			return nil, fmt.Errorf("Error reading quoted string.\n%s", err.Error())
@@ -167,9 +173,8 @@ func (tz *Tokenizer) readQuotedString(raw bool) (*Token, error) {
 			if err != nil {
 				return nil, err
 			}
+			escaped = true
 		case char.NewLine:
-			fallthrough
-		case char.Return:
 			if !raw {
 				return nil, fmt.Errorf(
 					"Unexpected newline while reading quoted string.")
@@ -186,7 +191,11 @@ func (tz *Tokenizer) readQuotedString(raw bool) (*Token, error) {
 		}
 	}
 
-	t := newToken(tt, s, line, col)
+	tz.offsets = offsets
+	if escaped {
+		tz.valueOffsets = offsets
+	}
+	t := tz.makeToken(tt, s, line, col)
 	return t, nil
 }
 
@@ -195,7 +204,7 @@ func (tz *Tokenizer) readPyMultilineString() (*Token, error) {
 	line := tz.r.NextLine()
 	col := tz.r.NextCol()
 
-	ss, err := tz.r.ReadSlice(3)
+	ss, err := tz.readSlice(3)
 	if err != nil {
 		return nil, fmt.Errorf("Error reading multine line string.\n%s", err.Error())
 	}
@@ -203,21 +212,40 @@ func (tz *Tokenizer) readPyMultilineString() (*Token, error) {
 		return nil, fmt.Errorf("Expecting '\"\"\"' as start of multiline string.")
 	}
 
-	var s []rune
-	s = append(s, ss...)
+	s, err := tz.readUntil(ss, TripleQuote, token_kind.PyMultilineString)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading multiline string.\n%s", err.Error())
+	}
 
-	for true {
-		c, err := tz.r.ReadChar()
-		if err != nil {
-			return nil, fmt.Errorf("Error reading multiline string.\n%s", err.Error())
-		}
+	return tz.makeToken(token_kind.PyMultilineString, s, line, col), nil
+}
 
-		s = append(s, c)
+// Reads a back slash followed by a new line. If token_kind.LineJoin is
+// present in the token kind set, a LineJoin token is returned. Else, the
+// lines are joined transparently and the token following the line join
+// is returned. Neither a NewLine token nor an Indent token is returned
+// for the new line which is joined.
+func (tz *Tokenizer) readLineJoin() (*Token, error) {
+	line := tz.r.NextLine()
+	col := tz.r.NextCol()
 
-		if l := len(s); string(s[l-3:l]) == TripleQuote {
-			break
-		}
+	c1, err := tz.r.PeekCharAt(1)
+	if err != nil || c1 != char.NewLine {
+		return nil, unExpectedCharacterError(char.BackSlash)
+	}
+
+	s, err := tz.readSlice(2)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading line join.\n%s", err.Error())
+	}
+	if tz.keepNewLines {
+		s = append(s[:1], []rune(tz.r.NewLineSpelling())...)
+	}
+
+	tz.joined = true
+	if tz.ts.Contains(token_kind.LineJoin) {
+		return tz.makeToken(token_kind.LineJoin, s, line, col), nil
 	}
 
-	return newToken(token_kind.PyMultilineString, s, line, col), nil
+	return tz.nextToken()
 }
@@ -1,6 +1,7 @@
 package lex
 
 import (
+	"reflect"
 	"testing"
 	"uno/lex/token_kind"
 )
@@ -51,3 +52,26 @@ func TestWithSingleQuoteString(t *testing.T) {
 		t.Errorf(err.Error())
 	}
 }
+
+func TestValueOffsets(t *testing.T) {
+	ts := NewTokenKindSet([]uint32{
+		token_kind.DoubleQuoteString,
+		token_kind.SingleQuoteCharacter,
+	})
+	tz, err := NewBytesTokenizer([]byte("\"ab\\tc\" \"x\" '\\n' \"é\\t\"\n"), ts, GoESR{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// The offsets are in bytes, and nil for a value without escape
+	// sequences.
+	expected := [][]uint32{{0, 1, 2, 3, 5, 6}, nil, {0, 1, 3}, {0, 1, 3, 5}}
+	for i, exp := range expected {
+		if _, err := tz.NextToken(); err != nil {
+			t.Fatal(err.Error())
+		}
+		if !reflect.DeepEqual(tz.ValueOffsets(), exp) {
+			t.Errorf("Expected the offsets %v for token %d, but got %v.", exp, i, tz.ValueOffsets())
+		}
+	}
+}
@@ -0,0 +1 @@
+s = 'unterminated
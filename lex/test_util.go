@@ -3,6 +3,7 @@ package lex
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -53,3 +54,43 @@ func matchTokens(file string, ts TokenKindSet, tokens []Token) error {
 
 	return nil
 }
+
+// Checks that the Pos of each token of |file|, which should be ASCII,
+// expands to the line and the column of the token.
+func matchPositions(file string, ts TokenKindSet) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Error opening simple text file. \n%s", err.Error())
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fset := NewFileSet()
+	sf := fset.AddFile(file, uint32(fi.Size()))
+
+	var goEsr GoESR
+	tz, err := NewFileTokenizer(sf, bufio.NewReader(f), ts, goEsr)
+	if err != nil {
+		return err
+	}
+
+	for tz.HasNext() {
+		t, p, err := tz.NextTokenPos()
+		if err == io.EOF {
+			// Skipped white space at the end of the file.
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error at %s:%d:%d: %s", file, tz.Line(), tz.Col(), err.Error())
+		}
+
+		pos := fset.Position(p)
+		if pos.Filename != file || pos.Line != t.Line || pos.Col != t.Col {
+			return fmt.Errorf("Expected '%s' at %s:%d:%d, but got %s.", t.Value, file, t.Line, t.Col, pos)
+		}
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package lex
 
+import "uno/lex/token_kind"
+
 type Token struct {
 	Kind  uint32
 	Value string
@@ -16,3 +18,35 @@ func newToken(tt uint32, val []rune, l uint32, c uint32) *Token {
 	return t
 }
 
+// A token which refers to its value in the input by byte offsets instead
+// of holding a copy of it. The value is the original spelling of the token
+// in the input, which can differ from the Value of the Token returned by
+// NextToken, like for strings with escape sequences.
+type TokenRef struct {
+	Kind uint32
+	// The byte offsets of the beginning and the end of the token.
+	Start uint32
+	End   uint32
+	Line  uint32
+	Col   uint32
+}
+
+// Returns the value of the token in the input |src| without copying it.
+func (t TokenRef) Bytes(src []byte) []byte {
+	return src[t.Start:t.End]
+}
+
+// Returns the value of the token in the input |src|.
+func (t TokenRef) Value(src []byte) string {
+	return string(src[t.Start:t.End])
+}
+
+// Returns true if the tokens of kind |kind| are part of the line structure
+// rather than of the code, like NewLine, Indent, Tab and LineJoin.
+func IsLayout(kind uint32) bool {
+	switch kind {
+	case token_kind.NewLine, token_kind.Indent, token_kind.Tab, token_kind.LineJoin:
+		return true
+	}
+	return false
+}
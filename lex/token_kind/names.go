@@ -0,0 +1,138 @@
+package token_kind
+
+import "fmt"
+
+// The names of the token kinds, indexed by kind.
+var names = [FirstInvalidTokenKind]string{
+	Invalid:              "Invalid",
+	KeywordAnd:           "KeywordAnd",
+	KeywordAs:            "KeywordAs",
+	KeywordAssert:        "KeywordAssert",
+	KeywordBreak:         "KeywordBreak",
+	KeywordClass:         "KeywordClass",
+	KeywordConst:         "KeywordConst",
+	KeywordContinue:      "KeywordContinue",
+	KeywordDef:           "KeywordDef",
+	KeywordDel:           "KeywordDel",
+	KeywordElif:          "KeywordElif",
+	KeywordElse:          "KeywordElse",
+	KeywordExcept:        "KeywordExcept",
+	KeywordCFalse:        "KeywordCFalse",
+	KeywordPyFalse:       "KeywordPyFalse",
+	KeywordFinally:       "KeywordFinally",
+	KeywordFor:           "KeywordFor",
+	KeywordFrom:          "KeywordFrom",
+	KeywordGlobal:        "KeywordGlobal",
+	KeywordIf:            "KeywordIf",
+	KeywordImport:        "KeywordImport",
+	KeywordIn:            "KeywordIn",
+	KeywordIs:            "KeywordIs",
+	KeywordLambda:        "KeywordLambda",
+	KeywordNonlocal:      "KeywordNonlocal",
+	KeywordNot:           "KeywordNot",
+	KeywordNull:          "KeywordNull",
+	KeywordOr:            "KeywordOr",
+	KeywordPass:          "KeywordPass",
+	KeywordRaise:         "KeywordRaise",
+	KeywordReturn:        "KeywordReturn",
+	KeywordCTrue:         "KeywordCTrue",
+	KeywordPyTrue:        "KeywordPyTrue",
+	KeywordTry:           "KeywordTry",
+	KeywordWhile:         "KeywordWhile",
+	KeywordWith:          "KeywordWith",
+	KeywordYield:         "KeywordYield",
+	Identifier:           "Identifier",
+	PythonDecorator:      "PythonDecorator",
+	CPPDirective:         "CPPDirective",
+	DoubleQuoteString:    "DoubleQuoteString",
+	SingleQuoteString:    "SingleQuoteString",
+	BackQuoteString:      "BackQuoteString",
+	PyMultilineString:    "PyMultilineString",
+	SingleQuoteCharacter: "SingleQuoteCharacter",
+	DecimalInteger:       "DecimalInteger",
+	HexInteger:           "HexInteger",
+	OctInteger:           "OctInteger",
+	FloatNumber:          "FloatNumber",
+	CSingleLineComment:   "CSingleLineComment",
+	CMultiLineComment:    "CMultiLineComment",
+	PySingleLineComment:  "PySingleLineComment",
+	Add:                  "Add",
+	Sub:                  "Sub",
+	Mul:                  "Mul",
+	Div:                  "Div",
+	Mod:                  "Mod",
+	BitwiseAnd:           "BitwiseAnd",
+	BitwiseOr:            "BitwiseOr",
+	BitwiseXor:           "BitwiseXor",
+	BitwiseNot:           "BitwiseNot",
+	BitwiseNeg:           "BitwiseNeg",
+	LeftShift:            "LeftShift",
+	RightShift:           "RightShift",
+	Assign:               "Assign",
+	AddAssign:            "AddAssign",
+	SubAssign:            "SubAssign",
+	MulAssign:            "MulAssign",
+	DivAssign:            "DivAssign",
+	ModAssign:            "ModAssign",
+	LeftShiftAssign:      "LeftShiftAssign",
+	RightShiftAssign:     "RightShiftAssign",
+	BitwiseAndAssign:     "BitwiseAndAssign",
+	BitwiseOrAssign:      "BitwiseOrAssign",
+	BitwiseXorAssign:     "BitwiseXorAssign",
+	BitwiseNotAssign:     "BitwiseNotAssign",
+	BitwiseNegAssign:     "BitwiseNegAssign",
+	Equal:                "Equal",
+	TripleEqual:          "TripleEqual",
+	NotEqual:             "NotEqual",
+	Dot:                  "Dot",
+	InclusiveRange:       "InclusiveRange",
+	ExclusiveRange:       "ExclusiveRange",
+	Comma:                "Comma",
+	LeftParen:            "LeftParen",
+	RightParen:           "RightParen",
+	LeftBracket:          "LeftBracket",
+	RightBracket:         "RightBracket",
+	LeftBrace:            "LeftBrace",
+	RightBrace:           "RightBrace",
+	Colon:                "Colon",
+	ScopeResolution:      "ScopeResolution",
+	Semicolon:            "Semicolon",
+	LogicalAnd:           "LogicalAnd",
+	LogicalOr:            "LogicalOr",
+	LogicalNot:           "LogicalNot",
+	LessThan:             "LessThan",
+	LessThanEqual:        "LessThanEqual",
+	GreaterThan:          "GreaterThan",
+	GreaterThanEqual:     "GreaterThanEqual",
+	ReturnArrow:          "ReturnArrow",
+	ChannelIO:            "ChannelIO",
+	UnaryIncrement:       "UnaryIncrement",
+	UnaryDecrement:       "UnaryDecrement",
+	MulPower:             "MulPower",
+	Indent:               "Indent",
+	NewLine:              "NewLine",
+	Tab:                  "Tab",
+	LineJoin:             "LineJoin",
+	CPPStringify:         "CPPStringify",
+	CPPTokenPaste:        "CPPTokenPaste",
+	QuestionMark:         "QuestionMark",
+}
+
+// Returns the name of the token kind |k|, like "Identifier".
+func Name(k uint32) string {
+	if k < FirstInvalidTokenKind {
+		return names[k]
+	}
+	return fmt.Sprintf("TokenKind(%d)", k)
+}
+
+// Returns the token kind named |name|, like token_kind.Identifier for
+// "Identifier".
+func ByName(name string) (uint32, error) {
+	for k, n := range names {
+		if n == name {
+			return uint32(k), nil
+		}
+	}
+	return Invalid, fmt.Errorf("Unknown token kind '%s'.", name)
+}
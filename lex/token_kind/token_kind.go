@@ -146,6 +146,14 @@ const (
 
 	LineJoin
 
+	// C pre-processor stringification operator: #
+	CPPStringify
+	// C pre-processor token pasting operator: ##
+	CPPTokenPaste
+
+	// Conditional operator: ?
+	QuestionMark
+
 	FirstInvalidTokenKind
 )
 
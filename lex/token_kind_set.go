@@ -0,0 +1,131 @@
+package lex
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"uno/lex/token_kind"
+)
+
+// A set of token kinds. It is a bitset in which the bit k is set if the
+// kind k is in the set, so that looking up a kind is cheap. A set can
+// hold the kinds below token_kind.FirstInvalidTokenKind. The empty set
+// TokenKindSet{} is ready to use, its words are allocated by Add.
+type TokenKindSet []uint64
+
+const tokenKindSetWords = int(token_kind.FirstInvalidTokenKind+63) / 64
+
+func newEmptyTokenKindSet() TokenKindSet {
+	return make(TokenKindSet, tokenKindSetWords)
+}
+
+// Returns a new set with the kinds |tokens|. The kinds which are not
+// valid are left out, see Add.
+func NewTokenKindSet(tokens []uint32) TokenKindSet {
+	s := newEmptyTokenKindSet()
+	for _, t := range tokens {
+		s.Add(t)
+	}
+	return s
+}
+
+// Adds the kind |t| to the set. An error is returned if |t| is not a valid
+// kind, and the set is not changed.
+func (s *TokenKindSet) Add(t uint32) error {
+	if t >= token_kind.FirstInvalidTokenKind {
+		return fmt.Errorf("Token kind %d cannot be added to the set.", t)
+	}
+	if len(*s) < tokenKindSetWords {
+		*s = append(*s, make(TokenKindSet, tokenKindSetWords-len(*s))...)
+	}
+	(*s)[t/64] |= 1 << (t % 64)
+	return nil
+}
+
+// Removes the kind |t| from the set.
+func (s TokenKindSet) Remove(t uint32) {
+	if int(t/64) < len(s) {
+		s[t/64] &^= 1 << (t % 64)
+	}
+}
+
+func (s TokenKindSet) Contains(t uint32) bool {
+	return int(t/64) < len(s) && s[t/64]&(1<<(t%64)) != 0
+}
+
+// Returns the number of kinds in the set.
+func (s TokenKindSet) Len() int {
+	n := 0
+	for _, w := range s {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Returns a new set with the kinds which are in |s| and |o| combined
+// by |op|.
+func (s TokenKindSet) combine(o TokenKindSet, op func(a, b uint64) uint64) TokenKindSet {
+	r := newEmptyTokenKindSet()
+	for i := range r {
+		var a, b uint64
+		if i < len(s) {
+			a = s[i]
+		}
+		if i < len(o) {
+			b = o[i]
+		}
+		r[i] = op(a, b)
+	}
+	return r
+}
+
+// Returns a new set with the kinds which are in either |s| or |o|.
+func (s TokenKindSet) Union(o TokenKindSet) TokenKindSet {
+	return s.combine(o, func(a, b uint64) uint64 { return a | b })
+}
+
+// Returns a new set with the kinds which are in both |s| and |o|.
+func (s TokenKindSet) Intersection(o TokenKindSet) TokenKindSet {
+	return s.combine(o, func(a, b uint64) uint64 { return a & b })
+}
+
+// Returns a new set with the kinds which are in |s| but not in |o|.
+func (s TokenKindSet) Difference(o TokenKindSet) TokenKindSet {
+	return s.combine(o, func(a, b uint64) uint64 { return a &^ b })
+}
+
+// Returns true if |s| and |o| have the same kinds, false otherwise.
+func (s TokenKindSet) Equal(o TokenKindSet) bool {
+	d := s.combine(o, func(a, b uint64) uint64 { return a ^ b })
+	return d.Len() == 0
+}
+
+// Calls |fn| with each kind in the set in increasing order.
+func (s TokenKindSet) ForEach(fn func(t uint32)) {
+	for i, w := range s {
+		for w != 0 {
+			b := bits.TrailingZeros64(w)
+			fn(uint32(i*64 + b))
+			w &^= 1 << uint(b)
+		}
+	}
+}
+
+// Returns the kinds in the set in increasing order.
+func (s TokenKindSet) Kinds() []uint32 {
+	var kinds []uint32
+	s.ForEach(func(t uint32) {
+		kinds = append(kinds, t)
+	})
+	return kinds
+}
+
+// Returns the names of the kinds in the set, like
+// "{Identifier, LeftParen, RightParen}".
+func (s TokenKindSet) String() string {
+	var names []string
+	s.ForEach(func(t uint32) {
+		names = append(names, token_kind.Name(t))
+	})
+	return "{" + strings.Join(names, ", ") + "}"
+}
@@ -0,0 +1,71 @@
+package lex
+
+import (
+	"testing"
+	"uno/lex/token_kind"
+)
+
+func TestTokenKindSet(t *testing.T) {
+	a := NewTokenKindSet([]uint32{token_kind.Identifier, token_kind.LeftParen, token_kind.LineJoin})
+	b := NewTokenKindSet([]uint32{token_kind.LeftParen, token_kind.RightParen, token_kind.Invalid})
+
+	if !a.Contains(token_kind.LineJoin) || a.Contains(token_kind.RightParen) {
+		t.Errorf("Contains does not match the kinds added.")
+	}
+	if a.Contains(token_kind.FirstInvalidTokenKind + 100) {
+		t.Errorf("Expected kinds out of range to not be in the set.")
+	}
+
+	checkKinds := func(name string, s TokenKindSet, kinds []uint32) {
+		if !s.Equal(NewTokenKindSet(kinds)) || s.Len() != len(kinds) {
+			t.Errorf("Expected the %s to be %v, but got %v.", name, NewTokenKindSet(kinds), s)
+		}
+	}
+	checkKinds("union", a.Union(b), []uint32{
+		token_kind.Invalid, token_kind.Identifier, token_kind.LeftParen, token_kind.RightParen,
+		token_kind.LineJoin,
+	})
+	checkKinds("intersection", a.Intersection(b), []uint32{token_kind.LeftParen})
+	checkKinds("difference", a.Difference(b), []uint32{token_kind.Identifier, token_kind.LineJoin})
+
+	kinds := a.Kinds()
+	if len(kinds) != 3 || kinds[0] != token_kind.Identifier || kinds[2] != token_kind.LineJoin {
+		t.Errorf("Expected the kinds in increasing order, but got %v.", kinds)
+	}
+	if s := a.String(); s != "{Identifier, LeftParen, LineJoin}" {
+		t.Errorf("Unexpected string '%s'.", s)
+	}
+
+	a.Remove(token_kind.LeftParen)
+	if a.Contains(token_kind.LeftParen) || a.Len() != 2 {
+		t.Errorf("Expected LeftParen to be removed.")
+	}
+
+	if err := a.Add(token_kind.FirstInvalidTokenKind); err == nil || a.Len() != 2 {
+		t.Errorf("Expected an error for adding an invalid kind, but got: %v", err)
+	}
+
+	// The empty set grows when a kind is added.
+	var c TokenKindSet
+	d := TokenKindSet{}
+	if c.Contains(token_kind.Identifier) || d.Len() != 0 {
+		t.Errorf("Expected the zero sets to be empty.")
+	}
+	if err := d.Add(token_kind.QuestionMark); err != nil {
+		t.Fatal(err.Error())
+	}
+	c.Add(token_kind.Identifier)
+	if !d.Contains(token_kind.QuestionMark) || !c.Equal(NewTokenKindSet([]uint32{token_kind.Identifier})) {
+		t.Errorf("Expected the kinds added to the zero sets, but got %v and %v.", c, d)
+	}
+}
+
+func BenchmarkTokenKindSetContains(b *testing.B) {
+	s := PythonProfile.TokenKindSet()
+	n := 0
+	for i := 0; i < b.N; i++ {
+		if s.Contains(uint32(i) % token_kind.FirstInvalidTokenKind) {
+			n += 1
+		}
+	}
+}
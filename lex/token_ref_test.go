@@ -0,0 +1,167 @@
+package lex
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+func readPythonText(tb testing.TB, repeat int) []byte {
+	text, err := ioutil.ReadFile("test_data/python_text")
+	if err != nil {
+		tb.Fatalf("Error reading test file.\n%s", err.Error())
+	}
+	return bytes.Repeat(text, repeat)
+}
+
+func TestNextRef(t *testing.T) {
+	src := readPythonText(t, 2)
+
+	tz, err := PythonProfile.NewTokenizer(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rtz, err := NewBytesTokenizer(src, PythonProfile.TokenKindSet(), PythonProfile.ESR)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	n := 0
+	for tz.HasNext() {
+		exp, err := tz.NextToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !rtz.HasNext() {
+			t.Fatalf("Expected %v, but the bytes tokenizer has no tokens.", *exp)
+		}
+		ref, err := rtz.NextRef()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if ref.Kind != exp.Kind || ref.Line != exp.Line || ref.Col != exp.Col {
+			t.Errorf("Expected %v, but got %v.", *exp, ref)
+		}
+		// Strings with escape sequences are spelled differently.
+		if exp.Kind != token_kind.SingleQuoteString && ref.Value(src) != exp.Value {
+			t.Errorf("Expected '%s' at %d:%d, but got '%s'.", exp.Value, exp.Line, exp.Col, ref.Value(src))
+		}
+		n += 1
+	}
+	if n == 0 {
+		t.Errorf("Expected tokens in the test file.")
+	}
+
+	ref, err := rtz.NextRef()
+	if err != io.EOF {
+		t.Errorf("Expected io.EOF at the end, but got %v and error: %v", ref, err)
+	}
+}
+
+func TestReadRefs(t *testing.T) {
+	text := []byte("x = 1  # c\n$ y\n")
+	tz, err := NewBytesTokenizer(text, PythonProfile.TokenKindSet(), PythonProfile.ESR)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	refs, err := ReadRefs(tz)
+	if line, col := tz.TokenStart(); err == nil || line != 2 || col != 1 {
+		t.Errorf("Expected an error for '$' at 2:1, but got %v at %d:%d.", err, line, col)
+	}
+	// x, =, 1 and the comment, which includes its new line.
+	if len(refs) != 4 || refs[3].Kind != token_kind.PySingleLineComment || IsLayout(refs[3].Kind) {
+		t.Errorf("Unexpected tokens %v before the error.", refs)
+	}
+
+	tz, err = NewBytesTokenizer(text[:11], PythonProfile.TokenKindSet(), PythonProfile.ESR)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if refs, err = ReadRefs(tz); err != nil || len(refs) != 4 {
+		t.Errorf("Expected 4 tokens, but got %v and error: %v", refs, err)
+	}
+	if !IsLayout(token_kind.NewLine) || !IsLayout(token_kind.Indent) || IsLayout(token_kind.Identifier) {
+		t.Errorf("Unexpected layout kinds.")
+	}
+}
+
+func TestNextRefAllocs(t *testing.T) {
+	src := readPythonText(t, 50)
+	ts := PythonProfile.TokenKindSet()
+
+	tokens := 0
+	allocs := testing.AllocsPerRun(5, func() {
+		tz, _ := NewBytesTokenizer(src, ts, PythonProfile.ESR)
+		tokens = 0
+		for {
+			_, err := tz.NextRef()
+			if err != nil {
+				break
+			}
+			tokens += 1
+		}
+	})
+	if perToken := allocs / float64(tokens); perToken > 0.01 {
+		t.Errorf("Expected near zero allocations per token, but got %f.", perToken)
+	}
+}
+
+func benchmarkTokens(b *testing.B, next func(src []byte) (int, error)) {
+	src := readPythonText(b, 100)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := next(src); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+
+	b.StopTimer()
+	tokens, _ := next(src)
+	allocs := testing.AllocsPerRun(1, func() { next(src) })
+	b.ReportMetric(allocs/float64(tokens), "allocs/token")
+}
+
+func BenchmarkNextToken(b *testing.B) {
+	ts := PythonProfile.TokenKindSet()
+	benchmarkTokens(b, func(src []byte) (int, error) {
+		tz, err := NewTokenizer(bytes.NewReader(src), ts, PythonProfile.ESR)
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for tz.HasNext() {
+			if _, err := tz.NextToken(); err != nil && err != io.EOF {
+				return 0, err
+			}
+			n += 1
+		}
+		return n, nil
+	})
+}
+
+func BenchmarkNextRef(b *testing.B) {
+	ts := PythonProfile.TokenKindSet()
+	benchmarkTokens(b, func(src []byte) (int, error) {
+		tz, err := NewBytesTokenizer(src, ts, PythonProfile.ESR)
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for tz.HasNext() {
+			if _, err := tz.NextRef(); err != nil && err != io.EOF {
+				return 0, err
+			}
+			n += 1
+		}
+		return n, nil
+	})
+}
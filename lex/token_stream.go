@@ -0,0 +1,218 @@
+package lex
+
+import (
+	"fmt"
+	"io"
+)
+
+// A source of tokens. Tokenizer is a TokenSource.
+type TokenSource interface {
+	HasNext() bool
+	NextToken() (*Token, error)
+}
+
+// A backtracking point in a TokenStream.
+type Mark struct {
+	index int
+}
+
+type streamEntry struct {
+	t   *Token
+	pos Pos
+}
+
+// A TokenStream reads tokens from a TokenSource and provides arbitrary
+// lookahead, pushback and backtracking over them. The tokens are held in
+// a ring buffer which grows as required. Tokens which have been read are
+// released from the buffer unless they can be reached by resetting to an
+// outstanding Mark.
+type TokenStream struct {
+	src    TokenSource
+	posSrc interface{ Pos() Pos }
+
+	// The ring buffer. Its length is always a power of 2. The token at
+	// the absolute index i is at buf[i&(len(buf)-1)].
+	buf []streamEntry
+	// The absolute indices of the oldest token retained, the next token
+	// to be read and one past the newest token read from |src|.
+	base, cur, end int
+
+	// The number of outstanding marks at each absolute index.
+	marks map[int]int
+
+	// The Pos of the last token read.
+	pos Pos
+
+	// The error returned by |src|, which is returned after all the
+	// buffered tokens have been read.
+	err error
+}
+
+const initialStreamBufferSize = 16
+
+// Returns a new TokenStream which reads from |src|. If |src| has a
+// method Pos like Tokenizer does, then the Pos values of the tokens are
+// also tracked.
+func NewTokenStream(src TokenSource) (*TokenStream, error) {
+	if src == nil {
+		return nil, fmt.Errorf("A non-nil TokenSource param is required.")
+	}
+
+	s := new(TokenStream)
+	s.src = src
+	s.posSrc, _ = src.(interface{ Pos() Pos })
+	s.buf = make([]streamEntry, initialStreamBufferSize)
+	s.marks = make(map[int]int)
+	return s, nil
+}
+
+func (s *TokenStream) slot(i int) *streamEntry {
+	return &s.buf[i&(len(s.buf)-1)]
+}
+
+func (s *TokenStream) grow() {
+	buf := make([]streamEntry, 2*len(s.buf))
+	for i := s.base; i < s.end; i++ {
+		buf[i&(len(buf)-1)] = *s.slot(i)
+	}
+	s.buf = buf
+}
+
+// Reads tokens from the source until |n| tokens following the next
+// token are buffered or an error occurs.
+func (s *TokenStream) fill(n int) error {
+	for s.end-s.cur <= n {
+		if s.err != nil {
+			return s.err
+		}
+		if !s.src.HasNext() {
+			s.err = io.EOF
+			continue
+		}
+
+		t, err := s.src.NextToken()
+		if err != nil {
+			// A Tokenizer returns io.EOF if only white space remains.
+			s.err = err
+			continue
+		}
+
+		if s.end-s.base == len(s.buf) {
+			s.grow()
+		}
+		e := streamEntry{t, NoPos}
+		if s.posSrc != nil {
+			e.pos = s.posSrc.Pos()
+		}
+		*s.slot(s.end) = e
+		s.end += 1
+	}
+	return nil
+}
+
+// Releases the tokens which have been read and are not reachable by an
+// outstanding mark. The last token read is retained so that unreading it
+// retains its Pos.
+func (s *TokenStream) release() {
+	base := s.cur - 1
+	for i := range s.marks {
+		if i < base {
+			base = i
+		}
+	}
+	for ; s.base < base; s.base++ {
+		*s.slot(s.base) = streamEntry{}
+	}
+}
+
+// Returns true if there are further tokens, false otherwise. It returns
+// true if an error other than io.EOF is pending, so that the error is
+// returned by Next.
+func (s *TokenStream) HasNext() bool {
+	return s.fill(0) != io.EOF
+}
+
+// Returns the next token and advances the stream. The error io.EOF is
+// returned at the end of the stream.
+func (s *TokenStream) Next() (*Token, error) {
+	err := s.fill(0)
+	if err != nil {
+		return nil, err
+	}
+
+	e := *s.slot(s.cur)
+	s.cur += 1
+	s.pos = e.pos
+	s.release()
+	return e.t, nil
+}
+
+// Returns the token |n| tokens after the next token without advancing
+// the stream. Peek(0) returns the next token. The error io.EOF is
+// returned if the stream ends before that token.
+func (s *TokenStream) Peek(n uint32) (*Token, error) {
+	err := s.fill(int(n))
+	if err != nil {
+		return nil, err
+	}
+	return s.slot(s.cur + int(n)).t, nil
+}
+
+// Returns the Pos of the last token returned by Next, or NoPos if the
+// source does not track positions.
+func (s *TokenStream) Pos() Pos {
+	return s.pos
+}
+
+// Pushes back |t| so that it is the next token returned. Unreading the
+// last token read restores the stream to the state before reading it.
+// If a different token is unread, it replaces the last token read for
+// the outstanding marks.
+func (s *TokenStream) Unread(t *Token) {
+	if s.cur == s.base {
+		if s.end-s.base == len(s.buf) {
+			s.grow()
+		}
+		s.base -= 1
+		*s.slot(s.base) = streamEntry{}
+	}
+
+	s.cur -= 1
+	e := s.slot(s.cur)
+	if e.t != t {
+		*e = streamEntry{t, NoPos}
+	}
+}
+
+// Returns a mark at the next token. The tokens from the mark onwards are
+// retained until the mark is released by Reset or Release.
+func (s *TokenStream) Mark() Mark {
+	s.marks[s.cur] += 1
+	return Mark{s.cur}
+}
+
+// Rewinds the stream to |m| and releases |m|.
+func (s *TokenStream) Reset(m Mark) {
+	if s.marks[m.index] == 0 {
+		panic("Reset to a released mark.")
+	}
+	s.cur = m.index
+	s.Release(m)
+}
+
+// Releases |m| without rewinding the stream.
+func (s *TokenStream) Release(m Mark) {
+	if s.marks[m.index] == 0 {
+		panic("Releasing a released mark.")
+	}
+	s.marks[m.index] -= 1
+	if s.marks[m.index] == 0 {
+		delete(s.marks, m.index)
+	}
+	s.release()
+}
+
+// Returns the number of tokens held in the buffer.
+func (s *TokenStream) Buffered() int {
+	return s.end - s.base
+}
@@ -0,0 +1,112 @@
+package lex
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"testing"
+	"uno/lex/token_kind"
+)
+
+func newIdentifiersStream(t *testing.T) (*TokenStream, *os.File) {
+	f, err := os.Open("test_data/identifiers_text")
+	if err != nil {
+		t.Fatalf("Error opening test file. \n%s", err.Error())
+	}
+
+	ts := NewTokenKindSet([]uint32{
+		token_kind.KeywordClass,
+		token_kind.KeywordDef,
+		token_kind.Identifier,
+	})
+	var goEsr GoESR
+	tz, err := NewTokenizer(bufio.NewReader(f), ts, goEsr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s, err := NewTokenStream(tz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return s, f
+}
+
+func expectNext(t *testing.T, s *TokenStream, value string) *Token {
+	tok, err := s.Next()
+	if err != nil {
+		t.Fatalf("Expected '%s', but got error: %s", value, err.Error())
+	}
+	if tok.Value != value {
+		t.Fatalf("Expected '%s', but got '%s'.", value, tok.Value)
+	}
+	return tok
+}
+
+func TestTokenStreamPeek(t *testing.T) {
+	s, f := newIdentifiersStream(t)
+	defer f.Close()
+
+	tok, err := s.Peek(5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if tok.Value != "AnotherFunc" {
+		t.Errorf("Expected Peek(5) to return 'AnotherFunc', but got '%s'.", tok.Value)
+	}
+
+	expectNext(t, s, "class")
+	expectNext(t, s, "MyClass")
+	if s.Buffered() != 5 {
+		t.Errorf("Expected the tokens read to be released, but %d are buffered.", s.Buffered())
+	}
+
+	_, err = s.Peek(100)
+	if err != io.EOF {
+		t.Errorf("Peeking beyond the end should result in EOF error.")
+	}
+
+	for _, v := range []string{"def", "MyFunc", "def", "AnotherFunc", "_an_identifier",
+		"_another_1_for_fun", "_take_100_then___"} {
+		expectNext(t, s, v)
+	}
+	if s.HasNext() {
+		t.Errorf("Expected no more tokens.")
+	}
+	_, err = s.Next()
+	if err != io.EOF {
+		t.Errorf("Reading beyond the end should result in EOF error.")
+	}
+}
+
+func TestTokenStreamMarkAndUnread(t *testing.T) {
+	s, f := newIdentifiersStream(t)
+	defer f.Close()
+
+	m := s.Mark()
+	expectNext(t, s, "class")
+	inner := s.Mark()
+	expectNext(t, s, "MyClass")
+	expectNext(t, s, "def")
+	s.Release(inner)
+	for i := 0; i < 40; i++ {
+		// Grow the buffer while the mark is outstanding.
+		s.Peek(uint32(i % 7))
+	}
+	s.Reset(m)
+	expectNext(t, s, "class")
+
+	if s.Buffered() != 9 {
+		t.Errorf("Expected all the 9 tokens to be buffered, but got %d.", s.Buffered())
+	}
+
+	tok := expectNext(t, s, "MyClass")
+	s.Unread(tok)
+	expectNext(t, s, "MyClass")
+
+	// Push back a token which was not read from the source.
+	s.Unread(&Token{token_kind.Identifier, "extra", 0, 0})
+	s.Unread(&Token{token_kind.Identifier, "more", 0, 0})
+	expectNext(t, s, "more")
+	expectNext(t, s, "extra")
+	expectNext(t, s, "def")
+}
@@ -3,6 +3,7 @@ package lex
 import (
 	"fmt"
 	"io"
+	"strings"
 	"uno/lex/char"
 	"uno/lex/token_kind"
 )
@@ -50,25 +51,6 @@ func IsOperator(s string) bool {
 	return e
 }
 
-type TokenKindSet map[uint32]bool
-
-func (s TokenKindSet) Add(t uint32) {
-	s[t] = true
-}
-
-func (s TokenKindSet) Contains(t uint32) bool {
-	_, e := s[t]
-	return e
-}
-
-func NewTokenKindSet(tokens []uint32) TokenKindSet {
-	s := TokenKindSet(make(map[uint32]bool))
-	for _, t := range tokens {
-		s.Add(t)
-	}
-	return s
-}
-
 type Tokenizer struct {
 	ts  TokenKindSet
 	r   *CharReader
@@ -78,6 +60,72 @@ type Tokenizer struct {
 	indent  bool // true if token_kind.Indent is present in |ts|.
 	newLine bool // true if token_kind.NewLine is present in |ts|.
 	tab     bool // true if token_kind.Tab is present in |ts|.
+
+	// true if NewLine and LineJoin tokens should have the original
+	// spelling of the new line instead of "\n".
+	keepNewLines bool
+
+	// The file being read and the Pos of the last token read. |start|
+	// is NoPos if |file| is nil.
+	file  *File
+	start Pos
+
+	// true if the last new line read was a part of a line join. The
+	// continued line does not begin with an Indent token.
+	joined bool
+
+	// The byte offsets of the first character of the last token read and
+	// of the character after it.
+	startOffset uint32
+	endOffset   uint32
+	// The byte offsets, relative to |startOffset|, of the characters of
+	// the value of the last token if it has escape sequences, or else nil.
+	// See ValueOffsets.
+	valueOffsets []uint32
+	// The line and the column of the first character of the last token
+	// read or attempted.
+	startLine uint32
+	startCol  uint32
+
+	// If not nil, it is called when the Tokenizer is about to read from
+	// the beginning of a line which is not a continued line.
+	lineStartHook func()
+
+	// The state carried from one line to the next. See State.
+	open     uint32
+	indents  []uint32
+	brackets []uint32
+	// true if the Tokenizer was created by NewTokenizerFromState. Such a
+	// Tokenizer returns a multiline token which is not terminated before
+	// the end of the input, and leaves it open.
+	partial bool
+	// true if no token other than Indent, NewLine, LineJoin and comment
+	// tokens has been read since the beginning of the current line.
+	lineBegins bool
+	// The width of the Indent token read on the current line, if any.
+	lineIndent uint32
+	// The width of the last Indent token read.
+	indentWidth uint32
+
+	// true if the token being read is returned by NextRef. The token is
+	// then recorded in |ref| and |refToken| instead of being allocated.
+	refs     bool
+	ref      TokenRef
+	refToken Token
+	// A buffer for the characters of the token being read, which is
+	// reused between tokens.
+	runes []rune
+	// A buffer for |valueOffsets|, which is reused between tokens.
+	offsets []uint32
+	// true if invalid bytes are read as Invalid tokens. See
+	// SetInvalidBytesAsTokens.
+	invalidBytes bool
+	// The rules for the characters of identifiers.
+	idRules IdentifierRules
+	// The state of the security checks. See SetSecurityChecks.
+	security  bool
+	warnings  []Warning
+	skeletons map[string]identifierSite
 }
 
 // Returns the line on which the last successfully read or attempted
@@ -94,11 +142,47 @@ func (tz *Tokenizer) Col() uint32 {
 	return tz.r.Col()
 }
 
+// Returns the line of the character to be read next. After an error, it
+// is the line at which the error was found.
+func (tz *Tokenizer) NextLine() uint32 {
+	return tz.r.NextLine()
+}
+
+// Returns the column of the character to be read next. After an error, it
+// is the column at which the error was found.
+func (tz *Tokenizer) NextCol() uint32 {
+	return tz.r.NextCol()
+}
+
+// Sets the unit in which the columns of tokens are counted. The tab width
+// is used only with VisualColumns. It should be called before reading any
+// token.
+func (tz *Tokenizer) SetColumnMode(m ColumnMode, tabWidth uint32) error {
+	return tz.r.SetColumnMode(m, tabWidth)
+}
+
+// All new line sequences, "\r\n", "\r", "\u0085", "\u2028" and "\u2029",
+// are read as "\n". If |keep| is true, the values of NewLine and LineJoin
+// tokens will have the original spelling of the new line.
+func (tz *Tokenizer) SetKeepNewLineSpelling(keep bool) {
+	tz.keepNewLines = keep
+}
+
 // Returns a new Tokenizer object.
 func NewTokenizer(r io.RuneReader, s TokenKindSet, esr EscSeqReader) (*Tokenizer, error) {
 	if r == nil {
 		return nil, fmt.Errorf("A non-nil rune param is required.")
 	}
+	return newTokenizer(NewCharReader(r), s, esr)
+}
+
+// Returns a new Tokenizer which reads the UTF-8 encoded text |b|. Along
+// with NextRef, it is the fast path for text which is in memory.
+func NewBytesTokenizer(b []byte, s TokenKindSet, esr EscSeqReader) (*Tokenizer, error) {
+	return newTokenizer(NewBytesCharReader(b), s, esr)
+}
+
+func newTokenizer(r *CharReader, s TokenKindSet, esr EscSeqReader) (*Tokenizer, error) {
 	if s == nil {
 		return nil, fmt.Errorf("A non-nil TokenKindSet param is required.")
 	}
@@ -123,7 +207,7 @@ func NewTokenizer(r io.RuneReader, s TokenKindSet, esr EscSeqReader) (*Tokenizer
 
 	tz := new(Tokenizer)
 	tz.ts = s
-	tz.r = NewCharReader(r)
+	tz.r = r
 	tz.esr = esr
 
 	if s.Contains(token_kind.Indent) {
@@ -141,6 +225,136 @@ func NewTokenizer(r io.RuneReader, s TokenKindSet, esr EscSeqReader) (*Tokenizer
 	return tz, nil
 }
 
+// Returns a new Tokenizer object which reads the file |f| of a FileSet
+// from |r|. The line table of |f| is built while reading and the Pos of
+// each token read is available from the Pos method.
+func NewFileTokenizer(f *File, r io.RuneReader, s TokenKindSet, esr EscSeqReader) (*Tokenizer, error) {
+	if f == nil {
+		return nil, fmt.Errorf("A non-nil File param is required.")
+	}
+
+	tz, err := NewTokenizer(r, s, esr)
+	if err != nil {
+		return nil, err
+	}
+	tz.file = f
+	tz.r.file = f
+	return tz, nil
+}
+
+// Returns the file being read, or nil if the Tokenizer was not created
+// with NewFileTokenizer.
+func (tz *Tokenizer) File() *File {
+	return tz.file
+}
+
+// Returns the Pos of the first character of the last token read, or
+// NoPos if the Tokenizer was not created with NewFileTokenizer.
+func (tz *Tokenizer) Pos() Pos {
+	return tz.start
+}
+
+// Returns the byte offsets of the beginning and the end of the last token
+// read, like the Start and End of a TokenRef. The offsets are relative to
+// the beginning of the input.
+func (tz *Tokenizer) Offsets() (uint32, uint32) {
+	return tz.startOffset, tz.endOffset
+}
+
+// Returns the byte offsets in the source of the characters of the value of
+// the last token read, relative to the beginning of the token, if the value
+// has escape sequences, or else nil. The offset of a character decoded from
+// an escape sequence is the offset of its back slash, like 3 for the tab of
+// "ab\tc", and 5 for the c. The slice is reused by the next token.
+func (tz *Tokenizer) ValueOffsets() []uint32 {
+	return tz.valueOffsets
+}
+
+// Returns the line and the column of the first character of the last token
+// read. After an error, it is the beginning of the token which could not
+// be read, like the quote of a string which is not terminated.
+func (tz *Tokenizer) TokenStart() (uint32, uint32) {
+	return tz.startLine, tz.startCol
+}
+
+// Skips the rest of the current line without reading its tokens, like the
+// C pre-processor does for the lines of a conditional group which is
+// skipped. The blanks are skipped first, and if the next character is one
+// of |stop|, nothing more is skipped and false is returned. Otherwise the
+// characters up to the next new line are skipped and true is returned. The
+// new line itself is not skipped.
+//
+// A line join continues the line, and a multiline comment which begins on
+// the line is skipped to its end. A string or character literal which is
+// not terminated ends at the end of the line, so that the apostrophe of a
+// word like "don't" is not an error.
+func (tz *Tokenizer) SkipLine(stop string) (bool, error) {
+	c, err := tz.r.PeekChar()
+	for err == nil && (c == char.Space || c == char.Tab) {
+		tz.r.ReadChar()
+		c, err = tz.r.PeekChar()
+	}
+	if err == nil && strings.ContainsRune(stop, c) {
+		return false, nil
+	}
+
+	// The quote of the literal being skipped, if any.
+	var quote rune
+	lineComment := false
+	for err == nil && c != char.NewLine {
+		switch {
+		case c == char.BackSlash:
+			// A line join, or an escaped character of a literal.
+			c1, err := tz.r.PeekCharAt(1)
+			if err == nil && (c1 == char.NewLine || quote != 0) {
+				tz.r.ReadChar()
+			}
+		case lineComment:
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == char.DoubleQuote || c == char.SingleQuote:
+			quote = c
+		case tz.r.PeekMatch("//") && tz.ts.Contains(token_kind.CSingleLineComment):
+			lineComment = true
+		case tz.r.PeekMatch("/*") && tz.ts.Contains(token_kind.CMultiLineComment):
+			tz.r.ReadSlice(2)
+			for !tz.r.PeekMatch("*/") {
+				if _, err := tz.r.ReadChar(); err != nil {
+					return true, skipError(err)
+				}
+			}
+			tz.r.ReadChar()
+		}
+		if _, err := tz.r.ReadChar(); err != nil {
+			return true, skipError(err)
+		}
+		c, err = tz.r.PeekChar()
+	}
+	return true, skipError(err)
+}
+
+// Returns |err| unless it is io.EOF, which ends a skipped line.
+func skipError(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Returns the next token in the input along with its Pos, which is NoPos
+// if the Tokenizer was not created with NewFileTokenizer. The Pos of a
+// TokenRef returned by NextRef is the Pos of its Start in the File.
+// If an error occurs, it is not guaranteed to be recoverable.
+func (tz *Tokenizer) NextTokenPos() (*Token, Pos, error) {
+	t, err := tz.NextToken()
+	if err != nil {
+		return nil, NoPos, err
+	}
+	return t, tz.start, nil
+}
+
 // Returns true if there are further tokens, false otherwise.
 func (tz *Tokenizer) HasNext() bool {
 	_, e := tz.r.PeekChar()
@@ -150,14 +364,89 @@ func (tz *Tokenizer) HasNext() bool {
 // Returns the next token in the input.
 // If an error occurs, it is not guaranteed to be recoverable.
 func (tz *Tokenizer) NextToken() (*Token, error) {
+	tz.refs = false
+	return tz.next()
+}
+
+// Returns the next token in the input as a TokenRef. Unlike NextToken, it
+// does not allocate the token or its value. The offsets of the TokenRef
+// are relative to the beginning of the input, so the value of the token
+// can be obtained by slicing the input if it is in memory.
+// If an error occurs, it is not guaranteed to be recoverable.
+func (tz *Tokenizer) NextRef() (TokenRef, error) {
+	tz.refs = true
+	_, err := tz.next()
+	if err != nil {
+		return TokenRef{}, err
+	}
+	return tz.ref, nil
+}
+
+// Returns the tokens read by |tz| as TokenRefs, up to the end of the
+// input. If lexing fails, the tokens before the error are returned along
+// with the error.
+func ReadRefs(tz *Tokenizer) ([]TokenRef, error) {
+	var refs []TokenRef
+	for tz.HasNext() {
+		t, err := tz.NextRef()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return refs, err
+		}
+		refs = append(refs, t)
+	}
+	return refs, nil
+}
+
+func (tz *Tokenizer) next() (*Token, error) {
+	var t *Token
+	var err error
+	if tz.open != token_kind.Invalid {
+		t, err = tz.readOpenToken()
+	} else {
+		t, err = tz.nextToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tz.updateState(t)
+	return t, nil
+}
+
+func (tz *Tokenizer) nextToken() (*Token, error) {
 	c, err := tz.r.PeekChar()
 	if err != nil {
 		return nil, err
 	}
 
+	lineStart := tz.r.PreviousWasNewLine() && !tz.joined
+	tz.joined = false
+	if lineStart {
+		tz.lineBegins = true
+		tz.lineIndent = 0
+		if tz.lineStartHook != nil {
+			tz.lineStartHook()
+		}
+	}
+	tz.startOffset = tz.r.NextOffset()
+	tz.startLine, tz.startCol = tz.r.NextLine(), tz.r.NextCol()
+	tz.valueOffsets = nil
+	tz.r.recorded = tz.r.recorded[:0]
+	if tz.file != nil {
+		// If |c| does not begin a token, this is updated when NextToken
+		// is called again after skipping |c|.
+		tz.start = tz.file.Pos(tz.r.NextOffset())
+	}
+	if tz.invalidBytes && tz.r.peekInvalid() {
+		return tz.readInvalidBytes()
+	}
+
 	switch {
 	case c == char.Space:
-		if tz.r.PreviousWasNewLine() && tz.indent {
+		if lineStart && tz.indent {
 			return tz.readIndentToken()
 		}
 
@@ -166,9 +455,9 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 			return nil, err
 		}
 
-		return tz.NextToken()
+		return tz.nextToken()
 	case c == char.Tab:
-		if tz.r.PreviousWasNewLine() && tz.indent {
+		if lineStart && tz.indent {
 			return tz.readIndentToken()
 		}
 
@@ -179,7 +468,7 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 				return nil, err
 			}
 
-			t := newToken(token_kind.Tab, []rune{c}, tz.r.Line(), tz.r.Col())
+			t := tz.makeToken(token_kind.Tab, append(tz.runes[:0], c), tz.r.Line(), tz.r.Col())
 			return t, nil
 		}
 
@@ -188,8 +477,8 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 			return nil, err
 		}
 
-		return tz.NextToken()
-	case c == char.NewLine || c == char.Return:
+		return tz.nextToken()
+	case c == char.NewLine:
 		c, err = tz.r.ReadChar()
 		if err != nil {
 			err = fmt.Errorf("Error reading new line character.\n%s", err.Error())
@@ -197,22 +486,25 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 		}
 
 		if tz.newLine {
-			t := newToken(
-				token_kind.NewLine, []rune{c}, tz.r.Line(), tz.r.Col())
+			v := append(tz.runes[:0], c)
+			if tz.keepNewLines {
+				v = []rune(tz.r.NewLineSpelling())
+			}
+			t := tz.makeToken(token_kind.NewLine, v, tz.r.Line(), tz.r.Col())
 			return t, nil
 		}
 
-		return tz.NextToken()
+		return tz.nextToken()
+	case c == char.BackSlash:
+		// A back slash at the end of a line joins it with the next line.
+		return tz.readLineJoin()
 	case c == char.DoubleQuote:
 		// It can either be the beginning of a double quoted string
 		// or Python mutiline/doc string.
 		if tz.ts.Contains(token_kind.PyMultilineString) {
-			q, err := tz.r.PeekSlice(3)
-			if err == nil {
-				if string(q) == TripleQuote {
-					// It is a Python mutiline string.
-					return tz.readPyMultilineString()
-				}
+			if tz.r.PeekMatch(TripleQuote) {
+				// It is a Python mutiline string.
+				return tz.readPyMultilineString()
 			}
 		}
 		if tz.ts.Contains(token_kind.DoubleQuoteString) {
@@ -235,13 +527,15 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 		if tz.ts.Contains(token_kind.PySingleLineComment) {
 			return tz.readPythonStyleComment()
 		}
+		// A '#' which does not begin a directive can still be the
+		// stringification or token pasting operator.
 		if !tz.ts.Contains(token_kind.CPPDirective) {
-			break
+			return tz.readOperator()
 		}
 
-		cc, err := tz.r.PeekSlice(2)
-		if err != nil || !isIdentifierBeginChar(cc[1]) {
-			break
+		c1, err := tz.r.PeekCharAt(1)
+		if err != nil || !tz.isIdentifierBeginChar(c1) {
+			return tz.readOperator()
 		}
 
 		line := tz.r.NextLine()
@@ -261,7 +555,7 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 
 		s := []rune{hash}
 		s = append(s, id...)
-		t := newToken(token_kind.CPPDirective, s, line, col)
+		t := tz.makeToken(token_kind.CPPDirective, s, line, col)
 		return t, nil
 	case c == char.At:
 		// Python style decorator.
@@ -269,8 +563,8 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 			break
 		}
 
-		cc, err := tz.r.PeekSlice(2)
-		if err != nil || !isIdentifierBeginChar(cc[1]) {
+		c1, err := tz.r.PeekCharAt(1)
+		if err != nil || !tz.isIdentifierBeginChar(c1) {
 			break
 		}
 
@@ -288,18 +582,18 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 
 		s := []rune{at}
 		s = append(s, id...)
-		return newToken(token_kind.PythonDecorator, s, line, col), nil
+		return tz.makeToken(token_kind.PythonDecorator, s, line, col), nil
 	case c == char.Div:
 		// It can either be the div operator itself or can be the C-style single
 		// line comment or C-style multiline comment.
-		cc, err := tz.r.PeekSlice(2)
+		c1, err := tz.r.PeekCharAt(1)
 		if err != nil {
 			return tz.readOperator()
 		}
 
-		if cc[1] == char.Div && tz.ts.Contains(token_kind.CSingleLineComment) {
+		if c1 == char.Div && tz.ts.Contains(token_kind.CSingleLineComment) {
 			return tz.readCStyleSingleLineComment()
-		} else if cc[1] == char.Mul && tz.ts.Contains(token_kind.CMultiLineComment) {
+		} else if c1 == char.Mul && tz.ts.Contains(token_kind.CMultiLineComment) {
 			return tz.readCStyleMultiLineComment()
 		} else {
 			return tz.readOperator()
@@ -307,13 +601,13 @@ func (tz *Tokenizer) NextToken() (*Token, error) {
 	case c == char.Dot:
 		// This can be the dot operator, or if it is followed by a number, then
 		// a floating point number.
-		cc, err := tz.r.PeekSlice(2)
-		f := isDecimalDigit(cc[1]) || cc[1] == 'E' || cc[1] == 'e'
+		c1, err := tz.r.PeekCharAt(1)
+		f := isDecimalDigit(c1) || c1 == 'E' || c1 == 'e'
 		if err == nil && f && tz.ts.Contains(token_kind.FloatNumber) {
 			return tz.readNumber()
 		}
 		return tz.readOperator()
-	case isIdentifierBeginChar(c):
+	case tz.isIdentifierBeginChar(c):
 		return tz.readIdentifier()
 	case isDecimalDigit(c):
 		return tz.readNumber()
@@ -333,7 +627,54 @@ func (tz *Tokenizer) newValidToken(t uint32, s []rune, l uint32, c uint32) (*Tok
 		return nil, fmt.Errorf("Unexpected '%s'.", string(s))
 	}
 
-	return newToken(t, s, l, c), nil
+	return tz.makeToken(t, s, l, c), nil
+}
+
+// Returns a token of kind |tt| with the value |val| at line |l| and column
+// |c|. The last character read should be the last character of the token.
+func (tz *Tokenizer) makeToken(tt uint32, val []rune, l uint32, c uint32) *Token {
+	if tt == token_kind.Indent {
+		tz.indentWidth = indentWidth(val)
+	}
+	if tz.security {
+		tz.checkSecurity(tt, val, l, c)
+	}
+	if cap(val) > cap(tz.runes) {
+		// The buffer can hold the value of the next token.
+		tz.runes = val[:0]
+	}
+
+	end := tz.r.NextOffset()
+	if n := len(val); tz.r.PreviousWasNewLine() && (n == 0 || val[n-1] != char.NewLine) {
+		// Single line comments read the new line at their end.
+		end -= uint32(len(tz.r.NewLineSpelling()))
+	}
+	tz.endOffset = end
+	if !tz.refs {
+		return newToken(tt, val, l, c)
+	}
+	tz.ref = TokenRef{
+		Kind:  tt,
+		Start: tz.startOffset,
+		End:   end,
+		Line:  l,
+		Col:   c,
+	}
+	tz.refToken = Token{Kind: tt, Line: l, Col: c}
+	return &tz.refToken
+}
+
+// Reads |n| characters in to the buffer for the value of the token.
+func (tz *Tokenizer) readSlice(n uint32) ([]rune, error) {
+	s := tz.runes[:0]
+	for i := uint32(0); i < n; i++ {
+		c, err := tz.r.ReadChar()
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, c)
+	}
+	return s, nil
 }
 
 func unExpectedCharacterError(c rune) error {